@@ -23,6 +23,7 @@ type Account struct {
 	LocationPrefix         string           `json:"-"`
 	ProvisionerID          string           `json:"-"`
 	ProvisionerName        string           `json:"-"`
+	CreatedAt              time.Time        `json:"-"`
 }
 
 // GetLocation returns the URL location of the given account.
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api/render"
+)
+
+// NewAuthzRequest represents the body for a NewAuthz request.
+type NewAuthzRequest struct {
+	Identifier acme.Identifier `json:"identifier"`
+}
+
+// Validate validates a new-authz request body.
+func (n *NewAuthzRequest) Validate() error {
+	switch n.Identifier.Type {
+	case acme.DNS, acme.IP:
+	default:
+		return acme.NewError(acme.ErrorUnsupportedIdentifierType,
+			"identifier type unsupported for pre-authorization: %s", n.Identifier.Type)
+	}
+	// RFC 8555 section 7.4.1: pre-authorization cannot be used to authorize
+	// issuance of certificates containing wildcard domain names.
+	if strings.HasPrefix(n.Identifier.Value, "*.") {
+		return acme.NewError(acme.ErrorMalformedType,
+			"wildcard identifiers cannot be pre-authorized: %s", n.Identifier.Value)
+	}
+	nor := &NewOrderRequest{
+		Identifiers: []acme.Identifier{n.Identifier},
+	}
+	return nor.Validate()
+}
+
+// NewAuthz ACME api for creating a new authorization before creating an
+// order. Pre-authorization is only available if the provisioner allows the
+// reuse of valid authorizations.
+func NewAuthz(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ca := mustAuthority(ctx)
+	db := acme.MustDatabaseFromContext(ctx)
+	linker := acme.MustLinkerFromContext(ctx)
+
+	acc, err := accountFromContext(ctx)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	prov, err := provisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	acmeProv, err := acmeProvisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	if acmeProv.AuthorizationReuseAge() == 0 {
+		render.Error(w, r, acme.NewError(acme.ErrorNotImplementedType,
+			"pre-authorization is not enabled for provisioner '%s'", prov.GetName()))
+		return
+	}
+	payload, err := payloadFromContext(ctx)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	var nar NewAuthzRequest
+	if err := json.Unmarshal(payload.value, &nar); err != nil {
+		render.Error(w, r, acme.WrapError(acme.ErrorMalformedType, err,
+			"failed to unmarshal new-authz request payload"))
+		return
+	}
+	if err := nar.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	var eak *acme.ExternalAccountKey
+	if acmeProv.RequireEAB {
+		if eak, err = db.GetExternalAccountKeyByAccountID(ctx, prov.GetID(), acc.ID); err != nil {
+			render.Error(w, r, acme.WrapErrorISE(err, "error retrieving external account binding key"))
+			return
+		}
+	}
+
+	acmePolicy, err := newACMEPolicyEngine(eak)
+	if err != nil {
+		render.Error(w, r, acme.WrapErrorISE(err, "error creating ACME policy engine"))
+		return
+	}
+	if err := authorizeIdentifier(ctx, ca, prov, acmePolicy, nar.Identifier); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	az := &acme.Authorization{
+		AccountID:  acc.ID,
+		Identifier: nar.Identifier,
+		ExpiresAt:  clock.Now().Add(defaultOrderExpiry),
+		Status:     acme.StatusPending,
+	}
+	if err := newAuthorization(ctx, az); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	linker.LinkAuthorization(ctx, az)
+
+	w.Header().Set("Location", linker.GetLink(ctx, acme.AuthzLinkType, az.ID))
+	render.JSONStatus(w, r, az, http.StatusCreated)
+}
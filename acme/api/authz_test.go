@@ -0,0 +1,329 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func newACMEProvWithReuse(t *testing.T, reuse time.Duration) *provisioner.ACME {
+	t.Helper()
+	p := &provisioner.ACME{
+		Type:               "ACME",
+		Name:               "test@acme-<test>provisioner.com",
+		AuthorizationReuse: &provisioner.Duration{Duration: reuse},
+	}
+	require.NoError(t, p.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+	return p
+}
+
+func TestNewAuthzRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		nar     *NewAuthzRequest
+		wantErr *acme.Error
+	}{
+		{"ok/dns", &NewAuthzRequest{Identifier: acme.Identifier{Type: "dns", Value: "example.com"}}, nil},
+		{"ok/ip", &NewAuthzRequest{Identifier: acme.Identifier{Type: "ip", Value: "192.168.42.42"}}, nil},
+		{"fail/type", &NewAuthzRequest{Identifier: acme.Identifier{Type: "permanent-identifier", Value: "12345"}},
+			acme.NewError(acme.ErrorUnsupportedIdentifierType, "identifier type unsupported for pre-authorization: permanent-identifier")},
+		{"fail/wildcard", &NewAuthzRequest{Identifier: acme.Identifier{Type: "dns", Value: "*.example.com"}},
+			acme.NewError(acme.ErrorMalformedType, "wildcard identifiers cannot be pre-authorized: *.example.com")},
+		{"fail/ip", &NewAuthzRequest{Identifier: acme.Identifier{Type: "ip", Value: "192.168.42.1000"}},
+			acme.NewError(acme.ErrorMalformedType, "invalid IP address: 192.168.42.1000")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.nar.Validate()
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var ae *acme.Error
+			require.True(t, errors.As(err, &ae))
+			assert.Equal(t, tt.wantErr.Type, ae.Type)
+			assert.Equal(t, tt.wantErr.Detail, ae.Detail)
+		})
+	}
+}
+
+func Test_reusableAuthorization(t *testing.T) {
+	identifier := acme.Identifier{Type: "dns", Value: "example.com"}
+	now := clock.Now()
+	expiresAt := now.Add(24 * time.Hour)
+	validated := func(d time.Duration) *acme.Authorization {
+		return &acme.Authorization{
+			ID:         "azID",
+			AccountID:  "accID",
+			Identifier: identifier,
+			Status:     acme.StatusValid,
+			ExpiresAt:  expiresAt,
+			Challenges: []*acme.Challenge{
+				{Status: acme.StatusPending},
+				{Status: acme.StatusValid, ValidatedAt: clock.Now().Add(-d).Format(time.RFC3339)},
+			},
+		}
+	}
+	dbReturning := func(az *acme.Authorization, err error) *acme.MockDB {
+		return &acme.MockDB{
+			MockGetValidAuthorizationByIdentifier: func(ctx context.Context, accountID string, id acme.Identifier) (*acme.Authorization, error) {
+				assert.Equal(t, "accID", accountID)
+				assert.Equal(t, identifier, id)
+				return az, err
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		db      acme.DB
+		maxAge  time.Duration
+		want    *acme.Authorization
+		wantErr bool
+	}{
+		{"ok/disabled", &acme.MockDB{}, 0, nil, false},
+		{"ok/not-found", dbReturning(nil, acme.ErrNotFound), time.Hour, nil, false},
+		{"ok/reuse", dbReturning(validated(time.Minute), nil), time.Hour, validated(time.Minute), false},
+		{"ok/too-old", dbReturning(validated(2*time.Hour), nil), time.Hour, nil, false},
+		{"ok/expired", dbReturning(func() *acme.Authorization {
+			az := validated(time.Minute)
+			az.ExpiresAt = now.Add(-time.Minute)
+			return az
+		}(), nil), time.Hour, nil, false},
+		{"ok/expires-before-order", dbReturning(func() *acme.Authorization {
+			az := validated(time.Minute)
+			az.ExpiresAt = now.Add(time.Hour)
+			return az
+		}(), nil), time.Hour, func() *acme.Authorization {
+			az := validated(time.Minute)
+			az.ExpiresAt = now.Add(time.Hour)
+			return az
+		}(), false},
+		{"ok/other-account", dbReturning(&acme.Authorization{AccountID: "otherID", Status: acme.StatusValid}, nil), time.Hour, nil, false},
+		{"ok/not-valid", dbReturning(&acme.Authorization{AccountID: "accID", Status: acme.StatusPending}, nil), time.Hour, nil, false},
+		{"fail/db-error", dbReturning(nil, errors.New("force")), time.Hour, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reusableAuthorization(context.Background(), tt.db, "accID", identifier, tt.maxAge)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewAuthz_reusedInNewOrder(t *testing.T) {
+	acc := &acme.Account{ID: "accID"}
+	identifier := acme.Identifier{Type: "dns", Value: "example.com"}
+	prov := newACMEProvWithReuse(t, 7*24*time.Hour)
+	mockMustAuthority(t, &mockCA{})
+
+	var (
+		stored  *acme.Authorization
+		created *acme.Order
+		authzs  int
+	)
+	db := &acme.MockDB{
+		MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+			ch.ID = "chID-" + string(ch.Type)
+			return nil
+		},
+		MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+			authzs++
+			az.ID = "azID"
+			stored = az
+			return nil
+		},
+		MockUpdateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+			stored = az
+			return nil
+		},
+		MockGetValidAuthorizationByIdentifier: func(ctx context.Context, accountID string, id acme.Identifier) (*acme.Authorization, error) {
+			if stored == nil || stored.Status != acme.StatusValid {
+				return nil, acme.ErrNotFound
+			}
+			return stored, nil
+		},
+		MockCreateOrder: func(ctx context.Context, o *acme.Order) error {
+			o.ID = "ordID"
+			created = o
+			return nil
+		},
+	}
+	newContext := func(v any) context.Context {
+		b, err := json.Marshal(v)
+		require.NoError(t, err)
+		ctx := acme.NewProvisionerContext(context.Background(), prov)
+		ctx = context.WithValue(ctx, accContextKey, acc)
+		ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+		return newBaseContext(ctx, db, acme.NewLinker("test.ca.smallstep.com", "acme"))
+	}
+
+	// pre-authorize the identifier
+	req := httptest.NewRequest("POST", "https://test.ca.smallstep.com/acme/test/new-authz", http.NoBody)
+	w := httptest.NewRecorder()
+	NewAuthz(w, req.WithContext(newContext(NewAuthzRequest{Identifier: identifier})))
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.NotNil(t, stored)
+	createdExpiresAt := stored.ExpiresAt
+
+	// validate one of its challenges
+	now := clock.Now()
+	stored.Challenges[0].Status = acme.StatusValid
+	stored.Challenges[0].ValidatedAt = now.Format(time.RFC3339)
+	require.NoError(t, stored.UpdateStatus(acme.NewProvisionerContext(context.Background(), prov), db))
+	assert.Equal(t, acme.StatusValid, stored.Status)
+	assert.True(t, stored.ExpiresAt.After(createdExpiresAt))
+
+	// a later order reuses the authorization
+	req = httptest.NewRequest("POST", "https://test.ca.smallstep.com/acme/test/new-order", http.NoBody)
+	w = httptest.NewRecorder()
+	NewOrder(w, req.WithContext(newContext(NewOrderRequest{Identifiers: []acme.Identifier{identifier}})))
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.NotNil(t, created)
+	assert.Equal(t, []string{"azID"}, created.AuthorizationIDs)
+	assert.Equal(t, 1, authzs)
+	assert.False(t, created.ExpiresAt.After(stored.ExpiresAt))
+}
+
+func TestHandler_NewAuthz(t *testing.T) {
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+	acc := &acme.Account{ID: "accID"}
+	mustPayload := func(t *testing.T, v any) *payloadInfo {
+		b, err := json.Marshal(v)
+		require.NoError(t, err)
+		return &payloadInfo{value: b}
+	}
+
+	type test struct {
+		db         acme.DB
+		prov       acme.Provisioner
+		payload    *payloadInfo
+		statusCode int
+		err        *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/not-enabled": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				prov:       newProv(),
+				statusCode: 501,
+				err:        acme.NewError(acme.ErrorNotImplementedType, "pre-authorization is not enabled for provisioner 'test@acme-<test>provisioner.com'"),
+			}
+		},
+		"fail/unmarshal": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				prov:       newACMEProvWithReuse(t, time.Hour),
+				payload:    &payloadInfo{value: []byte("{")},
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "failed to unmarshal new-authz request payload: unexpected end of JSON input"),
+			}
+		},
+		"fail/wildcard": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				prov:       newACMEProvWithReuse(t, time.Hour),
+				payload:    mustPayload(t, NewAuthzRequest{Identifier: acme.Identifier{Type: "dns", Value: "*.example.com"}}),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "wildcard identifiers cannot be pre-authorized: *.example.com"),
+			}
+		},
+		"fail/db.CreateAuthorization-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						ch.ID = "chID"
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						return errors.New("force")
+					},
+				},
+				prov:       newACMEProvWithReuse(t, time.Hour),
+				payload:    mustPayload(t, NewAuthzRequest{Identifier: acme.Identifier{Type: "dns", Value: "example.com"}}),
+				statusCode: 500,
+				err:        acme.NewErrorISE("error creating authorization: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						assert.Equal(t, "accID", ch.AccountID)
+						assert.Equal(t, "example.com", ch.Value)
+						ch.ID = "chID-" + string(ch.Type)
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						assert.Equal(t, "accID", az.AccountID)
+						assert.Equal(t, acme.StatusPending, az.Status)
+						assert.Equal(t, acme.Identifier{Type: "dns", Value: "example.com"}, az.Identifier)
+						az.ID = "azID"
+						return nil
+					},
+				},
+				prov:       newACMEProvWithReuse(t, time.Hour),
+				payload:    mustPayload(t, NewAuthzRequest{Identifier: acme.Identifier{Type: "dns", Value: "example.com"}}),
+				statusCode: 201,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, &mockCA{})
+			ctx := acme.NewProvisionerContext(context.Background(), tc.prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			if tc.payload != nil {
+				ctx = context.WithValue(ctx, payloadContextKey, tc.payload)
+			}
+			ctx = newBaseContext(ctx, tc.db, acme.NewLinker("test.ca.smallstep.com", "acme"))
+			req := httptest.NewRequest("POST", "https://test.ca.smallstep.com/acme/test/new-authz", http.NoBody)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			NewAuthz(w, req)
+			res := w.Result()
+
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+
+			if res.StatusCode >= 400 {
+				var ae acme.Error
+				require.NoError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+				assert.Equal(t, tc.err.Type, ae.Type)
+				assert.Equal(t, tc.err.Detail, ae.Detail)
+				return
+			}
+
+			var az acme.Authorization
+			require.NoError(t, json.Unmarshal(body, &az))
+			assert.Equal(t, acme.StatusPending, az.Status)
+			assert.Equal(t, acme.Identifier{Type: "dns", Value: "example.com"}, az.Identifier)
+			assert.False(t, az.Wildcard)
+			assert.NotEmpty(t, az.Challenges)
+			assert.Equal(t, []string{fmt.Sprintf("%s/acme/%s/authz/azID", baseURL.String(), url.PathEscape(tc.prov.GetName()))}, res.Header["Location"])
+		})
+	}
+}
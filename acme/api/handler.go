@@ -166,17 +166,23 @@ func route(r api.Router, middleware func(next nextHTTP) nextHTTP) {
 	r.MethodFunc("POST", getPath(acme.NewOrderLinkType, "{provisionerID}"),
 		extractPayloadByKid(NewOrder))
 	r.MethodFunc("POST", getPath(acme.OrderLinkType, "{provisionerID}", "{ordID}"),
-		extractPayloadByKid(isPostAsGet(GetOrder)))
+		extractPayloadByKid(GetOrUpdateOrder))
 	r.MethodFunc("POST", getPath(acme.OrdersByAccountLinkType, "{provisionerID}", "{accID}"),
 		extractPayloadByKid(isPostAsGet(GetOrdersByAccountID)))
 	r.MethodFunc("POST", getPath(acme.FinalizeLinkType, "{provisionerID}", "{ordID}"),
 		extractPayloadByKid(FinalizeOrder))
+	r.MethodFunc("POST", getPath(acme.NewAuthzLinkType, "{provisionerID}"),
+		extractPayloadByKid(NewAuthz))
 	r.MethodFunc("POST", getPath(acme.AuthzLinkType, "{provisionerID}", "{authzID}"),
 		extractPayloadByKid(isPostAsGet(GetAuthorization)))
 	r.MethodFunc("POST", getPath(acme.ChallengeLinkType, "{provisionerID}", "{authzID}", "{chID}"),
 		extractPayloadByKid(GetChallenge))
 	r.MethodFunc("POST", getPath(acme.CertificateLinkType, "{provisionerID}", "{certID}"),
 		extractPayloadByKid(isPostAsGet(GetCertificate)))
+	r.MethodFunc("POST", getPath(acme.StarCertificateLinkType, "{provisionerID}", "{ordID}"),
+		extractPayloadByKid(isPostAsGet(GetStarCertificate)))
+	r.MethodFunc("GET", getPath(acme.StarCertificateLinkType, "{provisionerID}", "{ordID}"),
+		commonMiddleware(GetStarCertificate))
 	r.MethodFunc("POST", getPath(acme.RevokeCertLinkType, "{provisionerID}"),
 		extractPayloadByKidOrJWK(RevokeCert))
 }
@@ -192,10 +198,11 @@ func GetNonce(w http.ResponseWriter, r *http.Request) {
 }
 
 type Meta struct {
-	TermsOfService          string   `json:"termsOfService,omitempty"`
-	Website                 string   `json:"website,omitempty"`
-	CaaIdentities           []string `json:"caaIdentities,omitempty"`
-	ExternalAccountRequired bool     `json:"externalAccountRequired,omitempty"`
+	TermsOfService          string           `json:"termsOfService,omitempty"`
+	Website                 string           `json:"website,omitempty"`
+	CaaIdentities           []string         `json:"caaIdentities,omitempty"`
+	ExternalAccountRequired bool             `json:"externalAccountRequired,omitempty"`
+	AutoRenewal             *AutoRenewalMeta `json:"auto-renewal,omitempty"`
 }
 
 // Directory represents an ACME directory for configuring clients.
@@ -203,6 +210,7 @@ type Directory struct {
 	NewNonce   string `json:"newNonce"`
 	NewAccount string `json:"newAccount"`
 	NewOrder   string `json:"newOrder"`
+	NewAuthz   string `json:"newAuthz,omitempty"`
 	RevokeCert string `json:"revokeCert"`
 	KeyChange  string `json:"keyChange"`
 	Meta       *Meta  `json:"meta,omitempty"`
@@ -229,10 +237,18 @@ func GetDirectory(w http.ResponseWriter, r *http.Request) {
 
 	linker := acme.MustLinkerFromContext(ctx)
 
+	// The newAuthz resource is only advertised if pre-authorization is
+	// enabled.
+	var newAuthz string
+	if acmeProv.AuthorizationReuseAge() > 0 {
+		newAuthz = linker.GetLink(ctx, acme.NewAuthzLinkType)
+	}
+
 	render.JSON(w, r, &Directory{
 		NewNonce:   linker.GetLink(ctx, acme.NewNonceLinkType),
 		NewAccount: linker.GetLink(ctx, acme.NewAccountLinkType),
 		NewOrder:   linker.GetLink(ctx, acme.NewOrderLinkType),
+		NewAuthz:   newAuthz,
 		RevokeCert: linker.GetLink(ctx, acme.RevokeCertLinkType),
 		KeyChange:  linker.GetLink(ctx, acme.KeyChangeLinkType),
 		Meta:       createMetaObject(acmeProv),
@@ -249,6 +265,7 @@ func createMetaObject(p *provisioner.ACME) *Meta {
 			Website:                 p.Website,
 			CaaIdentities:           p.CaaIdentities,
 			ExternalAccountRequired: p.RequireEAB,
+			AutoRenewal:             createAutoRenewalMeta(p),
 		}
 	}
 	return nil
@@ -266,6 +283,8 @@ func shouldAddMetaObject(p *provisioner.ACME) bool {
 		return true
 	case p.RequireEAB:
 		return true
+	case p.AutoRenewal != nil:
+		return true
 	default:
 		return false
 	}
@@ -385,6 +404,12 @@ func GetCertificate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	writeCertificateChain(w, cert)
+}
+
+// writeCertificateChain writes the PEM encoded certificate chain to the
+// response.
+func writeCertificateChain(w http.ResponseWriter, cert *acme.Certificate) {
 	var certBytes []byte
 	for _, c := range append([]*x509.Certificate{cert.Leaf}, cert.Intermediates...) {
 		certBytes = append(certBytes, pem.EncodeToMemory(&pem.Block{
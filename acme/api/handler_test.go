@@ -170,6 +170,26 @@ func TestHandler_GetDirectory(t *testing.T) {
 				statusCode: 200,
 			}
 		},
+		"ok/authorization-reuse": func(t *testing.T) test {
+			prov := newACMEProv(t)
+			prov.AuthorizationReuse = &provisioner.Duration{Duration: time.Hour}
+			provName := url.PathEscape(prov.GetName())
+			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			expDir := Directory{
+				NewNonce:   fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount: fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:   fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				NewAuthz:   fmt.Sprintf("%s/acme/%s/new-authz", baseURL.String(), provName),
+				RevokeCert: fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:  fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+			}
+			return test{
+				ctx:        ctx,
+				dir:        expDir,
+				statusCode: 200,
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
@@ -826,6 +846,23 @@ func Test_createMetaObject(t *testing.T) {
 				CaaIdentities: []string{"ca.local", "ca.remote"},
 			},
 		},
+		{
+			name: "auto-renewal",
+			p: &provisioner.ACME{
+				Type: "ACME",
+				Name: "acme",
+				AutoRenewal: &provisioner.ACMEAutoRenewal{
+					AllowCertificateGet: true,
+				},
+			},
+			want: &Meta{
+				AutoRenewal: &AutoRenewalMeta{
+					MinLifetime:         3600,
+					MaxDuration:         31536000,
+					AllowCertificateGet: true,
+				},
+			},
+		},
 		{
 			name: "require-eab",
 			p: &provisioner.ACME{
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -28,6 +29,7 @@ type NewOrderRequest struct {
 	Identifiers []acme.Identifier `json:"identifiers"`
 	NotBefore   time.Time         `json:"notBefore,omitempty"`
 	NotAfter    time.Time         `json:"notAfter,omitempty"`
+	AutoRenewal *acme.AutoRenewal `json:"auto-renewal,omitempty"`
 }
 
 // Validate validates a new-order request body.
@@ -206,6 +208,14 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	now := clock.Now()
+	if nor.AutoRenewal != nil {
+		if err := validateAutoRenewal(acmeProv, &nor, now); err != nil {
+			render.Error(w, r, err)
+			return
+		}
+	}
+
 	var eak *acme.ExternalAccountKey
 	if acmeProv.RequireEAB {
 		if eak, err = db.GetExternalAccountKeyByAccountID(ctx, prov.GetID(), acc.ID); err != nil {
@@ -221,25 +231,12 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, identifier := range nor.Identifiers {
-		// evaluate the ACME account level policy
-		if err = isIdentifierAllowed(acmePolicy, identifier); err != nil {
-			render.Error(w, r, acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized"))
-			return
-		}
-		// evaluate the provisioner level policy
-		orderIdentifier := provisioner.ACMEIdentifier{Type: provisioner.ACMEIdentifierType(identifier.Type), Value: identifier.Value}
-		if err = prov.AuthorizeOrderIdentifier(ctx, orderIdentifier); err != nil {
-			render.Error(w, r, acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized"))
-			return
-		}
-		// evaluate the authority level policy
-		if err = ca.AreSANsAllowed(ctx, []string{identifier.Value}); err != nil {
-			render.Error(w, r, acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized"))
+		if err := authorizeIdentifier(ctx, ca, prov, acmePolicy, identifier); err != nil {
+			render.Error(w, r, err)
 			return
 		}
 	}
 
-	now := clock.Now()
 	// New order.
 	o := &acme.Order{
 		AccountID:        acc.ID,
@@ -250,19 +247,31 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		AuthorizationIDs: make([]string, len(nor.Identifiers)),
 		NotBefore:        nor.NotBefore,
 		NotAfter:         nor.NotAfter,
+		AutoRenewal:      nor.AutoRenewal,
 	}
 
 	for i, identifier := range o.Identifiers {
-		az := &acme.Authorization{
-			AccountID:  acc.ID,
-			Identifier: identifier,
-			ExpiresAt:  o.ExpiresAt,
-			Status:     acme.StatusPending,
-		}
-		if err := newAuthorization(ctx, az); err != nil {
+		// reuse a recently validated authorization if enabled
+		az, err := reusableAuthorization(ctx, db, acc.ID, identifier, acmeProv.AuthorizationReuseAge())
+		if err != nil {
 			render.Error(w, r, err)
 			return
 		}
+		if az == nil {
+			az = &acme.Authorization{
+				AccountID:  acc.ID,
+				Identifier: identifier,
+				ExpiresAt:  o.ExpiresAt,
+				Status:     acme.StatusPending,
+			}
+			if err := newAuthorization(ctx, az); err != nil {
+				render.Error(w, r, err)
+				return
+			}
+		} else if az.ExpiresAt.Before(o.ExpiresAt) {
+			// the order cannot outlive the authorizations it reuses
+			o.ExpiresAt = az.ExpiresAt
+		}
 		o.AuthorizationIDs[i] = az.ID
 	}
 
@@ -283,6 +292,12 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		o.NotBefore = o.NotBefore.Add(-backdate)
 	}
 
+	// The validity of the certificates of STAR orders is defined by the
+	// auto-renewal attributes.
+	if o.IsAutoRenewal() {
+		o.NotBefore, o.NotAfter = o.AutoRenewal.Validity(o.AutoRenewal.StartDate)
+	}
+
 	if err := db.CreateOrder(ctx, o); err != nil {
 		render.Error(w, r, acme.WrapErrorISE(err, "error creating order"))
 		return
@@ -294,6 +309,54 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 	render.JSONStatus(w, r, o, http.StatusCreated)
 }
 
+// authorizeIdentifier evaluates the ACME account, provisioner and authority
+// level policies for the given identifier.
+func authorizeIdentifier(ctx context.Context, ca acme.CertificateAuthority, prov acme.Provisioner, acmePolicy policy.X509Policy, identifier acme.Identifier) error {
+	// evaluate the ACME account level policy
+	if err := isIdentifierAllowed(acmePolicy, identifier); err != nil {
+		return acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized")
+	}
+	// evaluate the provisioner level policy
+	orderIdentifier := provisioner.ACMEIdentifier{Type: provisioner.ACMEIdentifierType(identifier.Type), Value: identifier.Value}
+	if err := prov.AuthorizeOrderIdentifier(ctx, orderIdentifier); err != nil {
+		return acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized")
+	}
+	// evaluate the authority level policy
+	if err := ca.AreSANsAllowed(ctx, []string{identifier.Value}); err != nil {
+		return acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized")
+	}
+	return nil
+}
+
+// reusableAuthorization returns a valid authorization of the account for the
+// given order identifier if it was validated within maxAge and has not
+// expired. It returns nil if there's no such authorization or if maxAge is 0.
+//
+//nolint:nilnil // a nil authorization means that there's nothing to reuse
+func reusableAuthorization(ctx context.Context, db acme.DB, accountID string, identifier acme.Identifier, maxAge time.Duration) (*acme.Authorization, error) {
+	if maxAge <= 0 {
+		return nil, nil
+	}
+
+	az, err := db.GetValidAuthorizationByIdentifier(ctx, accountID, identifier)
+	switch {
+	case acme.IsErrNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, acme.WrapErrorISE(err, "error retrieving authorization for %s", identifier.Value)
+	case az.AccountID != accountID || az.Status != acme.StatusValid:
+		return nil, nil
+	case !az.ExpiresAt.After(clock.Now()):
+		return nil, nil
+	}
+
+	validatedAt := az.ValidatedAt()
+	if validatedAt.IsZero() || clock.Now().Sub(validatedAt) > maxAge {
+		return nil, nil
+	}
+	return az, nil
+}
+
 func isIdentifierAllowed(acmePolicy policy.X509Policy, identifier acme.Identifier) error {
 	if acmePolicy == nil {
 		return nil
@@ -428,6 +491,87 @@ func GetOrder(w http.ResponseWriter, r *http.Request) {
 
 	linker.LinkOrder(ctx, o)
 
+	w.Header().Set("Location", linker.GetLink(ctx, acme.OrderLinkType, o.ID))
+	setRetryAfter(w, o)
+	render.JSON(w, r, o)
+}
+
+// UpdateOrderRequest represents the body of a request to update an order.
+// The only update supported is the cancellation of an auto-renewal order.
+type UpdateOrderRequest struct {
+	Status acme.Status `json:"status"`
+}
+
+// Validate validates an update-order request body.
+func (u *UpdateOrderRequest) Validate() error {
+	if u.Status != acme.StatusCanceled {
+		return acme.NewError(acme.ErrorMalformedType,
+			"cannot update order status to '%s', only '%s' is allowed", u.Status, acme.StatusCanceled)
+	}
+	return nil
+}
+
+// GetOrUpdateOrder ACME api for retrieving an order or canceling an
+// auto-renewal order.
+func GetOrUpdateOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db := acme.MustDatabaseFromContext(ctx)
+	linker := acme.MustLinkerFromContext(ctx)
+
+	payload, err := payloadFromContext(ctx)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	if payload.isPostAsGet {
+		GetOrder(w, r)
+		return
+	}
+
+	acc, err := accountFromContext(ctx)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	prov, err := provisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	var uor UpdateOrderRequest
+	if err := json.Unmarshal(payload.value, &uor); err != nil {
+		render.Error(w, r, acme.WrapError(acme.ErrorMalformedType, err,
+			"failed to unmarshal update-order request payload"))
+		return
+	}
+	if err := uor.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	o, err := db.GetOrder(ctx, chi.URLParam(r, "ordID"))
+	if err != nil {
+		render.Error(w, r, acme.WrapErrorISE(err, "error retrieving order"))
+		return
+	}
+	if acc.ID != o.AccountID {
+		render.Error(w, r, acme.NewError(acme.ErrorUnauthorizedType,
+			"account '%s' does not own order '%s'", acc.ID, o.ID))
+		return
+	}
+	if prov.GetID() != o.ProvisionerID {
+		render.Error(w, r, acme.NewError(acme.ErrorUnauthorizedType,
+			"provisioner '%s' does not own order '%s'", prov.GetID(), o.ID))
+		return
+	}
+	if err := o.CancelAutoRenewal(ctx, db); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	linker.LinkOrder(ctx, o)
+
 	w.Header().Set("Location", linker.GetLink(ctx, acme.OrderLinkType, o.ID))
 	render.JSON(w, r, o)
 }
@@ -489,6 +633,7 @@ func FinalizeOrder(w http.ResponseWriter, r *http.Request) {
 	linker.LinkOrder(ctx, o)
 
 	w.Header().Set("Location", linker.GetLink(ctx, acme.OrderLinkType, o.ID))
+	setRetryAfter(w, o)
 	render.JSON(w, r, o)
 }
 
@@ -518,3 +663,11 @@ func challengeTypes(az *acme.Authorization) []acme.ChallengeType {
 
 	return chTypes
 }
+
+// setRetryAfter sets the Retry-After header if the order is being processed,
+// so clients know when to poll the order again.
+func setRetryAfter(w http.ResponseWriter, o *acme.Order) {
+	if o.Status == acme.StatusProcessing {
+		w.Header().Set("Retry-After", strconv.Itoa(acme.FinalizeRetryAfter))
+	}
+}
@@ -2747,3 +2747,13 @@ func TestTrimIfWildcard(t *testing.T) {
 		})
 	}
 }
+
+func Test_setRetryAfter(t *testing.T) {
+	w := httptest.NewRecorder()
+	setRetryAfter(w, &acme.Order{Status: acme.StatusProcessing})
+	assert.Equals(t, w.Header().Get("Retry-After"), "2")
+
+	w = httptest.NewRecorder()
+	setRetryAfter(w, &acme.Order{Status: acme.StatusValid})
+	assert.Equals(t, w.Header().Get("Retry-After"), "")
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// AutoRenewalMeta represents the auto-renewal capabilities advertised in the
+// directory meta object as defined in RFC 8739.
+type AutoRenewalMeta struct {
+	MinLifetime         int64 `json:"min-lifetime"`
+	MaxDuration         int64 `json:"max-duration"`
+	AllowCertificateGet bool  `json:"allow-certificate-get,omitempty"`
+}
+
+// createAutoRenewalMeta returns the auto-renewal capabilities of the
+// provisioner, or nil if STAR orders are not enabled.
+func createAutoRenewalMeta(p *provisioner.ACME) *AutoRenewalMeta {
+	if p.AutoRenewal == nil {
+		return nil
+	}
+	return &AutoRenewalMeta{
+		MinLifetime:         int64(p.AutoRenewal.GetMinLifetime() / time.Second),
+		MaxDuration:         int64(p.AutoRenewal.GetMaxDuration() / time.Second),
+		AllowCertificateGet: p.AutoRenewal.AllowCertificateGet,
+	}
+}
+
+// validateAutoRenewal validates the auto-renewal attributes of a new-order
+// request using the configuration of the provisioner. The start date defaults
+// to now if it's not set or if it's in the past.
+func validateAutoRenewal(p *provisioner.ACME, nor *NewOrderRequest, now time.Time) error {
+	ar := nor.AutoRenewal
+	if p.AutoRenewal == nil {
+		return acme.NewError(acme.ErrorMalformedType,
+			"auto-renewal is not supported by provisioner '%s'", p.GetName())
+	}
+	if !nor.NotBefore.IsZero() || !nor.NotAfter.IsZero() {
+		return acme.NewError(acme.ErrorMalformedType,
+			"notBefore and notAfter cannot be used in auto-renewal orders")
+	}
+
+	if ar.StartDate.Before(now) {
+		ar.StartDate = now
+	}
+	ar.StartDate = ar.StartDate.UTC().Truncate(time.Second)
+	ar.EndDate = ar.EndDate.UTC().Truncate(time.Second)
+
+	minLifetime := p.AutoRenewal.GetMinLifetime()
+	maxDuration := p.AutoRenewal.GetMaxDuration()
+	switch {
+	case !ar.EndDate.After(ar.StartDate):
+		return acme.NewError(acme.ErrorMalformedType, "auto-renewal end-date must be after start-date")
+	case ar.EndDate.Sub(ar.StartDate) > maxDuration:
+		return acme.NewError(acme.ErrorMalformedType,
+			"auto-renewal duration cannot be longer than %d seconds", int64(maxDuration/time.Second))
+	case ar.GetLifetime() < minLifetime:
+		return acme.NewError(acme.ErrorMalformedType,
+			"auto-renewal lifetime cannot be shorter than %d seconds", int64(minLifetime/time.Second))
+	case ar.LifetimeAdjust < 0:
+		return acme.NewError(acme.ErrorMalformedType, "auto-renewal lifetime-adjust cannot be negative")
+	case ar.AllowCertificateGet && !p.AutoRenewal.AllowCertificateGet:
+		return acme.NewError(acme.ErrorMalformedType, "auto-renewal allow-certificate-get is not allowed")
+	default:
+		return nil
+	}
+}
+
+// GetStarCertificate ACME api for retrieving the latest certificate of a STAR
+// order. Unauthenticated GET requests are only allowed if the order was
+// created with allow-certificate-get.
+func GetStarCertificate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db := acme.MustDatabaseFromContext(ctx)
+
+	prov, err := provisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	ordID := chi.URLParam(r, "ordID")
+	so, err := db.GetStarOrder(ctx, ordID)
+	if err != nil {
+		render.Error(w, r, acme.WrapErrorISE(err, "error retrieving star order"))
+		return
+	}
+	if prov.GetName() != so.ProvisionerName {
+		render.Error(w, r, acme.NewError(acme.ErrorUnauthorizedType,
+			"provisioner '%s' does not own order '%s'", prov.GetName(), ordID))
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		if !so.AutoRenewal.AllowCertificateGet {
+			render.Error(w, r, acme.NewError(acme.ErrorUnauthorizedType,
+				"certificate of order '%s' cannot be retrieved without authentication", ordID))
+			return
+		}
+	} else {
+		acc, err := accountFromContext(ctx)
+		if err != nil {
+			render.Error(w, r, err)
+			return
+		}
+		if acc.ID != so.AccountID {
+			render.Error(w, r, acme.NewError(acme.ErrorUnauthorizedType,
+				"account '%s' does not own order '%s'", acc.ID, ordID))
+			return
+		}
+	}
+
+	now := clock.Now()
+	switch {
+	case so.Status == acme.StatusCanceled:
+		render.Error(w, r, acme.NewError(acme.ErrorAutoRenewalCanceledType,
+			"auto-renewal order '%s' has been canceled", ordID))
+		return
+	case so.IsExpired(now):
+		render.Error(w, r, acme.NewError(acme.ErrorAutoRenewalExpiredType,
+			"auto-renewal order '%s' has expired", ordID))
+		return
+	}
+
+	cert, err := db.GetCertificate(ctx, so.GetCertificateID(now))
+	if err != nil {
+		render.Error(w, r, acme.WrapErrorISE(err, "error retrieving certificate"))
+		return
+	}
+
+	w.Header().Set("Cert-Not-Before", cert.Leaf.NotBefore.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cert-Not-After", cert.Leaf.NotAfter.UTC().Format(http.TimeFormat))
+	writeCertificateChain(w, cert)
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func newACMEProvWithAutoRenewal(t *testing.T) *provisioner.ACME {
+	t.Helper()
+	p := newACMEProv(t)
+	p.AutoRenewal = &provisioner.ACMEAutoRenewal{
+		MinLifetime: &provisioner.Duration{Duration: time.Hour},
+		MaxDuration: &provisioner.Duration{Duration: 30 * 24 * time.Hour},
+	}
+	return p
+}
+
+func Test_validateAutoRenewal(t *testing.T) {
+	now := clock.Now()
+	day := int64((24 * time.Hour).Seconds())
+	tests := []struct {
+		name    string
+		prov    *provisioner.ACME
+		nor     *NewOrderRequest
+		wantErr string
+	}{
+		{"ok", newACMEProvWithAutoRenewal(t), &NewOrderRequest{AutoRenewal: &acme.AutoRenewal{
+			EndDate: now.Add(7 * 24 * time.Hour), Lifetime: day,
+		}}, ""},
+		{"fail/not-enabled", newACMEProv(t), &NewOrderRequest{AutoRenewal: &acme.AutoRenewal{
+			EndDate: now.Add(7 * 24 * time.Hour), Lifetime: day,
+		}}, "auto-renewal is not supported by provisioner 'test@acme-<test>provisioner.com'"},
+		{"fail/notAfter", newACMEProvWithAutoRenewal(t), &NewOrderRequest{NotAfter: now.Add(time.Hour), AutoRenewal: &acme.AutoRenewal{
+			EndDate: now.Add(7 * 24 * time.Hour), Lifetime: day,
+		}}, "notBefore and notAfter cannot be used in auto-renewal orders"},
+		{"fail/end-date", newACMEProvWithAutoRenewal(t), &NewOrderRequest{AutoRenewal: &acme.AutoRenewal{
+			Lifetime: day,
+		}}, "auto-renewal end-date must be after start-date"},
+		{"fail/max-duration", newACMEProvWithAutoRenewal(t), &NewOrderRequest{AutoRenewal: &acme.AutoRenewal{
+			EndDate: now.Add(60 * 24 * time.Hour), Lifetime: day,
+		}}, "auto-renewal duration cannot be longer than 2592000 seconds"},
+		{"fail/min-lifetime", newACMEProvWithAutoRenewal(t), &NewOrderRequest{AutoRenewal: &acme.AutoRenewal{
+			EndDate: now.Add(7 * 24 * time.Hour), Lifetime: 60,
+		}}, "auto-renewal lifetime cannot be shorter than 3600 seconds"},
+		{"fail/lifetime-adjust", newACMEProvWithAutoRenewal(t), &NewOrderRequest{AutoRenewal: &acme.AutoRenewal{
+			EndDate: now.Add(7 * 24 * time.Hour), Lifetime: day, LifetimeAdjust: -1,
+		}}, "auto-renewal lifetime-adjust cannot be negative"},
+		{"fail/allow-certificate-get", newACMEProvWithAutoRenewal(t), &NewOrderRequest{AutoRenewal: &acme.AutoRenewal{
+			EndDate: now.Add(7 * 24 * time.Hour), Lifetime: day, AllowCertificateGet: true,
+		}}, "auto-renewal allow-certificate-get is not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAutoRenewal(tt.prov, tt.nor, now)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				assert.Equal(t, now, tt.nor.AutoRenewal.StartDate)
+				return
+			}
+			var ae *acme.Error
+			require.True(t, errors.As(err, &ae))
+			assert.Equal(t, acme.NewError(acme.ErrorMalformedType, "").Type, ae.Type)
+			assert.Equal(t, tt.wantErr, ae.Err.Error())
+		})
+	}
+}
+
+func TestHandler_GetStarCertificate(t *testing.T) {
+	leaf, err := pemutil.ReadCertificate("../../authority/testdata/certs/foo.crt")
+	require.NoError(t, err)
+	inter, err := pemutil.ReadCertificate("../../authority/testdata/certs/intermediate_ca.crt")
+	require.NoError(t, err)
+
+	prov := newProv()
+	acc := &acme.Account{ID: "accID"}
+	newStarOrder := func(status acme.Status, allowGet bool, endDate time.Time) *acme.StarOrder {
+		return &acme.StarOrder{
+			OrderID:         "ordID",
+			AccountID:       "accID",
+			ProvisionerName: prov.GetName(),
+			Status:          status,
+			AutoRenewal:     &acme.AutoRenewal{EndDate: endDate, AllowCertificateGet: allowGet},
+			CertificateID:   "certID",
+		}
+	}
+	tomorrow := clock.Now().Add(24 * time.Hour)
+	withNext := func(so *acme.StarOrder, currentID, nextID string, notBefore time.Time) *acme.StarOrder {
+		so.CertificateID = currentID
+		so.NextCertificateID = nextID
+		so.NextNotBefore = notBefore
+		return so
+	}
+
+	type test struct {
+		method     string
+		so         *acme.StarOrder
+		acc        *acme.Account
+		statusCode int
+		errType    acme.ProblemType
+	}
+	tests := map[string]test{
+		"ok/post-as-get":           {http.MethodPost, newStarOrder(acme.StatusValid, false, tomorrow), acc, 200, 0},
+		"ok/get":                   {http.MethodGet, newStarOrder(acme.StatusValid, true, tomorrow), nil, 200, 0},
+		"ok/next-not-valid-yet":    {http.MethodPost, withNext(newStarOrder(acme.StatusValid, false, tomorrow), "certID", "nextCertID", tomorrow), acc, 200, 0},
+		"ok/next-valid":            {http.MethodPost, withNext(newStarOrder(acme.StatusValid, false, tomorrow), "oldCertID", "certID", clock.Now().Add(-time.Minute)), acc, 200, 0},
+		"fail/get-not-allowed":     {http.MethodGet, newStarOrder(acme.StatusValid, false, tomorrow), nil, 401, acme.ErrorUnauthorizedType},
+		"fail/account":             {http.MethodPost, newStarOrder(acme.StatusValid, false, tomorrow), &acme.Account{ID: "other"}, 401, acme.ErrorUnauthorizedType},
+		"fail/canceled":            {http.MethodPost, newStarOrder(acme.StatusCanceled, false, tomorrow), acc, 403, acme.ErrorAutoRenewalCanceledType},
+		"fail/expired":             {http.MethodPost, newStarOrder(acme.StatusValid, false, clock.Now().Add(-time.Hour)), acc, 403, acme.ErrorAutoRenewalExpiredType},
+		"fail/get-canceled-public": {http.MethodGet, newStarOrder(acme.StatusCanceled, true, tomorrow), nil, 403, acme.ErrorAutoRenewalCanceledType},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db := &acme.MockDB{
+				MockGetStarOrder: func(ctx context.Context, orderID string) (*acme.StarOrder, error) {
+					assert.Equal(t, "ordID", orderID)
+					return tc.so, nil
+				},
+				MockGetCertificate: func(ctx context.Context, id string) (*acme.Certificate, error) {
+					assert.Equal(t, "certID", id)
+					return &acme.Certificate{ID: id, AccountID: "accID", Leaf: leaf, Intermediates: []*x509.Certificate{inter}}, nil
+				},
+			}
+
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("ordID", "ordID")
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			if tc.acc != nil {
+				ctx = context.WithValue(ctx, accContextKey, tc.acc)
+			}
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+			ctx = acme.NewDatabaseContext(ctx, db)
+			req := httptest.NewRequest(tc.method, "https://test.ca.smallstep.com/acme/test/star-certificate/ordID", http.NoBody)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			GetStarCertificate(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+
+			if res.StatusCode >= 400 {
+				var ae acme.Error
+				require.NoError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+				assert.Equal(t, acme.NewError(tc.errType, "").Type, ae.Type)
+				return
+			}
+			assert.Equal(t, []string{"application/pem-certificate-chain"}, res.Header["Content-Type"])
+			assert.Equal(t, leaf.NotBefore.UTC().Format(http.TimeFormat), res.Header.Get("Cert-Not-Before"))
+			assert.Equal(t, leaf.NotAfter.UTC().Format(http.TimeFormat), res.Header.Get("Cert-Not-After"))
+			certs, err := pemutil.ParseCertificateBundle(body)
+			require.NoError(t, err)
+			assert.Len(t, certs, 2)
+		})
+	}
+}
+
+func TestHandler_GetOrUpdateOrder(t *testing.T) {
+	prov := newProv()
+	acc := &acme.Account{ID: "accID"}
+	starOrder := func() *acme.Order {
+		return &acme.Order{
+			ID:               "ordID",
+			AccountID:        "accID",
+			ProvisionerID:    prov.GetID(),
+			Status:           acme.StatusValid,
+			CertificateID:    "certID",
+			AuthorizationIDs: []string{"azID"},
+			AutoRenewal:      &acme.AutoRenewal{Lifetime: 3600},
+		}
+	}
+
+	type test struct {
+		payload    string
+		db         acme.DB
+		statusCode int
+		errType    acme.ProblemType
+	}
+	tests := map[string]func(t *testing.T) test{
+		"fail/status": func(t *testing.T) test {
+			return test{
+				payload:    `{"status":"deactivated"}`,
+				db:         &acme.MockDB{},
+				statusCode: 400,
+				errType:    acme.ErrorMalformedType,
+			}
+		},
+		"fail/not-valid": func(t *testing.T) test {
+			return test{
+				payload: `{"status":"canceled"}`,
+				db: &acme.MockDB{
+					MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+						o := starOrder()
+						o.Status = acme.StatusCanceled
+						return o, nil
+					},
+				},
+				statusCode: 400,
+				errType:    acme.ErrorAutoRenewalCancellationInvalidType,
+			}
+		},
+		"ok/cancel": func(t *testing.T) test {
+			return test{
+				payload: `{"status":"canceled"}`,
+				db: &acme.MockDB{
+					MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+						assert.Equal(t, "ordID", id)
+						return starOrder(), nil
+					},
+					MockGetStarOrder: func(ctx context.Context, orderID string) (*acme.StarOrder, error) {
+						return &acme.StarOrder{OrderID: orderID, Status: acme.StatusValid}, nil
+					},
+					MockUpdateStarOrder: func(ctx context.Context, so *acme.StarOrder) error {
+						assert.Equal(t, acme.StatusCanceled, so.Status)
+						return nil
+					},
+					MockUpdateOrder: func(ctx context.Context, o *acme.Order) error {
+						assert.Equal(t, acme.StatusCanceled, o.Status)
+						return nil
+					},
+				},
+				statusCode: 200,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("ordID", "ordID")
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: []byte(tc.payload)})
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+			ctx = newBaseContext(ctx, tc.db, acme.NewLinker("test.ca.smallstep.com", "acme"))
+			req := httptest.NewRequest("POST", "https://test.ca.smallstep.com/acme/test/order/ordID", http.NoBody)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			GetOrUpdateOrder(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+
+			if res.StatusCode >= 400 {
+				var ae acme.Error
+				require.NoError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+				assert.Equal(t, acme.NewError(tc.errType, "").Type, ae.Type)
+				return
+			}
+			var o acme.Order
+			require.NoError(t, json.Unmarshal(body, &o))
+			assert.Equal(t, acme.StatusCanceled, o.Status)
+			assert.Empty(t, o.CertificateURL)
+			assert.Equal(t, "https://test.ca.smallstep.com/acme/test@acme-%3Ctest%3Eprovisioner.com/star-certificate/ordID", o.StarCertificateURL)
+		})
+	}
+}
@@ -8,16 +8,17 @@ import (
 
 // Authorization representst an ACME Authorization.
 type Authorization struct {
-	ID          string       `json:"-"`
-	AccountID   string       `json:"-"`
-	Token       string       `json:"-"`
-	Fingerprint string       `json:"-"`
-	Identifier  Identifier   `json:"identifier"`
-	Status      Status       `json:"status"`
-	Challenges  []*Challenge `json:"challenges"`
-	Wildcard    bool         `json:"wildcard"`
-	ExpiresAt   time.Time    `json:"expires"`
-	Error       *Error       `json:"error,omitempty"`
+	ID                string       `json:"-"`
+	AccountID         string       `json:"-"`
+	Token             string       `json:"-"`
+	Fingerprint       string       `json:"-"`
+	AttestationFormat string       `json:"-"`
+	Identifier        Identifier   `json:"identifier"`
+	Status            Status       `json:"status"`
+	Challenges        []*Challenge `json:"challenges"`
+	Wildcard          bool         `json:"wildcard"`
+	ExpiresAt         time.Time    `json:"expires"`
+	Error             *Error       `json:"error,omitempty"`
 }
 
 // ToLog enables response logging.
@@ -29,6 +30,22 @@ func (az *Authorization) ToLog() (interface{}, error) {
 	return string(b), nil
 }
 
+// ValidatedAt returns the time the authorization was validated, that is, the
+// latest validation time of its valid challenges. It returns the zero time if
+// the authorization has not been validated.
+func (az *Authorization) ValidatedAt() time.Time {
+	var validatedAt time.Time
+	for _, ch := range az.Challenges {
+		if ch.Status != StatusValid {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, ch.ValidatedAt); err == nil && t.After(validatedAt) {
+			validatedAt = t
+		}
+	}
+	return validatedAt
+}
+
 // UpdateStatus updates the ACME Authorization Status if necessary.
 // Changes to the Authorization are saved using the database interface.
 func (az *Authorization) UpdateStatus(ctx context.Context, db DB) error {
@@ -59,6 +76,7 @@ func (az *Authorization) UpdateStatus(ctx context.Context, db DB) error {
 		}
 		az.Status = StatusValid
 		az.Error = nil
+		az.ExpiresAt = validAuthorizationExpiry(ctx, az)
 	default:
 		return NewErrorISE("unrecognized authorization status: %s", az.Status)
 	}
@@ -68,3 +86,26 @@ func (az *Authorization) UpdateStatus(ctx context.Context, db DB) error {
 	}
 	return nil
 }
+
+// validAuthorizationExpiry returns the expiration time of an authorization
+// that just became valid. If the provisioner allows to reuse authorizations,
+// the authorization is extended so it can be reused for the configured time
+// after its validation.
+func validAuthorizationExpiry(ctx context.Context, az *Authorization) time.Time {
+	p, ok := ProvisionerFromContext(ctx)
+	if !ok {
+		return az.ExpiresAt
+	}
+	r, ok := p.(authorizationReuser)
+	if !ok || r.AuthorizationReuseAge() <= 0 {
+		return az.ExpiresAt
+	}
+	validatedAt := az.ValidatedAt()
+	if validatedAt.IsZero() {
+		return az.ExpiresAt
+	}
+	if expiresAt := validatedAt.Add(r.AuthorizationReuseAge()); expiresAt.After(az.ExpiresAt) {
+		return expiresAt
+	}
+	return az.ExpiresAt
+}
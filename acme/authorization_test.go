@@ -7,6 +7,8 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
+
+	"github.com/smallstep/certificates/authority/provisioner"
 )
 
 func TestAuthorization_UpdateStatus(t *testing.T) {
@@ -148,3 +150,75 @@ func TestAuthorization_UpdateStatus(t *testing.T) {
 
 	}
 }
+
+func TestAuthorization_UpdateStatus_authorizationReuse(t *testing.T) {
+	now := clock.Now().UTC().Truncate(time.Second)
+	newAuthz := func() *Authorization {
+		return &Authorization{
+			ID:        "azID",
+			Status:    StatusPending,
+			ExpiresAt: now.Add(24 * time.Hour),
+			Challenges: []*Challenge{
+				{Status: StatusPending},
+				{Status: StatusValid, ValidatedAt: now.Format(time.RFC3339)},
+			},
+		}
+	}
+	db := &MockDB{
+		MockUpdateAuthorization: func(ctx context.Context, az *Authorization) error {
+			return nil
+		},
+	}
+
+	tests := map[string]struct {
+		ctx context.Context
+		exp time.Time
+	}{
+		"no-provisioner": {context.Background(), now.Add(24 * time.Hour)},
+		"disabled":       {NewProvisionerContext(context.Background(), &provisioner.ACME{}), now.Add(24 * time.Hour)},
+		"shorter":        {NewProvisionerContext(context.Background(), &provisioner.ACME{AuthorizationReuse: &provisioner.Duration{Duration: time.Hour}}), now.Add(24 * time.Hour)},
+		"extended":       {NewProvisionerContext(context.Background(), &provisioner.ACME{AuthorizationReuse: &provisioner.Duration{Duration: 7 * 24 * time.Hour}}), now.Add(7 * 24 * time.Hour)},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			az := newAuthz()
+			assert.FatalError(t, az.UpdateStatus(tc.ctx, db))
+			assert.Equals(t, StatusValid, az.Status)
+			assert.Equals(t, tc.exp, az.ExpiresAt)
+		})
+	}
+}
+
+func TestAuthorization_ValidatedAt(t *testing.T) {
+	now := clock.Now().UTC().Truncate(time.Second)
+	type test struct {
+		az  *Authorization
+		exp time.Time
+	}
+	tests := map[string]test{
+		"ok/no-challenges": {
+			az:  &Authorization{},
+			exp: time.Time{},
+		},
+		"ok/not-validated": {
+			az: &Authorization{Challenges: []*Challenge{
+				{Status: StatusPending},
+				{Status: StatusInvalid, ValidatedAt: now.Format(time.RFC3339)},
+			}},
+			exp: time.Time{},
+		},
+		"ok/latest": {
+			az: &Authorization{Challenges: []*Challenge{
+				{Status: StatusValid, ValidatedAt: now.Add(-time.Hour).Format(time.RFC3339)},
+				{Status: StatusValid, ValidatedAt: now.Format(time.RFC3339)},
+				{Status: StatusValid, ValidatedAt: "bad-time"},
+			}},
+			exp: now,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.True(t, tc.az.ValidatedAt().Equal(tc.exp))
+		})
+	}
+}
@@ -37,6 +37,7 @@ import (
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/x509util"
 
+	"github.com/smallstep/certificates/acme/perspective"
 	"github.com/smallstep/certificates/acme/wire"
 	"github.com/smallstep/certificates/authority/provisioner"
 	wireprovisioner "github.com/smallstep/certificates/authority/provisioner/wire"
@@ -92,6 +93,9 @@ type Challenge struct {
 	Error           *Error        `json:"error,omitempty"`
 	Payload         []byte        `json:"-"`
 	PayloadFormat   string        `json:"-"`
+	// Perspectives contains the results of the remote validation perspectives
+	// if multi-perspective validation is enabled.
+	Perspectives []*perspective.Result `json:"-"`
 }
 
 // ToLog enables response logging.
@@ -177,6 +181,10 @@ func http01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWeb
 			"keyAuthorization does not match; expected %s, but got %s", expected, keyAuth))
 	}
 
+	if ok, err := corroborate(ctx, db, ch, jwk); !ok {
+		return err
+	}
+
 	// Update and store the challenge.
 	ch.Status = StatusValid
 	ch.Error = nil
@@ -332,6 +340,10 @@ func tlsalpn01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSON
 					hex.EncodeToString(hashedKeyAuth[:]), hex.EncodeToString(extValue)))
 			}
 
+			if ok, err := corroborate(ctx, db, ch, jwk); !ok {
+				return err
+			}
+
 			ch.Status = StatusValid
 			ch.Error = nil
 			ch.ValidatedAt = clock.Now().Format(time.RFC3339)
@@ -388,6 +400,10 @@ func dns01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebK
 			"keyAuthorization does not match; expected %s, but got %s", expectedKeyAuth, txtRecords))
 	}
 
+	if ok, err := corroborate(ctx, db, ch, jwk); !ok {
+		return err
+	}
+
 	// Update and store the challenge.
 	ch.Status = StatusValid
 	ch.Error = nil
@@ -951,10 +967,11 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 	ch.ValidatedAt = clock.Now().Format(time.RFC3339)
 	ch.PayloadFormat = format
 
-	// Store the fingerprint in the authorization.
+	// Store the fingerprint and the attestation format in the authorization.
 	//
 	// TODO: add method to update authorization and challenge atomically.
 	if az.Fingerprint != "" {
+		az.AttestationFormat = format
 		if err := db.UpdateAuthorization(ctx, az); err != nil {
 			return WrapErrorISE(err, "error updating authorization")
 		}
@@ -1635,6 +1652,32 @@ func KeyAuthorization(token string, jwk *jose.JSONWebKey) (string, error) {
 	return fmt.Sprintf("%s.%s", token, encPrint), nil
 }
 
+// corroborate checks a challenge that has been validated locally from the
+// remote perspectives configured in the context, and records the result of
+// each perspective in the challenge. It returns false if the validation was
+// not corroborated by a quorum of perspectives, in which case the error has
+// already been stored in the challenge.
+func corroborate(ctx context.Context, db DB, ch *Challenge, jwk *jose.JSONWebKey) (bool, error) {
+	pv, ok := PerspectiveValidatorFromContext(ctx)
+	if !ok {
+		return true, nil
+	}
+
+	pub := jwk.Public()
+	results, err := pv.Validate(ctx, &perspective.Request{
+		Type:  string(ch.Type),
+		Value: ch.Value,
+		Token: ch.Token,
+		JWK:   &pub,
+	})
+	ch.Perspectives = results
+	if err != nil {
+		return false, storeError(ctx, db, ch, false, WrapDetailedError(ErrorUnauthorizedType, err,
+			"%s challenge for %s could not be corroborated by remote perspectives", ch.Type, ch.Value))
+	}
+	return true, nil
+}
+
 // storeError the given error to an ACME error and saves using the DB interface.
 func storeError(ctx context.Context, db DB, ch *Challenge, markInvalid bool, err *Error) error {
 	ch.Error = err
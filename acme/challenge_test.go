@@ -40,6 +40,7 @@ import (
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/x509util"
 
+	"github.com/smallstep/certificates/acme/perspective"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
 	wireprovisioner "github.com/smallstep/certificates/authority/provisioner/wire"
@@ -5283,3 +5284,103 @@ func Test_dns01ChallengeHost(t *testing.T) {
 		})
 	}
 }
+
+type mockPerspectiveValidator struct {
+	validate func(ctx context.Context, req *perspective.Request) ([]*perspective.Result, error)
+}
+
+func (m *mockPerspectiveValidator) Validate(ctx context.Context, req *perspective.Request) ([]*perspective.Result, error) {
+	return m.validate(ctx, req)
+}
+
+func Test_corroborate(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+
+	results := []*perspective.Result{
+		{Perspective: "us-east", Status: perspective.StatusValid},
+		{Perspective: "eu-west", Status: perspective.StatusInvalid, Error: "keyAuthorization does not match"},
+	}
+	newChallenge := func() *Challenge {
+		return &Challenge{
+			ID:     "chID",
+			Type:   DNS01,
+			Value:  "example.com",
+			Token:  "token",
+			Status: StatusPending,
+		}
+	}
+
+	type args struct {
+		ctx context.Context
+		db  DB
+		ch  *Challenge
+	}
+	tests := []struct {
+		name             string
+		args             args
+		want             bool
+		wantErr          bool
+		wantPerspectives []*perspective.Result
+		wantChError      bool
+	}{
+		{"ok/disabled", args{context.Background(), &MockDB{}, newChallenge()}, true, false, nil, false},
+		{"ok/corroborated", args{
+			NewPerspectiveValidatorContext(context.Background(), &mockPerspectiveValidator{
+				validate: func(_ context.Context, req *perspective.Request) ([]*perspective.Result, error) {
+					assert.Equal(t, "dns-01", req.Type)
+					assert.Equal(t, "example.com", req.Value)
+					assert.Equal(t, "token", req.Token)
+					assert.True(t, req.JWK.IsPublic())
+					return results, nil
+				},
+			}),
+			&MockDB{}, newChallenge(),
+		}, true, false, results, false},
+		{"fail/quorum", args{
+			NewPerspectiveValidatorContext(context.Background(), &mockPerspectiveValidator{
+				validate: func(context.Context, *perspective.Request) ([]*perspective.Result, error) {
+					return results, perspective.ErrQuorum
+				},
+			}),
+			&MockDB{
+				MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+					assert.Equal(t, StatusPending, ch.Status)
+					assert.Equal(t, results, ch.Perspectives)
+					return nil
+				},
+			}, newChallenge(),
+		}, false, false, results, true},
+		{"fail/db.UpdateChallenge", args{
+			NewPerspectiveValidatorContext(context.Background(), &mockPerspectiveValidator{
+				validate: func(context.Context, *perspective.Request) ([]*perspective.Result, error) {
+					return results, perspective.ErrQuorum
+				},
+			}),
+			&MockDB{
+				MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+					return errors.New("force")
+				},
+			}, newChallenge(),
+		}, false, true, results, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := corroborate(tt.args.ctx, tt.args.db, tt.args.ch, jwk)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantPerspectives, tt.args.ch.Perspectives)
+			if tt.wantChError {
+				if assert.NotNil(t, tt.args.ch.Error) {
+					assert.Equal(t, "urn:ietf:params:acme:error:unauthorized", tt.args.ch.Error.Type)
+				}
+			} else {
+				assert.Nil(t, tt.args.ch.Error)
+			}
+		})
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"net"
 	"net/http"
 	"time"
+
+	"github.com/smallstep/certificates/acme/perspective"
 )
 
 // Client is the interface used to verify ACME challenges.
@@ -44,6 +46,30 @@ func MustClientFromContext(ctx context.Context) Client {
 	return c
 }
 
+// PerspectiveValidator is the interface used to corroborate ACME challenge
+// validations from remote network perspectives.
+type PerspectiveValidator interface {
+	// Validate runs the validation described by the request on every remote
+	// perspective. It returns an error if the validation is not corroborated
+	// by enough perspectives.
+	Validate(ctx context.Context, req *perspective.Request) ([]*perspective.Result, error)
+}
+
+type perspectiveValidatorKey struct{}
+
+// NewPerspectiveValidatorContext adds the given PerspectiveValidator to the
+// context.
+func NewPerspectiveValidatorContext(ctx context.Context, v PerspectiveValidator) context.Context {
+	return context.WithValue(ctx, perspectiveValidatorKey{}, v)
+}
+
+// PerspectiveValidatorFromContext returns the PerspectiveValidator in the
+// context. Multi-perspective validation is disabled if it's not present.
+func PerspectiveValidatorFromContext(ctx context.Context) (v PerspectiveValidator, ok bool) {
+	v, ok = ctx.Value(perspectiveValidatorKey{}).(PerspectiveValidator)
+	return v, ok && v != nil
+}
+
 type client struct {
 	http   *http.Client
 	dialer *net.Dialer
@@ -81,6 +81,12 @@ type Provisioner interface {
 	GetOptions() *provisioner.Options
 }
 
+// authorizationReuser is implemented by provisioners that allow to reuse valid
+// authorizations in new orders.
+type authorizationReuser interface {
+	AuthorizationReuseAge() time.Duration
+}
+
 type provisionerKey struct{}
 
 // NewProvisionerContext adds the given provisioner to the context.
@@ -25,6 +25,7 @@ type DB interface {
 	GetAccount(ctx context.Context, id string) (*Account, error)
 	GetAccountByKeyID(ctx context.Context, kid string) (*Account, error)
 	UpdateAccount(ctx context.Context, acc *Account) error
+	GetAccountsByProvisionerID(ctx context.Context, provisionerID string) ([]*Account, error)
 
 	CreateExternalAccountKey(ctx context.Context, provisionerID, reference string) (*ExternalAccountKey, error)
 	GetExternalAccountKey(ctx context.Context, provisionerID, keyID string) (*ExternalAccountKey, error)
@@ -41,10 +42,12 @@ type DB interface {
 	GetAuthorization(ctx context.Context, id string) (*Authorization, error)
 	UpdateAuthorization(ctx context.Context, az *Authorization) error
 	GetAuthorizationsByAccountID(ctx context.Context, accountID string) ([]*Authorization, error)
+	GetValidAuthorizationByIdentifier(ctx context.Context, accountID string, identifier Identifier) (*Authorization, error)
 
 	CreateCertificate(ctx context.Context, cert *Certificate) error
 	GetCertificate(ctx context.Context, id string) (*Certificate, error)
 	GetCertificateBySerial(ctx context.Context, serial string) (*Certificate, error)
+	GetCertificatesByAccountID(ctx context.Context, accountID string) ([]*Certificate, error)
 
 	CreateChallenge(ctx context.Context, ch *Challenge) error
 	GetChallenge(ctx context.Context, id, authzID string) (*Challenge, error)
@@ -54,6 +57,17 @@ type DB interface {
 	GetOrder(ctx context.Context, id string) (*Order, error)
 	GetOrdersByAccountID(ctx context.Context, accountID string) ([]string, error)
 	UpdateOrder(ctx context.Context, o *Order) error
+	GetOrderHistoryByAccountID(ctx context.Context, accountID string) ([]*Order, error)
+
+	CreateStarOrder(ctx context.Context, so *StarOrder) error
+	GetStarOrder(ctx context.Context, orderID string) (*StarOrder, error)
+	GetStarOrders(ctx context.Context) ([]*StarOrder, error)
+	UpdateStarOrder(ctx context.Context, so *StarOrder) error
+
+	CreateFinalizeJob(ctx context.Context, job *FinalizeJob) error
+	GetFinalizeJob(ctx context.Context, orderID string) (*FinalizeJob, error)
+	GetFinalizeJobs(ctx context.Context) ([]*FinalizeJob, error)
+	DeleteFinalizeJob(ctx context.Context, orderID string) error
 }
 
 // WireDB is the interface used for operations on ACME Orders for Wire identifiers. This
@@ -98,10 +112,11 @@ func MustDatabaseFromContext(ctx context.Context) DB {
 // MockDB is an implementation of the DB interface that should only be used as
 // a mock in tests.
 type MockDB struct {
-	MockCreateAccount     func(ctx context.Context, acc *Account) error
-	MockGetAccount        func(ctx context.Context, id string) (*Account, error)
-	MockGetAccountByKeyID func(ctx context.Context, kid string) (*Account, error)
-	MockUpdateAccount     func(ctx context.Context, acc *Account) error
+	MockCreateAccount              func(ctx context.Context, acc *Account) error
+	MockGetAccount                 func(ctx context.Context, id string) (*Account, error)
+	MockGetAccountByKeyID          func(ctx context.Context, kid string) (*Account, error)
+	MockUpdateAccount              func(ctx context.Context, acc *Account) error
+	MockGetAccountsByProvisionerID func(ctx context.Context, provisionerID string) ([]*Account, error)
 
 	MockCreateExternalAccountKey         func(ctx context.Context, provisionerID, reference string) (*ExternalAccountKey, error)
 	MockGetExternalAccountKey            func(ctx context.Context, provisionerID, keyID string) (*ExternalAccountKey, error)
@@ -114,23 +129,36 @@ type MockDB struct {
 	MockCreateNonce func(ctx context.Context) (Nonce, error)
 	MockDeleteNonce func(ctx context.Context, nonce Nonce) error
 
-	MockCreateAuthorization          func(ctx context.Context, az *Authorization) error
-	MockGetAuthorization             func(ctx context.Context, id string) (*Authorization, error)
-	MockUpdateAuthorization          func(ctx context.Context, az *Authorization) error
-	MockGetAuthorizationsByAccountID func(ctx context.Context, accountID string) ([]*Authorization, error)
+	MockCreateAuthorization               func(ctx context.Context, az *Authorization) error
+	MockGetAuthorization                  func(ctx context.Context, id string) (*Authorization, error)
+	MockUpdateAuthorization               func(ctx context.Context, az *Authorization) error
+	MockGetAuthorizationsByAccountID      func(ctx context.Context, accountID string) ([]*Authorization, error)
+	MockGetValidAuthorizationByIdentifier func(ctx context.Context, accountID string, identifier Identifier) (*Authorization, error)
 
-	MockCreateCertificate      func(ctx context.Context, cert *Certificate) error
-	MockGetCertificate         func(ctx context.Context, id string) (*Certificate, error)
-	MockGetCertificateBySerial func(ctx context.Context, serial string) (*Certificate, error)
+	MockCreateCertificate          func(ctx context.Context, cert *Certificate) error
+	MockGetCertificate             func(ctx context.Context, id string) (*Certificate, error)
+	MockGetCertificateBySerial     func(ctx context.Context, serial string) (*Certificate, error)
+	MockGetCertificatesByAccountID func(ctx context.Context, accountID string) ([]*Certificate, error)
 
 	MockCreateChallenge func(ctx context.Context, ch *Challenge) error
 	MockGetChallenge    func(ctx context.Context, id, authzID string) (*Challenge, error)
 	MockUpdateChallenge func(ctx context.Context, ch *Challenge) error
 
-	MockCreateOrder          func(ctx context.Context, o *Order) error
-	MockGetOrder             func(ctx context.Context, id string) (*Order, error)
-	MockGetOrdersByAccountID func(ctx context.Context, accountID string) ([]string, error)
-	MockUpdateOrder          func(ctx context.Context, o *Order) error
+	MockCreateOrder                func(ctx context.Context, o *Order) error
+	MockGetOrder                   func(ctx context.Context, id string) (*Order, error)
+	MockGetOrdersByAccountID       func(ctx context.Context, accountID string) ([]string, error)
+	MockUpdateOrder                func(ctx context.Context, o *Order) error
+	MockGetOrderHistoryByAccountID func(ctx context.Context, accountID string) ([]*Order, error)
+
+	MockCreateStarOrder func(ctx context.Context, so *StarOrder) error
+	MockGetStarOrder    func(ctx context.Context, orderID string) (*StarOrder, error)
+	MockGetStarOrders   func(ctx context.Context) ([]*StarOrder, error)
+	MockUpdateStarOrder func(ctx context.Context, so *StarOrder) error
+
+	MockCreateFinalizeJob func(ctx context.Context, job *FinalizeJob) error
+	MockGetFinalizeJob    func(ctx context.Context, orderID string) (*FinalizeJob, error)
+	MockGetFinalizeJobs   func(ctx context.Context) ([]*FinalizeJob, error)
+	MockDeleteFinalizeJob func(ctx context.Context, orderID string) error
 
 	MockRet1  interface{}
 	MockError error
@@ -188,6 +216,16 @@ func (m *MockDB) UpdateAccount(ctx context.Context, acc *Account) error {
 	return m.MockError
 }
 
+// GetAccountsByProvisionerID mock
+func (m *MockDB) GetAccountsByProvisionerID(ctx context.Context, provisionerID string) ([]*Account, error) {
+	if m.MockGetAccountsByProvisionerID != nil {
+		return m.MockGetAccountsByProvisionerID(ctx, provisionerID)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	return m.MockRet1.([]*Account), m.MockError
+}
+
 // CreateExternalAccountKey mock
 func (m *MockDB) CreateExternalAccountKey(ctx context.Context, provisionerID, reference string) (*ExternalAccountKey, error) {
 	if m.MockCreateExternalAccountKey != nil {
@@ -318,6 +356,16 @@ func (m *MockDB) GetAuthorizationsByAccountID(ctx context.Context, accountID str
 	return nil, m.MockError
 }
 
+// GetValidAuthorizationByIdentifier mock
+func (m *MockDB) GetValidAuthorizationByIdentifier(ctx context.Context, accountID string, identifier Identifier) (*Authorization, error) {
+	if m.MockGetValidAuthorizationByIdentifier != nil {
+		return m.MockGetValidAuthorizationByIdentifier(ctx, accountID, identifier)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	return nil, ErrNotFound
+}
+
 // CreateCertificate mock
 func (m *MockDB) CreateCertificate(ctx context.Context, cert *Certificate) error {
 	if m.MockCreateCertificate != nil {
@@ -348,6 +396,16 @@ func (m *MockDB) GetCertificateBySerial(ctx context.Context, serial string) (*Ce
 	return m.MockRet1.(*Certificate), m.MockError
 }
 
+// GetCertificatesByAccountID mock
+func (m *MockDB) GetCertificatesByAccountID(ctx context.Context, accountID string) ([]*Certificate, error) {
+	if m.MockGetCertificatesByAccountID != nil {
+		return m.MockGetCertificatesByAccountID(ctx, accountID)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	return m.MockRet1.([]*Certificate), m.MockError
+}
+
 // CreateChallenge mock
 func (m *MockDB) CreateChallenge(ctx context.Context, ch *Challenge) error {
 	if m.MockCreateChallenge != nil {
@@ -408,6 +466,16 @@ func (m *MockDB) UpdateOrder(ctx context.Context, o *Order) error {
 	return m.MockError
 }
 
+// GetOrderHistoryByAccountID mock
+func (m *MockDB) GetOrderHistoryByAccountID(ctx context.Context, accountID string) ([]*Order, error) {
+	if m.MockGetOrderHistoryByAccountID != nil {
+		return m.MockGetOrderHistoryByAccountID(ctx, accountID)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	return m.MockRet1.([]*Order), m.MockError
+}
+
 // GetOrdersByAccountID mock
 func (m *MockDB) GetOrdersByAccountID(ctx context.Context, accID string) ([]string, error) {
 	if m.MockGetOrdersByAccountID != nil {
@@ -418,6 +486,78 @@ func (m *MockDB) GetOrdersByAccountID(ctx context.Context, accID string) ([]stri
 	return m.MockRet1.([]string), m.MockError
 }
 
+// CreateStarOrder mock
+func (m *MockDB) CreateStarOrder(ctx context.Context, so *StarOrder) error {
+	if m.MockCreateStarOrder != nil {
+		return m.MockCreateStarOrder(ctx, so)
+	}
+	return m.MockError
+}
+
+// GetStarOrder mock
+func (m *MockDB) GetStarOrder(ctx context.Context, orderID string) (*StarOrder, error) {
+	if m.MockGetStarOrder != nil {
+		return m.MockGetStarOrder(ctx, orderID)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	return m.MockRet1.(*StarOrder), m.MockError
+}
+
+// GetStarOrders mock
+func (m *MockDB) GetStarOrders(ctx context.Context) ([]*StarOrder, error) {
+	if m.MockGetStarOrders != nil {
+		return m.MockGetStarOrders(ctx)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	return m.MockRet1.([]*StarOrder), m.MockError
+}
+
+// UpdateStarOrder mock
+func (m *MockDB) UpdateStarOrder(ctx context.Context, so *StarOrder) error {
+	if m.MockUpdateStarOrder != nil {
+		return m.MockUpdateStarOrder(ctx, so)
+	}
+	return m.MockError
+}
+
+// CreateFinalizeJob mock
+func (m *MockDB) CreateFinalizeJob(ctx context.Context, job *FinalizeJob) error {
+	if m.MockCreateFinalizeJob != nil {
+		return m.MockCreateFinalizeJob(ctx, job)
+	}
+	return m.MockError
+}
+
+// GetFinalizeJob mock
+func (m *MockDB) GetFinalizeJob(ctx context.Context, orderID string) (*FinalizeJob, error) {
+	if m.MockGetFinalizeJob != nil {
+		return m.MockGetFinalizeJob(ctx, orderID)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	return m.MockRet1.(*FinalizeJob), m.MockError
+}
+
+// GetFinalizeJobs mock
+func (m *MockDB) GetFinalizeJobs(ctx context.Context) ([]*FinalizeJob, error) {
+	if m.MockGetFinalizeJobs != nil {
+		return m.MockGetFinalizeJobs(ctx)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	return m.MockRet1.([]*FinalizeJob), m.MockError
+}
+
+// DeleteFinalizeJob mock
+func (m *MockDB) DeleteFinalizeJob(ctx context.Context, orderID string) error {
+	if m.MockDeleteFinalizeJob != nil {
+		return m.MockDeleteFinalizeJob(ctx, orderID)
+	}
+	return m.MockError
+}
+
 // GetAllOrdersByAccountID returns a list of any order IDs owned by the account.
 func (m *MockWireDB) GetAllOrdersByAccountID(ctx context.Context, accountID string) ([]string, error) {
 	if m.MockGetAllOrdersByAccountID != nil {
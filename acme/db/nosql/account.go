@@ -72,6 +72,7 @@ func (db *DB) GetAccount(ctx context.Context, id string) (*acme.Account, error)
 		LocationPrefix:  dbacc.LocationPrefix,
 		ProvisionerID:   dbacc.ProvisionerID,
 		ProvisionerName: dbacc.ProvisionerName,
+		CreatedAt:       dbacc.CreatedAt,
 	}, nil
 }
 
@@ -121,10 +122,31 @@ func (db *DB) CreateAccount(ctx context.Context, acc *acme.Account) error {
 			db.db.Del(accountByKeyIDTable, kidB)
 			return err
 		}
+		if acc.ProvisionerID != "" {
+			return db.addToIndex(accountsByProvisionerIDTable, acc.ProvisionerID, acc.ID)
+		}
 		return nil
 	}
 }
 
+// GetAccountsByProvisionerID retrieves the ACME accounts created with the
+// given provisioner.
+func (db *DB) GetAccountsByProvisionerID(ctx context.Context, provisionerID string) ([]*acme.Account, error) {
+	ids, err := db.getIndex(accountsByProvisionerIDTable, provisionerID)
+	if err != nil {
+		return nil, err
+	}
+	accs := make([]*acme.Account, 0, len(ids))
+	for _, id := range ids {
+		acc, err := db.GetAccount(ctx, id)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error loading account %s for provisioner %s", id, provisionerID)
+		}
+		accs = append(accs, acc)
+	}
+	return accs, nil
+}
+
 // UpdateAccount imlements the AcmeDB.UpdateAccount interface.
 func (db *DB) UpdateAccount(ctx context.Context, acc *acme.Account) error {
 	old, err := db.getDBAccount(ctx, acc.ID)
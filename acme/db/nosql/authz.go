@@ -3,6 +3,7 @@ package nosql
 import (
 	"context"
 	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -12,17 +13,18 @@ import (
 
 // dbAuthz is the base authz type that others build from.
 type dbAuthz struct {
-	ID           string          `json:"id"`
-	AccountID    string          `json:"accountID"`
-	Identifier   acme.Identifier `json:"identifier"`
-	Status       acme.Status     `json:"status"`
-	Token        string          `json:"token"`
-	Fingerprint  string          `json:"fingerprint,omitempty"`
-	ChallengeIDs []string        `json:"challengeIDs"`
-	Wildcard     bool            `json:"wildcard"`
-	CreatedAt    time.Time       `json:"createdAt"`
-	ExpiresAt    time.Time       `json:"expiresAt"`
-	Error        *acme.Error     `json:"error"`
+	ID                string          `json:"id"`
+	AccountID         string          `json:"accountID"`
+	Identifier        acme.Identifier `json:"identifier"`
+	Status            acme.Status     `json:"status"`
+	Token             string          `json:"token"`
+	Fingerprint       string          `json:"fingerprint,omitempty"`
+	AttestationFormat string          `json:"attestationFormat,omitempty"`
+	ChallengeIDs      []string        `json:"challengeIDs"`
+	Wildcard          bool            `json:"wildcard"`
+	CreatedAt         time.Time       `json:"createdAt"`
+	ExpiresAt         time.Time       `json:"expiresAt"`
+	Error             *acme.Error     `json:"error"`
 }
 
 func (ba *dbAuthz) clone() *dbAuthz {
@@ -62,16 +64,17 @@ func (db *DB) GetAuthorization(ctx context.Context, id string) (*acme.Authorizat
 		}
 	}
 	return &acme.Authorization{
-		ID:          dbaz.ID,
-		AccountID:   dbaz.AccountID,
-		Identifier:  dbaz.Identifier,
-		Status:      dbaz.Status,
-		Challenges:  chs,
-		Wildcard:    dbaz.Wildcard,
-		ExpiresAt:   dbaz.ExpiresAt,
-		Token:       dbaz.Token,
-		Fingerprint: dbaz.Fingerprint,
-		Error:       dbaz.Error,
+		ID:                dbaz.ID,
+		AccountID:         dbaz.AccountID,
+		Identifier:        dbaz.Identifier,
+		Status:            dbaz.Status,
+		Challenges:        chs,
+		Wildcard:          dbaz.Wildcard,
+		ExpiresAt:         dbaz.ExpiresAt,
+		Token:             dbaz.Token,
+		Fingerprint:       dbaz.Fingerprint,
+		AttestationFormat: dbaz.AttestationFormat,
+		Error:             dbaz.Error,
 	}, nil
 }
 
@@ -91,16 +94,17 @@ func (db *DB) CreateAuthorization(ctx context.Context, az *acme.Authorization) e
 
 	now := clock.Now()
 	dbaz := &dbAuthz{
-		ID:           az.ID,
-		AccountID:    az.AccountID,
-		Status:       az.Status,
-		CreatedAt:    now,
-		ExpiresAt:    az.ExpiresAt,
-		Identifier:   az.Identifier,
-		ChallengeIDs: chIDs,
-		Token:        az.Token,
-		Fingerprint:  az.Fingerprint,
-		Wildcard:     az.Wildcard,
+		ID:                az.ID,
+		AccountID:         az.AccountID,
+		Status:            az.Status,
+		CreatedAt:         now,
+		ExpiresAt:         az.ExpiresAt,
+		Identifier:        az.Identifier,
+		ChallengeIDs:      chIDs,
+		Token:             az.Token,
+		Fingerprint:       az.Fingerprint,
+		AttestationFormat: az.AttestationFormat,
+		Wildcard:          az.Wildcard,
 	}
 
 	return db.save(ctx, az.ID, dbaz, nil, "authz", authzTable)
@@ -115,9 +119,47 @@ func (db *DB) UpdateAuthorization(ctx context.Context, az *acme.Authorization) e
 
 	nu := old.clone()
 	nu.Status = az.Status
+	nu.ExpiresAt = az.ExpiresAt
 	nu.Fingerprint = az.Fingerprint
+	nu.AttestationFormat = az.AttestationFormat
 	nu.Error = az.Error
-	return db.save(ctx, old.ID, nu, old, "authz", authzTable)
+	if err := db.save(ctx, old.ID, nu, old, "authz", authzTable); err != nil {
+		return err
+	}
+
+	// Index the authorization so it can be reused in new orders.
+	if old.Status != acme.StatusValid && nu.Status == acme.StatusValid {
+		key := validAuthzKey(nu.AccountID, nu.Identifier, nu.Wildcard)
+		if err := db.db.Set(validAuthzByIdentifierTable, key, []byte(nu.ID)); err != nil {
+			return errors.Wrapf(err, "error saving authz index for authz %s", nu.ID)
+		}
+	}
+	return nil
+}
+
+// GetValidAuthorizationByIdentifier returns the latest authorization of the
+// account that became valid for the given order identifier. A wildcard
+// identifier, e.g. "*.example.com", only matches wildcard authorizations. It
+// returns acme.ErrNotFound if there's no such authorization.
+func (db *DB) GetValidAuthorizationByIdentifier(ctx context.Context, accountID string, identifier acme.Identifier) (*acme.Authorization, error) {
+	value, wildcard := strings.CutPrefix(identifier.Value, "*.")
+	key := validAuthzKey(accountID, acme.Identifier{Type: identifier.Type, Value: value}, wildcard)
+	id, err := db.db.Get(validAuthzByIdentifierTable, key)
+	if nosql.IsErrNotFound(err) {
+		return nil, acme.ErrNotFound
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "error loading authz index for account %s", accountID)
+	}
+	return db.GetAuthorization(ctx, string(id))
+}
+
+// validAuthzKey returns the key used in the index of valid authorizations.
+func validAuthzKey(accountID string, identifier acme.Identifier, wildcard bool) []byte {
+	value := identifier.Value
+	if wildcard {
+		value = "*." + value
+	}
+	return []byte(accountID + "|" + string(identifier.Type) + "|" + strings.ToLower(value))
 }
 
 // GetAuthorizationsByAccountID retrieves and unmarshals ACME authz types from the database.
@@ -139,16 +181,17 @@ func (db *DB) GetAuthorizationsByAccountID(_ context.Context, accountID string)
 			continue
 		}
 		authzs = append(authzs, &acme.Authorization{
-			ID:          dbaz.ID,
-			AccountID:   dbaz.AccountID,
-			Identifier:  dbaz.Identifier,
-			Status:      dbaz.Status,
-			Challenges:  nil, // challenges not required for current use case
-			Wildcard:    dbaz.Wildcard,
-			ExpiresAt:   dbaz.ExpiresAt,
-			Token:       dbaz.Token,
-			Fingerprint: dbaz.Fingerprint,
-			Error:       dbaz.Error,
+			ID:                dbaz.ID,
+			AccountID:         dbaz.AccountID,
+			Identifier:        dbaz.Identifier,
+			Status:            dbaz.Status,
+			Challenges:        nil, // challenges not required for current use case
+			Wildcard:          dbaz.Wildcard,
+			ExpiresAt:         dbaz.ExpiresAt,
+			Token:             dbaz.Token,
+			Fingerprint:       dbaz.Fingerprint,
+			AttestationFormat: dbaz.AttestationFormat,
+			Error:             dbaz.Error,
 		})
 	}
 
@@ -501,9 +501,10 @@ func TestDB_UpdateAuthorization(t *testing.T) {
 		},
 		"fail/db.CmpAndSwap-error": func(t *testing.T) test {
 			updAz := &acme.Authorization{
-				ID:     azID,
-				Status: acme.StatusValid,
-				Error:  acme.NewError(acme.ErrorMalformedType, "malformed"),
+				ID:        azID,
+				Status:    acme.StatusValid,
+				ExpiresAt: dbaz.ExpiresAt,
+				Error:     acme.NewError(acme.ErrorMalformedType, "malformed"),
 			}
 			return test{
 				az: updAz,
@@ -550,11 +551,12 @@ func TestDB_UpdateAuthorization(t *testing.T) {
 					{ID: "foo"},
 					{ID: "bar"},
 				},
-				Token:       dbaz.Token,
-				Wildcard:    dbaz.Wildcard,
-				ExpiresAt:   dbaz.ExpiresAt,
-				Fingerprint: "fingerprint",
-				Error:       acme.NewError(acme.ErrorMalformedType, "malformed"),
+				Token:             dbaz.Token,
+				Wildcard:          dbaz.Wildcard,
+				ExpiresAt:         dbaz.ExpiresAt.Add(time.Hour),
+				Fingerprint:       "fingerprint",
+				AttestationFormat: "tpm",
+				Error:             acme.NewError(acme.ErrorMalformedType, "malformed"),
 			}
 			return test{
 				az: updAz,
@@ -583,12 +585,40 @@ func TestDB_UpdateAuthorization(t *testing.T) {
 						assert.Equals(t, dbNew.ChallengeIDs, dbaz.ChallengeIDs)
 						assert.Equals(t, dbNew.Wildcard, dbaz.Wildcard)
 						assert.Equals(t, dbNew.CreatedAt, dbaz.CreatedAt)
-						assert.Equals(t, dbNew.ExpiresAt, dbaz.ExpiresAt)
+						assert.Equals(t, dbNew.ExpiresAt, updAz.ExpiresAt)
 						assert.Equals(t, dbNew.Fingerprint, dbaz.Fingerprint)
+						assert.Equals(t, dbNew.AttestationFormat, "tpm")
 						assert.Equals(t, dbNew.Error.Error(), acme.NewError(acme.ErrorMalformedType, "The request message was malformed").Error())
 						return nu, true, nil
 					},
+					MSet: func(bucket, key, value []byte) error {
+						assert.Equals(t, bucket, validAuthzByIdentifierTable)
+						assert.Equals(t, string(key), "accountID|dns|*.test.ca.smallstep.com")
+						assert.Equals(t, string(value), azID)
+						return nil
+					},
+				},
+			}
+		},
+		"fail/db.Set-error": func(t *testing.T) test {
+			return test{
+				az: &acme.Authorization{
+					ID:     azID,
+					Status: acme.StatusValid,
+				},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return nu, true, nil
+					},
+					MSet: func(bucket, key, value []byte) error {
+						assert.Equals(t, bucket, validAuthzByIdentifierTable)
+						return errors.New("force")
+					},
 				},
+				err: errors.New("error saving authz index for authz azID: force"),
 			}
 		},
 	}
@@ -608,7 +638,7 @@ func TestDB_UpdateAuthorization(t *testing.T) {
 					assert.Equals(t, tc.az.Status, acme.StatusValid)
 					assert.Equals(t, tc.az.Wildcard, dbaz.Wildcard)
 					assert.Equals(t, tc.az.Token, dbaz.Token)
-					assert.Equals(t, tc.az.ExpiresAt, dbaz.ExpiresAt)
+					assert.Equals(t, tc.az.ExpiresAt, dbaz.ExpiresAt.Add(time.Hour))
 					assert.Equals(t, tc.az.Challenges, []*acme.Challenge{
 						{ID: "foo"},
 						{ID: "bar"},
@@ -620,6 +650,115 @@ func TestDB_UpdateAuthorization(t *testing.T) {
 	}
 }
 
+func TestDB_GetValidAuthorizationByIdentifier(t *testing.T) {
+	azID := "azID"
+	now := clock.Now()
+	dbaz := &dbAuthz{
+		ID:        azID,
+		AccountID: "accountID",
+		Identifier: acme.Identifier{
+			Type:  "dns",
+			Value: "test.ca.smallstep.com",
+		},
+		Status:       acme.StatusValid,
+		Token:        "token",
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(5 * time.Minute),
+		ChallengeIDs: []string{"foo"},
+		Wildcard:     true,
+	}
+	b, err := json.Marshal(dbaz)
+	assert.FatalError(t, err)
+	dbch := &dbChallenge{
+		ID:          "foo",
+		AccountID:   "accountID",
+		Type:        "dns-01",
+		Status:      acme.StatusValid,
+		Token:       "token",
+		Value:       "test.ca.smallstep.com",
+		ValidatedAt: now.Format(time.RFC3339),
+	}
+	chb, err := json.Marshal(dbch)
+	assert.FatalError(t, err)
+
+	type test struct {
+		db         nosql.DB
+		identifier acme.Identifier
+		err        error
+		notFound   bool
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/not-found": func(t *testing.T) test {
+			return test{
+				identifier: acme.Identifier{Type: "dns", Value: "test.ca.smallstep.com"},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, validAuthzByIdentifierTable)
+						assert.Equals(t, string(key), "accountID|dns|test.ca.smallstep.com")
+						return nil, nosqldb.ErrNotFound
+					},
+				},
+				notFound: true,
+			}
+		},
+		"fail/db.Get-error": func(t *testing.T) test {
+			return test{
+				identifier: acme.Identifier{Type: "dns", Value: "*.test.ca.smallstep.com"},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading authz index for account accountID: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				identifier: acme.Identifier{Type: "dns", Value: "*.Test.ca.smallstep.com"},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						switch string(bucket) {
+						case string(validAuthzByIdentifierTable):
+							assert.Equals(t, string(key), "accountID|dns|*.test.ca.smallstep.com")
+							return []byte(azID), nil
+						case string(authzTable):
+							assert.Equals(t, string(key), azID)
+							return b, nil
+						case string(challengeTable):
+							assert.Equals(t, string(key), "foo")
+							return chb, nil
+						default:
+							t.Errorf("unexpected bucket %s", bucket)
+							return nil, errors.New("force")
+						}
+					},
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			az, err := d.GetValidAuthorizationByIdentifier(context.Background(), "accountID", tc.identifier)
+			switch {
+			case tc.notFound:
+				assert.True(t, acme.IsErrNotFound(err))
+			case tc.err != nil:
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+			default:
+				assert.FatalError(t, err)
+				assert.Equals(t, az.ID, azID)
+				assert.Equals(t, az.Status, acme.StatusValid)
+				assert.True(t, az.Wildcard)
+				assert.Equals(t, az.ValidatedAt(), now)
+			}
+		})
+	}
+}
+
 func TestDB_GetAuthorizationsByAccountID(t *testing.T) {
 	azID := "azID"
 	accountID := "accountID"
@@ -64,7 +64,28 @@ func (db *DB) CreateCertificate(ctx context.Context, cert *acme.Certificate) err
 		Serial:        serial,
 		CertificateID: cert.ID,
 	}
-	return db.save(ctx, serial, dbSerial, nil, "serial", certBySerialTable)
+	if err := db.save(ctx, serial, dbSerial, nil, "serial", certBySerialTable); err != nil {
+		return err
+	}
+	return db.addToIndex(certsByAccountIDTable, cert.AccountID, cert.ID)
+}
+
+// GetCertificatesByAccountID retrieves all the certificates issued to the
+// account.
+func (db *DB) GetCertificatesByAccountID(ctx context.Context, accountID string) ([]*acme.Certificate, error) {
+	ids, err := db.getIndex(certsByAccountIDTable, accountID)
+	if err != nil {
+		return nil, err
+	}
+	certs := make([]*acme.Certificate, 0, len(ids))
+	for _, id := range ids {
+		cert, err := db.GetCertificate(ctx, id)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error loading certificate %s for account %s", id, accountID)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
 }
 
 // GetCertificate retrieves and unmarshals an ACME certificate type from the
@@ -76,9 +76,14 @@ func TestDB_CreateCertificate(t *testing.T) {
 			return test{
 				db: &db.MockNoSQLDB{
 					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
-						if !bytes.Equal(bucket, certTable) && !bytes.Equal(bucket, certBySerialTable) {
+						if !bytes.Equal(bucket, certTable) && !bytes.Equal(bucket, certBySerialTable) && !bytes.Equal(bucket, certsByAccountIDTable) {
 							t.Fail()
 						}
+						if bytes.Equal(bucket, certsByAccountIDTable) {
+							assert.Equals(t, key, []byte(cert.AccountID))
+							assert.Equals(t, old, nil)
+							assert.Equals(t, nu, []byte(`["`+cert.ID+`"]`))
+						}
 						if bytes.Equal(bucket, certTable) {
 							*idPtr = string(key)
 							assert.Equals(t, bucket, certTable)
@@ -10,6 +10,7 @@ import (
 	"github.com/smallstep/nosql"
 
 	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/acme/perspective"
 )
 
 type dbChallenge struct {
@@ -23,6 +24,8 @@ type dbChallenge struct {
 	ValidatedAt string             `json:"validatedAt"`
 	CreatedAt   time.Time          `json:"createdAt"`
 	Error       *acme.Error        `json:"error"` // TODO(hs): a bit dangerous; should become db-specific type
+	// Perspectives contains the result of each remote validation perspective.
+	Perspectives []*perspective.Result `json:"perspectives,omitempty"`
 }
 
 func (dbc *dbChallenge) clone() *dbChallenge {
@@ -78,15 +81,16 @@ func (db *DB) GetChallenge(ctx context.Context, id, authzID string) (*acme.Chall
 	}
 
 	ch := &acme.Challenge{
-		ID:          dbch.ID,
-		AccountID:   dbch.AccountID,
-		Type:        dbch.Type,
-		Value:       dbch.Value,
-		Status:      dbch.Status,
-		Token:       dbch.Token,
-		Error:       dbch.Error,
-		ValidatedAt: dbch.ValidatedAt,
-		Target:      dbch.Target,
+		ID:           dbch.ID,
+		AccountID:    dbch.AccountID,
+		Type:         dbch.Type,
+		Value:        dbch.Value,
+		Status:       dbch.Status,
+		Token:        dbch.Token,
+		Error:        dbch.Error,
+		ValidatedAt:  dbch.ValidatedAt,
+		Target:       dbch.Target,
+		Perspectives: dbch.Perspectives,
 	}
 	return ch, nil
 }
@@ -104,6 +108,7 @@ func (db *DB) UpdateChallenge(ctx context.Context, ch *acme.Challenge) error {
 	nu.Status = ch.Status
 	nu.Error = ch.Error
 	nu.ValidatedAt = ch.ValidatedAt
+	nu.Perspectives = ch.Perspectives
 
 	return db.save(ctx, old.ID, nu, old, "challenge", challengeTable)
 }
@@ -0,0 +1,89 @@
+package nosql
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/nosql"
+)
+
+type dbFinalizeJob struct {
+	ID              string    `json:"id"`
+	ProvisionerName string    `json:"provisionerName"`
+	CSR             []byte    `json:"csr"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+func (a *dbFinalizeJob) toFinalizeJob() (*acme.FinalizeJob, error) {
+	csr, err := x509.ParseCertificateRequest(a.CSR)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing csr of finalize job %s", a.ID)
+	}
+	return &acme.FinalizeJob{
+		OrderID:         a.ID,
+		ProvisionerName: a.ProvisionerName,
+		CSR:             csr,
+		CreatedAt:       a.CreatedAt,
+	}, nil
+}
+
+// CreateFinalizeJob stores a job for an order finalized asynchronously. The
+// job is stored using the ID of the order.
+func (db *DB) CreateFinalizeJob(ctx context.Context, job *acme.FinalizeJob) error {
+	dbj := &dbFinalizeJob{
+		ID:              job.OrderID,
+		ProvisionerName: job.ProvisionerName,
+		CSR:             job.CSR.Raw,
+		CreatedAt:       job.CreatedAt,
+	}
+	return db.save(ctx, job.OrderID, dbj, nil, "finalize job", finalizeJobTable)
+}
+
+// GetFinalizeJob retrieves the finalize job of an order. It returns
+// acme.ErrNotFound if the order has no job.
+func (db *DB) GetFinalizeJob(_ context.Context, orderID string) (*acme.FinalizeJob, error) {
+	b, err := db.db.Get(finalizeJobTable, []byte(orderID))
+	if nosql.IsErrNotFound(err) {
+		return nil, acme.ErrNotFound
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "error loading finalize job %s", orderID)
+	}
+	dbj := new(dbFinalizeJob)
+	if err := json.Unmarshal(b, dbj); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling finalize job %s into dbFinalizeJob", orderID)
+	}
+	return dbj.toFinalizeJob()
+}
+
+// GetFinalizeJobs retrieves all the pending finalize jobs.
+func (db *DB) GetFinalizeJobs(context.Context) ([]*acme.FinalizeJob, error) {
+	entries, err := db.db.List(finalizeJobTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing finalize jobs")
+	}
+	jobs := []*acme.FinalizeJob{}
+	for _, entry := range entries {
+		dbj := new(dbFinalizeJob)
+		if err := json.Unmarshal(entry.Value, dbj); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling finalize job key '%s' into dbFinalizeJob", string(entry.Key))
+		}
+		job, err := dbj.toFinalizeJob()
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// DeleteFinalizeJob deletes the finalize job of an order.
+func (db *DB) DeleteFinalizeJob(_ context.Context, orderID string) error {
+	if err := db.db.Del(finalizeJobTable, []byte(orderID)); err != nil {
+		return errors.Wrapf(err, "error deleting finalize job %s", orderID)
+	}
+	return nil
+}
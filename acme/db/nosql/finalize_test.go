@@ -0,0 +1,157 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestDB_CreateFinalizeJob(t *testing.T) {
+	now := clock.Now()
+	csr := mustStarCSR(t)
+	job := &acme.FinalizeJob{
+		OrderID:         "orderID",
+		ProvisionerName: "acme",
+		CSR:             csr,
+		CreatedAt:       now,
+	}
+
+	t.Run("fail/cmpAndSwap-error", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+				return nil, false, errors.New("force")
+			},
+		}}
+		err := d.CreateFinalizeJob(context.Background(), job)
+		if assert.NotNil(t, err) {
+			assert.Equals(t, err.Error(), "error saving acme finalize job: force")
+		}
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, finalizeJobTable)
+				assert.Equals(t, string(key), "orderID")
+				assert.Equals(t, old, nil)
+
+				dbj := new(dbFinalizeJob)
+				assert.FatalError(t, json.Unmarshal(nu, dbj))
+				assert.Equals(t, dbj.ID, "orderID")
+				assert.Equals(t, dbj.ProvisionerName, "acme")
+				assert.Equals(t, dbj.CSR, csr.Raw)
+				assert.Equals(t, dbj.CreatedAt, now)
+				return nu, true, nil
+			},
+		}}
+		assert.FatalError(t, d.CreateFinalizeJob(context.Background(), job))
+	})
+}
+
+func TestDB_GetFinalizeJob(t *testing.T) {
+	csr := mustStarCSR(t)
+
+	t.Run("fail/not-found", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, database.ErrNotFound
+			},
+		}}
+		_, err := d.GetFinalizeJob(context.Background(), "orderID")
+		assert.True(t, acme.IsErrNotFound(err))
+	})
+
+	t.Run("fail/db.Get-error", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, errors.New("force")
+			},
+		}}
+		_, err := d.GetFinalizeJob(context.Background(), "orderID")
+		if assert.NotNil(t, err) {
+			assert.Equals(t, err.Error(), "error loading finalize job orderID: force")
+		}
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		b, err := json.Marshal(&dbFinalizeJob{ID: "orderID", ProvisionerName: "acme", CSR: csr.Raw})
+		assert.FatalError(t, err)
+		d := DB{db: &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, finalizeJobTable)
+				assert.Equals(t, string(key), "orderID")
+				return b, nil
+			},
+		}}
+		job, err := d.GetFinalizeJob(context.Background(), "orderID")
+		assert.FatalError(t, err)
+		assert.Equals(t, job.OrderID, "orderID")
+		assert.Equals(t, job.ProvisionerName, "acme")
+		assert.Equals(t, job.CSR.Raw, csr.Raw)
+	})
+}
+
+func TestDB_GetFinalizeJobs(t *testing.T) {
+	csr := mustStarCSR(t)
+
+	t.Run("fail/db.List-error", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return nil, errors.New("force")
+			},
+		}}
+		_, err := d.GetFinalizeJobs(context.Background())
+		if assert.NotNil(t, err) {
+			assert.Equals(t, err.Error(), "error listing finalize jobs: force")
+		}
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		b, err := json.Marshal(&dbFinalizeJob{ID: "orderID", ProvisionerName: "acme", CSR: csr.Raw})
+		assert.FatalError(t, err)
+		d := DB{db: &db.MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				assert.Equals(t, bucket, finalizeJobTable)
+				return []*database.Entry{{Bucket: finalizeJobTable, Key: []byte("orderID"), Value: b}}, nil
+			},
+		}}
+		jobs, err := d.GetFinalizeJobs(context.Background())
+		assert.FatalError(t, err)
+		if assert.Equals(t, len(jobs), 1) {
+			assert.Equals(t, jobs[0].OrderID, "orderID")
+			assert.Equals(t, jobs[0].ProvisionerName, "acme")
+			assert.Equals(t, jobs[0].CSR.Raw, csr.Raw)
+		}
+	})
+}
+
+func TestDB_DeleteFinalizeJob(t *testing.T) {
+	t.Run("fail/db.Del-error", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MDel: func(bucket, key []byte) error {
+				return errors.New("force")
+			},
+		}}
+		err := d.DeleteFinalizeJob(context.Background(), "orderID")
+		if assert.NotNil(t, err) {
+			assert.Equals(t, err.Error(), "error deleting finalize job orderID: force")
+		}
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MDel: func(bucket, key []byte) error {
+				assert.Equals(t, bucket, finalizeJobTable)
+				assert.Equals(t, string(key), "orderID")
+				return nil
+			},
+		}}
+		assert.FatalError(t, d.DeleteFinalizeJob(context.Background(), "orderID"))
+	})
+}
@@ -0,0 +1,167 @@
+package nosql
+
+import (
+	"encoding/json"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	nosqlDB "github.com/smallstep/nosql"
+)
+
+// accountIndexesMigration is the key used in the migrations table to record
+// that the account, certificate and order history indexes have been
+// backfilled.
+var accountIndexesMigration = []byte("account-indexes")
+
+// indexEntry is an id added to an index together with its creation time, used
+// to keep the backfilled ids in creation order.
+type indexEntry struct {
+	id        string
+	createdAt time.Time
+}
+
+// backfillAccountIndexes adds the accounts, certificates and orders created
+// before the accountsByProvisionerID, certsByAccountID and
+// orderHistoryByAccountID indexes existed to those indexes. It runs only once;
+// completion is recorded in the migrations table.
+//
+// Accounts created before the provisioner ID was stored are indexed using the
+// provisioner ID of their orders. Accounts without a provisioner ID and
+// without orders cannot be indexed.
+func (db *DB) backfillAccountIndexes() error {
+	_, err := db.db.Get(migrationsTable, accountIndexesMigration)
+	switch {
+	case err == nil:
+		return nil
+	case !nosqlDB.IsErrNotFound(err):
+		return errors.Wrap(err, "error loading acme migrations")
+	}
+
+	// Orders
+	orders, err := db.db.List(orderTable)
+	if err != nil {
+		return errors.Wrap(err, "error listing acme orders")
+	}
+	orderHistory := map[string][]indexEntry{}
+	provisionerByAccountID := map[string]string{}
+	for _, entry := range orders {
+		dbo := new(dbOrder)
+		if err := json.Unmarshal(entry.Value, dbo); err != nil {
+			return errors.Wrapf(err, "error unmarshaling order %s into dbOrder", string(entry.Key))
+		}
+		if dbo.AccountID == "" {
+			continue
+		}
+		orderHistory[dbo.AccountID] = append(orderHistory[dbo.AccountID], indexEntry{dbo.ID, dbo.CreatedAt})
+		if dbo.ProvisionerID != "" {
+			provisionerByAccountID[dbo.AccountID] = dbo.ProvisionerID
+		}
+	}
+
+	// Accounts
+	accounts, err := db.db.List(accountTable)
+	if err != nil {
+		return errors.Wrap(err, "error listing acme accounts")
+	}
+	accountsByProvisioner := map[string][]indexEntry{}
+	for _, entry := range accounts {
+		dba := new(dbAccount)
+		if err := json.Unmarshal(entry.Value, dba); err != nil {
+			return errors.Wrapf(err, "error unmarshaling account %s into dbAccount", string(entry.Key))
+		}
+		provisionerID := dba.ProvisionerID
+		if provisionerID == "" {
+			provisionerID = provisionerByAccountID[dba.ID]
+		}
+		if provisionerID == "" {
+			continue
+		}
+		accountsByProvisioner[provisionerID] = append(accountsByProvisioner[provisionerID], indexEntry{dba.ID, dba.CreatedAt})
+	}
+
+	// Certificates
+	certs, err := db.db.List(certTable)
+	if err != nil {
+		return errors.Wrap(err, "error listing acme certificates")
+	}
+	certsByAccount := map[string][]indexEntry{}
+	for _, entry := range certs {
+		dbc := new(dbCert)
+		if err := json.Unmarshal(entry.Value, dbc); err != nil {
+			return errors.Wrapf(err, "error unmarshaling certificate %s into dbCert", string(entry.Key))
+		}
+		if dbc.AccountID == "" {
+			continue
+		}
+		certsByAccount[dbc.AccountID] = append(certsByAccount[dbc.AccountID], indexEntry{dbc.ID, dbc.CreatedAt})
+	}
+
+	for table, index := range map[string]map[string][]indexEntry{
+		string(accountsByProvisionerIDTable): accountsByProvisioner,
+		string(orderHistoryByAccountIDTable): orderHistory,
+		string(certsByAccountIDTable):        certsByAccount,
+	} {
+		for key, entries := range index {
+			if err := db.backfillIndex([]byte(table), key, entries); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := db.db.Set(migrationsTable, accountIndexesMigration, []byte(clock.Now().Format(time.RFC3339))); err != nil {
+		return errors.Wrap(err, "error saving acme migrations")
+	}
+	return nil
+}
+
+// backfillIndex adds the entries missing in the list of ids stored under key
+// in the given index table. The missing ids are older than the ones already
+// indexed, so they are added in creation order before them.
+func (db *DB) backfillIndex(table []byte, key string, entries []indexEntry) error {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].createdAt.Before(entries[j].createdAt)
+	})
+
+	for i := 0; i < maxIndexRetries; i++ {
+		var (
+			ids  []string
+			oldB []byte
+		)
+		b, err := db.db.Get(table, []byte(key))
+		switch {
+		case nosqlDB.IsErrNotFound(err):
+		case err != nil:
+			return errors.Wrapf(err, "error loading index %s for key %s", string(table), key)
+		default:
+			if err := json.Unmarshal(b, &ids); err != nil {
+				return errors.Wrapf(err, "error unmarshaling index %s for key %s", string(table), key)
+			}
+			oldB = b
+		}
+
+		var missing []string
+		for _, e := range entries {
+			if !slices.Contains(ids, e.id) {
+				missing = append(missing, e.id)
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+
+		newB, err := json.Marshal(append(missing, ids...))
+		if err != nil {
+			return errors.Wrapf(err, "error marshaling index %s for key %s", string(table), key)
+		}
+		_, swapped, err := db.db.CmpAndSwap(table, []byte(key), oldB, newB)
+		switch {
+		case err != nil:
+			return errors.Wrapf(err, "error saving index %s for key %s", string(table), key)
+		case swapped:
+			return nil
+		}
+	}
+	return errors.Errorf("error saving index %s for key %s; too many concurrent updates", string(table), key)
+}
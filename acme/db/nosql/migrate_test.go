@@ -0,0 +1,85 @@
+package nosql
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestDB_backfillAccountIndexes(t *testing.T) {
+	now := clock.Now()
+	mustSet := func(t *testing.T, d nosql.DB, table []byte, key string, v interface{}) {
+		t.Helper()
+		b, err := json.Marshal(v)
+		assert.FatalError(t, err)
+		assert.FatalError(t, d.Set(table, []byte(key), b))
+	}
+	mustIndex := func(t *testing.T, d *DB, table []byte, key string) []string {
+		t.Helper()
+		ids, err := d.getIndex(table, key)
+		assert.FatalError(t, err)
+		return ids
+	}
+
+	t.Run("fail/db.Get-error", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, migrationsTable)
+				return nil, errors.New("force")
+			},
+		}}
+		err := d.backfillAccountIndexes()
+		if assert.NotNil(t, err) {
+			assert.Equals(t, err.Error(), "error loading acme migrations: force")
+		}
+	})
+
+	t.Run("ok/already-done", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return []byte("done"), nil
+			},
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				t.Fatal("unexpected call to List")
+				return nil, nil
+			},
+		}}
+		assert.FatalError(t, d.backfillAccountIndexes())
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		ndb, err := nosql.New("badgerv2", t.TempDir())
+		assert.FatalError(t, err)
+		d, err := New(ndb)
+		assert.FatalError(t, err)
+
+		// Reset the migration and add records created before the indexes.
+		assert.FatalError(t, ndb.Del(migrationsTable, accountIndexesMigration))
+		mustSet(t, ndb, accountTable, "acc1", &dbAccount{ID: "acc1", ProvisionerID: "prov1", CreatedAt: now.Add(-2 * time.Hour)})
+		mustSet(t, ndb, accountTable, "acc2", &dbAccount{ID: "acc2", CreatedAt: now.Add(-time.Hour)})
+		mustSet(t, ndb, accountTable, "acc3", &dbAccount{ID: "acc3", CreatedAt: now.Add(-time.Hour)})
+		mustSet(t, ndb, orderTable, "ord1", &dbOrder{ID: "ord1", AccountID: "acc2", ProvisionerID: "prov1", CreatedAt: now.Add(-time.Hour)})
+		mustSet(t, ndb, orderTable, "ord2", &dbOrder{ID: "ord2", AccountID: "acc2", ProvisionerID: "prov1", CreatedAt: now.Add(-2 * time.Hour)})
+		mustSet(t, ndb, certTable, "cert1", &dbCert{ID: "cert1", AccountID: "acc2", CreatedAt: now.Add(-time.Hour)})
+
+		// Records created after the indexes are already indexed.
+		mustSet(t, ndb, orderTable, "ord3", &dbOrder{ID: "ord3", AccountID: "acc2", ProvisionerID: "prov1", CreatedAt: now})
+		assert.FatalError(t, d.addToIndex(orderHistoryByAccountIDTable, "acc2", "ord3"))
+
+		assert.FatalError(t, d.backfillAccountIndexes())
+		assert.Equals(t, mustIndex(t, d, accountsByProvisionerIDTable, "prov1"), []string{"acc1", "acc2"})
+		assert.Equals(t, mustIndex(t, d, orderHistoryByAccountIDTable, "acc2"), []string{"ord2", "ord1", "ord3"})
+		assert.Equals(t, mustIndex(t, d, certsByAccountIDTable, "acc2"), []string{"cert1"})
+
+		// The migration only runs once.
+		mustSet(t, ndb, certTable, "cert2", &dbCert{ID: "cert2", AccountID: "acc2", CreatedAt: now})
+		assert.FatalError(t, d.backfillAccountIndexes())
+		assert.Equals(t, mustIndex(t, d, certsByAccountIDTable, "acc2"), []string{"cert1"})
+	})
+}
@@ -14,10 +14,16 @@ var (
 	accountTable                              = []byte("acme_accounts")
 	accountByKeyIDTable                       = []byte("acme_keyID_accountID_index")
 	authzTable                                = []byte("acme_authzs")
+	validAuthzByIdentifierTable               = []byte("acme_account_identifier_authz_index")
 	challengeTable                            = []byte("acme_challenges")
 	nonceTable                                = []byte("nonces")
 	orderTable                                = []byte("acme_orders")
 	ordersByAccountIDTable                    = []byte("acme_account_orders_index")
+	orderHistoryByAccountIDTable              = []byte("acme_account_order_history_index")
+	accountsByProvisionerIDTable              = []byte("acme_provisioner_accounts_index")
+	certsByAccountIDTable                     = []byte("acme_account_certs_index")
+	starOrderTable                            = []byte("acme_star_orders")
+	finalizeJobTable                          = []byte("acme_finalize_jobs")
 	certTable                                 = []byte("acme_certs")
 	certBySerialTable                         = []byte("acme_serial_certs_index")
 	externalAccountKeyTable                   = []byte("acme_external_account_keys")
@@ -25,6 +31,7 @@ var (
 	externalAccountKeyIDsByProvisionerIDTable = []byte("acme_external_account_keyID_provisionerID_index")
 	wireDpopTokenTable                        = []byte("wire_acme_dpop_token")
 	wireOidcTokenTable                        = []byte("wire_acme_oidc_token")
+	migrationsTable                           = []byte("acme_migrations")
 )
 
 // DB is a struct that implements the AcmeDB interface.
@@ -34,18 +41,23 @@ type DB struct {
 
 // New configures and returns a new ACME DB backend implemented using a nosql DB.
 func New(db nosqlDB.DB) (*DB, error) {
-	tables := [][]byte{accountTable, accountByKeyIDTable, authzTable,
-		challengeTable, nonceTable, orderTable, ordersByAccountIDTable,
-		certTable, certBySerialTable, externalAccountKeyTable,
+	tables := [][]byte{accountTable, accountByKeyIDTable, accountsByProvisionerIDTable, authzTable,
+		validAuthzByIdentifierTable, challengeTable, nonceTable, orderTable, ordersByAccountIDTable,
+		orderHistoryByAccountIDTable, starOrderTable, finalizeJobTable,
+		certTable, certBySerialTable, certsByAccountIDTable, externalAccountKeyTable,
 		externalAccountKeyIDsByReferenceTable, externalAccountKeyIDsByProvisionerIDTable,
-		wireDpopTokenTable, wireOidcTokenTable,
+		wireDpopTokenTable, wireOidcTokenTable, migrationsTable,
 	}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
 			return nil, errors.Wrapf(err, "error creating table %s", string(b))
 		}
 	}
-	return &DB{db}, nil
+	acmeDB := &DB{db}
+	if err := acmeDB.backfillAccountIndexes(); err != nil {
+		return nil, errors.Wrap(err, "error backfilling acme indexes")
+	}
+	return acmeDB, nil
 }
 
 // save writes the new data to the database, overwriting the old data if it
@@ -84,6 +96,56 @@ func (db *DB) save(_ context.Context, id string, nu, old interface{}, typ string
 	}
 }
 
+// maxIndexRetries is the number of times an index is read again when it
+// changes while it's being updated.
+const maxIndexRetries = 10
+
+// addToIndex appends the given id to the list of ids stored under key in the
+// given index table. Concurrent updates are retried.
+func (db *DB) addToIndex(table []byte, key, id string) error {
+	var (
+		ids  []string
+		oldB []byte
+	)
+	for i := 0; i < maxIndexRetries; i++ {
+		newB, err := json.Marshal(append(ids, id))
+		if err != nil {
+			return errors.Wrapf(err, "error marshaling index %s for key %s", string(table), key)
+		}
+		current, swapped, err := db.db.CmpAndSwap(table, []byte(key), oldB, newB)
+		switch {
+		case err != nil:
+			return errors.Wrapf(err, "error saving index %s for key %s", string(table), key)
+		case swapped:
+			return nil
+		}
+		ids, oldB = nil, nil
+		if len(current) > 0 {
+			if err := json.Unmarshal(current, &ids); err != nil {
+				return errors.Wrapf(err, "error unmarshaling index %s for key %s", string(table), key)
+			}
+			oldB = current
+		}
+	}
+	return errors.Errorf("error saving index %s for key %s; too many concurrent updates", string(table), key)
+}
+
+// getIndex returns the list of ids stored under key in the given index table.
+func (db *DB) getIndex(table []byte, key string) ([]string, error) {
+	b, err := db.db.Get(table, []byte(key))
+	switch {
+	case nosqlDB.IsErrNotFound(err):
+		return []string{}, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "error loading index %s for key %s", string(table), key)
+	}
+	var ids []string
+	if err := json.Unmarshal(b, &ids); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling index %s for key %s", string(table), key)
+	}
+	return ids, nil
+}
+
 var idLen = 32
 
 func randID() (val string, err error) {
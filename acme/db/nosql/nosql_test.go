@@ -8,6 +8,7 @@ import (
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
 )
 
 func TestNew(t *testing.T) {
@@ -137,3 +138,132 @@ func TestDB_save(t *testing.T) {
 		})
 	}
 }
+
+func TestDB_addToIndex(t *testing.T) {
+	t.Run("ok/retry", func(t *testing.T) {
+		calls := 0
+		d := DB{db: &db.MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+				calls++
+				assert.Equals(t, bucket, certsByAccountIDTable)
+				assert.Equals(t, string(key), "accID")
+				if calls == 1 {
+					assert.Equals(t, old, nil)
+					assert.Equals(t, string(nu), `["certID"]`)
+					return []byte(`["other"]`), false, nil
+				}
+				assert.Equals(t, string(old), `["other"]`)
+				assert.Equals(t, string(nu), `["other","certID"]`)
+				return nu, true, nil
+			},
+		}}
+		assert.FatalError(t, d.addToIndex(certsByAccountIDTable, "accID", "certID"))
+		assert.Equals(t, calls, 2)
+	})
+
+	t.Run("fail/cmpAndSwap-error", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+				return nil, false, errors.New("force")
+			},
+		}}
+		err := d.addToIndex(certsByAccountIDTable, "accID", "certID")
+		if assert.NotNil(t, err) {
+			assert.Equals(t, err.Error(), "error saving index acme_account_certs_index for key accID: force")
+		}
+	})
+
+	t.Run("fail/too-many-retries", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+				return []byte(`["other"]`), false, nil
+			},
+		}}
+		err := d.addToIndex(certsByAccountIDTable, "accID", "certID")
+		if assert.NotNil(t, err) {
+			assert.Equals(t, err.Error(), "error saving index acme_account_certs_index for key accID; too many concurrent updates")
+		}
+	})
+}
+
+func TestDB_getIndex(t *testing.T) {
+	t.Run("ok/not-found", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, database.ErrNotFound
+			},
+		}}
+		ids, err := d.getIndex(accountsByProvisionerIDTable, "provID")
+		assert.FatalError(t, err)
+		assert.Equals(t, ids, []string{})
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, accountsByProvisionerIDTable)
+				assert.Equals(t, string(key), "provID")
+				return []byte(`["acc1","acc2"]`), nil
+			},
+		}}
+		ids, err := d.getIndex(accountsByProvisionerIDTable, "provID")
+		assert.FatalError(t, err)
+		assert.Equals(t, ids, []string{"acc1", "acc2"})
+	})
+
+	t.Run("fail/db.Get-error", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, errors.New("force")
+			},
+		}}
+		_, err := d.getIndex(accountsByProvisionerIDTable, "provID")
+		if assert.NotNil(t, err) {
+			assert.Equals(t, err.Error(), "error loading index acme_provisioner_accounts_index for key provID: force")
+		}
+	})
+}
+
+func TestDB_GetAccountsByProvisionerID(t *testing.T) {
+	d := DB{db: &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			switch string(bucket) {
+			case string(accountsByProvisionerIDTable):
+				assert.Equals(t, string(key), "provID")
+				return []byte(`["accID"]`), nil
+			case string(accountTable):
+				assert.Equals(t, string(key), "accID")
+				return []byte(`{"id":"accID","status":"valid","provisionerID":"provID","createdAt":"2026-01-01T00:00:00Z"}`), nil
+			default:
+				return nil, errors.Errorf("unexpected bucket %s", string(bucket))
+			}
+		},
+	}}
+	accs, err := d.GetAccountsByProvisionerID(context.Background(), "provID")
+	assert.FatalError(t, err)
+	if assert.Equals(t, len(accs), 1) {
+		assert.Equals(t, accs[0].ID, "accID")
+		assert.Equals(t, accs[0].ProvisionerID, "provID")
+		assert.Equals(t, accs[0].CreatedAt.Year(), 2026)
+	}
+}
+
+func TestDB_GetOrderHistoryByAccountID(t *testing.T) {
+	d := DB{db: &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			switch string(bucket) {
+			case string(orderHistoryByAccountIDTable):
+				assert.Equals(t, string(key), "accID")
+				return []byte(`["ordID"]`), nil
+			case string(orderTable):
+				return nil, database.ErrNotFound
+			default:
+				return nil, errors.Errorf("unexpected bucket %s", string(bucket))
+			}
+		},
+	}}
+	_, err := d.GetOrderHistoryByAccountID(context.Background(), "accID")
+	if assert.NotNil(t, err) {
+		assert.Equals(t, err.Error(), "error loading order ordID for account accID: order ordID not found")
+	}
+}
@@ -27,6 +27,7 @@ type dbOrder struct {
 	ExpiresAt        time.Time         `json:"expiresAt,omitempty"`
 	CertificateID    string            `json:"certificate,omitempty"`
 	Error            *acme.Error       `json:"error,omitempty"`
+	AutoRenewal      *acme.AutoRenewal `json:"autoRenewal,omitempty"`
 }
 
 func (a *dbOrder) clone() *dbOrder {
@@ -68,6 +69,7 @@ func (db *DB) GetOrder(ctx context.Context, id string) (*acme.Order, error) {
 		NotAfter:         dbo.NotAfter,
 		AuthorizationIDs: dbo.AuthorizationIDs,
 		Error:            dbo.Error,
+		AutoRenewal:      dbo.AutoRenewal,
 	}
 
 	return o, nil
@@ -93,6 +95,7 @@ func (db *DB) CreateOrder(ctx context.Context, o *acme.Order) error {
 		NotBefore:        o.NotBefore,
 		NotAfter:         o.NotAfter,
 		AuthorizationIDs: o.AuthorizationIDs,
+		AutoRenewal:      o.AutoRenewal,
 	}
 	if err := db.save(ctx, o.ID, dbo, nil, "order", orderTable); err != nil {
 		return err
@@ -102,7 +105,25 @@ func (db *DB) CreateOrder(ctx context.Context, o *acme.Order) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	return db.addToIndex(orderHistoryByAccountIDTable, o.AccountID, o.ID)
+}
+
+// GetOrderHistoryByAccountID retrieves all the orders created by the account,
+// regardless of their status.
+func (db *DB) GetOrderHistoryByAccountID(ctx context.Context, accountID string) ([]*acme.Order, error) {
+	ids, err := db.getIndex(orderHistoryByAccountIDTable, accountID)
+	if err != nil {
+		return nil, err
+	}
+	orders := make([]*acme.Order, 0, len(ids))
+	for _, id := range ids {
+		o, err := db.GetOrder(ctx, id)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error loading order %s for account %s", id, accountID)
+		}
+		orders = append(orders, o)
+	}
+	return orders, nil
 }
 
 // UpdateOrder saves an updated ACME Order to the database.
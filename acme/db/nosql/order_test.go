@@ -539,6 +539,13 @@ func TestDB_CreateOrder(t *testing.T) {
 							assert.Equals(t, dbo.Identifiers, o.Identifiers)
 							assert.Equals(t, dbo.Error, nil)
 							return nu, true, nil
+						case string(orderHistoryByAccountIDTable):
+							b, err := json.Marshal([]string{o.ID})
+							assert.FatalError(t, err)
+							assert.Equals(t, string(key), "accID")
+							assert.Equals(t, old, nil)
+							assert.Equals(t, nu, b)
+							return nu, true, nil
 						default:
 							assert.FatalError(t, errors.Errorf("unexpected bucket %s", string(bucket)))
 							return nil, false, errors.New("force")
@@ -0,0 +1,152 @@
+package nosql
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/nosql"
+)
+
+type dbStarOrder struct {
+	ID                string            `json:"id"`
+	AccountID         string            `json:"accountID"`
+	ProvisionerName   string            `json:"provisionerName"`
+	Status            acme.Status       `json:"status"`
+	AutoRenewal       *acme.AutoRenewal `json:"autoRenewal"`
+	CSR               []byte            `json:"csr"`
+	CertificateID     string            `json:"certificateID"`
+	PeriodStart       time.Time         `json:"periodStart"`
+	NotBefore         time.Time         `json:"notBefore"`
+	NotAfter          time.Time         `json:"notAfter"`
+	NextCertificateID string            `json:"nextCertificateID,omitempty"`
+	NextPeriodStart   time.Time         `json:"nextPeriodStart"`
+	NextNotBefore     time.Time         `json:"nextNotBefore"`
+	NextNotAfter      time.Time         `json:"nextNotAfter"`
+	CreatedAt         time.Time         `json:"createdAt"`
+	UpdatedAt         time.Time         `json:"updatedAt"`
+}
+
+func (a *dbStarOrder) clone() *dbStarOrder {
+	b := *a
+	return &b
+}
+
+func (a *dbStarOrder) toStarOrder() (*acme.StarOrder, error) {
+	csr, err := x509.ParseCertificateRequest(a.CSR)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing csr of star order %s", a.ID)
+	}
+	return &acme.StarOrder{
+		OrderID:           a.ID,
+		AccountID:         a.AccountID,
+		ProvisionerName:   a.ProvisionerName,
+		Status:            a.Status,
+		AutoRenewal:       a.AutoRenewal,
+		CSR:               csr,
+		CertificateID:     a.CertificateID,
+		PeriodStart:       a.PeriodStart,
+		NotBefore:         a.NotBefore,
+		NotAfter:          a.NotAfter,
+		NextCertificateID: a.NextCertificateID,
+		NextPeriodStart:   a.NextPeriodStart,
+		NextNotBefore:     a.NextNotBefore,
+		NextNotAfter:      a.NextNotAfter,
+	}, nil
+}
+
+// getDBStarOrder retrieves and unmarshals the state of a STAR order from the
+// database.
+func (db *DB) getDBStarOrder(_ context.Context, orderID string) (*dbStarOrder, error) {
+	b, err := db.db.Get(starOrderTable, []byte(orderID))
+	if nosql.IsErrNotFound(err) {
+		return nil, acme.NewError(acme.ErrorMalformedType, "star order %s not found", orderID)
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "error loading star order %s", orderID)
+	}
+	so := new(dbStarOrder)
+	if err := json.Unmarshal(b, so); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling star order %s into dbStarOrder", orderID)
+	}
+	return so, nil
+}
+
+// CreateStarOrder stores the state of a STAR order. The state is stored
+// using the ID of the order.
+func (db *DB) CreateStarOrder(ctx context.Context, so *acme.StarOrder) error {
+	now := clock.Now()
+	dbso := &dbStarOrder{
+		ID:              so.OrderID,
+		AccountID:       so.AccountID,
+		ProvisionerName: so.ProvisionerName,
+		Status:          so.Status,
+		AutoRenewal:     so.AutoRenewal,
+		CSR:             so.CSR.Raw,
+		CertificateID:   so.CertificateID,
+		PeriodStart:     so.PeriodStart,
+		NotBefore:       so.NotBefore,
+		NotAfter:        so.NotAfter,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	return db.save(ctx, so.OrderID, dbso, nil, "star order", starOrderTable)
+}
+
+// GetStarOrder retrieves the state of a STAR order from the database.
+func (db *DB) GetStarOrder(ctx context.Context, orderID string) (*acme.StarOrder, error) {
+	dbso, err := db.getDBStarOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return dbso.toStarOrder()
+}
+
+// GetStarOrders retrieves the state of all the STAR orders that have not been
+// canceled.
+func (db *DB) GetStarOrders(context.Context) ([]*acme.StarOrder, error) {
+	entries, err := db.db.List(starOrderTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing star orders")
+	}
+	sos := []*acme.StarOrder{}
+	for _, entry := range entries {
+		dbso := new(dbStarOrder)
+		if err := json.Unmarshal(entry.Value, dbso); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling star order key '%s' into dbStarOrder", string(entry.Key))
+		}
+		if dbso.Status != acme.StatusValid {
+			continue
+		}
+		so, err := dbso.toStarOrder()
+		if err != nil {
+			return nil, err
+		}
+		sos = append(sos, so)
+	}
+	return sos, nil
+}
+
+// UpdateStarOrder saves the updated state of a STAR order to the database.
+func (db *DB) UpdateStarOrder(ctx context.Context, so *acme.StarOrder) error {
+	old, err := db.getDBStarOrder(ctx, so.OrderID)
+	if err != nil {
+		return err
+	}
+
+	nu := old.clone()
+	nu.Status = so.Status
+	nu.CertificateID = so.CertificateID
+	nu.PeriodStart = so.PeriodStart
+	nu.NotBefore = so.NotBefore
+	nu.NotAfter = so.NotAfter
+	nu.NextCertificateID = so.NextCertificateID
+	nu.NextPeriodStart = so.NextPeriodStart
+	nu.NextNotBefore = so.NextNotBefore
+	nu.NextNotAfter = so.NextNotAfter
+	nu.UpdatedAt = clock.Now()
+
+	return db.save(ctx, old.ID, nu, old, "star order", starOrderTable)
+}
@@ -0,0 +1,272 @@
+package nosql
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+func mustStarCSR(t *testing.T) *x509.CertificateRequest {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		DNSNames: []string{"example.com"},
+	}, key)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+	return csr
+}
+
+func TestDB_CreateStarOrder(t *testing.T) {
+	now := clock.Now()
+	csr := mustStarCSR(t)
+	so := &acme.StarOrder{
+		OrderID:         "orderID",
+		AccountID:       "accID",
+		ProvisionerName: "acme",
+		Status:          acme.StatusValid,
+		AutoRenewal: &acme.AutoRenewal{
+			StartDate: now,
+			EndDate:   now.Add(24 * time.Hour),
+			Lifetime:  3600,
+		},
+		CSR:           csr,
+		CertificateID: "certID",
+		PeriodStart:   now,
+		NotBefore:     now,
+		NotAfter:      now.Add(time.Hour),
+	}
+	type test struct {
+		db  nosql.DB
+		err error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/cmpAndSwap-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return nil, false, errors.New("force")
+					},
+				},
+				err: errors.New("error saving acme star order: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, starOrderTable)
+						assert.Equals(t, string(key), "orderID")
+						assert.Equals(t, old, nil)
+
+						dbso := new(dbStarOrder)
+						assert.FatalError(t, json.Unmarshal(nu, dbso))
+						assert.Equals(t, dbso.ID, "orderID")
+						assert.Equals(t, dbso.AccountID, "accID")
+						assert.Equals(t, dbso.ProvisionerName, "acme")
+						assert.Equals(t, dbso.Status, acme.StatusValid)
+						assert.Equals(t, dbso.AutoRenewal, so.AutoRenewal)
+						assert.Equals(t, dbso.CSR, csr.Raw)
+						assert.Equals(t, dbso.CertificateID, "certID")
+						assert.Equals(t, dbso.PeriodStart, now)
+						return nu, true, nil
+					},
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			err := d.CreateStarOrder(context.Background(), so)
+			if tc.err != nil {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, err.Error(), tc.err.Error())
+				}
+			} else {
+				assert.FatalError(t, err)
+			}
+		})
+	}
+}
+
+func TestDB_GetStarOrder(t *testing.T) {
+	csr := mustStarCSR(t)
+	dbso := &dbStarOrder{
+		ID:              "orderID",
+		AccountID:       "accID",
+		ProvisionerName: "acme",
+		Status:          acme.StatusValid,
+		AutoRenewal:     &acme.AutoRenewal{Lifetime: 3600},
+		CSR:             csr.Raw,
+		CertificateID:   "certID",
+	}
+	b, err := json.Marshal(dbso)
+	assert.FatalError(t, err)
+
+	type test struct {
+		db      nosql.DB
+		err     error
+		acmeErr *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/not-found": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, database.ErrNotFound
+					},
+				},
+				acmeErr: acme.NewError(acme.ErrorMalformedType, "star order orderID not found"),
+			}
+		},
+		"fail/db.Get-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading star order orderID: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, starOrderTable)
+						assert.Equals(t, string(key), "orderID")
+						return b, nil
+					},
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			so, err := d.GetStarOrder(context.Background(), "orderID")
+			switch {
+			case tc.acmeErr != nil:
+				var ae *acme.Error
+				if assert.True(t, errors.As(err, &ae)) {
+					assert.Equals(t, ae.Type, tc.acmeErr.Type)
+					assert.Equals(t, ae.Detail, tc.acmeErr.Detail)
+				}
+			case tc.err != nil:
+				if assert.NotNil(t, err) {
+					assert.Equals(t, err.Error(), tc.err.Error())
+				}
+			default:
+				assert.FatalError(t, err)
+				assert.Equals(t, so.OrderID, "orderID")
+				assert.Equals(t, so.AccountID, "accID")
+				assert.Equals(t, so.ProvisionerName, "acme")
+				assert.Equals(t, so.Status, acme.StatusValid)
+				assert.Equals(t, so.AutoRenewal, dbso.AutoRenewal)
+				assert.Equals(t, so.CSR.Raw, csr.Raw)
+				assert.Equals(t, so.CertificateID, "certID")
+			}
+		})
+	}
+}
+
+func TestDB_GetStarOrders(t *testing.T) {
+	csr := mustStarCSR(t)
+	mustEntry := func(id string, status acme.Status) *database.Entry {
+		b, err := json.Marshal(&dbStarOrder{ID: id, Status: status, CSR: csr.Raw})
+		assert.FatalError(t, err)
+		return &database.Entry{Bucket: starOrderTable, Key: []byte(id), Value: b}
+	}
+
+	t.Run("fail/db.List-error", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return nil, errors.New("force")
+			},
+		}}
+		_, err := d.GetStarOrders(context.Background())
+		if assert.NotNil(t, err) {
+			assert.Equals(t, err.Error(), "error listing star orders: force")
+		}
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				assert.Equals(t, bucket, starOrderTable)
+				return []*database.Entry{
+					mustEntry("valid", acme.StatusValid),
+					mustEntry("canceled", acme.StatusCanceled),
+				}, nil
+			},
+		}}
+		sos, err := d.GetStarOrders(context.Background())
+		assert.FatalError(t, err)
+		if assert.Equals(t, len(sos), 1) {
+			assert.Equals(t, sos[0].OrderID, "valid")
+		}
+	})
+}
+
+func TestDB_UpdateStarOrder(t *testing.T) {
+	now := clock.Now()
+	csr := mustStarCSR(t)
+	dbso := &dbStarOrder{
+		ID:              "orderID",
+		AccountID:       "accID",
+		ProvisionerName: "acme",
+		Status:          acme.StatusValid,
+		CSR:             csr.Raw,
+		CertificateID:   "certID",
+		PeriodStart:     now,
+		CreatedAt:       now,
+	}
+	b, err := json.Marshal(dbso)
+	assert.FatalError(t, err)
+
+	so := &acme.StarOrder{
+		OrderID:       "orderID",
+		Status:        acme.StatusCanceled,
+		CertificateID: "newCertID",
+		PeriodStart:   now.Add(time.Hour),
+	}
+	d := DB{db: &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			assert.Equals(t, bucket, starOrderTable)
+			assert.Equals(t, string(key), "orderID")
+			return b, nil
+		},
+		MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+			assert.Equals(t, bucket, starOrderTable)
+			assert.Equals(t, old, b)
+
+			dbNew := new(dbStarOrder)
+			assert.FatalError(t, json.Unmarshal(nu, dbNew))
+			assert.Equals(t, dbNew.AccountID, "accID")
+			assert.Equals(t, dbNew.CSR, csr.Raw)
+			assert.Equals(t, dbNew.CreatedAt, now)
+			assert.Equals(t, dbNew.Status, acme.StatusCanceled)
+			assert.Equals(t, dbNew.CertificateID, "newCertID")
+			assert.Equals(t, dbNew.PeriodStart, now.Add(time.Hour))
+			return nu, true, nil
+		},
+	}}
+	assert.FatalError(t, d.UpdateStarOrder(context.Background(), so))
+}
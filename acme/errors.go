@@ -65,6 +65,12 @@ const (
 	ErrorUserActionRequiredType
 	// ErrorNotImplementedType operation is not implemented
 	ErrorNotImplementedType
+	// ErrorAutoRenewalCanceledType the short-term certificate is no longer available because the auto-renewal order has been canceled
+	ErrorAutoRenewalCanceledType
+	// ErrorAutoRenewalExpiredType the short-term certificate is no longer available because the auto-renewal order has expired
+	ErrorAutoRenewalExpiredType
+	// ErrorAutoRenewalCancellationInvalidType request to cancel an auto-renewal order that is not in state "valid"
+	ErrorAutoRenewalCancellationInvalidType
 )
 
 // String returns the string representation of the acme problem type,
@@ -121,6 +127,12 @@ func (ap ProblemType) String() string {
 		return "userActionRequired"
 	case ErrorNotImplementedType:
 		return "notImplemented"
+	case ErrorAutoRenewalCanceledType:
+		return "autoRenewalCanceled"
+	case ErrorAutoRenewalExpiredType:
+		return "autoRenewalExpired"
+	case ErrorAutoRenewalCancellationInvalidType:
+		return "autoRenewalCancellationInvalid"
 	default:
 		return fmt.Sprintf("unsupported type ACME error type '%d'", int(ap))
 	}
@@ -266,6 +278,21 @@ var (
 			details: "Visit the “instance” URL and take actions specified there",
 			status:  400,
 		},
+		ErrorAutoRenewalCanceledType: {
+			typ:     officialACMEPrefix + ErrorAutoRenewalCanceledType.String(),
+			details: "The short-term certificate is no longer available because the auto-renewal order has been canceled",
+			status:  403,
+		},
+		ErrorAutoRenewalExpiredType: {
+			typ:     officialACMEPrefix + ErrorAutoRenewalExpiredType.String(),
+			details: "The short-term certificate is no longer available because the auto-renewal order has expired",
+			status:  403,
+		},
+		ErrorAutoRenewalCancellationInvalidType: {
+			typ:     officialACMEPrefix + ErrorAutoRenewalCancellationInvalidType.String(),
+			details: "A request to cancel an auto-renewal order that is not in state \"valid\" has been received",
+			status:  400,
+		},
 		ErrorServerInternalType: errorServerInternalMetadata,
 	}
 )
@@ -0,0 +1,272 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFinalizeWorkers is the default number of workers issuing the
+	// certificates of orders finalized asynchronously.
+	DefaultFinalizeWorkers = 4
+	// DefaultFinalizeQueueSize is the default number of orders that can be
+	// waiting to be finalized asynchronously.
+	DefaultFinalizeQueueSize = 100
+	// FinalizeRetryAfter is the number of seconds a client is asked to wait
+	// before polling an order that is being processed.
+	FinalizeRetryAfter = 2
+)
+
+type finalizeQueueKey struct{}
+
+// NewFinalizeQueueContext adds the given FinalizeQueue to the context.
+func NewFinalizeQueueContext(ctx context.Context, q *FinalizeQueue) context.Context {
+	return context.WithValue(ctx, finalizeQueueKey{}, q)
+}
+
+// FinalizeQueueFromContext returns the FinalizeQueue in the context, if any.
+func FinalizeQueueFromContext(ctx context.Context) (q *FinalizeQueue, ok bool) {
+	q, ok = ctx.Value(finalizeQueueKey{}).(*FinalizeQueue)
+	return q, ok && q != nil
+}
+
+// FinalizeJob is the state of an order waiting for its certificate to be
+// issued asynchronously.
+type FinalizeJob struct {
+	OrderID         string
+	ProvisionerName string
+	CSR             *x509.CertificateRequest
+	CreatedAt       time.Time
+}
+
+// FinalizeQueue is a bounded pool of workers that issues the certificates of
+// the orders finalized asynchronously. Jobs are persisted in the database
+// until they are processed, so the jobs left by a previous run are resumed
+// when the queue starts.
+type FinalizeQueue struct {
+	db      DB
+	auth    CertificateAuthority
+	workers int
+	jobs    chan *FinalizeJob
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	queued  map[string]struct{}
+}
+
+// NewFinalizeQueue creates a new FinalizeQueue with the given number of
+// workers and queue size. Default values are used if they are not positive.
+func NewFinalizeQueue(db DB, auth CertificateAuthority, workers, size int) *FinalizeQueue {
+	if workers <= 0 {
+		workers = DefaultFinalizeWorkers
+	}
+	if size <= 0 {
+		size = DefaultFinalizeQueueSize
+	}
+	return &FinalizeQueue{
+		db:      db,
+		auth:    auth,
+		workers: workers,
+		jobs:    make(chan *FinalizeJob, size),
+		stop:    make(chan struct{}),
+		queued:  make(map[string]struct{}),
+	}
+}
+
+// Start starts the workers and enqueues the jobs persisted in the database.
+func (q *FinalizeQueue) Start(ctx context.Context) error {
+	jobs, err := q.db.GetFinalizeJobs(ctx)
+	if err != nil {
+		return WrapErrorISE(err, "error retrieving finalize jobs")
+	}
+
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+
+	// The persisted jobs can exceed the size of the queue, so they are sent
+	// in the background.
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		for _, job := range jobs {
+			if !q.markQueued(job.OrderID) {
+				continue
+			}
+			select {
+			case q.jobs <- job:
+			case <-q.stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops the workers and waits for the jobs in progress to finish. Jobs
+// that have not been processed remain in the database.
+func (q *FinalizeQueue) Stop() {
+	close(q.stop)
+	q.wg.Wait()
+}
+
+// Enqueue persists a job and adds it to the queue. It returns a rateLimited
+// error if the queue is full.
+func (q *FinalizeQueue) Enqueue(ctx context.Context, job *FinalizeJob) error {
+	if !q.markQueued(job.OrderID) {
+		return nil
+	}
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = clock.Now()
+	}
+	if err := q.db.CreateFinalizeJob(ctx, job); err != nil {
+		q.unmarkQueued(job.OrderID)
+		return WrapErrorISE(err, "error creating finalize job for order %s", job.OrderID)
+	}
+
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		q.unmarkQueued(job.OrderID)
+		if err := q.db.DeleteFinalizeJob(ctx, job.OrderID); err != nil {
+			return WrapErrorISE(err, "error deleting finalize job for order %s", job.OrderID)
+		}
+		return NewError(ErrorRateLimitedType, "too many orders are being finalized, please try again later")
+	}
+}
+
+func (q *FinalizeQueue) markQueued(orderID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.queued[orderID]; ok {
+		return false
+	}
+	q.queued[orderID] = struct{}{}
+	return true
+}
+
+func (q *FinalizeQueue) unmarkQueued(orderID string) {
+	q.mu.Lock()
+	delete(q.queued, orderID)
+	q.mu.Unlock()
+}
+
+func (q *FinalizeQueue) worker() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case job := <-q.jobs:
+			if err := q.process(context.Background(), job); err != nil {
+				log.Printf("error finalizing ACME order %s: %v", job.OrderID, err)
+			}
+		}
+	}
+}
+
+func (q *FinalizeQueue) process(ctx context.Context, job *FinalizeJob) error {
+	defer q.unmarkQueued(job.OrderID)
+	return processFinalizeJob(ctx, q.db, q.auth, job)
+}
+
+// ProcessFinalizeJobs synchronously processes the finalize jobs persisted in
+// the database. It is used to finish the jobs left by a previous run when the
+// asynchronous finalization is no longer enabled. Errors processing a job do
+// not prevent the processing of the rest.
+func ProcessFinalizeJobs(ctx context.Context, db DB, auth CertificateAuthority) error {
+	jobs, err := db.GetFinalizeJobs(ctx)
+	if err != nil {
+		return WrapErrorISE(err, "error retrieving finalize jobs")
+	}
+	var errs []error
+	for _, job := range jobs {
+		if err := processFinalizeJob(ctx, db, auth, job); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// processFinalizeJob issues the certificate of an order in the processing
+// state. The job is kept in the database if the order cannot be loaded or
+// updated, so it is retried later.
+func processFinalizeJob(ctx context.Context, db DB, auth CertificateAuthority, job *FinalizeJob) error {
+	o, err := db.GetOrder(ctx, job.OrderID)
+	if err != nil {
+		return WrapErrorISE(err, "error retrieving order %s", job.OrderID)
+	}
+	return o.processFinalizeJob(ctx, db, auth, job)
+}
+
+// processFinalizeJob issues the certificate of the order if it is in the
+// processing state and deletes the job. If the issuance fails, the order
+// becomes invalid.
+func (o *Order) processFinalizeJob(ctx context.Context, db DB, auth CertificateAuthority, job *FinalizeJob) error {
+	if o.Status == StatusProcessing {
+		p, err := loadProvisioner(auth, job.ProvisionerName)
+		if err == nil {
+			err = o.complete(ctx, db, job.CSR, auth, p)
+		}
+		if err != nil {
+			var ae *Error
+			if !errors.As(err, &ae) {
+				ae = WrapErrorISE(err, "error finalizing order %s", o.ID)
+			}
+			if err := o.invalidate(ctx, db, ae); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := db.DeleteFinalizeJob(ctx, job.OrderID); err != nil {
+		return WrapErrorISE(err, "error deleting finalize job for order %s", job.OrderID)
+	}
+	return nil
+}
+
+// invalidate marks the order as invalid with the given error.
+func (o *Order) invalidate(ctx context.Context, db DB, ae *Error) error {
+	o.Status = StatusInvalid
+	o.Error = ae
+	if err := db.UpdateOrder(ctx, o); err != nil {
+		return WrapErrorISE(err, "error updating order %s", o.ID)
+	}
+	return nil
+}
+
+// finishProcessing finalizes an order left in the processing state when
+// there's no FinalizeQueue, e.g. if the asynchronous finalization has been
+// disabled. The persisted job of the order is processed synchronously, and
+// the order becomes invalid if it has no job.
+func (o *Order) finishProcessing(ctx context.Context, db DB, auth CertificateAuthority) error {
+	job, err := db.GetFinalizeJob(ctx, o.ID)
+	switch {
+	case IsErrNotFound(err):
+		return o.invalidate(ctx, db, NewErrorISE("the finalization of order %s was interrupted", o.ID))
+	case err != nil:
+		return WrapErrorISE(err, "error retrieving finalize job for order %s", o.ID)
+	default:
+		return o.processFinalizeJob(ctx, db, auth, job)
+	}
+}
+
+// loadProvisioner returns the ACME provisioner with the given name.
+func loadProvisioner(auth CertificateAuthority, name string) (Provisioner, error) {
+	prov, err := auth.LoadProvisionerByName(name)
+	if err != nil {
+		return nil, WrapErrorISE(err, "error loading provisioner %s", name)
+	}
+	p, ok := prov.(Provisioner)
+	if !ok {
+		return nil, NewErrorISE("provisioner %s is not an ACME provisioner", name)
+	}
+	return p, nil
+}
@@ -0,0 +1,335 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestFinalizeQueue_Enqueue(t *testing.T) {
+	var created, deleted []string
+	db := &MockDB{
+		MockCreateFinalizeJob: func(ctx context.Context, job *FinalizeJob) error {
+			assert.False(t, job.CreatedAt.IsZero())
+			created = append(created, job.OrderID)
+			return nil
+		},
+		MockDeleteFinalizeJob: func(ctx context.Context, orderID string) error {
+			deleted = append(deleted, orderID)
+			return nil
+		},
+	}
+	q := NewFinalizeQueue(db, &mockSignAuth{}, 1, 1)
+
+	require.NoError(t, q.Enqueue(context.Background(), &FinalizeJob{OrderID: "ord1"}))
+	// Jobs already queued are ignored.
+	require.NoError(t, q.Enqueue(context.Background(), &FinalizeJob{OrderID: "ord1"}))
+
+	err := q.Enqueue(context.Background(), &FinalizeJob{OrderID: "ord2"})
+	var ae *Error
+	require.ErrorAs(t, err, &ae)
+	assert.Equal(t, "urn:ietf:params:acme:error:rateLimited", ae.Type)
+
+	assert.Equal(t, []string{"ord1", "ord2"}, created)
+	assert.Equal(t, []string{"ord2"}, deleted)
+	assert.Len(t, q.jobs, 1)
+}
+
+func TestFinalizeQueue_Enqueue_error(t *testing.T) {
+	q := NewFinalizeQueue(&MockDB{MockError: errors.New("force")}, &mockSignAuth{}, 1, 1)
+	err := q.Enqueue(context.Background(), &FinalizeJob{OrderID: "ord1"})
+	assert.EqualError(t, err, "error creating finalize job for order ord1: force")
+	assert.Empty(t, q.queued)
+}
+
+func TestFinalizeQueue_process(t *testing.T) {
+	prov := &provisioner.ACME{Type: "ACME", Name: "acme"}
+	require.NoError(t, prov.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+
+	job := &FinalizeJob{
+		OrderID:         "ordID",
+		ProvisionerName: "acme",
+		CSR:             &x509.CertificateRequest{DNSNames: []string{"example.com"}},
+	}
+	newOrder := func(status Status) *Order {
+		return &Order{
+			ID:          "ordID",
+			AccountID:   "accID",
+			Status:      status,
+			Identifiers: []Identifier{{Type: DNS, Value: "example.com"}},
+		}
+	}
+	leaf := &x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}}
+	intermediate := &x509.Certificate{Subject: pkix.Name{CommonName: "intermediate"}}
+	loadProvisioner := func(name string) (provisioner.Interface, error) {
+		assert.Equal(t, "acme", name)
+		return prov, nil
+	}
+
+	tests := []struct {
+		name       string
+		order      *Order
+		signErr    error
+		wantStatus Status
+		wantUpdate bool
+	}{
+		{"ok/valid", newOrder(StatusProcessing), nil, StatusValid, true},
+		{"ok/invalid", newOrder(StatusProcessing), errors.New("force"), StatusInvalid, true},
+		{"ok/not-processing", newOrder(StatusReady), nil, StatusReady, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updated, deleted bool
+			db := &MockDB{
+				MockGetOrder: func(ctx context.Context, id string) (*Order, error) {
+					assert.Equal(t, "ordID", id)
+					return tt.order, nil
+				},
+				MockCreateCertificate: func(ctx context.Context, cert *Certificate) error {
+					cert.ID = "certID"
+					return nil
+				},
+				MockUpdateOrder: func(ctx context.Context, o *Order) error {
+					updated = true
+					assert.Equal(t, tt.wantStatus, o.Status)
+					return nil
+				},
+				MockDeleteFinalizeJob: func(ctx context.Context, orderID string) error {
+					deleted = true
+					assert.Equal(t, "ordID", orderID)
+					return nil
+				},
+			}
+			auth := &mockSignAuth{
+				signWithContext: func(context.Context, *x509.CertificateRequest, provisioner.SignOptions, ...provisioner.SignOption) ([]*x509.Certificate, error) {
+					if tt.signErr != nil {
+						return nil, tt.signErr
+					}
+					return []*x509.Certificate{leaf, intermediate}, nil
+				},
+				loadProvisionerByName: loadProvisioner,
+			}
+
+			q := NewFinalizeQueue(db, auth, 1, 1)
+			q.markQueued(job.OrderID)
+			require.NoError(t, q.process(context.Background(), job))
+			assert.Equal(t, tt.wantUpdate, updated)
+			assert.True(t, deleted)
+			assert.Equal(t, tt.wantStatus, tt.order.Status)
+			assert.Empty(t, q.queued)
+			if tt.wantStatus == StatusInvalid {
+				require.NotNil(t, tt.order.Error)
+				assert.Equal(t, "urn:ietf:params:acme:error:serverInternal", tt.order.Error.Type)
+			}
+		})
+	}
+}
+
+func TestFinalizeQueue_process_getOrderError(t *testing.T) {
+	db := &MockDB{
+		MockGetOrder: func(ctx context.Context, id string) (*Order, error) {
+			return nil, errors.New("force")
+		},
+		MockDeleteFinalizeJob: func(ctx context.Context, orderID string) error {
+			t.Error("job should not be deleted")
+			return nil
+		},
+	}
+	q := NewFinalizeQueue(db, &mockSignAuth{}, 1, 1)
+	err := q.process(context.Background(), &FinalizeJob{OrderID: "ordID"})
+	assert.EqualError(t, err, "error retrieving order ordID: force")
+}
+
+func TestFinalizeQueue_Start(t *testing.T) {
+	done := make(chan string, 2)
+	db := &MockDB{
+		MockGetFinalizeJobs: func(ctx context.Context) ([]*FinalizeJob, error) {
+			return []*FinalizeJob{{OrderID: "ord1"}, {OrderID: "ord2"}}, nil
+		},
+		MockGetOrder: func(ctx context.Context, id string) (*Order, error) {
+			return &Order{ID: id, Status: StatusValid}, nil
+		},
+		MockDeleteFinalizeJob: func(ctx context.Context, orderID string) error {
+			done <- orderID
+			return nil
+		},
+	}
+
+	// The persisted jobs are processed even if they exceed the queue size.
+	q := NewFinalizeQueue(db, &mockSignAuth{}, 1, 1)
+	require.NoError(t, q.Start(context.Background()))
+	defer q.Stop()
+
+	var got []string
+	for len(got) < 2 {
+		select {
+		case id := <-done:
+			got = append(got, id)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for finalize jobs")
+		}
+	}
+	assert.ElementsMatch(t, []string{"ord1", "ord2"}, got)
+}
+
+func TestOrder_Finalize_async(t *testing.T) {
+	o := &Order{
+		ID:          "ordID",
+		Status:      StatusReady,
+		ExpiresAt:   clock.Now().Add(time.Hour),
+		Identifiers: []Identifier{{Type: DNS, Value: "example.com"}},
+	}
+	var status []Status
+	db := &MockDB{
+		MockUpdateOrder: func(ctx context.Context, o *Order) error {
+			status = append(status, o.Status)
+			return nil
+		},
+		MockCreateFinalizeJob: func(ctx context.Context, job *FinalizeJob) error {
+			assert.Equal(t, "acme", job.ProvisionerName)
+			assert.Equal(t, []string{"example.com"}, job.CSR.DNSNames)
+			return nil
+		},
+	}
+	q := NewFinalizeQueue(db, &mockSignAuth{}, 1, 1)
+	ctx := NewFinalizeQueueContext(context.Background(), q)
+
+	csr := &x509.CertificateRequest{DNSNames: []string{"example.com"}}
+	prov := &provisioner.ACME{Type: "ACME", Name: "acme"}
+	require.NoError(t, o.Finalize(ctx, db, csr, &mockSignAuth{}, prov))
+	assert.Equal(t, StatusProcessing, o.Status)
+	assert.Equal(t, []Status{StatusProcessing}, status)
+
+	// A full queue moves the order back to ready.
+	o2 := &Order{ID: "ordID2", Status: StatusReady, ExpiresAt: clock.Now().Add(time.Hour)}
+	err := o2.Finalize(ctx, db, csr, &mockSignAuth{}, prov)
+	var ae *Error
+	require.ErrorAs(t, err, &ae)
+	assert.Equal(t, "urn:ietf:params:acme:error:rateLimited", ae.Type)
+	assert.Equal(t, StatusReady, o2.Status)
+	assert.Equal(t, []Status{StatusProcessing, StatusProcessing, StatusReady}, status)
+}
+
+func TestProcessFinalizeJobs(t *testing.T) {
+	var deleted []string
+	db := &MockDB{
+		MockGetFinalizeJobs: func(ctx context.Context) ([]*FinalizeJob, error) {
+			return []*FinalizeJob{{OrderID: "ord1"}, {OrderID: "ord2"}, {OrderID: "ord3"}}, nil
+		},
+		MockGetOrder: func(ctx context.Context, id string) (*Order, error) {
+			if id == "ord2" {
+				return nil, errors.New("force")
+			}
+			return &Order{ID: id, Status: StatusValid}, nil
+		},
+		MockDeleteFinalizeJob: func(ctx context.Context, orderID string) error {
+			deleted = append(deleted, orderID)
+			return nil
+		},
+	}
+
+	// Errors processing a job don't stop the rest.
+	err := ProcessFinalizeJobs(context.Background(), db, &mockSignAuth{})
+	assert.EqualError(t, err, "error retrieving order ord2: force")
+	assert.Equal(t, []string{"ord1", "ord3"}, deleted)
+
+	err = ProcessFinalizeJobs(context.Background(), &MockDB{MockError: errors.New("force")}, &mockSignAuth{})
+	assert.EqualError(t, err, "error retrieving finalize jobs: force")
+}
+
+func TestOrder_Finalize_processingWithoutQueue(t *testing.T) {
+	prov := &provisioner.ACME{Type: "ACME", Name: "acme"}
+	require.NoError(t, prov.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+	csr := &x509.CertificateRequest{DNSNames: []string{"example.com"}}
+	newOrder := func() *Order {
+		return &Order{
+			ID:          "ordID",
+			AccountID:   "accID",
+			Status:      StatusProcessing,
+			ExpiresAt:   clock.Now().Add(time.Hour),
+			Identifiers: []Identifier{{Type: DNS, Value: "example.com"}},
+		}
+	}
+	auth := &mockSignAuth{
+		signWithContext: func(context.Context, *x509.CertificateRequest, provisioner.SignOptions, ...provisioner.SignOption) ([]*x509.Certificate, error) {
+			return []*x509.Certificate{
+				{Subject: pkix.Name{CommonName: "leaf"}},
+				{Subject: pkix.Name{CommonName: "intermediate"}},
+			}, nil
+		},
+		loadProvisionerByName: func(name string) (provisioner.Interface, error) {
+			assert.Equal(t, "acme", name)
+			return prov, nil
+		},
+	}
+
+	t.Run("ok/job", func(t *testing.T) {
+		var deleted bool
+		db := &MockDB{
+			MockGetFinalizeJob: func(ctx context.Context, orderID string) (*FinalizeJob, error) {
+				assert.Equal(t, "ordID", orderID)
+				return &FinalizeJob{OrderID: orderID, ProvisionerName: "acme", CSR: csr}, nil
+			},
+			MockCreateCertificate: func(ctx context.Context, cert *Certificate) error {
+				cert.ID = "certID"
+				return nil
+			},
+			MockUpdateOrder: func(ctx context.Context, o *Order) error {
+				assert.Equal(t, StatusValid, o.Status)
+				return nil
+			},
+			MockDeleteFinalizeJob: func(ctx context.Context, orderID string) error {
+				deleted = true
+				return nil
+			},
+		}
+		o := newOrder()
+		require.NoError(t, o.Finalize(context.Background(), db, csr, auth, prov))
+		assert.Equal(t, StatusValid, o.Status)
+		assert.Equal(t, "certID", o.CertificateID)
+		assert.True(t, deleted)
+	})
+
+	t.Run("ok/no-job", func(t *testing.T) {
+		db := &MockDB{
+			MockGetFinalizeJob: func(ctx context.Context, orderID string) (*FinalizeJob, error) {
+				return nil, ErrNotFound
+			},
+			MockUpdateOrder: func(ctx context.Context, o *Order) error {
+				assert.Equal(t, StatusInvalid, o.Status)
+				return nil
+			},
+		}
+		o := newOrder()
+		require.NoError(t, o.Finalize(context.Background(), db, csr, auth, prov))
+		assert.Equal(t, StatusInvalid, o.Status)
+		require.NotNil(t, o.Error)
+		assert.Equal(t, "urn:ietf:params:acme:error:serverInternal", o.Error.Type)
+	})
+
+	t.Run("fail/db.GetFinalizeJob", func(t *testing.T) {
+		db := &MockDB{
+			MockGetFinalizeJob: func(ctx context.Context, orderID string) (*FinalizeJob, error) {
+				return nil, errors.New("force")
+			},
+		}
+		err := newOrder().Finalize(context.Background(), db, csr, auth, prov)
+		assert.EqualError(t, err, "error retrieving finalize job for order ordID: force")
+	})
+
+	t.Run("ok/queue", func(t *testing.T) {
+		ctx := NewFinalizeQueueContext(context.Background(), NewFinalizeQueue(&MockDB{}, auth, 1, 1))
+		o := newOrder()
+		require.NoError(t, o.Finalize(ctx, &MockDB{}, csr, auth, prov))
+		assert.Equal(t, StatusProcessing, o.Status)
+	})
+}
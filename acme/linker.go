@@ -46,6 +46,8 @@ const (
 	RevokeCertLinkType
 	// KeyChangeLinkType key rollover
 	KeyChangeLinkType
+	// StarCertificateLinkType certificate of an auto-renewal order
+	StarCertificateLinkType
 )
 
 func (l LinkType) String() string {
@@ -74,6 +76,8 @@ func (l LinkType) String() string {
 		return "revoke-cert"
 	case KeyChangeLinkType:
 		return "key-change"
+	case StarCertificateLinkType:
+		return "star-certificate"
 	default:
 		return fmt.Sprintf("unexpected LinkType '%d'", int(l))
 	}
@@ -83,7 +87,7 @@ func GetUnescapedPathSuffix(typ LinkType, provisionerName string, inputs ...stri
 	switch typ {
 	case NewNonceLinkType, NewAccountLinkType, NewOrderLinkType, NewAuthzLinkType, DirectoryLinkType, KeyChangeLinkType, RevokeCertLinkType:
 		return fmt.Sprintf("/%s/%s", provisionerName, typ)
-	case AccountLinkType, OrderLinkType, AuthzLinkType, CertificateLinkType:
+	case AccountLinkType, OrderLinkType, AuthzLinkType, CertificateLinkType, StarCertificateLinkType:
 		return fmt.Sprintf("/%s/%s/%s", provisionerName, typ, inputs[0])
 	case ChallengeLinkType:
 		return fmt.Sprintf("/%s/%s/%s/%s", provisionerName, typ, inputs[0], inputs[1]) //nolint:gosec // operating on internally defined inputs
@@ -243,7 +247,13 @@ func (l *linker) LinkOrder(ctx context.Context, o *Order) {
 	}
 	o.FinalizeURL = l.GetLink(ctx, FinalizeLinkType, o.ID)
 	if o.CertificateID != "" {
-		o.CertificateURL = l.GetLink(ctx, CertificateLinkType, o.CertificateID)
+		// The certificates of auto-renewal orders are available in a stable
+		// URL that always returns the latest certificate.
+		if o.IsAutoRenewal() {
+			o.StarCertificateURL = l.GetLink(ctx, StarCertificateLinkType, o.ID)
+		} else {
+			o.CertificateURL = l.GetLink(ctx, CertificateLinkType, o.CertificateID)
+		}
 	}
 }
 
@@ -46,6 +46,7 @@ func TestGetUnescapedPathSuffix(t *testing.T) {
 	assert.Equals(t, getPath(AuthzLinkType, "{provisionerID}", "{authzID}"), "/{provisionerID}/authz/{authzID}")
 	assert.Equals(t, getPath(ChallengeLinkType, "{provisionerID}", "{authzID}", "{chID}"), "/{provisionerID}/challenge/{authzID}/{chID}")
 	assert.Equals(t, getPath(CertificateLinkType, "{provisionerID}", "{certID}"), "/{provisionerID}/certificate/{certID}")
+	assert.Equals(t, getPath(StarCertificateLinkType, "{provisionerID}", "{ordID}"), "/{provisionerID}/star-certificate/{ordID}")
 }
 
 func TestLinker_DNS(t *testing.T) {
@@ -61,6 +61,10 @@ type Order struct {
 	FinalizeURL       string       `json:"finalize"`
 	CertificateID     string       `json:"-"`
 	CertificateURL    string       `json:"certificate,omitempty"`
+	// AutoRenewal and StarCertificateURL are only set in short-term,
+	// automatically renewed (STAR) orders as defined in RFC 8739.
+	AutoRenewal        *AutoRenewal `json:"auto-renewal,omitempty"`
+	StarCertificateURL string       `json:"star-certificate,omitempty"`
 }
 
 // ToLog enables response logging.
@@ -82,6 +86,10 @@ func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
 		return nil
 	case StatusValid:
 		return nil
+	case StatusCanceled:
+		return nil
+	case StatusProcessing:
+		return nil
 	case StatusReady:
 		// Check expiry
 		if now.After(o.ExpiresAt) {
@@ -147,22 +155,33 @@ func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
 // There's no point on reading all the authorizations as there will be only one
 // for a permanent identifier.
 func (o *Order) getAuthorizationFingerprint(ctx context.Context, db DB) (string, error) {
+	az, err := o.getAttestedAuthorization(ctx, db)
+	if err != nil || az == nil {
+		return "", err
+	}
+	return az.Fingerprint, nil
+}
+
+// getAttestedAuthorization returns the authorization validated with a
+// device-attest-01 challenge, or nil if there is none.
+func (o *Order) getAttestedAuthorization(ctx context.Context, db DB) (*Authorization, error) {
 	for _, azID := range o.AuthorizationIDs {
 		az, err := db.GetAuthorization(ctx, azID)
 		if err != nil {
-			return "", WrapErrorISE(err, "error getting authorization %q", azID)
+			return nil, WrapErrorISE(err, "error getting authorization %q", azID)
 		}
 		// There's no point on reading all the authorizations as there will
 		// be only one for a permanent identifier.
 		if az.Fingerprint != "" {
-			return az.Fingerprint, nil
+			return az, nil
 		}
 	}
-	return "", nil
+	return nil, nil
 }
 
 // Finalize signs a certificate if the necessary conditions for Order completion
-// have been met.
+// have been met. If a FinalizeQueue is available in the context, the order is
+// moved to the processing state and the certificate is signed asynchronously.
 //
 // TODO(mariano): Here or in the challenge validation we should perform some
 // external validation using the identifier value and the attestation data. From
@@ -178,6 +197,11 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		return NewError(ErrorOrderNotReadyType, "order %s has been abandoned", o.ID)
 	case StatusValid:
 		return nil
+	case StatusProcessing:
+		if _, ok := FinalizeQueueFromContext(ctx); !ok {
+			return o.finishProcessing(ctx, db, auth)
+		}
+		return nil
 	case StatusPending:
 		return NewError(ErrorOrderNotReadyType, "order %s is not ready", o.ID)
 	case StatusReady:
@@ -204,6 +228,76 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		}
 	}
 
+	// Move the order to processing and let the workers of the queue issue
+	// the certificate if the asynchronous finalization is enabled.
+	if q, ok := FinalizeQueueFromContext(ctx); ok {
+		return o.enqueue(ctx, db, q, csr, p)
+	}
+
+	return o.complete(ctx, db, csr, auth, p)
+}
+
+// enqueue moves the order to the processing state and adds it to the given
+// finalize queue. The order goes back to ready if it cannot be enqueued.
+func (o *Order) enqueue(ctx context.Context, db DB, q *FinalizeQueue, csr *x509.CertificateRequest, p Provisioner) error {
+	o.Status = StatusProcessing
+	if err := db.UpdateOrder(ctx, o); err != nil {
+		return WrapErrorISE(err, "error updating order %s", o.ID)
+	}
+
+	if err := q.Enqueue(ctx, &FinalizeJob{
+		OrderID:         o.ID,
+		ProvisionerName: p.GetName(),
+		CSR:             csr,
+	}); err != nil {
+		o.Status = StatusReady
+		if uerr := db.UpdateOrder(ctx, o); uerr != nil {
+			return WrapErrorISE(uerr, "error updating order %s", o.ID)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// complete issues the certificate of the order and marks it as valid.
+func (o *Order) complete(ctx context.Context, db DB, csr *x509.CertificateRequest, auth CertificateAuthority, p Provisioner) error {
+	cert, err := o.issueCertificate(ctx, db, csr, auth, p, o.NotBefore, o.NotAfter)
+	if err != nil {
+		return err
+	}
+
+	// Keep the state required to reissue the certificates of STAR orders.
+	if o.IsAutoRenewal() {
+		if err := db.CreateStarOrder(ctx, &StarOrder{
+			OrderID:         o.ID,
+			AccountID:       o.AccountID,
+			ProvisionerName: p.GetName(),
+			Status:          StatusValid,
+			AutoRenewal:     o.AutoRenewal,
+			CSR:             csr,
+			CertificateID:   cert.ID,
+			PeriodStart:     o.AutoRenewal.StartDate,
+			NotBefore:       cert.Leaf.NotBefore,
+			NotAfter:        cert.Leaf.NotAfter,
+		}); err != nil {
+			return WrapErrorISE(err, "error creating auto-renewal state for order %s", o.ID)
+		}
+	}
+
+	o.CertificateID = cert.ID
+	o.Status = StatusValid
+
+	if err = db.UpdateOrder(ctx, o); err != nil {
+		return WrapErrorISE(err, "error updating order %s", o.ID)
+	}
+
+	return nil
+}
+
+// issueCertificate signs and stores a new certificate for the order using the
+// given CSR and validity bounds.
+func (o *Order) issueCertificate(ctx context.Context, db DB, csr *x509.CertificateRequest, auth CertificateAuthority, p Provisioner, notBefore, notAfter time.Time) (*Certificate, error) {
 	// canonicalize the CSR to allow for comparison
 	csr = canonicalize(csr)
 
@@ -212,24 +306,24 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 	if o.containsWireIdentifiers() {
 		wireDB, ok := db.(WireDB)
 		if !ok {
-			return fmt.Errorf("db %T is not a WireDB", db)
+			return nil, fmt.Errorf("db %T is not a WireDB", db)
 		}
 		subject, err := createWireSubject(o, csr)
 		if err != nil {
-			return fmt.Errorf("failed creating Wire subject: %w", err)
+			return nil, fmt.Errorf("failed creating Wire subject: %w", err)
 		}
 		data.SetSubject(subject)
 
 		// Inject Wire's custom challenges into the template once they have been validated
 		dpop, err := wireDB.GetDpopToken(ctx, o.ID)
 		if err != nil {
-			return fmt.Errorf("failed getting Wire DPoP token: %w", err)
+			return nil, fmt.Errorf("failed getting Wire DPoP token: %w", err)
 		}
 		data.Set("Dpop", dpop)
 
 		oidc, err := wireDB.GetOidcToken(ctx, o.ID)
 		if err != nil {
-			return fmt.Errorf("failed getting Wire OIDC token: %w", err)
+			return nil, fmt.Errorf("failed getting Wire OIDC token: %w", err)
 		}
 		data.Set("Oidc", oidc)
 	} else {
@@ -250,7 +344,7 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 			// could result in unauthorized access if a relying system relies on the Common
 			// Name in its authorization logic.
 			if csr.Subject.CommonName != "" && csr.Subject.CommonName != permanentIdentifier {
-				return NewError(ErrorBadCSRType, "CSR Subject Common Name does not match identifiers exactly: "+
+				return nil, NewError(ErrorBadCSRType, "CSR Subject Common Name does not match identifiers exactly: "+
 					"CSR Subject Common Name = %s, Order Permanent Identifier = %s", csr.Subject.CommonName, permanentIdentifier)
 			}
 			break
@@ -264,14 +358,23 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 			Type:  x509util.PermanentIdentifierType,
 			Value: permanentIdentifier,
 		})
-		extraOptions = append(extraOptions, provisioner.AttestationData{
+		attData := provisioner.AttestationData{
 			PermanentIdentifier: permanentIdentifier,
-		})
+		}
+		az, err := o.getAttestedAuthorization(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+		if az != nil {
+			attData.Fingerprint = az.Fingerprint
+			attData.Format = az.AttestationFormat
+		}
+		extraOptions = append(extraOptions, attData)
 	} else {
 		defaultTemplate = x509util.DefaultLeafTemplate
 		sans, err := o.sans(csr)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		data.SetSubjectAlternativeNames(sans...)
 	}
@@ -280,7 +383,7 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
 	signOps, err := p.AuthorizeSign(ctx, "")
 	if err != nil {
-		return WrapErrorISE(err, "error retrieving authorization options from ACME provisioner")
+		return nil, WrapErrorISE(err, "error retrieving authorization options from ACME provisioner")
 	}
 	// Unlike most of the provisioners, ACME's AuthorizeSign method doesn't
 	// define the templates, and the template data used in WebHooks is not
@@ -293,17 +396,20 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 
 	templateOptions, err := provisioner.CustomTemplateOptions(p.GetOptions(), data, defaultTemplate)
 	if err != nil {
-		return WrapErrorISE(err, "error creating template options from ACME provisioner")
+		return nil, WrapErrorISE(err, "error creating template options from ACME provisioner")
 	}
 
 	// Build extra signing options.
 	signOps = append(signOps, templateOptions)
 	signOps = append(signOps, extraOptions...)
+	signOps = append(signOps, provisioner.ACMEAccountData{
+		ID: o.AccountID,
+	})
 
 	// Sign a new certificate.
 	certChain, err := auth.SignWithContext(ctx, csr, provisioner.SignOptions{
-		NotBefore: provisioner.NewTimeDuration(o.NotBefore),
-		NotAfter:  provisioner.NewTimeDuration(o.NotAfter),
+		NotBefore: provisioner.NewTimeDuration(notBefore),
+		NotAfter:  provisioner.NewTimeDuration(notAfter),
 	}, signOps...)
 	if err != nil {
 		// Add subproblem for webhook errors, others can be added later.
@@ -314,10 +420,10 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 				Type:   fmt.Sprintf("urn:smallstep:acme:error:%s", webhookErr.Code),
 				Detail: webhookErr.Message,
 			})
-			return acmeError
+			return nil, acmeError
 		}
 
-		return WrapErrorISE(err, "error signing certificate for order %s", o.ID)
+		return nil, WrapErrorISE(err, "error signing certificate for order %s", o.ID)
 	}
 
 	cert := &Certificate{
@@ -327,17 +433,9 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		Intermediates: certChain[1:],
 	}
 	if err := db.CreateCertificate(ctx, cert); err != nil {
-		return WrapErrorISE(err, "error creating certificate for order %s", o.ID)
+		return nil, WrapErrorISE(err, "error creating certificate for order %s", o.ID)
 	}
-
-	o.CertificateID = cert.ID
-	o.Status = StatusValid
-
-	if err = db.UpdateOrder(ctx, o); err != nil {
-		return WrapErrorISE(err, "error updating order %s", o.ID)
-	}
-
-	return nil
+	return cert, nil
 }
 
 // containsWireIdentifiers checks if [Order] contains ACME
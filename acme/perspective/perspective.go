@@ -0,0 +1,379 @@
+// Package perspective implements the protocol used to corroborate ACME
+// challenge validations from remote network perspectives.
+//
+// When multi-perspective validation is enabled, every http-01, dns-01 and
+// tls-alpn-01 validation that succeeds locally is dispatched to a set of
+// remote validation agents. The challenge is only considered valid if a quorum
+// of agents reach the same result. Requests and responses are authenticated
+// using an HMAC-SHA256 signature computed with a secret shared between the CA
+// and each agent. Each response includes the hash of the request it answers,
+// so a response cannot be replayed for a different request.
+package perspective
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.step.sm/crypto/jose"
+)
+
+const (
+	// SignatureHeader is the header containing the hex encoded HMAC-SHA256
+	// signature of a request or response body.
+	SignatureHeader = "X-Smallstep-Signature"
+
+	// ValidatePath is the path where validation agents listen for requests.
+	ValidatePath = "/validate"
+
+	// MaxClockSkew is the maximum difference allowed between the timestamp of
+	// a request or response and the local time.
+	MaxClockSkew = time.Minute
+
+	// DefaultTimeout is the default time to wait for an agent response.
+	DefaultTimeout = 30 * time.Second
+
+	// maxBodySize is the maximum size of a request or response body.
+	maxBodySize = 64 * 1024
+)
+
+// Status values returned by a validation agent. They match the ACME status of
+// the challenge after the validation.
+const (
+	StatusValid   = "valid"
+	StatusInvalid = "invalid"
+	StatusPending = "pending"
+)
+
+// ErrQuorum is the error returned when not enough perspectives corroborate a
+// validation.
+var ErrQuorum = errors.New("validation was not corroborated by enough perspectives")
+
+// Options contains the configuration of the remote validation perspectives.
+type Options struct {
+	// Agents is the list of remote validation agents.
+	Agents []*Agent `json:"agents"`
+	// Quorum is the number of agents that must corroborate a validation. If
+	// not set, all agents are required if there are fewer than three,
+	// otherwise one agent is allowed to fail.
+	Quorum int `json:"quorum,omitempty"`
+	// Timeout is the maximum time to wait for an agent, e.g. "10s".
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// Agent is a remote validation agent.
+type Agent struct {
+	// Name is the name of the perspective, e.g. "us-east-1".
+	Name string `json:"name"`
+	// URL is the base URL of the agent, e.g. "https://validator.example.com".
+	URL string `json:"url"`
+	// Secret is the base64 encoded secret used to authenticate requests and
+	// responses.
+	Secret string `json:"secret"`
+}
+
+// IsEnabled returns true if multi-perspective validation is configured.
+func (o *Options) IsEnabled() bool {
+	return o != nil && len(o.Agents) > 0
+}
+
+// GetQuorum returns the number of agents that must corroborate a validation.
+func (o *Options) GetQuorum() int {
+	switch {
+	case !o.IsEnabled():
+		return 0
+	case o.Quorum > 0:
+		return o.Quorum
+	case len(o.Agents) < 3:
+		return len(o.Agents)
+	default:
+		return len(o.Agents) - 1
+	}
+}
+
+// GetTimeout returns the time to wait for an agent response.
+func (o *Options) GetTimeout() time.Duration {
+	if o != nil && o.Timeout != "" {
+		if d, err := time.ParseDuration(o.Timeout); err == nil && d > 0 {
+			return d
+		}
+	}
+	return DefaultTimeout
+}
+
+// Validate validates the multi-perspective options.
+func (o *Options) Validate() error {
+	if o == nil {
+		return nil
+	}
+	names := make(map[string]struct{}, len(o.Agents))
+	for i, a := range o.Agents {
+		switch {
+		case a == nil:
+			return fmt.Errorf("perspectives.agents[%d] cannot be empty", i)
+		case a.Name == "":
+			return fmt.Errorf("perspectives.agents[%d].name cannot be empty", i)
+		case a.Secret == "":
+			return fmt.Errorf("perspectives.agents[%d].secret cannot be empty", i)
+		}
+		if _, ok := names[a.Name]; ok {
+			return fmt.Errorf("perspectives.agents[%d].name %q is duplicated", i, a.Name)
+		}
+		names[a.Name] = struct{}{}
+		u, err := url.Parse(a.URL)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("perspectives.agents[%d].url is invalid", i)
+		}
+		if u.Scheme != "https" {
+			return fmt.Errorf("perspectives.agents[%d].url must use https", i)
+		}
+		if _, err := base64.StdEncoding.DecodeString(a.Secret); err != nil {
+			return fmt.Errorf("perspectives.agents[%d].secret is not valid base64", i)
+		}
+	}
+	if o.Quorum < 0 || o.Quorum > len(o.Agents) {
+		return fmt.Errorf("perspectives.quorum must be between 0 and %d", len(o.Agents))
+	}
+	if o.Timeout != "" {
+		if d, err := time.ParseDuration(o.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("perspectives.timeout %q is not a valid duration", o.Timeout)
+		}
+	}
+	return nil
+}
+
+// Request is the body sent to a validation agent.
+type Request struct {
+	// Type is the ACME challenge type, e.g. "http-01".
+	Type string `json:"type"`
+	// Value is the identifier being validated.
+	Value string `json:"value"`
+	// Token is the challenge token.
+	Token string `json:"token"`
+	// JWK is the public key of the ACME account, required to compute the key
+	// authorization.
+	JWK *jose.JSONWebKey `json:"jwk"`
+	// Timestamp is the time the request was created.
+	Timestamp time.Time `json:"timestamp"`
+	// Nonce is a random value that makes every request unique.
+	Nonce string `json:"nonce"`
+}
+
+// Response is the body returned by a validation agent.
+type Response struct {
+	// Status is the status of the challenge after the validation.
+	Status string `json:"status"`
+	// Error describes why the validation failed.
+	Error string `json:"error,omitempty"`
+	// RequestHash is the hex encoded SHA-256 hash of the body of the request.
+	RequestHash string `json:"requestHash"`
+	// Timestamp is the time the response was created.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Result is the outcome of a validation from a single perspective.
+type Result struct {
+	Perspective string    `json:"perspective"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	ValidatedAt time.Time `json:"validatedAt"`
+}
+
+// Sign returns the hex encoded HMAC-SHA256 signature of the given body.
+func Sign(secret, body []byte) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify checks that the given signature is the HMAC-SHA256 signature of the
+// body.
+func Verify(secret, body []byte, signature string) bool {
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	h := hmac.New(sha256.New, secret)
+	h.Write(body)
+	return hmac.Equal(sig, h.Sum(nil))
+}
+
+// Hash returns the hex encoded SHA-256 hash of a request body.
+func Hash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckTimestamp returns an error if the given time is too far from now.
+func CheckTimestamp(t time.Time) error {
+	if d := time.Since(t); d > MaxClockSkew || d < -MaxClockSkew {
+		return fmt.Errorf("timestamp %s is outside the allowed clock skew", t.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// HTTPClient is the interface used to send requests to the validation agents.
+type HTTPClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+type agent struct {
+	name   string
+	url    string
+	secret []byte
+}
+
+// Client dispatches validation requests to the remote validation agents.
+type Client struct {
+	agents  []agent
+	quorum  int
+	timeout time.Duration
+	client  HTTPClient
+}
+
+// New creates a new Client using the given options. If client is nil, a
+// default HTTP client is used.
+func New(o *Options, client HTTPClient) (*Client, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	if !o.IsEnabled() {
+		return nil, errors.New("perspectives.agents cannot be empty")
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	agents := make([]agent, len(o.Agents))
+	for i, a := range o.Agents {
+		secret, err := base64.StdEncoding.DecodeString(a.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding perspectives.agents[%d].secret: %w", i, err)
+		}
+		agents[i] = agent{
+			name:   a.Name,
+			url:    a.URL,
+			secret: secret,
+		}
+	}
+	return &Client{
+		agents:  agents,
+		quorum:  o.GetQuorum(),
+		timeout: o.GetTimeout(),
+		client:  client,
+	}, nil
+}
+
+// Validate sends the request to all the agents concurrently and returns the
+// result of each perspective. It returns ErrQuorum if the number of agents
+// reporting a valid challenge is lower than the configured quorum.
+func (c *Client) Validate(ctx context.Context, req *Request) ([]*Result, error) {
+	results := make([]*Result, len(c.agents))
+
+	var wg sync.WaitGroup
+	for i := range c.agents {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = c.validate(ctx, &c.agents[i], req)
+		}(i)
+	}
+	wg.Wait()
+
+	var valid int
+	for _, r := range results {
+		if r.Status == StatusValid {
+			valid++
+		}
+	}
+	if valid < c.quorum {
+		return results, fmt.Errorf("%w: %d of %d required", ErrQuorum, valid, c.quorum)
+	}
+	return results, nil
+}
+
+func (c *Client) validate(ctx context.Context, a *agent, req *Request) *Result {
+	result := &Result{
+		Perspective: a.name,
+		Status:      StatusPending,
+	}
+	resp, err := c.do(ctx, a, req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Status = resp.Status
+	result.Error = resp.Error
+	result.ValidatedAt = resp.Timestamp
+	return result
+}
+
+func (c *Client) do(ctx context.Context, a *agent, req *Request) (*Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	r := *req
+	r.Timestamp = time.Now()
+	r.Nonce = hex.EncodeToString(nonce)
+	body, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url+ValidatePath, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(SignatureHeader, Sign(a.secret, body))
+
+	httpResp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("error doing request to %s: %w", a.name, err)
+	}
+	defer httpResp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(httpResp.Body, maxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response from %s: %w", a.name, err)
+	}
+	if httpResp.StatusCode >= 400 {
+		return nil, fmt.Errorf("agent %s responded with status code %d", a.name, httpResp.StatusCode)
+	}
+	if !Verify(a.secret, b, httpResp.Header.Get(SignatureHeader)) {
+		return nil, fmt.Errorf("agent %s response has an invalid signature", a.name)
+	}
+
+	var resp Response
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return nil, fmt.Errorf("error unmarshaling response from %s: %w", a.name, err)
+	}
+	if err := CheckTimestamp(resp.Timestamp); err != nil {
+		return nil, fmt.Errorf("agent %s response is not valid: %w", a.name, err)
+	}
+	if !hmac.Equal([]byte(resp.RequestHash), []byte(Hash(body))) {
+		return nil, fmt.Errorf("agent %s response does not match the request", a.name)
+	}
+	switch resp.Status {
+	case StatusValid, StatusInvalid, StatusPending:
+	default:
+		return nil, fmt.Errorf("agent %s responded with unknown status %q", a.name, resp.Status)
+	}
+	return &resp, nil
+}
@@ -0,0 +1,196 @@
+package perspective
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSecret = []byte("the-shared-secret")
+
+func newAgentServer(t *testing.T, fn func(req *Request) (*Response, string)) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, ValidatePath, r.URL.Path)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		if !Verify(testSecret, body, r.Header.Get(SignatureHeader)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req Request
+		require.NoError(t, json.Unmarshal(body, &req))
+		resp, signature := fn(&req)
+		if resp.RequestHash == "" {
+			resp.RequestHash = Hash(body)
+		}
+		b, err := json.Marshal(resp)
+		require.NoError(t, err)
+		if signature == "" {
+			signature = Sign(testSecret, b)
+		}
+		w.Header().Set(SignatureHeader, signature)
+		w.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOptions_GetQuorum(t *testing.T) {
+	agents := func(n int) []*Agent {
+		return make([]*Agent, n)
+	}
+	tests := []struct {
+		name    string
+		options *Options
+		want    int
+	}{
+		{"nil", nil, 0},
+		{"empty", &Options{}, 0},
+		{"one", &Options{Agents: agents(1)}, 1},
+		{"two", &Options{Agents: agents(2)}, 2},
+		{"three", &Options{Agents: agents(3)}, 2},
+		{"five", &Options{Agents: agents(5)}, 4},
+		{"quorum", &Options{Agents: agents(5), Quorum: 3}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.options.GetQuorum())
+		})
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	secret := base64.StdEncoding.EncodeToString(testSecret)
+	tests := []struct {
+		name    string
+		options *Options
+		wantErr bool
+	}{
+		{"ok/nil", nil, false},
+		{"ok", &Options{Agents: []*Agent{
+			{Name: "a", URL: "https://a.example.com", Secret: secret},
+			{Name: "b", URL: "https://b.example.com:8443", Secret: secret},
+		}, Quorum: 1, Timeout: "10s"}, false},
+		{"fail/nil agent", &Options{Agents: []*Agent{nil}}, true},
+		{"fail/name", &Options{Agents: []*Agent{{URL: "https://a.example.com", Secret: secret}}}, true},
+		{"fail/duplicated", &Options{Agents: []*Agent{
+			{Name: "a", URL: "https://a.example.com", Secret: secret},
+			{Name: "a", URL: "https://b.example.com", Secret: secret},
+		}}, true},
+		{"fail/url", &Options{Agents: []*Agent{{Name: "a", URL: "a.example.com", Secret: secret}}}, true},
+		{"fail/http", &Options{Agents: []*Agent{{Name: "a", URL: "http://a.example.com", Secret: secret}}}, true},
+		{"fail/secret", &Options{Agents: []*Agent{{Name: "a", URL: "https://a.example.com"}}}, true},
+		{"fail/secret base64", &Options{Agents: []*Agent{{Name: "a", URL: "https://a.example.com", Secret: "%%%"}}}, true},
+		{"fail/quorum", &Options{Agents: []*Agent{{Name: "a", URL: "https://a.example.com", Secret: secret}}, Quorum: 2}, true},
+		{"fail/timeout", &Options{Agents: []*Agent{{Name: "a", URL: "https://a.example.com", Secret: secret}}, Timeout: "foo"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"status":"valid"}`)
+	sig := Sign(testSecret, body)
+	assert.True(t, Verify(testSecret, body, sig))
+	assert.False(t, Verify([]byte("other"), body, sig))
+	assert.False(t, Verify(testSecret, []byte(`{"status":"invalid"}`), sig))
+	assert.False(t, Verify(testSecret, body, "not-hex"))
+}
+
+func TestClient_Validate(t *testing.T) {
+	secret := base64.StdEncoding.EncodeToString(testSecret)
+	valid := newAgentServer(t, func(req *Request) (*Response, string) {
+		assert.Equal(t, "dns-01", req.Type)
+		assert.Equal(t, "example.com", req.Value)
+		assert.Equal(t, "token", req.Token)
+		assert.Len(t, req.Nonce, 32)
+		return &Response{Status: StatusValid, Timestamp: time.Now()}, ""
+	})
+	invalid := newAgentServer(t, func(*Request) (*Response, string) {
+		return &Response{Status: StatusInvalid, Error: "keyAuthorization does not match", Timestamp: time.Now()}, ""
+	})
+	forged := newAgentServer(t, func(*Request) (*Response, string) {
+		return &Response{Status: StatusValid, Timestamp: time.Now()}, "0102"
+	})
+	stale := newAgentServer(t, func(*Request) (*Response, string) {
+		return &Response{Status: StatusValid, Timestamp: time.Now().Add(-time.Hour)}, ""
+	})
+	replayed := newAgentServer(t, func(*Request) (*Response, string) {
+		return &Response{Status: StatusValid, RequestHash: Hash([]byte(`{"type":"dns-01"}`)), Timestamp: time.Now()}, ""
+	})
+
+	agent := func(name string, srv *httptest.Server) *Agent {
+		return &Agent{Name: name, URL: srv.URL, Secret: secret}
+	}
+	req := &Request{Type: "dns-01", Value: "example.com", Token: "token"}
+
+	tests := []struct {
+		name       string
+		options    *Options
+		wantStatus []string
+		wantErr    bool
+	}{
+		{"ok", &Options{Agents: []*Agent{agent("a", valid), agent("b", valid)}}, []string{StatusValid, StatusValid}, false},
+		{"ok/quorum", &Options{Agents: []*Agent{agent("a", valid), agent("b", valid), agent("c", invalid)}}, []string{StatusValid, StatusValid, StatusInvalid}, false},
+		{"fail/invalid", &Options{Agents: []*Agent{agent("a", valid), agent("b", invalid)}}, []string{StatusValid, StatusInvalid}, true},
+		{"fail/forged", &Options{Agents: []*Agent{agent("a", valid), agent("b", forged)}}, []string{StatusValid, StatusPending}, true},
+		{"fail/stale", &Options{Agents: []*Agent{agent("a", valid), agent("b", stale)}}, []string{StatusValid, StatusPending}, true},
+		{"fail/replayed", &Options{Agents: []*Agent{agent("a", valid), agent("b", replayed)}}, []string{StatusValid, StatusPending}, true},
+		{"fail/secret", &Options{Agents: []*Agent{
+			agent("a", valid),
+			{Name: "b", URL: valid.URL, Secret: base64.StdEncoding.EncodeToString([]byte("wrong"))},
+		}}, []string{StatusValid, StatusPending}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.options, valid.Client())
+			require.NoError(t, err)
+			results, err := c.Validate(context.Background(), req)
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, ErrQuorum))
+			} else {
+				assert.NoError(t, err)
+			}
+			require.Len(t, results, len(tt.wantStatus))
+			for i, r := range results {
+				assert.Equal(t, tt.options.Agents[i].Name, r.Perspective)
+				assert.Equal(t, tt.wantStatus[i], r.Status)
+				if r.Status != StatusValid {
+					assert.NotEmpty(t, r.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(nil, nil)
+	assert.Error(t, err)
+
+	_, err = New(&Options{Agents: []*Agent{{Name: "a", URL: "http://a.example.com", Secret: "c2VjcmV0"}}}, nil)
+	assert.Error(t, err)
+
+	c, err := New(&Options{Agents: []*Agent{{Name: "a", URL: "https://a.example.com", Secret: "c2VjcmV0"}}, Timeout: "5s"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.quorum)
+	assert.Equal(t, 5*time.Second, c.timeout)
+	assert.Equal(t, []byte("secret"), c.agents[0].secret)
+}
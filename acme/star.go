@@ -0,0 +1,272 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"time"
+
+	"github.com/smallstep/certificates/authority/policy"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// AutoRenewal contains the auto-renewal attributes of a short-term,
+// automatically renewed (STAR) order as defined in RFC 8739.
+type AutoRenewal struct {
+	StartDate           time.Time `json:"start-date"`
+	EndDate             time.Time `json:"end-date"`
+	Lifetime            int64     `json:"lifetime"`
+	LifetimeAdjust      int64     `json:"lifetime-adjust,omitempty"`
+	AllowCertificateGet bool      `json:"allow-certificate-get,omitempty"`
+}
+
+// GetLifetime returns the lifetime of the certificates.
+func (a *AutoRenewal) GetLifetime() time.Duration {
+	return time.Duration(a.Lifetime) * time.Second
+}
+
+// GetLifetimeAdjust returns the amount of time added before the start of the
+// validity period of each certificate.
+func (a *AutoRenewal) GetLifetimeAdjust() time.Duration {
+	return time.Duration(a.LifetimeAdjust) * time.Second
+}
+
+// Validity returns the validity bounds of the certificate for the period
+// starting at the given time. The lifetime-adjust is added before the start
+// of the period, and the end of the period is bounded by the end date.
+func (a *AutoRenewal) Validity(start time.Time) (notBefore, notAfter time.Time) {
+	notBefore = start.Add(-a.GetLifetimeAdjust())
+	notAfter = start.Add(a.GetLifetime())
+	if notAfter.After(a.EndDate) {
+		notAfter = a.EndDate
+	}
+	return
+}
+
+// IsAutoRenewal returns true if the order is a STAR order.
+func (o *Order) IsAutoRenewal() bool {
+	return o.AutoRenewal != nil
+}
+
+// CancelAutoRenewal cancels a valid STAR order, after this no more
+// certificates will be issued for the order.
+func (o *Order) CancelAutoRenewal(ctx context.Context, db DB) error {
+	if !o.IsAutoRenewal() {
+		return NewError(ErrorMalformedType, "order %s is not an auto-renewal order", o.ID)
+	}
+	if o.Status != StatusValid {
+		return NewError(ErrorAutoRenewalCancellationInvalidType, "order %s is in state %s", o.ID, o.Status)
+	}
+
+	so, err := db.GetStarOrder(ctx, o.ID)
+	if err != nil {
+		return WrapErrorISE(err, "error retrieving auto-renewal state for order %s", o.ID)
+	}
+	so.Status = StatusCanceled
+	if err := db.UpdateStarOrder(ctx, so); err != nil {
+		return WrapErrorISE(err, "error updating auto-renewal state for order %s", o.ID)
+	}
+
+	o.Status = StatusCanceled
+	if err := db.UpdateOrder(ctx, o); err != nil {
+		return WrapErrorISE(err, "error updating order %s", o.ID)
+	}
+	return nil
+}
+
+// StarOrder contains the state required to reissue the certificates of a STAR
+// order. It is created when the order is finalized.
+type StarOrder struct {
+	OrderID         string
+	AccountID       string
+	ProvisionerName string
+	Status          Status
+	AutoRenewal     *AutoRenewal
+	CSR             *x509.CertificateRequest
+	CertificateID   string
+	// PeriodStart is the start of the period covered by the current
+	// certificate, without the lifetime-adjust.
+	PeriodStart time.Time
+	NotBefore   time.Time
+	NotAfter    time.Time
+	// NextCertificateID is the certificate issued in advance for the next
+	// period. It replaces the current certificate once its NotBefore is
+	// reached.
+	NextCertificateID string
+	NextPeriodStart   time.Time
+	NextNotBefore     time.Time
+	NextNotAfter      time.Time
+}
+
+// GetCertificateID returns the ID of the certificate that must be served at
+// the given time. The certificate of the next period is only returned once it
+// has become valid.
+func (so *StarOrder) GetCertificateID(now time.Time) string {
+	if so.NextCertificateID != "" && !now.Before(so.NextNotBefore) {
+		return so.NextCertificateID
+	}
+	return so.CertificateID
+}
+
+// promote replaces the current certificate with the certificate of the next
+// period if the latter has become valid. It returns true if the state of the
+// order has changed.
+func (so *StarOrder) promote(now time.Time) bool {
+	if so.NextCertificateID == "" || now.Before(so.NextNotBefore) {
+		return false
+	}
+	so.CertificateID = so.NextCertificateID
+	so.PeriodStart = so.NextPeriodStart
+	so.NotBefore = so.NextNotBefore
+	so.NotAfter = so.NextNotAfter
+	so.NextCertificateID = ""
+	so.NextPeriodStart = time.Time{}
+	so.NextNotBefore = time.Time{}
+	so.NextNotAfter = time.Time{}
+	return true
+}
+
+// IsExpired returns true if the end date of the STAR order has passed.
+func (so *StarOrder) IsExpired(now time.Time) bool {
+	return !now.Before(so.AutoRenewal.EndDate)
+}
+
+// nextPeriod returns the start of the next period that needs to be covered by
+// a new certificate. Periods that have passed completely are skipped. It
+// returns false if the end date has been reached.
+func (so *StarOrder) nextPeriod(now time.Time) (time.Time, bool) {
+	lifetime := so.AutoRenewal.GetLifetime()
+	if lifetime <= 0 {
+		return time.Time{}, false
+	}
+	next := so.PeriodStart.Add(lifetime)
+	for !next.Add(lifetime).After(now) {
+		next = next.Add(lifetime)
+	}
+	if !next.Before(so.AutoRenewal.EndDate) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// Renew issues the certificate for the next period of a valid STAR order. The
+// certificate is issued once half of the lifetime of the current one has
+// passed, and it replaces the current one once it becomes valid. Before
+// issuing, the status of the account and the account, provisioner and
+// authority policies are checked again. It does nothing if the order is not
+// due for renewal.
+func (so *StarOrder) Renew(ctx context.Context, db DB, auth CertificateAuthority) error {
+	if so.Status != StatusValid {
+		return nil
+	}
+	now := clock.Now()
+	if so.promote(now) {
+		if err := db.UpdateStarOrder(ctx, so); err != nil {
+			return WrapErrorISE(err, "error updating auto-renewal state for order %s", so.OrderID)
+		}
+	}
+	if so.NextCertificateID != "" {
+		return nil
+	}
+
+	next, ok := so.nextPeriod(now)
+	if !ok || now.Before(next.Add(-so.AutoRenewal.GetLifetime()/2)) {
+		return nil
+	}
+
+	o, err := db.GetOrder(ctx, so.OrderID)
+	if err != nil {
+		return WrapErrorISE(err, "error retrieving order %s", so.OrderID)
+	}
+	if o.Status != StatusValid {
+		return nil
+	}
+	p, err := loadProvisioner(auth, so.ProvisionerName)
+	if err != nil {
+		return err
+	}
+
+	// Stop renewing the order if the account is no longer valid.
+	acc, err := db.GetAccount(ctx, so.AccountID)
+	if err != nil {
+		return WrapErrorISE(err, "error retrieving account %s", so.AccountID)
+	}
+	if acc.Status != StatusValid {
+		return o.CancelAutoRenewal(ctx, db)
+	}
+	if err := so.authorizeIdentifiers(ctx, db, auth, p, o.Identifiers); err != nil {
+		return err
+	}
+
+	notBefore, notAfter := so.AutoRenewal.Validity(next)
+	cert, err := o.issueCertificate(ctx, db, so.CSR, auth, p, notBefore, notAfter)
+	if err != nil {
+		return err
+	}
+
+	so.NextCertificateID = cert.ID
+	so.NextPeriodStart = next
+	so.NextNotBefore = cert.Leaf.NotBefore
+	so.NextNotAfter = cert.Leaf.NotAfter
+	so.promote(now)
+	if err := db.UpdateStarOrder(ctx, so); err != nil {
+		return WrapErrorISE(err, "error updating auto-renewal state for order %s", so.OrderID)
+	}
+	return nil
+}
+
+// authorizeIdentifiers evaluates the ACME account, provisioner and authority
+// policies for the identifiers of the order, as it's done when the order is
+// created. The policies might have changed since then.
+func (so *StarOrder) authorizeIdentifiers(ctx context.Context, db DB, auth CertificateAuthority, p Provisioner, identifiers []Identifier) error {
+	var eak *ExternalAccountKey
+	if acmeProv, ok := p.(*provisioner.ACME); ok && acmeProv.RequireEAB {
+		var err error
+		if eak, err = db.GetExternalAccountKeyByAccountID(ctx, p.GetID(), so.AccountID); err != nil {
+			return WrapErrorISE(err, "error retrieving external account binding key")
+		}
+	}
+
+	var acmePolicy policy.X509Policy
+	if eak != nil {
+		var err error
+		if acmePolicy, err = policy.NewX509PolicyEngine(eak.Policy); err != nil {
+			return WrapErrorISE(err, "error creating ACME policy engine")
+		}
+	}
+
+	for _, identifier := range identifiers {
+		if acmePolicy != nil {
+			if err := acmePolicy.AreSANsAllowed([]string{identifier.Value}); err != nil {
+				return WrapError(ErrorRejectedIdentifierType, err, "not authorized")
+			}
+		}
+		if err := p.AuthorizeOrderIdentifier(ctx, provisioner.ACMEIdentifier{
+			Type:  provisioner.ACMEIdentifierType(identifier.Type),
+			Value: identifier.Value,
+		}); err != nil {
+			return WrapError(ErrorRejectedIdentifierType, err, "not authorized")
+		}
+		if err := auth.AreSANsAllowed(ctx, []string{identifier.Value}); err != nil {
+			return WrapError(ErrorRejectedIdentifierType, err, "not authorized")
+		}
+	}
+	return nil
+}
+
+// RenewStarOrders issues new certificates for all the STAR orders that are
+// due for renewal. Errors renewing an order do not prevent the renewal of the
+// rest.
+func RenewStarOrders(ctx context.Context, db DB, auth CertificateAuthority) error {
+	sos, err := db.GetStarOrders(ctx)
+	if err != nil {
+		return WrapErrorISE(err, "error retrieving auto-renewal orders")
+	}
+	var errs []error
+	for _, so := range sos {
+		if err := so.Renew(ctx, db, auth); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
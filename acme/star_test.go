@@ -0,0 +1,314 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestAutoRenewal_Validity(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ar := &AutoRenewal{
+		StartDate:      start,
+		EndDate:        start.Add(60 * time.Hour),
+		Lifetime:       int64((24 * time.Hour).Seconds()),
+		LifetimeAdjust: int64((time.Hour).Seconds()),
+	}
+
+	nb, na := ar.Validity(start)
+	assert.Equal(t, start.Add(-time.Hour), nb)
+	assert.Equal(t, start.Add(24*time.Hour), na)
+
+	// The last certificate is bounded by the end date.
+	nb, na = ar.Validity(start.Add(48 * time.Hour))
+	assert.Equal(t, start.Add(47*time.Hour), nb)
+	assert.Equal(t, start.Add(60*time.Hour), na)
+}
+
+func TestStarOrder_nextPeriod(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	so := &StarOrder{
+		AutoRenewal: &AutoRenewal{
+			StartDate: start,
+			EndDate:   start.Add(72 * time.Hour),
+			Lifetime:  int64((24 * time.Hour).Seconds()),
+		},
+		PeriodStart: start,
+	}
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		want   time.Time
+		wantOK bool
+	}{
+		{"ok/first", start.Add(time.Hour), start.Add(24 * time.Hour), true},
+		{"ok/skip", start.Add(50 * time.Hour), start.Add(48 * time.Hour), true},
+		{"ok/end", start.Add(80 * time.Hour), time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := so.nextPeriod(tt.now)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStarOrder_Renew(t *testing.T) {
+	prov := &provisioner.ACME{Type: "ACME", Name: "acme"}
+	require.NoError(t, prov.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+
+	lifetime := 4 * time.Hour
+	newStarOrder := func(periodStart time.Time) *StarOrder {
+		return &StarOrder{
+			OrderID:         "ordID",
+			AccountID:       "accID",
+			ProvisionerName: "acme",
+			Status:          StatusValid,
+			AutoRenewal: &AutoRenewal{
+				StartDate: periodStart,
+				EndDate:   periodStart.Add(24 * time.Hour),
+				Lifetime:  int64(lifetime.Seconds()),
+			},
+			CSR:           &x509.CertificateRequest{DNSNames: []string{"example.com"}},
+			CertificateID: "certID",
+			PeriodStart:   periodStart,
+		}
+	}
+	order := &Order{
+		ID:          "ordID",
+		AccountID:   "accID",
+		Status:      StatusValid,
+		Identifiers: []Identifier{{Type: DNS, Value: "example.com"}},
+	}
+	validAccount := func(ctx context.Context, id string) (*Account, error) {
+		assert.Equal(t, "accID", id)
+		return &Account{ID: id, Status: StatusValid}, nil
+	}
+	intermediate := &x509.Certificate{Subject: pkix.Name{CommonName: "intermediate"}}
+
+	t.Run("ok/not-due", func(t *testing.T) {
+		so := newStarOrder(clock.Now().Add(-time.Hour))
+		require.NoError(t, so.Renew(context.Background(), &MockDB{}, &mockSignAuth{}))
+		assert.Equal(t, "certID", so.CertificateID)
+	})
+
+	t.Run("ok/canceled", func(t *testing.T) {
+		so := newStarOrder(clock.Now().Add(-3 * time.Hour))
+		so.Status = StatusCanceled
+		require.NoError(t, so.Renew(context.Background(), &MockDB{}, &mockSignAuth{}))
+		assert.Equal(t, "certID", so.CertificateID)
+	})
+
+	t.Run("ok/renew", func(t *testing.T) {
+		start := clock.Now().Add(-3 * time.Hour)
+		so := newStarOrder(start)
+		var updated bool
+		db := &MockDB{
+			MockGetOrder: func(ctx context.Context, id string) (*Order, error) {
+				assert.Equal(t, "ordID", id)
+				return order, nil
+			},
+			MockGetAccount: validAccount,
+			MockCreateCertificate: func(ctx context.Context, cert *Certificate) error {
+				assert.Equal(t, "accID", cert.AccountID)
+				assert.Equal(t, "ordID", cert.OrderID)
+				cert.ID = "newCertID"
+				return nil
+			},
+			MockUpdateStarOrder: func(ctx context.Context, so *StarOrder) error {
+				updated = true
+				assert.Equal(t, "certID", so.CertificateID)
+				assert.Equal(t, start, so.PeriodStart)
+				assert.Equal(t, "newCertID", so.NextCertificateID)
+				assert.Equal(t, start.Add(lifetime), so.NextPeriodStart)
+				assert.Equal(t, start.Add(lifetime), so.NextNotBefore)
+				return nil
+			},
+		}
+		auth := &mockSignAuth{
+			signWithContext: func(_ context.Context, csr *x509.CertificateRequest, signOpts provisioner.SignOptions, _ ...provisioner.SignOption) ([]*x509.Certificate, error) {
+				assert.Equal(t, []string{"example.com"}, csr.DNSNames)
+				assert.Equal(t, start.Add(lifetime), signOpts.NotBefore.Time())
+				assert.Equal(t, start.Add(2*lifetime), signOpts.NotAfter.Time())
+				leaf := &x509.Certificate{
+					Subject:   pkix.Name{CommonName: "leaf"},
+					NotBefore: signOpts.NotBefore.Time(),
+					NotAfter:  signOpts.NotAfter.Time(),
+				}
+				return []*x509.Certificate{leaf, intermediate}, nil
+			},
+			loadProvisionerByName: func(name string) (provisioner.Interface, error) {
+				assert.Equal(t, "acme", name)
+				return prov, nil
+			},
+		}
+		require.NoError(t, so.Renew(context.Background(), db, auth))
+		assert.True(t, updated)
+
+		// The current certificate is served until the next one is valid.
+		assert.Equal(t, "certID", so.GetCertificateID(clock.Now()))
+		assert.Equal(t, "newCertID", so.GetCertificateID(start.Add(lifetime)))
+	})
+
+	t.Run("ok/already-renewed", func(t *testing.T) {
+		so := newStarOrder(clock.Now().Add(-3 * time.Hour))
+		so.NextCertificateID = "nextCertID"
+		so.NextNotBefore = clock.Now().Add(time.Hour)
+		require.NoError(t, so.Renew(context.Background(), &MockDB{}, &mockSignAuth{}))
+		assert.Equal(t, "certID", so.CertificateID)
+		assert.Equal(t, "nextCertID", so.NextCertificateID)
+	})
+
+	t.Run("ok/promote", func(t *testing.T) {
+		start := clock.Now().Add(-5 * time.Hour)
+		so := newStarOrder(start)
+		so.NextCertificateID = "nextCertID"
+		so.NextPeriodStart = start.Add(lifetime)
+		so.NextNotBefore = start.Add(lifetime)
+		so.NextNotAfter = start.Add(2 * lifetime)
+		db := &MockDB{
+			MockUpdateStarOrder: func(ctx context.Context, so *StarOrder) error {
+				assert.Equal(t, "nextCertID", so.CertificateID)
+				assert.Empty(t, so.NextCertificateID)
+				return nil
+			},
+		}
+		require.NoError(t, so.Renew(context.Background(), db, &mockSignAuth{}))
+		assert.Equal(t, "nextCertID", so.CertificateID)
+		assert.Equal(t, start.Add(lifetime), so.PeriodStart)
+		assert.Equal(t, start.Add(lifetime), so.NotBefore)
+		assert.Equal(t, start.Add(2*lifetime), so.NotAfter)
+	})
+
+	t.Run("ok/account-deactivated", func(t *testing.T) {
+		so := newStarOrder(clock.Now().Add(-3 * time.Hour))
+		var canceled bool
+		db := &MockDB{
+			MockGetOrder: func(ctx context.Context, id string) (*Order, error) {
+				o := *order
+				o.AutoRenewal = so.AutoRenewal
+				return &o, nil
+			},
+			MockGetAccount: func(ctx context.Context, id string) (*Account, error) {
+				return &Account{ID: id, Status: StatusDeactivated}, nil
+			},
+			MockGetStarOrder: func(ctx context.Context, orderID string) (*StarOrder, error) {
+				return so, nil
+			},
+			MockUpdateStarOrder: func(ctx context.Context, so *StarOrder) error {
+				canceled = so.Status == StatusCanceled
+				return nil
+			},
+			MockUpdateOrder: func(ctx context.Context, o *Order) error {
+				assert.Equal(t, StatusCanceled, o.Status)
+				return nil
+			},
+		}
+		auth := &mockSignAuth{
+			loadProvisionerByName: func(string) (provisioner.Interface, error) {
+				return prov, nil
+			},
+		}
+		require.NoError(t, so.Renew(context.Background(), db, auth))
+		assert.True(t, canceled)
+		assert.Equal(t, "certID", so.CertificateID)
+	})
+
+	t.Run("fail/policy", func(t *testing.T) {
+		so := newStarOrder(clock.Now().Add(-3 * time.Hour))
+		db := &MockDB{
+			MockGetOrder: func(ctx context.Context, id string) (*Order, error) {
+				return order, nil
+			},
+			MockGetAccount: validAccount,
+		}
+		auth := &mockSignAuth{
+			areSANsAllowed: func(ctx context.Context, sans []string) error {
+				return errors.New("force")
+			},
+			loadProvisionerByName: func(string) (provisioner.Interface, error) {
+				return prov, nil
+			},
+		}
+		err := so.Renew(context.Background(), db, auth)
+		var ae *Error
+		require.ErrorAs(t, err, &ae)
+		assert.Equal(t, officialACMEPrefix+ErrorRejectedIdentifierType.String(), ae.Type)
+		assert.Empty(t, so.NextCertificateID)
+	})
+
+	t.Run("fail/sign", func(t *testing.T) {
+		so := newStarOrder(clock.Now().Add(-3 * time.Hour))
+		db := &MockDB{
+			MockGetOrder: func(ctx context.Context, id string) (*Order, error) {
+				return order, nil
+			},
+			MockGetAccount: validAccount,
+		}
+		auth := &mockSignAuth{
+			signWithContext: func(context.Context, *x509.CertificateRequest, provisioner.SignOptions, ...provisioner.SignOption) ([]*x509.Certificate, error) {
+				return nil, errors.New("force")
+			},
+			loadProvisionerByName: func(string) (provisioner.Interface, error) {
+				return prov, nil
+			},
+		}
+		err := so.Renew(context.Background(), db, auth)
+		assert.EqualError(t, err, "error signing certificate for order ordID: force")
+		assert.Equal(t, "certID", so.CertificateID)
+	})
+}
+
+func TestOrder_CancelAutoRenewal(t *testing.T) {
+	tests := []struct {
+		name    string
+		o       *Order
+		db      DB
+		wantErr *Error
+	}{
+		{"fail/not-star", &Order{ID: "ordID", Status: StatusValid}, &MockDB{},
+			NewError(ErrorMalformedType, "order ordID is not an auto-renewal order")},
+		{"fail/not-valid", &Order{ID: "ordID", Status: StatusPending, AutoRenewal: &AutoRenewal{}}, &MockDB{},
+			NewError(ErrorAutoRenewalCancellationInvalidType, "order ordID is in state pending")},
+		{"fail/db.GetStarOrder-error", &Order{ID: "ordID", Status: StatusValid, AutoRenewal: &AutoRenewal{}}, &MockDB{MockError: errors.New("force")},
+			NewErrorISE("error retrieving auto-renewal state for order ordID: force")},
+		{"ok", &Order{ID: "ordID", Status: StatusValid, AutoRenewal: &AutoRenewal{}}, &MockDB{
+			MockGetStarOrder: func(ctx context.Context, orderID string) (*StarOrder, error) {
+				return &StarOrder{OrderID: orderID, Status: StatusValid}, nil
+			},
+			MockUpdateStarOrder: func(ctx context.Context, so *StarOrder) error {
+				assert.Equal(t, StatusCanceled, so.Status)
+				return nil
+			},
+			MockUpdateOrder: func(ctx context.Context, o *Order) error {
+				assert.Equal(t, StatusCanceled, o.Status)
+				return nil
+			},
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.o.CancelAutoRenewal(context.Background(), tt.db)
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+				assert.Equal(t, StatusCanceled, tt.o.Status)
+				return
+			}
+			var ae *Error
+			require.ErrorAs(t, err, &ae)
+			assert.Equal(t, tt.wantErr.Type, ae.Type)
+			assert.Equal(t, tt.wantErr.Err.Error(), ae.Err.Error())
+		})
+	}
+}
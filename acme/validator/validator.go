@@ -0,0 +1,145 @@
+// Package validator implements a remote validation agent used for
+// multi-perspective ACME domain validation.
+//
+// An agent receives authenticated validation requests from the CA, performs
+// the http-01, dns-01 or tls-alpn-01 check from its own network location using
+// the same code as the CA, and returns a signed response with the result.
+package validator
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/acme/perspective"
+)
+
+// maxBodySize is the maximum size of a request body.
+const maxBodySize = 64 * 1024
+
+// Handler is the http.Handler of a validation agent.
+type Handler struct {
+	secret []byte
+	client acme.Client
+}
+
+// NewHandler returns a new validation agent handler that authenticates
+// requests with the given secret and performs the validations using the given
+// client. If client is nil, acme.NewClient() is used.
+func NewHandler(secret []byte, client acme.Client) *Handler {
+	if client == nil {
+		client = acme.NewClient()
+	}
+	return &Handler{
+		secret: secret,
+		client: client,
+	}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != perspective.ValidatePath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "error reading request body", http.StatusBadRequest)
+		return
+	}
+	if !perspective.Verify(h.secret, body, r.Header.Get(perspective.SignatureHeader)) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	var req perspective.Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "error unmarshaling request body", http.StatusBadRequest)
+		return
+	}
+	if err := perspective.CheckTimestamp(req.Timestamp); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if req.JWK == nil || req.Token == "" || req.Value == "" || req.Nonce == "" {
+		http.Error(w, "request is missing required fields", http.StatusBadRequest)
+		return
+	}
+
+	resp := h.validate(r.Context(), &req)
+	resp.RequestHash = perspective.Hash(body)
+	h.writeResponse(w, resp)
+}
+
+func (h *Handler) validate(ctx context.Context, req *perspective.Request) *perspective.Response {
+	switch acme.ChallengeType(req.Type) {
+	case acme.HTTP01, acme.DNS01, acme.TLSALPN01:
+	default:
+		return &perspective.Response{
+			Status: perspective.StatusInvalid,
+			Error:  "unsupported challenge type " + req.Type,
+		}
+	}
+
+	ch := &acme.Challenge{
+		Type:   acme.ChallengeType(req.Type),
+		Value:  req.Value,
+		Token:  req.Token,
+		Status: acme.StatusPending,
+	}
+
+	// The context does not contain a perspective validator, so the challenge
+	// is only validated from this location.
+	ctx = acme.NewClientContext(ctx, h.client)
+	if err := ch.Validate(ctx, &challengeDB{}, req.JWK, nil); err != nil {
+		return &perspective.Response{
+			Status: perspective.StatusPending,
+			Error:  err.Error(),
+		}
+	}
+
+	resp := &perspective.Response{
+		Status: string(ch.Status),
+	}
+	if ch.Error != nil {
+		resp.Error = ch.Error.Error()
+	}
+	return resp
+}
+
+func (h *Handler) writeResponse(w http.ResponseWriter, resp *perspective.Response) {
+	resp.Timestamp = time.Now()
+	b, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, "error marshaling response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(perspective.SignatureHeader, perspective.Sign(h.secret, b))
+	if _, err := w.Write(b); err != nil {
+		log.Printf("error writing validation response: %v", err)
+	}
+}
+
+// challengeDB is an acme.DB that only supports updating challenges. The
+// validation functions only store the result of the validation in the
+// challenge, so the agent does not need a database.
+type challengeDB struct {
+	acme.DB
+}
+
+// UpdateChallenge implements acme.DB.UpdateChallenge; the challenge is already
+// updated in memory.
+func (*challengeDB) UpdateChallenge(context.Context, *acme.Challenge) error {
+	return nil
+}
@@ -0,0 +1,168 @@
+package validator
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/acme/perspective"
+)
+
+var testSecret = []byte("the-shared-secret")
+
+type mockClient struct {
+	lookupTxt func(name string) ([]string, error)
+}
+
+func (m *mockClient) Get(string) (*http.Response, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockClient) LookupTxt(name string) ([]string, error) {
+	return m.lookupTxt(name)
+}
+
+func (m *mockClient) TLSDial(string, string, *tls.Config) (*tls.Conn, error) {
+	return nil, errors.New("not implemented")
+}
+
+func mustTXTRecord(t *testing.T, token string, jwk *jose.JSONWebKey) string {
+	t.Helper()
+	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+	require.NoError(t, err)
+	h := sha256.Sum256([]byte(token + "." + base64.RawURLEncoding.EncodeToString(thumbprint)))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	pub := jwk.Public()
+	record := mustTXTRecord(t, "token", &pub)
+
+	client := &mockClient{
+		lookupTxt: func(name string) ([]string, error) {
+			switch name {
+			case "_acme-challenge.valid.example.com":
+				return []string{"foo", record}, nil
+			case "_acme-challenge.invalid.example.com":
+				return []string{"foo"}, nil
+			default:
+				return nil, errors.New("no such host")
+			}
+		},
+	}
+	h := NewHandler(testSecret, client)
+
+	newRequest := func(req *perspective.Request, secret []byte) *http.Request {
+		b, err := json.Marshal(req)
+		require.NoError(t, err)
+		r := httptest.NewRequest(http.MethodPost, perspective.ValidatePath, bytes.NewReader(b))
+		r.Header.Set(perspective.SignatureHeader, perspective.Sign(secret, b))
+		return r
+	}
+	request := func(typ, value string) *perspective.Request {
+		return &perspective.Request{
+			Type:      typ,
+			Value:     value,
+			Token:     "token",
+			JWK:       &pub,
+			Timestamp: time.Now(),
+			Nonce:     "nonce",
+		}
+	}
+
+	tests := []struct {
+		name       string
+		req        *http.Request
+		wantCode   int
+		wantStatus string
+	}{
+		{"ok/valid", newRequest(request("dns-01", "valid.example.com"), testSecret), http.StatusOK, perspective.StatusValid},
+		{"ok/wildcard", newRequest(request("dns-01", "*.valid.example.com"), testSecret), http.StatusOK, perspective.StatusValid},
+		{"ok/invalid", newRequest(request("dns-01", "invalid.example.com"), testSecret), http.StatusOK, perspective.StatusPending},
+		{"ok/dns error", newRequest(request("dns-01", "missing.example.com"), testSecret), http.StatusOK, perspective.StatusPending},
+		{"ok/unsupported", newRequest(request("device-attest-01", "valid.example.com"), testSecret), http.StatusOK, perspective.StatusInvalid},
+		{"fail/path", httptest.NewRequest(http.MethodPost, "/foo", http.NoBody), http.StatusNotFound, ""},
+		{"fail/method", httptest.NewRequest(http.MethodGet, perspective.ValidatePath, http.NoBody), http.StatusMethodNotAllowed, ""},
+		{"fail/signature", newRequest(request("dns-01", "valid.example.com"), []byte("wrong")), http.StatusUnauthorized, ""},
+		{"fail/timestamp", newRequest(&perspective.Request{
+			Type: "dns-01", Value: "valid.example.com", Token: "token", JWK: &pub, Timestamp: time.Now().Add(-time.Hour), Nonce: "nonce",
+		}, testSecret), http.StatusUnauthorized, ""},
+		{"fail/missing jwk", newRequest(&perspective.Request{
+			Type: "dns-01", Value: "valid.example.com", Token: "token", Timestamp: time.Now(), Nonce: "nonce",
+		}, testSecret), http.StatusBadRequest, ""},
+		{"fail/missing nonce", newRequest(&perspective.Request{
+			Type: "dns-01", Value: "valid.example.com", Token: "token", JWK: &pub, Timestamp: time.Now(),
+		}, testSecret), http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqBody, err := io.ReadAll(tt.req.Body)
+			require.NoError(t, err)
+			tt.req.Body = io.NopCloser(bytes.NewReader(reqBody))
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, tt.req)
+			res := w.Result()
+			assert.Equal(t, tt.wantCode, res.StatusCode)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			body := w.Body.Bytes()
+			assert.True(t, perspective.Verify(testSecret, body, res.Header.Get(perspective.SignatureHeader)))
+			var resp perspective.Response
+			require.NoError(t, json.Unmarshal(body, &resp))
+			assert.Equal(t, tt.wantStatus, resp.Status)
+			assert.NoError(t, perspective.CheckTimestamp(resp.Timestamp))
+			assert.Equal(t, perspective.Hash(reqBody), resp.RequestHash)
+			if tt.wantStatus != perspective.StatusValid {
+				assert.NotEmpty(t, resp.Error)
+			}
+		})
+	}
+}
+
+func TestHandler_perspectiveClient(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	pub := jwk.Public()
+	record := mustTXTRecord(t, "token", &pub)
+
+	srv := httptest.NewTLSServer(NewHandler(testSecret, &mockClient{
+		lookupTxt: func(string) ([]string, error) {
+			return []string{record}, nil
+		},
+	}))
+	defer srv.Close()
+
+	c, err := perspective.New(&perspective.Options{
+		Agents: []*perspective.Agent{
+			{Name: "agent", URL: srv.URL, Secret: base64.StdEncoding.EncodeToString(testSecret)},
+		},
+	}, srv.Client())
+	require.NoError(t, err)
+
+	results, err := c.Validate(context.Background(), &perspective.Request{
+		Type: "dns-01", Value: "example.com", Token: "token", JWK: &pub,
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "agent", results[0].Perspective)
+	assert.Equal(t, perspective.StatusValid, results[0].Status)
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/internal/cast"
 	"github.com/smallstep/certificates/logging"
@@ -57,6 +58,8 @@ type Authority interface {
 	GetFederation() ([]*x509.Certificate, error)
 	Version() authority.Version
 	GetCertificateRevocationList() (*authority.CertificateRevocationListInfo, error)
+	GetIssuerCertificateRevocationList(issuer string) (*authority.CertificateRevocationListInfo, error)
+	GetCASHealth() []casapi.BackendHealth
 }
 
 // mustAuthority will be replaced on unit tests.
@@ -217,9 +220,18 @@ type VersionResponse struct {
 	RequireClientAuthentication bool   `json:"requireClientAuthentication,omitempty"`
 }
 
-// HealthResponse is the response object that returns the health of the server.
+// HealthResponse is the response object that returns the health of the server
+// and the number of healthy and unhealthy CAS backends if the CAS reports it.
 type HealthResponse struct {
-	Status string `json:"status"`
+	Status   string          `json:"status"`
+	Backends *BackendsHealth `json:"backends,omitempty"`
+}
+
+// BackendsHealth is the number of healthy and unhealthy CAS backends. The
+// details of each backend are not public.
+type BackendsHealth struct {
+	Healthy   int `json:"healthy"`
+	Unhealthy int `json:"unhealthy"`
 }
 
 // RootResponse is the response object that returns the PEM of a root certificate.
@@ -333,6 +345,7 @@ func Route(r Router) {
 	r.MethodFunc("POST", "/rekey", Rekey)
 	r.MethodFunc("POST", "/revoke", Revoke)
 	r.MethodFunc("GET", "/crl", CRL)
+	r.MethodFunc("GET", "/crl/{issuer}", CRL)
 	r.MethodFunc("GET", "/provisioners", Provisioners)
 	r.MethodFunc("GET", "/provisioners/{kid}/encrypted-key", ProvisionerKey)
 	r.MethodFunc("GET", "/roots", Roots)
@@ -352,7 +365,11 @@ func Route(r Router) {
 	r.MethodFunc("POST", "/ssh/config/{type}", SSHConfig)
 	r.MethodFunc("POST", "/ssh/check-host", SSHCheckHost)
 	r.MethodFunc("GET", "/ssh/hosts", SSHGetHosts)
+	r.MethodFunc("GET", "/ssh/krl", SSHKRL)
 	r.MethodFunc("POST", "/ssh/bastion", SSHBastion)
+	r.MethodFunc("POST", "/ssh/authorized-principals", SSHAuthorizedPrincipals)
+	r.MethodFunc("POST", "/ssh/access-requests", SSHAccessRequestCreate)
+	r.MethodFunc("GET", "/ssh/access-requests/{id}", SSHAccessRequestGet)
 
 	// For compatibility with old code:
 	r.MethodFunc("POST", "/re-sign", Renew)
@@ -371,7 +388,21 @@ func Version(w http.ResponseWriter, r *http.Request) {
 
 // Health is an HTTP handler that returns the status of the server.
 func Health(w http.ResponseWriter, r *http.Request) {
-	render.JSON(w, r, HealthResponse{Status: "ok"})
+	resp := HealthResponse{Status: "ok"}
+	if health := mustAuthority(r.Context()).GetCASHealth(); len(health) > 0 {
+		resp.Backends = new(BackendsHealth)
+		for _, h := range health {
+			if h.Healthy {
+				resp.Backends.Healthy++
+			} else {
+				resp.Backends.Unhealthy++
+			}
+		}
+		if resp.Backends.Healthy == 0 {
+			resp.Status = "degraded"
+		}
+	}
+	render.JSON(w, r, resp)
 }
 
 // Root is an HTTP handler that using the SHA256 from the URL, returns the root
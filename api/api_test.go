@@ -37,6 +37,8 @@ import (
 
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/provisioner"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/logging"
 	"github.com/smallstep/certificates/templates"
@@ -210,6 +212,8 @@ type mockAuthority struct {
 	getIntermediateCertificates  func() []*x509.Certificate
 	getFederation                func() ([]*x509.Certificate, error)
 	getCRL                       func() (*authority.CertificateRevocationListInfo, error)
+	getIssuerCRL                 func(issuer string) (*authority.CertificateRevocationListInfo, error)
+	getCASHealth                 func() []casapi.BackendHealth
 	signSSH                      func(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error)
 	signSSHAddUser               func(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error)
 	renewSSH                     func(ctx context.Context, cert *ssh.Certificate) (*ssh.Certificate, error)
@@ -220,6 +224,10 @@ type mockAuthority struct {
 	getSSHConfig                 func(ctx context.Context, typ string, data map[string]string) ([]templates.Output, error)
 	checkSSHHost                 func(ctx context.Context, principal, token string) (bool, error)
 	getSSHBastion                func(ctx context.Context, user string, hostname string) (*authority.Bastion, error)
+	getSSHAuthorizedPrincipals   func(ctx context.Context, hostnames []string, hostCert *x509.Certificate, user string, cert *ssh.Certificate) ([]string, error)
+	getSSHKRL                    func(ctx context.Context) ([]byte, error)
+	createSSHAccessRequest       func(ctx context.Context, token string, req *db.SSHAccessRequest) (*db.SSHAccessRequest, error)
+	getSSHAccessRequest          func(ctx context.Context, token, id string) (*db.SSHAccessRequest, error)
 	version                      func() authority.Version
 }
 
@@ -231,6 +239,21 @@ func (m *mockAuthority) GetCertificateRevocationList() (*authority.CertificateRe
 	return m.ret1.(*authority.CertificateRevocationListInfo), m.err
 }
 
+func (m *mockAuthority) GetIssuerCertificateRevocationList(issuer string) (*authority.CertificateRevocationListInfo, error) {
+	if m.getIssuerCRL != nil {
+		return m.getIssuerCRL(issuer)
+	}
+
+	return m.ret1.(*authority.CertificateRevocationListInfo), m.err
+}
+
+func (m *mockAuthority) GetCASHealth() []casapi.BackendHealth {
+	if m.getCASHealth != nil {
+		return m.getCASHealth()
+	}
+	return nil
+}
+
 // TODO: remove once Authorize is deprecated.
 func (m *mockAuthority) Authorize(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
 	if m.authorize != nil {
@@ -414,6 +437,34 @@ func (m *mockAuthority) GetSSHBastion(ctx context.Context, user, hostname string
 	return m.ret1.(*authority.Bastion), m.err
 }
 
+func (m *mockAuthority) GetSSHAuthorizedPrincipals(ctx context.Context, hostnames []string, hostCert *x509.Certificate, user string, cert *ssh.Certificate) ([]string, error) {
+	if m.getSSHAuthorizedPrincipals != nil {
+		return m.getSSHAuthorizedPrincipals(ctx, hostnames, hostCert, user, cert)
+	}
+	return m.ret1.([]string), m.err
+}
+
+func (m *mockAuthority) GetSSHKRL(ctx context.Context) ([]byte, error) {
+	if m.getSSHKRL != nil {
+		return m.getSSHKRL(ctx)
+	}
+	return m.ret1.([]byte), m.err
+}
+
+func (m *mockAuthority) CreateSSHAccessRequest(ctx context.Context, token string, req *db.SSHAccessRequest) (*db.SSHAccessRequest, error) {
+	if m.createSSHAccessRequest != nil {
+		return m.createSSHAccessRequest(ctx, token, req)
+	}
+	return m.ret1.(*db.SSHAccessRequest), m.err
+}
+
+func (m *mockAuthority) GetSSHAccessRequestWithToken(ctx context.Context, token, id string) (*db.SSHAccessRequest, error) {
+	if m.getSSHAccessRequest != nil {
+		return m.getSSHAccessRequest(ctx, token, id)
+	}
+	return m.ret1.(*db.SSHAccessRequest), m.err
+}
+
 func (m *mockAuthority) Version() authority.Version {
 	if m.version != nil {
 		return m.version()
@@ -830,23 +881,47 @@ func Test_caHandler_Route(t *testing.T) {
 }
 
 func Test_Health(t *testing.T) {
-	req := httptest.NewRequest("GET", "http://example.com/health", http.NoBody)
-	w := httptest.NewRecorder()
-	Health(w, req)
-
-	res := w.Result()
-	if res.StatusCode != 200 {
-		t.Errorf("caHandler.Health StatusCode = %d, wants 200", res.StatusCode)
+	checkedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		health   []casapi.BackendHealth
+		expected []byte
+	}{
+		{"ok", nil, []byte("{\"status\":\"ok\"}\n")},
+		{"ok/backends", []casapi.BackendHealth{
+			{Name: "primary", Type: "cloudcas", Healthy: false, Error: "unavailable", CheckedAt: checkedAt},
+			{Name: "secondary", Type: "vaultcas", Healthy: true},
+		}, []byte(`{"status":"ok","backends":{"healthy":1,"unhealthy":1}}` + "\n")},
+		{"degraded", []casapi.BackendHealth{
+			{Name: "primary", Type: "cloudcas", Healthy: false, Error: "unavailable", CheckedAt: checkedAt},
+			{Name: "secondary", Type: "vaultcas", Healthy: false, Error: "unavailable", CheckedAt: checkedAt},
+		}, []byte(`{"status":"degraded","backends":{"healthy":0,"unhealthy":2}}` + "\n")},
 	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				getCASHealth: func() []casapi.BackendHealth {
+					return tt.health
+				},
+			})
+			req := httptest.NewRequest("GET", "http://example.com/health", http.NoBody)
+			w := httptest.NewRecorder()
+			Health(w, req)
 
-	body, err := io.ReadAll(res.Body)
-	res.Body.Close()
-	if err != nil {
-		t.Errorf("caHandler.Health unexpected error = %v", err)
-	}
-	expected := []byte("{\"status\":\"ok\"}\n")
-	if !bytes.Equal(body, expected) {
-		t.Errorf("caHandler.Health Body = %s, wants %s", body, expected)
+			res := w.Result()
+			if res.StatusCode != 200 {
+				t.Errorf("caHandler.Health StatusCode = %d, wants 200", res.StatusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("caHandler.Health unexpected error = %v", err)
+			}
+			if !bytes.Equal(body, tt.expected) {
+				t.Errorf("caHandler.Health Body = %s, wants %s", body, tt.expected)
+			}
+		})
 	}
 }
 
@@ -1144,7 +1219,16 @@ func Test_Rekey(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockMustAuthority(t, &mockAuthority{
-				ret1: tt.cert, ret2: tt.root, err: tt.err,
+				renewContext: func(ctx context.Context, oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
+					got, ok := authority.CertificateRequestFromContext(ctx)
+					if !ok || !reflect.DeepEqual(got.PublicKey, pk) {
+						t.Errorf("caHandler.Rekey context certificate request = %v, want %v", got, csr)
+					}
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return []*x509.Certificate{tt.cert, tt.root}, nil
+				},
 				getTLSOptions: func() *authority.TLSOptions {
 					return nil
 				},
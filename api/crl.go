@@ -5,13 +5,26 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/errs"
 )
 
-// CRL is an HTTP handler that returns the current CRL in DER or PEM format
+// CRL is an HTTP handler that returns the current CRL in DER or PEM format. If
+// the issuer is present in the path, it returns the CRL of that certificate
+// authority.
 func CRL(w http.ResponseWriter, r *http.Request) {
-	crlInfo, err := mustAuthority(r.Context()).GetCertificateRevocationList()
+	var (
+		crlInfo *authority.CertificateRevocationListInfo
+		err     error
+	)
+	if issuer := chi.URLParam(r, "issuer"); issuer != "" {
+		crlInfo, err = mustAuthority(r.Context()).GetIssuerCertificateRevocationList(issuer)
+	} else {
+		crlInfo, err = mustAuthority(r.Context()).GetCertificateRevocationList()
+	}
 	if err != nil {
 		render.Error(w, r, err)
 		return
@@ -91,3 +91,45 @@ func Test_CRL(t *testing.T) {
 		})
 	}
 }
+
+func Test_CRL_issuer(t *testing.T) {
+	data := []byte{1, 2, 3, 4}
+	mockMustAuthority(t, &mockAuthority{
+		getCRL: func() (*authority.CertificateRevocationListInfo, error) {
+			return nil, errors.New("unexpected call")
+		},
+		getIssuerCRL: func(issuer string) (*authority.CertificateRevocationListInfo, error) {
+			if issuer != "vault" {
+				return nil, errs.NotFound("certificate authority %s was not found", issuer)
+			}
+			return &authority.CertificateRevocationListInfo{Data: data}, nil
+		},
+	})
+
+	for _, tt := range []struct {
+		issuer     string
+		statusCode int
+	}{
+		{"vault", http.StatusOK},
+		{"missing", http.StatusNotFound},
+	} {
+		t.Run(tt.issuer, func(t *testing.T) {
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("issuer", tt.issuer)
+			req := httptest.NewRequest("GET", "http://example.com/crl/"+tt.issuer, http.NoBody)
+			req = req.WithContext(context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			CRL(w, req)
+			res := w.Result()
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if tt.statusCode == http.StatusOK {
+				assert.Equal(t, "application/pkix-crl", res.Header.Get("Content-Type"))
+				assert.Equal(t, data, body)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/smallstep/certificates/api/read"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/errs"
 )
 
@@ -44,8 +45,12 @@ func Rekey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	a := mustAuthority(r.Context())
-	certChain, err := a.Rekey(r.TLS.PeerCertificates[0], body.CsrPEM.CertificateRequest.PublicKey)
+	// The certificate request is also added to the context, some CAS require
+	// it to issue the new certificate.
+	csr := body.CsrPEM.CertificateRequest
+	ctx := authority.NewCertificateRequestContext(r.Context(), csr)
+	a := mustAuthority(ctx)
+	certChain, err := a.RenewContext(ctx, r.TLS.PeerCertificates[0], csr.PublicKey)
 	if err != nil {
 		render.Error(w, r, errs.Wrap(http.StatusInternalServerError, err, "cahandler.Rekey"))
 		return
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"time"
 
@@ -19,6 +20,7 @@ import (
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/internal/cast"
 	"github.com/smallstep/certificates/templates"
@@ -36,6 +38,10 @@ type SSHAuthority interface {
 	CheckSSHHost(ctx context.Context, principal string, token string) (bool, error)
 	GetSSHHosts(ctx context.Context, cert *x509.Certificate) ([]config.Host, error)
 	GetSSHBastion(ctx context.Context, user string, hostname string) (*config.Bastion, error)
+	GetSSHAuthorizedPrincipals(ctx context.Context, hostnames []string, hostCert *x509.Certificate, user string, cert *ssh.Certificate) ([]string, error)
+	GetSSHKRL(ctx context.Context) ([]byte, error)
+	CreateSSHAccessRequest(ctx context.Context, token string, req *db.SSHAccessRequest) (*db.SSHAccessRequest, error)
+	GetSSHAccessRequestWithToken(ctx context.Context, token, id string) (*db.SSHAccessRequest, error)
 }
 
 // SSHSignRequest is the request body of an SSH certificate request.
@@ -50,6 +56,15 @@ type SSHSignRequest struct {
 	AddUserPublicKey []byte             `json:"addUserPublicKey,omitempty"`
 	IdentityCSR      CertificateRequest `json:"identityCSR,omitempty"`
 	TemplateData     json.RawMessage    `json:"templateData,omitempty"`
+
+	// Attestation contains the FIDO attestation of a security key, as
+	// written by `ssh-keygen -O write-attestation`, and its challenge.
+	Attestation *provisioner.SSHSecurityKeyAttestation `json:"attestation,omitempty"`
+
+	// HostKeyProof is an SSH signature of the OTT made with the private key
+	// of the current host certificate, used to verify the identity of the
+	// host if the sshpop host verification method is configured.
+	HostKeyProof []byte `json:"hostKeyProof,omitempty"`
 }
 
 // Validate validates the SSHSignRequest.
@@ -61,6 +76,12 @@ func (s *SSHSignRequest) Validate() error {
 		return errs.BadRequest("missing or empty publicKey")
 	case s.OTT == "":
 		return errs.BadRequest("missing or empty ott")
+	case s.Attestation != nil && len(s.Attestation.Data) == 0:
+		return errs.BadRequest("missing or empty attestation data")
+	case s.Attestation != nil && len(s.Attestation.Challenge) == 0:
+		return errs.BadRequest("missing or empty attestation challenge")
+	case len(s.HostKeyProof) > 0 && s.CertType != provisioner.SSHHostCert:
+		return errs.BadRequest("hostKeyProof can only be used with host certificates")
 	default:
 		// Validate identity signature if provided
 		if s.IdentityCSR.CertificateRequest != nil {
@@ -289,6 +310,8 @@ func SSHSign(w http.ResponseWriter, r *http.Request) {
 		ValidBefore:  body.ValidBefore,
 		ValidAfter:   body.ValidAfter,
 		TemplateData: body.TemplateData,
+		Attestation:  body.Attestation,
+		HostKeyProof: body.HostKeyProof,
 	}
 
 	ctx := provisioner.NewContextWithMethod(r.Context(), provisioner.SSHSignMethod)
@@ -474,11 +497,59 @@ func SSHGetHosts(w http.ResponseWriter, r *http.Request) {
 		render.Error(w, r, errs.InternalServerErr(err))
 		return
 	}
+
+	// Filter hosts by tag and group. A tag can be a name or a name=value
+	// pair.
+	query := r.URL.Query()
+	if tags, groups := query["tag"], query["group"]; len(tags) > 0 || len(groups) > 0 {
+		filtered := []config.Host{}
+		for _, h := range hosts {
+			if matchSSHHost(h, tags, groups) {
+				filtered = append(filtered, h)
+			}
+		}
+		hosts = filtered
+	}
+
 	render.JSON(w, r, &SSHGetHostsResponse{
 		Hosts: hosts,
 	})
 }
 
+// matchSSHHost returns true if the host has all the given tags and groups.
+func matchSSHHost(h config.Host, tags, groups []string) bool {
+	for _, t := range tags {
+		name, value, hasValue := strings.Cut(t, "=")
+		if !slices.ContainsFunc(h.HostTags, func(ht config.HostTag) bool {
+			return ht.Name == name && (!hasValue || ht.Value == value)
+		}) {
+			return false
+		}
+	}
+	for _, g := range groups {
+		if !slices.Contains(h.HostGroups, g) {
+			return false
+		}
+	}
+	return true
+}
+
+// SSHKRL is an HTTP handler that returns an OpenSSH key revocation list with
+// the revoked SSH certificates. It can be used in the RevokedKeys option of
+// sshd.
+func SSHKRL(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	krl, err := mustAuthority(ctx).GetSSHKRL(ctx)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/octet-stream")
+	w.Header().Add("Content-Disposition", "attachment; filename=\"revoked_keys.krl\"")
+	w.Write(krl)
+}
+
 // SSHBastion provides returns the bastion configured if any.
 func SSHBastion(w http.ResponseWriter, r *http.Request) {
 	var body SSHBastionRequest
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// SSHAccessRequestRequest is the request body used to create a just-in-time
+// SSH access request. The user authenticates using an SSH sign token (ott),
+// and the subject of the token is the subject of the request.
+type SSHAccessRequestRequest struct {
+	OTT             string               `json:"ott"`
+	HostGroup       string               `json:"hostGroup,omitempty"`
+	Principals      []string             `json:"principals"`
+	SourceAddresses []string             `json:"sourceAddresses,omitempty"`
+	Justification   string               `json:"justification"`
+	Validity        provisioner.Duration `json:"validity,omitempty"`
+}
+
+// Validate validates the SSHAccessRequestRequest.
+func (s *SSHAccessRequestRequest) Validate() error {
+	switch {
+	case s.OTT == "":
+		return errs.BadRequest("missing or empty ott")
+	case len(s.Principals) == 0:
+		return errs.BadRequest("missing or empty principals")
+	case s.Justification == "":
+		return errs.BadRequest("missing or empty justification")
+	default:
+		return nil
+	}
+}
+
+// SSHAccessRequestCreate is an HTTP handler that creates a just-in-time SSH
+// access request. Once the request is approved, the subject can get an SSH
+// user certificate using a token with the accessRequestID claim.
+func SSHAccessRequestCreate(w http.ResponseWriter, r *http.Request) {
+	var body SSHAccessRequestRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, errs.BadRequestErr(err, "error reading request body"))
+		return
+	}
+
+	logOtt(w, body.OTT)
+	if err := body.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	ctx := provisioner.NewContextWithMethod(r.Context(), provisioner.SSHSignMethod)
+	ctx = provisioner.NewContextWithToken(ctx, body.OTT)
+	req, err := mustAuthority(ctx).CreateSSHAccessRequest(ctx, body.OTT, &db.SSHAccessRequest{
+		HostGroup:       body.HostGroup,
+		Principals:      body.Principals,
+		SourceAddresses: body.SourceAddresses,
+		Justification:   body.Justification,
+		Validity:        body.Validity,
+	})
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	render.JSONStatus(w, r, req, http.StatusCreated)
+}
+
+// SSHAccessRequestGet is an HTTP handler that returns a just-in-time SSH
+// access request, so the subject can check if it has been approved. The
+// subject authenticates using an SSH sign token in the Authorization header
+// with the Bearer scheme.
+func SSHAccessRequestGet(w http.ResponseWriter, r *http.Request) {
+	var ott string
+	if s := r.Header.Get(authorizationHeader); s != "" {
+		if parts := strings.SplitN(s, bearerScheme+" ", 2); len(parts) == 2 {
+			ott = parts[1]
+		}
+	}
+	if ott == "" {
+		render.Error(w, r, errs.Unauthorized("missing or empty bearer token"))
+		return
+	}
+
+	logOtt(w, ott)
+	ctx := provisioner.NewContextWithMethod(r.Context(), provisioner.SSHSignMethod)
+	ctx = provisioner.NewContextWithToken(ctx, ott)
+	req, err := mustAuthority(ctx).GetSSHAccessRequestWithToken(ctx, ott, chi.URLParam(r, "id"))
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	render.JSON(w, r, req)
+}
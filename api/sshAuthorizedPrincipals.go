@@ -0,0 +1,98 @@
+package api
+
+import (
+	"crypto/x509"
+	"net/http"
+	"slices"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+// SSHAuthorizedPrincipalsRequest is the request body used by a host to get
+// the principals of a user certificate authorized to log in. The host
+// authenticates using an SSHPOP token (ott) signed with its host certificate,
+// or with the X.509 client certificate used in the TLS connection if it was
+// issued by the provisioner configured in ssh.authorizedPrincipalsProvisioner.
+type SSHAuthorizedPrincipalsRequest struct {
+	OTT         string         `json:"ott,omitempty"`
+	User        string         `json:"user"`
+	Certificate SSHCertificate `json:"certificate"`
+}
+
+// Validate validates the SSHAuthorizedPrincipalsRequest.
+func (s *SSHAuthorizedPrincipalsRequest) Validate() error {
+	switch {
+	case s.User == "":
+		return errs.BadRequest("missing or empty user")
+	case s.Certificate.Certificate == nil:
+		return errs.BadRequest("missing or empty certificate")
+	default:
+		return nil
+	}
+}
+
+// SSHAuthorizedPrincipalsResponse is the response object that returns the
+// authorized principals.
+type SSHAuthorizedPrincipalsResponse struct {
+	Principals []string `json:"principals"`
+}
+
+// SSHAuthorizedPrincipals is an HTTP handler that returns the principals of a
+// user certificate that are authorized to log in to the host making the
+// request. It's meant to be used by the sshd AuthorizedPrincipalsCommand.
+func SSHAuthorizedPrincipals(w http.ResponseWriter, r *http.Request) {
+	var body SSHAuthorizedPrincipalsRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, errs.BadRequestErr(err, "error reading request body"))
+		return
+	}
+
+	logOtt(w, body.OTT)
+	if err := body.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	a := mustAuthority(ctx)
+
+	var hostnames []string
+	var hostCert *x509.Certificate
+	switch {
+	case body.OTT != "":
+		ctx = provisioner.NewContextWithMethod(ctx, provisioner.SSHAuthorizedPrincipalsMethod)
+		ctx = provisioner.NewContextWithToken(ctx, body.OTT)
+		if _, err := a.Authorize(ctx, body.OTT); err != nil {
+			render.Error(w, r, errs.UnauthorizedErr(err))
+			return
+		}
+		cert, _, err := provisioner.ExtractSSHPOPCert(body.OTT)
+		if err != nil {
+			render.Error(w, r, errs.InternalServerErr(err))
+			return
+		}
+		hostnames = cert.ValidPrincipals
+	case r.TLS != nil && len(r.TLS.PeerCertificates) > 0:
+		hostCert = r.TLS.PeerCertificates[0]
+		hostnames = append(hostnames, hostCert.DNSNames...)
+		if cn := hostCert.Subject.CommonName; cn != "" && !slices.Contains(hostnames, cn) {
+			hostnames = append(hostnames, cn)
+		}
+	default:
+		render.Error(w, r, errs.Unauthorized("missing ott or client certificate"))
+		return
+	}
+
+	principals, err := a.GetSSHAuthorizedPrincipals(ctx, hostnames, hostCert, body.User, body.Certificate.Certificate)
+	if err != nil {
+		render.Error(w, r, errs.ForbiddenErr(err, "error getting ssh authorized principals"))
+		return
+	}
+
+	render.JSON(w, r, &SSHAuthorizedPrincipalsResponse{
+		Principals: principals,
+	})
+}
@@ -6,7 +6,9 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -19,13 +21,17 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/logging"
 	"github.com/smallstep/certificates/templates"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -216,22 +222,29 @@ func TestSignSSHRequest_Validate(t *testing.T) {
 		AddUserPublicKey []byte
 		KeyID            string
 		IdentityCSR      CertificateRequest
+		Attestation      *provisioner.SSHSecurityKeyAttestation
+		HostKeyProof     []byte
 	}
 	tests := []struct {
 		name    string
 		fields  fields
 		wantErr bool
 	}{
-		{"ok-empty", fields{[]byte("Zm9v"), "ott", "", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, false},
-		{"ok-user", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, false},
-		{"ok-host", fields{[]byte("Zm9v"), "ott", "host", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, false},
-		{"ok-keyID", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "key-id", CertificateRequest{}}, false},
-		{"ok-identityCSR", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "key-id", CertificateRequest{CertificateRequest: csr}}, false},
-		{"key", fields{nil, "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, true},
-		{"key", fields{[]byte(""), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, true},
-		{"type", fields{[]byte("Zm9v"), "ott", "foo", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, true},
-		{"ott", fields{[]byte("Zm9v"), "", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, true},
-		{"identityCSR", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "key-id", CertificateRequest{CertificateRequest: badCSR}}, true},
+		{"ok-empty", fields{[]byte("Zm9v"), "ott", "", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil, nil}, false},
+		{"ok-user", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil, nil}, false},
+		{"ok-host", fields{[]byte("Zm9v"), "ott", "host", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil, nil}, false},
+		{"ok-keyID", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "key-id", CertificateRequest{}, nil, nil}, false},
+		{"ok-identityCSR", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "key-id", CertificateRequest{CertificateRequest: csr}, nil, nil}, false},
+		{"ok-attestation", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, &provisioner.SSHSecurityKeyAttestation{Data: []byte("data"), Challenge: []byte("challenge")}, nil}, false},
+		{"key", fields{nil, "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil, nil}, true},
+		{"key", fields{[]byte(""), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil, nil}, true},
+		{"type", fields{[]byte("Zm9v"), "ott", "foo", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil, nil}, true},
+		{"ott", fields{[]byte("Zm9v"), "", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil, nil}, true},
+		{"identityCSR", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "key-id", CertificateRequest{CertificateRequest: badCSR}, nil, nil}, true},
+		{"attestation-data", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, &provisioner.SSHSecurityKeyAttestation{Challenge: []byte("challenge")}, nil}, true},
+		{"attestation-challenge", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, &provisioner.SSHSecurityKeyAttestation{Data: []byte("data")}, nil}, true},
+		{"ok-hostKeyProof", fields{[]byte("Zm9v"), "ott", "host", []string{"host"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil, []byte("proof")}, false},
+		{"hostKeyProof", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil, []byte("proof")}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -245,6 +258,8 @@ func TestSignSSHRequest_Validate(t *testing.T) {
 				AddUserPublicKey: tt.fields.AddUserPublicKey,
 				KeyID:            tt.fields.KeyID,
 				IdentityCSR:      tt.fields.IdentityCSR,
+				Attestation:      tt.fields.Attestation,
+				HostKeyProof:     tt.fields.HostKeyProof,
 			}
 			if err := s.Validate(); (err != nil) != tt.wantErr {
 				t.Errorf("SignSSHRequest.Validate() error = %v, wantErr %v", err, tt.wantErr)
@@ -621,6 +636,35 @@ func Test_SSHGetHosts(t *testing.T) {
 	}
 }
 
+func Test_matchSSHHost(t *testing.T) {
+	host := authority.Host{
+		HostID:     "1",
+		HostTags:   []authority.HostTag{{ID: "1/env", Name: "env", Value: "prod"}, {ID: "1/role", Name: "role", Value: "db"}},
+		HostGroups: []string{"databases"},
+		Hostname:   "db1.example.com",
+	}
+	tests := []struct {
+		name   string
+		tags   []string
+		groups []string
+		want   bool
+	}{
+		{"ok/empty", nil, nil, true},
+		{"ok/tag name", []string{"env"}, nil, true},
+		{"ok/tag value", []string{"env=prod", "role=db"}, nil, true},
+		{"ok/group", nil, []string{"databases"}, true},
+		{"ok/tag and group", []string{"role=db"}, []string{"databases"}, true},
+		{"fail/tag name", []string{"zone"}, nil, false},
+		{"fail/tag value", []string{"env=dev"}, nil, false},
+		{"fail/group", []string{"env"}, []string{"web"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchSSHHost(host, tt.tags, tt.groups))
+		})
+	}
+}
+
 func Test_SSHBastion(t *testing.T) {
 	bastion := &authority.Bastion{
 		Hostname: "bastion.local",
@@ -676,6 +720,86 @@ func Test_SSHBastion(t *testing.T) {
 	}
 }
 
+func Test_SSHAuthorizedPrincipals(t *testing.T) {
+	user, err := getSignedUserCertificate()
+	require.NoError(t, err)
+	host, err := getSignedHostCertificate()
+	require.NoError(t, err)
+	userB64 := base64.StdEncoding.EncodeToString(user.Marshal())
+
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	so.WithHeader("sshpop", base64.StdEncoding.EncodeToString(host.Marshal()))
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: sshHostKey}, so)
+	require.NoError(t, err)
+	ott, err := jose.Signed(sig).Claims(jose.Claims{Subject: "1234"}).CompactSerialize()
+	require.NoError(t, err)
+
+	tlsState := &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{{
+			Subject:  pkix.Name{CommonName: "host"},
+			DNSNames: []string{"host.local"},
+		}},
+	}
+
+	tests := []struct {
+		name          string
+		req           string
+		tls           *tls.ConnectionState
+		authorizeErr  error
+		wantHostnames []string
+		principals    []string
+		err           error
+		body          []byte
+		statusCode    int
+	}{
+		{"ok/sshpop", `{"ott":"` + ott + `","user":"root","certificate":"` + userB64 + `"}`, nil, nil, host.ValidPrincipals, []string{"user"}, nil, []byte(`{"principals":["user"]}`), http.StatusOK},
+		{"ok/mtls", `{"user":"root","certificate":"` + userB64 + `"}`, tlsState, nil, []string{"host.local", "host"}, []string{}, nil, []byte(`{"principals":[]}`), http.StatusOK},
+		{"fail/bad-json", `bad json`, nil, nil, nil, nil, nil, nil, http.StatusBadRequest},
+		{"fail/missing-user", `{"certificate":"` + userB64 + `"}`, tlsState, nil, nil, nil, nil, nil, http.StatusBadRequest},
+		{"fail/missing-certificate", `{"user":"root"}`, tlsState, nil, nil, nil, nil, nil, http.StatusBadRequest},
+		{"fail/unauthenticated", `{"user":"root","certificate":"` + userB64 + `"}`, nil, nil, nil, nil, nil, nil, http.StatusUnauthorized},
+		{"fail/authorize", `{"ott":"` + ott + `","user":"root","certificate":"` + userB64 + `"}`, nil, fmt.Errorf("an error"), nil, nil, nil, nil, http.StatusUnauthorized},
+		{"fail/principals", `{"user":"root","certificate":"` + userB64 + `"}`, tlsState, nil, []string{"host.local", "host"}, nil, fmt.Errorf("an error"), nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				authorize: func(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+					assert.Equal(t, provisioner.SSHAuthorizedPrincipalsMethod, provisioner.MethodFromContext(ctx))
+					assert.Equal(t, ott, token)
+					return nil, tt.authorizeErr
+				},
+				getSSHAuthorizedPrincipals: func(ctx context.Context, hostnames []string, hostCert *x509.Certificate, u string, cert *ssh.Certificate) ([]string, error) {
+					assert.Equal(t, tt.wantHostnames, hostnames)
+					assert.Equal(t, "root", u)
+					assert.Equal(t, user.Marshal(), cert.Marshal())
+					if tt.tls != nil {
+						assert.Equal(t, tt.tls.PeerCertificates[0], hostCert)
+					} else {
+						assert.Nil(t, hostCert)
+					}
+					return tt.principals, tt.err
+				},
+			})
+
+			req := httptest.NewRequest("POST", "http://example.com/ssh/authorized-principals", strings.NewReader(tt.req))
+			req.TLS = tt.tls
+			w := httptest.NewRecorder()
+			SSHAuthorizedPrincipals(logging.NewResponseLogger(w), req)
+			res := w.Result()
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if tt.statusCode < http.StatusBadRequest {
+				assert.Equal(t, tt.body, bytes.TrimSpace(body))
+			}
+		})
+	}
+}
+
 func TestSSHPublicKey_MarshalJSON(t *testing.T) {
 	key, err := ssh.NewPublicKey(sshUserKey.Public())
 	require.NoError(t, err)
@@ -833,3 +957,121 @@ func Test_getIdentityURI(t *testing.T) {
 		})
 	}
 }
+
+func Test_SSHAccessRequestCreate(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        string
+		err        error
+		statusCode int
+	}{
+		{"ok", `{"ott":"token","principals":["alice"],"justification":"incident 42","validity":"10m","sourceAddresses":["10.0.0.1"]}`, nil, http.StatusCreated},
+		{"fail/json", `{`, nil, http.StatusBadRequest},
+		{"fail/ott", `{"principals":["alice"],"justification":"incident 42"}`, nil, http.StatusBadRequest},
+		{"fail/principals", `{"ott":"token","justification":"incident 42"}`, nil, http.StatusBadRequest},
+		{"fail/justification", `{"ott":"token","principals":["alice"]}`, nil, http.StatusBadRequest},
+		{"fail/authority", `{"ott":"token","principals":["alice"],"justification":"incident 42"}`, errs.Unauthorized("bad token"), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				createSSHAccessRequest: func(ctx context.Context, token string, req *db.SSHAccessRequest) (*db.SSHAccessRequest, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					assert.Equal(t, "token", token)
+					assert.Equal(t, []string{"alice"}, req.Principals)
+					assert.Equal(t, []string{"10.0.0.1"}, req.SourceAddresses)
+					assert.Equal(t, 10*time.Minute, req.Validity.Duration)
+					req.ID = "1"
+					req.Status = db.SSHAccessRequestPending
+					return req, nil
+				},
+			})
+
+			req := httptest.NewRequest("POST", "http://example.com/ssh/access-requests", strings.NewReader(tt.req))
+			w := httptest.NewRecorder()
+			SSHAccessRequestCreate(logging.NewResponseLogger(w), req)
+			require.Equal(t, tt.statusCode, w.Code)
+			if tt.statusCode == http.StatusCreated {
+				var got db.SSHAccessRequest
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+				assert.Equal(t, "1", got.ID)
+				assert.Equal(t, db.SSHAccessRequestPending, got.Status)
+			}
+		})
+	}
+}
+
+func Test_SSHAccessRequestGet(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		err           error
+		statusCode    int
+	}{
+		{"ok", "Bearer token", nil, http.StatusOK},
+		{"fail/missing", "", nil, http.StatusUnauthorized},
+		{"fail/scheme", "Basic token", nil, http.StatusUnauthorized},
+		{"fail/authority", "Bearer token", errs.Forbidden("not yours"), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				getSSHAccessRequest: func(ctx context.Context, token, id string) (*db.SSHAccessRequest, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					assert.Equal(t, "token", token)
+					assert.Equal(t, "1", id)
+					return &db.SSHAccessRequest{ID: "1", Status: db.SSHAccessRequestApproved}, nil
+				},
+			})
+
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("id", "1")
+			req := httptest.NewRequest("GET", "http://example.com/ssh/access-requests/1", http.NoBody)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			SSHAccessRequestGet(logging.NewResponseLogger(w), req)
+			require.Equal(t, tt.statusCode, w.Code)
+			if tt.statusCode == http.StatusOK {
+				var got db.SSHAccessRequest
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+				assert.Equal(t, db.SSHAccessRequestApproved, got.Status)
+			}
+		})
+	}
+}
+
+func Test_SSHKRL(t *testing.T) {
+	tests := []struct {
+		name       string
+		krl        []byte
+		err        error
+		statusCode int
+	}{
+		{"ok", []byte("SSHKRL\n\x00"), nil, http.StatusOK},
+		{"fail", nil, errs.NotImplemented("not supported"), http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				getSSHKRL: func(ctx context.Context) ([]byte, error) {
+					return tt.krl, tt.err
+				},
+			})
+			req := httptest.NewRequest("GET", "http://example.com/ssh/krl", http.NoBody)
+			w := httptest.NewRecorder()
+			SSHKRL(logging.NewResponseLogger(w), req)
+			require.Equal(t, tt.statusCode, w.Code)
+			if tt.statusCode == http.StatusOK {
+				assert.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+				assert.Equal(t, tt.krl, w.Body.Bytes())
+			}
+		})
+	}
+}
@@ -0,0 +1,514 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/smallstep/linkedca"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+const (
+	// defaultACMEAccountsLimit is the default number of accounts returned
+	// when listing ACME accounts.
+	defaultACMEAccountsLimit = 20
+	// maxACMEAccountsLimit is the maximum number of accounts returned when
+	// listing ACME accounts.
+	maxACMEAccountsLimit = 100
+)
+
+// ACMEAccount is the representation of an ACME account in the admin API.
+type ACMEAccount struct {
+	ID          string      `json:"id"`
+	Status      acme.Status `json:"status"`
+	Contact     []string    `json:"contact,omitempty"`
+	Provisioner string      `json:"provisioner"`
+	Reference   string      `json:"reference,omitempty"`
+	CreatedAt   time.Time   `json:"createdAt"`
+}
+
+// GetACMEAccountsResponse is the type for GET /admin/acme/accounts responses.
+type GetACMEAccountsResponse struct {
+	Accounts   []*ACMEAccount `json:"accounts"`
+	NextCursor string         `json:"nextCursor"`
+}
+
+// ACMEOrder is the representation of an ACME order in the admin API.
+type ACMEOrder struct {
+	ID            string            `json:"id"`
+	Status        acme.Status       `json:"status"`
+	Identifiers   []acme.Identifier `json:"identifiers"`
+	NotBefore     time.Time         `json:"notBefore,omitempty"`
+	NotAfter      time.Time         `json:"notAfter,omitempty"`
+	ExpiresAt     time.Time         `json:"expiresAt"`
+	CertificateID string            `json:"certificateID,omitempty"`
+	Error         *acme.Error       `json:"error,omitempty"`
+}
+
+// GetACMEAccountOrdersResponse is the type for GET
+// /admin/acme/accounts/{provisionerName}/{id}/orders responses.
+type GetACMEAccountOrdersResponse struct {
+	Orders []*ACMEOrder `json:"orders"`
+}
+
+// ACMECertificate is the representation of a certificate issued to an ACME
+// account in the admin API.
+type ACMECertificate struct {
+	ID           string    `json:"id"`
+	OrderID      string    `json:"orderID"`
+	SerialNumber string    `json:"serialNumber"`
+	Subject      string    `json:"subject"`
+	DNSNames     []string  `json:"dnsNames,omitempty"`
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+	Revoked      bool      `json:"revoked"`
+}
+
+// GetACMEAccountCertificatesResponse is the type for GET
+// /admin/acme/accounts/{provisionerName}/{id}/certificates responses.
+type GetACMEAccountCertificatesResponse struct {
+	Certificates []*ACMECertificate `json:"certificates"`
+}
+
+// RevokeACMEAccountCertificatesRequest is the type for POST
+// /admin/acme/accounts/{provisionerName}/{id}/revoke requests.
+type RevokeACMEAccountCertificatesRequest struct {
+	ReasonCode int    `json:"reasonCode"`
+	Reason     string `json:"reason"`
+}
+
+// Validate validates a bulk revocation request body.
+func (r *RevokeACMEAccountCertificatesRequest) Validate() error {
+	if r.ReasonCode < ocsp.Unspecified || r.ReasonCode > ocsp.AACompromise || r.ReasonCode == 7 {
+		return admin.NewError(admin.ErrorBadRequestType, "reasonCode %d is not valid", r.ReasonCode)
+	}
+	return nil
+}
+
+// RevokeACMEAccountCertificatesResponse is the type for POST
+// /admin/acme/accounts/{provisionerName}/{id}/revoke responses.
+type RevokeACMEAccountCertificatesResponse struct {
+	Revoked        []string          `json:"revoked"`
+	AlreadyRevoked []string          `json:"alreadyRevoked"`
+	Failed         map[string]string `json:"failed,omitempty"`
+}
+
+// acmeAccountFilter contains the query parameters used to search ACME
+// accounts.
+type acmeAccountFilter struct {
+	contact       string
+	reference     string
+	accountID     string
+	createdAfter  time.Time
+	createdBefore time.Time
+}
+
+func parseACMEAccountFilter(r *http.Request) (*acmeAccountFilter, error) {
+	q := r.URL.Query()
+	f := &acmeAccountFilter{
+		contact:   strings.ToLower(q.Get("contact")),
+		reference: q.Get("reference"),
+	}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"createdAfter", &f.createdAfter}, {"createdBefore", &f.createdBefore}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, admin.WrapError(admin.ErrorBadRequestType, err, "%s '%s' is not a valid RFC 3339 date", p.name, v)
+			}
+			*p.t = t
+		}
+	}
+	return f, nil
+}
+
+func (f *acmeAccountFilter) matches(acc *acme.Account) bool {
+	switch {
+	case f.accountID != "" && acc.ID != f.accountID:
+		return false
+	case !f.createdAfter.IsZero() && acc.CreatedAt.Before(f.createdAfter):
+		return false
+	case !f.createdBefore.IsZero() && acc.CreatedAt.After(f.createdBefore):
+		return false
+	case f.contact != "":
+		for _, c := range acc.Contact {
+			if strings.Contains(strings.ToLower(c), f.contact) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// requireACMEProvisioner is a middleware that ensures the provisioner in the
+// context is an ACME provisioner.
+func requireACMEProvisioner(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prov := linkedca.MustProvisionerFromContext(r.Context())
+		if prov.GetType() != linkedca.Provisioner_ACME {
+			render.Error(w, r, admin.NewError(admin.ErrorBadRequestType, "provisioner '%s' is not an ACME provisioner", prov.GetName()))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// ACMEAccountAdminResponder is responsible for writing ACME account admin
+// responses.
+type ACMEAccountAdminResponder interface {
+	GetACMEAccounts(w http.ResponseWriter, r *http.Request)
+	GetACMEAccount(w http.ResponseWriter, r *http.Request)
+	GetACMEAccountOrders(w http.ResponseWriter, r *http.Request)
+	GetACMEAccountCertificates(w http.ResponseWriter, r *http.Request)
+	DeactivateACMEAccount(w http.ResponseWriter, r *http.Request)
+	RevokeACMEAccountCertificates(w http.ResponseWriter, r *http.Request)
+}
+
+// acmeAccountAdminResponder implements ACMEAccountAdminResponder.
+type acmeAccountAdminResponder struct{}
+
+// NewACMEAccountAdminResponder returns a new ACMEAccountAdminResponder.
+func NewACMEAccountAdminResponder() ACMEAccountAdminResponder {
+	return &acmeAccountAdminResponder{}
+}
+
+// GetACMEAccounts writes the response for the ACME accounts GET endpoint. The
+// accounts can be filtered by contact, EAB reference and creation date.
+func (h *acmeAccountAdminResponder) GetACMEAccounts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+	prov := linkedca.MustProvisionerFromContext(ctx)
+
+	cursor, limit, err := api.ParseCursor(r)
+	if err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err,
+			"error parsing cursor and limit from query params"))
+		return
+	}
+	switch {
+	case limit <= 0:
+		limit = defaultACMEAccountsLimit
+	case limit > maxACMEAccountsLimit:
+		limit = maxACMEAccountsLimit
+	}
+
+	filter, err := parseACMEAccountFilter(r)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	references, err := accountReferences(ctx, acmeDB, prov.GetId())
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving ACME EAB keys"))
+		return
+	}
+	if filter.reference != "" {
+		for accID, ref := range references {
+			if ref == filter.reference {
+				filter.accountID = accID
+			}
+		}
+		if filter.accountID == "" {
+			render.JSON(w, r, &GetACMEAccountsResponse{Accounts: []*ACMEAccount{}})
+			return
+		}
+	}
+
+	accs, err := acmeDB.GetAccountsByProvisionerID(ctx, prov.GetId())
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving ACME accounts"))
+		return
+	}
+	sort.Slice(accs, func(i, j int) bool {
+		if accs[i].CreatedAt.Equal(accs[j].CreatedAt) {
+			return accs[i].ID < accs[j].ID
+		}
+		return accs[i].CreatedAt.Before(accs[j].CreatedAt)
+	})
+
+	resp := &GetACMEAccountsResponse{Accounts: []*ACMEAccount{}}
+	started := cursor == ""
+	for _, acc := range accs {
+		if !started {
+			if acc.ID != cursor {
+				continue
+			}
+			started = true
+		}
+		if !filter.matches(acc) {
+			continue
+		}
+		if len(resp.Accounts) == limit {
+			resp.NextCursor = acc.ID
+			break
+		}
+		resp.Accounts = append(resp.Accounts, toACMEAccount(acc, prov.GetName(), references[acc.ID]))
+	}
+
+	render.JSON(w, r, resp)
+}
+
+// GetACMEAccount writes the response for the ACME account GET endpoint.
+func (h *acmeAccountAdminResponder) GetACMEAccount(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+
+	acc, err := loadACMEAccount(r)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	references, err := accountReferences(ctx, acme.MustDatabaseFromContext(ctx), prov.GetId())
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving ACME EAB keys"))
+		return
+	}
+
+	render.JSON(w, r, toACMEAccount(acc, prov.GetName(), references[acc.ID]))
+}
+
+// GetACMEAccountOrders writes the response for the ACME account orders GET
+// endpoint.
+func (h *acmeAccountAdminResponder) GetACMEAccountOrders(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	acc, err := loadACMEAccount(r)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	orders, err := acme.MustDatabaseFromContext(ctx).GetOrderHistoryByAccountID(ctx, acc.ID)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving orders for ACME account %s", acc.ID))
+		return
+	}
+
+	resp := &GetACMEAccountOrdersResponse{Orders: make([]*ACMEOrder, 0, len(orders))}
+	for _, o := range orders {
+		resp.Orders = append(resp.Orders, &ACMEOrder{
+			ID:            o.ID,
+			Status:        o.Status,
+			Identifiers:   o.Identifiers,
+			NotBefore:     o.NotBefore,
+			NotAfter:      o.NotAfter,
+			ExpiresAt:     o.ExpiresAt,
+			CertificateID: o.CertificateID,
+			Error:         o.Error,
+		})
+	}
+
+	render.JSON(w, r, resp)
+}
+
+// GetACMEAccountCertificates writes the response for the ACME account
+// certificates GET endpoint.
+func (h *acmeAccountAdminResponder) GetACMEAccountCertificates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	auth := mustAuthority(ctx)
+
+	acc, err := loadACMEAccount(r)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	certs, err := acme.MustDatabaseFromContext(ctx).GetCertificatesByAccountID(ctx, acc.ID)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving certificates for ACME account %s", acc.ID))
+		return
+	}
+
+	resp := &GetACMEAccountCertificatesResponse{Certificates: make([]*ACMECertificate, 0, len(certs))}
+	for _, cert := range certs {
+		serial := cert.Leaf.SerialNumber.String()
+		revoked, err := auth.IsRevoked(serial)
+		if err != nil {
+			render.Error(w, r, admin.WrapErrorISE(err, "error checking revocation of certificate %s", serial))
+			return
+		}
+		resp.Certificates = append(resp.Certificates, &ACMECertificate{
+			ID:           cert.ID,
+			OrderID:      cert.OrderID,
+			SerialNumber: serial,
+			Subject:      cert.Leaf.Subject.String(),
+			DNSNames:     cert.Leaf.DNSNames,
+			NotBefore:    cert.Leaf.NotBefore,
+			NotAfter:     cert.Leaf.NotAfter,
+			Revoked:      revoked,
+		})
+	}
+
+	render.JSON(w, r, resp)
+}
+
+// DeactivateACMEAccount writes the response for the ACME account deactivation
+// POST endpoint. Deactivated accounts cannot create new orders, but their
+// certificates are not revoked.
+func (h *acmeAccountAdminResponder) DeactivateACMEAccount(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+
+	acc, err := loadACMEAccount(r)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	if acc.Status != acme.StatusDeactivated {
+		acc.Status = acme.StatusDeactivated
+		if err := acmeDB.UpdateAccount(ctx, acc); err != nil {
+			render.Error(w, r, admin.WrapErrorISE(err, "error deactivating ACME account %s", acc.ID))
+			return
+		}
+	}
+
+	references, err := accountReferences(ctx, acmeDB, prov.GetId())
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving ACME EAB keys"))
+		return
+	}
+
+	render.JSON(w, r, toACMEAccount(acc, prov.GetName(), references[acc.ID]))
+}
+
+// RevokeACMEAccountCertificates writes the response for the ACME account bulk
+// revocation POST endpoint. It revokes all the certificates issued to the
+// account that have not been revoked yet.
+func (h *acmeAccountAdminResponder) RevokeACMEAccountCertificates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	auth := mustAuthority(ctx)
+
+	var body RevokeACMEAccountCertificatesRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	acc, err := loadACMEAccount(r)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	certs, err := acme.MustDatabaseFromContext(ctx).GetCertificatesByAccountID(ctx, acc.ID)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving certificates for ACME account %s", acc.ID))
+		return
+	}
+
+	reason := body.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("bulk revocation of ACME account %s", acc.ID)
+	}
+
+	ctx = provisioner.NewContextWithMethod(ctx, provisioner.RevokeMethod)
+	resp := &RevokeACMEAccountCertificatesResponse{
+		Revoked:        []string{},
+		AlreadyRevoked: []string{},
+	}
+	for _, cert := range certs {
+		serial := cert.Leaf.SerialNumber.String()
+		revoked, err := auth.IsRevoked(serial)
+		switch {
+		case err != nil:
+			resp.addFailure(serial, err)
+			continue
+		case revoked:
+			resp.AlreadyRevoked = append(resp.AlreadyRevoked, serial)
+			continue
+		}
+		if err := auth.Revoke(ctx, &authority.RevokeOptions{
+			Serial:     serial,
+			Reason:     reason,
+			ReasonCode: body.ReasonCode,
+			ACME:       true,
+			Crt:        cert.Leaf,
+		}); err != nil {
+			resp.addFailure(serial, err)
+			continue
+		}
+		resp.Revoked = append(resp.Revoked, serial)
+	}
+
+	render.JSON(w, r, resp)
+}
+
+func (r *RevokeACMEAccountCertificatesResponse) addFailure(serial string, err error) {
+	if r.Failed == nil {
+		r.Failed = make(map[string]string)
+	}
+	r.Failed[serial] = err.Error()
+}
+
+// loadACMEAccount returns the ACME account in the URL, checking that it
+// belongs to the provisioner in the context.
+func loadACMEAccount(r *http.Request) (*acme.Account, error) {
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	id := chi.URLParam(r, "id")
+
+	acc, err := acme.MustDatabaseFromContext(ctx).GetAccount(ctx, id)
+	switch {
+	case acme.IsErrNotFound(err):
+		return nil, admin.NewError(admin.ErrorNotFoundType, "ACME account %s not found", id)
+	case err != nil:
+		return nil, admin.WrapErrorISE(err, "error retrieving ACME account %s", id)
+	case acc.ProvisionerID != prov.GetId():
+		return nil, admin.NewError(admin.ErrorNotFoundType, "ACME account %s not found", id)
+	default:
+		return acc, nil
+	}
+}
+
+// accountReferences returns a map with the EAB references of the accounts of
+// a provisioner.
+func accountReferences(ctx context.Context, acmeDB acme.DB, provisionerID string) (map[string]string, error) {
+	eaks, _, err := acmeDB.GetExternalAccountKeys(ctx, provisionerID, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	references := make(map[string]string, len(eaks))
+	for _, eak := range eaks {
+		if eak.AccountID != "" {
+			references[eak.AccountID] = eak.Reference
+		}
+	}
+	return references, nil
+}
+
+func toACMEAccount(acc *acme.Account, provisionerName, reference string) *ACMEAccount {
+	return &ACMEAccount{
+		ID:          acc.ID,
+		Status:      acc.Status,
+		Contact:     acc.Contact,
+		Provisioner: provisionerName,
+		Reference:   reference,
+		CreatedAt:   acc.CreatedAt,
+	}
+}
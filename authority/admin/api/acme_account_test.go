@@ -0,0 +1,316 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/linkedca"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func newACMEAccountRequest(t *testing.T, method, target string, body []byte, db acme.DB, urlParams map[string]string) *http.Request {
+	t.Helper()
+	chiCtx := chi.NewRouteContext()
+	for k, v := range urlParams {
+		chiCtx.URLParams.Add(k, v)
+	}
+	ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+	ctx = linkedca.NewContextWithProvisioner(ctx, &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "acme",
+		Type: linkedca.Provisioner_ACME,
+	})
+	ctx = acme.NewDatabaseContext(ctx, db)
+	return httptest.NewRequest(method, target, bytes.NewReader(body)).WithContext(ctx)
+}
+
+func Test_requireACMEProvisioner(t *testing.T) {
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	ctx := linkedca.NewContextWithProvisioner(context.Background(), &linkedca.Provisioner{
+		Name: "jwk", Type: linkedca.Provisioner_JWK,
+	})
+	w := httptest.NewRecorder()
+	requireACMEProvisioner(next)(w, httptest.NewRequest("GET", "/foo", http.NoBody).WithContext(ctx))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	ctx = linkedca.NewContextWithProvisioner(context.Background(), &linkedca.Provisioner{
+		Name: "acme", Type: linkedca.Provisioner_ACME,
+	})
+	w = httptest.NewRecorder()
+	requireACMEProvisioner(next)(w, httptest.NewRequest("GET", "/foo", http.NoBody).WithContext(ctx))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestACMEAccountAdminResponder_GetACMEAccounts(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	accs := []*acme.Account{
+		{ID: "acc3", Status: acme.StatusValid, ProvisionerID: "provID", Contact: []string{"mailto:carol@example.com"}, CreatedAt: base.Add(3 * time.Hour)},
+		{ID: "acc1", Status: acme.StatusValid, ProvisionerID: "provID", Contact: []string{"mailto:alice@example.com"}, CreatedAt: base.Add(time.Hour)},
+		{ID: "acc2", Status: acme.StatusDeactivated, ProvisionerID: "provID", Contact: []string{"mailto:bob@example.org"}, CreatedAt: base.Add(2 * time.Hour)},
+	}
+	db := &acme.MockDB{
+		MockGetAccountsByProvisionerID: func(ctx context.Context, provisionerID string) ([]*acme.Account, error) {
+			assert.Equal(t, "provID", provisionerID)
+			return accs, nil
+		},
+		MockGetExternalAccountKeys: func(ctx context.Context, provisionerID, cursor string, limit int) ([]*acme.ExternalAccountKey, string, error) {
+			return []*acme.ExternalAccountKey{{Reference: "ref2", AccountID: "acc2"}}, "", nil
+		},
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantIDs    []string
+		wantCursor string
+		wantCode   int
+	}{
+		{"ok/all", "", []string{"acc1", "acc2", "acc3"}, "", 200},
+		{"ok/limit", "?limit=1", []string{"acc1"}, "acc2", 200},
+		{"ok/cursor", "?limit=1&cursor=acc2", []string{"acc2"}, "acc3", 200},
+		{"ok/contact", "?contact=EXAMPLE.COM", []string{"acc1", "acc3"}, "", 200},
+		{"ok/reference", "?reference=ref2", []string{"acc2"}, "", 200},
+		{"ok/reference-not-found", "?reference=missing", []string{}, "", 200},
+		{"ok/created", "?createdAfter=2026-01-01T01:30:00Z&createdBefore=2026-01-01T02:30:00Z", []string{"acc2"}, "", 200},
+		{"fail/created", "?createdAfter=yesterday", nil, "", 400},
+		{"fail/limit", "?limit=foo", nil, "", 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newACMEAccountRequest(t, "GET", "/foo"+tt.query, nil, db, nil)
+			w := httptest.NewRecorder()
+			NewACMEAccountAdminResponder().GetACMEAccounts(w, req)
+			require.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode != 200 {
+				return
+			}
+
+			var resp GetACMEAccountsResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			ids := []string{}
+			for _, acc := range resp.Accounts {
+				ids = append(ids, acc.ID)
+				assert.Equal(t, "acme", acc.Provisioner)
+				if acc.ID == "acc2" {
+					assert.Equal(t, "ref2", acc.Reference)
+				}
+			}
+			assert.Equal(t, tt.wantIDs, ids)
+			assert.Equal(t, tt.wantCursor, resp.NextCursor)
+		})
+	}
+}
+
+func TestACMEAccountAdminResponder_GetACMEAccount(t *testing.T) {
+	tests := []struct {
+		name     string
+		db       acme.DB
+		wantCode int
+	}{
+		{"ok", &acme.MockDB{
+			MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+				assert.Equal(t, "accID", id)
+				return &acme.Account{ID: id, Status: acme.StatusValid, ProvisionerID: "provID"}, nil
+			},
+			MockGetExternalAccountKeys: func(ctx context.Context, provisionerID, cursor string, limit int) ([]*acme.ExternalAccountKey, string, error) {
+				return []*acme.ExternalAccountKey{}, "", nil
+			},
+		}, 200},
+		{"fail/other-provisioner", &acme.MockDB{
+			MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+				return &acme.Account{ID: id, Status: acme.StatusValid, ProvisionerID: "otherID"}, nil
+			},
+		}, 404},
+		{"fail/not-found", &acme.MockDB{
+			MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+				return nil, acme.ErrNotFound
+			},
+		}, 404},
+		{"fail/db.GetAccount", &acme.MockDB{MockError: errors.New("force")}, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newACMEAccountRequest(t, "GET", "/foo", nil, tt.db, map[string]string{"id": "accID"})
+			w := httptest.NewRecorder()
+			NewACMEAccountAdminResponder().GetACMEAccount(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
+
+func TestACMEAccountAdminResponder_GetACMEAccountOrders(t *testing.T) {
+	db := &acme.MockDB{
+		MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+			return &acme.Account{ID: id, ProvisionerID: "provID"}, nil
+		},
+		MockGetOrderHistoryByAccountID: func(ctx context.Context, accountID string) ([]*acme.Order, error) {
+			assert.Equal(t, "accID", accountID)
+			return []*acme.Order{
+				{ID: "ord1", Status: acme.StatusValid, CertificateID: "certID"},
+				{ID: "ord2", Status: acme.StatusPending},
+			}, nil
+		},
+	}
+	req := newACMEAccountRequest(t, "GET", "/foo", nil, db, map[string]string{"id": "accID"})
+	w := httptest.NewRecorder()
+	NewACMEAccountAdminResponder().GetACMEAccountOrders(w, req)
+	require.Equal(t, 200, w.Code)
+
+	var resp GetACMEAccountOrdersResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Orders, 2)
+	assert.Equal(t, "ord1", resp.Orders[0].ID)
+	assert.Equal(t, "certID", resp.Orders[0].CertificateID)
+	assert.Equal(t, acme.StatusPending, resp.Orders[1].Status)
+}
+
+func testACMECertificates() []*acme.Certificate {
+	return []*acme.Certificate{
+		{ID: "cert1", OrderID: "ord1", Leaf: &x509.Certificate{
+			SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "one.example.com"},
+			DNSNames: []string{"one.example.com"}, Raw: []byte("cert1"),
+		}},
+		{ID: "cert2", OrderID: "ord2", Leaf: &x509.Certificate{
+			SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "two.example.com"}, Raw: []byte("cert2"),
+		}},
+		{ID: "cert3", OrderID: "ord3", Leaf: &x509.Certificate{
+			SerialNumber: big.NewInt(3), Subject: pkix.Name{CommonName: "three.example.com"}, Raw: []byte("cert3"),
+		}},
+	}
+}
+
+func TestACMEAccountAdminResponder_GetACMEAccountCertificates(t *testing.T) {
+	mockMustAuthority(t, &mockAdminAuthority{
+		MockIsRevoked: func(sn string) (bool, error) {
+			return sn == "2", nil
+		},
+	})
+	db := &acme.MockDB{
+		MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+			return &acme.Account{ID: id, ProvisionerID: "provID"}, nil
+		},
+		MockGetCertificatesByAccountID: func(ctx context.Context, accountID string) ([]*acme.Certificate, error) {
+			return testACMECertificates(), nil
+		},
+	}
+	req := newACMEAccountRequest(t, "GET", "/foo", nil, db, map[string]string{"id": "accID"})
+	w := httptest.NewRecorder()
+	NewACMEAccountAdminResponder().GetACMEAccountCertificates(w, req)
+	require.Equal(t, 200, w.Code)
+
+	var resp GetACMEAccountCertificatesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Certificates, 3)
+	assert.Equal(t, "1", resp.Certificates[0].SerialNumber)
+	assert.Equal(t, "CN=one.example.com", resp.Certificates[0].Subject)
+	assert.Equal(t, []string{"one.example.com"}, resp.Certificates[0].DNSNames)
+	assert.False(t, resp.Certificates[0].Revoked)
+	assert.True(t, resp.Certificates[1].Revoked)
+}
+
+func TestACMEAccountAdminResponder_DeactivateACMEAccount(t *testing.T) {
+	var updated bool
+	db := &acme.MockDB{
+		MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+			return &acme.Account{ID: id, Status: acme.StatusValid, ProvisionerID: "provID"}, nil
+		},
+		MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+			updated = true
+			assert.Equal(t, acme.StatusDeactivated, acc.Status)
+			return nil
+		},
+		MockGetExternalAccountKeys: func(ctx context.Context, provisionerID, cursor string, limit int) ([]*acme.ExternalAccountKey, string, error) {
+			assert.Equal(t, "provID", provisionerID)
+			return []*acme.ExternalAccountKey{
+				{ID: "eakID", Reference: "ref", AccountID: "accID"},
+			}, "", nil
+		},
+	}
+	req := newACMEAccountRequest(t, "POST", "/foo", nil, db, map[string]string{"id": "accID"})
+	w := httptest.NewRecorder()
+	NewACMEAccountAdminResponder().DeactivateACMEAccount(w, req)
+	require.Equal(t, 200, w.Code)
+	assert.True(t, updated)
+
+	var resp ACMEAccount
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, acme.StatusDeactivated, resp.Status)
+	assert.Equal(t, "ref", resp.Reference)
+}
+
+func TestRevokeACMEAccountCertificatesRequest_Validate(t *testing.T) {
+	assert.NoError(t, (&RevokeACMEAccountCertificatesRequest{ReasonCode: 0}).Validate())
+	assert.NoError(t, (&RevokeACMEAccountCertificatesRequest{ReasonCode: 1}).Validate())
+	assert.Error(t, (&RevokeACMEAccountCertificatesRequest{ReasonCode: -1}).Validate())
+	assert.Error(t, (&RevokeACMEAccountCertificatesRequest{ReasonCode: 7}).Validate())
+	assert.Error(t, (&RevokeACMEAccountCertificatesRequest{ReasonCode: 11}).Validate())
+}
+
+func TestACMEAccountAdminResponder_RevokeACMEAccountCertificates(t *testing.T) {
+	var revoked []string
+	mockMustAuthority(t, &mockAdminAuthority{
+		MockIsRevoked: func(sn string) (bool, error) {
+			return sn == "2", nil
+		},
+		MockRevoke: func(ctx context.Context, opts *authority.RevokeOptions) error {
+			assert.Equal(t, provisioner.RevokeMethod, provisioner.MethodFromContext(ctx))
+			assert.True(t, opts.ACME)
+			assert.Equal(t, 1, opts.ReasonCode)
+			assert.Equal(t, "bulk revocation of ACME account accID", opts.Reason)
+			assert.NotNil(t, opts.Crt)
+			if opts.Serial == "3" {
+				return errors.New("force")
+			}
+			revoked = append(revoked, opts.Serial)
+			return nil
+		},
+	})
+	db := &acme.MockDB{
+		MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+			return &acme.Account{ID: id, ProvisionerID: "provID"}, nil
+		},
+		MockGetCertificatesByAccountID: func(ctx context.Context, accountID string) ([]*acme.Certificate, error) {
+			return testACMECertificates(), nil
+		},
+	}
+
+	t.Run("fail/bad-reason", func(t *testing.T) {
+		req := newACMEAccountRequest(t, "POST", "/foo", []byte(`{"reasonCode":7}`), db, map[string]string{"id": "accID"})
+		w := httptest.NewRecorder()
+		NewACMEAccountAdminResponder().RevokeACMEAccountCertificates(w, req)
+		assert.Equal(t, 400, w.Code)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		req := newACMEAccountRequest(t, "POST", "/foo", []byte(`{"reasonCode":1}`), db, map[string]string{"id": "accID"})
+		w := httptest.NewRecorder()
+		NewACMEAccountAdminResponder().RevokeACMEAccountCertificates(w, req)
+		require.Equal(t, 200, w.Code)
+
+		var resp RevokeACMEAccountCertificatesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, []string{"1"}, resp.Revoked)
+		assert.Equal(t, []string{"2"}, resp.AlreadyRevoked)
+		assert.Equal(t, map[string]string{"3": "force"}, resp.Failed)
+		assert.Equal(t, []string{"1"}, revoked)
+	})
+}
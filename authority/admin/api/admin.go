@@ -11,8 +11,11 @@ import (
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/api/read"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 )
 
 type adminAuthority interface {
@@ -33,6 +36,33 @@ type adminAuthority interface {
 	CreateAuthorityPolicy(ctx context.Context, admin *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	UpdateAuthorityPolicy(ctx context.Context, admin *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	RemoveAuthorityPolicy(ctx context.Context) error
+	GetSSHOptionsPolicy(ctx context.Context, provisionerID string) (*policy.SSHOptionsPolicy, error)
+	UpdateSSHOptionsPolicy(ctx context.Context, provisionerID string, p *policy.SSHOptionsPolicy) (*policy.SSHOptionsPolicy, error)
+	RemoveSSHOptionsPolicy(ctx context.Context, provisionerID string) error
+	GetCELPolicy(ctx context.Context, scope policy.CELPolicyScope) (*policy.CELPolicy, error)
+	UpdateCELPolicy(ctx context.Context, scope policy.CELPolicyScope, p *policy.CELPolicy) (*policy.CELPolicy, error)
+	RemoveCELPolicy(ctx context.Context, scope policy.CELPolicyScope) error
+	ExplainPolicy(ctx context.Context, req *authority.PolicyExplainRequest) (*authority.PolicyExplanation, error)
+	GetSSHInventoryHost(ctx context.Context, hostname string) (*db.SSHHost, error)
+	GetSSHInventoryHosts(ctx context.Context) ([]*db.SSHHost, error)
+	CreateSSHInventoryHost(ctx context.Context, host *db.SSHHost) (*db.SSHHost, error)
+	UpdateSSHInventoryHost(ctx context.Context, host *db.SSHHost) (*db.SSHHost, error)
+	RemoveSSHInventoryHost(ctx context.Context, hostname string) error
+	DecommissionSSHInventoryHost(ctx context.Context, hostname, reason string) (*db.SSHHost, error)
+	SearchSSHCertificates(ctx context.Context, filter *db.SSHCertificateFilter) ([]*db.SSHCertificateInfo, error)
+	RevokeSSHCertificates(ctx context.Context, filter *db.SSHCertificateFilter, reasonCode int, reason string) ([]*db.SSHCertificateInfo, error)
+	GetSSHAccessRequest(ctx context.Context, id string) (*db.SSHAccessRequest, error)
+	GetSSHAccessRequests(ctx context.Context) ([]*db.SSHAccessRequest, error)
+	ApproveSSHAccessRequest(ctx context.Context, id, approvedBy string) (*db.SSHAccessRequest, error)
+	DenySSHAccessRequest(ctx context.Context, id, deniedBy, reason string) (*db.SSHAccessRequest, error)
+	CreateSCEPChallenge(ctx context.Context, provisionerName string, ch *db.SCEPChallenge) (string, *db.SCEPChallenge, error)
+	GetSCEPChallenges(ctx context.Context, provisionerName string) ([]*db.SCEPChallenge, error)
+	RevokeSCEPChallenge(ctx context.Context, provisionerName, id string) error
+	GetIssuers(ctx context.Context) []*authority.IssuerStatus
+	RotateIntermediate(ctx context.Context, req *authority.IntermediateRotationRequest) ([]*authority.IssuerStatus, error)
+	CancelIntermediateRotation(ctx context.Context) error
+	IsRevoked(sn string) (bool, error)
+	Revoke(ctx context.Context, opts *authority.RevokeOptions) error
 }
 
 // CreateAdminRequest represents the body for a CreateAdmin request.
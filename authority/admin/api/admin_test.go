@@ -19,8 +19,11 @@ import (
 	"github.com/smallstep/linkedca"
 
 	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 )
 
 type mockAdminAuthority struct {
@@ -44,6 +47,36 @@ type mockAdminAuthority struct {
 	MockCreateAuthorityPolicy func(ctx context.Context, adm *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	MockUpdateAuthorityPolicy func(ctx context.Context, adm *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	MockRemoveAuthorityPolicy func(ctx context.Context) error
+
+	MockGetSSHOptionsPolicy    func(ctx context.Context, provisionerID string) (*policy.SSHOptionsPolicy, error)
+	MockUpdateSSHOptionsPolicy func(ctx context.Context, provisionerID string, p *policy.SSHOptionsPolicy) (*policy.SSHOptionsPolicy, error)
+	MockRemoveSSHOptionsPolicy func(ctx context.Context, provisionerID string) error
+	MockGetCELPolicy           func(ctx context.Context, scope policy.CELPolicyScope) (*policy.CELPolicy, error)
+	MockUpdateCELPolicy        func(ctx context.Context, scope policy.CELPolicyScope, p *policy.CELPolicy) (*policy.CELPolicy, error)
+	MockRemoveCELPolicy        func(ctx context.Context, scope policy.CELPolicyScope) error
+	MockExplainPolicy          func(ctx context.Context, req *authority.PolicyExplainRequest) (*authority.PolicyExplanation, error)
+
+	MockGetSSHInventoryHost          func(ctx context.Context, hostname string) (*db.SSHHost, error)
+	MockGetSSHInventoryHosts         func(ctx context.Context) ([]*db.SSHHost, error)
+	MockCreateSSHInventoryHost       func(ctx context.Context, host *db.SSHHost) (*db.SSHHost, error)
+	MockUpdateSSHInventoryHost       func(ctx context.Context, host *db.SSHHost) (*db.SSHHost, error)
+	MockRemoveSSHInventoryHost       func(ctx context.Context, hostname string) error
+	MockDecommissionSSHInventoryHost func(ctx context.Context, hostname, reason string) (*db.SSHHost, error)
+	MockSearchSSHCertificates        func(ctx context.Context, filter *db.SSHCertificateFilter) ([]*db.SSHCertificateInfo, error)
+	MockRevokeSSHCertificates        func(ctx context.Context, filter *db.SSHCertificateFilter, reasonCode int, reason string) ([]*db.SSHCertificateInfo, error)
+	MockGetSSHAccessRequest          func(ctx context.Context, id string) (*db.SSHAccessRequest, error)
+	MockGetSSHAccessRequests         func(ctx context.Context) ([]*db.SSHAccessRequest, error)
+	MockApproveSSHAccessRequest      func(ctx context.Context, id, approvedBy string) (*db.SSHAccessRequest, error)
+	MockDenySSHAccessRequest         func(ctx context.Context, id, deniedBy, reason string) (*db.SSHAccessRequest, error)
+	MockCreateSCEPChallenge          func(ctx context.Context, provisionerName string, ch *db.SCEPChallenge) (string, *db.SCEPChallenge, error)
+	MockGetSCEPChallenges            func(ctx context.Context, provisionerName string) ([]*db.SCEPChallenge, error)
+	MockRevokeSCEPChallenge          func(ctx context.Context, provisionerName, id string) error
+	MockGetIssuers                   func(ctx context.Context) []*authority.IssuerStatus
+	MockRotateIntermediate           func(ctx context.Context, req *authority.IntermediateRotationRequest) ([]*authority.IssuerStatus, error)
+	MockCancelIntermediateRotation   func(ctx context.Context) error
+
+	MockIsRevoked func(sn string) (bool, error)
+	MockRevoke    func(ctx context.Context, opts *authority.RevokeOptions) error
 }
 
 func (m *mockAdminAuthority) IsAdminAPIEnabled() bool {
@@ -165,6 +198,195 @@ func (m *mockAdminAuthority) RemoveAuthorityPolicy(ctx context.Context) error {
 	return m.MockErr
 }
 
+func (m *mockAdminAuthority) GetSSHInventoryHost(ctx context.Context, hostname string) (*db.SSHHost, error) {
+	if m.MockGetSSHInventoryHost != nil {
+		return m.MockGetSSHInventoryHost(ctx, hostname)
+	}
+	return m.MockRet1.(*db.SSHHost), m.MockErr
+}
+
+func (m *mockAdminAuthority) GetSSHInventoryHosts(ctx context.Context) ([]*db.SSHHost, error) {
+	if m.MockGetSSHInventoryHosts != nil {
+		return m.MockGetSSHInventoryHosts(ctx)
+	}
+	return m.MockRet1.([]*db.SSHHost), m.MockErr
+}
+
+func (m *mockAdminAuthority) CreateSSHInventoryHost(ctx context.Context, host *db.SSHHost) (*db.SSHHost, error) {
+	if m.MockCreateSSHInventoryHost != nil {
+		return m.MockCreateSSHInventoryHost(ctx, host)
+	}
+	return m.MockRet1.(*db.SSHHost), m.MockErr
+}
+
+func (m *mockAdminAuthority) UpdateSSHInventoryHost(ctx context.Context, host *db.SSHHost) (*db.SSHHost, error) {
+	if m.MockUpdateSSHInventoryHost != nil {
+		return m.MockUpdateSSHInventoryHost(ctx, host)
+	}
+	return m.MockRet1.(*db.SSHHost), m.MockErr
+}
+
+func (m *mockAdminAuthority) RemoveSSHInventoryHost(ctx context.Context, hostname string) error {
+	if m.MockRemoveSSHInventoryHost != nil {
+		return m.MockRemoveSSHInventoryHost(ctx, hostname)
+	}
+	return m.MockErr
+}
+
+func (m *mockAdminAuthority) DecommissionSSHInventoryHost(ctx context.Context, hostname, reason string) (*db.SSHHost, error) {
+	if m.MockDecommissionSSHInventoryHost != nil {
+		return m.MockDecommissionSSHInventoryHost(ctx, hostname, reason)
+	}
+	return m.MockRet1.(*db.SSHHost), m.MockErr
+}
+
+func (m *mockAdminAuthority) SearchSSHCertificates(ctx context.Context, filter *db.SSHCertificateFilter) ([]*db.SSHCertificateInfo, error) {
+	if m.MockSearchSSHCertificates != nil {
+		return m.MockSearchSSHCertificates(ctx, filter)
+	}
+	return m.MockRet1.([]*db.SSHCertificateInfo), m.MockErr
+}
+
+func (m *mockAdminAuthority) RevokeSSHCertificates(ctx context.Context, filter *db.SSHCertificateFilter, reasonCode int, reason string) ([]*db.SSHCertificateInfo, error) {
+	if m.MockRevokeSSHCertificates != nil {
+		return m.MockRevokeSSHCertificates(ctx, filter, reasonCode, reason)
+	}
+	return m.MockRet1.([]*db.SSHCertificateInfo), m.MockErr
+}
+
+func (m *mockAdminAuthority) GetSSHAccessRequest(ctx context.Context, id string) (*db.SSHAccessRequest, error) {
+	if m.MockGetSSHAccessRequest != nil {
+		return m.MockGetSSHAccessRequest(ctx, id)
+	}
+	return m.MockRet1.(*db.SSHAccessRequest), m.MockErr
+}
+
+func (m *mockAdminAuthority) GetSSHAccessRequests(ctx context.Context) ([]*db.SSHAccessRequest, error) {
+	if m.MockGetSSHAccessRequests != nil {
+		return m.MockGetSSHAccessRequests(ctx)
+	}
+	return m.MockRet1.([]*db.SSHAccessRequest), m.MockErr
+}
+
+func (m *mockAdminAuthority) ApproveSSHAccessRequest(ctx context.Context, id, approvedBy string) (*db.SSHAccessRequest, error) {
+	if m.MockApproveSSHAccessRequest != nil {
+		return m.MockApproveSSHAccessRequest(ctx, id, approvedBy)
+	}
+	return m.MockRet1.(*db.SSHAccessRequest), m.MockErr
+}
+
+func (m *mockAdminAuthority) DenySSHAccessRequest(ctx context.Context, id, deniedBy, reason string) (*db.SSHAccessRequest, error) {
+	if m.MockDenySSHAccessRequest != nil {
+		return m.MockDenySSHAccessRequest(ctx, id, deniedBy, reason)
+	}
+	return m.MockRet1.(*db.SSHAccessRequest), m.MockErr
+}
+
+func (m *mockAdminAuthority) CreateSCEPChallenge(ctx context.Context, provisionerName string, ch *db.SCEPChallenge) (string, *db.SCEPChallenge, error) {
+	if m.MockCreateSCEPChallenge != nil {
+		return m.MockCreateSCEPChallenge(ctx, provisionerName, ch)
+	}
+	return m.MockRet1.(string), m.MockRet2.(*db.SCEPChallenge), m.MockErr
+}
+
+func (m *mockAdminAuthority) GetSCEPChallenges(ctx context.Context, provisionerName string) ([]*db.SCEPChallenge, error) {
+	if m.MockGetSCEPChallenges != nil {
+		return m.MockGetSCEPChallenges(ctx, provisionerName)
+	}
+	return m.MockRet1.([]*db.SCEPChallenge), m.MockErr
+}
+
+func (m *mockAdminAuthority) RevokeSCEPChallenge(ctx context.Context, provisionerName, id string) error {
+	if m.MockRevokeSCEPChallenge != nil {
+		return m.MockRevokeSCEPChallenge(ctx, provisionerName, id)
+	}
+	return m.MockErr
+}
+
+func (m *mockAdminAuthority) GetIssuers(ctx context.Context) []*authority.IssuerStatus {
+	if m.MockGetIssuers != nil {
+		return m.MockGetIssuers(ctx)
+	}
+	return m.MockRet1.([]*authority.IssuerStatus)
+}
+
+func (m *mockAdminAuthority) RotateIntermediate(ctx context.Context, req *authority.IntermediateRotationRequest) ([]*authority.IssuerStatus, error) {
+	if m.MockRotateIntermediate != nil {
+		return m.MockRotateIntermediate(ctx, req)
+	}
+	return m.MockRet1.([]*authority.IssuerStatus), m.MockErr
+}
+
+func (m *mockAdminAuthority) CancelIntermediateRotation(ctx context.Context) error {
+	if m.MockCancelIntermediateRotation != nil {
+		return m.MockCancelIntermediateRotation(ctx)
+	}
+	return m.MockErr
+}
+
+func (m *mockAdminAuthority) GetSSHOptionsPolicy(ctx context.Context, provisionerID string) (*policy.SSHOptionsPolicy, error) {
+	if m.MockGetSSHOptionsPolicy != nil {
+		return m.MockGetSSHOptionsPolicy(ctx, provisionerID)
+	}
+	return m.MockRet1.(*policy.SSHOptionsPolicy), m.MockErr
+}
+
+func (m *mockAdminAuthority) UpdateSSHOptionsPolicy(ctx context.Context, provisionerID string, p *policy.SSHOptionsPolicy) (*policy.SSHOptionsPolicy, error) {
+	if m.MockUpdateSSHOptionsPolicy != nil {
+		return m.MockUpdateSSHOptionsPolicy(ctx, provisionerID, p)
+	}
+	return m.MockRet1.(*policy.SSHOptionsPolicy), m.MockErr
+}
+
+func (m *mockAdminAuthority) RemoveSSHOptionsPolicy(ctx context.Context, provisionerID string) error {
+	if m.MockRemoveSSHOptionsPolicy != nil {
+		return m.MockRemoveSSHOptionsPolicy(ctx, provisionerID)
+	}
+	return m.MockErr
+}
+
+func (m *mockAdminAuthority) GetCELPolicy(ctx context.Context, scope policy.CELPolicyScope) (*policy.CELPolicy, error) {
+	if m.MockGetCELPolicy != nil {
+		return m.MockGetCELPolicy(ctx, scope)
+	}
+	return m.MockRet1.(*policy.CELPolicy), m.MockErr
+}
+
+func (m *mockAdminAuthority) UpdateCELPolicy(ctx context.Context, scope policy.CELPolicyScope, p *policy.CELPolicy) (*policy.CELPolicy, error) {
+	if m.MockUpdateCELPolicy != nil {
+		return m.MockUpdateCELPolicy(ctx, scope, p)
+	}
+	return m.MockRet1.(*policy.CELPolicy), m.MockErr
+}
+
+func (m *mockAdminAuthority) RemoveCELPolicy(ctx context.Context, scope policy.CELPolicyScope) error {
+	if m.MockRemoveCELPolicy != nil {
+		return m.MockRemoveCELPolicy(ctx, scope)
+	}
+	return m.MockErr
+}
+
+func (m *mockAdminAuthority) ExplainPolicy(ctx context.Context, req *authority.PolicyExplainRequest) (*authority.PolicyExplanation, error) {
+	if m.MockExplainPolicy != nil {
+		return m.MockExplainPolicy(ctx, req)
+	}
+	return m.MockRet1.(*authority.PolicyExplanation), m.MockErr
+}
+
+func (m *mockAdminAuthority) IsRevoked(sn string) (bool, error) {
+	if m.MockIsRevoked != nil {
+		return m.MockIsRevoked(sn)
+	}
+	return false, m.MockErr
+}
+
+func (m *mockAdminAuthority) Revoke(ctx context.Context, opts *authority.RevokeOptions) error {
+	if m.MockRevoke != nil {
+		return m.MockRevoke(ctx, opts)
+	}
+	return m.MockErr
+}
+
 func TestCreateAdminRequest_Validate(t *testing.T) {
 	type fields struct {
 		Subject     string
@@ -13,9 +13,10 @@ var mustAuthority = func(ctx context.Context) adminAuthority {
 }
 
 type router struct {
-	acmeResponder    ACMEAdminResponder
-	policyResponder  PolicyAdminResponder
-	webhookResponder WebhookAdminResponder
+	acmeResponder        ACMEAdminResponder
+	acmeAccountResponder ACMEAccountAdminResponder
+	policyResponder      PolicyAdminResponder
+	webhookResponder     WebhookAdminResponder
 }
 
 type RouterOption func(*router)
@@ -26,6 +27,12 @@ func WithACMEResponder(acmeResponder ACMEAdminResponder) RouterOption {
 	}
 }
 
+func WithACMEAccountResponder(acmeAccountResponder ACMEAccountAdminResponder) RouterOption {
+	return func(r *router) {
+		r.acmeAccountResponder = acmeAccountResponder
+	}
+}
+
 func WithPolicyResponder(policyResponder PolicyAdminResponder) RouterOption {
 	return func(r *router) {
 		r.policyResponder = policyResponder
@@ -61,6 +68,10 @@ func Route(r api.Router, options ...RouterOption) {
 		return authnz(loadProvisionerByName(requireEABEnabled(next)))
 	}
 
+	acmeAccountMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
+		return authnz(loadProvisionerByName(requireACMEProvisioner(next)))
+	}
+
 	authorityPolicyMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
 		return authnz(enabledInStandalone(next))
 	}
@@ -73,6 +84,14 @@ func Route(r api.Router, options ...RouterOption) {
 		return authnz(disabledInStandalone(loadProvisionerByName(requireEABEnabled(loadExternalAccountKey(next)))))
 	}
 
+	acmeAccountPolicyMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
+		return authnz(disabledInStandalone(loadProvisionerByName(requireACMEProvisioner(next))))
+	}
+
+	provisionerPolicyExplainMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
+		return authnz(loadProvisionerByName(next))
+	}
+
 	webhookMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
 		return authnz(loadProvisionerByName(next))
 	}
@@ -91,6 +110,34 @@ func Route(r api.Router, options ...RouterOption) {
 	r.MethodFunc("PATCH", "/admins/{id}", authnz(UpdateAdmin))
 	r.MethodFunc("DELETE", "/admins/{id}", authnz(DeleteAdmin))
 
+	// SSH host inventory
+	r.MethodFunc("GET", "/ssh/hosts/{hostname}", authnz(GetSSHHost))
+	r.MethodFunc("GET", "/ssh/hosts", authnz(GetSSHHosts))
+	r.MethodFunc("POST", "/ssh/hosts", authnz(CreateSSHHost))
+	r.MethodFunc("PUT", "/ssh/hosts/{hostname}", authnz(UpdateSSHHost))
+	r.MethodFunc("DELETE", "/ssh/hosts/{hostname}", authnz(DeleteSSHHost))
+	r.MethodFunc("POST", "/ssh/hosts/{hostname}/decommission", authnz(DecommissionSSHHost))
+
+	// SSH certificates
+	r.MethodFunc("GET", "/ssh/certificates", authnz(GetSSHCertificates))
+	r.MethodFunc("POST", "/ssh/certificates/revoke", authnz(RevokeSSHCertificates))
+
+	// SSH access requests
+	r.MethodFunc("GET", "/ssh/access-requests", authnz(GetSSHAccessRequests))
+	r.MethodFunc("GET", "/ssh/access-requests/{id}", authnz(GetSSHAccessRequest))
+	r.MethodFunc("POST", "/ssh/access-requests/{id}/approve", authnz(ApproveSSHAccessRequest))
+	r.MethodFunc("POST", "/ssh/access-requests/{id}/deny", authnz(DenySSHAccessRequest))
+
+	// SCEP one-time challenges
+	r.MethodFunc("GET", "/scep/challenges/{provisionerName}", authnz(GetSCEPChallenges))
+	r.MethodFunc("POST", "/scep/challenges/{provisionerName}", authnz(CreateSCEPChallenge))
+	r.MethodFunc("DELETE", "/scep/challenges/{provisionerName}/{id}", authnz(RevokeSCEPChallenge))
+
+	// Intermediates
+	r.MethodFunc("GET", "/intermediates", authnz(GetIssuers))
+	r.MethodFunc("POST", "/intermediates/rotation", authnz(RotateIntermediate))
+	r.MethodFunc("DELETE", "/intermediates/rotation", authnz(CancelIntermediateRotation))
+
 	// ACME responder
 	if router.acmeResponder != nil {
 		// ACME External Account Binding Keys
@@ -100,6 +147,16 @@ func Route(r api.Router, options ...RouterOption) {
 		r.MethodFunc("DELETE", "/acme/eab/{provisionerName}/{id}", acmeEABMiddleware(router.acmeResponder.DeleteExternalAccountKey))
 	}
 
+	// ACME account responder
+	if router.acmeAccountResponder != nil {
+		r.MethodFunc("GET", "/acme/accounts/{provisionerName}", acmeAccountMiddleware(router.acmeAccountResponder.GetACMEAccounts))
+		r.MethodFunc("GET", "/acme/accounts/{provisionerName}/{id}", acmeAccountMiddleware(router.acmeAccountResponder.GetACMEAccount))
+		r.MethodFunc("GET", "/acme/accounts/{provisionerName}/{id}/orders", acmeAccountMiddleware(router.acmeAccountResponder.GetACMEAccountOrders))
+		r.MethodFunc("GET", "/acme/accounts/{provisionerName}/{id}/certificates", acmeAccountMiddleware(router.acmeAccountResponder.GetACMEAccountCertificates))
+		r.MethodFunc("POST", "/acme/accounts/{provisionerName}/{id}/deactivate", acmeAccountMiddleware(router.acmeAccountResponder.DeactivateACMEAccount))
+		r.MethodFunc("POST", "/acme/accounts/{provisionerName}/{id}/revoke", acmeAccountMiddleware(router.acmeAccountResponder.RevokeACMEAccountCertificates))
+	}
+
 	// Policy responder
 	if router.policyResponder != nil {
 		// Policy - Authority
@@ -107,12 +164,26 @@ func Route(r api.Router, options ...RouterOption) {
 		r.MethodFunc("POST", "/policy", authorityPolicyMiddleware(router.policyResponder.CreateAuthorityPolicy))
 		r.MethodFunc("PUT", "/policy", authorityPolicyMiddleware(router.policyResponder.UpdateAuthorityPolicy))
 		r.MethodFunc("DELETE", "/policy", authorityPolicyMiddleware(router.policyResponder.DeleteAuthorityPolicy))
+		r.MethodFunc("GET", "/policy/ssh-options", authorityPolicyMiddleware(router.policyResponder.GetAuthoritySSHOptionsPolicy))
+		r.MethodFunc("PUT", "/policy/ssh-options", authorityPolicyMiddleware(router.policyResponder.UpdateAuthoritySSHOptionsPolicy))
+		r.MethodFunc("DELETE", "/policy/ssh-options", authorityPolicyMiddleware(router.policyResponder.DeleteAuthoritySSHOptionsPolicy))
+		r.MethodFunc("GET", "/policy/cel", authorityPolicyMiddleware(router.policyResponder.GetAuthorityCELPolicy))
+		r.MethodFunc("PUT", "/policy/cel", authorityPolicyMiddleware(router.policyResponder.UpdateAuthorityCELPolicy))
+		r.MethodFunc("DELETE", "/policy/cel", authorityPolicyMiddleware(router.policyResponder.DeleteAuthorityCELPolicy))
+		r.MethodFunc("POST", "/policy/explain", authorityPolicyMiddleware(router.policyResponder.ExplainAuthorityPolicy))
 
 		// Policy - Provisioner
 		r.MethodFunc("GET", "/provisioners/{provisionerName}/policy", provisionerPolicyMiddleware(router.policyResponder.GetProvisionerPolicy))
 		r.MethodFunc("POST", "/provisioners/{provisionerName}/policy", provisionerPolicyMiddleware(router.policyResponder.CreateProvisionerPolicy))
 		r.MethodFunc("PUT", "/provisioners/{provisionerName}/policy", provisionerPolicyMiddleware(router.policyResponder.UpdateProvisionerPolicy))
 		r.MethodFunc("DELETE", "/provisioners/{provisionerName}/policy", provisionerPolicyMiddleware(router.policyResponder.DeleteProvisionerPolicy))
+		r.MethodFunc("GET", "/provisioners/{provisionerName}/policy/ssh-options", provisionerPolicyMiddleware(router.policyResponder.GetProvisionerSSHOptionsPolicy))
+		r.MethodFunc("PUT", "/provisioners/{provisionerName}/policy/ssh-options", provisionerPolicyMiddleware(router.policyResponder.UpdateProvisionerSSHOptionsPolicy))
+		r.MethodFunc("DELETE", "/provisioners/{provisionerName}/policy/ssh-options", provisionerPolicyMiddleware(router.policyResponder.DeleteProvisionerSSHOptionsPolicy))
+		r.MethodFunc("GET", "/provisioners/{provisionerName}/policy/cel", provisionerPolicyMiddleware(router.policyResponder.GetProvisionerCELPolicy))
+		r.MethodFunc("PUT", "/provisioners/{provisionerName}/policy/cel", provisionerPolicyMiddleware(router.policyResponder.UpdateProvisionerCELPolicy))
+		r.MethodFunc("DELETE", "/provisioners/{provisionerName}/policy/cel", provisionerPolicyMiddleware(router.policyResponder.DeleteProvisionerCELPolicy))
+		r.MethodFunc("POST", "/provisioners/{provisionerName}/policy/explain", provisionerPolicyExplainMiddleware(router.policyResponder.ExplainProvisionerPolicy))
 
 		// Policy - ACME Account
 		r.MethodFunc("GET", "/acme/policy/{provisionerName}/reference/{reference}", acmePolicyMiddleware(router.policyResponder.GetACMEAccountPolicy))
@@ -123,6 +194,10 @@ func Route(r api.Router, options ...RouterOption) {
 		r.MethodFunc("PUT", "/acme/policy/{provisionerName}/key/{keyID}", acmePolicyMiddleware(router.policyResponder.UpdateACMEAccountPolicy))
 		r.MethodFunc("DELETE", "/acme/policy/{provisionerName}/reference/{reference}", acmePolicyMiddleware(router.policyResponder.DeleteACMEAccountPolicy))
 		r.MethodFunc("DELETE", "/acme/policy/{provisionerName}/key/{keyID}", acmePolicyMiddleware(router.policyResponder.DeleteACMEAccountPolicy))
+		r.MethodFunc("GET", "/acme/policy/{provisionerName}/account/{id}/cel", acmeAccountPolicyMiddleware(router.policyResponder.GetACMEAccountCELPolicy))
+		r.MethodFunc("PUT", "/acme/policy/{provisionerName}/account/{id}/cel", acmeAccountPolicyMiddleware(router.policyResponder.UpdateACMEAccountCELPolicy))
+		r.MethodFunc("DELETE", "/acme/policy/{provisionerName}/account/{id}/cel", acmeAccountPolicyMiddleware(router.policyResponder.DeleteACMEAccountCELPolicy))
+		r.MethodFunc("POST", "/acme/policy/{provisionerName}/account/{id}/explain", acmeAccountMiddleware(router.policyResponder.ExplainACMEAccountPolicy))
 	}
 
 	if router.webhookResponder != nil {
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/smallstep/linkedca"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+// RotateIntermediateRequest represents the body of a request to rotate the
+// intermediate certificate. The root key and the new key are files or KMS
+// URIs in the CA host.
+type RotateIntermediateRequest struct {
+	RootKey   string    `json:"rootKey"`
+	Key       string    `json:"key"`
+	CrossSign bool      `json:"crossSign,omitempty"`
+	RotateAt  time.Time `json:"rotateAt,omitzero"`
+	NotAfter  time.Time `json:"notAfter,omitzero"`
+}
+
+// Validate validates a rotate intermediate request body.
+func (r *RotateIntermediateRequest) Validate() error {
+	switch {
+	case r.RootKey == "":
+		return admin.NewError(admin.ErrorBadRequestType, "rootKey cannot be empty")
+	case r.Key == "":
+		return admin.NewError(admin.ErrorBadRequestType, "key cannot be empty")
+	default:
+		return nil
+	}
+}
+
+// GetIssuersResponse is the response with the status of the intermediate
+// certificates.
+type GetIssuersResponse struct {
+	Issuers []*authority.IssuerStatus `json:"issuers"`
+}
+
+// GetIssuers returns the status of the intermediate certificates.
+func GetIssuers(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, &GetIssuersResponse{
+		Issuers: mustAuthority(r.Context()).GetIssuers(r.Context()),
+	})
+}
+
+// RotateIntermediate creates a new intermediate certificate and schedules the
+// rotation of the current one.
+func RotateIntermediate(w http.ResponseWriter, r *http.Request) {
+	var body RotateIntermediateRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	adm := linkedca.MustAdminFromContext(ctx)
+
+	issuers, err := mustAuthority(ctx).RotateIntermediate(ctx, &authority.IntermediateRotationRequest{
+		RootKey:   body.RootKey,
+		Key:       body.Key,
+		CrossSign: body.CrossSign,
+		RotateAt:  body.RotateAt,
+		NotAfter:  body.NotAfter,
+		CreatedBy: adm.Subject,
+	})
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error rotating intermediate"))
+		return
+	}
+	render.JSONStatus(w, r, &GetIssuersResponse{
+		Issuers: issuers,
+	}, http.StatusCreated)
+}
+
+// CancelIntermediateRotation cancels the rotation of the intermediate
+// certificate.
+func CancelIntermediateRotation(w http.ResponseWriter, r *http.Request) {
+	if err := mustAuthority(r.Context()).CancelIntermediateRotation(r.Context()); err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error canceling intermediate rotation"))
+		return
+	}
+	render.JSON(w, r, &DeleteResponse{Status: "ok"})
+}
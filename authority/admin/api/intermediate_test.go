@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/linkedca"
+
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+func newIntermediateRequest(method, body string) *http.Request {
+	ctx := linkedca.NewContextWithAdmin(context.Background(), &linkedca.Admin{Subject: "admin@example.com"})
+	req := httptest.NewRequest(method, "/intermediates/rotation", http.NoBody)
+	if body != "" {
+		req = httptest.NewRequest(method, "/intermediates/rotation", strings.NewReader(body))
+	}
+	return req.WithContext(ctx)
+}
+
+func TestGetIssuers(t *testing.T) {
+	mockMustAuthority(t, &mockAdminAuthority{
+		MockGetIssuers: func(ctx context.Context) []*authority.IssuerStatus {
+			return []*authority.IssuerStatus{
+				{Status: authority.IssuerStatusActive, SerialNumber: "1"},
+				{Status: authority.IssuerStatusScheduled, SerialNumber: "2"},
+			}
+		},
+	})
+
+	w := httptest.NewRecorder()
+	GetIssuers(w, newIntermediateRequest("GET", ""))
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp GetIssuersResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	if assert.Len(t, resp.Issuers, 2) {
+		assert.Equal(t, "active", resp.Issuers[0].Status)
+		assert.Equal(t, "scheduled", resp.Issuers[1].Status)
+	}
+}
+
+func TestRotateIntermediate(t *testing.T) {
+	rotateAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		body     string
+		want     *authority.IntermediateRotationRequest
+		wantCode int
+	}{
+		{"ok", `{"rootKey":"root_ca_key","key":"intermediate_ca_key_2","crossSign":true,"rotateAt":"2026-01-01T00:00:00Z"}`, &authority.IntermediateRotationRequest{
+			RootKey:   "root_ca_key",
+			Key:       "intermediate_ca_key_2",
+			CrossSign: true,
+			RotateAt:  rotateAt,
+			CreatedBy: "admin@example.com",
+		}, http.StatusCreated},
+		{"fail/json", `{`, nil, http.StatusBadRequest},
+		{"fail/rootKey", `{"key":"intermediate_ca_key_2"}`, nil, http.StatusBadRequest},
+		{"fail/key", `{"rootKey":"root_ca_key"}`, nil, http.StatusBadRequest},
+		{"fail/authority", `{"rootKey":"root_ca_key","key":"intermediate_ca_key"}`, nil, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAdminAuthority{
+				MockRotateIntermediate: func(ctx context.Context, req *authority.IntermediateRotationRequest) ([]*authority.IssuerStatus, error) {
+					if tt.want == nil {
+						return nil, admin.NewError(admin.ErrorConflictType, "an intermediate rotation already exists")
+					}
+					assert.Equal(t, tt.want, req)
+					return []*authority.IssuerStatus{
+						{Status: authority.IssuerStatusActive},
+						{Status: authority.IssuerStatusScheduled, RotateAt: rotateAt},
+					}, nil
+				},
+			})
+			w := httptest.NewRecorder()
+			RotateIntermediate(w, newIntermediateRequest("POST", tt.body))
+			require.Equal(t, tt.wantCode, w.Code)
+			if tt.want == nil {
+				return
+			}
+
+			var resp GetIssuersResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Len(t, resp.Issuers, 2)
+		})
+	}
+}
+
+func TestCancelIntermediateRotation(t *testing.T) {
+	mockMustAuthority(t, &mockAdminAuthority{
+		MockErr: admin.NewError(admin.ErrorNotFoundType, "intermediate rotation not found"),
+	})
+	w := httptest.NewRecorder()
+	CancelIntermediateRotation(w, newIntermediateRequest("DELETE", ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	mockMustAuthority(t, &mockAdminAuthority{})
+	w = httptest.NewRecorder()
+	CancelIntermediateRotation(w, newIntermediateRequest("DELETE", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
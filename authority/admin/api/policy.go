@@ -5,6 +5,9 @@ import (
 	"errors"
 	"net/http"
 
+	"go.step.sm/crypto/pemutil"
+	"golang.org/x/crypto/ssh"
+
 	"github.com/smallstep/linkedca"
 
 	"github.com/smallstep/certificates/acme"
@@ -13,6 +16,7 @@ import (
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/policy"
+	"github.com/smallstep/certificates/authority/provisioner"
 )
 
 // PolicyAdminResponder is the interface responsible for writing ACME admin
@@ -30,6 +34,24 @@ type PolicyAdminResponder interface {
 	CreateACMEAccountPolicy(w http.ResponseWriter, r *http.Request)
 	UpdateACMEAccountPolicy(w http.ResponseWriter, r *http.Request)
 	DeleteACMEAccountPolicy(w http.ResponseWriter, r *http.Request)
+	GetAuthoritySSHOptionsPolicy(w http.ResponseWriter, r *http.Request)
+	UpdateAuthoritySSHOptionsPolicy(w http.ResponseWriter, r *http.Request)
+	DeleteAuthoritySSHOptionsPolicy(w http.ResponseWriter, r *http.Request)
+	GetProvisionerSSHOptionsPolicy(w http.ResponseWriter, r *http.Request)
+	UpdateProvisionerSSHOptionsPolicy(w http.ResponseWriter, r *http.Request)
+	DeleteProvisionerSSHOptionsPolicy(w http.ResponseWriter, r *http.Request)
+	GetAuthorityCELPolicy(w http.ResponseWriter, r *http.Request)
+	UpdateAuthorityCELPolicy(w http.ResponseWriter, r *http.Request)
+	DeleteAuthorityCELPolicy(w http.ResponseWriter, r *http.Request)
+	GetProvisionerCELPolicy(w http.ResponseWriter, r *http.Request)
+	UpdateProvisionerCELPolicy(w http.ResponseWriter, r *http.Request)
+	DeleteProvisionerCELPolicy(w http.ResponseWriter, r *http.Request)
+	GetACMEAccountCELPolicy(w http.ResponseWriter, r *http.Request)
+	UpdateACMEAccountCELPolicy(w http.ResponseWriter, r *http.Request)
+	DeleteACMEAccountCELPolicy(w http.ResponseWriter, r *http.Request)
+	ExplainAuthorityPolicy(w http.ResponseWriter, r *http.Request)
+	ExplainProvisionerPolicy(w http.ResponseWriter, r *http.Request)
+	ExplainACMEAccountPolicy(w http.ResponseWriter, r *http.Request)
 }
 
 // policyAdminResponder implements PolicyAdminResponder.
@@ -453,6 +475,401 @@ func (par *policyAdminResponder) DeleteACMEAccountPolicy(w http.ResponseWriter,
 	render.JSONStatus(w, r, DeleteResponse{Status: "ok"}, http.StatusOK)
 }
 
+// GetAuthoritySSHOptionsPolicy handles the GET /admin/policy/ssh-options request
+func (par *policyAdminResponder) GetAuthoritySSHOptionsPolicy(w http.ResponseWriter, r *http.Request) {
+	getSSHOptionsPolicy(w, r, "")
+}
+
+// UpdateAuthoritySSHOptionsPolicy handles the PUT /admin/policy/ssh-options request
+func (par *policyAdminResponder) UpdateAuthoritySSHOptionsPolicy(w http.ResponseWriter, r *http.Request) {
+	updateSSHOptionsPolicy(w, r, "")
+}
+
+// DeleteAuthoritySSHOptionsPolicy handles the DELETE /admin/policy/ssh-options request
+func (par *policyAdminResponder) DeleteAuthoritySSHOptionsPolicy(w http.ResponseWriter, r *http.Request) {
+	deleteSSHOptionsPolicy(w, r, "")
+}
+
+// GetProvisionerSSHOptionsPolicy handles the GET /admin/provisioners/{name}/policy/ssh-options request
+func (par *policyAdminResponder) GetProvisionerSSHOptionsPolicy(w http.ResponseWriter, r *http.Request) {
+	prov := linkedca.MustProvisionerFromContext(r.Context())
+	getSSHOptionsPolicy(w, r, prov.GetId())
+}
+
+// UpdateProvisionerSSHOptionsPolicy handles the PUT /admin/provisioners/{name}/policy/ssh-options request
+func (par *policyAdminResponder) UpdateProvisionerSSHOptionsPolicy(w http.ResponseWriter, r *http.Request) {
+	prov := linkedca.MustProvisionerFromContext(r.Context())
+	updateSSHOptionsPolicy(w, r, prov.GetId())
+}
+
+// DeleteProvisionerSSHOptionsPolicy handles the DELETE /admin/provisioners/{name}/policy/ssh-options request
+func (par *policyAdminResponder) DeleteProvisionerSSHOptionsPolicy(w http.ResponseWriter, r *http.Request) {
+	prov := linkedca.MustProvisionerFromContext(r.Context())
+	deleteSSHOptionsPolicy(w, r, prov.GetId())
+}
+
+// getSSHOptionsPolicy writes the SSH critical options and extensions policy
+// of a provisioner, or of the authority if the provisioner ID is empty.
+func getSSHOptionsPolicy(w http.ResponseWriter, r *http.Request, provisionerID string) {
+	ctx := r.Context()
+	if err := blockLinkedCA(ctx); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	p, err := mustAuthority(ctx).GetSSHOptionsPolicy(ctx, provisionerID)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving SSH options policy"))
+		return
+	}
+
+	render.JSONStatus(w, r, p, http.StatusOK)
+}
+
+// updateSSHOptionsPolicy creates or replaces the SSH critical options and
+// extensions policy of a provisioner, or of the authority if the
+// provisioner ID is empty.
+func updateSSHOptionsPolicy(w http.ResponseWriter, r *http.Request, provisionerID string) {
+	ctx := r.Context()
+	if err := blockLinkedCA(ctx); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	var newPolicy = new(policy.SSHOptionsPolicy)
+	if err := read.JSON(r.Body, newPolicy); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := newPolicy.Validate(); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error validating SSH options policy"))
+		return
+	}
+
+	updatedPolicy, err := mustAuthority(ctx).UpdateSSHOptionsPolicy(ctx, provisionerID, newPolicy)
+	if err != nil {
+		if isBadRequest(err) {
+			render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error updating SSH options policy"))
+			return
+		}
+
+		render.Error(w, r, admin.WrapErrorISE(err, "error updating SSH options policy"))
+		return
+	}
+
+	render.JSONStatus(w, r, updatedPolicy, http.StatusOK)
+}
+
+// deleteSSHOptionsPolicy deletes the SSH critical options and extensions
+// policy of a provisioner, or of the authority if the provisioner ID is
+// empty.
+func deleteSSHOptionsPolicy(w http.ResponseWriter, r *http.Request, provisionerID string) {
+	ctx := r.Context()
+	if err := blockLinkedCA(ctx); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	auth := mustAuthority(ctx)
+	if _, err := auth.GetSSHOptionsPolicy(ctx, provisionerID); err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving SSH options policy"))
+		return
+	}
+
+	if err := auth.RemoveSSHOptionsPolicy(ctx, provisionerID); err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error deleting SSH options policy"))
+		return
+	}
+
+	render.JSONStatus(w, r, DeleteResponse{Status: "ok"}, http.StatusOK)
+}
+
+// GetAuthorityCELPolicy handles the GET /admin/policy/cel request
+func (par *policyAdminResponder) GetAuthorityCELPolicy(w http.ResponseWriter, r *http.Request) {
+	getCELPolicy(w, r, policy.CELPolicyScope{})
+}
+
+// UpdateAuthorityCELPolicy handles the PUT /admin/policy/cel request
+func (par *policyAdminResponder) UpdateAuthorityCELPolicy(w http.ResponseWriter, r *http.Request) {
+	updateCELPolicy(w, r, policy.CELPolicyScope{})
+}
+
+// DeleteAuthorityCELPolicy handles the DELETE /admin/policy/cel request
+func (par *policyAdminResponder) DeleteAuthorityCELPolicy(w http.ResponseWriter, r *http.Request) {
+	deleteCELPolicy(w, r, policy.CELPolicyScope{})
+}
+
+// GetProvisionerCELPolicy handles the GET /admin/provisioners/{name}/policy/cel request
+func (par *policyAdminResponder) GetProvisionerCELPolicy(w http.ResponseWriter, r *http.Request) {
+	prov := linkedca.MustProvisionerFromContext(r.Context())
+	getCELPolicy(w, r, policy.CELPolicyScope{ProvisionerID: prov.GetId()})
+}
+
+// UpdateProvisionerCELPolicy handles the PUT /admin/provisioners/{name}/policy/cel request
+func (par *policyAdminResponder) UpdateProvisionerCELPolicy(w http.ResponseWriter, r *http.Request) {
+	prov := linkedca.MustProvisionerFromContext(r.Context())
+	updateCELPolicy(w, r, policy.CELPolicyScope{ProvisionerID: prov.GetId()})
+}
+
+// DeleteProvisionerCELPolicy handles the DELETE /admin/provisioners/{name}/policy/cel request
+func (par *policyAdminResponder) DeleteProvisionerCELPolicy(w http.ResponseWriter, r *http.Request) {
+	prov := linkedca.MustProvisionerFromContext(r.Context())
+	deleteCELPolicy(w, r, policy.CELPolicyScope{ProvisionerID: prov.GetId()})
+}
+
+// GetACMEAccountCELPolicy handles the GET /admin/acme/policy/{provisionerName}/account/{id}/cel request
+func (par *policyAdminResponder) GetACMEAccountCELPolicy(w http.ResponseWriter, r *http.Request) {
+	if scope, ok := acmeAccountCELPolicyScope(w, r); ok {
+		getCELPolicy(w, r, scope)
+	}
+}
+
+// UpdateACMEAccountCELPolicy handles the PUT /admin/acme/policy/{provisionerName}/account/{id}/cel request
+func (par *policyAdminResponder) UpdateACMEAccountCELPolicy(w http.ResponseWriter, r *http.Request) {
+	if scope, ok := acmeAccountCELPolicyScope(w, r); ok {
+		updateCELPolicy(w, r, scope)
+	}
+}
+
+// DeleteACMEAccountCELPolicy handles the DELETE /admin/acme/policy/{provisionerName}/account/{id}/cel request
+func (par *policyAdminResponder) DeleteACMEAccountCELPolicy(w http.ResponseWriter, r *http.Request) {
+	if scope, ok := acmeAccountCELPolicyScope(w, r); ok {
+		deleteCELPolicy(w, r, scope)
+	}
+}
+
+// acmeAccountCELPolicyScope returns the CEL policy scope of the ACME account
+// in the request. It writes an error if the account doesn't exist.
+func acmeAccountCELPolicyScope(w http.ResponseWriter, r *http.Request) (policy.CELPolicyScope, bool) {
+	acc, err := loadACMEAccount(r)
+	if err != nil {
+		render.Error(w, r, err)
+		return policy.CELPolicyScope{}, false
+	}
+
+	return policy.CELPolicyScope{
+		ProvisionerID: acc.ProvisionerID,
+		ACMEAccountID: acc.ID,
+	}, true
+}
+
+// getCELPolicy writes the CEL policy of the authority, a provisioner or an
+// ACME account.
+func getCELPolicy(w http.ResponseWriter, r *http.Request, scope policy.CELPolicyScope) {
+	ctx := r.Context()
+	if err := blockLinkedCA(ctx); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	p, err := mustAuthority(ctx).GetCELPolicy(ctx, scope)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving CEL policy"))
+		return
+	}
+
+	render.JSONStatus(w, r, p, http.StatusOK)
+}
+
+// updateCELPolicy creates or replaces the CEL policy of the authority, a
+// provisioner or an ACME account.
+func updateCELPolicy(w http.ResponseWriter, r *http.Request, scope policy.CELPolicyScope) {
+	ctx := r.Context()
+	if err := blockLinkedCA(ctx); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	var newPolicy = new(policy.CELPolicy)
+	if err := read.JSON(r.Body, newPolicy); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := newPolicy.Validate(); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error validating CEL policy"))
+		return
+	}
+
+	updatedPolicy, err := mustAuthority(ctx).UpdateCELPolicy(ctx, scope, newPolicy)
+	if err != nil {
+		if isBadRequest(err) {
+			render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error updating CEL policy"))
+			return
+		}
+
+		render.Error(w, r, admin.WrapErrorISE(err, "error updating CEL policy"))
+		return
+	}
+
+	render.JSONStatus(w, r, updatedPolicy, http.StatusOK)
+}
+
+// deleteCELPolicy deletes the CEL policy of the authority, a provisioner or
+// an ACME account.
+func deleteCELPolicy(w http.ResponseWriter, r *http.Request, scope policy.CELPolicyScope) {
+	ctx := r.Context()
+	if err := blockLinkedCA(ctx); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	auth := mustAuthority(ctx)
+	if _, err := auth.GetCELPolicy(ctx, scope); err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving CEL policy"))
+		return
+	}
+
+	if err := auth.RemoveCELPolicy(ctx, scope); err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error deleting CEL policy"))
+		return
+	}
+
+	render.JSONStatus(w, r, DeleteResponse{Status: "ok"}, http.StatusOK)
+}
+
+// ExplainPolicyRequest is the body of a request to explain the policy
+// decisions for a CSR, a list of SANs or a list of SSH principals. Exactly one
+// of them must be set. CertType is the type of the SSH certificate the
+// principals are requested for; it defaults to "user".
+type ExplainPolicyRequest struct {
+	CSR        string   `json:"csr,omitempty"`
+	SANs       []string `json:"sans,omitempty"`
+	Principals []string `json:"principals,omitempty"`
+	CertType   string   `json:"certType,omitempty"`
+}
+
+// Validate validates an ExplainPolicyRequest body.
+func (r *ExplainPolicyRequest) Validate() error {
+	var n int
+	if r.CSR != "" {
+		n++
+	}
+	if len(r.SANs) > 0 {
+		n++
+	}
+	if len(r.Principals) > 0 {
+		n++
+	}
+
+	switch {
+	case n == 0:
+		return admin.NewError(admin.ErrorBadRequestType, "csr, sans or principals are required")
+	case n > 1:
+		return admin.NewError(admin.ErrorBadRequestType, "only one of csr, sans or principals can be set")
+	case r.CertType != "" && len(r.Principals) == 0:
+		return admin.NewError(admin.ErrorBadRequestType, "certType can only be set with principals")
+	case r.CertType != "" && r.CertType != provisioner.SSHUserCert && r.CertType != provisioner.SSHHostCert:
+		return admin.NewError(admin.ErrorBadRequestType, "certType %q is not valid", r.CertType)
+	default:
+		return nil
+	}
+}
+
+// toAuthority converts the request body into the authority request.
+func (r *ExplainPolicyRequest) toAuthority() (*authority.PolicyExplainRequest, error) {
+	switch {
+	case r.CSR != "":
+		csr, err := pemutil.ParseCertificateRequest([]byte(r.CSR))
+		if err != nil {
+			return nil, admin.WrapError(admin.ErrorBadRequestType, err, "error parsing csr")
+		}
+		return &authority.PolicyExplainRequest{CSR: csr}, nil
+	case len(r.Principals) > 0:
+		certType := uint32(ssh.UserCert)
+		if r.CertType == provisioner.SSHHostCert {
+			certType = ssh.HostCert
+		}
+		return &authority.PolicyExplainRequest{
+			SSHCertificate: &ssh.Certificate{
+				CertType:        certType,
+				ValidPrincipals: r.Principals,
+			},
+		}, nil
+	default:
+		return &authority.PolicyExplainRequest{SANs: r.SANs}, nil
+	}
+}
+
+// ExplainAuthorityPolicy handles the POST /admin/policy/explain request
+func (par *policyAdminResponder) ExplainAuthorityPolicy(w http.ResponseWriter, r *http.Request) {
+	explainPolicy(w, r, func(*authority.PolicyExplainRequest) error {
+		return nil
+	})
+}
+
+// ExplainProvisionerPolicy handles the POST /admin/provisioners/{name}/policy/explain request
+func (par *policyAdminResponder) ExplainProvisionerPolicy(w http.ResponseWriter, r *http.Request) {
+	explainPolicy(w, r, func(req *authority.PolicyExplainRequest) error {
+		req.Provisioner = linkedca.MustProvisionerFromContext(r.Context())
+		return nil
+	})
+}
+
+// ExplainACMEAccountPolicy handles the POST /admin/acme/policy/{provisionerName}/account/{id}/explain request
+func (par *policyAdminResponder) ExplainACMEAccountPolicy(w http.ResponseWriter, r *http.Request) {
+	explainPolicy(w, r, func(req *authority.PolicyExplainRequest) error {
+		ctx := r.Context()
+		acc, err := loadACMEAccount(r)
+		if err != nil {
+			return err
+		}
+
+		// the ACME account policy is the policy of the External Account
+		// Key the account was bound to, like when a new order is created.
+		eak, err := acme.MustDatabaseFromContext(ctx).GetExternalAccountKeyByAccountID(ctx, acc.ProvisionerID, acc.ID)
+		if err != nil {
+			return admin.WrapErrorISE(err, "error retrieving ACME External Account Key")
+		}
+
+		req.Provisioner = linkedca.MustProvisionerFromContext(ctx)
+		req.ACMEAccountID = acc.ID
+		if eak != nil {
+			req.ACMEAccountPolicy = eak.Policy
+		}
+		return nil
+	})
+}
+
+// explainPolicy writes the policy decisions for the names in the request. The
+// scope function adds the provisioner and ACME account to explain.
+func explainPolicy(w http.ResponseWriter, r *http.Request, scope func(*authority.PolicyExplainRequest) error) {
+	ctx := r.Context()
+	if err := blockLinkedCA(ctx); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	var body ExplainPolicyRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	req, err := body.toAuthority()
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	if err := scope(req); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	explanation, err := mustAuthority(ctx).ExplainPolicy(ctx, req)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error explaining policy"))
+		return
+	}
+
+	render.JSONStatus(w, r, explanation, http.StatusOK)
+}
+
 // blockLinkedCA blocks all API operations on linked deployments
 func blockLinkedCA(ctx context.Context) error {
 	// temporary blocking linked deployments
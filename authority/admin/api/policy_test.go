@@ -3,7 +3,12 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"io"
 	"net/http"
@@ -12,6 +17,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
 	"google.golang.org/protobuf/encoding/protojson"
 
 	"github.com/smallstep/linkedca"
@@ -19,6 +25,7 @@ import (
 	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/policy"
 )
 
 type fakeLinkedCA struct {
@@ -2773,3 +2780,567 @@ func Test_validatePolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestPolicyAdminResponder_GetAuthoritySSHOptionsPolicy(t *testing.T) {
+	sshOptionsPolicy := &policy.SSHOptionsPolicy{
+		User: &policy.SSHCertificateOptionsPolicy{
+			CriticalOptions: &policy.SSHCriticalOptions{SourceAddresses: []string{"10.0.0.0/8"}},
+			Extensions:      &policy.SSHExtensionOptions{Deny: []string{"permit-port-forwarding"}},
+		},
+	}
+	tests := []struct {
+		name       string
+		adminDB    admin.DB
+		auth       adminAuthority
+		statusCode int
+		errType    string
+	}{
+		{"fail/linkedca", &fakeLinkedCA{}, nil, 501, admin.ErrorNotImplementedType.String()},
+		{"fail/not-found", &admin.MockDB{}, &mockAdminAuthority{
+			MockGetSSHOptionsPolicy: func(ctx context.Context, provisionerID string) (*policy.SSHOptionsPolicy, error) {
+				assert.Equal(t, "", provisionerID)
+				return nil, admin.NewError(admin.ErrorNotFoundType, "ssh options policy not found")
+			},
+		}, 404, admin.ErrorNotFoundType.String()},
+		{"fail/not-implemented", &admin.MockDB{}, &mockAdminAuthority{
+			MockGetSSHOptionsPolicy: func(ctx context.Context, provisionerID string) (*policy.SSHOptionsPolicy, error) {
+				return nil, admin.NewError(admin.ErrorNotImplementedType, "not supported")
+			},
+		}, 501, admin.ErrorNotImplementedType.String()},
+		{"ok", &admin.MockDB{}, &mockAdminAuthority{
+			MockGetSSHOptionsPolicy: func(ctx context.Context, provisionerID string) (*policy.SSHOptionsPolicy, error) {
+				assert.Equal(t, "", provisionerID)
+				return sshOptionsPolicy, nil
+			},
+		}, 200, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			ctx := admin.NewContext(context.Background(), tc.adminDB)
+			req := httptest.NewRequest("GET", "/foo", http.NoBody).WithContext(ctx)
+			w := httptest.NewRecorder()
+
+			NewPolicyAdminResponder().GetAuthoritySSHOptionsPolicy(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.NoError(t, err)
+
+			if res.StatusCode >= 400 {
+				ae := testAdminError{}
+				assert.NoError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+				assert.Equal(t, tc.errType, ae.Type)
+				return
+			}
+
+			p := &policy.SSHOptionsPolicy{}
+			assert.NoError(t, json.Unmarshal(body, p))
+			assert.Equal(t, sshOptionsPolicy, p)
+		})
+	}
+}
+
+func TestPolicyAdminResponder_UpdateProvisionerSSHOptionsPolicy(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
+	tests := []struct {
+		name       string
+		auth       adminAuthority
+		body       string
+		statusCode int
+		errType    string
+	}{
+		{"fail/read.JSON", nil, "{", 400, admin.ErrorBadRequestType.String()},
+		{"fail/validate", nil, `{"user":{"criticalOptions":{"sourceAddress":["not-an-ip"]}}}`, 400, admin.ErrorBadRequestType.String()},
+		{"fail/auth.UpdateSSHOptionsPolicy", &mockAdminAuthority{
+			MockUpdateSSHOptionsPolicy: func(ctx context.Context, provisionerID string, p *policy.SSHOptionsPolicy) (*policy.SSHOptionsPolicy, error) {
+				return nil, &authority.PolicyError{Typ: authority.StoreFailure, Err: errors.New("force")}
+			},
+		}, `{"user":{"extensions":{"deny":["permit-pty"]}}}`, 500, admin.ErrorServerInternalType.String()},
+		{"ok", &mockAdminAuthority{
+			MockUpdateSSHOptionsPolicy: func(ctx context.Context, provisionerID string, p *policy.SSHOptionsPolicy) (*policy.SSHOptionsPolicy, error) {
+				assert.Equal(t, "provID", provisionerID)
+				assert.Equal(t, []string{"permit-pty"}, p.User.Extensions.Deny)
+				return p, nil
+			},
+		}, `{"user":{"extensions":{"deny":["permit-pty"]}}}`, 200, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			ctx := admin.NewContext(context.Background(), &admin.MockDB{})
+			ctx = linkedca.NewContextWithProvisioner(ctx, prov)
+			req := httptest.NewRequest("PUT", "/foo", strings.NewReader(tc.body)).WithContext(ctx)
+			w := httptest.NewRecorder()
+
+			NewPolicyAdminResponder().UpdateProvisionerSSHOptionsPolicy(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.NoError(t, err)
+
+			if res.StatusCode >= 400 {
+				ae := testAdminError{}
+				assert.NoError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+				assert.Equal(t, tc.errType, ae.Type)
+				return
+			}
+
+			p := &policy.SSHOptionsPolicy{}
+			assert.NoError(t, json.Unmarshal(body, p))
+			assert.Equal(t, []string{"permit-pty"}, p.User.Extensions.Deny)
+		})
+	}
+}
+
+func TestPolicyAdminResponder_DeleteAuthoritySSHOptionsPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		auth       adminAuthority
+		statusCode int
+		errType    string
+	}{
+		{"fail/not-found", &mockAdminAuthority{
+			MockGetSSHOptionsPolicy: func(ctx context.Context, provisionerID string) (*policy.SSHOptionsPolicy, error) {
+				return nil, admin.NewError(admin.ErrorNotFoundType, "ssh options policy not found")
+			},
+		}, 404, admin.ErrorNotFoundType.String()},
+		{"fail/auth.RemoveSSHOptionsPolicy", &mockAdminAuthority{
+			MockGetSSHOptionsPolicy: func(ctx context.Context, provisionerID string) (*policy.SSHOptionsPolicy, error) {
+				return &policy.SSHOptionsPolicy{}, nil
+			},
+			MockRemoveSSHOptionsPolicy: func(ctx context.Context, provisionerID string) error {
+				return errors.New("force")
+			},
+		}, 500, admin.ErrorServerInternalType.String()},
+		{"ok", &mockAdminAuthority{
+			MockGetSSHOptionsPolicy: func(ctx context.Context, provisionerID string) (*policy.SSHOptionsPolicy, error) {
+				return &policy.SSHOptionsPolicy{}, nil
+			},
+			MockRemoveSSHOptionsPolicy: func(ctx context.Context, provisionerID string) error {
+				assert.Equal(t, "", provisionerID)
+				return nil
+			},
+		}, 200, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			ctx := admin.NewContext(context.Background(), &admin.MockDB{})
+			req := httptest.NewRequest("DELETE", "/foo", http.NoBody).WithContext(ctx)
+			w := httptest.NewRecorder()
+
+			NewPolicyAdminResponder().DeleteAuthoritySSHOptionsPolicy(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.NoError(t, err)
+
+			if res.StatusCode >= 400 {
+				ae := testAdminError{}
+				assert.NoError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+				assert.Equal(t, tc.errType, ae.Type)
+				return
+			}
+
+			assert.JSONEq(t, `{"status":"ok"}`, string(body))
+		})
+	}
+}
+
+func TestPolicyAdminResponder_GetAuthorityCELPolicy(t *testing.T) {
+	celPolicy := &policy.CELPolicy{
+		X509: []policy.CELRule{{Name: "max-sans", Expression: "size(cert.sans) <= 5", Message: "too many names"}},
+	}
+	tests := []struct {
+		name       string
+		adminDB    admin.DB
+		auth       adminAuthority
+		statusCode int
+		errType    string
+	}{
+		{"fail/linkedca", &fakeLinkedCA{}, nil, 501, admin.ErrorNotImplementedType.String()},
+		{"fail/not-found", &admin.MockDB{}, &mockAdminAuthority{
+			MockGetCELPolicy: func(ctx context.Context, scope policy.CELPolicyScope) (*policy.CELPolicy, error) {
+				assert.Equal(t, policy.CELPolicyScope{}, scope)
+				return nil, admin.NewError(admin.ErrorNotFoundType, "cel policy not found")
+			},
+		}, 404, admin.ErrorNotFoundType.String()},
+		{"ok", &admin.MockDB{}, &mockAdminAuthority{
+			MockGetCELPolicy: func(ctx context.Context, scope policy.CELPolicyScope) (*policy.CELPolicy, error) {
+				assert.Equal(t, policy.CELPolicyScope{}, scope)
+				return celPolicy, nil
+			},
+		}, 200, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			ctx := admin.NewContext(context.Background(), tc.adminDB)
+			req := httptest.NewRequest("GET", "/foo", http.NoBody).WithContext(ctx)
+			w := httptest.NewRecorder()
+
+			NewPolicyAdminResponder().GetAuthorityCELPolicy(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.NoError(t, err)
+
+			if res.StatusCode >= 400 {
+				ae := testAdminError{}
+				assert.NoError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+				assert.Equal(t, tc.errType, ae.Type)
+				return
+			}
+
+			p := &policy.CELPolicy{}
+			assert.NoError(t, json.Unmarshal(body, p))
+			assert.Equal(t, celPolicy, p)
+		})
+	}
+}
+
+func TestPolicyAdminResponder_UpdateProvisionerCELPolicy(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
+	tests := []struct {
+		name       string
+		auth       adminAuthority
+		body       string
+		statusCode int
+		errType    string
+	}{
+		{"fail/read.JSON", nil, "{", 400, admin.ErrorBadRequestType.String()},
+		{"fail/validate", nil, `{"x509":[{"name":"max-sans","expression":"size(cert.sans)"}]}`, 400, admin.ErrorBadRequestType.String()},
+		{"fail/auth.UpdateCELPolicy", &mockAdminAuthority{
+			MockUpdateCELPolicy: func(ctx context.Context, scope policy.CELPolicyScope, p *policy.CELPolicy) (*policy.CELPolicy, error) {
+				return nil, &authority.PolicyError{Typ: authority.StoreFailure, Err: errors.New("force")}
+			},
+		}, `{"x509":[{"name":"max-sans","expression":"size(cert.sans) <= 5"}]}`, 500, admin.ErrorServerInternalType.String()},
+		{"ok", &mockAdminAuthority{
+			MockUpdateCELPolicy: func(ctx context.Context, scope policy.CELPolicyScope, p *policy.CELPolicy) (*policy.CELPolicy, error) {
+				assert.Equal(t, policy.CELPolicyScope{ProvisionerID: "provID"}, scope)
+				return p, nil
+			},
+		}, `{"x509":[{"name":"max-sans","expression":"size(cert.sans) <= 5"}]}`, 200, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			ctx := admin.NewContext(context.Background(), &admin.MockDB{})
+			ctx = linkedca.NewContextWithProvisioner(ctx, prov)
+			req := httptest.NewRequest("PUT", "/foo", strings.NewReader(tc.body)).WithContext(ctx)
+			w := httptest.NewRecorder()
+
+			NewPolicyAdminResponder().UpdateProvisionerCELPolicy(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.NoError(t, err)
+
+			if res.StatusCode >= 400 {
+				ae := testAdminError{}
+				assert.NoError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+				assert.Equal(t, tc.errType, ae.Type)
+				return
+			}
+
+			p := &policy.CELPolicy{}
+			assert.NoError(t, json.Unmarshal(body, p))
+			assert.Equal(t, []policy.CELRule{{Name: "max-sans", Expression: "size(cert.sans) <= 5"}}, p.X509)
+		})
+	}
+}
+
+func TestPolicyAdminResponder_UpdateACMEAccountCELPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		db         acme.DB
+		auth       adminAuthority
+		statusCode int
+	}{
+		{"fail/not-found", &acme.MockDB{
+			MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+				return nil, acme.ErrNotFound
+			},
+		}, nil, 404},
+		{"fail/other-provisioner", &acme.MockDB{
+			MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+				return &acme.Account{ID: id, ProvisionerID: "otherID"}, nil
+			},
+		}, nil, 404},
+		{"ok", &acme.MockDB{
+			MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+				return &acme.Account{ID: id, ProvisionerID: "provID"}, nil
+			},
+		}, &mockAdminAuthority{
+			MockUpdateCELPolicy: func(ctx context.Context, scope policy.CELPolicyScope, p *policy.CELPolicy) (*policy.CELPolicy, error) {
+				assert.Equal(t, policy.CELPolicyScope{ProvisionerID: "provID", ACMEAccountID: "accID"}, scope)
+				return p, nil
+			},
+		}, 200},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			body := []byte(`{"x509":[{"name":"no-client-auth","expression":"!(\"clientAuth\" in cert.extKeyUsage)"}]}`)
+			req := newACMEAccountRequest(t, "PUT", "/foo", body, tc.db, map[string]string{"id": "accID"})
+			req = req.WithContext(admin.NewContext(req.Context(), &admin.MockDB{}))
+			w := httptest.NewRecorder()
+
+			NewPolicyAdminResponder().UpdateACMEAccountCELPolicy(w, req)
+			assert.Equal(t, tc.statusCode, w.Code)
+		})
+	}
+}
+
+func TestPolicyAdminResponder_DeleteAuthorityCELPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		auth       adminAuthority
+		statusCode int
+		errType    string
+	}{
+		{"fail/not-found", &mockAdminAuthority{
+			MockGetCELPolicy: func(ctx context.Context, scope policy.CELPolicyScope) (*policy.CELPolicy, error) {
+				return nil, admin.NewError(admin.ErrorNotFoundType, "cel policy not found")
+			},
+		}, 404, admin.ErrorNotFoundType.String()},
+		{"fail/auth.RemoveCELPolicy", &mockAdminAuthority{
+			MockGetCELPolicy: func(ctx context.Context, scope policy.CELPolicyScope) (*policy.CELPolicy, error) {
+				return &policy.CELPolicy{}, nil
+			},
+			MockRemoveCELPolicy: func(ctx context.Context, scope policy.CELPolicyScope) error {
+				return errors.New("force")
+			},
+		}, 500, admin.ErrorServerInternalType.String()},
+		{"ok", &mockAdminAuthority{
+			MockGetCELPolicy: func(ctx context.Context, scope policy.CELPolicyScope) (*policy.CELPolicy, error) {
+				return &policy.CELPolicy{}, nil
+			},
+			MockRemoveCELPolicy: func(ctx context.Context, scope policy.CELPolicyScope) error {
+				assert.Equal(t, policy.CELPolicyScope{}, scope)
+				return nil
+			},
+		}, 200, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			ctx := admin.NewContext(context.Background(), &admin.MockDB{})
+			req := httptest.NewRequest("DELETE", "/foo", http.NoBody).WithContext(ctx)
+			w := httptest.NewRecorder()
+
+			NewPolicyAdminResponder().DeleteAuthorityCELPolicy(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.NoError(t, err)
+
+			if res.StatusCode >= 400 {
+				ae := testAdminError{}
+				assert.NoError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+				assert.Equal(t, tc.errType, ae.Type)
+				return
+			}
+
+			assert.JSONEq(t, `{"status":"ok"}`, string(body))
+		})
+	}
+}
+
+func TestExplainPolicyRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     *ExplainPolicyRequest
+		wantErr bool
+	}{
+		{"ok/csr", &ExplainPolicyRequest{CSR: "csr"}, false},
+		{"ok/sans", &ExplainPolicyRequest{SANs: []string{"www.example.com"}}, false},
+		{"ok/principals", &ExplainPolicyRequest{Principals: []string{"jane"}}, false},
+		{"ok/host-principals", &ExplainPolicyRequest{Principals: []string{"host.example.com"}, CertType: "host"}, false},
+		{"fail/empty", &ExplainPolicyRequest{}, true},
+		{"fail/multiple", &ExplainPolicyRequest{SANs: []string{"www.example.com"}, Principals: []string{"jane"}}, true},
+		{"fail/certType-without-principals", &ExplainPolicyRequest{SANs: []string{"www.example.com"}, CertType: "user"}, true},
+		{"fail/certType", &ExplainPolicyRequest{Principals: []string{"jane"}, CertType: "foo"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPolicyAdminResponder_ExplainAuthorityPolicy(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		DNSNames: []string{"www.example.com"},
+	}, key)
+	assert.NoError(t, err)
+	csrPEM, err := json.Marshal(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})))
+	assert.NoError(t, err)
+
+	explanation := &authority.PolicyExplanation{
+		Allowed: true,
+		Layers: []*authority.PolicyLayerExplanation{
+			{Layer: authority.AuthorityPolicyLayer, Explanation: &policy.Explanation{Allowed: true}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		auth       adminAuthority
+		statusCode int
+		errType    string
+	}{
+		{"fail/read.JSON", "{", nil, 400, admin.ErrorBadRequestType.String()},
+		{"fail/validate", "{}", nil, 400, admin.ErrorBadRequestType.String()},
+		{"fail/csr", `{"csr":"foo"}`, nil, 400, admin.ErrorBadRequestType.String()},
+		{"fail/auth.ExplainPolicy", `{"sans":["www.example.com"]}`, &mockAdminAuthority{
+			MockExplainPolicy: func(ctx context.Context, req *authority.PolicyExplainRequest) (*authority.PolicyExplanation, error) {
+				return nil, errors.New("force")
+			},
+		}, 500, admin.ErrorServerInternalType.String()},
+		{"ok/sans", `{"sans":["www.example.com"]}`, &mockAdminAuthority{
+			MockExplainPolicy: func(ctx context.Context, req *authority.PolicyExplainRequest) (*authority.PolicyExplanation, error) {
+				assert.Equal(t, &authority.PolicyExplainRequest{SANs: []string{"www.example.com"}}, req)
+				return explanation, nil
+			},
+		}, 200, ""},
+		{"ok/csr", `{"csr":` + string(csrPEM) + `}`, &mockAdminAuthority{
+			MockExplainPolicy: func(ctx context.Context, req *authority.PolicyExplainRequest) (*authority.PolicyExplanation, error) {
+				if assert.NotNil(t, req.CSR) {
+					assert.Equal(t, []string{"www.example.com"}, req.CSR.DNSNames)
+				}
+				return explanation, nil
+			},
+		}, 200, ""},
+		{"ok/principals", `{"principals":["host.example.com"],"certType":"host"}`, &mockAdminAuthority{
+			MockExplainPolicy: func(ctx context.Context, req *authority.PolicyExplainRequest) (*authority.PolicyExplanation, error) {
+				if assert.NotNil(t, req.SSHCertificate) {
+					assert.Equal(t, uint32(ssh.HostCert), req.SSHCertificate.CertType)
+					assert.Equal(t, []string{"host.example.com"}, req.SSHCertificate.ValidPrincipals)
+				}
+				return explanation, nil
+			},
+		}, 200, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			ctx := admin.NewContext(context.Background(), &admin.MockDB{})
+			req := httptest.NewRequest("POST", "/foo", strings.NewReader(tc.body)).WithContext(ctx)
+			w := httptest.NewRecorder()
+
+			NewPolicyAdminResponder().ExplainAuthorityPolicy(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.NoError(t, err)
+
+			if res.StatusCode >= 400 {
+				ae := testAdminError{}
+				assert.NoError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+				assert.Equal(t, tc.errType, ae.Type)
+				return
+			}
+
+			assert.JSONEq(t, `{"allowed":true,"layers":[{"layer":"authority","configured":false,"allowed":true}]}`, string(body))
+		})
+	}
+}
+
+func TestPolicyAdminResponder_ExplainACMEAccountPolicy(t *testing.T) {
+	accountPolicy := &acme.Policy{
+		X509: acme.X509Policy{Allowed: acme.PolicyNames{DNSNames: []string{"*.example.com"}}},
+	}
+	tests := []struct {
+		name       string
+		db         acme.DB
+		auth       adminAuthority
+		statusCode int
+	}{
+		{"fail/not-found", &acme.MockDB{
+			MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+				return nil, acme.ErrNotFound
+			},
+		}, nil, 404},
+		{"fail/db.GetExternalAccountKeyByAccountID", &acme.MockDB{
+			MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+				return &acme.Account{ID: id, ProvisionerID: "provID"}, nil
+			},
+			MockGetExternalAccountKeyByAccountID: func(ctx context.Context, provisionerID, accountID string) (*acme.ExternalAccountKey, error) {
+				return nil, errors.New("force")
+			},
+		}, nil, 500},
+		{"ok/without-eak", &acme.MockDB{
+			MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+				return &acme.Account{ID: id, ProvisionerID: "provID"}, nil
+			},
+			MockGetExternalAccountKeyByAccountID: func(ctx context.Context, provisionerID, accountID string) (*acme.ExternalAccountKey, error) {
+				return nil, nil
+			},
+		}, &mockAdminAuthority{
+			MockExplainPolicy: func(ctx context.Context, req *authority.PolicyExplainRequest) (*authority.PolicyExplanation, error) {
+				assert.Equal(t, "acme", req.Provisioner.GetName())
+				assert.Equal(t, "accID", req.ACMEAccountID)
+				assert.Nil(t, req.ACMEAccountPolicy)
+				return &authority.PolicyExplanation{Allowed: true}, nil
+			},
+		}, 200},
+		{"ok/with-eak", &acme.MockDB{
+			MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+				return &acme.Account{ID: id, ProvisionerID: "provID"}, nil
+			},
+			MockGetExternalAccountKeyByAccountID: func(ctx context.Context, provisionerID, accountID string) (*acme.ExternalAccountKey, error) {
+				assert.Equal(t, "provID", provisionerID)
+				assert.Equal(t, "accID", accountID)
+				return &acme.ExternalAccountKey{ID: "eakID", Policy: accountPolicy}, nil
+			},
+		}, &mockAdminAuthority{
+			MockExplainPolicy: func(ctx context.Context, req *authority.PolicyExplainRequest) (*authority.PolicyExplanation, error) {
+				assert.Equal(t, "accID", req.ACMEAccountID)
+				assert.Equal(t, accountPolicy, req.ACMEAccountPolicy)
+				return &authority.PolicyExplanation{Allowed: true}, nil
+			},
+		}, 200},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			body := []byte(`{"sans":["www.example.com"]}`)
+			req := newACMEAccountRequest(t, "POST", "/foo", body, tc.db, map[string]string{"id": "accID"})
+			req = req.WithContext(admin.NewContext(req.Context(), &admin.MockDB{}))
+			w := httptest.NewRecorder()
+
+			NewPolicyAdminResponder().ExplainACMEAccountPolicy(w, req)
+			assert.Equal(t, tc.statusCode, w.Code)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/linkedca"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+// CreateSCEPChallengeRequest represents the body of a request to create a
+// one-time SCEP challenge. All the fields are optional.
+type CreateSCEPChallengeRequest struct {
+	Subject   string    `json:"subject,omitempty"`
+	SANs      []string  `json:"sans,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+}
+
+// CreateSCEPChallengeResponse is the response for a new one-time SCEP
+// challenge. It is the only time the challenge password is returned.
+type CreateSCEPChallengeResponse struct {
+	Challenge string `json:"challenge"`
+	*db.SCEPChallenge
+}
+
+// GetSCEPChallengesResponse is the response for a list of one-time SCEP
+// challenges.
+type GetSCEPChallengesResponse struct {
+	Challenges []*db.SCEPChallenge `json:"challenges"`
+}
+
+// CreateSCEPChallenge mints a one-time challenge for a SCEP provisioner on
+// behalf of the admin making the request.
+func CreateSCEPChallenge(w http.ResponseWriter, r *http.Request) {
+	var body CreateSCEPChallengeRequest
+	if r.ContentLength != 0 {
+		if err := read.JSON(r.Body, &body); err != nil {
+			render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	name := chi.URLParam(r, "provisionerName")
+	adm := linkedca.MustAdminFromContext(ctx)
+
+	challenge, ch, err := mustAuthority(ctx).CreateSCEPChallenge(ctx, name, &db.SCEPChallenge{
+		Subject:   body.Subject,
+		SANs:      body.SANs,
+		CreatedBy: adm.Subject,
+		ExpiresAt: body.ExpiresAt,
+	})
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error creating scep challenge for provisioner %s", name))
+		return
+	}
+	render.JSONStatus(w, r, &CreateSCEPChallengeResponse{
+		Challenge:     challenge,
+		SCEPChallenge: ch,
+	}, http.StatusCreated)
+}
+
+// GetSCEPChallenges returns the outstanding one-time challenges of a SCEP
+// provisioner.
+func GetSCEPChallenges(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provisionerName")
+
+	chs, err := mustAuthority(r.Context()).GetSCEPChallenges(r.Context(), name)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving scep challenges for provisioner %s", name))
+		return
+	}
+	render.JSON(w, r, &GetSCEPChallengesResponse{
+		Challenges: chs,
+	})
+}
+
+// RevokeSCEPChallenge revokes an outstanding one-time challenge of a SCEP
+// provisioner.
+func RevokeSCEPChallenge(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provisionerName")
+	id := chi.URLParam(r, "id")
+
+	if err := mustAuthority(r.Context()).RevokeSCEPChallenge(r.Context(), name, id); err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error revoking scep challenge %s", id))
+		return
+	}
+	render.JSON(w, r, &DeleteResponse{Status: "ok"})
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/linkedca"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+func newSCEPChallengeRequest(method, target, body, id string) *http.Request {
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("provisionerName", "scep")
+	if id != "" {
+		chiCtx.URLParams.Add("id", id)
+	}
+	ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+	ctx = linkedca.NewContextWithAdmin(ctx, &linkedca.Admin{Subject: "admin@example.com"})
+	req := httptest.NewRequest(method, target, http.NoBody)
+	if body != "" {
+		req = httptest.NewRequest(method, target, strings.NewReader(body))
+	}
+	return req.WithContext(ctx)
+}
+
+func TestCreateSCEPChallenge(t *testing.T) {
+	expiresAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		body     string
+		want     *db.SCEPChallenge
+		wantCode int
+	}{
+		{"ok", "", &db.SCEPChallenge{CreatedBy: "admin@example.com"}, http.StatusCreated},
+		{"ok/bound", `{"subject":"device-1","sans":["device-1.example.com"],"expiresAt":"2026-01-01T00:00:00Z"}`, &db.SCEPChallenge{
+			Subject:   "device-1",
+			SANs:      []string{"device-1.example.com"},
+			CreatedBy: "admin@example.com",
+			ExpiresAt: expiresAt,
+		}, http.StatusCreated},
+		{"fail/json", `{`, nil, http.StatusBadRequest},
+		{"fail/authority", `{"sans":[""]}`, nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAdminAuthority{
+				MockCreateSCEPChallenge: func(ctx context.Context, provisionerName string, ch *db.SCEPChallenge) (string, *db.SCEPChallenge, error) {
+					assert.Equal(t, "scep", provisionerName)
+					if tt.want == nil {
+						return "", nil, admin.NewError(admin.ErrorBadRequestType, "scep challenge sans cannot contain empty values")
+					}
+					assert.Equal(t, tt.want, ch)
+					ch.ID = "the-id"
+					ch.Provisioner = provisionerName
+					return "the-challenge", ch, nil
+				},
+			})
+			w := httptest.NewRecorder()
+			CreateSCEPChallenge(w, newSCEPChallengeRequest("POST", "/scep/challenges/scep", tt.body, ""))
+			require.Equal(t, tt.wantCode, w.Code)
+			if tt.want == nil {
+				return
+			}
+
+			var resp map[string]any
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, "the-challenge", resp["challenge"])
+			assert.Equal(t, "the-id", resp["id"])
+			assert.Equal(t, "scep", resp["provisioner"])
+		})
+	}
+}
+
+func TestGetSCEPChallenges(t *testing.T) {
+	mockMustAuthority(t, &mockAdminAuthority{
+		MockGetSCEPChallenges: func(ctx context.Context, provisionerName string) ([]*db.SCEPChallenge, error) {
+			assert.Equal(t, "scep", provisionerName)
+			return []*db.SCEPChallenge{
+				{ID: "1", Provisioner: "scep"},
+				{ID: "2", Provisioner: "scep"},
+			}, nil
+		},
+	})
+
+	w := httptest.NewRecorder()
+	GetSCEPChallenges(w, newSCEPChallengeRequest("GET", "/scep/challenges/scep", "", ""))
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp GetSCEPChallengesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	if assert.Len(t, resp.Challenges, 2) {
+		assert.Equal(t, "1", resp.Challenges[0].ID)
+		assert.Equal(t, "2", resp.Challenges[1].ID)
+	}
+}
+
+func TestRevokeSCEPChallenge(t *testing.T) {
+	mockMustAuthority(t, &mockAdminAuthority{
+		MockRevokeSCEPChallenge: func(ctx context.Context, provisionerName, id string) error {
+			assert.Equal(t, "scep", provisionerName)
+			if id != "1" {
+				return admin.NewError(admin.ErrorNotFoundType, "scep challenge %s not found", id)
+			}
+			return nil
+		},
+	})
+
+	w := httptest.NewRecorder()
+	RevokeSCEPChallenge(w, newSCEPChallengeRequest("DELETE", "/scep/challenges/scep/1", "", "1"))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	RevokeSCEPChallenge(w, newSCEPChallengeRequest("DELETE", "/scep/challenges/scep/2", "", "2"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/linkedca"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+// DenySSHAccessRequestRequest represents the body of a request to deny an SSH
+// access request.
+type DenySSHAccessRequestRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// GetSSHAccessRequestsResponse is the response for a list of SSH access
+// requests.
+type GetSSHAccessRequestsResponse struct {
+	AccessRequests []*db.SSHAccessRequest `json:"accessRequests"`
+}
+
+// GetSSHAccessRequest returns an SSH access request.
+func GetSSHAccessRequest(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	req, err := mustAuthority(r.Context()).GetSSHAccessRequest(r.Context(), id)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving ssh access request %s", id))
+		return
+	}
+	render.JSON(w, r, req)
+}
+
+// GetSSHAccessRequests returns the SSH access requests sorted by creation
+// time. They can be filtered by the status and subject query parameters.
+func GetSSHAccessRequests(w http.ResponseWriter, r *http.Request) {
+	reqs, err := mustAuthority(r.Context()).GetSSHAccessRequests(r.Context())
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving ssh access requests"))
+		return
+	}
+
+	query := r.URL.Query()
+	status, subject := query.Get("status"), query.Get("subject")
+	filtered := []*db.SSHAccessRequest{}
+	for _, req := range reqs {
+		if (status == "" || strings.EqualFold(string(req.Status), status)) && (subject == "" || req.Subject == subject) {
+			filtered = append(filtered, req)
+		}
+	}
+	slices.SortFunc(filtered, func(a, b *db.SSHAccessRequest) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	render.JSON(w, r, &GetSSHAccessRequestsResponse{
+		AccessRequests: filtered,
+	})
+}
+
+// ApproveSSHAccessRequest approves a pending SSH access request on behalf of
+// the admin making the request.
+func ApproveSSHAccessRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := chi.URLParam(r, "id")
+	adm := linkedca.MustAdminFromContext(ctx)
+
+	req, err := mustAuthority(ctx).ApproveSSHAccessRequest(ctx, id, adm.Subject)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error approving ssh access request %s", id))
+		return
+	}
+	render.JSON(w, r, req)
+}
+
+// DenySSHAccessRequest denies a pending or approved SSH access request on
+// behalf of the admin making the request.
+func DenySSHAccessRequest(w http.ResponseWriter, r *http.Request) {
+	var body DenySSHAccessRequestRequest
+	if r.ContentLength != 0 {
+		if err := read.JSON(r.Body, &body); err != nil {
+			render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	id := chi.URLParam(r, "id")
+	adm := linkedca.MustAdminFromContext(ctx)
+
+	req, err := mustAuthority(ctx).DenySSHAccessRequest(ctx, id, adm.Subject, body.Reason)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error denying ssh access request %s", id))
+		return
+	}
+	render.JSON(w, r, req)
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/linkedca"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+func newSSHAccessRequestRequest(method, target, body, id string) *http.Request {
+	chiCtx := chi.NewRouteContext()
+	if id != "" {
+		chiCtx.URLParams.Add("id", id)
+	}
+	ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+	ctx = linkedca.NewContextWithAdmin(ctx, &linkedca.Admin{Subject: "admin@example.com"})
+	req := httptest.NewRequest(method, target, http.NoBody)
+	if body != "" {
+		req = httptest.NewRequest(method, target, strings.NewReader(body))
+	}
+	return req.WithContext(ctx)
+}
+
+func TestGetSSHAccessRequests(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	mockMustAuthority(t, &mockAdminAuthority{
+		MockGetSSHAccessRequests: func(ctx context.Context) ([]*db.SSHAccessRequest, error) {
+			return []*db.SSHAccessRequest{
+				{ID: "3", Status: db.SSHAccessRequestPending, Subject: "bob", CreatedAt: base.Add(3 * time.Hour)},
+				{ID: "1", Status: db.SSHAccessRequestIssued, Subject: "alice", CreatedAt: base.Add(time.Hour)},
+				{ID: "2", Status: db.SSHAccessRequestPending, Subject: "alice", CreatedAt: base.Add(2 * time.Hour)},
+			}, nil
+		},
+	})
+
+	tests := []struct {
+		name    string
+		query   string
+		wantIDs []string
+	}{
+		{"ok/all", "", []string{"1", "2", "3"}},
+		{"ok/status", "?status=pending", []string{"2", "3"}},
+		{"ok/subject", "?subject=alice", []string{"1", "2"}},
+		{"ok/status and subject", "?status=PENDING&subject=alice", []string{"2"}},
+		{"ok/none", "?status=denied", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			GetSSHAccessRequests(w, newSSHAccessRequestRequest("GET", "/ssh/access-requests"+tt.query, "", ""))
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var resp GetSSHAccessRequestsResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			ids := []string{}
+			for _, req := range resp.AccessRequests {
+				ids = append(ids, req.ID)
+			}
+			assert.Equal(t, tt.wantIDs, ids)
+		})
+	}
+}
+
+func TestApproveSSHAccessRequest(t *testing.T) {
+	mockMustAuthority(t, &mockAdminAuthority{
+		MockApproveSSHAccessRequest: func(ctx context.Context, id, approvedBy string) (*db.SSHAccessRequest, error) {
+			assert.Equal(t, "admin@example.com", approvedBy)
+			if id != "1" {
+				return nil, admin.NewError(admin.ErrorBadRequestType, "ssh access request %s is denied", id)
+			}
+			return &db.SSHAccessRequest{ID: id, Status: db.SSHAccessRequestApproved, ApprovedBy: approvedBy}, nil
+		},
+	})
+
+	w := httptest.NewRecorder()
+	ApproveSSHAccessRequest(w, newSSHAccessRequestRequest("POST", "/ssh/access-requests/1/approve", "", "1"))
+	require.Equal(t, http.StatusOK, w.Code)
+	var req db.SSHAccessRequest
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &req))
+	assert.Equal(t, db.SSHAccessRequestApproved, req.Status)
+
+	w = httptest.NewRecorder()
+	ApproveSSHAccessRequest(w, newSSHAccessRequestRequest("POST", "/ssh/access-requests/2/approve", "", "2"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDenySSHAccessRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantReason string
+		wantCode   int
+	}{
+		{"ok", "", "", http.StatusOK},
+		{"ok/reason", `{"reason":"not on call"}`, "not on call", http.StatusOK},
+		{"fail/json", `{`, "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAdminAuthority{
+				MockDenySSHAccessRequest: func(ctx context.Context, id, deniedBy, reason string) (*db.SSHAccessRequest, error) {
+					assert.Equal(t, "1", id)
+					assert.Equal(t, "admin@example.com", deniedBy)
+					assert.Equal(t, tt.wantReason, reason)
+					return &db.SSHAccessRequest{ID: id, Status: db.SSHAccessRequestDenied}, nil
+				},
+			})
+			w := httptest.NewRecorder()
+			DenySSHAccessRequest(w, newSSHAccessRequestRequest("POST", "/ssh/access-requests/1/deny", tt.body, "1"))
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+// RevokeSSHCertificatesRequest represents the body of a request to revoke all
+// the active SSH certificates with a principal or a key id.
+type RevokeSSHCertificatesRequest struct {
+	Principal  string `json:"principal,omitempty"`
+	KeyID      string `json:"keyID,omitempty"`
+	Type       string `json:"type,omitempty"`
+	ReasonCode int    `json:"reasonCode,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// Validate validates a RevokeSSHCertificatesRequest body.
+func (r *RevokeSSHCertificatesRequest) Validate() error {
+	switch {
+	case r.Principal == "" && r.KeyID == "":
+		return admin.NewError(admin.ErrorBadRequestType, "principal or keyID are required")
+	case r.Type != "" && r.Type != provisioner.SSHUserCert && r.Type != provisioner.SSHHostCert:
+		return admin.NewError(admin.ErrorBadRequestType, "type %q is not valid", r.Type)
+	case r.ReasonCode < 0 || r.ReasonCode > 10:
+		return admin.NewError(admin.ErrorBadRequestType, "reasonCode %d is not valid", r.ReasonCode)
+	default:
+		return nil
+	}
+}
+
+// SSHCertificatesResponse is the response for a list of SSH certificates.
+type SSHCertificatesResponse struct {
+	Certificates []*db.SSHCertificateInfo `json:"certificates"`
+}
+
+// GetSSHCertificates returns the stored SSH certificates. They can be filtered
+// by the principal, keyID, type, active and validAt query parameters. Searches
+// by principal or keyID only return certificates that have not expired.
+func GetSSHCertificates(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := &db.SSHCertificateFilter{
+		Principal: query.Get("principal"),
+		KeyID:     query.Get("keyID"),
+		Type:      query.Get("type"),
+	}
+	if v := query.Get("validAt"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "validAt %q is not a valid RFC3339 time", v))
+			return
+		}
+		filter.ValidAt = t
+	}
+	if v := query.Get("active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "active %q is not a valid boolean", v))
+			return
+		}
+		if active && filter.ValidAt.IsZero() {
+			filter.ValidAt = time.Now()
+		}
+	}
+
+	infos, err := mustAuthority(r.Context()).SearchSSHCertificates(r.Context(), filter)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error searching ssh certificates"))
+		return
+	}
+	if infos == nil {
+		infos = []*db.SSHCertificateInfo{}
+	}
+	render.JSON(w, r, &SSHCertificatesResponse{
+		Certificates: infos,
+	})
+}
+
+// RevokeSSHCertificates revokes all the active SSH certificates with the
+// principal or key id in the request, and returns the revoked certificates.
+func RevokeSSHCertificates(w http.ResponseWriter, r *http.Request) {
+	var body RevokeSSHCertificatesRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	infos, err := mustAuthority(r.Context()).RevokeSSHCertificates(r.Context(), &db.SSHCertificateFilter{
+		Principal: body.Principal,
+		KeyID:     body.KeyID,
+		Type:      body.Type,
+	}, body.ReasonCode, body.Reason)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error revoking ssh certificates"))
+		return
+	}
+	render.JSON(w, r, &SSHCertificatesResponse{
+		Certificates: infos,
+	})
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/smallstep/certificates/db"
+)
+
+func TestRevokeSSHCertificatesRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     *RevokeSSHCertificatesRequest
+		wantErr string
+	}{
+		{"ok/principal", &RevokeSSHCertificatesRequest{Principal: "alice", Type: "user"}, ""},
+		{"ok/keyID", &RevokeSSHCertificatesRequest{KeyID: "alice@example.com", ReasonCode: ocsp.KeyCompromise}, ""},
+		{"fail/empty", &RevokeSSHCertificatesRequest{}, "principal or keyID are required"},
+		{"fail/type", &RevokeSSHCertificatesRequest{Principal: "alice", Type: "foo"}, `type "foo" is not valid`},
+		{"fail/reasonCode", &RevokeSSHCertificatesRequest{Principal: "alice", ReasonCode: 11}, "reasonCode 11 is not valid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestGetSSHCertificates(t *testing.T) {
+	validAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name       string
+		query      string
+		wantFilter *db.SSHCertificateFilter
+		wantCode   int
+	}{
+		{"ok/all", "", &db.SSHCertificateFilter{}, http.StatusOK},
+		{"ok/filter", "?principal=alice&keyID=alice@example.com&type=user", &db.SSHCertificateFilter{Principal: "alice", KeyID: "alice@example.com", Type: "user"}, http.StatusOK},
+		{"ok/validAt", "?validAt=2024-01-02T03:04:05Z", &db.SSHCertificateFilter{ValidAt: validAt}, http.StatusOK},
+		{"ok/active", "?active=true", nil, http.StatusOK},
+		{"fail/validAt", "?validAt=yesterday", nil, http.StatusBadRequest},
+		{"fail/active", "?active=maybe", nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAdminAuthority{
+				MockSearchSSHCertificates: func(ctx context.Context, filter *db.SSHCertificateFilter) ([]*db.SSHCertificateInfo, error) {
+					if tt.wantFilter != nil {
+						assert.Equal(t, tt.wantFilter, filter)
+					} else {
+						assert.WithinDuration(t, time.Now(), filter.ValidAt, time.Minute)
+					}
+					return []*db.SSHCertificateInfo{{Serial: "1", Type: "user", Principals: []string{"alice"}}}, nil
+				},
+			})
+			w := httptest.NewRecorder()
+			GetSSHCertificates(w, httptest.NewRequest("GET", "/ssh/certificates"+tt.query, http.NoBody))
+			require.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode == http.StatusOK {
+				var resp SSHCertificatesResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				require.Len(t, resp.Certificates, 1)
+				assert.Equal(t, "1", resp.Certificates[0].Serial)
+			}
+		})
+	}
+}
+
+func TestRevokeSSHCertificates(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{"ok", `{"principal":"alice","type":"user","reasonCode":1,"reason":"offboarding"}`, http.StatusOK},
+		{"fail/json", `{`, http.StatusBadRequest},
+		{"fail/validate", `{"reason":"offboarding"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAdminAuthority{
+				MockRevokeSSHCertificates: func(ctx context.Context, filter *db.SSHCertificateFilter, reasonCode int, reason string) ([]*db.SSHCertificateInfo, error) {
+					assert.Equal(t, &db.SSHCertificateFilter{Principal: "alice", Type: "user"}, filter)
+					assert.Equal(t, ocsp.KeyCompromise, reasonCode)
+					assert.Equal(t, "offboarding", reason)
+					return []*db.SSHCertificateInfo{{Serial: "1", Revoked: true}}, nil
+				},
+			})
+			w := httptest.NewRecorder()
+			RevokeSSHCertificates(w, newSSHHostRequest("POST", "/ssh/certificates/revoke", []byte(tt.body), ""))
+			require.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode == http.StatusOK {
+				var resp SSHCertificatesResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				require.Len(t, resp.Certificates, 1)
+				assert.True(t, resp.Certificates[0].Revoked)
+			}
+		})
+	}
+}
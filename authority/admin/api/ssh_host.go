@@ -0,0 +1,197 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+// SSHHostRequest represents the body of a request to create or update a host
+// in the SSH host inventory.
+type SSHHostRequest struct {
+	Hostname string            `json:"hostname"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Groups   []string          `json:"groups,omitempty"`
+}
+
+// Validate validates an SSHHostRequest body.
+func (r *SSHHostRequest) Validate() error {
+	switch {
+	case r.Hostname == "":
+		return admin.NewError(admin.ErrorBadRequestType, "hostname cannot be empty")
+	case strings.ContainsAny(r.Hostname, " \t\r\n/"):
+		return admin.NewError(admin.ErrorBadRequestType, "hostname %q is not valid", r.Hostname)
+	}
+	for k := range r.Tags {
+		if k == "" {
+			return admin.NewError(admin.ErrorBadRequestType, "tag names cannot be empty")
+		}
+	}
+	for _, g := range r.Groups {
+		if g == "" {
+			return admin.NewError(admin.ErrorBadRequestType, "groups cannot contain empty values")
+		}
+	}
+	return nil
+}
+
+// DecommissionSSHHostRequest represents the body of a request to decommission
+// a host in the SSH host inventory.
+type DecommissionSSHHostRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// GetSSHHostsResponse is the response for a list of hosts in the SSH host
+// inventory.
+type GetSSHHostsResponse struct {
+	Hosts []*db.SSHHost `json:"hosts"`
+}
+
+// GetSSHHost returns a host in the SSH host inventory.
+func GetSSHHost(w http.ResponseWriter, r *http.Request) {
+	hostname := chi.URLParam(r, "hostname")
+
+	host, err := mustAuthority(r.Context()).GetSSHInventoryHost(r.Context(), hostname)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving ssh host %s", hostname))
+		return
+	}
+	render.JSON(w, r, host)
+}
+
+// GetSSHHosts returns the hosts in the SSH host inventory. Hosts can be
+// filtered by the tag and group query parameters. A tag can be given as a
+// name or as a name=value pair.
+func GetSSHHosts(w http.ResponseWriter, r *http.Request) {
+	hosts, err := mustAuthority(r.Context()).GetSSHInventoryHosts(r.Context())
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving ssh hosts"))
+		return
+	}
+
+	query := r.URL.Query()
+	tags, groups := query["tag"], query["group"]
+	filtered := []*db.SSHHost{}
+	for _, h := range hosts {
+		if matchSSHHost(h, tags, groups) {
+			filtered = append(filtered, h)
+		}
+	}
+	render.JSON(w, r, &GetSSHHostsResponse{
+		Hosts: filtered,
+	})
+}
+
+// CreateSSHHost adds a host to the SSH host inventory.
+func CreateSSHHost(w http.ResponseWriter, r *http.Request) {
+	var body SSHHostRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	host, err := mustAuthority(r.Context()).CreateSSHInventoryHost(r.Context(), &db.SSHHost{
+		Hostname: body.Hostname,
+		Tags:     body.Tags,
+		Groups:   body.Groups,
+	})
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error creating ssh host %s", body.Hostname))
+		return
+	}
+	render.JSONStatus(w, r, host, http.StatusCreated)
+}
+
+// UpdateSSHHost replaces the tags and groups of a host in the SSH host
+// inventory.
+func UpdateSSHHost(w http.ResponseWriter, r *http.Request) {
+	var body SSHHostRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	hostname := chi.URLParam(r, "hostname")
+	if body.Hostname == "" {
+		body.Hostname = hostname
+	}
+	if err := body.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	if !strings.EqualFold(body.Hostname, hostname) {
+		render.Error(w, r, admin.NewError(admin.ErrorBadRequestType, "hostname cannot be changed"))
+		return
+	}
+
+	host, err := mustAuthority(r.Context()).UpdateSSHInventoryHost(r.Context(), &db.SSHHost{
+		Hostname: hostname,
+		Tags:     body.Tags,
+		Groups:   body.Groups,
+	})
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error updating ssh host %s", hostname))
+		return
+	}
+	render.JSON(w, r, host)
+}
+
+// DeleteSSHHost removes a host from the SSH host inventory.
+func DeleteSSHHost(w http.ResponseWriter, r *http.Request) {
+	hostname := chi.URLParam(r, "hostname")
+
+	if err := mustAuthority(r.Context()).RemoveSSHInventoryHost(r.Context(), hostname); err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error deleting ssh host %s", hostname))
+		return
+	}
+	render.JSON(w, r, &DeleteResponse{Status: "ok"})
+}
+
+// DecommissionSSHHost marks a host in the SSH host inventory as
+// decommissioned and revokes its host certificates.
+func DecommissionSSHHost(w http.ResponseWriter, r *http.Request) {
+	var body DecommissionSSHHostRequest
+	if r.ContentLength != 0 {
+		if err := read.JSON(r.Body, &body); err != nil {
+			render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+			return
+		}
+	}
+
+	hostname := chi.URLParam(r, "hostname")
+	host, err := mustAuthority(r.Context()).DecommissionSSHInventoryHost(r.Context(), hostname, body.Reason)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error decommissioning ssh host %s", hostname))
+		return
+	}
+	render.JSON(w, r, host)
+}
+
+// matchSSHHost returns true if the host has all the given tags and belongs to
+// all the given groups.
+func matchSSHHost(h *db.SSHHost, tags, groups []string) bool {
+	for _, t := range tags {
+		name, value, hasValue := strings.Cut(t, "=")
+		v, ok := h.Tags[name]
+		if !ok || (hasValue && v != value) {
+			return false
+		}
+	}
+	for _, g := range groups {
+		if !slices.Contains(h.Groups, g) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+func newSSHHostRequest(method, target string, body []byte, hostname string) *http.Request {
+	chiCtx := chi.NewRouteContext()
+	if hostname != "" {
+		chiCtx.URLParams.Add("hostname", hostname)
+	}
+	ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+	return httptest.NewRequest(method, target, bytes.NewReader(body)).WithContext(ctx)
+}
+
+func TestSSHHostRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     *SSHHostRequest
+		wantErr string
+	}{
+		{"ok", &SSHHostRequest{Hostname: "db1.example.com", Tags: map[string]string{"env": "prod"}, Groups: []string{"databases"}}, ""},
+		{"fail/hostname empty", &SSHHostRequest{}, "hostname cannot be empty"},
+		{"fail/hostname", &SSHHostRequest{Hostname: "db1/example"}, `hostname "db1/example" is not valid`},
+		{"fail/tag", &SSHHostRequest{Hostname: "db1", Tags: map[string]string{"": "prod"}}, "tag names cannot be empty"},
+		{"fail/group", &SSHHostRequest{Hostname: "db1", Groups: []string{""}}, "groups cannot contain empty values"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestGetSSHHosts(t *testing.T) {
+	hosts := []*db.SSHHost{
+		{ID: "1", Hostname: "db1.example.com", Tags: map[string]string{"env": "prod", "role": "db"}, Groups: []string{"databases"}},
+		{ID: "2", Hostname: "db2.example.com", Tags: map[string]string{"env": "dev", "role": "db"}, Groups: []string{"databases"}},
+		{ID: "3", Hostname: "web1.example.com", Tags: map[string]string{"env": "prod"}},
+	}
+	mockMustAuthority(t, &mockAdminAuthority{
+		MockGetSSHInventoryHosts: func(ctx context.Context) ([]*db.SSHHost, error) {
+			return hosts, nil
+		},
+	})
+
+	tests := []struct {
+		name    string
+		query   string
+		wantIDs []string
+	}{
+		{"ok/all", "", []string{"1", "2", "3"}},
+		{"ok/tag", "?tag=role", []string{"1", "2"}},
+		{"ok/tag value", "?tag=env=prod", []string{"1", "3"}},
+		{"ok/group", "?group=databases", []string{"1", "2"}},
+		{"ok/tag and group", "?tag=env=prod&group=databases", []string{"1"}},
+		{"ok/none", "?group=web", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			GetSSHHosts(w, newSSHHostRequest("GET", "/ssh/hosts"+tt.query, nil, ""))
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var resp GetSSHHostsResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			ids := []string{}
+			for _, h := range resp.Hosts {
+				ids = append(ids, h.ID)
+			}
+			assert.Equal(t, tt.wantIDs, ids)
+		})
+	}
+}
+
+func TestCreateSSHHost(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		err      error
+		wantCode int
+	}{
+		{"ok", `{"hostname":"db1.example.com","tags":{"env":"prod"},"groups":["databases"]}`, nil, http.StatusCreated},
+		{"fail/json", `{`, nil, http.StatusBadRequest},
+		{"fail/validate", `{"tags":{"env":"prod"}}`, nil, http.StatusBadRequest},
+		{"fail/conflict", `{"hostname":"db1.example.com"}`, admin.NewError(admin.ErrorConflictType, "ssh host db1.example.com already exists"), http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAdminAuthority{
+				MockCreateSSHInventoryHost: func(ctx context.Context, host *db.SSHHost) (*db.SSHHost, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					assert.Equal(t, "db1.example.com", host.Hostname)
+					assert.Equal(t, map[string]string{"env": "prod"}, host.Tags)
+					assert.Equal(t, []string{"databases"}, host.Groups)
+					host.ID = "1"
+					return host, nil
+				},
+			})
+			w := httptest.NewRecorder()
+			CreateSSHHost(w, newSSHHostRequest("POST", "/ssh/hosts", []byte(tt.body), ""))
+			require.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode == http.StatusCreated {
+				var host db.SSHHost
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &host))
+				assert.Equal(t, "1", host.ID)
+			}
+		})
+	}
+}
+
+func TestUpdateSSHHost(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{"ok", `{"tags":{"env":"dev"}}`, http.StatusOK},
+		{"ok/hostname", `{"hostname":"DB1.example.com","tags":{"env":"dev"}}`, http.StatusOK},
+		{"fail/hostname", `{"hostname":"db2.example.com","tags":{"env":"dev"}}`, http.StatusBadRequest},
+		{"fail/json", `{`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAdminAuthority{
+				MockUpdateSSHInventoryHost: func(ctx context.Context, host *db.SSHHost) (*db.SSHHost, error) {
+					assert.Equal(t, "db1.example.com", host.Hostname)
+					assert.Equal(t, map[string]string{"env": "dev"}, host.Tags)
+					return host, nil
+				},
+			})
+			w := httptest.NewRecorder()
+			UpdateSSHHost(w, newSSHHostRequest("PUT", "/ssh/hosts/db1.example.com", []byte(tt.body), "db1.example.com"))
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
+
+func TestDeleteSSHHost(t *testing.T) {
+	mockMustAuthority(t, &mockAdminAuthority{
+		MockRemoveSSHInventoryHost: func(ctx context.Context, hostname string) error {
+			if hostname == "missing" {
+				return admin.NewError(admin.ErrorNotFoundType, "ssh host missing not found")
+			}
+			return nil
+		},
+	})
+
+	w := httptest.NewRecorder()
+	DeleteSSHHost(w, newSSHHostRequest("DELETE", "/ssh/hosts/db1", nil, "db1"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	DeleteSSHHost(w, newSSHHostRequest("DELETE", "/ssh/hosts/missing", nil, "missing"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDecommissionSSHHost(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		name       string
+		body       []byte
+		wantReason string
+		wantCode   int
+	}{
+		{"ok", nil, "", http.StatusOK},
+		{"ok/reason", []byte(`{"reason":"hardware failure"}`), "hardware failure", http.StatusOK},
+		{"fail/json", []byte(`{`), "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAdminAuthority{
+				MockDecommissionSSHInventoryHost: func(ctx context.Context, hostname, reason string) (*db.SSHHost, error) {
+					assert.Equal(t, "db1", hostname)
+					assert.Equal(t, tt.wantReason, reason)
+					return &db.SSHHost{ID: "1", Hostname: hostname, DecommissionedAt: now}, nil
+				},
+			})
+			w := httptest.NewRecorder()
+			DecommissionSSHHost(w, newSSHHostRequest("POST", "/ssh/hosts/db1/decommission", tt.body, "db1"))
+			require.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode == http.StatusOK {
+				var host db.SSHHost
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &host))
+				assert.True(t, host.IsDecommissioned())
+			}
+		})
+	}
+}
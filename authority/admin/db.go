@@ -7,6 +7,8 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/linkedca"
+
+	"github.com/smallstep/certificates/authority/policy"
 )
 
 const (
@@ -76,6 +78,27 @@ type DB interface {
 	DeleteAuthorityPolicy(ctx context.Context) error
 }
 
+// SSHOptionsPolicyDB is the interface implemented by admin databases that
+// can store SSH critical options and extensions policies. The linkedca
+// policies don't support them, so they're stored by provisioner ID, where
+// an empty provisioner ID refers to the authority policy.
+type SSHOptionsPolicyDB interface {
+	GetSSHOptionsPolicy(ctx context.Context, provisionerID string) (*policy.SSHOptionsPolicy, error)
+	GetSSHOptionsPolicies(ctx context.Context) (map[string]*policy.SSHOptionsPolicy, error)
+	UpdateSSHOptionsPolicy(ctx context.Context, provisionerID string, p *policy.SSHOptionsPolicy) error
+	DeleteSSHOptionsPolicy(ctx context.Context, provisionerID string) error
+}
+
+// CELPolicyDB is the interface implemented by admin databases that can store
+// CEL policies. The linkedca policies don't support them, so they're stored
+// by scope, where the zero scope refers to the authority policy.
+type CELPolicyDB interface {
+	GetCELPolicy(ctx context.Context, scope policy.CELPolicyScope) (*policy.CELPolicy, error)
+	GetCELPolicies(ctx context.Context) (map[policy.CELPolicyScope]*policy.CELPolicy, error)
+	UpdateCELPolicy(ctx context.Context, scope policy.CELPolicyScope, p *policy.CELPolicy) error
+	DeleteCELPolicy(ctx context.Context, scope policy.CELPolicyScope) error
+}
+
 type dbKey struct{}
 
 // NewContext adds the given admin database to the context.
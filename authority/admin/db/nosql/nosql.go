@@ -11,9 +11,11 @@ import (
 )
 
 var (
-	adminsTable            = []byte("admins")
-	provisionersTable      = []byte("provisioners")
-	authorityPoliciesTable = []byte("authority_policies")
+	adminsTable             = []byte("admins")
+	provisionersTable       = []byte("provisioners")
+	authorityPoliciesTable  = []byte("authority_policies")
+	sshOptionsPoliciesTable = []byte("ssh_options_policies")
+	celPoliciesTable        = []byte("cel_policies")
 )
 
 // DB is a struct that implements the AdminDB interface.
@@ -24,7 +26,7 @@ type DB struct {
 
 // New configures and returns a new Authority DB backend implemented using a nosql DB.
 func New(db nosqlDB.DB, authorityID string) (*DB, error) {
-	tables := [][]byte{adminsTable, provisionersTable, authorityPoliciesTable}
+	tables := [][]byte{adminsTable, provisionersTable, authorityPoliciesTable, sshOptionsPoliciesTable, celPoliciesTable}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
 			return nil, errors.Wrapf(err, "error creating table %s",
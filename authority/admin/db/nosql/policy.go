@@ -3,11 +3,13 @@ package nosql
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/smallstep/linkedca"
 
 	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/nosql"
 )
 
@@ -337,3 +339,228 @@ func linkedToDB(p *linkedca.Policy) *dbPolicy {
 
 	return r
 }
+
+type dbSSHOptionsPolicy struct {
+	ID            string                   `json:"id"`
+	AuthorityID   string                   `json:"authorityID"`
+	ProvisionerID string                   `json:"provisionerID,omitempty"`
+	Policy        *policy.SSHOptionsPolicy `json:"policy,omitempty"`
+}
+
+// sshOptionsPolicyKey returns the key of the SSH options policy of a
+// provisioner, or the key of the authority policy if the provisioner ID is
+// empty.
+func (db *DB) sshOptionsPolicyKey(provisionerID string) string {
+	if provisionerID == "" {
+		return db.authorityID
+	}
+	return provisionerID
+}
+
+func (db *DB) getDBSSHOptionsPolicy(_ context.Context, provisionerID string) (*dbSSHOptionsPolicy, error) {
+	data, err := db.db.Get(sshOptionsPoliciesTable, []byte(db.sshOptionsPolicyKey(provisionerID)))
+	if nosql.IsErrNotFound(err) {
+		return nil, admin.NewError(admin.ErrorNotFoundType, "ssh options policy not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("error loading ssh options policy: %w", err)
+	}
+	var dbp = new(dbSSHOptionsPolicy)
+	if err := json.Unmarshal(data, dbp); err != nil {
+		return nil, fmt.Errorf("error unmarshaling ssh options policy bytes into dbSSHOptionsPolicy: %w", err)
+	}
+	if dbp.AuthorityID != db.authorityID {
+		return nil, admin.NewError(admin.ErrorAuthorityMismatchType,
+			"ssh options policy is not owned by authority %s", db.authorityID)
+	}
+	return dbp, nil
+}
+
+// GetSSHOptionsPolicy retrieves the SSH critical options and extensions
+// policy of a provisioner, or of the authority if the provisioner ID is
+// empty.
+func (db *DB) GetSSHOptionsPolicy(ctx context.Context, provisionerID string) (*policy.SSHOptionsPolicy, error) {
+	dbp, err := db.getDBSSHOptionsPolicy(ctx, provisionerID)
+	if err != nil {
+		return nil, err
+	}
+	return dbp.Policy, nil
+}
+
+// GetSSHOptionsPolicies retrieves all the SSH critical options and extensions
+// policies of the authority by provisioner ID. The authority policy uses an
+// empty provisioner ID.
+func (db *DB) GetSSHOptionsPolicies(context.Context) (map[string]*policy.SSHOptionsPolicy, error) {
+	dbEntries, err := db.db.List(sshOptionsPoliciesTable)
+	if err != nil {
+		return nil, fmt.Errorf("error loading ssh options policies: %w", err)
+	}
+	policies := make(map[string]*policy.SSHOptionsPolicy)
+	for _, entry := range dbEntries {
+		var dbp = new(dbSSHOptionsPolicy)
+		if err := json.Unmarshal(entry.Value, dbp); err != nil {
+			return nil, fmt.Errorf("error unmarshaling ssh options policy bytes into dbSSHOptionsPolicy: %w", err)
+		}
+		if dbp.AuthorityID != db.authorityID {
+			continue
+		}
+		policies[dbp.ProvisionerID] = dbp.Policy
+	}
+	return policies, nil
+}
+
+// UpdateSSHOptionsPolicy creates or replaces the SSH critical options and
+// extensions policy of a provisioner, or of the authority if the provisioner
+// ID is empty.
+func (db *DB) UpdateSSHOptionsPolicy(ctx context.Context, provisionerID string, p *policy.SSHOptionsPolicy) error {
+	// the old value must be an untyped nil if the policy doesn't exist yet
+	var old interface{}
+	var ae *admin.Error
+	switch dbp, err := db.getDBSSHOptionsPolicy(ctx, provisionerID); {
+	case err == nil:
+		old = dbp
+	case !errors.As(err, &ae) || !ae.IsType(admin.ErrorNotFoundType):
+		return err
+	}
+
+	dbp := &dbSSHOptionsPolicy{
+		ID:            db.sshOptionsPolicyKey(provisionerID),
+		AuthorityID:   db.authorityID,
+		ProvisionerID: provisionerID,
+		Policy:        p,
+	}
+
+	if err := db.save(ctx, dbp.ID, dbp, old, "ssh_options_policy", sshOptionsPoliciesTable); err != nil {
+		return admin.WrapErrorISE(err, "error updating ssh options policy")
+	}
+
+	return nil
+}
+
+// DeleteSSHOptionsPolicy deletes the SSH critical options and extensions
+// policy of a provisioner, or of the authority if the provisioner ID is
+// empty.
+func (db *DB) DeleteSSHOptionsPolicy(ctx context.Context, provisionerID string) error {
+	old, err := db.getDBSSHOptionsPolicy(ctx, provisionerID)
+	if err != nil {
+		return err
+	}
+
+	if err := db.save(ctx, old.ID, nil, old, "ssh_options_policy", sshOptionsPoliciesTable); err != nil {
+		return admin.WrapErrorISE(err, "error deleting ssh options policy")
+	}
+
+	return nil
+}
+
+type dbCELPolicy struct {
+	ID            string            `json:"id"`
+	AuthorityID   string            `json:"authorityID"`
+	ProvisionerID string            `json:"provisionerID,omitempty"`
+	ACMEAccountID string            `json:"acmeAccountID,omitempty"`
+	Policy        *policy.CELPolicy `json:"policy,omitempty"`
+}
+
+// celPolicyKey returns the key of the CEL policy of a scope. The authority
+// policy uses the authority ID, and ACME account policies are namespaced by
+// provisioner ID.
+func (db *DB) celPolicyKey(scope policy.CELPolicyScope) string {
+	switch {
+	case scope.ProvisionerID == "":
+		return db.authorityID
+	case scope.ACMEAccountID == "":
+		return scope.ProvisionerID
+	default:
+		return scope.ProvisionerID + "/" + scope.ACMEAccountID
+	}
+}
+
+func (db *DB) getDBCELPolicy(_ context.Context, scope policy.CELPolicyScope) (*dbCELPolicy, error) {
+	data, err := db.db.Get(celPoliciesTable, []byte(db.celPolicyKey(scope)))
+	if nosql.IsErrNotFound(err) {
+		return nil, admin.NewError(admin.ErrorNotFoundType, "cel policy not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("error loading cel policy: %w", err)
+	}
+	var dbp = new(dbCELPolicy)
+	if err := json.Unmarshal(data, dbp); err != nil {
+		return nil, fmt.Errorf("error unmarshaling cel policy bytes into dbCELPolicy: %w", err)
+	}
+	if dbp.AuthorityID != db.authorityID {
+		return nil, admin.NewError(admin.ErrorAuthorityMismatchType,
+			"cel policy is not owned by authority %s", db.authorityID)
+	}
+	return dbp, nil
+}
+
+// GetCELPolicy retrieves the CEL policy of a scope.
+func (db *DB) GetCELPolicy(ctx context.Context, scope policy.CELPolicyScope) (*policy.CELPolicy, error) {
+	dbp, err := db.getDBCELPolicy(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+	return dbp.Policy, nil
+}
+
+// GetCELPolicies retrieves all the CEL policies of the authority by scope.
+func (db *DB) GetCELPolicies(context.Context) (map[policy.CELPolicyScope]*policy.CELPolicy, error) {
+	dbEntries, err := db.db.List(celPoliciesTable)
+	if err != nil {
+		return nil, fmt.Errorf("error loading cel policies: %w", err)
+	}
+	policies := make(map[policy.CELPolicyScope]*policy.CELPolicy)
+	for _, entry := range dbEntries {
+		var dbp = new(dbCELPolicy)
+		if err := json.Unmarshal(entry.Value, dbp); err != nil {
+			return nil, fmt.Errorf("error unmarshaling cel policy bytes into dbCELPolicy: %w", err)
+		}
+		if dbp.AuthorityID != db.authorityID {
+			continue
+		}
+		policies[policy.CELPolicyScope{
+			ProvisionerID: dbp.ProvisionerID,
+			ACMEAccountID: dbp.ACMEAccountID,
+		}] = dbp.Policy
+	}
+	return policies, nil
+}
+
+// UpdateCELPolicy creates or replaces the CEL policy of a scope.
+func (db *DB) UpdateCELPolicy(ctx context.Context, scope policy.CELPolicyScope, p *policy.CELPolicy) error {
+	// the old value must be an untyped nil if the policy doesn't exist yet
+	var old interface{}
+	var ae *admin.Error
+	switch dbp, err := db.getDBCELPolicy(ctx, scope); {
+	case err == nil:
+		old = dbp
+	case !errors.As(err, &ae) || !ae.IsType(admin.ErrorNotFoundType):
+		return err
+	}
+
+	dbp := &dbCELPolicy{
+		ID:            db.celPolicyKey(scope),
+		AuthorityID:   db.authorityID,
+		ProvisionerID: scope.ProvisionerID,
+		ACMEAccountID: scope.ACMEAccountID,
+		Policy:        p,
+	}
+
+	if err := db.save(ctx, dbp.ID, dbp, old, "cel_policy", celPoliciesTable); err != nil {
+		return admin.WrapErrorISE(err, "error updating cel policy")
+	}
+
+	return nil
+}
+
+// DeleteCELPolicy deletes the CEL policy of a scope.
+func (db *DB) DeleteCELPolicy(ctx context.Context, scope policy.CELPolicyScope) error {
+	old, err := db.getDBCELPolicy(ctx, scope)
+	if err != nil {
+		return err
+	}
+
+	if err := db.save(ctx, old.ID, nil, old, "cel_policy", celPoliciesTable); err != nil {
+		return admin.WrapErrorISE(err, "error deleting cel policy")
+	}
+
+	return nil
+}
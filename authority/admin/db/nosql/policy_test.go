@@ -9,6 +9,7 @@ import (
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/linkedca"
 	"github.com/smallstep/nosql"
@@ -1204,3 +1205,597 @@ func Test_dbToLinked(t *testing.T) {
 		})
 	}
 }
+
+func TestDB_GetSSHOptionsPolicy(t *testing.T) {
+	authID := "authID"
+	type test struct {
+		ctx           context.Context
+		authorityID   string
+		provisionerID string
+		db            nosql.DB
+		err           error
+		adminErr      *admin.Error
+		policy        *policy.SSHOptionsPolicy
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/not-found": func(t *testing.T) test {
+			return test{
+				ctx:         context.Background(),
+				authorityID: authID,
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, sshOptionsPoliciesTable)
+						assert.Equals(t, string(key), authID)
+						return nil, nosqldb.ErrNotFound
+					},
+				},
+				adminErr: admin.NewError(admin.ErrorNotFoundType, "ssh options policy not found"),
+			}
+		},
+		"fail/db.Get-error": func(t *testing.T) test {
+			return test{
+				ctx:         context.Background(),
+				authorityID: authID,
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading ssh options policy: force"),
+			}
+		},
+		"fail/authority-mismatch": func(t *testing.T) test {
+			return test{
+				ctx:           context.Background(),
+				authorityID:   authID,
+				provisionerID: "provID",
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, sshOptionsPoliciesTable)
+						assert.Equals(t, string(key), "provID")
+						b, err := json.Marshal(&dbSSHOptionsPolicy{
+							ID:            "provID",
+							AuthorityID:   "otherAuthID",
+							ProvisionerID: "provID",
+						})
+						assert.FatalError(t, err)
+						return b, nil
+					},
+				},
+				adminErr: admin.NewError(admin.ErrorAuthorityMismatchType, "ssh options policy is not owned by authority authID"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			p := &policy.SSHOptionsPolicy{
+				User: &policy.SSHCertificateOptionsPolicy{
+					CriticalOptions: &policy.SSHCriticalOptions{
+						ForceCommands: []string{"/usr/bin/backup"},
+					},
+				},
+			}
+			return test{
+				ctx:           context.Background(),
+				authorityID:   authID,
+				provisionerID: "provID",
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, sshOptionsPoliciesTable)
+						assert.Equals(t, string(key), "provID")
+						b, err := json.Marshal(&dbSSHOptionsPolicy{
+							ID:            "provID",
+							AuthorityID:   authID,
+							ProvisionerID: "provID",
+							Policy:        p,
+						})
+						assert.FatalError(t, err)
+						return b, nil
+					},
+				},
+				policy: p,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db, authorityID: tc.authorityID}
+			p, err := d.GetSSHOptionsPolicy(tc.ctx, tc.provisionerID)
+			if err != nil {
+				var ae *admin.Error
+				if errors.As(err, &ae) {
+					if assert.NotNil(t, tc.adminErr) {
+						assert.Equals(t, ae.Type, tc.adminErr.Type)
+						assert.Equals(t, ae.Detail, tc.adminErr.Detail)
+						assert.Equals(t, ae.Status, tc.adminErr.Status)
+						assert.Equals(t, ae.Err.Error(), tc.adminErr.Err.Error())
+					}
+				} else {
+					if assert.NotNil(t, tc.err) {
+						assert.HasPrefix(t, err.Error(), tc.err.Error())
+					}
+				}
+				return
+			}
+			assert.Equals(t, tc.policy, p)
+		})
+	}
+}
+
+func TestDB_GetSSHOptionsPolicies(t *testing.T) {
+	authID := "authID"
+	authorityPolicy := &policy.SSHOptionsPolicy{
+		Host: &policy.SSHCertificateOptionsPolicy{
+			Extensions: &policy.SSHExtensionOptions{Deny: []string{"permit-pty"}},
+		},
+	}
+	provisionerPolicy := &policy.SSHOptionsPolicy{
+		User: &policy.SSHCertificateOptionsPolicy{
+			CriticalOptions: &policy.SSHCriticalOptions{Require: []string{"verify-required"}},
+		},
+	}
+	marshal := func(t *testing.T, v *dbSSHOptionsPolicy) []byte {
+		b, err := json.Marshal(v)
+		assert.FatalError(t, err)
+		return b
+	}
+	type test struct {
+		db   nosql.DB
+		err  error
+		want map[string]*policy.SSHOptionsPolicy
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/db.List-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+						assert.Equals(t, bucket, sshOptionsPoliciesTable)
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading ssh options policies: force"),
+			}
+		},
+		"fail/unmarshal-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+						return []*nosqldb.Entry{{Bucket: bucket, Key: []byte(authID), Value: []byte("foo")}}, nil
+					},
+				},
+				err: errors.New("error unmarshaling ssh options policy bytes into dbSSHOptionsPolicy"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+						return []*nosqldb.Entry{
+							{Bucket: bucket, Key: []byte(authID), Value: marshal(t, &dbSSHOptionsPolicy{
+								ID: authID, AuthorityID: authID, Policy: authorityPolicy,
+							})},
+							{Bucket: bucket, Key: []byte("provID"), Value: marshal(t, &dbSSHOptionsPolicy{
+								ID: "provID", AuthorityID: authID, ProvisionerID: "provID", Policy: provisionerPolicy,
+							})},
+							{Bucket: bucket, Key: []byte("otherProvID"), Value: marshal(t, &dbSSHOptionsPolicy{
+								ID: "otherProvID", AuthorityID: "otherAuthID", ProvisionerID: "otherProvID", Policy: provisionerPolicy,
+							})},
+						}, nil
+					},
+				},
+				want: map[string]*policy.SSHOptionsPolicy{
+					"":       authorityPolicy,
+					"provID": provisionerPolicy,
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db, authorityID: authID}
+			got, err := d.GetSSHOptionsPolicies(context.Background())
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			assert.Nil(t, tc.err)
+			assert.Equals(t, tc.want, got)
+		})
+	}
+}
+
+func TestDB_UpdateSSHOptionsPolicy(t *testing.T) {
+	authID := "authID"
+	p := &policy.SSHOptionsPolicy{
+		User: &policy.SSHCertificateOptionsPolicy{
+			CriticalOptions: &policy.SSHCriticalOptions{SourceAddresses: []string{"10.0.0.0/8"}},
+		},
+	}
+	type test struct {
+		provisionerID string
+		db            nosql.DB
+		err           error
+		adminErr      *admin.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/db.Get-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading ssh options policy: force"),
+			}
+		},
+		"fail/save-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, nosqldb.ErrNotFound
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return nil, false, errors.New("force")
+					},
+				},
+				adminErr: admin.NewErrorISE("error updating ssh options policy: error saving authority ssh_options_policy: force"),
+			}
+		},
+		"ok/create": func(t *testing.T) test {
+			return test{
+				provisionerID: "provID",
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, sshOptionsPoliciesTable)
+						assert.Equals(t, string(key), "provID")
+						return nil, nosqldb.ErrNotFound
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, sshOptionsPoliciesTable)
+						assert.Equals(t, string(key), "provID")
+						assert.Equals(t, old, nil)
+
+						var dbp = new(dbSSHOptionsPolicy)
+						assert.FatalError(t, json.Unmarshal(nu, dbp))
+						assert.Equals(t, dbp, &dbSSHOptionsPolicy{
+							ID:            "provID",
+							AuthorityID:   authID,
+							ProvisionerID: "provID",
+							Policy:        p,
+						})
+
+						return nil, true, nil
+					},
+				},
+			}
+		},
+		"ok/replace": func(t *testing.T) test {
+			oldDBP := &dbSSHOptionsPolicy{ID: authID, AuthorityID: authID}
+			oldB, err := json.Marshal(oldDBP)
+			assert.FatalError(t, err)
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, sshOptionsPoliciesTable)
+						assert.Equals(t, string(key), authID)
+						return oldB, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, sshOptionsPoliciesTable)
+						assert.Equals(t, string(key), authID)
+						assert.Equals(t, old, oldB)
+
+						var dbp = new(dbSSHOptionsPolicy)
+						assert.FatalError(t, json.Unmarshal(nu, dbp))
+						assert.Equals(t, dbp, &dbSSHOptionsPolicy{
+							ID:          authID,
+							AuthorityID: authID,
+							Policy:      p,
+						})
+
+						return nil, true, nil
+					},
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db, authorityID: authID}
+			if err := d.UpdateSSHOptionsPolicy(context.Background(), tc.provisionerID, p); err != nil {
+				var ae *admin.Error
+				if errors.As(err, &ae) {
+					if assert.NotNil(t, tc.adminErr) {
+						assert.Equals(t, ae.Type, tc.adminErr.Type)
+						assert.Equals(t, ae.Detail, tc.adminErr.Detail)
+						assert.Equals(t, ae.Status, tc.adminErr.Status)
+						assert.Equals(t, ae.Err.Error(), tc.adminErr.Err.Error())
+					}
+				} else {
+					if assert.NotNil(t, tc.err) {
+						assert.HasPrefix(t, err.Error(), tc.err.Error())
+					}
+				}
+				return
+			}
+			assert.Nil(t, tc.err)
+			assert.Nil(t, tc.adminErr)
+		})
+	}
+}
+
+func TestDB_DeleteSSHOptionsPolicy(t *testing.T) {
+	authID := "authID"
+	t.Run("fail/not-found", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, nosqldb.ErrNotFound
+			},
+		}, authorityID: authID}
+		err := d.DeleteSSHOptionsPolicy(context.Background(), "provID")
+		var ae *admin.Error
+		if assert.True(t, errors.As(err, &ae)) {
+			assert.Equals(t, ae.Type, admin.ErrorNotFoundType.String())
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		oldB, err := json.Marshal(&dbSSHOptionsPolicy{ID: "provID", AuthorityID: authID, ProvisionerID: "provID"})
+		assert.FatalError(t, err)
+		d := DB{db: &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, sshOptionsPoliciesTable)
+				assert.Equals(t, string(key), "provID")
+				return oldB, nil
+			},
+			MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, sshOptionsPoliciesTable)
+				assert.Equals(t, string(key), "provID")
+				assert.Equals(t, old, oldB)
+				assert.Equals(t, nil, nu)
+				return nil, true, nil
+			},
+		}, authorityID: authID}
+		assert.FatalError(t, d.DeleteSSHOptionsPolicy(context.Background(), "provID"))
+	})
+}
+
+func TestDB_GetCELPolicies(t *testing.T) {
+	authID := "authID"
+	authorityPolicy := &policy.CELPolicy{
+		X509: []policy.CELRule{{Name: "max-sans", Expression: "size(cert.sans) <= 5"}},
+	}
+	accountPolicy := &policy.CELPolicy{
+		SSH: []policy.CELRule{{Name: "user", Expression: `cert.type == "user"`}},
+	}
+	marshal := func(t *testing.T, v *dbCELPolicy) []byte {
+		b, err := json.Marshal(v)
+		assert.FatalError(t, err)
+		return b
+	}
+	type test struct {
+		db   nosql.DB
+		err  error
+		want map[policy.CELPolicyScope]*policy.CELPolicy
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/db.List-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+						assert.Equals(t, bucket, celPoliciesTable)
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading cel policies: force"),
+			}
+		},
+		"fail/unmarshal-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+						return []*nosqldb.Entry{{Bucket: bucket, Key: []byte(authID), Value: []byte("foo")}}, nil
+					},
+				},
+				err: errors.New("error unmarshaling cel policy bytes into dbCELPolicy"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+						return []*nosqldb.Entry{
+							{Bucket: bucket, Key: []byte(authID), Value: marshal(t, &dbCELPolicy{
+								ID: authID, AuthorityID: authID, Policy: authorityPolicy,
+							})},
+							{Bucket: bucket, Key: []byte("provID/accID"), Value: marshal(t, &dbCELPolicy{
+								ID: "provID/accID", AuthorityID: authID, ProvisionerID: "provID", ACMEAccountID: "accID", Policy: accountPolicy,
+							})},
+							{Bucket: bucket, Key: []byte("otherProvID"), Value: marshal(t, &dbCELPolicy{
+								ID: "otherProvID", AuthorityID: "otherAuthID", ProvisionerID: "otherProvID", Policy: accountPolicy,
+							})},
+						}, nil
+					},
+				},
+				want: map[policy.CELPolicyScope]*policy.CELPolicy{
+					{}: authorityPolicy,
+					{ProvisionerID: "provID", ACMEAccountID: "accID"}: accountPolicy,
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db, authorityID: authID}
+			got, err := d.GetCELPolicies(context.Background())
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			assert.Nil(t, tc.err)
+			assert.Equals(t, tc.want, got)
+		})
+	}
+}
+
+func TestDB_UpdateCELPolicy(t *testing.T) {
+	authID := "authID"
+	p := &policy.CELPolicy{
+		X509: []policy.CELRule{{Name: "max-sans", Expression: "size(cert.sans) <= 5", Message: "too many names"}},
+	}
+	type test struct {
+		scope    policy.CELPolicyScope
+		db       nosql.DB
+		err      error
+		adminErr *admin.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/db.Get-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading cel policy: force"),
+			}
+		},
+		"fail/save-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, nosqldb.ErrNotFound
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return nil, false, errors.New("force")
+					},
+				},
+				adminErr: admin.NewErrorISE("error updating cel policy: error saving authority cel_policy: force"),
+			}
+		},
+		"ok/create-account": func(t *testing.T) test {
+			return test{
+				scope: policy.CELPolicyScope{ProvisionerID: "provID", ACMEAccountID: "accID"},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, celPoliciesTable)
+						assert.Equals(t, string(key), "provID/accID")
+						return nil, nosqldb.ErrNotFound
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, celPoliciesTable)
+						assert.Equals(t, string(key), "provID/accID")
+						assert.Equals(t, old, nil)
+
+						var dbp = new(dbCELPolicy)
+						assert.FatalError(t, json.Unmarshal(nu, dbp))
+						assert.Equals(t, dbp, &dbCELPolicy{
+							ID:            "provID/accID",
+							AuthorityID:   authID,
+							ProvisionerID: "provID",
+							ACMEAccountID: "accID",
+							Policy:        p,
+						})
+
+						return nil, true, nil
+					},
+				},
+			}
+		},
+		"ok/replace-provisioner": func(t *testing.T) test {
+			oldDBP := &dbCELPolicy{ID: "provID", AuthorityID: authID, ProvisionerID: "provID"}
+			oldB, err := json.Marshal(oldDBP)
+			assert.FatalError(t, err)
+			return test{
+				scope: policy.CELPolicyScope{ProvisionerID: "provID"},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, celPoliciesTable)
+						assert.Equals(t, string(key), "provID")
+						return oldB, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, celPoliciesTable)
+						assert.Equals(t, string(key), "provID")
+						assert.Equals(t, old, oldB)
+
+						var dbp = new(dbCELPolicy)
+						assert.FatalError(t, json.Unmarshal(nu, dbp))
+						assert.Equals(t, dbp, &dbCELPolicy{
+							ID:            "provID",
+							AuthorityID:   authID,
+							ProvisionerID: "provID",
+							Policy:        p,
+						})
+
+						return nil, true, nil
+					},
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db, authorityID: authID}
+			if err := d.UpdateCELPolicy(context.Background(), tc.scope, p); err != nil {
+				var ae *admin.Error
+				if errors.As(err, &ae) {
+					if assert.NotNil(t, tc.adminErr) {
+						assert.Equals(t, ae.Type, tc.adminErr.Type)
+						assert.Equals(t, ae.Detail, tc.adminErr.Detail)
+						assert.Equals(t, ae.Status, tc.adminErr.Status)
+						assert.Equals(t, ae.Err.Error(), tc.adminErr.Err.Error())
+					}
+				} else {
+					if assert.NotNil(t, tc.err) {
+						assert.HasPrefix(t, err.Error(), tc.err.Error())
+					}
+				}
+				return
+			}
+			assert.Nil(t, tc.err)
+			assert.Nil(t, tc.adminErr)
+		})
+	}
+}
+
+func TestDB_DeleteCELPolicy(t *testing.T) {
+	authID := "authID"
+	t.Run("fail/not-found", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, nosqldb.ErrNotFound
+			},
+		}, authorityID: authID}
+		err := d.DeleteCELPolicy(context.Background(), policy.CELPolicyScope{})
+		var ae *admin.Error
+		if assert.True(t, errors.As(err, &ae)) {
+			assert.Equals(t, ae.Type, admin.ErrorNotFoundType.String())
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		oldB, err := json.Marshal(&dbCELPolicy{ID: authID, AuthorityID: authID})
+		assert.FatalError(t, err)
+		d := DB{db: &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, celPoliciesTable)
+				assert.Equals(t, string(key), authID)
+				return oldB, nil
+			},
+			MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, celPoliciesTable)
+				assert.Equals(t, string(key), authID)
+				assert.Equals(t, old, oldB)
+				assert.Equals(t, nil, nu)
+				return nil, true, nil
+			},
+		}, authorityID: authID}
+		assert.FatalError(t, d.DeleteCELPolicy(context.Background(), policy.CELPolicyScope{}))
+	})
+}
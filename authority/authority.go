@@ -61,6 +61,10 @@ type Authority struct {
 	rootX509CertPool      *x509.CertPool
 	federatedX509Certs    []*x509.Certificate
 	intermediateX509Certs []*x509.Certificate
+	nextX509Certs         []*x509.Certificate
+	x509Issuers           []*x509Issuer
+	x509Rotation          *intermediateRotation
+	x509RotationMutex     sync.RWMutex
 	certificates          *sync.Map
 	x509Enforcers         []provisioner.CertificateEnforcer
 
@@ -79,6 +83,10 @@ type Authority struct {
 	sshCAHostCerts          []ssh.PublicKey
 	sshCAUserFederatedCerts []ssh.PublicKey
 	sshCAHostFederatedCerts []ssh.PublicKey
+	sshCAUserSigningKeys    []sshSigningKey
+	sshCAHostSigningKeys    []sshSigningKey
+	sshCASignerKeys         []ssh.PublicKey
+	sshHostResolver         sshHostResolver
 
 	// CRL vars
 	crlTicker  *time.Ticker
@@ -100,6 +108,10 @@ type Authority struct {
 	// Constraints and Policy engines
 	constraintsEngine *constraints.Engine
 	policyEngine      *policy.Engine
+	// SSH critical options and extensions policy engines by provisioner ID
+	sshOptionsPolicyEngines map[string]*policy.Engine
+	// CEL policy engines of the provisioners and ACME accounts
+	celPolicyEngines map[policy.CELPolicyScope]*policy.Engine
 
 	adminMutex sync.RWMutex
 
@@ -397,6 +409,11 @@ func (a *Authority) init() error {
 		// AuthorityID might be empty. It's always available linked CAs/RAs.
 		options.AuthorityID = a.config.AuthorityConfig.AuthorityID
 
+		// Keep track of the backend that issues each certificate.
+		if store, ok := a.db.(casapi.CertificateBackendStore); ok {
+			options.BackendStore = store
+		}
+
 		// Configure linked RA
 		if linkedcaClient != nil && options.CertificateAuthority == "" {
 			conf, err := linkedcaClient.GetConfiguration(ctx)
@@ -466,6 +483,16 @@ func (a *Authority) init() error {
 			}
 			a.rootX509Certs = append(a.rootX509Certs, resp.RootCertificate)
 			a.intermediateX509Certs = append(a.intermediateX509Certs, resp.IntermediateCertificates...)
+			a.nextX509Certs = append(a.nextX509Certs, resp.NextIntermediateCertificates...)
+		}
+	}
+
+	// Read the intermediate certificates that will replace the current ones.
+	// They are announced to SCEP clients before the rollover.
+	if len(a.nextX509Certs) == 0 && a.config.NextIntermediateCert != "" {
+		a.nextX509Certs, err = pemutil.ReadCertificateBundle(a.config.NextIntermediateCert)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -480,6 +507,19 @@ func (a *Authority) init() error {
 			a.rootX509Certs = append(a.rootX509Certs, crts...)
 		}
 	}
+
+	// Initialize the named X.509 CA services, it will add their roots.
+	if a.x509Issuers == nil {
+		if err := a.initX509Issuers(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Resume the rotation of the intermediate if one has been scheduled.
+	if err := a.initIntermediateRotation(); err != nil {
+		return err
+	}
+
 	for _, crt := range a.rootX509Certs {
 		sum := sha256.Sum256(crt.Raw)
 		a.certificates.Store(hex.EncodeToString(sum[:]), crt)
@@ -519,70 +559,56 @@ func (a *Authority) init() error {
 	var tmplVars templates.Step
 	if a.config.SSH != nil {
 		if a.config.SSH.HostKey != "" {
-			signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
-				SigningKey: a.config.SSH.HostKey,
-				Password:   a.sshHostPassword,
-			})
+			a.sshCAHostCertSignKey, err = a.newSSHSigner(a.config.SSH.HostKey, a.sshHostPassword)
 			if err != nil {
 				return err
 			}
-			// If our signer is from sshagentkms, just unwrap it instead of
-			// wrapping it in another layer, and this prevents crypto from
-			// erroring out with: ssh: unsupported key type *agent.Key
-			switch s := signer.(type) {
-			case *sshagentkms.WrappedSSHSigner:
-				a.sshCAHostCertSignKey = s.Signer
-			case *instrumentedKMSSigner:
-				switch is := s.Signer.(type) {
-				case *sshagentkms.WrappedSSHSigner:
-					a.sshCAHostCertSignKey = is.Signer
-				default:
-					a.sshCAHostCertSignKey, err = ssh.NewSignerFromSigner(s)
-				}
-			case crypto.Signer:
-				a.sshCAHostCertSignKey, err = ssh.NewSignerFromSigner(s)
-			default:
-				return errors.Errorf("unsupported signer type %T", signer)
-			}
-			if err != nil {
-				return errors.Wrap(err, "error creating ssh signer")
-			}
 			// Append public key to list of host certs
 			a.sshCAHostCerts = append(a.sshCAHostCerts, a.sshCAHostCertSignKey.PublicKey())
 			a.sshCAHostFederatedCerts = append(a.sshCAHostFederatedCerts, a.sshCAHostCertSignKey.PublicKey())
+			a.sshCASignerKeys = append(a.sshCASignerKeys, a.sshCAHostCertSignKey.PublicKey())
 		}
 		if a.config.SSH.UserKey != "" {
-			signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
-				SigningKey: a.config.SSH.UserKey,
-				Password:   a.sshUserPassword,
-			})
+			a.sshCAUserCertSignKey, err = a.newSSHSigner(a.config.SSH.UserKey, a.sshUserPassword)
 			if err != nil {
 				return err
 			}
-			// If our signer is from sshagentkms, just unwrap it instead of
-			// wrapping it in another layer, and this prevents crypto from
-			// erroring out with: ssh: unsupported key type *agent.Key
-			switch s := signer.(type) {
-			case *sshagentkms.WrappedSSHSigner:
-				a.sshCAUserCertSignKey = s.Signer
-			case *instrumentedKMSSigner:
-				switch is := s.Signer.(type) {
-				case *sshagentkms.WrappedSSHSigner:
-					a.sshCAUserCertSignKey = is.Signer
-				default:
-					a.sshCAUserCertSignKey, err = ssh.NewSignerFromSigner(s)
-				}
-			case crypto.Signer:
-				a.sshCAUserCertSignKey, err = ssh.NewSignerFromSigner(s)
-			default:
-				return errors.Errorf("unsupported signer type %T", signer)
-			}
-			if err != nil {
-				return errors.Wrap(err, "error creating ssh signer")
-			}
 			// Append public key to list of user certs
 			a.sshCAUserCerts = append(a.sshCAUserCerts, a.sshCAUserCertSignKey.PublicKey())
 			a.sshCAUserFederatedCerts = append(a.sshCAUserFederatedCerts, a.sshCAUserCertSignKey.PublicKey())
+			a.sshCASignerKeys = append(a.sshCASignerKeys, a.sshCAUserCertSignKey.PublicKey())
+		}
+
+		// Load the signing keys used to rotate the host and user keys. Their
+		// public keys are always trusted, and the ones with an activation
+		// time will be used to sign certificates after that time.
+		for _, key := range a.config.SSH.SigningKeys {
+			switch key.Type {
+			case provisioner.SSHHostCert:
+				signer, err := a.newSSHSigner(key.Key, a.sshHostPassword)
+				if err != nil {
+					return err
+				}
+				a.sshCAHostCerts = append(a.sshCAHostCerts, signer.PublicKey())
+				a.sshCAHostFederatedCerts = append(a.sshCAHostFederatedCerts, signer.PublicKey())
+				a.sshCASignerKeys = append(a.sshCASignerKeys, signer.PublicKey())
+				if key.ActiveFrom != nil {
+					a.sshCAHostSigningKeys = addSSHSigningKey(a.sshCAHostSigningKeys, signer, *key.ActiveFrom)
+				}
+			case provisioner.SSHUserCert:
+				signer, err := a.newSSHSigner(key.Key, a.sshUserPassword)
+				if err != nil {
+					return err
+				}
+				a.sshCAUserCerts = append(a.sshCAUserCerts, signer.PublicKey())
+				a.sshCAUserFederatedCerts = append(a.sshCAUserFederatedCerts, signer.PublicKey())
+				a.sshCASignerKeys = append(a.sshCASignerKeys, signer.PublicKey())
+				if key.ActiveFrom != nil {
+					a.sshCAUserSigningKeys = addSSHSigningKey(a.sshCAUserSigningKeys, signer, *key.ActiveFrom)
+				}
+			default:
+				return errors.Errorf("unsupported type %s", key.Type)
+			}
 		}
 
 		// Append other public keys and add them to the template variables.
@@ -735,8 +761,9 @@ func (a *Authority) init() error {
 	case a.requiresSCEP() && a.GetSCEP() == nil:
 		if a.scepOptions == nil {
 			options := &scep.Options{
-				Roots:         a.rootX509Certs,
-				Intermediates: a.intermediateX509Certs,
+				Roots:             a.rootX509Certs,
+				Intermediates:     a.intermediateX509Certs,
+				NextIntermediates: a.nextX509Certs,
 			}
 
 			// intermediate certificates can be empty in RA mode
@@ -867,6 +894,42 @@ func (a *Authority) init() error {
 	return nil
 }
 
+// newSSHSigner creates an ssh.Signer using the key manager for the given key
+// and password.
+func (a *Authority) newSSHSigner(key string, password []byte) (ssh.Signer, error) {
+	signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: key,
+		Password:   password,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// If our signer is from sshagentkms, just unwrap it instead of
+	// wrapping it in another layer, and this prevents crypto from
+	// erroring out with: ssh: unsupported key type *agent.Key
+	var sshSigner ssh.Signer
+	switch s := signer.(type) {
+	case *sshagentkms.WrappedSSHSigner:
+		sshSigner = s.Signer
+	case *instrumentedKMSSigner:
+		switch is := s.Signer.(type) {
+		case *sshagentkms.WrappedSSHSigner:
+			sshSigner = is.Signer
+		default:
+			sshSigner, err = ssh.NewSignerFromSigner(s)
+		}
+	case crypto.Signer:
+		sshSigner, err = ssh.NewSignerFromSigner(s)
+	default:
+		return nil, errors.Errorf("unsupported signer type %T", signer)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating ssh signer")
+	}
+	return sshSigner, nil
+}
+
 // initLogf is used to log initialization information. The output
 // can be disabled by starting the CA with the `--quiet` flag.
 func (a *Authority) initLogf(format string, v ...any) {
@@ -919,10 +982,10 @@ func (a *Authority) GetInfo() Info {
 		DNSNames:      a.config.DNSNames,
 	}
 	if a.sshCAUserCertSignKey != nil {
-		ai.SSHCAUserPublicKey = ssh.MarshalAuthorizedKey(a.sshCAUserCertSignKey.PublicKey())
+		ai.SSHCAUserPublicKey = ssh.MarshalAuthorizedKey(a.getSSHSigner(ssh.UserCert, time.Now()).PublicKey())
 	}
 	if a.sshCAHostCertSignKey != nil {
-		ai.SSHCAHostPublicKey = ssh.MarshalAuthorizedKey(a.sshCAHostCertSignKey.PublicKey())
+		ai.SSHCAHostPublicKey = ssh.MarshalAuthorizedKey(a.getSSHSigner(ssh.HostCert, time.Now()).PublicKey())
 	}
 	return ai
 }
@@ -943,9 +1006,26 @@ func (a *Authority) Shutdown() error {
 	if err := a.keyManager.Close(); err != nil {
 		log.Printf("error closing the key manager: %v", err)
 	}
+	a.closeCAS()
 	return a.db.Shutdown()
 }
 
+// closeCAS closes the default and named certificate authority services that
+// implement [casapi.CertificateAuthorityCloser].
+func (a *Authority) closeCAS() {
+	services := []casapi.CertificateAuthorityService{a.x509CAService}
+	for _, iss := range a.x509Issuers {
+		services = append(services, iss.service)
+	}
+	for _, svc := range services {
+		if c, ok := svc.(casapi.CertificateAuthorityCloser); ok {
+			if err := c.Close(); err != nil {
+				log.Printf("error closing the certificate authority service: %v", err)
+			}
+		}
+	}
+}
+
 // CloseForReload closes internal services, to allow a safe reload.
 func (a *Authority) CloseForReload() {
 	if a.crlTicker != nil {
@@ -956,6 +1036,7 @@ func (a *Authority) CloseForReload() {
 	if err := a.keyManager.Close(); err != nil {
 		log.Printf("error closing the key manager: %v", err)
 	}
+	a.closeCAS()
 	if client, ok := a.adminDB.(*linkedCaClient); ok {
 		client.Stop()
 	}
@@ -294,6 +294,15 @@ func TestAuthorityNew_bundles(t *testing.T) {
 			DNSNames:         []string{"127.0.0.1"},
 			AuthorityConfig:  &AuthConfig{},
 		}, false},
+		{"ok next intermediate", &config.Config{
+			Address:              "127.0.0.1:443",
+			Root:                 []string{filepath.Join(rootPath, "root0.crt")},
+			IntermediateCert:     filepath.Join(rootPath, "int0.crt"),
+			IntermediateKey:      filepath.Join(rootPath, "int0.key"),
+			NextIntermediateCert: filepath.Join(rootPath, "int1.crt"),
+			DNSNames:             []string{"127.0.0.1"},
+			AuthorityConfig:      &AuthConfig{},
+		}, false},
 		{"fail root", &config.Config{
 			Address:          "127.0.0.1:443",
 			Root:             []string{filepath.Join(rootPath, "missing.crt")},
@@ -311,15 +320,27 @@ func TestAuthorityNew_bundles(t *testing.T) {
 			DNSNames:         []string{"127.0.0.1"},
 			AuthorityConfig:  &AuthConfig{},
 		}, true},
+		{"fail next intermediate", &config.Config{
+			Address:              "127.0.0.1:443",
+			Root:                 []string{filepath.Join(rootPath, "root0.crt")},
+			IntermediateCert:     filepath.Join(rootPath, "int0.crt"),
+			IntermediateKey:      filepath.Join(rootPath, "int0.key"),
+			NextIntermediateCert: filepath.Join(rootPath, "missing.crt"),
+			DNSNames:             []string{"127.0.0.1"},
+			AuthorityConfig:      &AuthConfig{},
+		}, true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := New(tt.config)
+			a, err := New(tt.config)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if err == nil && tt.config.NextIntermediateCert != "" {
+				assert.Equals(t, []*x509.Certificate{ca1.Intermediate}, a.GetNextIntermediateCertificates())
+			}
 		})
 	}
 }
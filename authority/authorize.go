@@ -256,6 +256,12 @@ func (a *Authority) Authorize(ctx context.Context, token string) ([]provisioner.
 		}
 		_, signOpts, err := a.authorizeSSHRekey(ctx, token)
 		return signOpts, errs.Wrap(http.StatusInternalServerError, err, "authority.Authorize", opts...)
+	case provisioner.SSHAuthorizedPrincipalsMethod:
+		if a.sshCAUserCertSignKey == nil {
+			return nil, errs.NotImplemented("authority.Authorize; ssh user certificate flows are not enabled", opts...)
+		}
+		_, err := a.authorizeSSHAuthorizedPrincipals(ctx, token)
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Authorize", opts...)
 	default:
 		return nil, errs.InternalServer("authority.Authorize; method %d is not supported", append([]interface{}{m}, opts...)...)
 	}
@@ -396,6 +402,28 @@ func (a *Authority) authorizeSSHRekey(ctx context.Context, token string) (*ssh.C
 	return cert, signOpts, nil
 }
 
+// authorizeSSHAuthorizedPrincipals authorizes a request of a host to get the
+// principals authorized to log in, by validating the contents of an SSHPOP
+// token. It returns the host certificate in the token.
+func (a *Authority) authorizeSSHAuthorizedPrincipals(ctx context.Context, token string) (*ssh.Certificate, error) {
+	p, err := a.authorizeToken(ctx, token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHAuthorizedPrincipals")
+	}
+	authorizer, ok := p.(provisioner.SSHAuthorizedPrincipalsAuthorizer)
+	if !ok {
+		return nil, errs.Unauthorized("authority.authorizeSSHAuthorizedPrincipals; provisioner %s does not support ssh authorized principals", p.GetName())
+	}
+	cert, err := authorizer.AuthorizeSSHAuthorizedPrincipals(ctx, token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHAuthorizedPrincipals")
+	}
+	if err := a.authorizeSSHCertificate(ctx, cert); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHAuthorizedPrincipals")
+	}
+	return cert, nil
+}
+
 // authorizeSSHRevoke authorizes an SSH certificate revoke request, by
 // validating the contents of an SSHPOP token.
 func (a *Authority) authorizeSSHRevoke(ctx context.Context, token string) error {
@@ -33,12 +33,13 @@ import (
 )
 
 var testAudiences = provisioner.Audiences{
-	Sign:      []string{"https://example.com/1.0/sign", "https://example.com/sign"},
-	Revoke:    []string{"https://example.com/1.0/revoke", "https://example.com/revoke"},
-	SSHSign:   []string{"https://example.com/1.0/ssh/sign"},
-	SSHRevoke: []string{"https://example.com/1.0/ssh/revoke"},
-	SSHRenew:  []string{"https://example.com/1.0/ssh/renew"},
-	SSHRekey:  []string{"https://example.com/1.0/ssh/rekey"},
+	Sign:                    []string{"https://example.com/1.0/sign", "https://example.com/sign"},
+	Revoke:                  []string{"https://example.com/1.0/revoke", "https://example.com/revoke"},
+	SSHSign:                 []string{"https://example.com/1.0/ssh/sign"},
+	SSHRevoke:               []string{"https://example.com/1.0/ssh/revoke"},
+	SSHRenew:                []string{"https://example.com/1.0/ssh/renew"},
+	SSHRekey:                []string{"https://example.com/1.0/ssh/rekey"},
+	SSHAuthorizedPrincipals: []string{"https://example.com/1.0/ssh/authorized-principals"},
 }
 
 type tokOption func(*jose.SignerOptions) error
@@ -796,6 +797,69 @@ func TestAuthority_Authorize(t *testing.T) {
 				ctx:   provisioner.NewContextWithMethod(context.Background(), provisioner.SSHRekeyMethod),
 			}
 		},
+		"fail/sshAuthorizedPrincipals/invalid-token": func(t *testing.T) *authorizeTest {
+			return &authorizeTest{
+				auth:  a,
+				token: "foo",
+				ctx:   provisioner.NewContextWithMethod(context.Background(), provisioner.SSHAuthorizedPrincipalsMethod),
+				err:   errors.New("authority.Authorize: authority.authorizeSSHAuthorizedPrincipals: error parsing token"),
+				code:  http.StatusUnauthorized,
+			}
+		},
+		"fail/sshAuthorizedPrincipals/not-supported": func(t *testing.T) *authorizeTest {
+			cl := jose.Claims{
+				Subject:   "foo.smallstep.com",
+				Issuer:    validIssuer,
+				NotBefore: jose.NewNumericDate(now),
+				Expiry:    jose.NewNumericDate(now.Add(time.Minute)),
+				Audience:  testAudiences.SSHAuthorizedPrincipals,
+				ID:        "authorized-principals",
+			}
+			token, err := jose.Signed(sig).Claims(cl).CompactSerialize()
+			assert.FatalError(t, err)
+			return &authorizeTest{
+				auth:  a,
+				token: token,
+				ctx:   provisioner.NewContextWithMethod(context.Background(), provisioner.SSHAuthorizedPrincipalsMethod),
+				err:   errors.New("authority.Authorize: authority.authorizeSSHAuthorizedPrincipals; provisioner step-cli does not support ssh authorized principals"),
+				code:  http.StatusUnauthorized,
+			}
+		},
+		"fail/sshAuthorizedPrincipals/disabled": func(t *testing.T) *authorizeTest {
+			_a := testAuthority(t)
+			_a.sshCAUserCertSignKey = nil
+			return &authorizeTest{
+				auth:  _a,
+				token: "foo",
+				ctx:   provisioner.NewContextWithMethod(context.Background(), provisioner.SSHAuthorizedPrincipalsMethod),
+				err:   errors.New("authority.Authorize; ssh user certificate flows are not enabled"),
+				code:  http.StatusNotImplemented,
+			}
+		},
+		"ok/sshAuthorizedPrincipals": func(t *testing.T) *authorizeTest {
+			key, err := pemutil.Read("./testdata/secrets/ssh_host_ca_key")
+			assert.FatalError(t, err)
+			signer, ok := key.(crypto.Signer)
+			assert.Fatal(t, ok, "could not cast ssh signing key to crypto signer")
+			sshSigner, err := ssh.NewSignerFromSigner(signer)
+			assert.FatalError(t, err)
+
+			cert, _jwk, err := createSSHCert(&ssh.Certificate{CertType: ssh.HostCert}, sshSigner)
+			assert.FatalError(t, err)
+
+			p, ok := a.provisioners.Load("sshpop/sshpop")
+			assert.Fatal(t, ok, "sshpop provisioner not found in test authority")
+
+			tok, err := generateToken("foo", p.GetName(), testAudiences.SSHAuthorizedPrincipals[0]+"#sshpop/sshpop",
+				[]string{"foo.smallstep.com"}, now, _jwk, withSSHPOPFile(cert))
+			assert.FatalError(t, err)
+
+			return &authorizeTest{
+				auth:  a,
+				token: tok,
+				ctx:   provisioner.NewContextWithMethod(context.Background(), provisioner.SSHAuthorizedPrincipalsMethod),
+			}
+		},
 		"fail/unexpected-method": func(t *testing.T) *authorizeTest {
 			return &authorizeTest{
 				auth:  a,
@@ -1105,7 +1169,7 @@ func TestAuthority_authorizeSSHSign(t *testing.T) {
 				}
 			} else {
 				if assert.Nil(t, tc.err) {
-					assert.Len(t, 10, got) // number of provisioner.SignOptions returned
+					assert.Len(t, 12, got) // number of provisioner.SignOptions returned
 				}
 			}
 		})
@@ -13,6 +13,7 @@ import (
 	"github.com/smallstep/linkedca"
 	kms "go.step.sm/crypto/kms/apiv1"
 
+	"github.com/smallstep/certificates/acme/perspective"
 	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
 	cas "github.com/smallstep/certificates/cas/apiv1"
@@ -65,26 +66,28 @@ var (
 
 // Config represents the CA configuration and it's mapped to a JSON object.
 type Config struct {
-	Root             multiString          `json:"root"`
-	FederatedRoots   []string             `json:"federatedRoots"`
-	IntermediateCert string               `json:"crt"`
-	IntermediateKey  string               `json:"key"`
-	Address          string               `json:"address"`
-	InsecureAddress  string               `json:"insecureAddress"`
-	DNSNames         []string             `json:"dnsNames"`
-	KMS              *kms.Options         `json:"kms,omitempty"`
-	SSH              *SSHConfig           `json:"ssh,omitempty"`
-	Logger           json.RawMessage      `json:"logger,omitempty"`
-	DB               *db.Config           `json:"db,omitempty"`
-	Monitoring       json.RawMessage      `json:"monitoring,omitempty"`
-	AuthorityConfig  *AuthConfig          `json:"authority,omitempty"`
-	TLS              *TLSOptions          `json:"tls,omitempty"`
-	Password         string               `json:"password,omitempty"`
-	Templates        *templates.Templates `json:"templates,omitempty"`
-	CommonName       string               `json:"commonName,omitempty"`
-	CRL              *CRLConfig           `json:"crl,omitempty"`
-	MetricsAddress   string               `json:"metricsAddress,omitempty"`
-	SkipValidation   bool                 `json:"-"`
+	Root                 multiString          `json:"root"`
+	FederatedRoots       []string             `json:"federatedRoots"`
+	IntermediateCert     string               `json:"crt"`
+	IntermediateKey      string               `json:"key"`
+	NextIntermediateCert string               `json:"nextCrt,omitempty"`
+	Address              string               `json:"address"`
+	InsecureAddress      string               `json:"insecureAddress"`
+	DNSNames             []string             `json:"dnsNames"`
+	KMS                  *kms.Options         `json:"kms,omitempty"`
+	SSH                  *SSHConfig           `json:"ssh,omitempty"`
+	Logger               json.RawMessage      `json:"logger,omitempty"`
+	DB                   *db.Config           `json:"db,omitempty"`
+	Monitoring           json.RawMessage      `json:"monitoring,omitempty"`
+	AuthorityConfig      *AuthConfig          `json:"authority,omitempty"`
+	TLS                  *TLSOptions          `json:"tls,omitempty"`
+	Password             string               `json:"password,omitempty"`
+	Templates            *templates.Templates `json:"templates,omitempty"`
+	CommonName           string               `json:"commonName,omitempty"`
+	CRL                  *CRLConfig           `json:"crl,omitempty"`
+	ACME                 *ACMEConfig          `json:"acme,omitempty"`
+	MetricsAddress       string               `json:"metricsAddress,omitempty"`
+	SkipValidation       bool                 `json:"-"`
 
 	// Keeps record of the filename the Config is read from
 	loadedFromFilepath string
@@ -140,6 +143,64 @@ func (c *CRLConfig) TickerDuration() time.Duration {
 	return (c.CacheDuration.Duration / 3) * 2
 }
 
+// ACMEConfig represents the authority-wide options of the ACME server.
+type ACMEConfig struct {
+	// Perspectives configures the remote validation agents used to
+	// corroborate http-01, dns-01 and tls-alpn-01 validations.
+	Perspectives *perspective.Options `json:"perspectives,omitempty"`
+	// AsyncFinalize enables the asynchronous finalization of orders. If set,
+	// finalize requests move the order to processing and the certificates
+	// are issued by a pool of workers.
+	AsyncFinalize *ACMEAsyncFinalize `json:"asyncFinalize,omitempty"`
+}
+
+// ACMEAsyncFinalize configures the pool of workers used to finalize ACME
+// orders asynchronously.
+type ACMEAsyncFinalize struct {
+	// Workers is the number of concurrent workers issuing certificates.
+	// Defaults to 4.
+	Workers int `json:"workers,omitempty"`
+	// QueueSize is the maximum number of orders waiting to be processed.
+	// Defaults to 100.
+	QueueSize int `json:"queueSize,omitempty"`
+}
+
+// Validate validates the asynchronous finalization options.
+func (c *ACMEAsyncFinalize) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.Workers < 0:
+		return errors.New("acme.asyncFinalize.workers cannot be negative")
+	case c.QueueSize < 0:
+		return errors.New("acme.asyncFinalize.queueSize cannot be negative")
+	default:
+		return nil
+	}
+}
+
+// HasPerspectives returns true if multi-perspective validation is enabled.
+func (c *ACMEConfig) HasPerspectives() bool {
+	return c != nil && c.Perspectives.IsEnabled()
+}
+
+// HasAsyncFinalize returns true if the asynchronous finalization of orders is
+// enabled.
+func (c *ACMEConfig) HasAsyncFinalize() bool {
+	return c != nil && c.AsyncFinalize != nil
+}
+
+// Validate validates the ACME configuration.
+func (c *ACMEConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if err := c.Perspectives.Validate(); err != nil {
+		return err
+	}
+	return c.AsyncFinalize.Validate()
+}
+
 // ASN1DN contains ASN1.DN attributes that are used in Subject and Issuer
 // x509 Certificate blocks.
 type ASN1DN struct {
@@ -169,6 +230,46 @@ type AuthConfig struct {
 	Backdate             *provisioner.Duration `json:"backdate,omitempty"`
 	EnableAdmin          bool                  `json:"enableAdmin,omitempty"`
 	DisableGetSSHHosts   bool                  `json:"disableGetSSHHosts,omitempty"`
+
+	// CertificateAuthorities are additional named CAS that can be used by
+	// some provisioners instead of the default one. A CAS is selected by
+	// provisioner name only; ACME orders cannot select one by profile because
+	// ACME profiles are not supported.
+	CertificateAuthorities []*CertificateAuthority `json:"certificateAuthorities,omitempty"`
+}
+
+// CertificateAuthority represents a named certificate authority service (CAS)
+// used to sign the X.509 certificates of the given provisioners. All the
+// orders of an ACME provisioner use the same CAS. The root, crt and key
+// properties are only used by softcas, the root can be omitted if it is the
+// same as the default one.
+type CertificateAuthority struct {
+	Name string `json:"name"`
+	*cas.Options
+	Root             multiString `json:"root,omitempty"`
+	IntermediateCert string      `json:"crt,omitempty"`
+	IntermediateKey  string      `json:"key,omitempty"`
+	Provisioners     []string    `json:"provisioners,omitempty"`
+}
+
+// Validate validates a named certificate authority.
+func (c *CertificateAuthority) Validate() error {
+	switch {
+	case c == nil:
+		return errors.New("certificateAuthorities cannot contain null values")
+	case c.Name == "":
+		return errors.New("certificateAuthorities name cannot be empty")
+	case c.Options.Is(cas.SoftCAS) && c.IntermediateCert == "":
+		return errors.Errorf("certificateAuthorities %s crt cannot be empty", c.Name)
+	case c.Options.Is(cas.SoftCAS) && c.IntermediateKey == "":
+		return errors.Errorf("certificateAuthorities %s key cannot be empty", c.Name)
+	}
+	for _, root := range c.Root {
+		if root == "" {
+			return errors.Errorf("certificateAuthorities %s root cannot contain empty values", c.Name)
+		}
+	}
+	return c.Options.Validate()
 }
 
 // init initializes the required fields in the AuthConfig if they are not
@@ -211,6 +312,25 @@ func (c *AuthConfig) Validate(provisioner.Audiences) error {
 		return errors.New("authority.backdate cannot be less than 0")
 	}
 
+	// Check that names are unique and that provisioners use only one CAS
+	names := make(map[string]bool, len(c.CertificateAuthorities))
+	provisioners := make(map[string]string)
+	for _, ca := range c.CertificateAuthorities {
+		if err := ca.Validate(); err != nil {
+			return err
+		}
+		if names[ca.Name] {
+			return errors.Errorf("certificateAuthorities name %s is duplicated", ca.Name)
+		}
+		names[ca.Name] = true
+		for _, name := range ca.Provisioners {
+			if other, ok := provisioners[name]; ok {
+				return errors.Errorf("provisioner %s cannot use both certificateAuthorities %s and %s", name, other, ca.Name)
+			}
+			provisioners[name] = ca.Name
+		}
+	}
+
 	return nil
 }
 
@@ -377,6 +497,11 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	// Validate acme config: nil is ok
+	if err := c.ACME.Validate(); err != nil {
+		return err
+	}
+
 	return c.AuthorityConfig.Validate(c.GetAudiences())
 }
 
@@ -419,6 +544,9 @@ func (c *Config) GetAudiences() provisioner.Audiences {
 		audiences.SSHRekey = append(audiences.SSHRekey,
 			fmt.Sprintf("https://%s/1.0/ssh/rekey", hostname),
 			fmt.Sprintf("https://%s/ssh/rekey", hostname))
+		audiences.SSHAuthorizedPrincipals = append(audiences.SSHAuthorizedPrincipals,
+			fmt.Sprintf("https://%s/1.0/ssh/authorized-principals", hostname),
+			fmt.Sprintf("https://%s/ssh/authorized-principals", hostname))
 	}
 
 	return audiences
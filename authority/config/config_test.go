@@ -287,6 +287,58 @@ func TestAuthConfigValidate(t *testing.T) {
 				asn1dn: asn1dn,
 			}
 		},
+		"ok-certificate-authorities": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					CertificateAuthorities: []*CertificateAuthority{
+						{Name: "a", IntermediateCert: "a.crt", IntermediateKey: "a.key", Provisioners: []string{"Max"}},
+						{Name: "b", IntermediateCert: "b.crt", IntermediateKey: "b.key", Provisioners: []string{"step-cli"}},
+					},
+				},
+				asn1dn: ASN1DN{},
+			}
+		},
+		"fail-certificate-authorities-nil": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					CertificateAuthorities: []*CertificateAuthority{nil},
+				},
+				err: errors.New("certificateAuthorities cannot contain null values"),
+			}
+		},
+		"fail-certificate-authorities-key": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					CertificateAuthorities: []*CertificateAuthority{
+						{Name: "a", IntermediateCert: "a.crt"},
+					},
+				},
+				err: errors.New("certificateAuthorities a key cannot be empty"),
+			}
+		},
+		"fail-certificate-authorities-duplicated": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					CertificateAuthorities: []*CertificateAuthority{
+						{Name: "a", IntermediateCert: "a.crt", IntermediateKey: "a.key"},
+						{Name: "a", IntermediateCert: "b.crt", IntermediateKey: "b.key"},
+					},
+				},
+				err: errors.New("certificateAuthorities name a is duplicated"),
+			}
+		},
+		"fail-certificate-authorities-provisioner": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					CertificateAuthorities: []*CertificateAuthority{
+						{Name: "a", IntermediateCert: "a.crt", IntermediateKey: "a.key", Provisioners: []string{"Max"}},
+						{Name: "b", IntermediateCert: "b.crt", IntermediateKey: "b.key", Provisioners: []string{"Max"}},
+					},
+				},
+				err: errors.New("provisioner Max cannot use both certificateAuthorities a and b"),
+			}
+		},
 	}
 
 	for name, get := range tests {
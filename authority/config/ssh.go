@@ -1,6 +1,11 @@
 package config
 
 import (
+	"encoding/base64"
+	"path"
+	"strings"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"go.step.sm/crypto/jose"
@@ -9,12 +14,17 @@ import (
 
 // SSHConfig contains the user and host keys.
 type SSHConfig struct {
-	HostKey          string          `json:"hostKey"`
-	UserKey          string          `json:"userKey"`
-	Keys             []*SSHPublicKey `json:"keys,omitempty"`
-	AddUserPrincipal string          `json:"addUserPrincipal,omitempty"`
-	AddUserCommand   string          `json:"addUserCommand,omitempty"`
-	Bastion          *Bastion        `json:"bastion,omitempty"`
+	HostKey                         string               `json:"hostKey"`
+	UserKey                         string               `json:"userKey"`
+	Keys                            []*SSHPublicKey      `json:"keys,omitempty"`
+	SigningKeys                     []*SSHSigningKey     `json:"signingKeys,omitempty"`
+	AuthorizedPrincipals            []*SSHPrincipalsRule `json:"authorizedPrincipals,omitempty"`
+	AuthorizedPrincipalsProvisioner string               `json:"authorizedPrincipalsProvisioner,omitempty"`
+	AddUserPrincipal                string               `json:"addUserPrincipal,omitempty"`
+	AddUserCommand                  string               `json:"addUserCommand,omitempty"`
+	Bastion                         *Bastion             `json:"bastion,omitempty"`
+	AccessRequests                  *SSHAccessRequests   `json:"accessRequests,omitempty"`
+	HostVerification                *SSHHostVerification `json:"hostVerification,omitempty"`
 }
 
 // Bastion contains the custom properties used on bastion.
@@ -26,6 +36,88 @@ type Bastion struct {
 	Flags    string `json:"flags,omitempty"`
 }
 
+// SSHPrincipalsRule is a rule used to return the principals of a user
+// certificate authorized to log in to a host, it is evaluated by the
+// AuthorizedPrincipalsCommand endpoint. A rule applies if the host matches one
+// of the Hosts patterns and has all the HostTags, the local user matches one of
+// the Users patterns, and the certificate key id matches one of the KeyIDs
+// patterns; empty lists match everything. The certificate principals matching
+// one of the Principals patterns of an applicable rule are authorized.
+//
+// Patterns use the syntax of path.Match, and the string "%u" in Principals is
+// replaced by the local user.
+type SSHPrincipalsRule struct {
+	Hosts      []string          `json:"hosts,omitempty"`
+	HostTags   map[string]string `json:"hostTags,omitempty"`
+	Users      []string          `json:"users,omitempty"`
+	KeyIDs     []string          `json:"keyIDs,omitempty"`
+	Principals []string          `json:"principals"`
+}
+
+// Validate checks the fields in SSHPrincipalsRule.
+func (r *SSHPrincipalsRule) Validate() error {
+	if len(r.Principals) == 0 {
+		return errors.New("authorizedPrincipals rule principals cannot be empty")
+	}
+	for _, patterns := range [][]string{r.Hosts, r.Users, r.KeyIDs, r.Principals} {
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return errors.Errorf("authorizedPrincipals rule has an invalid pattern %q", p)
+			}
+		}
+	}
+	return nil
+}
+
+// Authorize returns the principals of a certificate with the given key id
+// that the rule authorizes to log in as user to a host with the given
+// hostnames and tags.
+func (r *SSHPrincipalsRule) Authorize(hostnames []string, tags []HostTag, user, keyID string, principals []string) []string {
+	if !matchAny(r.Hosts, hostnames...) || !matchAny(r.Users, user) || !matchAny(r.KeyIDs, keyID) {
+		return nil
+	}
+	for name, value := range r.HostTags {
+		var found bool
+		for _, t := range tags {
+			if t.Name == name && t.Value == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+
+	patterns := make([]string, len(r.Principals))
+	for i, p := range r.Principals {
+		patterns[i] = strings.ReplaceAll(p, "%u", user)
+	}
+	var authorized []string
+	for _, p := range principals {
+		if matchAny(patterns, p) {
+			authorized = append(authorized, p)
+		}
+	}
+	return authorized
+}
+
+// matchAny returns true if any of the values matches any of the patterns, or
+// if there are no patterns.
+func matchAny(patterns []string, values ...string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		for _, v := range values {
+			if ok, _ := path.Match(p, v); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // HostTag are tagged with k,v pairs. These tags are how a user is ultimately
 // associated with a host.
 type HostTag struct {
@@ -36,9 +128,10 @@ type HostTag struct {
 
 // Host defines expected attributes for an ssh host.
 type Host struct {
-	HostID   string    `json:"hid"`
-	HostTags []HostTag `json:"host_tags"`
-	Hostname string    `json:"hostname"`
+	HostID     string    `json:"hid"`
+	HostTags   []HostTag `json:"host_tags"`
+	HostGroups []string  `json:"host_groups,omitempty"`
+	Hostname   string    `json:"hostname"`
 }
 
 // Validate checks the fields in SSHConfig.
@@ -51,9 +144,184 @@ func (c *SSHConfig) Validate() error {
 			return err
 		}
 	}
+	for _, r := range c.AuthorizedPrincipals {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, k := range c.SigningKeys {
+		if err := k.Validate(); err != nil {
+			return err
+		}
+		switch {
+		case k.Type == provisioner.SSHHostCert && c.HostKey == "":
+			return errors.New("ssh signing keys of type host require a hostKey")
+		case k.Type == provisioner.SSHUserCert && c.UserKey == "":
+			return errors.New("ssh signing keys of type user require a userKey")
+		}
+	}
+	if err := c.AccessRequests.Validate(); err != nil {
+		return err
+	}
+	return c.HostVerification.Validate()
+}
+
+// SSHAccessRequests enables just-in-time SSH access requests. A user can
+// request access to a group of hosts, and once the request is approved by an
+// admin or by the Webhook, the user can get a single SSH user certificate with
+// the principals, validity and source addresses of the request, using a token
+// with the id of the request.
+//
+// MaxDuration is the maximum validity of the certificates, it defaults to one
+// hour. ApprovalDuration is the time an approved request can be used to get a
+// certificate, it defaults to fifteen minutes.
+type SSHAccessRequests struct {
+	MaxDuration      *provisioner.Duration    `json:"maxDuration,omitempty"`
+	ApprovalDuration *provisioner.Duration    `json:"approvalDuration,omitempty"`
+	Webhook          *SSHAccessRequestWebhook `json:"webhook,omitempty"`
+}
+
+// SSHAccessRequestWebhook is a webhook called when an SSH access request is
+// created. The request is approved if the webhook server allows it, otherwise
+// it is left pending for an admin to approve or deny it.
+type SSHAccessRequestWebhook struct {
+	URL                  string `json:"url"`
+	Secret               string `json:"secret"`
+	BearerToken          string `json:"bearerToken,omitempty"`
+	DisableTLSClientAuth bool   `json:"disableTLSClientAuth,omitempty"`
+}
+
+// Validate checks the fields in SSHAccessRequests.
+func (r *SSHAccessRequests) Validate() error {
+	switch {
+	case r == nil:
+		return nil
+	case r.MaxDuration != nil && r.MaxDuration.Value() <= 0:
+		return errors.New("accessRequests maxDuration must be greater than 0")
+	case r.ApprovalDuration != nil && r.ApprovalDuration.Value() <= 0:
+		return errors.New("accessRequests approvalDuration must be greater than 0")
+	case r.Webhook == nil:
+		return nil
+	}
+	wh := &provisioner.Webhook{
+		Name: "accessRequests",
+		URL:  r.Webhook.URL,
+		Kind: "AUTHORIZING",
+	}
+	if err := wh.Validate(); err != nil {
+		return errors.Wrap(err, "accessRequests webhook is not valid")
+	}
+	if _, err := base64.StdEncoding.DecodeString(r.Webhook.Secret); err != nil {
+		return errors.New("accessRequests webhook secret must be base64 encoded")
+	}
 	return nil
 }
 
+// GetMaxDuration returns the maximum validity of the certificates issued for
+// access requests.
+func (r *SSHAccessRequests) GetMaxDuration() time.Duration {
+	if r.MaxDuration == nil {
+		return time.Hour
+	}
+	return r.MaxDuration.Value()
+}
+
+// GetApprovalDuration returns the time an approved access request can be used
+// to get a certificate.
+func (r *SSHAccessRequests) GetApprovalDuration() time.Duration {
+	if r.ApprovalDuration == nil {
+		return 15 * time.Minute
+	}
+	return r.ApprovalDuration.Value()
+}
+
+// SSH host verification methods.
+const (
+	// SSHHostVerifyConnect verifies a host connecting to the SSH port of each
+	// principal and checking that the host key presented is the key being
+	// certified.
+	SSHHostVerifyConnect = "connect"
+	// SSHHostVerifySSHPOP verifies a host with a signature of the one-time
+	// token made with the private key of an active, not revoked, host
+	// certificate issued by the CA for the same principals, a proof of
+	// possession like the one used by the SSHPOP provisioner.
+	SSHHostVerifySSHPOP = "sshpop"
+)
+
+// SSHHostVerification enables the verification of the identity of a host
+// before issuing an SSH host certificate. Method defaults to connect, where the
+// CA connects to the SSH port of each principal. With sshpop, the host signs
+// the token with the key of its current host certificate.
+//
+// Port is the SSH port used to connect to the hosts, it defaults to 22, and
+// Timeout defaults to five seconds. If DNS is set, each hostname in the
+// principals must resolve to an address that resolves back to the hostname.
+type SSHHostVerification struct {
+	Method  string                `json:"method,omitempty"`
+	Port    int                   `json:"port,omitempty"`
+	Timeout *provisioner.Duration `json:"timeout,omitempty"`
+	DNS     bool                  `json:"dns,omitempty"`
+}
+
+// Validate checks the fields in SSHHostVerification.
+func (v *SSHHostVerification) Validate() error {
+	switch {
+	case v == nil:
+		return nil
+	case v.Method != "" && v.Method != SSHHostVerifyConnect && v.Method != SSHHostVerifySSHPOP:
+		return errors.Errorf("hostVerification method %q is not valid, it must be connect or sshpop", v.Method)
+	case v.Port < 0 || v.Port > 65535:
+		return errors.Errorf("hostVerification port %d is not valid", v.Port)
+	case v.Timeout != nil && v.Timeout.Value() <= 0:
+		return errors.New("hostVerification timeout must be greater than 0")
+	default:
+		return nil
+	}
+}
+
+// GetPort returns the SSH port used to connect to the hosts.
+func (v *SSHHostVerification) GetPort() int {
+	if v.Port == 0 {
+		return 22
+	}
+	return v.Port
+}
+
+// GetTimeout returns the maximum time used to verify a host.
+func (v *SSHHostVerification) GetTimeout() time.Duration {
+	if v.Timeout == nil {
+		return 5 * time.Second
+	}
+	return v.Timeout.Value()
+}
+
+// SSHSigningKey is an additional key used to sign SSH certificates, it allows
+// the rotation of the HostKey or UserKey without a flag day. The public keys
+// of all the signing keys are trusted, and they are published along with the
+// HostKey or UserKey. If ActiveFrom is set, the key becomes the signer of the
+// given type at that time; if multiple keys are active, the one with the most
+// recent ActiveFrom is used. Keys without ActiveFrom are never used to sign,
+// they can be used to stage a new key or to keep a retiring key.
+type SSHSigningKey struct {
+	Type       string     `json:"type"`
+	Key        string     `json:"key"`
+	ActiveFrom *time.Time `json:"activeFrom,omitempty"`
+}
+
+// Validate checks the fields in SSHSigningKey.
+func (k *SSHSigningKey) Validate() error {
+	switch {
+	case k.Type == "":
+		return errors.New("type cannot be empty")
+	case k.Type != provisioner.SSHHostCert && k.Type != provisioner.SSHUserCert:
+		return errors.Errorf("invalid type %s, it must be user or host", k.Type)
+	case k.Key == "":
+		return errors.New("key cannot be empty")
+	default:
+		return nil
+	}
+}
+
 // SSHPublicKey contains a public key used by federated CAs to keep old signing
 // keys for this ca.
 type SSHPublicKey struct {
@@ -3,8 +3,10 @@ package config
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/provisioner"
 	"go.step.sm/crypto/jose"
 	"golang.org/x/crypto/ssh"
 )
@@ -71,3 +73,154 @@ func TestSSHPublicKey_PublicKey(t *testing.T) {
 		})
 	}
 }
+
+func TestSSHSigningKey_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     *SSHSigningKey
+		wantErr bool
+	}{
+		{"user", &SSHSigningKey{Type: "user", Key: "user_ca_key"}, false},
+		{"host", &SSHSigningKey{Type: "host", Key: "host_ca_key"}, false},
+		{"emptyType", &SSHSigningKey{Key: "host_ca_key"}, true},
+		{"badType", &SSHSigningKey{Type: "bad", Key: "host_ca_key"}, true},
+		{"emptyKey", &SSHSigningKey{Type: "host"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.key.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SSHSigningKey.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSSHAccessRequests_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *SSHAccessRequests
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"ok", &SSHAccessRequests{MaxDuration: &provisioner.Duration{Duration: time.Hour}}, false},
+		{"webhook", &SSHAccessRequests{Webhook: &SSHAccessRequestWebhook{URL: "https://example.com/approve", Secret: "c2VjcmV0"}}, false},
+		{"badMaxDuration", &SSHAccessRequests{MaxDuration: &provisioner.Duration{Duration: -time.Hour}}, true},
+		{"badApprovalDuration", &SSHAccessRequests{ApprovalDuration: &provisioner.Duration{}}, true},
+		{"badWebhookURL", &SSHAccessRequests{Webhook: &SSHAccessRequestWebhook{URL: "http://example.com/approve"}}, true},
+		{"badWebhookSecret", &SSHAccessRequests{Webhook: &SSHAccessRequestWebhook{URL: "https://example.com/approve", Secret: "%%%"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SSHAccessRequests.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSSHHostVerification_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *SSHHostVerification
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"ok", &SSHHostVerification{}, false},
+		{"connect", &SSHHostVerification{Method: "connect", Port: 2222, Timeout: &provisioner.Duration{Duration: time.Second}, DNS: true}, false},
+		{"sshpop", &SSHHostVerification{Method: "sshpop"}, false},
+		{"badMethod", &SSHHostVerification{Method: "dns"}, true},
+		{"badPort", &SSHHostVerification{Port: 65536}, true},
+		{"badTimeout", &SSHHostVerification{Timeout: &provisioner.Duration{}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SSHHostVerification.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSSHConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *SSHConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"ok", &SSHConfig{HostKey: "host_ca_key", UserKey: "user_ca_key", SigningKeys: []*SSHSigningKey{
+			{Type: "host", Key: "host_ca_key_new"},
+			{Type: "user", Key: "user_ca_key_new"},
+		}}, false},
+		{"badSigningKey", &SSHConfig{HostKey: "host_ca_key", SigningKeys: []*SSHSigningKey{
+			{Type: "host"},
+		}}, true},
+		{"missingHostKey", &SSHConfig{UserKey: "user_ca_key", SigningKeys: []*SSHSigningKey{
+			{Type: "host", Key: "host_ca_key_new"},
+		}}, true},
+		{"missingUserKey", &SSHConfig{HostKey: "host_ca_key", SigningKeys: []*SSHSigningKey{
+			{Type: "user", Key: "user_ca_key_new"},
+		}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SSHConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSSHPrincipalsRule_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    *SSHPrincipalsRule
+		wantErr bool
+	}{
+		{"ok", &SSHPrincipalsRule{Hosts: []string{"*.example.com"}, Principals: []string{"%u"}}, false},
+		{"emptyPrincipals", &SSHPrincipalsRule{Hosts: []string{"*.example.com"}}, true},
+		{"badHost", &SSHPrincipalsRule{Hosts: []string{"[*.example.com"}, Principals: []string{"%u"}}, true},
+		{"badPrincipal", &SSHPrincipalsRule{Principals: []string{"[%u"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SSHPrincipalsRule.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSSHPrincipalsRule_Authorize(t *testing.T) {
+	hostnames := []string{"db1.example.com", "db1"}
+	tags := []HostTag{{Name: "env", Value: "prod"}, {Name: "role", Value: "db"}}
+	principals := []string{"alice", "alice@example.com", "dba"}
+
+	tests := []struct {
+		name  string
+		rule  *SSHPrincipalsRule
+		user  string
+		keyID string
+		want  []string
+	}{
+		{"ok/user", &SSHPrincipalsRule{Principals: []string{"%u"}}, "alice", "alice@example.com", []string{"alice"}},
+		{"ok/pattern", &SSHPrincipalsRule{Principals: []string{"*@example.com", "dba"}}, "root", "alice@example.com", []string{"alice@example.com", "dba"}},
+		{"ok/hosts", &SSHPrincipalsRule{Hosts: []string{"db*.example.com"}, Principals: []string{"dba"}}, "root", "alice@example.com", []string{"dba"}},
+		{"ok/tags", &SSHPrincipalsRule{HostTags: map[string]string{"env": "prod", "role": "db"}, Principals: []string{"dba"}}, "root", "alice@example.com", []string{"dba"}},
+		{"ok/users", &SSHPrincipalsRule{Users: []string{"postgres", "root"}, Principals: []string{"dba"}}, "root", "alice@example.com", []string{"dba"}},
+		{"ok/keyIDs", &SSHPrincipalsRule{KeyIDs: []string{"*@example.com"}, Principals: []string{"dba"}}, "root", "alice@example.com", []string{"dba"}},
+		{"fail/hosts", &SSHPrincipalsRule{Hosts: []string{"web*"}, Principals: []string{"dba"}}, "root", "alice@example.com", nil},
+		{"fail/tags", &SSHPrincipalsRule{HostTags: map[string]string{"env": "dev"}, Principals: []string{"dba"}}, "root", "alice@example.com", nil},
+		{"fail/users", &SSHPrincipalsRule{Users: []string{"postgres"}, Principals: []string{"dba"}}, "root", "alice@example.com", nil},
+		{"fail/keyIDs", &SSHPrincipalsRule{KeyIDs: []string{"bob@example.com"}, Principals: []string{"dba"}}, "root", "alice@example.com", nil},
+		{"fail/principals", &SSHPrincipalsRule{Principals: []string{"%u"}}, "root", "alice@example.com", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.rule.Authorize(hostnames, tags, tt.user, tt.keyID, principals)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SSHPrincipalsRule.Authorize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
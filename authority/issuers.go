@@ -0,0 +1,250 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/cas"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// x509Issuer is a named certificate authority service (CAS) used to sign the
+// X.509 certificates of some provisioners instead of the default one.
+type x509Issuer struct {
+	name          string
+	service       cas.CertificateAuthorityService
+	roots         []*x509.Certificate
+	intermediates []*x509.Certificate
+	provisioners  []string
+}
+
+// initX509Issuers initializes the named certificate authority services and
+// adds their roots to the authority roots.
+func (a *Authority) initX509Issuers(ctx context.Context) error {
+	for _, c := range a.config.AuthorityConfig.CertificateAuthorities {
+		iss, err := a.newX509Issuer(ctx, c)
+		if err != nil {
+			return errors.Wrapf(err, "error initializing certificate authority %s", c.Name)
+		}
+		for _, crt := range iss.roots {
+			if !containsCertificate(a.rootX509Certs, crt) {
+				a.rootX509Certs = append(a.rootX509Certs, crt)
+			}
+		}
+		a.x509Issuers = append(a.x509Issuers, iss)
+	}
+	return nil
+}
+
+func (a *Authority) newX509Issuer(ctx context.Context, c *config.CertificateAuthority) (*x509Issuer, error) {
+	var options casapi.Options
+	if c.Options != nil {
+		options = *c.Options
+	}
+	options.AuthorityID = a.config.AuthorityConfig.AuthorityID
+	if store, ok := a.db.(casapi.CertificateBackendStore); ok {
+		options.BackendStore = store
+	}
+
+	iss := &x509Issuer{
+		name:         c.Name,
+		provisioners: c.Provisioners,
+	}
+
+	// Read intermediate and create X509 signer for softcas.
+	if options.Is(casapi.SoftCAS) {
+		chain, err := pemutil.ReadCertificateBundle(c.IntermediateCert)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+			SigningKey: c.IntermediateKey,
+			Password:   a.password,
+		})
+		if err != nil {
+			return nil, err
+		}
+		options.CertificateChain = chain
+		options.Signer = signer
+		iss.intermediates = append(iss.intermediates, chain...)
+	}
+
+	svc, err := cas.New(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	iss.service = svc
+
+	// Get root and intermediates from the CAS.
+	if srv, ok := svc.(casapi.CertificateAuthorityGetter); ok {
+		resp, err := srv.GetCertificateAuthority(&casapi.GetCertificateAuthorityRequest{
+			Name: options.CertificateAuthority,
+		})
+		if err != nil {
+			return nil, err
+		}
+		iss.roots = append(iss.roots, resp.RootCertificate)
+		iss.intermediates = append(iss.intermediates, resp.IntermediateCertificates...)
+	}
+
+	for _, path := range c.Root {
+		crts, err := pemutil.ReadCertificateBundle(path)
+		if err != nil {
+			return nil, err
+		}
+		iss.roots = append(iss.roots, crts...)
+	}
+
+	return iss, nil
+}
+
+// GetCertificateAuthorityService returns the certificate authority service
+// (CAS) with the given name. If the name is empty it returns the default one.
+func (a *Authority) GetCertificateAuthorityService(name string) (cas.CertificateAuthorityService, error) {
+	if name == "" {
+		return a.x509CAService, nil
+	}
+	if iss := a.getX509Issuer(name); iss != nil {
+		return iss.service, nil
+	}
+	return nil, errs.NotFound("certificate authority %s was not found", name)
+}
+
+// getX509Issuer returns the named issuer with the given name or nil if it
+// does not exist.
+func (a *Authority) getX509Issuer(name string) *x509Issuer {
+	for _, iss := range a.x509Issuers {
+		if iss.name == name {
+			return iss
+		}
+	}
+	return nil
+}
+
+// lookupX509Issuer returns the named issuer to use with the given certificate
+// and provisioner, both optional. The issuer of the certificate takes
+// precedence over the one configured for the provisioner. Issuers are not
+// selected per ACME profile, as profiles are not supported. It returns nil if
+// the default CAS must be used.
+func (a *Authority) lookupX509Issuer(cert *x509.Certificate, prov provisioner.Interface) *x509Issuer {
+	if len(a.x509Issuers) == 0 {
+		return nil
+	}
+	if cert != nil {
+		if isIssuedBy(cert, a.intermediateX509Certs) {
+			return nil
+		}
+		if r := a.getIntermediateRotation(); r != nil && isIssuedBy(cert, r.chain) {
+			return nil
+		}
+		for _, iss := range a.x509Issuers {
+			if isIssuedBy(cert, iss.intermediates) {
+				return iss
+			}
+		}
+	}
+	if prov != nil {
+		for _, iss := range a.x509Issuers {
+			if slices.Contains(iss.provisioners, prov.GetName()) {
+				return iss
+			}
+		}
+	}
+	return nil
+}
+
+// getX509CAService returns the name and the certificate authority service to
+// use with the given certificate and provisioner. The name of the default CAS
+// is empty.
+func (a *Authority) getX509CAService(cert *x509.Certificate, prov provisioner.Interface) (string, cas.CertificateAuthorityService) {
+	if iss := a.lookupX509Issuer(cert, prov); iss != nil {
+		return iss.name, iss.service
+	}
+	return "", a.x509CAService
+}
+
+// GetCASHealth returns the health of the backends of the default and named
+// certificate authority services that report it. The backends of a named CAS
+// are prefixed with its name.
+func (a *Authority) GetCASHealth() []casapi.BackendHealth {
+	var health []casapi.BackendHealth
+	if r, ok := a.x509CAService.(casapi.CertificateAuthorityHealthReporter); ok {
+		health = append(health, r.GetHealth()...)
+	}
+	for _, iss := range a.x509Issuers {
+		if r, ok := iss.service.(casapi.CertificateAuthorityHealthReporter); ok {
+			for _, h := range r.GetHealth() {
+				h.Name = iss.name + "/" + h.Name
+				health = append(health, h)
+			}
+		}
+	}
+	return health
+}
+
+// GetIssuerCertificateRevocationList returns the current CRL of the named
+// certificate authority. The name can also be the fingerprint of the
+// intermediate replaced by a rotation.
+func (a *Authority) GetIssuerCertificateRevocationList(name string) (*CertificateRevocationListInfo, error) {
+	if !a.config.CRL.IsEnabled() {
+		return nil, errs.Wrap(http.StatusNotFound, errors.Errorf("Certificate Revocation Lists are not enabled"), "authority.GetIssuerCertificateRevocationList")
+	}
+	if a.getX509Issuer(name) == nil && !a.isRetiredIntermediate(name) {
+		return nil, errs.NotFound("certificate authority %s was not found", name)
+	}
+
+	crlDB, ok := a.db.(db.IssuerCertificateRevocationListDB)
+	if !ok {
+		return nil, errs.Wrap(http.StatusNotImplemented, errors.Errorf("Database does not support Certificate Revocation Lists of multiple certificate authorities"), "authority.GetIssuerCertificateRevocationList")
+	}
+
+	crlInfo, err := crlDB.GetIssuerCRL(name)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetIssuerCertificateRevocationList")
+	}
+
+	return &CertificateRevocationListInfo{
+		Number:    crlInfo.Number,
+		ExpiresAt: crlInfo.ExpiresAt,
+		Duration:  crlInfo.Duration,
+		Data:      crlInfo.DER,
+	}, nil
+}
+
+// isRetiredIntermediate returns true if the given name is the fingerprint of
+// the intermediate replaced by a rotation.
+func (a *Authority) isRetiredIntermediate(name string) bool {
+	retired := a.getRetiredIntermediate(time.Now())
+	return retired != nil && x509util.Fingerprint(retired) == name
+}
+
+// isIssuedBy returns true if the certificate was signed by the first
+// certificate in the chain.
+func isIssuedBy(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	if len(chain) == 0 {
+		return false
+	}
+	issuer := chain[0]
+	return bytes.Equal(cert.RawIssuer, issuer.RawSubject) &&
+		(len(cert.AuthorityKeyId) == 0 || bytes.Equal(cert.AuthorityKeyId, issuer.SubjectKeyId))
+}
+
+func containsCertificate(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	return slices.ContainsFunc(certs, func(c *x509.Certificate) bool {
+		return c.Equal(cert)
+	})
+}
@@ -0,0 +1,210 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/nosql/database"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+type mockIssuerCRLDB struct {
+	db.MockAuthDB
+	crls map[string]*db.CertificateRevocationListInfo
+}
+
+func (m *mockIssuerCRLDB) GetIssuerCRL(issuer string) (*db.CertificateRevocationListInfo, error) {
+	if crl, ok := m.crls[issuer]; ok {
+		return crl, nil
+	}
+	return nil, database.ErrNotFound
+}
+
+func (m *mockIssuerCRLDB) StoreIssuerCRL(issuer string, crl *db.CertificateRevocationListInfo) error {
+	m.crls[issuer] = crl
+	return nil
+}
+
+func withTestX509Issuer(t *testing.T, ca *minica.CA) Option {
+	t.Helper()
+	dir := t.TempDir()
+	rootPath := filepath.Join(dir, "root.crt")
+	crtPath := filepath.Join(dir, "intermediate.crt")
+	keyPath := filepath.Join(dir, "intermediate.key")
+	require.NoError(t, os.WriteFile(rootPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw}), 0600))
+	require.NoError(t, os.WriteFile(crtPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw}), 0600))
+	_, err := pemutil.Serialize(ca.Signer, pemutil.ToFile(keyPath, 0600))
+	require.NoError(t, err)
+
+	return func(a *Authority) error {
+		a.config.AuthorityConfig.CertificateAuthorities = []*config.CertificateAuthority{{
+			Name:             "other",
+			Root:             []string{rootPath},
+			IntermediateCert: crtPath,
+			IntermediateKey:  keyPath,
+			Provisioners:     []string{"Max"},
+		}}
+		return nil
+	}
+}
+
+// newTestIssuedCert returns a certificate that looks issued by the given
+// intermediate.
+func newTestIssuedCert(issuer *x509.Certificate, sn int64) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber:   big.NewInt(sn),
+		Subject:        pkix.Name{CommonName: "leaf"},
+		RawIssuer:      issuer.RawSubject,
+		AuthorityKeyId: issuer.SubjectKeyId,
+		NotBefore:      time.Now(),
+		NotAfter:       time.Now().Add(time.Hour),
+	}
+}
+
+func TestAuthority_x509Issuers(t *testing.T) {
+	ca, err := minica.New(minica.WithName("Other"))
+	require.NoError(t, err)
+	a := testAuthority(t, withTestX509Issuer(t, ca))
+
+	// Roots and intermediates include the named certificate authority.
+	roots, err := a.GetRoots()
+	require.NoError(t, err)
+	assert.Len(t, roots, 2)
+	assert.True(t, containsCertificate(roots, ca.Root))
+
+	intermediates := a.GetIntermediateCertificates()
+	assert.Equal(t, a.intermediateX509Certs[0], intermediates[0])
+	assert.True(t, containsCertificate(intermediates, ca.Intermediate))
+
+	// Lookup by name.
+	svc, err := a.GetCertificateAuthorityService("")
+	require.NoError(t, err)
+	assert.Equal(t, a.x509CAService, svc)
+	svc, err = a.GetCertificateAuthorityService("other")
+	require.NoError(t, err)
+	assert.NotEqual(t, a.x509CAService, svc)
+	_, err = a.GetCertificateAuthorityService("missing")
+	assert.Error(t, err)
+
+	// Lookup by provisioner and certificate.
+	maxProv, err := a.LoadProvisionerByName("Max")
+	require.NoError(t, err)
+	cliProv, err := a.LoadProvisionerByName("step-cli")
+	require.NoError(t, err)
+
+	defaultCert := newTestIssuedCert(a.intermediateX509Certs[0], 1)
+	otherCert := newTestIssuedCert(ca.Intermediate, 2)
+
+	tests := []struct {
+		name     string
+		cert     *x509.Certificate
+		prov     provisioner.Interface
+		wantName string
+	}{
+		{"default", nil, nil, ""},
+		{"default/provisioner", nil, cliProv, ""},
+		{"default/certificate", defaultCert, maxProv, ""},
+		{"other/provisioner", nil, maxProv, "other"},
+		{"other/certificate", otherCert, cliProv, "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, svc := a.getX509CAService(tt.cert, tt.prov)
+			assert.Equal(t, tt.wantName, name)
+			want, err := a.GetCertificateAuthorityService(tt.wantName)
+			require.NoError(t, err)
+			assert.Equal(t, want, svc)
+		})
+	}
+}
+
+func TestAuthority_x509Issuers_CRL(t *testing.T) {
+	ca, err := minica.New(minica.WithName("Other"))
+	require.NoError(t, err)
+
+	var revokedList []db.RevokedCertificateInfo
+	var crlStore *db.CertificateRevocationListInfo
+	cdb := &mockIssuerCRLDB{
+		MockAuthDB: db.MockAuthDB{
+			MGetCertificate: func(sn string) (*x509.Certificate, error) {
+				return nil, database.ErrNotFound
+			},
+			MRevoke: func(rci *db.RevokedCertificateInfo) error {
+				revokedList = append(revokedList, *rci)
+				return nil
+			},
+			MGetRevokedCertificates: func() (*[]db.RevokedCertificateInfo, error) {
+				return &revokedList, nil
+			},
+			MStoreCRL: func(crl *db.CertificateRevocationListInfo) error {
+				crlStore = crl
+				return nil
+			},
+			MGetCRL: func() (*db.CertificateRevocationListInfo, error) {
+				if crlStore == nil {
+					return nil, database.ErrNotFound
+				}
+				return crlStore, nil
+			},
+		},
+		crls: map[string]*db.CertificateRevocationListInfo{},
+	}
+	a := testAuthority(t, WithDatabase(cdb), withTestX509Issuer(t, ca))
+	a.config.CRL = &config.CRLConfig{Enabled: true}
+
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.RevokeMethod)
+	for _, crt := range []*x509.Certificate{
+		newTestIssuedCert(a.intermediateX509Certs[0], 1),
+		newTestIssuedCert(ca.Intermediate, 2),
+	} {
+		require.NoError(t, a.Revoke(ctx, &RevokeOptions{
+			Serial: crt.SerialNumber.String(),
+			Crt:    crt,
+			MTLS:   true,
+		}))
+	}
+	require.Len(t, revokedList, 2)
+	assert.Empty(t, revokedList[0].Issuer)
+	assert.Equal(t, "other", revokedList[1].Issuer)
+
+	require.NoError(t, a.GenerateCertificateRevocationList())
+
+	// The default CRL only contains certificates of the default issuer.
+	info, err := a.GetCertificateRevocationList()
+	require.NoError(t, err)
+	crl, err := x509.ParseRevocationList(info.Data)
+	require.NoError(t, err)
+	require.NoError(t, crl.CheckSignatureFrom(a.intermediateX509Certs[0]))
+	if assert.Len(t, crl.RevokedCertificateEntries, 1) {
+		assert.Equal(t, big.NewInt(1), crl.RevokedCertificateEntries[0].SerialNumber)
+	}
+
+	// The named CRL only contains certificates of the named issuer.
+	info, err = a.GetIssuerCertificateRevocationList("other")
+	require.NoError(t, err)
+	crl, err = x509.ParseRevocationList(info.Data)
+	require.NoError(t, err)
+	require.NoError(t, crl.CheckSignatureFrom(ca.Intermediate))
+	if assert.Len(t, crl.RevokedCertificateEntries, 1) {
+		assert.Equal(t, big.NewInt(2), crl.RevokedCertificateEntries[0].SerialNumber)
+	}
+
+	_, err = a.GetIssuerCertificateRevocationList("missing")
+	assert.Error(t, err)
+}
@@ -264,6 +264,7 @@ func WithSSHUserSigner(s crypto.Signer) Option {
 		pub := signer.PublicKey()
 		a.sshCAUserCerts = append(a.sshCAUserCerts, pub)
 		a.sshCAUserFederatedCerts = append(a.sshCAUserFederatedCerts, pub)
+		a.sshCASignerKeys = append(a.sshCASignerKeys, pub)
 		return nil
 	}
 }
@@ -280,6 +281,7 @@ func WithSSHHostSigner(s crypto.Signer) Option {
 		pub := signer.PublicKey()
 		a.sshCAHostCerts = append(a.sshCAHostCerts, pub)
 		a.sshCAHostFederatedCerts = append(a.sshCAHostFederatedCerts, pub)
+		a.sshCASignerKeys = append(a.sshCASignerKeys, pub)
 		return nil
 	}
 }
@@ -323,6 +325,16 @@ func WithX509IntermediateCerts(intermediateCerts ...*x509.Certificate) Option {
 	}
 }
 
+// WithX509NextIntermediateCerts is an option that allows to define the list of
+// intermediate certificates that will replace the current ones after a CA
+// rollover. This option will replace the nextCrt property of the ca.json.
+func WithX509NextIntermediateCerts(nextIntermediateCerts ...*x509.Certificate) Option {
+	return func(a *Authority) error {
+		a.nextX509Certs = nextIntermediateCerts
+		return nil
+	}
+}
+
 // WithX509RootBundle is an option that allows to define the list of root
 // certificates. This option will replace any root certificate defined before.
 func WithX509RootBundle(pemCerts []byte) Option {
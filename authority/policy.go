@@ -2,13 +2,20 @@ package authority
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
 
+	"go.step.sm/crypto/sshutil"
+	"go.step.sm/crypto/x509util"
+	"golang.org/x/crypto/ssh"
+
 	"github.com/smallstep/linkedca"
 
 	"github.com/smallstep/certificates/authority/admin"
 	authPolicy "github.com/smallstep/certificates/authority/policy"
+	"github.com/smallstep/certificates/authority/provisioner"
 	policy "github.com/smallstep/certificates/policy"
 )
 
@@ -208,8 +215,10 @@ func (a *Authority) checkPolicy(_ context.Context, currentAdmin *linkedca.Admin,
 // configuration stored in the DB or from the configuration file.
 func (a *Authority) reloadPolicyEngines(ctx context.Context) error {
 	var (
-		err           error
-		policyOptions *authPolicy.Options
+		err               error
+		policyOptions     *authPolicy.Options
+		sshOptionsEngines map[string]*authPolicy.Engine
+		celEngines        map[authPolicy.CELPolicyScope]*authPolicy.Engine
 	)
 
 	if a.config.AuthorityConfig.EnableAdmin {
@@ -226,6 +235,32 @@ func (a *Authority) reloadPolicyEngines(ctx context.Context) error {
 			}
 		}
 		policyOptions = authPolicy.LinkedToCertificates(linkedPolicy)
+
+		// add the SSH critical options and extensions policies, which are
+		// stored separately from the linkedca policies.
+		if db, ok := a.adminDB.(admin.SSHOptionsPolicyDB); ok {
+			sshOptionsPolicies, err := db.GetSSHOptionsPolicies(ctx)
+			if err != nil {
+				return fmt.Errorf("error getting SSH options policies to (re)load policy engines: %w", err)
+			}
+			policyOptions = policyOptions.WithSSHOptionsPolicy(sshOptionsPolicies[""])
+			if sshOptionsEngines, err = newSSHOptionsPolicyEngines(sshOptionsPolicies); err != nil {
+				return err
+			}
+		}
+
+		// add the CEL policies, which are stored separately from the
+		// linkedca policies too.
+		if db, ok := a.adminDB.(admin.CELPolicyDB); ok {
+			celPolicies, err := db.GetCELPolicies(ctx)
+			if err != nil {
+				return fmt.Errorf("error getting CEL policies to (re)load policy engines: %w", err)
+			}
+			policyOptions = policyOptions.WithCELPolicy(celPolicies[authPolicy.CELPolicyScope{}])
+			if celEngines, err = newCELPolicyEngines(celPolicies); err != nil {
+				return err
+			}
+		}
 	} else {
 		policyOptions = a.config.AuthorityConfig.Policy
 	}
@@ -235,12 +270,356 @@ func (a *Authority) reloadPolicyEngines(ctx context.Context) error {
 		return err
 	}
 
-	// only update the policy engine when no error was returned
+	// only update the policy engines when no error was returned
 	a.policyEngine = engine
+	a.sshOptionsPolicyEngines = sshOptionsEngines
+	a.celPolicyEngines = celEngines
 
 	return nil
 }
 
+// newSSHOptionsPolicyEngines creates the SSH critical options and extensions
+// policy engines of the provisioners. The authority policy, with an empty
+// provisioner ID, is skipped.
+func newSSHOptionsPolicyEngines(policies map[string]*authPolicy.SSHOptionsPolicy) (map[string]*authPolicy.Engine, error) {
+	engines := make(map[string]*authPolicy.Engine, len(policies))
+	for provisionerID, p := range policies {
+		if provisionerID == "" {
+			continue
+		}
+		engine, err := authPolicy.New(new(authPolicy.Options).WithSSHOptionsPolicy(p))
+		if err != nil {
+			return nil, fmt.Errorf("error creating SSH options policy engine for provisioner %s: %w", provisionerID, err)
+		}
+		engines[provisionerID] = engine
+	}
+	return engines, nil
+}
+
+// GetSSHOptionsPolicy returns the SSH critical options and extensions policy
+// of a provisioner, or the authority policy if the provisioner ID is empty.
+func (a *Authority) GetSSHOptionsPolicy(ctx context.Context, provisionerID string) (*authPolicy.SSHOptionsPolicy, error) {
+	a.adminMutex.Lock()
+	defer a.adminMutex.Unlock()
+
+	db, err := a.getSSHOptionsPolicyDB()
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetSSHOptionsPolicy(ctx, provisionerID)
+}
+
+// UpdateSSHOptionsPolicy creates or replaces the SSH critical options and
+// extensions policy of a provisioner, or the authority policy if the
+// provisioner ID is empty.
+func (a *Authority) UpdateSSHOptionsPolicy(ctx context.Context, provisionerID string, p *authPolicy.SSHOptionsPolicy) (*authPolicy.SSHOptionsPolicy, error) {
+	a.adminMutex.Lock()
+	defer a.adminMutex.Unlock()
+
+	db, err := a.getSSHOptionsPolicyDB()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, &PolicyError{
+			Typ: ConfigurationFailure,
+			Err: err,
+		}
+	}
+
+	if err := db.UpdateSSHOptionsPolicy(ctx, provisionerID, p); err != nil {
+		return nil, &PolicyError{
+			Typ: StoreFailure,
+			Err: err,
+		}
+	}
+
+	if err := a.reloadPolicyEngines(ctx); err != nil {
+		return nil, &PolicyError{
+			Typ: ReloadFailure,
+			Err: fmt.Errorf("error reloading policy engines when updating SSH options policy: %w", err),
+		}
+	}
+
+	return p, nil
+}
+
+// RemoveSSHOptionsPolicy deletes the SSH critical options and extensions
+// policy of a provisioner, or the authority policy if the provisioner ID is
+// empty.
+func (a *Authority) RemoveSSHOptionsPolicy(ctx context.Context, provisionerID string) error {
+	a.adminMutex.Lock()
+	defer a.adminMutex.Unlock()
+
+	db, err := a.getSSHOptionsPolicyDB()
+	if err != nil {
+		return err
+	}
+
+	if err := db.DeleteSSHOptionsPolicy(ctx, provisionerID); err != nil {
+		return &PolicyError{
+			Typ: StoreFailure,
+			Err: err,
+		}
+	}
+
+	if err := a.reloadPolicyEngines(ctx); err != nil {
+		return &PolicyError{
+			Typ: ReloadFailure,
+			Err: fmt.Errorf("error reloading policy engines when deleting SSH options policy: %w", err),
+		}
+	}
+
+	return nil
+}
+
+// getSSHOptionsPolicyDB returns the admin database if it supports SSH
+// critical options and extensions policies.
+func (a *Authority) getSSHOptionsPolicyDB() (admin.SSHOptionsPolicyDB, error) {
+	if db, ok := a.adminDB.(admin.SSHOptionsPolicyDB); ok {
+		return db, nil
+	}
+	return nil, admin.NewError(admin.ErrorNotImplementedType, "SSH options policies are not supported by the admin database")
+}
+
+// newCELPolicyEngines creates the CEL policy engines of the provisioners and
+// ACME accounts. The authority policy, with the zero scope, is skipped.
+func newCELPolicyEngines(policies map[authPolicy.CELPolicyScope]*authPolicy.CELPolicy) (map[authPolicy.CELPolicyScope]*authPolicy.Engine, error) {
+	engines := make(map[authPolicy.CELPolicyScope]*authPolicy.Engine, len(policies))
+	for scope, p := range policies {
+		if scope == (authPolicy.CELPolicyScope{}) {
+			continue
+		}
+		engine, err := authPolicy.New(new(authPolicy.Options).WithCELPolicy(p))
+		if err != nil {
+			return nil, fmt.Errorf("error creating CEL policy engine for %s: %w", celPolicyScopeName(scope), err)
+		}
+		engines[scope] = engine
+	}
+	return engines, nil
+}
+
+func celPolicyScopeName(scope authPolicy.CELPolicyScope) string {
+	switch {
+	case scope.ProvisionerID == "":
+		return "authority"
+	case scope.ACMEAccountID == "":
+		return "provisioner " + scope.ProvisionerID
+	default:
+		return "ACME account " + scope.ACMEAccountID + " of provisioner " + scope.ProvisionerID
+	}
+}
+
+// GetCELPolicy returns the CEL policy of the authority, a provisioner or an
+// ACME account.
+func (a *Authority) GetCELPolicy(ctx context.Context, scope authPolicy.CELPolicyScope) (*authPolicy.CELPolicy, error) {
+	a.adminMutex.Lock()
+	defer a.adminMutex.Unlock()
+
+	db, err := a.getCELPolicyDB()
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetCELPolicy(ctx, scope)
+}
+
+// UpdateCELPolicy creates or replaces the CEL policy of the authority, a
+// provisioner or an ACME account.
+func (a *Authority) UpdateCELPolicy(ctx context.Context, scope authPolicy.CELPolicyScope, p *authPolicy.CELPolicy) (*authPolicy.CELPolicy, error) {
+	a.adminMutex.Lock()
+	defer a.adminMutex.Unlock()
+
+	db, err := a.getCELPolicyDB()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, &PolicyError{
+			Typ: ConfigurationFailure,
+			Err: err,
+		}
+	}
+
+	if err := db.UpdateCELPolicy(ctx, scope, p); err != nil {
+		return nil, &PolicyError{
+			Typ: StoreFailure,
+			Err: err,
+		}
+	}
+
+	if err := a.reloadPolicyEngines(ctx); err != nil {
+		return nil, &PolicyError{
+			Typ: ReloadFailure,
+			Err: fmt.Errorf("error reloading policy engines when updating CEL policy: %w", err),
+		}
+	}
+
+	return p, nil
+}
+
+// RemoveCELPolicy deletes the CEL policy of the authority, a provisioner or
+// an ACME account.
+func (a *Authority) RemoveCELPolicy(ctx context.Context, scope authPolicy.CELPolicyScope) error {
+	a.adminMutex.Lock()
+	defer a.adminMutex.Unlock()
+
+	db, err := a.getCELPolicyDB()
+	if err != nil {
+		return err
+	}
+
+	if err := db.DeleteCELPolicy(ctx, scope); err != nil {
+		return &PolicyError{
+			Typ: StoreFailure,
+			Err: err,
+		}
+	}
+
+	if err := a.reloadPolicyEngines(ctx); err != nil {
+		return &PolicyError{
+			Typ: ReloadFailure,
+			Err: fmt.Errorf("error reloading policy engines when deleting CEL policy: %w", err),
+		}
+	}
+
+	return nil
+}
+
+// getCELPolicyDB returns the admin database if it supports CEL policies.
+func (a *Authority) getCELPolicyDB() (admin.CELPolicyDB, error) {
+	if db, ok := a.adminDB.(admin.CELPolicyDB); ok {
+		return db, nil
+	}
+	return nil, admin.NewError(admin.ErrorNotImplementedType, "CEL policies are not supported by the admin database")
+}
+
+// getCELPolicyEngines returns the CEL policy engines of the provisioner and
+// the ACME account of a request. The authority policy is part of the policy
+// engine.
+func (a *Authority) getCELPolicyEngines(prov provisioner.Interface, account *provisioner.ACMEAccountData) []*authPolicy.Engine {
+	if prov == nil {
+		return nil
+	}
+	engines := []*authPolicy.Engine{
+		a.celPolicyEngines[authPolicy.CELPolicyScope{ProvisionerID: prov.GetID()}],
+	}
+	if account != nil {
+		engines = append(engines, a.celPolicyEngines[authPolicy.CELPolicyScope{
+			ProvisionerID: prov.GetID(),
+			ACMEAccountID: account.ID,
+		}])
+	}
+	return engines
+}
+
+// areX509RulesSatisfied evaluates the CEL policies of the authority, the
+// provisioner and the ACME account against the certificate (to be signed).
+func (a *Authority) areX509RulesSatisfied(cert *x509.Certificate, csr *x509.CertificateRequest, prov provisioner.Interface, webhookCtl webhookController, attData *provisioner.AttestationData, account *provisioner.ACMEAccountData) error {
+	engines := append([]*authPolicy.Engine{a.policyEngine}, a.getCELPolicyEngines(prov, account)...)
+	if !hasCELPolicy(engines) {
+		return nil
+	}
+
+	data, err := newCELData(prov, webhookCtl)
+	if err != nil {
+		return err
+	}
+	if attData != nil {
+		data.Attestation = map[string]any{
+			"permanentIdentifier": attData.PermanentIdentifier,
+			"fingerprint":         attData.Fingerprint,
+			"type":                attData.Format,
+		}
+	}
+	if account != nil {
+		data.Account = map[string]any{
+			"id": account.ID,
+		}
+	}
+
+	for _, e := range engines {
+		if err := e.AreX509RulesSatisfied(cert, csr, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// areSSHRulesSatisfied evaluates the CEL policies of the authority and the
+// provisioner against the SSH certificate (to be signed).
+func (a *Authority) areSSHRulesSatisfied(cert *ssh.Certificate, prov provisioner.Interface, webhookCtl webhookController) error {
+	engines := append([]*authPolicy.Engine{a.policyEngine}, a.getCELPolicyEngines(prov, nil)...)
+	if !hasCELPolicy(engines) {
+		return nil
+	}
+
+	data, err := newCELData(prov, webhookCtl)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range engines {
+		if err := e.AreSSHRulesSatisfied(cert, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasCELPolicy(engines []*authPolicy.Engine) bool {
+	for _, e := range engines {
+		if e.HasCELPolicy() {
+			return true
+		}
+	}
+	return false
+}
+
+// newCELData returns the provisioner and token claims of a request. The
+// claims are taken from the template data of the webhook controller, where
+// the provisioners that authorize requests with tokens set them.
+func newCELData(prov provisioner.Interface, webhookCtl webhookController) (*policy.CELData, error) {
+	data := &policy.CELData{}
+	if prov != nil {
+		data.Provisioner = map[string]any{
+			"id":   prov.GetID(),
+			"name": prov.GetName(),
+			"type": prov.GetType().String(),
+		}
+	}
+
+	wc, ok := webhookCtl.(*provisioner.WebhookController)
+	if !ok || wc == nil {
+		return data, nil
+	}
+
+	var token any
+	switch tmpl := wc.TemplateData.(type) {
+	case x509util.TemplateData:
+		token = tmpl[x509util.TokenKey]
+	case sshutil.TemplateData:
+		token = tmpl[sshutil.TokenKey]
+	}
+	if token == nil {
+		return data, nil
+	}
+
+	// convert the claims to the JSON representation used in tokens
+	b, err := json.Marshal(token)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling token claims: %w", err)
+	}
+	if err := json.Unmarshal(b, &data.Token); err != nil {
+		return nil, fmt.Errorf("error unmarshaling token claims: %w", err)
+	}
+
+	return data, nil
+}
+
 func isAllowed(engine authPolicy.X509Policy, sans []string) error {
 	if err := engine.AreSANsAllowed(sans); err != nil {
 		var policyErr *policy.NamePolicyError
@@ -259,3 +638,112 @@ func isAllowed(engine authPolicy.X509Policy, sans []string) error {
 
 	return nil
 }
+
+// PolicyLayer identifies the level at which a name policy is configured.
+type PolicyLayer string
+
+const (
+	// AuthorityPolicyLayer is the authority level policy.
+	AuthorityPolicyLayer PolicyLayer = "authority"
+	// ProvisionerPolicyLayer is the provisioner level policy.
+	ProvisionerPolicyLayer PolicyLayer = "provisioner"
+	// ACMEAccountPolicyLayer is the ACME account level policy.
+	ACMEAccountPolicyLayer PolicyLayer = "acmeAccount"
+)
+
+// PolicyExplainRequest contains the names to explain the policy decisions
+// for. Only one of CSR, SANs or SSHCertificate is expected to be set. When
+// Provisioner is set, its policy is explained too. When ACMEAccountID is set,
+// ACMEAccountPolicy is explained as the policy of that ACME account; ACME
+// account policies only apply to X.509 certificates.
+type PolicyExplainRequest struct {
+	CSR               *x509.CertificateRequest
+	SANs              []string
+	SSHCertificate    *ssh.Certificate
+	Provisioner       *linkedca.Provisioner
+	ACMEAccountID     string
+	ACMEAccountPolicy authPolicy.X509PolicyOptionsInterface
+}
+
+// PolicyLayerExplanation is the explanation of the policy at one layer.
+type PolicyLayerExplanation struct {
+	Layer PolicyLayer `json:"layer"`
+	Name  string      `json:"name,omitempty"`
+	*authPolicy.Explanation
+}
+
+// PolicyExplanation contains the explanations of the name policies of the
+// authority, and optionally a provisioner and an ACME account. A request is
+// only allowed when all layers allow it.
+type PolicyExplanation struct {
+	Allowed bool                      `json:"allowed"`
+	Layers  []*PolicyLayerExplanation `json:"layers"`
+}
+
+// ExplainPolicy explains which of the authority, provisioner and ACME account
+// name policies allow or deny the names in the request, and which rules
+// matched. It doesn't sign anything and doesn't change any state.
+func (a *Authority) ExplainPolicy(_ context.Context, req *PolicyExplainRequest) (*PolicyExplanation, error) {
+	a.adminMutex.RLock()
+	defer a.adminMutex.RUnlock()
+
+	res := &PolicyExplanation{
+		Allowed: true,
+	}
+	add := func(layer PolicyLayer, name string, exp *authPolicy.Explanation) {
+		res.Layers = append(res.Layers, &PolicyLayerExplanation{
+			Layer:       layer,
+			Name:        name,
+			Explanation: exp,
+		})
+		res.Allowed = res.Allowed && exp.Allowed
+	}
+
+	add(AuthorityPolicyLayer, "", explainPolicyEngine(a.policyEngine, req))
+
+	if req.Provisioner != nil {
+		engine, err := authPolicy.New(authPolicy.LinkedToCertificates(req.Provisioner.GetPolicy()))
+		if err != nil {
+			return nil, &PolicyError{
+				Typ: ConfigurationFailure,
+				Err: fmt.Errorf("error creating policy engine for provisioner %q: %w", req.Provisioner.GetName(), err),
+			}
+		}
+		add(ProvisionerPolicyLayer, req.Provisioner.GetName(), explainPolicyEngine(engine, req))
+	}
+
+	if req.ACMEAccountID != "" {
+		engine, err := authPolicy.NewX509PolicyEngine(req.ACMEAccountPolicy)
+		if err != nil {
+			return nil, &PolicyError{
+				Typ: ConfigurationFailure,
+				Err: fmt.Errorf("error creating policy engine for ACME account %q: %w", req.ACMEAccountID, err),
+			}
+		}
+		var exp *authPolicy.Explanation
+		switch {
+		case req.SSHCertificate != nil:
+			exp = &authPolicy.Explanation{Allowed: true}
+		case req.CSR != nil:
+			exp = authPolicy.ExplainX509CertificateRequest(engine, req.CSR)
+		default:
+			exp = authPolicy.ExplainSANs(engine, req.SANs)
+		}
+		add(ACMEAccountPolicyLayer, req.ACMEAccountID, exp)
+	}
+
+	return res, nil
+}
+
+// explainPolicyEngine explains the decision of an engine for the names in
+// the request.
+func explainPolicyEngine(engine *authPolicy.Engine, req *PolicyExplainRequest) *authPolicy.Explanation {
+	switch {
+	case req.SSHCertificate != nil:
+		return engine.ExplainSSHCertificate(req.SSHCertificate)
+	case req.CSR != nil:
+		return engine.ExplainX509CertificateRequest(req.CSR)
+	default:
+		return engine.ExplainSANs(req.SANs)
+	}
+}
@@ -6,13 +6,18 @@ import (
 	"fmt"
 
 	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/policy"
 )
 
 // Engine is a container for multiple policies.
 type Engine struct {
-	x509Policy    X509Policy
-	sshUserPolicy UserPolicy
-	sshHostPolicy HostPolicy
+	x509Policy           X509Policy
+	sshUserPolicy        UserPolicy
+	sshHostPolicy        HostPolicy
+	sshUserOptionsPolicy UserPolicy
+	sshHostOptionsPolicy HostPolicy
+	celPolicy            *policy.CELPolicyEngine
 }
 
 // New returns a new Engine using Options.
@@ -24,10 +29,13 @@ func New(options *Options) (*Engine, error) {
 	}
 
 	var (
-		x509Policy    X509Policy
-		sshHostPolicy HostPolicy
-		sshUserPolicy UserPolicy
-		err           error
+		x509Policy           X509Policy
+		sshHostPolicy        HostPolicy
+		sshUserPolicy        UserPolicy
+		sshHostOptionsPolicy HostPolicy
+		sshUserOptionsPolicy UserPolicy
+		celPolicy            *policy.CELPolicyEngine
+		err                  error
 	)
 
 	// initialize the x509 allow/deny policy engine
@@ -45,10 +53,28 @@ func New(options *Options) (*Engine, error) {
 		return nil, err
 	}
 
+	// initialize the SSH critical options and extensions policy engine for host certificates
+	if sshHostOptionsPolicy, err = NewSSHHostOptionsPolicyEngine(options.GetSSHOptions()); err != nil {
+		return nil, err
+	}
+
+	// initialize the SSH critical options and extensions policy engine for user certificates
+	if sshUserOptionsPolicy, err = NewSSHUserOptionsPolicyEngine(options.GetSSHOptions()); err != nil {
+		return nil, err
+	}
+
+	// initialize the CEL expressions policy engine
+	if celPolicy, err = NewCELPolicyEngine(options.GetCELOptions()); err != nil {
+		return nil, err
+	}
+
 	return &Engine{
-		x509Policy:    x509Policy,
-		sshHostPolicy: sshHostPolicy,
-		sshUserPolicy: sshUserPolicy,
+		x509Policy:           x509Policy,
+		sshHostPolicy:        sshHostPolicy,
+		sshUserPolicy:        sshUserPolicy,
+		sshHostOptionsPolicy: sshHostOptionsPolicy,
+		sshUserOptionsPolicy: sshUserOptionsPolicy,
+		celPolicy:            celPolicy,
 	}, nil
 }
 
@@ -77,12 +103,50 @@ func (e *Engine) AreSANsAllowed(sans []string) error {
 	return e.x509Policy.AreSANsAllowed(sans)
 }
 
+// HasCELPolicy returns true if the engine contains CEL policy rules.
+func (e *Engine) HasCELPolicy() bool {
+	return e != nil && e.celPolicy != nil
+}
+
+// AreX509RulesSatisfied evaluates an X.509 certificate, the certificate
+// request and the rest of the request data against the CEL policy (if
+// configured) and returns an error if one of the rules is not satisfied.
+func (e *Engine) AreX509RulesSatisfied(cert *x509.Certificate, csr *x509.CertificateRequest, data *policy.CELData) error {
+	if e == nil {
+		return nil
+	}
+	return e.celPolicy.IsX509CertificateAllowed(cert, csr, data)
+}
+
+// AreSSHRulesSatisfied evaluates an SSH certificate and the rest of the
+// request data against the CEL policy (if configured) and returns an error
+// if one of the rules is not satisfied.
+func (e *Engine) AreSSHRulesSatisfied(cert *ssh.Certificate, data *policy.CELData) error {
+	if e == nil {
+		return nil
+	}
+	return e.celPolicy.IsSSHCertificateAllowed(cert, data)
+}
+
 // IsSSHCertificateAllowed evaluates an SSH certificate against the
 // user or host policy (if configured) and returns an error if one of the
-// principals in the certificate is not allowed.
+// principals, critical options or extensions in the certificate is not
+// allowed.
 func (e *Engine) IsSSHCertificateAllowed(cert *ssh.Certificate) error {
 	// return early if there's no policy to evaluate
-	if e == nil || (e.sshHostPolicy == nil && e.sshUserPolicy == nil) {
+	if e == nil {
+		return nil
+	}
+
+	// evaluate the critical options and extensions; these policies are
+	// independent of each other, so only the one for the type of the
+	// certificate is evaluated.
+	if err := e.areSSHOptionsAllowed(cert); err != nil {
+		return err
+	}
+
+	// return early if there's no name policy to evaluate
+	if e.sshHostPolicy == nil && e.sshUserPolicy == nil {
 		return nil
 	}
 
@@ -109,3 +173,16 @@ func (e *Engine) IsSSHCertificateAllowed(cert *ssh.Certificate) error {
 		return fmt.Errorf("unexpected SSH certificate type %q", cert.CertType)
 	}
 }
+
+// areSSHOptionsAllowed evaluates the critical options and extensions of an
+// SSH certificate against the user or host options policy (if configured).
+func (e *Engine) areSSHOptionsAllowed(cert *ssh.Certificate) error {
+	switch {
+	case cert.CertType == ssh.HostCert && e.sshHostOptionsPolicy != nil:
+		return e.sshHostOptionsPolicy.IsSSHCertificateAllowed(cert)
+	case cert.CertType == ssh.UserCert && e.sshUserOptionsPolicy != nil:
+		return e.sshUserOptionsPolicy.IsSSHCertificateAllowed(cert)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,83 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestEngine_IsSSHCertificateAllowed(t *testing.T) {
+	userCert := func(criticalOptions, extensions map[string]string) *ssh.Certificate {
+		return &ssh.Certificate{
+			CertType:        ssh.UserCert,
+			ValidPrincipals: []string{"jane"},
+			Permissions: ssh.Permissions{
+				CriticalOptions: criticalOptions,
+				Extensions:      extensions,
+			},
+		}
+	}
+	hostCert := &ssh.Certificate{
+		CertType:        ssh.HostCert,
+		ValidPrincipals: []string{"host.example.com"},
+		Permissions: ssh.Permissions{
+			Extensions: map[string]string{"permit-port-forwarding": ""},
+		},
+	}
+	optionsPolicy := &SSHPolicyOptions{
+		User: &SSHUserCertificateOptions{
+			CriticalOptions: &SSHCriticalOptions{
+				Require:         []string{"source-address"},
+				SourceAddresses: []string{"10.0.0.0/8"},
+			},
+			Extensions: &SSHExtensionOptions{
+				Deny: []string{"permit-port-forwarding"},
+			},
+		},
+	}
+	tests := []struct {
+		name    string
+		options *Options
+		cert    *ssh.Certificate
+		wantErr bool
+	}{
+		{"ok/no-policy", nil, userCert(nil, nil), false},
+		{"ok/user", &Options{SSH: optionsPolicy}, userCert(map[string]string{"source-address": "10.0.0.1"}, map[string]string{"permit-pty": ""}), false},
+		{"ok/host-without-options-policy", &Options{SSH: optionsPolicy}, hostCert, false},
+		{"ok/with-names", &Options{SSH: &SSHPolicyOptions{User: &SSHUserCertificateOptions{
+			AllowedNames: &SSHNameOptions{Principals: []string{"jane"}},
+			Extensions:   &SSHExtensionOptions{Allow: []string{"permit-pty"}},
+		}}}, userCert(nil, map[string]string{"permit-pty": ""}), false},
+		{"fail/required-critical-option", &Options{SSH: optionsPolicy}, userCert(nil, nil), true},
+		{"fail/source-address", &Options{SSH: optionsPolicy}, userCert(map[string]string{"source-address": "192.168.0.1"}, nil), true},
+		{"fail/denied-extension", &Options{SSH: optionsPolicy}, userCert(map[string]string{"source-address": "10.0.0.1"}, map[string]string{"permit-port-forwarding": ""}), true},
+		{"fail/with-names", &Options{SSH: &SSHPolicyOptions{User: &SSHUserCertificateOptions{
+			AllowedNames: &SSHNameOptions{Principals: []string{"john"}},
+			Extensions:   &SSHExtensionOptions{Allow: []string{"permit-pty"}},
+		}}}, userCert(nil, map[string]string{"permit-pty": ""}), true},
+		{"fail/host-with-user-name-policy", &Options{SSH: &SSHPolicyOptions{User: &SSHUserCertificateOptions{
+			AllowedNames: &SSHNameOptions{Principals: []string{"jane"}},
+		}}}, hostCert, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.options)
+			require.NoError(t, err)
+			err = e.IsSSHCertificateAllowed(tt.cert)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestNew_sshOptionsError(t *testing.T) {
+	_, err := New(&Options{SSH: &SSHPolicyOptions{Host: &SSHHostCertificateOptions{
+		CriticalOptions: &SSHCriticalOptions{SourceAddresses: []string{"not-an-ip"}},
+	}}})
+	assert.Error(t, err)
+}
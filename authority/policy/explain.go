@@ -0,0 +1,118 @@
+package policy
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/policy"
+)
+
+// Explanation describes how the name policy of a single layer (the
+// authority, a provisioner or an ACME account) decides on a request.
+// Configured is false when the layer has no name policy for the type
+// of request, in which case the request is allowed by that layer.
+type Explanation struct {
+	Configured bool                     `json:"configured"`
+	Allowed    bool                     `json:"allowed"`
+	Error      string                   `json:"error,omitempty"`
+	Names      []policy.NameExplanation `json:"names,omitempty"`
+}
+
+// ExplainX509CertificateRequest explains the decision of an X.509 name
+// policy for the names in a CSR.
+func ExplainX509CertificateRequest(p X509Policy, csr *x509.CertificateRequest) *Explanation {
+	explainer, ok := p.(policy.NamePolicyExplainer)
+	if !ok {
+		return notConfigured()
+	}
+	return configured(explainer.ExplainX509CertificateRequest(csr))
+}
+
+// ExplainSANs explains the decision of an X.509 name policy for a slice of
+// SANs.
+func ExplainSANs(p X509Policy, sans []string) *Explanation {
+	explainer, ok := p.(policy.NamePolicyExplainer)
+	if !ok {
+		return notConfigured()
+	}
+	return configured(explainer.ExplainSANs(sans))
+}
+
+// ExplainX509CertificateRequest explains the decision of the X.509 policy
+// (if available) for the names in a CSR.
+func (e *Engine) ExplainX509CertificateRequest(csr *x509.CertificateRequest) *Explanation {
+	if e == nil {
+		return notConfigured()
+	}
+	return ExplainX509CertificateRequest(e.x509Policy, csr)
+}
+
+// ExplainSANs explains the decision of the X.509 policy (if available) for
+// a slice of SANs.
+func (e *Engine) ExplainSANs(sans []string) *Explanation {
+	if e == nil {
+		return notConfigured()
+	}
+	return ExplainSANs(e.x509Policy, sans)
+}
+
+// ExplainSSHCertificate explains the decision of the SSH user or host policy
+// (if configured) for the principals in an SSH certificate. Only the name
+// policies are explained; critical options and extensions are not.
+func (e *Engine) ExplainSSHCertificate(cert *ssh.Certificate) *Explanation {
+	// return early if there's no name policy to explain
+	if e == nil || (e.sshHostPolicy == nil && e.sshUserPolicy == nil) {
+		return notConfigured()
+	}
+
+	var p policy.SSHNamePolicyEngine
+	switch cert.CertType {
+	case ssh.HostCert:
+		if e.sshHostPolicy == nil {
+			return denied("authority not allowed to sign SSH host certificates when SSH user certificate policy is active")
+		}
+		p = e.sshHostPolicy
+	case ssh.UserCert:
+		if e.sshUserPolicy == nil {
+			return denied("authority not allowed to sign SSH user certificates when SSH host certificate policy is active")
+		}
+		p = e.sshUserPolicy
+	default:
+		return denied(fmt.Sprintf("unexpected SSH certificate type %d", cert.CertType))
+	}
+
+	explainer, ok := p.(policy.NamePolicyExplainer)
+	if !ok {
+		return notConfigured()
+	}
+
+	exp, err := explainer.ExplainSSHCertificate(cert)
+	if err != nil {
+		return denied(err.Error())
+	}
+
+	return configured(exp)
+}
+
+func notConfigured() *Explanation {
+	return &Explanation{
+		Allowed: true,
+	}
+}
+
+func configured(exp *policy.Explanation) *Explanation {
+	return &Explanation{
+		Configured: true,
+		Allowed:    exp.Allowed,
+		Names:      exp.Names,
+	}
+}
+
+func denied(reason string) *Explanation {
+	return &Explanation{
+		Configured: true,
+		Error:      reason,
+	}
+}
@@ -0,0 +1,94 @@
+package policy
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/policy"
+)
+
+func TestEngine_ExplainSANs(t *testing.T) {
+	engine, err := New(&Options{
+		X509: &X509PolicyOptions{
+			AllowedNames: &X509NameOptions{DNSDomains: []string{"*.example.com"}},
+			DeniedNames:  &X509NameOptions{DNSDomains: []string{"db.example.com"}},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		engine *Engine
+		sans   []string
+		want   *Explanation
+	}{
+		{"ok/nil-engine", nil, []string{"www.example.com"}, &Explanation{Allowed: true}},
+		{"ok/no-x509-policy", &Engine{}, []string{"www.example.com"}, &Explanation{Allowed: true}},
+		{"ok/allowed", engine, []string{"www.example.com"}, &Explanation{Configured: true, Allowed: true, Names: []policy.NameExplanation{
+			{NameType: policy.DNSNameType, Name: "www.example.com", Allowed: true, RuleType: policy.AllowRule, Rule: ".example.com"},
+		}}},
+		{"ok/denied", engine, []string{"db.example.com"}, &Explanation{Configured: true, Allowed: false, Names: []policy.NameExplanation{
+			{NameType: policy.DNSNameType, Name: "db.example.com", Allowed: false, RuleType: policy.DenyRule, Rule: "db.example.com",
+				Detail: `dns "db.example.com" is excluded by constraint "db.example.com"`},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.engine.ExplainSANs(tt.sans))
+		})
+	}
+}
+
+func TestEngine_ExplainX509CertificateRequest(t *testing.T) {
+	engine, err := New(&Options{
+		X509: &X509PolicyOptions{
+			AllowedNames: &X509NameOptions{CommonNames: []string{"My Service"}, DNSDomains: []string{"*.example.com"}},
+		},
+	})
+	require.NoError(t, err)
+
+	csr := &x509.CertificateRequest{DNSNames: []string{"www.example.com"}}
+	csr.Subject.CommonName = "My Service"
+	assert.Equal(t, &Explanation{Configured: true, Allowed: true, Names: []policy.NameExplanation{
+		{NameType: policy.DNSNameType, Name: "www.example.com", Allowed: true, RuleType: policy.AllowRule, Rule: ".example.com"},
+		{NameType: policy.CNNameType, Name: "My Service", Allowed: true, RuleType: policy.AllowRule, Rule: "my service"},
+	}}, engine.ExplainX509CertificateRequest(csr))
+}
+
+func TestEngine_ExplainSSHCertificate(t *testing.T) {
+	userOnly, err := New(&Options{
+		SSH: &SSHPolicyOptions{
+			User: &SSHUserCertificateOptions{
+				AllowedNames: &SSHNameOptions{Principals: []string{"jane"}},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		engine *Engine
+		cert   *ssh.Certificate
+		want   *Explanation
+	}{
+		{"ok/no-ssh-policy", &Engine{}, &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"jane"}},
+			&Explanation{Allowed: true}},
+		{"ok/user", userOnly, &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"jane"}},
+			&Explanation{Configured: true, Allowed: true, Names: []policy.NameExplanation{
+				{NameType: policy.PrincipalNameType, Name: "jane", Allowed: true, RuleType: policy.AllowRule, Rule: "jane"},
+			}}},
+		{"fail/host-without-host-policy", userOnly, &ssh.Certificate{CertType: ssh.HostCert, ValidPrincipals: []string{"host.example.com"}},
+			&Explanation{Configured: true, Error: "authority not allowed to sign SSH host certificates when SSH user certificate policy is active"}},
+		{"fail/unexpected-principals", userOnly, &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"https://example.com"}},
+			&Explanation{Configured: true, Error: "URL principals [https://example.com] not expected in SSH user certificate "}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.engine.ExplainSSHCertificate(tt.cert))
+		})
+	}
+}
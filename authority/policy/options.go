@@ -5,6 +5,7 @@ package policy
 type Options struct {
 	X509 *X509PolicyOptions `json:"x509,omitempty"`
 	SSH  *SSHPolicyOptions  `json:"ssh,omitempty"`
+	CEL  *CELPolicy         `json:"cel,omitempty"`
 }
 
 // GetX509Options returns the x509 authority level policy
@@ -25,6 +26,15 @@ func (o *Options) GetSSHOptions() *SSHPolicyOptions {
 	return o.SSH
 }
 
+// GetCELOptions returns the CEL authority level policy
+// configuration
+func (o *Options) GetCELOptions() *CELPolicy {
+	if o == nil {
+		return nil
+	}
+	return o.CEL
+}
+
 // X509PolicyOptionsInterface is an interface for providers
 // of x509 allowed and denied names.
 type X509PolicyOptionsInterface interface {
@@ -98,6 +108,10 @@ type SSHPolicyOptionsInterface interface {
 	GetDeniedUserNameOptions() *SSHNameOptions
 	GetAllowedHostNameOptions() *SSHNameOptions
 	GetDeniedHostNameOptions() *SSHNameOptions
+	GetUserCriticalOptions() *SSHCriticalOptions
+	GetUserExtensions() *SSHExtensionOptions
+	GetHostCriticalOptions() *SSHCriticalOptions
+	GetHostExtensions() *SSHExtensionOptions
 }
 
 // SSHPolicyOptions is a container for SSH user and host policy
@@ -145,12 +159,52 @@ func (o *SSHPolicyOptions) GetDeniedHostNameOptions() *SSHNameOptions {
 	return o.Host.DeniedNames
 }
 
+// GetUserCriticalOptions returns the SSH user certificate critical options
+// policy configuration.
+func (o *SSHPolicyOptions) GetUserCriticalOptions() *SSHCriticalOptions {
+	if o == nil || o.User == nil {
+		return nil
+	}
+	return o.User.CriticalOptions
+}
+
+// GetUserExtensions returns the SSH user certificate extensions policy
+// configuration.
+func (o *SSHPolicyOptions) GetUserExtensions() *SSHExtensionOptions {
+	if o == nil || o.User == nil {
+		return nil
+	}
+	return o.User.Extensions
+}
+
+// GetHostCriticalOptions returns the SSH host certificate critical options
+// policy configuration.
+func (o *SSHPolicyOptions) GetHostCriticalOptions() *SSHCriticalOptions {
+	if o == nil || o.Host == nil {
+		return nil
+	}
+	return o.Host.CriticalOptions
+}
+
+// GetHostExtensions returns the SSH host certificate extensions policy
+// configuration.
+func (o *SSHPolicyOptions) GetHostExtensions() *SSHExtensionOptions {
+	if o == nil || o.Host == nil {
+		return nil
+	}
+	return o.Host.Extensions
+}
+
 // SSHUserCertificateOptions is a collection of SSH user certificate options.
 type SSHUserCertificateOptions struct {
 	// AllowedNames contains the names the provisioner is authorized to sign
 	AllowedNames *SSHNameOptions `json:"allow,omitempty"`
 	// DeniedNames contains the names the provisioner is not authorized to sign
 	DeniedNames *SSHNameOptions `json:"deny,omitempty"`
+	// CriticalOptions contains the critical options policy
+	CriticalOptions *SSHCriticalOptions `json:"criticalOptions,omitempty"`
+	// Extensions contains the extensions policy
+	Extensions *SSHExtensionOptions `json:"extensions,omitempty"`
 }
 
 // SSHHostCertificateOptions is a collection of SSH host certificate options.
@@ -192,3 +246,166 @@ func (o *SSHNameOptions) HasNames() bool {
 		len(o.EmailAddresses) > 0 ||
 		len(o.Principals) > 0
 }
+
+// SSHCriticalOptions models the SSH critical options policy configuration.
+// Critical options in Allow and Require are allowed; if Allow is empty, all
+// critical options not in Deny are allowed. The values of the force-command
+// and source-address critical options can be constrained with ForceCommands
+// and SourceAddresses.
+type SSHCriticalOptions struct {
+	Allow           []string `json:"allow,omitempty"`
+	Deny            []string `json:"deny,omitempty"`
+	Require         []string `json:"require,omitempty"`
+	ForceCommands   []string `json:"forceCommand,omitempty"`
+	SourceAddresses []string `json:"sourceAddress,omitempty"`
+}
+
+// HasOptions checks if the SSHCriticalOptions has one or more
+// constraints configured.
+func (o *SSHCriticalOptions) HasOptions() bool {
+	return o != nil && (len(o.Allow) > 0 ||
+		len(o.Deny) > 0 ||
+		len(o.Require) > 0 ||
+		len(o.ForceCommands) > 0 ||
+		len(o.SourceAddresses) > 0)
+}
+
+// SSHExtensionOptions models the SSH extensions policy configuration.
+// Extensions in Allow and Require are allowed; if Allow is empty, all
+// extensions not in Deny are allowed.
+type SSHExtensionOptions struct {
+	Allow   []string `json:"allow,omitempty"`
+	Deny    []string `json:"deny,omitempty"`
+	Require []string `json:"require,omitempty"`
+}
+
+// HasOptions checks if the SSHExtensionOptions has one or more
+// constraints configured.
+func (o *SSHExtensionOptions) HasOptions() bool {
+	return o != nil && (len(o.Allow) > 0 ||
+		len(o.Deny) > 0 ||
+		len(o.Require) > 0)
+}
+
+// SSHOptionsPolicy models the SSH critical options and extensions policy of
+// user and host certificates. The linkedca policy managed with the admin API
+// can only contain names, so this policy is managed separately.
+type SSHOptionsPolicy struct {
+	// User contains the SSH user certificate critical options and extensions policy.
+	User *SSHCertificateOptionsPolicy `json:"user,omitempty"`
+	// Host contains the SSH host certificate critical options and extensions policy.
+	Host *SSHCertificateOptionsPolicy `json:"host,omitempty"`
+}
+
+// SSHCertificateOptionsPolicy is a collection of SSH critical options and
+// extensions policies.
+type SSHCertificateOptionsPolicy struct {
+	CriticalOptions *SSHCriticalOptions  `json:"criticalOptions,omitempty"`
+	Extensions      *SSHExtensionOptions `json:"extensions,omitempty"`
+}
+
+// Validate validates the SSH critical options and extensions policy.
+func (p *SSHOptionsPolicy) Validate() error {
+	options := new(SSHPolicyOptions).WithSSHOptionsPolicy(p)
+	if _, err := NewSSHUserOptionsPolicyEngine(options); err != nil {
+		return err
+	}
+	if _, err := NewSSHHostOptionsPolicyEngine(options); err != nil {
+		return err
+	}
+	return nil
+}
+
+// WithSSHOptionsPolicy sets the critical options and extensions policy of the
+// authority level policy configuration and returns it. If the configuration
+// is nil, a new one is returned.
+func (o *Options) WithSSHOptionsPolicy(p *SSHOptionsPolicy) *Options {
+	if p == nil {
+		return o
+	}
+	if o == nil {
+		o = &Options{}
+	}
+	o.SSH = o.SSH.WithSSHOptionsPolicy(p)
+	return o
+}
+
+// WithSSHOptionsPolicy sets the critical options and extensions policy of the
+// SSH policy configuration and returns it. If the configuration is nil, a
+// new one is returned.
+func (o *SSHPolicyOptions) WithSSHOptionsPolicy(p *SSHOptionsPolicy) *SSHPolicyOptions {
+	if p == nil {
+		return o
+	}
+	if o == nil {
+		o = &SSHPolicyOptions{}
+	}
+	if user := p.User; user != nil {
+		if o.User == nil {
+			o.User = &SSHUserCertificateOptions{}
+		}
+		o.User.CriticalOptions = user.CriticalOptions
+		o.User.Extensions = user.Extensions
+	}
+	if host := p.Host; host != nil {
+		if o.Host == nil {
+			o.Host = &SSHHostCertificateOptions{}
+		}
+		o.Host.CriticalOptions = host.CriticalOptions
+		o.Host.Extensions = host.Extensions
+	}
+	return o
+}
+
+// CELPolicy models issuance policy rules written as CEL expressions. A
+// certificate is only issued if the expressions of all the rules for its
+// kind evaluate to true. The linkedca policy managed with the admin API
+// can only contain names, so this policy is managed separately.
+type CELPolicy struct {
+	// X509 contains the rules for X.509 certificates.
+	X509 []CELRule `json:"x509,omitempty"`
+	// SSH contains the rules for SSH certificates.
+	SSH []CELRule `json:"ssh,omitempty"`
+}
+
+// CELRule is a named CEL expression. The expression can use the variables
+// cert, csr, provisioner, token, attestation and account.
+type CELRule struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+	// Message is added to the error returned when the rule is not satisfied.
+	Message string `json:"message,omitempty"`
+}
+
+// HasRules returns true if the policy contains at least one rule.
+func (p *CELPolicy) HasRules() bool {
+	return p != nil && (len(p.X509) > 0 || len(p.SSH) > 0)
+}
+
+// Validate validates the CEL policy, compiling all the expressions.
+func (p *CELPolicy) Validate() error {
+	_, err := NewCELPolicyEngine(p)
+	return err
+}
+
+// WithCELPolicy sets the CEL policy of the authority level policy
+// configuration and returns it. If the configuration is nil, a new one is
+// returned.
+func (o *Options) WithCELPolicy(p *CELPolicy) *Options {
+	if p == nil {
+		return o
+	}
+	if o == nil {
+		o = &Options{}
+	}
+	o.CEL = p
+	return o
+}
+
+// CELPolicyScope identifies the level a CEL policy is configured at. The
+// zero value refers to the authority, a provisioner ID to a provisioner,
+// and a provisioner ID with an ACME account ID to an ACME account.
+type CELPolicyScope struct {
+	ProvisionerID string `json:"provisionerID,omitempty"`
+	ACMEAccountID string `json:"acmeAccountID,omitempty"`
+}
@@ -144,6 +144,99 @@ func newSSHPolicyEngine(policyOptions SSHPolicyOptionsInterface, typ sshPolicyEn
 	return policy.New(options...)
 }
 
+// NewSSHUserOptionsPolicyEngine creates a new SSH user certificate critical
+// options and extensions policy engine
+func NewSSHUserOptionsPolicyEngine(policyOptions SSHPolicyOptionsInterface) (UserPolicy, error) {
+	policyEngine, err := newSSHOptionsPolicyEngine(policyOptions, UserPolicyEngineType)
+	if err != nil {
+		return nil, err
+	}
+	return policyEngine, nil
+}
+
+// NewSSHHostOptionsPolicyEngine creates a new SSH host certificate critical
+// options and extensions policy engine
+func NewSSHHostOptionsPolicyEngine(policyOptions SSHPolicyOptionsInterface) (HostPolicy, error) {
+	policyEngine, err := newSSHOptionsPolicyEngine(policyOptions, HostPolicyEngineType)
+	if err != nil {
+		return nil, err
+	}
+	return policyEngine, nil
+}
+
+// newSSHOptionsPolicyEngine creates a new SSH critical options and extensions
+// policy engine
+func newSSHOptionsPolicyEngine(policyOptions SSHPolicyOptionsInterface, typ sshPolicyEngineType) (policy.SSHNamePolicyEngine, error) {
+	// return early if no policy engine options to configure
+	if policyOptions == nil {
+		//nolint:nilnil,nolintlint // expected values
+		return nil, nil
+	}
+
+	var (
+		criticalOptions *SSHCriticalOptions
+		extensions      *SSHExtensionOptions
+	)
+
+	switch typ {
+	case UserPolicyEngineType:
+		criticalOptions = policyOptions.GetUserCriticalOptions()
+		extensions = policyOptions.GetUserExtensions()
+	case HostPolicyEngineType:
+		criticalOptions = policyOptions.GetHostCriticalOptions()
+		extensions = policyOptions.GetHostExtensions()
+	default:
+		return nil, fmt.Errorf("unknown SSH policy engine type %s provided", typ)
+	}
+
+	options := []policy.SSHOptionsPolicyOption{}
+
+	if criticalOptions.HasOptions() {
+		options = append(options,
+			policy.WithPermittedCriticalOptions(criticalOptions.Allow...),
+			policy.WithExcludedCriticalOptions(criticalOptions.Deny...),
+			policy.WithRequiredCriticalOptions(criticalOptions.Require...),
+			policy.WithPermittedForceCommands(criticalOptions.ForceCommands...),
+			policy.WithPermittedSourceAddresses(criticalOptions.SourceAddresses...),
+		)
+	}
+
+	if extensions.HasOptions() {
+		options = append(options,
+			policy.WithPermittedExtensions(extensions.Allow...),
+			policy.WithExcludedExtensions(extensions.Deny...),
+			policy.WithRequiredExtensions(extensions.Require...),
+		)
+	}
+
+	// ensure no policy engine is returned when no options were provided
+	if len(options) == 0 {
+		//nolint:nilnil,nolintlint // expected values
+		return nil, nil
+	}
+
+	return policy.NewSSHOptionsPolicyEngine(options...)
+}
+
+// NewCELPolicyEngine creates a new CEL policy engine. No engine is returned
+// if the policy doesn't have rules.
+func NewCELPolicyEngine(p *CELPolicy) (*policy.CELPolicyEngine, error) {
+	if !p.HasRules() {
+		//nolint:nilnil,nolintlint // expected values
+		return nil, nil
+	}
+
+	options := []policy.CELPolicyOption{}
+	for _, r := range p.X509 {
+		options = append(options, policy.WithX509CELRule(r.Name, r.Expression, r.Message))
+	}
+	for _, r := range p.SSH {
+		options = append(options, policy.WithSSHCELRule(r.Name, r.Expression, r.Message))
+	}
+
+	return policy.NewCELPolicyEngine(options...)
+}
+
 func LinkedToCertificates(p *linkedca.Policy) *Options {
 	// return early
 	if p == nil {
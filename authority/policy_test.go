@@ -8,6 +8,7 @@ import (
 
 	"github.com/go-jose/go-jose/v3"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
 
 	"github.com/smallstep/linkedca"
 
@@ -866,6 +867,100 @@ func TestAuthority_reloadPolicyEngines(t *testing.T) {
 	}
 }
 
+type mockSSHOptionsPolicyDB struct {
+	*admin.MockDB
+	MockGetSSHOptionsPolicies func(ctx context.Context) (map[string]*policy.SSHOptionsPolicy, error)
+}
+
+func (m *mockSSHOptionsPolicyDB) GetSSHOptionsPolicy(ctx context.Context, provisionerID string) (*policy.SSHOptionsPolicy, error) {
+	policies, err := m.GetSSHOptionsPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return policies[provisionerID], nil
+}
+
+func (m *mockSSHOptionsPolicyDB) GetSSHOptionsPolicies(ctx context.Context) (map[string]*policy.SSHOptionsPolicy, error) {
+	return m.MockGetSSHOptionsPolicies(ctx)
+}
+
+func (m *mockSSHOptionsPolicyDB) UpdateSSHOptionsPolicy(context.Context, string, *policy.SSHOptionsPolicy) error {
+	return nil
+}
+
+func (m *mockSSHOptionsPolicyDB) DeleteSSHOptionsPolicy(context.Context, string) error {
+	return nil
+}
+
+func TestAuthority_reloadPolicyEngines_sshOptions(t *testing.T) {
+	adminDB := &mockSSHOptionsPolicyDB{
+		MockDB: &admin.MockDB{
+			MockGetAuthorityPolicy: func(ctx context.Context) (*linkedca.Policy, error) {
+				return nil, admin.NewError(admin.ErrorNotFoundType, "not found")
+			},
+		},
+		MockGetSSHOptionsPolicies: func(ctx context.Context) (map[string]*policy.SSHOptionsPolicy, error) {
+			return map[string]*policy.SSHOptionsPolicy{
+				"": {
+					Host: &policy.SSHCertificateOptionsPolicy{
+						Extensions: &policy.SSHExtensionOptions{
+							Deny: []string{"permit-pty"},
+						},
+					},
+				},
+				"provID": {
+					User: &policy.SSHCertificateOptionsPolicy{
+						CriticalOptions: &policy.SSHCriticalOptions{
+							ForceCommands: []string{"/usr/bin/backup"},
+						},
+					},
+				},
+			}, nil
+		},
+	}
+	a := &Authority{
+		config: &config.Config{
+			AuthorityConfig: &config.AuthConfig{
+				EnableAdmin: true,
+			},
+		},
+		adminDB: adminDB,
+	}
+	assert.NoError(t, a.reloadPolicyEngines(context.Background()))
+
+	prov := &provisioner.JWK{ID: "provID"}
+	otherProv := &provisioner.JWK{ID: "otherProvID"}
+	userCert := &ssh.Certificate{
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"backup"},
+		Permissions: ssh.Permissions{
+			CriticalOptions: map[string]string{"force-command": "/bin/sh"},
+		},
+	}
+	hostCert := &ssh.Certificate{
+		CertType:        ssh.HostCert,
+		ValidPrincipals: []string{"host.local"},
+		Permissions: ssh.Permissions{
+			Extensions: map[string]string{"permit-pty": ""},
+		},
+	}
+
+	// the provisioner policy only applies to the provisioner
+	assert.Error(t, a.isAllowedToSignSSHCertificate(prov, userCert))
+	assert.NoError(t, a.isAllowedToSignSSHCertificate(otherProv, userCert))
+	assert.NoError(t, a.isAllowedToSignSSHCertificate(nil, userCert))
+
+	// the authority policy applies to all provisioners
+	assert.Error(t, a.isAllowedToSignSSHCertificate(prov, hostCert))
+	assert.Error(t, a.isAllowedToSignSSHCertificate(otherProv, hostCert))
+
+	// failing to load the SSH options policies fails the reload
+	adminDB.MockGetSSHOptionsPolicies = func(ctx context.Context) (map[string]*policy.SSHOptionsPolicy, error) {
+		return nil, errors.New("force")
+	}
+	assert.Error(t, a.reloadPolicyEngines(context.Background()))
+}
+
 func TestAuthority_checkAuthorityPolicy(t *testing.T) {
 	type fields struct {
 		provisioners *provisioner.Collection
@@ -1627,3 +1722,103 @@ func TestAuthority_UpdateAuthorityPolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthority_ExplainPolicy(t *testing.T) {
+	authorityEngine, err := policy.New(&policy.Options{
+		X509: &policy.X509PolicyOptions{
+			AllowedNames: &policy.X509NameOptions{DNSDomains: []string{"*.example.com", "*.internal"}},
+		},
+	})
+	assert.NoError(t, err)
+	a := &Authority{policyEngine: authorityEngine}
+
+	prov := &linkedca.Provisioner{
+		Name: "acme",
+		Policy: &linkedca.Policy{
+			X509: &linkedca.X509Policy{
+				Deny: &linkedca.X509Names{Dns: []string{"*.internal"}},
+			},
+		},
+	}
+	accountPolicy := &policy.X509PolicyOptions{
+		AllowedNames: &policy.X509NameOptions{DNSDomains: []string{"www.example.com"}},
+	}
+
+	t.Run("ok/authority", func(t *testing.T) {
+		got, err := a.ExplainPolicy(context.Background(), &PolicyExplainRequest{
+			SANs: []string{"www.example.com"},
+		})
+		assert.NoError(t, err)
+		assert.True(t, got.Allowed)
+		if assert.Len(t, got.Layers, 1) {
+			assert.Equal(t, AuthorityPolicyLayer, got.Layers[0].Layer)
+			assert.True(t, got.Layers[0].Configured)
+			assert.Equal(t, ".example.com", got.Layers[0].Names[0].Rule)
+		}
+	})
+
+	t.Run("ok/provisioner-denied", func(t *testing.T) {
+		got, err := a.ExplainPolicy(context.Background(), &PolicyExplainRequest{
+			SANs:        []string{"db.internal"},
+			Provisioner: prov,
+		})
+		assert.NoError(t, err)
+		assert.False(t, got.Allowed)
+		if assert.Len(t, got.Layers, 2) {
+			assert.True(t, got.Layers[0].Allowed)
+			assert.Equal(t, ProvisionerPolicyLayer, got.Layers[1].Layer)
+			assert.Equal(t, "acme", got.Layers[1].Name)
+			assert.False(t, got.Layers[1].Allowed)
+			assert.Equal(t, ".internal", got.Layers[1].Names[0].Rule)
+		}
+	})
+
+	t.Run("ok/acme-account", func(t *testing.T) {
+		got, err := a.ExplainPolicy(context.Background(), &PolicyExplainRequest{
+			SANs:              []string{"api.example.com"},
+			Provisioner:       prov,
+			ACMEAccountID:     "accountID",
+			ACMEAccountPolicy: accountPolicy,
+		})
+		assert.NoError(t, err)
+		assert.False(t, got.Allowed)
+		if assert.Len(t, got.Layers, 3) {
+			assert.True(t, got.Layers[0].Allowed)
+			assert.True(t, got.Layers[1].Allowed)
+			assert.Equal(t, ACMEAccountPolicyLayer, got.Layers[2].Layer)
+			assert.Equal(t, "accountID", got.Layers[2].Name)
+			assert.False(t, got.Layers[2].Allowed)
+		}
+	})
+
+	t.Run("ok/acme-account-ssh", func(t *testing.T) {
+		got, err := a.ExplainPolicy(context.Background(), &PolicyExplainRequest{
+			SSHCertificate: &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"jane"}},
+			ACMEAccountID:  "accountID",
+		})
+		assert.NoError(t, err)
+		assert.True(t, got.Allowed)
+		if assert.Len(t, got.Layers, 2) {
+			assert.False(t, got.Layers[0].Configured)
+			assert.False(t, got.Layers[1].Configured)
+		}
+	})
+
+	t.Run("fail/provisioner-policy", func(t *testing.T) {
+		_, err := a.ExplainPolicy(context.Background(), &PolicyExplainRequest{
+			SANs: []string{"www.example.com"},
+			Provisioner: &linkedca.Provisioner{
+				Name: "bad",
+				Policy: &linkedca.Policy{
+					X509: &linkedca.X509Policy{
+						Allow: &linkedca.X509Names{Ips: []string{"10.0.0.0/33"}},
+					},
+				},
+			},
+		})
+		var pe *PolicyError
+		if assert.True(t, errors.As(err, &pe)) {
+			assert.Equal(t, ConfigurationFailure, pe.Typ)
+		}
+	})
+}
@@ -81,6 +81,61 @@ func (f ACMEAttestationFormat) Validate() error {
 	}
 }
 
+const (
+	// DefaultACMEAutoRenewalMinLifetime is the default minimum lifetime of the
+	// certificates issued by STAR orders.
+	DefaultACMEAutoRenewalMinLifetime = time.Hour
+	// DefaultACMEAutoRenewalMaxDuration is the default maximum duration of a
+	// STAR order.
+	DefaultACMEAutoRenewalMaxDuration = 365 * 24 * time.Hour
+)
+
+// ACMEAutoRenewal contains the configuration of the short-term, automatically
+// renewed (STAR) certificates of an ACME provisioner.
+type ACMEAutoRenewal struct {
+	// MinLifetime is the minimum lifetime of the certificates that can be
+	// requested. Defaults to 1h.
+	MinLifetime *Duration `json:"minLifetime,omitempty"`
+	// MaxDuration is the maximum time between the start and end date of a
+	// STAR order. Defaults to 365 days.
+	MaxDuration *Duration `json:"maxDuration,omitempty"`
+	// AllowCertificateGet allows clients to request that the certificates
+	// can be fetched using unauthenticated GET requests.
+	AllowCertificateGet bool `json:"allowCertificateGet,omitempty"`
+}
+
+// GetMinLifetime returns the minimum lifetime of a STAR certificate.
+func (a *ACMEAutoRenewal) GetMinLifetime() time.Duration {
+	if a == nil || a.MinLifetime == nil || a.MinLifetime.Duration == 0 {
+		return DefaultACMEAutoRenewalMinLifetime
+	}
+	return a.MinLifetime.Duration
+}
+
+// GetMaxDuration returns the maximum duration of a STAR order.
+func (a *ACMEAutoRenewal) GetMaxDuration() time.Duration {
+	if a == nil || a.MaxDuration == nil || a.MaxDuration.Duration == 0 {
+		return DefaultACMEAutoRenewalMaxDuration
+	}
+	return a.MaxDuration.Duration
+}
+
+// Validate returns an error if the auto-renewal configuration is not valid.
+func (a *ACMEAutoRenewal) Validate() error {
+	switch {
+	case a == nil:
+		return nil
+	case a.MinLifetime != nil && a.MinLifetime.Duration < 0:
+		return errors.New("autoRenewal.minLifetime cannot be negative")
+	case a.MaxDuration != nil && a.MaxDuration.Duration < 0:
+		return errors.New("autoRenewal.maxDuration cannot be negative")
+	case a.GetMinLifetime() > a.GetMaxDuration():
+		return errors.New("autoRenewal.minLifetime cannot be greater than autoRenewal.maxDuration")
+	default:
+		return nil
+	}
+}
+
 // ACME is the acme provisioner type, an entity that can authorize the ACME
 // provisioning flow.
 type ACME struct {
@@ -117,9 +172,19 @@ type ACME struct {
 	// AttestationRoots contains a bundle of root certificates in PEM format
 	// that will be used to verify the attestation certificates. If provided,
 	// this bundle will be used even for well-known CAs like Apple and Yubico.
-	AttestationRoots    []byte   `json:"attestationRoots,omitempty"`
-	Claims              *Claims  `json:"claims,omitempty"`
-	Options             *Options `json:"options,omitempty"`
+	AttestationRoots []byte `json:"attestationRoots,omitempty"`
+	// AuthorizationReuse is the maximum age of a valid authorization that
+	// can be reused in new orders of the same account for the same
+	// identifier. It also enables pre-authorization using the newAuthz
+	// resource. Valid authorizations expire this long after their validation.
+	// If not set, every order creates new authorizations.
+	AuthorizationReuse *Duration `json:"authorizationReuse,omitempty"`
+	// AutoRenewal enables short-term, automatically renewed (STAR)
+	// certificates as defined in RFC 8739. If not set, orders requesting
+	// auto-renewal are rejected.
+	AutoRenewal         *ACMEAutoRenewal `json:"autoRenewal,omitempty"`
+	Claims              *Claims          `json:"claims,omitempty"`
+	Options             *Options         `json:"options,omitempty"`
 	attestationRootPool *x509.CertPool
 	ctl                 *Controller
 }
@@ -170,6 +235,16 @@ func (p *ACME) DefaultTLSCertDuration() time.Duration {
 	return p.ctl.Claimer.DefaultTLSCertDuration()
 }
 
+// AuthorizationReuseAge returns the maximum age of a valid authorization that
+// can be reused in a new order. It returns 0 if authorization reuse is
+// disabled.
+func (p *ACME) AuthorizationReuseAge() time.Duration {
+	if p.AuthorizationReuse == nil {
+		return 0
+	}
+	return p.AuthorizationReuse.Duration
+}
+
 // Init initializes and validates the fields of an ACME type.
 func (p *ACME) Init(config Config) (err error) {
 	switch {
@@ -189,6 +264,12 @@ func (p *ACME) Init(config Config) (err error) {
 			return err
 		}
 	}
+	if p.AuthorizationReuse != nil && p.AuthorizationReuse.Duration < 0 {
+		return errors.New("authorizationReuse cannot be negative")
+	}
+	if err := p.AutoRenewal.Validate(); err != nil {
+		return err
+	}
 
 	// Parse attestation roots.
 	// The pool will be nil if there are no roots.
@@ -127,6 +127,24 @@ MCowBQYDK2VwAyEA5c+4NKZSNQcR1T8qN6SjwgdPZQ0Ge12Ylx/YeGAJ35k=
 				err: errors.New("claims: MinTLSCertDuration must be greater than 0"),
 			}
 		},
+		"fail/negative-authorization-reuse": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "ACME", AuthorizationReuse: &Duration{-time.Hour}},
+				err: errors.New("authorizationReuse cannot be negative"),
+			}
+		},
+		"fail/negative-auto-renewal-lifetime": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "ACME", AutoRenewal: &ACMEAutoRenewal{MinLifetime: &Duration{-time.Hour}}},
+				err: errors.New("autoRenewal.minLifetime cannot be negative"),
+			}
+		},
+		"fail/auto-renewal-lifetime-greater-than-duration": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "ACME", AutoRenewal: &ACMEAutoRenewal{MinLifetime: &Duration{48 * time.Hour}, MaxDuration: &Duration{24 * time.Hour}}},
+				err: errors.New("autoRenewal.minLifetime cannot be greater than autoRenewal.maxDuration"),
+			}
+		},
 		"fail/bad-challenge": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p:   &ACME{Name: "foo", Type: "ACME", Challenges: []ACMEChallenge{HTTP_01, "zar"}},
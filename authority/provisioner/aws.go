@@ -666,12 +666,16 @@ func (p *AWS) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 		&sshDefaultDuration{p.ctl.Claimer},
 		// Validate public key
 		&sshDefaultPublicKeyValidator{},
+		// Validate security keys and their attestation.
+		p.ctl.sshSecurityKey,
 		// Validate the validity period.
 		&sshCertValidityValidator{p.ctl.Claimer},
 		// Require all the fields in the SSH certificate
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
 		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), nil),
+		// Ensure that all critical options and extensions are allowed
+		newSSHOptionsPolicyValidator(p.ctl.getPolicy().getSSHHostOptions(), nil),
 		// Call webhooks
 		p.ctl.newWebhookController(
 			data,
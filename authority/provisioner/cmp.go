@@ -0,0 +1,275 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/linkedca"
+)
+
+// defaultCMPConfirmWaitTime is the time a CMP transaction waits for the
+// certConf message if the provisioner does not define one.
+const defaultCMPConfirmWaitTime = 5 * time.Minute
+
+// CMP is the CMP provisioner type, an entity that can authorize the
+// Certificate Management Protocol flows defined in RFC 9483 (Lightweight CMP).
+//
+// Request messages can be protected using a MAC based on the SharedSecret, or
+// signed with a certificate that chains to one of the Roots. Key update and
+// revocation requests are always signed with the certificate being updated or
+// revoked, and it must be issued by the CA.
+//
+// Responses are protected with the same mechanism used in the request. Signed
+// responses use the SignerCertificate and SignerKeyPEM if configured, or the
+// CA intermediate otherwise.
+type CMP struct {
+	*base
+	ID                string `json:"-"`
+	Type              string `json:"type"`
+	Name              string `json:"name"`
+	ForceCN           bool   `json:"forceCN,omitempty"`
+	SharedSecret      string `json:"sharedSecret,omitempty"`
+	Roots             []byte `json:"roots,omitempty"`
+	SignerCertificate []byte `json:"signerCertificate,omitempty"`
+	SignerKeyPEM      []byte `json:"signerKeyPEM,omitempty"`
+	SignerKeyPassword string `json:"signerKeyPassword,omitempty"`
+
+	// DisableImplicitConfirm makes the provisioner always wait for a certConf
+	// message, even if the client requested implicit confirmation.
+	DisableImplicitConfirm bool `json:"disableImplicitConfirm,omitempty"`
+
+	// ConfirmWaitTime is the time to wait for a certConf message before the
+	// transaction is discarded and, if the CA has a database, the certificate
+	// is revoked. Defaults to 5 minutes.
+	ConfirmWaitTime *Duration `json:"confirmWaitTime,omitempty"`
+
+	// PollingThreshold enables delayed enrollment. If issuing a certificate
+	// takes longer than this value, the client receives a waiting status and
+	// must poll for the certificate.
+	PollingThreshold *Duration `json:"pollingThreshold,omitempty"`
+
+	// IncludeRoot makes the provisioner return the CA root in the caPubs
+	// field of the responses to initialization requests.
+	IncludeRoot bool `json:"includeRoot,omitempty"`
+
+	// MinimumPublicKeyLength is the minimum length for public keys in
+	// certificate requests.
+	MinimumPublicKeyLength int `json:"minimumPublicKeyLength,omitempty"`
+
+	Options           *Options `json:"options,omitempty"`
+	Claims            *Claims  `json:"claims,omitempty"`
+	ctl               *Controller
+	rootPool          *x509.CertPool
+	signer            crypto.Signer
+	signerCertificate *x509.Certificate
+}
+
+// GetID returns the provisioner unique identifier.
+func (s *CMP) GetID() string {
+	if s.ID != "" {
+		return s.ID
+	}
+	return s.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (s *CMP) GetIDForToken() string {
+	return "cmp/" + s.Name
+}
+
+// GetName returns the name of the provisioner.
+func (s *CMP) GetName() string {
+	return s.Name
+}
+
+// GetType returns the type of provisioner.
+func (s *CMP) GetType() Type {
+	return TypeCMP
+}
+
+// GetEncryptedKey returns the base provisioner encrypted key if it's defined.
+func (s *CMP) GetEncryptedKey() (string, string, bool) {
+	return "", "", false
+}
+
+// GetTokenID returns the identifier of the token. This provisioner will always
+// return [ErrTokenFlowNotSupported].
+func (s *CMP) GetTokenID(string) (string, error) {
+	return "", ErrTokenFlowNotSupported
+}
+
+// GetOptions returns the configured provisioner options.
+func (s *CMP) GetOptions() *Options {
+	return s.Options
+}
+
+// DefaultTLSCertDuration returns the default TLS cert duration enforced by
+// the provisioner.
+func (s *CMP) DefaultTLSCertDuration() time.Duration {
+	return s.ctl.Claimer.DefaultTLSCertDuration()
+}
+
+// Init initializes and validates the fields of a CMP type.
+func (s *CMP) Init(config Config) (err error) {
+	switch {
+	case s.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case s.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case s.SharedSecret == "" && len(s.Roots) == 0:
+		return errors.New("provisioner sharedSecret or roots are required")
+	case (len(s.SignerCertificate) == 0) != (len(s.SignerKeyPEM) == 0):
+		return errors.New("provisioner signerCertificate and signerKeyPEM must be set together")
+	case s.ConfirmWaitTime.Value() < 0:
+		return errors.New("provisioner confirmWaitTime cannot be negative")
+	case s.PollingThreshold.Value() < 0:
+		return errors.New("provisioner pollingThreshold cannot be negative")
+	}
+
+	// Default to 2048 bits minimum public key length (for CSRs) if not set
+	if s.MinimumPublicKeyLength == 0 {
+		s.MinimumPublicKeyLength = 2048
+	}
+	if s.MinimumPublicKeyLength%8 != 0 {
+		return errors.Errorf("%d bits is not exactly divisible by 8", s.MinimumPublicKeyLength)
+	}
+
+	if len(s.Roots) > 0 {
+		s.rootPool = x509.NewCertPool()
+		var (
+			block *pem.Block
+			rest  = s.Roots
+			count int
+		)
+		for rest != nil {
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return errors.Wrap(err, "error parsing x509 certificate from PEM block")
+			}
+			count++
+			s.rootPool.AddCert(cert)
+		}
+		if count == 0 {
+			return errors.Errorf("no x509 certificates found in roots attribute for provisioner '%s'", s.GetName())
+		}
+	}
+
+	if len(s.SignerCertificate) > 0 {
+		if s.signerCertificate, err = pemutil.ParseCertificate(s.SignerCertificate); err != nil {
+			return errors.Wrap(err, "error parsing signerCertificate")
+		}
+		var opts []pemutil.Options
+		if s.SignerKeyPassword != "" {
+			opts = append(opts, pemutil.WithPassword([]byte(s.SignerKeyPassword)))
+		}
+		key, err := pemutil.Parse(s.SignerKeyPEM, opts...)
+		if err != nil {
+			return errors.Wrap(err, "error parsing signerKeyPEM")
+		}
+		var ok bool
+		if s.signer, ok = key.(crypto.Signer); !ok {
+			return errors.Errorf("signerKeyPEM of type %T is not a crypto.Signer", key)
+		}
+		if err := keyutil.VerifyPair(s.signerCertificate.PublicKey, s.signer); err != nil {
+			return errors.Wrap(err, "signerCertificate and signerKeyPEM do not match")
+		}
+	}
+
+	s.ctl, err = NewController(s, s.Claims, config, s.Options)
+	return
+}
+
+// AuthorizeSign does not do any verification, because all verification is
+// handled in the CMP protocol. This method returns a list of modifiers and
+// constraints on the resulting certificate.
+func (s *CMP) AuthorizeSign(context.Context, string) ([]SignOption, error) {
+	return []SignOption{
+		s,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeCMP, s.Name, "").WithControllerOptions(s.ctl),
+		newForceCNOption(s.ForceCN),
+		profileDefaultDuration(s.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		newPublicKeyMinimumLengthValidator(s.MinimumPublicKeyLength),
+		newValidityValidator(s.ctl.Claimer.MinTLSCertDuration(), s.ctl.Claimer.MaxTLSCertDuration()),
+		newX509NamePolicyValidator(s.ctl.getPolicy().getX509()),
+		s.ctl.newWebhookController(nil, linkedca.Webhook_X509),
+	}, nil
+}
+
+// GetSharedSecret returns the secret used in MAC-based protection, or nil if
+// MAC-based protection is not enabled.
+func (s *CMP) GetSharedSecret() []byte {
+	if s.SharedSecret == "" {
+		return nil
+	}
+	return []byte(s.SharedSecret)
+}
+
+// AuthorizeClientCertificate validates that the certificate chain used to
+// sign a request is signed by one of the provisioner roots.
+func (s *CMP) AuthorizeClientCertificate(chain []*x509.Certificate) error {
+	switch {
+	case s.rootPool == nil:
+		return errors.New("signature-based protection is not enabled")
+	case len(chain) == 0:
+		return errors.New("protection certificate is required")
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         s.rootPool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return errors.Wrap(err, "error verifying protection certificate")
+	}
+	return nil
+}
+
+// GetSigner returns the certificate and signer used to protect responses, or
+// nil if they are not configured.
+func (s *CMP) GetSigner() (*x509.Certificate, crypto.Signer) {
+	return s.signerCertificate, s.signer
+}
+
+// ShouldAllowImplicitConfirm returns true if the provisioner grants implicit
+// confirmation to clients that request it.
+func (s *CMP) ShouldAllowImplicitConfirm() bool {
+	return !s.DisableImplicitConfirm
+}
+
+// ShouldIncludeRootInChain returns true if the responses must include the CA
+// root in the caPubs field.
+func (s *CMP) ShouldIncludeRootInChain() bool {
+	return s.IncludeRoot
+}
+
+// GetConfirmWaitTime returns the time to wait for a certConf message.
+func (s *CMP) GetConfirmWaitTime() time.Duration {
+	if d := s.ConfirmWaitTime.Value(); d > 0 {
+		return d
+	}
+	return defaultCMPConfirmWaitTime
+}
+
+// GetPollingThreshold returns the maximum time to wait for a certificate
+// before answering with a waiting status. A zero value disables delayed
+// enrollment.
+func (s *CMP) GetPollingThreshold() time.Duration {
+	return s.PollingThreshold.Value()
+}
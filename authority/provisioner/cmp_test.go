@@ -0,0 +1,134 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/pemutil"
+)
+
+func TestCMP_Init(t *testing.T) {
+	ca, roots := generateESTCA(t)
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	cert, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "cmp"},
+		PublicKey: signer.Public(),
+	})
+	require.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	block, err := pemutil.Serialize(signer)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(block)
+	otherSigner, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	block, err = pemutil.Serialize(otherSigner)
+	require.NoError(t, err)
+	otherKeyPEM := pem.EncodeToMemory(block)
+
+	config := Config{Claims: globalProvisionerClaims}
+	tests := []struct {
+		name    string
+		p       *CMP
+		wantErr bool
+	}{
+		{"ok/shared-secret", &CMP{Type: "CMP", Name: "cmp", SharedSecret: "secret"}, false},
+		{"ok/roots", &CMP{Type: "CMP", Name: "cmp", Roots: roots}, false},
+		{"ok/signer", &CMP{Type: "CMP", Name: "cmp", Roots: roots, SignerCertificate: certPEM, SignerKeyPEM: keyPEM}, false},
+		{"ok/durations", &CMP{Type: "CMP", Name: "cmp", SharedSecret: "secret", ConfirmWaitTime: &Duration{Duration: time.Minute}, PollingThreshold: &Duration{Duration: time.Second}}, false},
+		{"fail/type", &CMP{Name: "cmp", SharedSecret: "secret"}, true},
+		{"fail/name", &CMP{Type: "CMP", SharedSecret: "secret"}, true},
+		{"fail/no-auth", &CMP{Type: "CMP", Name: "cmp"}, true},
+		{"fail/roots", &CMP{Type: "CMP", Name: "cmp", Roots: []byte("foo")}, true},
+		{"fail/signer-certificate", &CMP{Type: "CMP", Name: "cmp", Roots: roots, SignerCertificate: certPEM}, true},
+		{"fail/signer-key", &CMP{Type: "CMP", Name: "cmp", Roots: roots, SignerKeyPEM: keyPEM}, true},
+		{"fail/signer-mismatch", &CMP{Type: "CMP", Name: "cmp", Roots: roots, SignerCertificate: certPEM, SignerKeyPEM: otherKeyPEM}, true},
+		{"fail/confirm-wait-time", &CMP{Type: "CMP", Name: "cmp", SharedSecret: "secret", ConfirmWaitTime: &Duration{Duration: -time.Minute}}, true},
+		{"fail/polling-threshold", &CMP{Type: "CMP", Name: "cmp", SharedSecret: "secret", PollingThreshold: &Duration{Duration: -time.Second}}, true},
+		{"fail/minimum-public-key-length", &CMP{Type: "CMP", Name: "cmp", SharedSecret: "secret", MinimumPublicKeyLength: 2047}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, 2048, tt.p.MinimumPublicKeyLength)
+		})
+	}
+}
+
+func TestCMP_AuthorizeSign(t *testing.T) {
+	p := &CMP{Type: "CMP", Name: "cmp", SharedSecret: "secret"}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+
+	opts, err := p.AuthorizeSign(context.Background(), "")
+	require.NoError(t, err)
+	assert.Len(t, opts, 8)
+	assert.Equal(t, p, opts[0])
+	assert.IsType(t, &provisionerExtensionOption{}, opts[1])
+	assert.IsType(t, &WebhookController{}, opts[7])
+}
+
+func TestCMP_Getters(t *testing.T) {
+	p := &CMP{Type: "CMP", Name: "cmp", SharedSecret: "secret"}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	assert.Equal(t, []byte("secret"), p.GetSharedSecret())
+	assert.True(t, p.ShouldAllowImplicitConfirm())
+	assert.False(t, p.ShouldIncludeRootInChain())
+	assert.Equal(t, defaultCMPConfirmWaitTime, p.GetConfirmWaitTime())
+	assert.Zero(t, p.GetPollingThreshold())
+	cert, signer := p.GetSigner()
+	assert.Nil(t, cert)
+	assert.Nil(t, signer)
+
+	p = &CMP{
+		Type: "CMP", Name: "cmp", SharedSecret: "secret",
+		DisableImplicitConfirm: true, IncludeRoot: true,
+		ConfirmWaitTime:  &Duration{Duration: time.Minute},
+		PollingThreshold: &Duration{Duration: time.Second},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	assert.False(t, p.ShouldAllowImplicitConfirm())
+	assert.True(t, p.ShouldIncludeRootInChain())
+	assert.Equal(t, time.Minute, p.GetConfirmWaitTime())
+	assert.Equal(t, time.Second, p.GetPollingThreshold())
+	assert.Nil(t, (&CMP{}).GetSharedSecret())
+}
+
+func TestCMP_AuthorizeClientCertificate(t *testing.T) {
+	ca, roots := generateESTCA(t)
+	otherCA, _ := generateESTCA(t)
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	sign := func(ca *minica.CA) *x509.Certificate {
+		cert, err := ca.Sign(&x509.Certificate{
+			Subject:   pkix.Name{CommonName: "device"},
+			PublicKey: signer.Public(),
+		})
+		require.NoError(t, err)
+		return cert
+	}
+
+	p := &CMP{Type: "CMP", Name: "cmp", Roots: roots}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	noRoots := &CMP{Type: "CMP", Name: "cmp", SharedSecret: "secret"}
+	require.NoError(t, noRoots.Init(Config{Claims: globalProvisionerClaims}))
+
+	assert.NoError(t, p.AuthorizeClientCertificate([]*x509.Certificate{sign(ca), ca.Intermediate}))
+	assert.Error(t, p.AuthorizeClientCertificate(nil))
+	assert.Error(t, p.AuthorizeClientCertificate([]*x509.Certificate{sign(ca)}))
+	assert.Error(t, p.AuthorizeClientCertificate([]*x509.Certificate{sign(otherCA), otherCA.Intermediate}))
+	assert.Error(t, noRoots.AuthorizeClientCertificate([]*x509.Certificate{sign(ca), ca.Intermediate}))
+}
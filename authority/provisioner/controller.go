@@ -31,6 +31,7 @@ type Controller struct {
 	httpClient            HTTPClient
 	webhookClient         HTTPClient
 	webhooks              []*Webhook
+	sshSecurityKey        *sshSecurityKeyModifier
 	wrapTransport         httptransport.Wrapper
 }
 
@@ -53,6 +54,10 @@ func NewController(p Interface, claims *Claims, config Config, options *Options)
 			return nil, err
 		}
 	}
+	sshSecurityKey, err := newSSHSecurityKeyModifier(options.GetSSHOptions().GetSecurityKeyOptions())
+	if err != nil {
+		return nil, err
+	}
 
 	return &Controller{
 		Interface:             p,
@@ -64,6 +69,7 @@ func NewController(p Interface, claims *Claims, config Config, options *Options)
 		policy:                policy,
 		webhookClient:         config.WebhookClient,
 		webhooks:              options.GetWebhooks(),
+		sshSecurityKey:        sshSecurityKey,
 		httpClient:            config.HTTPClient,
 		wrapTransport:         wt,
 	}, nil
@@ -140,6 +146,12 @@ type AuthorizeRenewFunc func(ctx context.Context, p *Controller, cert *x509.Cert
 // given SSH certificate is enabled.
 type AuthorizeSSHRenewFunc func(ctx context.Context, p *Controller, cert *ssh.Certificate) error
 
+// ValidateSCEPChallengeFunc is a function that validates a one-time SCEP
+// challenge. It returns false if the challenge is not a one-time challenge of
+// the given provisioner, and an error if it is, but it cannot be used for the
+// given certificate request.
+type ValidateSCEPChallengeFunc func(ctx context.Context, p Interface, csr *x509.CertificateRequest, challenge string) (bool, error)
+
 // DefaultIdentityFunc return a default identity depending on the provisioner
 // type. For OIDC email is always present and the usernames might
 // contain empty strings.
@@ -0,0 +1,265 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/linkedca"
+)
+
+// EST is the EST provisioner type, an entity that can authorize the
+// Enrollment over Secure Transport flow defined in RFC 7030.
+//
+// Clients can authenticate using HTTP basic authentication with the Username
+// and Password, or using a TLS client certificate that chains to one of the
+// Roots. The CA TLS server only requests client certificates signed by the
+// CA, so Roots is usually the CA root or one of its intermediates. Re-enroll
+// requests are always authenticated with the TLS client certificate being
+// renewed.
+type EST struct {
+	*base
+	ID       string `json:"-"`
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	ForceCN  bool   `json:"forceCN,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Roots    []byte `json:"roots,omitempty"`
+
+	// RequireChannelBinding requires the challengePassword attribute of the
+	// CSRs to contain the base64 encoded tls-unique value of the connection,
+	// or the tls-exporter value if TLS 1.3 is used.
+	RequireChannelBinding bool `json:"requireChannelBinding,omitempty"`
+
+	// CSRAttributes contains the object identifiers returned in the csrattrs
+	// response.
+	CSRAttributes []string `json:"csrAttributes,omitempty"`
+
+	// EnableServerKeyGen enables the serverkeygen operation, that generates
+	// the private key of the certificate in the CA.
+	EnableServerKeyGen bool `json:"enableServerKeyGen,omitempty"`
+
+	// IncludeRoot makes the provisioner return the CA root in addition to the
+	// intermediate in the cacerts response.
+	IncludeRoot bool `json:"includeRoot,omitempty"`
+
+	// MinimumPublicKeyLength is the minimum length for public keys in CSRs
+	MinimumPublicKeyLength int `json:"minimumPublicKeyLength,omitempty"`
+
+	Options       *Options `json:"options,omitempty"`
+	Claims        *Claims  `json:"claims,omitempty"`
+	ctl           *Controller
+	rootPool      *x509.CertPool
+	csrAttributes []asn1.ObjectIdentifier
+}
+
+// GetID returns the provisioner unique identifier.
+func (s *EST) GetID() string {
+	if s.ID != "" {
+		return s.ID
+	}
+	return s.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (s *EST) GetIDForToken() string {
+	return "est/" + s.Name
+}
+
+// GetName returns the name of the provisioner.
+func (s *EST) GetName() string {
+	return s.Name
+}
+
+// GetType returns the type of provisioner.
+func (s *EST) GetType() Type {
+	return TypeEST
+}
+
+// GetEncryptedKey returns the base provisioner encrypted key if it's defined.
+func (s *EST) GetEncryptedKey() (string, string, bool) {
+	return "", "", false
+}
+
+// GetTokenID returns the identifier of the token. This provisioner will always
+// return [ErrTokenFlowNotSupported].
+func (s *EST) GetTokenID(string) (string, error) {
+	return "", ErrTokenFlowNotSupported
+}
+
+// GetOptions returns the configured provisioner options.
+func (s *EST) GetOptions() *Options {
+	return s.Options
+}
+
+// DefaultTLSCertDuration returns the default TLS cert duration enforced by
+// the provisioner.
+func (s *EST) DefaultTLSCertDuration() time.Duration {
+	return s.ctl.Claimer.DefaultTLSCertDuration()
+}
+
+// Init initializes and validates the fields of an EST type.
+func (s *EST) Init(config Config) (err error) {
+	switch {
+	case s.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case s.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case (s.Username == "") != (s.Password == ""):
+		return errors.New("provisioner username and password must be set together")
+	case s.Username == "" && len(s.Roots) == 0:
+		return errors.New("provisioner username and password or roots are required")
+	}
+
+	// Default to 2048 bits minimum public key length (for CSRs) if not set
+	if s.MinimumPublicKeyLength == 0 {
+		s.MinimumPublicKeyLength = 2048
+	}
+	if s.MinimumPublicKeyLength%8 != 0 {
+		return errors.Errorf("%d bits is not exactly divisible by 8", s.MinimumPublicKeyLength)
+	}
+
+	if len(s.Roots) > 0 {
+		s.rootPool = x509.NewCertPool()
+		var (
+			block *pem.Block
+			rest  = s.Roots
+			count int
+		)
+		for rest != nil {
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return errors.Wrap(err, "error parsing x509 certificate from PEM block")
+			}
+			count++
+			s.rootPool.AddCert(cert)
+		}
+		if count == 0 {
+			return errors.Errorf("no x509 certificates found in roots attribute for provisioner '%s'", s.GetName())
+		}
+	}
+
+	s.csrAttributes = make([]asn1.ObjectIdentifier, len(s.CSRAttributes))
+	for i, v := range s.CSRAttributes {
+		if s.csrAttributes[i], err = parseObjectIdentifier(v); err != nil {
+			return errors.Wrapf(err, "error parsing csrAttributes %q", v)
+		}
+	}
+
+	s.ctl, err = NewController(s, s.Claims, config, s.Options)
+	return
+}
+
+// AuthorizeSign does not do any verification, because all verification is
+// handled in the EST protocol. This method returns a list of modifiers and
+// constraints on the resulting certificate.
+func (s *EST) AuthorizeSign(context.Context, string) ([]SignOption, error) {
+	return []SignOption{
+		s,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeEST, s.Name, "").WithControllerOptions(s.ctl),
+		newForceCNOption(s.ForceCN),
+		profileDefaultDuration(s.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		newPublicKeyMinimumLengthValidator(s.MinimumPublicKeyLength),
+		newValidityValidator(s.ctl.Claimer.MinTLSCertDuration(), s.ctl.Claimer.MaxTLSCertDuration()),
+		newX509NamePolicyValidator(s.ctl.getPolicy().getX509()),
+		s.ctl.newWebhookController(nil, linkedca.Webhook_X509),
+	}, nil
+}
+
+// HasBasicAuth returns true if the provisioner accepts HTTP basic
+// authentication.
+func (s *EST) HasBasicAuth() bool {
+	return s.Username != ""
+}
+
+// AuthorizeBasicAuth validates the username and password of an HTTP basic
+// authentication.
+func (s *EST) AuthorizeBasicAuth(username, password string) error {
+	if s.Username == "" {
+		return errors.New("basic authentication is not enabled")
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(s.Username), []byte(username))
+	passOK := subtle.ConstantTimeCompare([]byte(s.Password), []byte(password))
+	if userOK&passOK == 0 {
+		return errors.New("invalid username or password")
+	}
+	return nil
+}
+
+// AuthorizeClientCertificate validates that the given TLS client certificate
+// chain is signed by one of the provisioner roots.
+func (s *EST) AuthorizeClientCertificate(chain []*x509.Certificate) error {
+	switch {
+	case s.rootPool == nil:
+		return errors.New("client certificate authentication is not enabled")
+	case len(chain) == 0:
+		return errors.New("client certificate is required")
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         s.rootPool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return errors.Wrap(err, "error verifying client certificate")
+	}
+	return nil
+}
+
+// ShouldRequireChannelBinding returns true if the CSRs must be bound to the
+// TLS connection.
+func (s *EST) ShouldRequireChannelBinding() bool {
+	return s.RequireChannelBinding
+}
+
+// ShouldIncludeRootInChain returns true if the cacerts response must include
+// the CA root.
+func (s *EST) ShouldIncludeRootInChain() bool {
+	return s.IncludeRoot
+}
+
+// IsServerKeyGenEnabled returns true if the serverkeygen operation is
+// enabled.
+func (s *EST) IsServerKeyGenEnabled() bool {
+	return s.EnableServerKeyGen
+}
+
+// GetCSRAttributes returns the object identifiers of the csrattrs response.
+func (s *EST) GetCSRAttributes() []asn1.ObjectIdentifier {
+	return s.csrAttributes
+}
+
+// parseObjectIdentifier parses an object identifier in dot notation.
+func parseObjectIdentifier(v string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(v, ".")
+	if len(parts) < 2 {
+		return nil, errors.New("invalid object identifier")
+	}
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, errors.New("invalid object identifier")
+		}
+		oid[i] = n
+	}
+	return oid, nil
+}
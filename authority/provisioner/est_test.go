@@ -0,0 +1,159 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+)
+
+func generateESTCA(t *testing.T) (*minica.CA, []byte) {
+	t.Helper()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	return ca, pem.EncodeToMemory(&pem.Block{
+		Type: "CERTIFICATE", Bytes: ca.Root.Raw,
+	})
+}
+
+func TestEST_Init(t *testing.T) {
+	_, roots := generateESTCA(t)
+	config := Config{Claims: globalProvisionerClaims}
+	tests := []struct {
+		name    string
+		p       *EST
+		wantErr bool
+	}{
+		{"ok/basic-auth", &EST{Type: "EST", Name: "est", Username: "user", Password: "pass"}, false},
+		{"ok/roots", &EST{Type: "EST", Name: "est", Roots: roots}, false},
+		{"ok/csr-attributes", &EST{Type: "EST", Name: "est", Roots: roots, CSRAttributes: []string{"1.2.840.113549.1.9.7", "2.5.4.5"}}, false},
+		{"fail/type", &EST{Name: "est", Username: "user", Password: "pass"}, true},
+		{"fail/name", &EST{Type: "EST", Username: "user", Password: "pass"}, true},
+		{"fail/username", &EST{Type: "EST", Name: "est", Password: "pass"}, true},
+		{"fail/password", &EST{Type: "EST", Name: "est", Username: "user"}, true},
+		{"fail/no-auth", &EST{Type: "EST", Name: "est"}, true},
+		{"fail/roots", &EST{Type: "EST", Name: "est", Roots: []byte("foo")}, true},
+		{"fail/minimum-public-key-length", &EST{Type: "EST", Name: "est", Roots: roots, MinimumPublicKeyLength: 2047}, true},
+		{"fail/csr-attributes", &EST{Type: "EST", Name: "est", Roots: roots, CSRAttributes: []string{"1.foo"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, 2048, tt.p.MinimumPublicKeyLength)
+			assert.Len(t, tt.p.GetCSRAttributes(), len(tt.p.CSRAttributes))
+		})
+	}
+}
+
+func TestEST_AuthorizeSign(t *testing.T) {
+	p := &EST{Type: "EST", Name: "est", Username: "user", Password: "pass"}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+
+	opts, err := p.AuthorizeSign(context.Background(), "")
+	require.NoError(t, err)
+	assert.Len(t, opts, 8)
+	assert.Equal(t, p, opts[0])
+	assert.IsType(t, &provisionerExtensionOption{}, opts[1])
+	assert.IsType(t, &WebhookController{}, opts[7])
+}
+
+func TestEST_AuthorizeBasicAuth(t *testing.T) {
+	_, roots := generateESTCA(t)
+	p := &EST{Type: "EST", Name: "est", Username: "user", Password: "pass"}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	noBasicAuth := &EST{Type: "EST", Name: "est", Roots: roots}
+	require.NoError(t, noBasicAuth.Init(Config{Claims: globalProvisionerClaims}))
+
+	assert.True(t, p.HasBasicAuth())
+	assert.False(t, noBasicAuth.HasBasicAuth())
+	assert.NoError(t, p.AuthorizeBasicAuth("user", "pass"))
+	assert.Error(t, p.AuthorizeBasicAuth("user", "foo"))
+	assert.Error(t, p.AuthorizeBasicAuth("foo", "pass"))
+	assert.Error(t, p.AuthorizeBasicAuth("", ""))
+	assert.Error(t, noBasicAuth.AuthorizeBasicAuth("", ""))
+}
+
+func TestEST_AuthorizeClientCertificate(t *testing.T) {
+	ca, roots := generateESTCA(t)
+	otherCA, _ := generateESTCA(t)
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	sign := func(ca *minica.CA, extKeyUsage x509.ExtKeyUsage) *x509.Certificate {
+		cert, err := ca.Sign(&x509.Certificate{
+			Subject:     pkix.Name{CommonName: "device"},
+			PublicKey:   signer.Public(),
+			ExtKeyUsage: []x509.ExtKeyUsage{extKeyUsage},
+		})
+		require.NoError(t, err)
+		return cert
+	}
+
+	p := &EST{Type: "EST", Name: "est", Roots: roots}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	noRoots := &EST{Type: "EST", Name: "est", Username: "user", Password: "pass"}
+	require.NoError(t, noRoots.Init(Config{Claims: globalProvisionerClaims}))
+
+	tests := []struct {
+		name    string
+		p       *EST
+		chain   []*x509.Certificate
+		wantErr bool
+	}{
+		{"ok", p, []*x509.Certificate{sign(ca, x509.ExtKeyUsageClientAuth), ca.Intermediate}, false},
+		{"fail/no-roots", noRoots, []*x509.Certificate{sign(ca, x509.ExtKeyUsageClientAuth), ca.Intermediate}, true},
+		{"fail/empty", p, nil, true},
+		{"fail/missing-intermediate", p, []*x509.Certificate{sign(ca, x509.ExtKeyUsageClientAuth)}, true},
+		{"fail/other-ca", p, []*x509.Certificate{sign(otherCA, x509.ExtKeyUsageClientAuth), otherCA.Intermediate}, true},
+		{"fail/server-auth", p, []*x509.Certificate{sign(ca, x509.ExtKeyUsageServerAuth), ca.Intermediate}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.AuthorizeClientCertificate(tt.chain)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_parseObjectIdentifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       string
+		want    asn1.ObjectIdentifier
+		wantErr bool
+	}{
+		{"ok", "1.2.840.113549.1.9.7", asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}, false},
+		{"ok/short", "2.5", asn1.ObjectIdentifier{2, 5}, false},
+		{"fail/empty", "", nil, true},
+		{"fail/single", "1", nil, true},
+		{"fail/negative", "1.-2", nil, true},
+		{"fail/text", "1.foo", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseObjectIdentifier(tt.v)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -479,12 +479,16 @@ func (p *GCP) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 		&sshDefaultDuration{p.ctl.Claimer},
 		// Validate public key
 		&sshDefaultPublicKeyValidator{},
+		// Validate security keys and their attestation.
+		p.ctl.sshSecurityKey,
 		// Validate the validity period.
 		&sshCertValidityValidator{p.ctl.Claimer},
 		// Require all the fields in the SSH certificate
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
 		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser()),
+		// Ensure that all critical options and extensions are allowed
+		newSSHOptionsPolicyValidator(p.ctl.getPolicy().getSSHHostOptions(), p.ctl.getPolicy().getSSHUserOptions()),
 		// Call webhooks
 		p.ctl.newWebhookController(
 			data,
@@ -242,6 +242,14 @@ func (p *JWK) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 		sshCertOptionsValidator(SignSSHOptions{KeyID: claims.Subject}),
 	}
 
+	// Bind the certificate to an approved access request.
+	if opts.AccessRequestID != "" {
+		signOptions = append(signOptions, SSHAccessRequestOption{
+			ID:      opts.AccessRequestID,
+			Subject: claims.Subject,
+		})
+	}
+
 	// Default template attributes.
 	certType := sshutil.UserCert
 	keyID := claims.Subject
@@ -287,12 +295,16 @@ func (p *JWK) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 		&sshDefaultDuration{p.ctl.Claimer},
 		// Validate public key
 		&sshDefaultPublicKeyValidator{},
+		// Validate security keys and their attestation.
+		p.ctl.sshSecurityKey,
 		// Validate the validity period.
 		&sshCertValidityValidator{p.ctl.Claimer},
 		// Require and validate all the default fields in the SSH certificate.
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
 		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser()),
+		// Ensure that all critical options and extensions are allowed
+		newSSHOptionsPolicyValidator(p.ctl.getPolicy().getSSHHostOptions(), p.ctl.getPolicy().getSSHUserOptions()),
 		// Call webhooks
 		p.ctl.newWebhookController(data, linkedca.Webhook_SSH),
 	), nil
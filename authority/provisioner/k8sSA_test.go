@@ -370,7 +370,7 @@ func TestK8sSA_AuthorizeSSHSign(t *testing.T) {
 			} else {
 				if assert.Nil(t, tc.err) {
 					if assert.NotNil(t, opts) {
-						assert.Len(t, 9, opts)
+						assert.Len(t, 11, opts)
 						for _, o := range opts {
 							switch v := o.(type) {
 							case Interface:
@@ -386,6 +386,11 @@ func TestK8sSA_AuthorizeSSHSign(t *testing.T) {
 							case *sshNamePolicyValidator:
 								assert.Equals(t, nil, v.userPolicyEngine)
 								assert.Equals(t, nil, v.hostPolicyEngine)
+							case *sshOptionsPolicyValidator:
+								assert.Equals(t, nil, v.userPolicyEngine)
+								assert.Equals(t, nil, v.hostPolicyEngine)
+							case *sshSecurityKeyModifier:
+								assert.Equals(t, (*sshSecurityKeyModifier)(nil), v)
 							case *WebhookController:
 								assert.Len(t, 0, v.webhooks)
 							default:
@@ -28,6 +28,9 @@ const (
 	SSHRevokeMethod
 	// SSHRekeyMethod is the method used to rekey SSH certificates.
 	SSHRekeyMethod
+	// SSHAuthorizedPrincipalsMethod is the method used to get the principals
+	// authorized to log in to an SSH host.
+	SSHAuthorizedPrincipalsMethod
 )
 
 // String returns a string representation of the context method.
@@ -49,6 +52,8 @@ func (m Method) String() string {
 		return "ssh-revoke-method"
 	case SSHRekeyMethod:
 		return "ssh-rekey-method"
+	case SSHAuthorizedPrincipalsMethod:
+		return "ssh-authorized-principals-method"
 	default:
 		return "unknown"
 	}
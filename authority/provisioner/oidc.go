@@ -459,12 +459,16 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 		&sshDefaultDuration{o.ctl.Claimer},
 		// Validate public key
 		&sshDefaultPublicKeyValidator{},
+		// Validate security keys and their attestation.
+		o.ctl.sshSecurityKey,
 		// Validate the validity period.
 		&sshCertValidityValidator{o.ctl.Claimer},
 		// Require all the fields in the SSH certificate
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
 		newSSHNamePolicyValidator(o.ctl.getPolicy().getSSHHost(), o.ctl.getPolicy().getSSHUser()),
+		// Ensure that all critical options and extensions are allowed
+		newSSHOptionsPolicyValidator(o.ctl.getPolicy().getSSHHostOptions(), o.ctl.getPolicy().getSSHUserOptions()),
 		// Call webhooks
 		o.ctl.newWebhookController(data, linkedca.Webhook_SSH),
 	), nil
@@ -3,9 +3,11 @@ package provisioner
 import "github.com/smallstep/certificates/authority/policy"
 
 type policyEngine struct {
-	x509Policy    policy.X509Policy
-	sshHostPolicy policy.HostPolicy
-	sshUserPolicy policy.UserPolicy
+	x509Policy           policy.X509Policy
+	sshHostPolicy        policy.HostPolicy
+	sshUserPolicy        policy.UserPolicy
+	sshHostOptionsPolicy policy.HostPolicy
+	sshUserOptionsPolicy policy.UserPolicy
 }
 
 func newPolicyEngine(options *Options) (*policyEngine, error) {
@@ -15,10 +17,12 @@ func newPolicyEngine(options *Options) (*policyEngine, error) {
 	}
 
 	var (
-		x509Policy    policy.X509Policy
-		sshHostPolicy policy.HostPolicy
-		sshUserPolicy policy.UserPolicy
-		err           error
+		x509Policy           policy.X509Policy
+		sshHostPolicy        policy.HostPolicy
+		sshUserPolicy        policy.UserPolicy
+		sshHostOptionsPolicy policy.HostPolicy
+		sshUserOptionsPolicy policy.UserPolicy
+		err                  error
 	)
 
 	// Initialize the x509 allow/deny policy engine
@@ -36,10 +40,22 @@ func newPolicyEngine(options *Options) (*policyEngine, error) {
 		return nil, err
 	}
 
+	// Initialize the SSH critical options and extensions policy engine for host certificates
+	if sshHostOptionsPolicy, err = policy.NewSSHHostOptionsPolicyEngine(options.GetSSHOptions()); err != nil {
+		return nil, err
+	}
+
+	// Initialize the SSH critical options and extensions policy engine for user certificates
+	if sshUserOptionsPolicy, err = policy.NewSSHUserOptionsPolicyEngine(options.GetSSHOptions()); err != nil {
+		return nil, err
+	}
+
 	return &policyEngine{
-		x509Policy:    x509Policy,
-		sshHostPolicy: sshHostPolicy,
-		sshUserPolicy: sshUserPolicy,
+		x509Policy:           x509Policy,
+		sshHostPolicy:        sshHostPolicy,
+		sshUserPolicy:        sshUserPolicy,
+		sshHostOptionsPolicy: sshHostOptionsPolicy,
+		sshUserOptionsPolicy: sshUserOptionsPolicy,
 	}, nil
 }
 
@@ -63,3 +79,17 @@ func (p *policyEngine) getSSHUser() policy.UserPolicy {
 	}
 	return p.sshUserPolicy
 }
+
+func (p *policyEngine) getSSHHostOptions() policy.HostPolicy {
+	if p == nil {
+		return nil
+	}
+	return p.sshHostOptionsPolicy
+}
+
+func (p *policyEngine) getSSHUserOptions() policy.UserPolicy {
+	if p == nil {
+		return nil
+	}
+	return p.sshUserOptionsPolicy
+}
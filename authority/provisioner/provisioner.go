@@ -34,6 +34,13 @@ type Interface interface {
 	AuthorizeSSHRekey(ctx context.Context, token string) (*ssh.Certificate, []SignOption, error)
 }
 
+// SSHAuthorizedPrincipalsAuthorizer is the interface implemented by the
+// provisioners that can authorize the requests of SSH hosts to get the
+// principals authorized to log in.
+type SSHAuthorizedPrincipalsAuthorizer interface {
+	AuthorizeSSHAuthorizedPrincipals(ctx context.Context, token string) (*ssh.Certificate, error)
+}
+
 // HTTPClient is the interface implemented by the HTTP clients used by the
 // provisioners.
 type HTTPClient interface {
@@ -86,13 +93,14 @@ var ErrNotImplemented = stderrors.New("not implemented")
 
 // Audiences stores all supported audiences by request type.
 type Audiences struct {
-	Sign      []string
-	Renew     []string
-	Revoke    []string
-	SSHSign   []string
-	SSHRevoke []string
-	SSHRenew  []string
-	SSHRekey  []string
+	Sign                    []string
+	Renew                   []string
+	Revoke                  []string
+	SSHSign                 []string
+	SSHRevoke               []string
+	SSHRenew                []string
+	SSHRekey                []string
+	SSHAuthorizedPrincipals []string
 }
 
 // All returns all supported audiences across all request types in one list.
@@ -104,6 +112,7 @@ func (a Audiences) All() (auds []string) {
 	auds = append(auds, a.SSHRevoke...)
 	auds = append(auds, a.SSHRenew...)
 	auds = append(auds, a.SSHRekey...)
+	auds = append(auds, a.SSHAuthorizedPrincipals...)
 	return
 }
 
@@ -111,13 +120,14 @@ func (a Audiences) All() (auds []string) {
 // given fragment.
 func (a Audiences) WithFragment(fragment string) Audiences {
 	ret := Audiences{
-		Sign:      make([]string, len(a.Sign)),
-		Renew:     make([]string, len(a.Renew)),
-		Revoke:    make([]string, len(a.Revoke)),
-		SSHSign:   make([]string, len(a.SSHSign)),
-		SSHRevoke: make([]string, len(a.SSHRevoke)),
-		SSHRenew:  make([]string, len(a.SSHRenew)),
-		SSHRekey:  make([]string, len(a.SSHRekey)),
+		Sign:                    make([]string, len(a.Sign)),
+		Renew:                   make([]string, len(a.Renew)),
+		Revoke:                  make([]string, len(a.Revoke)),
+		SSHSign:                 make([]string, len(a.SSHSign)),
+		SSHRevoke:               make([]string, len(a.SSHRevoke)),
+		SSHRenew:                make([]string, len(a.SSHRenew)),
+		SSHRekey:                make([]string, len(a.SSHRekey)),
+		SSHAuthorizedPrincipals: make([]string, len(a.SSHAuthorizedPrincipals)),
 	}
 	for i, s := range a.Sign {
 		if u, err := url.Parse(s); err == nil {
@@ -168,6 +178,13 @@ func (a Audiences) WithFragment(fragment string) Audiences {
 			ret.SSHRekey[i] = s
 		}
 	}
+	for i, s := range a.SSHAuthorizedPrincipals {
+		if u, err := url.Parse(s); err == nil {
+			ret.SSHAuthorizedPrincipals[i] = u.ResolveReference(&url.URL{Fragment: fragment}).String()
+		} else {
+			ret.SSHAuthorizedPrincipals[i] = s
+		}
+	}
 	return ret
 }
 
@@ -208,6 +225,10 @@ const (
 	TypeSCEP Type = 10
 	// TypeNebula is used to indicate the Nebula provisioners
 	TypeNebula Type = 11
+	// TypeEST is used to indicate the EST provisioners
+	TypeEST Type = 12
+	// TypeCMP is used to indicate the CMP provisioners
+	TypeCMP Type = 13
 )
 
 // String returns the string representation of the type.
@@ -235,6 +256,10 @@ func (t Type) String() string {
 		return "SCEP"
 	case TypeNebula:
 		return "Nebula"
+	case TypeEST:
+		return "EST"
+	case TypeCMP:
+		return "CMP"
 	default:
 		return ""
 	}
@@ -271,6 +296,9 @@ type Config struct {
 	// AuthorizeSSHRenewFunc is a function that returns nil if a given SSH
 	// certificate can be renewed.
 	AuthorizeSSHRenewFunc AuthorizeSSHRenewFunc
+	// ValidateSCEPChallengeFunc is a function that validates and consumes the
+	// one-time challenges minted by the authority for SCEP provisioners.
+	ValidateSCEPChallengeFunc ValidateSCEPChallengeFunc
 	// WebhookClient is an HTTP client used when performing webhook requests.
 	WebhookClient HTTPClient
 	// SCEPKeyManager, if defined, is the interface used by SCEP provisioners.
@@ -328,6 +356,10 @@ func (l *List) UnmarshalJSON(data []byte) error {
 			p = &SCEP{}
 		case "nebula":
 			p = &Nebula{}
+		case "est":
+			p = &EST{}
+		case "cmp":
+			p = &CMP{}
 		default:
 			// Skip unsupported provisioners. A client using this method may be
 			// compiled with a version of smallstep/certificates that does not
@@ -422,22 +454,23 @@ func (p *raProvisioner) RAInfo() *RAInfo {
 
 // MockProvisioner for testing
 type MockProvisioner struct {
-	Mret1, Mret2, Mret3 interface{}
-	Merr                error
-	MgetID              func() string
-	MgetIDForToken      func() string
-	MgetTokenID         func(string) (string, error)
-	MgetName            func() string
-	MgetType            func() Type
-	MgetEncryptedKey    func() (string, string, bool)
-	Minit               func(Config) error
-	MauthorizeSign      func(ctx context.Context, ott string) ([]SignOption, error)
-	MauthorizeRenew     func(ctx context.Context, cert *x509.Certificate) error
-	MauthorizeRevoke    func(ctx context.Context, ott string) error
-	MauthorizeSSHSign   func(ctx context.Context, ott string) ([]SignOption, error)
-	MauthorizeSSHRenew  func(ctx context.Context, ott string) (*ssh.Certificate, error)
-	MauthorizeSSHRekey  func(ctx context.Context, ott string) (*ssh.Certificate, []SignOption, error)
-	MauthorizeSSHRevoke func(ctx context.Context, ott string) error
+	Mret1, Mret2, Mret3               interface{}
+	Merr                              error
+	MgetID                            func() string
+	MgetIDForToken                    func() string
+	MgetTokenID                       func(string) (string, error)
+	MgetName                          func() string
+	MgetType                          func() Type
+	MgetEncryptedKey                  func() (string, string, bool)
+	Minit                             func(Config) error
+	MauthorizeSign                    func(ctx context.Context, ott string) ([]SignOption, error)
+	MauthorizeRenew                   func(ctx context.Context, cert *x509.Certificate) error
+	MauthorizeRevoke                  func(ctx context.Context, ott string) error
+	MauthorizeSSHSign                 func(ctx context.Context, ott string) ([]SignOption, error)
+	MauthorizeSSHRenew                func(ctx context.Context, ott string) (*ssh.Certificate, error)
+	MauthorizeSSHRekey                func(ctx context.Context, ott string) (*ssh.Certificate, []SignOption, error)
+	MauthorizeSSHAuthorizedPrincipals func(ctx context.Context, ott string) (*ssh.Certificate, error)
+	MauthorizeSSHRevoke               func(ctx context.Context, ott string) error
 }
 
 // GetID mock
@@ -547,6 +580,14 @@ func (m *MockProvisioner) AuthorizeSSHRekey(ctx context.Context, ott string) (*s
 	return m.Mret1.(*ssh.Certificate), m.Mret2.([]SignOption), m.Merr
 }
 
+// AuthorizeSSHAuthorizedPrincipals mock
+func (m *MockProvisioner) AuthorizeSSHAuthorizedPrincipals(ctx context.Context, ott string) (*ssh.Certificate, error) {
+	if m.MauthorizeSSHAuthorizedPrincipals != nil {
+		return m.MauthorizeSSHAuthorizedPrincipals(ctx, ott)
+	}
+	return m.Mret1.(*ssh.Certificate), m.Merr
+}
+
 // AuthorizeSSHRevoke mock
 func (m *MockProvisioner) AuthorizeSSHRevoke(ctx context.Context, ott string) error {
 	if m.MauthorizeSSHRevoke != nil {
@@ -58,6 +58,7 @@ type SCEP struct {
 	ctl                           *Controller
 	encryptionAlgorithm           int
 	challengeValidationController *challengeValidationController
+	validateChallengeFunc         ValidateSCEPChallengeFunc
 	notificationController        *notificationController
 	keyManager                    SCEPKeyManager
 	decrypter                     crypto.Decrypter
@@ -140,6 +141,7 @@ func newChallengeValidationController(client HTTPClient, tw httptransport.Wrappe
 
 var (
 	ErrSCEPChallengeInvalid   = errors.New("webhook server did not allow request")
+	ErrSCEPChallengePending   = errors.New("webhook server deferred the request")
 	ErrSCEPNotificationFailed = errors.New("scep notification failed")
 )
 
@@ -148,9 +150,14 @@ var (
 // the challenge value is accepted, validation succeeds. In
 // that case, the other webhooks will be skipped. If none of
 // the webhooks indicates the value of the challenge was accepted,
-// an error is returned.
+// an error is returned. ErrSCEPChallengePending is returned if none
+// of them accepted the challenge, but at least one of them deferred
+// the decision.
 func (c *challengeValidationController) Validate(ctx context.Context, csr *x509.CertificateRequest, provisionerName, challenge, transactionID string) ([]SignCSROption, error) {
-	var opts []SignCSROption
+	var (
+		opts    []SignCSROption
+		pending bool
+	)
 
 	for _, wh := range c.webhooks {
 		req, err := webhook.NewRequestBody(webhook.WithX509CertificateRequest(csr))
@@ -164,18 +171,24 @@ func (c *challengeValidationController) Validate(ctx context.Context, csr *x509.
 		if err != nil {
 			return nil, fmt.Errorf("failed executing webhook request: %w", err)
 		}
-		if resp.Allow {
+		switch {
+		case resp.Allow:
 			opts = append(opts, TemplateDataModifierFunc(func(data x509util.TemplateData) {
 				data.SetWebhook(wh.Name, resp.Data)
 			}))
+		case resp.Pending:
+			pending = true
 		}
 	}
 
-	if len(opts) == 0 {
+	switch {
+	case len(opts) > 0:
+		return opts, nil
+	case pending:
+		return nil, ErrSCEPChallengePending
+	default:
 		return nil, ErrSCEPChallengeInvalid
 	}
-
-	return opts, nil
 }
 
 type notificationController struct {
@@ -276,6 +289,8 @@ func (s *SCEP) Init(config Config) (err error) {
 		s.GetOptions().GetWebhooks(),
 	)
 
+	s.validateChallengeFunc = config.ValidateSCEPChallengeFunc
+
 	// Prepare the SCEP notification controller
 	s.notificationController = newNotificationController(
 		config.WebhookClient,
@@ -453,13 +468,23 @@ func (s *SCEP) GetContentEncryptionAlgorithm() int {
 	return s.encryptionAlgorithm
 }
 
-// ValidateChallenge validates the provided challenge. It starts by
-// selecting the validation method to use, then performs validation
-// according to that method.
+// ValidateChallenge validates the provided challenge. One-time challenges
+// minted by the authority are always accepted and consumed. Otherwise, it
+// selects the validation method to use, then performs validation according
+// to that method.
 func (s *SCEP) ValidateChallenge(ctx context.Context, csr *x509.CertificateRequest, challenge, transactionID string) ([]SignCSROption, error) {
 	if s.challengeValidationController == nil {
 		return nil, fmt.Errorf("provisioner %q wasn't initialized", s.Name)
 	}
+	if s.validateChallengeFunc != nil && challenge != "" {
+		ok, err := s.validateChallengeFunc(ctx, s, csr, challenge)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return []SignCSROption{}, nil
+		}
+	}
 	switch s.selectValidationMethod() {
 	case validationMethodWebhook:
 		return s.challengeValidationController.Validate(ctx, csr, s.Name, challenge, transactionID)
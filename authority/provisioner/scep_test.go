@@ -75,8 +75,9 @@ func Test_challengeValidationController_Validate(t *testing.T) {
 		TransactionID   string                          `json:"scepTransactionID"`
 	}
 	type response struct {
-		Allow bool `json:"allow"`
-		Data  any  `json:"data"`
+		Allow   bool `json:"allow"`
+		Data    any  `json:"data"`
+		Pending bool `json:"pending"`
 	}
 	nokServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		req := &request{}
@@ -90,6 +91,17 @@ func Test_challengeValidationController_Validate(t *testing.T) {
 		w.WriteHeader(200)
 		w.Write(b)
 	}))
+	pendingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &request{}
+		err := json.NewDecoder(r.Body).Decode(req)
+		require.NoError(t, err)
+		assert.Equal(t, "my-scep-provisioner", req.ProvisionerName)
+		assert.Equal(t, "pending", req.Challenge)
+		b, err := json.Marshal(response{Pending: true})
+		require.NoError(t, err)
+		w.WriteHeader(200)
+		w.Write(b)
+	}))
 	okServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		req := &request{}
 		err := json.NewDecoder(r.Body).Decode(req)
@@ -114,6 +126,7 @@ func Test_challengeValidationController_Validate(t *testing.T) {
 	}))
 	t.Cleanup(func() {
 		nokServer.Close()
+		pendingServer.Close()
 		okServer.Close()
 	})
 	type fields struct {
@@ -187,6 +200,25 @@ func Test_challengeValidationController_Validate(t *testing.T) {
 			},
 			expErr: errors.New("webhook server did not allow request"),
 		},
+		{
+			name: "fail/pending",
+			fields: fields{http.DefaultClient, []*Webhook{
+				{
+					ID:       "webhook-id-1",
+					Name:     "webhook-name-1",
+					Secret:   "MTIzNAo=",
+					Kind:     linkedca.Webhook_SCEPCHALLENGE.String(),
+					CertType: linkedca.Webhook_X509.String(),
+					URL:      pendingServer.URL,
+				},
+			}},
+			args: args{
+				provisionerName: "my-scep-provisioner",
+				challenge:       "pending",
+				transactionID:   "transaction-1",
+			},
+			expErr: ErrSCEPChallengePending,
+		},
 		{
 			name: "ok",
 			fields: fields{http.DefaultClient, []*Webhook{
@@ -501,6 +533,50 @@ func TestSCEP_ValidateChallenge(t *testing.T) {
 	}
 }
 
+func TestSCEP_ValidateChallenge_oneTime(t *testing.T) {
+	csr := &x509.CertificateRequest{Raw: []byte{1}}
+	validate := func(ctx context.Context, p Interface, cr *x509.CertificateRequest, challenge string) (bool, error) {
+		assert.Equal(t, "SCEP", p.GetName())
+		assert.Equal(t, csr, cr)
+		switch challenge {
+		case "one-time":
+			return true, nil
+		case "used":
+			return false, errors.New("scep challenge already used")
+		default:
+			return false, nil
+		}
+	}
+
+	tests := []struct {
+		name      string
+		challenge string
+		expErr    error
+	}{
+		{"ok/one-time", "one-time", nil},
+		{"ok/static", "secret-static-challenge", nil},
+		{"fail/used", "used", errors.New("scep challenge already used")},
+		{"fail/wrong", "wrong", errors.New("invalid challenge password provided")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &SCEP{
+				Name:              "SCEP",
+				Type:              "SCEP",
+				ChallengePassword: "secret-static-challenge",
+			}
+			require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, ValidateSCEPChallengeFunc: validate}))
+			got, err := p.ValidateChallenge(context.Background(), csr, tt.challenge, "transaction-1")
+			if tt.expErr != nil {
+				assert.EqualError(t, err, tt.expErr.Error())
+				return
+			}
+			assert.NoError(t, err)
+			assert.Empty(t, got)
+		})
+	}
+}
+
 func TestSCEP_Init(t *testing.T) {
 	serialize := func(key crypto.PrivateKey, password string) []byte {
 		var opts []pemutil.Options
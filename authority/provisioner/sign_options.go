@@ -85,6 +85,17 @@ func (fn CertificateEnforcerFunc) Enforce(cert *x509.Certificate) error {
 // sign methods.
 type AttestationData struct {
 	PermanentIdentifier string
+	// Fingerprint is the fingerprint of the attested key.
+	Fingerprint string
+	// Format is the format of the attestation statement, e.g. apple, step
+	// or tpm.
+	Format string
+}
+
+// ACMEAccountData is a SignOption used to pass the ACME account of an order
+// to the sign methods.
+type ACMEAccountData struct {
+	ID string
 }
 
 // defaultPublicKeyValidator validates the public key of a certificate request.
@@ -63,6 +63,31 @@ type SignSSHOptions struct {
 	ValidBefore  TimeDuration    `json:"validBefore,omitempty"`
 	TemplateData json.RawMessage `json:"templateData,omitempty"`
 	Backdate     time.Duration   `json:"-"`
+
+	// Attestation contains the FIDO attestation of a security key.
+	Attestation *SSHSecurityKeyAttestation `json:"attestation,omitempty"`
+
+	// HostKeyProof is an SSH signature of the one-time token made with the
+	// private key of the current host certificate. It is used to verify the
+	// identity of the host.
+	HostKeyProof []byte `json:"hostKeyProof,omitempty"`
+
+	// AccessRequestID is the id of an approved SSH access request. It is only
+	// used in the claims of a token.
+	AccessRequestID string `json:"accessRequestID,omitempty"`
+
+	// HostTags and HostGroups contain the tags and groups of the host in the
+	// SSH host inventory. They are set by the authority.
+	HostTags   map[string]string `json:"-"`
+	HostGroups []string          `json:"-"`
+}
+
+// SSHAccessRequestOption is a SignOption that binds the issuance of an SSH
+// certificate to an approved access request. It is added by the provisioners
+// supporting the accessRequestID claim, with the subject of the token.
+type SSHAccessRequestOption struct {
+	ID      string
+	Subject string
 }
 
 // Validate validates the given SignSSHOptions.
@@ -75,7 +100,7 @@ func (o SignSSHOptions) Validate() error {
 			return errs.BadRequest("principals cannot contain empty values")
 		}
 	}
-	return nil
+	return o.Attestation.Validate()
 }
 
 // Type returns the uint32 representation of the CertType.
@@ -375,6 +400,10 @@ func (v sshDefaultPublicKeyValidator) Valid(cert *ssh.Certificate, _ SignSSHOpti
 				8*keyutil.MinRSAKeyBytes, keyutil.MinRSAKeyBytes)
 		}
 		return nil
+	case ssh.KeyAlgoSKECDSA256, ssh.KeyAlgoSKED25519:
+		// The application of security keys is validated with the
+		// sshSecurityKeyModifier.
+		return nil
 	case ssh.InsecureKeyAlgoDSA: //nolint:staticcheck // only using the constant for lookup; no dependent logic
 		return errs.BadRequest("ssh certificate key algorithm (DSA) is not supported")
 	default:
@@ -429,6 +458,36 @@ func (v *sshNamePolicyValidator) Valid(cert *ssh.Certificate, _ SignSSHOptions)
 	}
 }
 
+// sshOptionsPolicyValidator validates that the critical options and
+// extensions of the certificate (to be signed) are allowed.
+type sshOptionsPolicyValidator struct {
+	hostPolicyEngine policy.HostPolicy
+	userPolicyEngine policy.UserPolicy
+}
+
+// newSSHOptionsPolicyValidator return a new SSH critical options and
+// extensions validator.
+func newSSHOptionsPolicyValidator(host policy.HostPolicy, user policy.UserPolicy) *sshOptionsPolicyValidator {
+	return &sshOptionsPolicyValidator{
+		hostPolicyEngine: host,
+		userPolicyEngine: user,
+	}
+}
+
+// Valid validates that the certificate (to be signed) contains only allowed
+// critical options and extensions. Unlike the name policy, the host and user
+// policies are independent: a certificate type without policy is allowed.
+func (v *sshOptionsPolicyValidator) Valid(cert *ssh.Certificate, _ SignSSHOptions) error {
+	switch {
+	case cert.CertType == ssh.HostCert && v.hostPolicyEngine != nil:
+		return v.hostPolicyEngine.IsSSHCertificateAllowed(cert)
+	case cert.CertType == ssh.UserCert && v.userPolicyEngine != nil:
+		return v.userPolicyEngine.IsSSHCertificateAllowed(cert)
+	default:
+		return nil
+	}
+}
+
 // sshCertTypeUInt32
 func sshCertTypeUInt32(ct string) uint32 {
 	switch ct {
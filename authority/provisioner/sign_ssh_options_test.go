@@ -9,6 +9,8 @@ import (
 	"github.com/smallstep/assert"
 	"go.step.sm/crypto/keyutil"
 	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/authority/policy"
 )
 
 func TestSSHOptions_Type(t *testing.T) {
@@ -736,3 +738,35 @@ func Test_sshDefaultDuration_Option(t *testing.T) {
 		})
 	}
 }
+
+func Test_sshOptionsPolicyValidator_Valid(t *testing.T) {
+	options := &Options{
+		SSH: &SSHOptions{
+			User: &policy.SSHUserCertificateOptions{
+				Extensions: &policy.SSHExtensionOptions{Deny: []string{"permit-port-forwarding"}},
+			},
+		},
+	}
+	engine, err := newPolicyEngine(options)
+	assert.FatalError(t, err)
+
+	forwarding := ssh.Permissions{Extensions: map[string]string{"permit-port-forwarding": ""}}
+	tests := []struct {
+		name      string
+		validator *sshOptionsPolicyValidator
+		cert      *ssh.Certificate
+		wantErr   bool
+	}{
+		{"ok/no-policy", newSSHOptionsPolicyValidator(nil, nil), &ssh.Certificate{CertType: ssh.UserCert, Permissions: forwarding}, false},
+		{"ok/user", newSSHOptionsPolicyValidator(engine.getSSHHostOptions(), engine.getSSHUserOptions()), &ssh.Certificate{CertType: ssh.UserCert}, false},
+		{"ok/host-without-policy", newSSHOptionsPolicyValidator(engine.getSSHHostOptions(), engine.getSSHUserOptions()), &ssh.Certificate{CertType: ssh.HostCert, Permissions: forwarding}, false},
+		{"fail/user", newSSHOptionsPolicyValidator(engine.getSSHHostOptions(), engine.getSSHUserOptions()), &ssh.Certificate{CertType: ssh.UserCert, Permissions: forwarding}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.validator.Valid(tt.cert, SignSSHOptions{}); (err != nil) != tt.wantErr {
+				t.Errorf("sshOptionsPolicyValidator.Valid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -12,6 +12,16 @@ import (
 	"github.com/smallstep/certificates/authority/policy"
 )
 
+const (
+	// SSHHostTagsKey is the key used in the template data for the tags of
+	// the host in the SSH host inventory.
+	SSHHostTagsKey = "HostTags"
+
+	// SSHHostGroupsKey is the key used in the template data for the groups
+	// of the host in the SSH host inventory.
+	SSHHostGroupsKey = "HostGroups"
+)
+
 // SSHCertificateOptions is an interface that returns a list of options passed when
 // creating a new certificate.
 type SSHCertificateOptions interface {
@@ -43,6 +53,10 @@ type SSHOptions struct {
 
 	// Host contains SSH host certificate options.
 	Host *policy.SSHHostCertificateOptions `json:"-"`
+
+	// SecurityKey contains the options for keys backed by a FIDO security
+	// key.
+	SecurityKey *SSHSecurityKeyOptions `json:"securityKey,omitempty"`
 }
 
 // GetAllowedUserNameOptions returns the SSHNameOptions that are
@@ -93,6 +107,63 @@ func (o *SSHOptions) GetDeniedHostNameOptions() *policy.SSHNameOptions {
 	return o.Host.DeniedNames
 }
 
+// GetUserCriticalOptions returns the SSHCriticalOptions that are
+// enforced when SSH user certificates are requested.
+func (o *SSHOptions) GetUserCriticalOptions() *policy.SSHCriticalOptions {
+	if o == nil {
+		return nil
+	}
+	if o.User == nil {
+		return nil
+	}
+	return o.User.CriticalOptions
+}
+
+// GetUserExtensions returns the SSHExtensionOptions that are
+// enforced when SSH user certificates are requested.
+func (o *SSHOptions) GetUserExtensions() *policy.SSHExtensionOptions {
+	if o == nil {
+		return nil
+	}
+	if o.User == nil {
+		return nil
+	}
+	return o.User.Extensions
+}
+
+// GetHostCriticalOptions returns the SSHCriticalOptions that are
+// enforced when SSH host certificates are requested.
+func (o *SSHOptions) GetHostCriticalOptions() *policy.SSHCriticalOptions {
+	if o == nil {
+		return nil
+	}
+	if o.Host == nil {
+		return nil
+	}
+	return o.Host.CriticalOptions
+}
+
+// GetHostExtensions returns the SSHExtensionOptions that are
+// enforced when SSH host certificates are requested.
+func (o *SSHOptions) GetHostExtensions() *policy.SSHExtensionOptions {
+	if o == nil {
+		return nil
+	}
+	if o.Host == nil {
+		return nil
+	}
+	return o.Host.Extensions
+}
+
+// GetSecurityKeyOptions returns the SSHSecurityKeyOptions used to validate
+// keys backed by a FIDO security key.
+func (o *SSHOptions) GetSecurityKeyOptions() *SSHSecurityKeyOptions {
+	if o == nil {
+		return nil
+	}
+	return o.SecurityKey
+}
+
 // HasTemplate returns true if a template is defined in the provisioner options.
 func (o *SSHOptions) HasTemplate() bool {
 	return o != nil && (o.Template != "" || o.TemplateFile != "")
@@ -126,6 +197,14 @@ func CustomSSHTemplateOptions(o *Options, data sshutil.TemplateData, defaultTemp
 	}
 
 	return sshCertificateOptionsFunc(func(so SignSSHOptions) []sshutil.Option {
+		// Add the tags and groups of the host in the SSH host inventory.
+		if so.HostTags != nil {
+			data.Set(SSHHostTagsKey, so.HostTags)
+		}
+		if so.HostGroups != nil {
+			data.Set(SSHHostGroupsKey, so.HostGroups)
+		}
+
 		// We're not provided user data without custom templates.
 		if !opts.HasTemplate() {
 			return []sshutil.Option{
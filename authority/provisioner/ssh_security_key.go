@@ -0,0 +1,364 @@
+package provisioner
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+const (
+	// sshVerifyRequiredOption is the name of the SSH critical option that
+	// requires signatures made with user verification (PIN or biometrics).
+	sshVerifyRequiredOption = "verify-required"
+
+	// sshAttestationV01 is the magic string used in the attestation
+	// generated by `ssh-keygen -O write-attestation`.
+	sshAttestationV01 = "ssh-sk-attest-v01"
+)
+
+// FIDO authenticator data flags.
+const (
+	authDataFlagUserPresent            = 0x01
+	authDataFlagUserVerified           = 0x04
+	authDataFlagAttestedCredentialData = 0x40
+)
+
+// COSE key parameters used in the attested credential data.
+const (
+	coseKeyType      = 1
+	coseKeyCurve     = -1
+	coseKeyX         = -2
+	coseKeyY         = -3
+	coseKeyTypeOKP   = 1
+	coseKeyTypeEC2   = 2
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+// SSHSecurityKeyOptions contains the options used to sign SSH certificates
+// for keys backed by a FIDO security key, sk-ecdsa-sha2-nistp256@openssh.com
+// and sk-ssh-ed25519@openssh.com.
+type SSHSecurityKeyOptions struct {
+	// Required requires the public key in the certificate to be backed by a
+	// security key.
+	Required bool `json:"required,omitempty"`
+
+	// VerifyRequired adds the verify-required critical option to user
+	// certificates, so sshd only accepts signatures made with user
+	// verification. It implies Required.
+	VerifyRequired bool `json:"verifyRequired,omitempty"`
+
+	// AttestationRoots contains a bundle of root certificates in PEM format
+	// that will be used to verify the FIDO attestation certificates. If
+	// provided, an attestation is required for security keys.
+	AttestationRoots []byte `json:"attestationRoots,omitempty"`
+}
+
+// IsRequired returns true if the public key must be backed by a security key.
+func (o *SSHSecurityKeyOptions) IsRequired() bool {
+	return o != nil && (o.Required || o.VerifyRequired)
+}
+
+// SSHSecurityKeyAttestation contains the FIDO attestation of a security key
+// as written by `ssh-keygen -O write-attestation`, and the challenge used
+// when the key was generated.
+type SSHSecurityKeyAttestation struct {
+	Data      []byte `json:"data"`
+	Challenge []byte `json:"challenge"`
+}
+
+// Validate validates the SSHSecurityKeyAttestation.
+func (a *SSHSecurityKeyAttestation) Validate() error {
+	switch {
+	case a == nil:
+		return nil
+	case len(a.Data) == 0:
+		return errs.BadRequest("attestation data cannot be empty")
+	case len(a.Challenge) == 0:
+		return errs.BadRequest("attestation challenge cannot be empty")
+	default:
+		return nil
+	}
+}
+
+// sshSecurityKeyModifier is an SSHCertModifier that validates security key
+// backed public keys and their attestation. If configured, it adds the
+// verify-required critical option to user certificates. A nil modifier
+// still validates security keys and attestations given by the client.
+type sshSecurityKeyModifier struct {
+	options *SSHSecurityKeyOptions
+	roots   *x509.CertPool
+}
+
+// newSSHSecurityKeyModifier creates a new sshSecurityKeyModifier with the
+// given options. It returns nil if no options are given.
+func newSSHSecurityKeyModifier(o *SSHSecurityKeyOptions) (*sshSecurityKeyModifier, error) {
+	if o == nil {
+		return nil, nil
+	}
+	m := &sshSecurityKeyModifier{options: o}
+	if rest := o.AttestationRoots; len(rest) > 0 {
+		var block *pem.Block
+		m.roots = x509.NewCertPool()
+		hasCert := false
+		for rest != nil {
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, errors.New("error parsing ssh securityKey attestationRoots: malformed certificate")
+			}
+			m.roots.AddCert(cert)
+			hasCert = true
+		}
+		if !hasCert {
+			return nil, errors.New("error parsing ssh securityKey attestationRoots: no certificates found")
+		}
+	}
+	return m, nil
+}
+
+// Modify implements SSHCertModifier. It validates the certificate key and,
+// if present, the attestation in the options.
+func (m *sshSecurityKeyModifier) Modify(cert *ssh.Certificate, o SignSSHOptions) error {
+	var opts *SSHSecurityKeyOptions
+	var roots *x509.CertPool
+	if m != nil {
+		opts, roots = m.options, m.roots
+	}
+
+	if cert.Key == nil {
+		return errs.BadRequest("ssh certificate key cannot be nil")
+	}
+	if !isSSHSecurityKey(cert.Key) {
+		if opts.IsRequired() {
+			return errs.Forbidden("ssh certificate key must be backed by a security key, got %s", cert.Key.Type())
+		}
+		if o.Attestation != nil {
+			return errs.BadRequest("ssh certificate attestation is only supported for security keys")
+		}
+		return nil
+	}
+
+	application, err := sshSecurityKeyApplication(cert.Key)
+	if err != nil {
+		return errs.BadRequestErr(err, "error parsing security key")
+	}
+	if !strings.HasPrefix(application, "ssh:") {
+		return errs.Forbidden("ssh certificate security key application %q is not valid", application)
+	}
+
+	switch {
+	case o.Attestation != nil:
+		if err := o.Attestation.Validate(); err != nil {
+			return err
+		}
+		if err := verifySSHSecurityKeyAttestation(cert.Key, application, o.Attestation, roots, opts != nil && opts.VerifyRequired); err != nil {
+			return errs.ForbiddenErr(err, "error validating security key attestation: %s", err)
+		}
+	case roots != nil:
+		return errs.Forbidden("ssh certificate security key attestation is required")
+	}
+
+	if opts != nil && opts.VerifyRequired && cert.CertType == ssh.UserCert {
+		if cert.CriticalOptions == nil {
+			cert.CriticalOptions = make(map[string]string)
+		}
+		cert.CriticalOptions[sshVerifyRequiredOption] = ""
+	}
+
+	return nil
+}
+
+// isSSHSecurityKey returns true if the given key is backed by a FIDO security
+// key.
+func isSSHSecurityKey(key ssh.PublicKey) bool {
+	switch key.Type() {
+	case ssh.KeyAlgoSKECDSA256, ssh.KeyAlgoSKED25519:
+		return true
+	default:
+		return false
+	}
+}
+
+// sshSecurityKeyApplication returns the application string of a security
+// key. It is not exposed by the ssh package, so it is read from the wire
+// format of the key.
+func sshSecurityKeyApplication(key ssh.PublicKey) (string, error) {
+	switch key.Type() {
+	case ssh.KeyAlgoSKECDSA256:
+		var w struct {
+			Name        string
+			Curve       string
+			Point       []byte
+			Application string
+			Rest        []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(key.Marshal(), &w); err != nil {
+			return "", errors.Wrap(err, "error unmarshalling public key")
+		}
+		return w.Application, nil
+	case ssh.KeyAlgoSKED25519:
+		var w struct {
+			Name        string
+			KeyBytes    []byte
+			Application string
+			Rest        []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(key.Marshal(), &w); err != nil {
+			return "", errors.Wrap(err, "error unmarshalling public key")
+		}
+		return w.Application, nil
+	default:
+		return "", errors.Errorf("unsupported key type %s", key.Type())
+	}
+}
+
+// verifySSHSecurityKeyAttestation verifies a FIDO attestation in the format
+// written by OpenSSH. It checks that the attestation was signed by the
+// attestation certificate, that the attested credential is the given key
+// and that it was created for the given application. If roots are given,
+// the attestation certificate must chain to one of them. Only the packed
+// attestation format is supported.
+func verifySSHSecurityKeyAttestation(key ssh.PublicKey, application string, att *SSHSecurityKeyAttestation, roots *x509.CertPool, verifyRequired bool) error {
+	var w struct {
+		Magic       string
+		Certificate []byte
+		Signature   []byte
+		AuthData    []byte
+		Flags       uint32
+		Extensions  []byte
+	}
+	if err := ssh.Unmarshal(att.Data, &w); err != nil {
+		return errors.Wrap(err, "error parsing attestation")
+	}
+	if w.Magic != sshAttestationV01 {
+		return errors.Errorf("unsupported attestation format %q", w.Magic)
+	}
+
+	leaf, err := x509.ParseCertificate(w.Certificate)
+	if err != nil {
+		return errors.Wrap(err, "error parsing attestation certificate")
+	}
+	if roots != nil {
+		if _, err := leaf.Verify(x509.VerifyOptions{
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}); err != nil {
+			return errors.Wrap(err, "error verifying attestation certificate")
+		}
+	}
+
+	// The authenticator data is encoded as a CBOR byte string.
+	var authData []byte
+	if err := cbor.Unmarshal(w.AuthData, &authData); err != nil {
+		return errors.Wrap(err, "error parsing authenticator data")
+	}
+
+	// The signature is over the authenticator data and the hash of the
+	// client data, the challenge for OpenSSH.
+	clientDataHash := sha256.Sum256(att.Challenge)
+	signed := append(bytes.Clone(authData), clientDataHash[:]...)
+	if err := checkAttestationSignature(leaf, signed, w.Signature); err != nil {
+		return err
+	}
+
+	// Authenticator data is rpIdHash (32) || flags (1) || counter (4) ||
+	// attested credential data.
+	if len(authData) < 37 {
+		return errors.New("authenticator data is too short")
+	}
+	rpIDHash := sha256.Sum256([]byte(application))
+	if !bytes.Equal(authData[:32], rpIDHash[:]) {
+		return errors.New("authenticator data application does not match")
+	}
+	flags := authData[32]
+	switch {
+	case flags&authDataFlagUserPresent == 0:
+		return errors.New("authenticator data user present flag is not set")
+	case verifyRequired && flags&authDataFlagUserVerified == 0:
+		return errors.New("authenticator data user verified flag is not set")
+	case flags&authDataFlagAttestedCredentialData == 0:
+		return errors.New("authenticator data does not contain attested credential data")
+	}
+
+	// Attested credential data is aaguid (16) || credentialIdLength (2) ||
+	// credentialId || credentialPublicKey (COSE).
+	data := authData[37:]
+	if len(data) < 18 {
+		return errors.New("attested credential data is too short")
+	}
+	n := int(binary.BigEndian.Uint16(data[16:18]))
+	if len(data) < 18+n {
+		return errors.New("attested credential data is too short")
+	}
+	var coseKey map[int]any
+	if _, err := cbor.UnmarshalFirst(data[18+n:], &coseKey); err != nil {
+		return errors.Wrap(err, "error parsing attested credential public key")
+	}
+	if !coseKeyEqual(coseKey, key) {
+		return errors.New("attested credential public key does not match")
+	}
+
+	return nil
+}
+
+// checkAttestationSignature checks the signature of the given data using the
+// public key in the attestation certificate.
+func checkAttestationSignature(cert *x509.Certificate, signed, signature []byte) error {
+	var algo x509.SignatureAlgorithm
+	switch cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		algo = x509.ECDSAWithSHA256
+	case ed25519.PublicKey:
+		algo = x509.PureEd25519
+	default:
+		algo = x509.SHA256WithRSA
+	}
+	if err := cert.CheckSignature(algo, signed, signature); err != nil {
+		return errors.Wrap(err, "error verifying attestation signature")
+	}
+	return nil
+}
+
+// coseKeyEqual returns true if the COSE key is the same as the given security
+// key.
+func coseKeyEqual(coseKey map[int]any, key ssh.PublicKey) bool {
+	cpk, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return false
+	}
+	kty, _ := coseKey[coseKeyType].(uint64)
+	crv, _ := coseKey[coseKeyCurve].(uint64)
+	x, _ := coseKey[coseKeyX].([]byte)
+	switch pub := cpk.CryptoPublicKey().(type) {
+	case *ecdsa.PublicKey:
+		y, _ := coseKey[coseKeyY].([]byte)
+		if kty != coseKeyTypeEC2 || crv != coseCurveP256 || pub.Curve != elliptic.P256() {
+			return false
+		}
+		return new(big.Int).SetBytes(x).Cmp(pub.X) == 0 && new(big.Int).SetBytes(y).Cmp(pub.Y) == 0
+	case ed25519.PublicKey:
+		if kty != coseKeyTypeOKP || crv != coseCurveEd25519 {
+			return false
+		}
+		return bytes.Equal(x, pub)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,244 @@
+package provisioner
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/minica"
+	"golang.org/x/crypto/ssh"
+)
+
+func mustSKECDSAKey(t *testing.T, application string) (ssh.PublicKey, *ecdsa.PublicKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	pub, err := ssh.ParsePublicKey(ssh.Marshal(struct {
+		Name        string
+		Curve       string
+		Point       []byte
+		Application string
+	}{ssh.KeyAlgoSKECDSA256, "nistp256", elliptic.Marshal(elliptic.P256(), key.X, key.Y), application})) //nolint:staticcheck // wire format of the key
+	require.NoError(t, err)
+	return pub, &key.PublicKey
+}
+
+func mustSKEd25519Key(t *testing.T, application string) (ssh.PublicKey, ed25519.PublicKey) {
+	t.Helper()
+	key, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	pub, err := ssh.ParsePublicKey(ssh.Marshal(struct {
+		Name        string
+		KeyBytes    []byte
+		Application string
+	}{ssh.KeyAlgoSKED25519, key, application}))
+	require.NoError(t, err)
+	return pub, key
+}
+
+type testSSHAttestation struct {
+	ca          *minica.CA
+	roots       []byte
+	application string
+	flags       byte
+	challenge   []byte
+}
+
+func newTestSSHAttestation(t *testing.T) *testSSHAttestation {
+	t.Helper()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	return &testSSHAttestation{
+		ca:          ca,
+		roots:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw}),
+		application: "ssh:",
+		flags:       authDataFlagUserPresent | authDataFlagAttestedCredentialData,
+		challenge:   []byte("the-challenge"),
+	}
+}
+
+func (a *testSSHAttestation) attest(t *testing.T, coseKey map[int]any) []byte {
+	t.Helper()
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	cert, err := a.ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "Security Key Attestation"},
+		PublicKey: signer.Public(),
+	})
+	require.NoError(t, err)
+
+	credentialID := []byte("credential-id")
+	encodedKey, err := cbor.Marshal(coseKey)
+	require.NoError(t, err)
+
+	rpIDHash := sha256.Sum256([]byte(a.application))
+	authData := append(rpIDHash[:], a.flags, 0, 0, 0, 1)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(credentialID)))
+	authData = append(authData, credentialID...)
+	authData = append(authData, encodedKey...)
+
+	clientDataHash := sha256.Sum256(a.challenge)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, signer, digest[:])
+	require.NoError(t, err)
+
+	encodedAuthData, err := cbor.Marshal(authData)
+	require.NoError(t, err)
+
+	return ssh.Marshal(struct {
+		Magic       string
+		Certificate []byte
+		Signature   []byte
+		AuthData    []byte
+		Flags       uint32
+		Extensions  []byte
+	}{sshAttestationV01, cert.Raw, sig, encodedAuthData, 0, nil})
+}
+
+func ecdsaCOSEKey(pub *ecdsa.PublicKey) map[int]any {
+	return map[int]any{
+		coseKeyType:  coseKeyTypeEC2,
+		3:            -7,
+		coseKeyCurve: coseCurveP256,
+		coseKeyX:     pub.X.FillBytes(make([]byte, 32)),
+		coseKeyY:     pub.Y.FillBytes(make([]byte, 32)),
+	}
+}
+
+func TestSSHSecurityKeyAttestation_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		att     *SSHSecurityKeyAttestation
+		wantErr bool
+	}{
+		{"ok", &SSHSecurityKeyAttestation{Data: []byte("data"), Challenge: []byte("challenge")}, false},
+		{"ok nil", nil, false},
+		{"fail data", &SSHSecurityKeyAttestation{Challenge: []byte("challenge")}, true},
+		{"fail challenge", &SSHSecurityKeyAttestation{Data: []byte("data")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.att.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SSHSecurityKeyAttestation.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_newSSHSecurityKeyModifier(t *testing.T) {
+	ta := newTestSSHAttestation(t)
+
+	m, err := newSSHSecurityKeyModifier(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+
+	m, err = newSSHSecurityKeyModifier(&SSHSecurityKeyOptions{Required: true})
+	assert.NoError(t, err)
+	assert.Nil(t, m.roots)
+
+	m, err = newSSHSecurityKeyModifier(&SSHSecurityKeyOptions{AttestationRoots: ta.roots})
+	assert.NoError(t, err)
+	assert.NotNil(t, m.roots)
+
+	_, err = newSSHSecurityKeyModifier(&SSHSecurityKeyOptions{AttestationRoots: []byte("not a pem")})
+	assert.EqualError(t, err, "error parsing ssh securityKey attestationRoots: no certificates found")
+
+	_, err = newSSHSecurityKeyModifier(&SSHSecurityKeyOptions{AttestationRoots: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("foo")})})
+	assert.EqualError(t, err, "error parsing ssh securityKey attestationRoots: malformed certificate")
+}
+
+func Test_sshSecurityKeyModifier_Modify(t *testing.T) {
+	ta := newTestSSHAttestation(t)
+	skECDSA, ecdsaPub := mustSKECDSAKey(t, "ssh:")
+	skEd25519, ed25519Pub := mustSKEd25519Key(t, "ssh:")
+	skWeb, _ := mustSKECDSAKey(t, "https://example.com")
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecSSHKey, err := ssh.NewPublicKey(ecKey.Public())
+	require.NoError(t, err)
+
+	ecdsaAttestation := &SSHSecurityKeyAttestation{
+		Data:      ta.attest(t, ecdsaCOSEKey(ecdsaPub)),
+		Challenge: ta.challenge,
+	}
+	ed25519Attestation := &SSHSecurityKeyAttestation{
+		Data: ta.attest(t, map[int]any{
+			coseKeyType:  coseKeyTypeOKP,
+			3:            -8,
+			coseKeyCurve: coseCurveEd25519,
+			coseKeyX:     []byte(ed25519Pub),
+		}),
+		Challenge: ta.challenge,
+	}
+	otherKey, _ := mustSKECDSAKey(t, "ssh:")
+
+	uvAttestation := newTestSSHAttestation(t)
+	uvAttestation.flags |= authDataFlagUserVerified
+
+	required := &sshSecurityKeyModifier{options: &SSHSecurityKeyOptions{Required: true}}
+	verifyRequired := &sshSecurityKeyModifier{options: &SSHSecurityKeyOptions{VerifyRequired: true}}
+	attested, err := newSSHSecurityKeyModifier(&SSHSecurityKeyOptions{AttestationRoots: ta.roots})
+	require.NoError(t, err)
+	attestedVerify, err := newSSHSecurityKeyModifier(&SSHSecurityKeyOptions{VerifyRequired: true, AttestationRoots: uvAttestation.roots})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name                string
+		modifier            *sshSecurityKeyModifier
+		cert                *ssh.Certificate
+		opts                SignSSHOptions
+		wantCriticalOptions map[string]string
+		wantErr             string
+	}{
+		{"ok nil", nil, &ssh.Certificate{Key: ecSSHKey, CertType: ssh.UserCert}, SignSSHOptions{}, nil, ""},
+		{"ok nil sk", nil, &ssh.Certificate{Key: skECDSA, CertType: ssh.UserCert}, SignSSHOptions{}, nil, ""},
+		{"ok nil attestation", nil, &ssh.Certificate{Key: skECDSA, CertType: ssh.UserCert}, SignSSHOptions{Attestation: ecdsaAttestation}, nil, ""},
+		{"ok required", required, &ssh.Certificate{Key: skEd25519, CertType: ssh.UserCert}, SignSSHOptions{}, nil, ""},
+		{"ok verifyRequired", verifyRequired, &ssh.Certificate{Key: skECDSA, CertType: ssh.UserCert}, SignSSHOptions{}, map[string]string{"verify-required": ""}, ""},
+		{"ok verifyRequired host", verifyRequired, &ssh.Certificate{Key: skECDSA, CertType: ssh.HostCert}, SignSSHOptions{}, nil, ""},
+		{"ok attested ecdsa", attested, &ssh.Certificate{Key: skECDSA, CertType: ssh.UserCert}, SignSSHOptions{Attestation: ecdsaAttestation}, nil, ""},
+		{"ok attested ed25519", attested, &ssh.Certificate{Key: skEd25519, CertType: ssh.UserCert}, SignSSHOptions{Attestation: ed25519Attestation}, nil, ""},
+		{"ok attested verifyRequired", attestedVerify, &ssh.Certificate{Key: skECDSA, CertType: ssh.UserCert}, SignSSHOptions{Attestation: &SSHSecurityKeyAttestation{
+			Data: uvAttestation.attest(t, ecdsaCOSEKey(ecdsaPub)), Challenge: uvAttestation.challenge,
+		}}, map[string]string{"verify-required": ""}, ""},
+		{"fail nil key", nil, &ssh.Certificate{CertType: ssh.UserCert}, SignSSHOptions{}, nil, "ssh certificate key cannot be nil"},
+		{"fail required", required, &ssh.Certificate{Key: ecSSHKey, CertType: ssh.UserCert}, SignSSHOptions{}, nil, "ssh certificate key must be backed by a security key, got ecdsa-sha2-nistp256"},
+		{"fail verifyRequired", verifyRequired, &ssh.Certificate{Key: ecSSHKey, CertType: ssh.UserCert}, SignSSHOptions{}, nil, "ssh certificate key must be backed by a security key, got ecdsa-sha2-nistp256"},
+		{"fail attestation not sk", nil, &ssh.Certificate{Key: ecSSHKey, CertType: ssh.UserCert}, SignSSHOptions{Attestation: ecdsaAttestation}, nil, "ssh certificate attestation is only supported for security keys"},
+		{"fail application", nil, &ssh.Certificate{Key: skWeb, CertType: ssh.UserCert}, SignSSHOptions{}, nil, `ssh certificate security key application "https://example.com" is not valid`},
+		{"fail attestation required", attested, &ssh.Certificate{Key: skECDSA, CertType: ssh.UserCert}, SignSSHOptions{}, nil, "ssh certificate security key attestation is required"},
+		{"fail attestation challenge", attested, &ssh.Certificate{Key: skECDSA, CertType: ssh.UserCert}, SignSSHOptions{Attestation: &SSHSecurityKeyAttestation{
+			Data: ecdsaAttestation.Data, Challenge: []byte("other-challenge"),
+		}}, nil, "error verifying attestation signature"},
+		{"fail attestation key", attested, &ssh.Certificate{Key: otherKey, CertType: ssh.UserCert}, SignSSHOptions{Attestation: ecdsaAttestation}, nil, "attested credential public key does not match"},
+		{"fail attestation roots", attestedVerify, &ssh.Certificate{Key: skECDSA, CertType: ssh.UserCert}, SignSSHOptions{Attestation: ecdsaAttestation}, nil, "error verifying attestation certificate"},
+		{"fail attestation user verified", verifyRequired, &ssh.Certificate{Key: skECDSA, CertType: ssh.UserCert}, SignSSHOptions{Attestation: ecdsaAttestation}, nil, "authenticator data user verified flag is not set"},
+		{"fail attestation format", nil, &ssh.Certificate{Key: skECDSA, CertType: ssh.UserCert}, SignSSHOptions{Attestation: &SSHSecurityKeyAttestation{
+			Data: ssh.Marshal(struct{ Magic string }{"ssh-sk-attest-v00"}), Challenge: ta.challenge,
+		}}, nil, "error parsing attestation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.modifier.Modify(tt.cert, tt.opts)
+			if tt.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantCriticalOptions, tt.cert.CriticalOptions)
+		})
+	}
+}
@@ -236,6 +236,19 @@ func (p *SSHPOP) AuthorizeSSHRekey(_ context.Context, token string) (*ssh.Certif
 	}, nil
 }
 
+// AuthorizeSSHAuthorizedPrincipals validates the authorization token and
+// extracts/validates the SSH host certificate from the ssh-pop header.
+func (p *SSHPOP) AuthorizeSSHAuthorizedPrincipals(_ context.Context, token string) (*ssh.Certificate, error) {
+	claims, err := p.authorizeToken(token, p.ctl.Audiences.SSHAuthorizedPrincipals, true)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "sshpop.AuthorizeSSHAuthorizedPrincipals")
+	}
+	if claims.sshCert.CertType != ssh.HostCert {
+		return nil, errs.BadRequest("sshpop certificate must be a host ssh certificate")
+	}
+	return claims.sshCert, nil
+}
+
 // ExtractSSHPOPCert parses a JWT and extracts and loads the SSH Certificate
 // in the sshpop header. If the header is missing, an error is returned.
 func ExtractSSHPOPCert(token string) (*ssh.Certificate, *jose.JSONWebToken, error) {
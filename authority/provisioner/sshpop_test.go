@@ -482,6 +482,104 @@ func TestSSHPOP_AuthorizeSSHRekey(t *testing.T) {
 	}
 }
 
+func TestSSHPOP_AuthorizeSSHAuthorizedPrincipals(t *testing.T) {
+	key, err := pemutil.Read("./testdata/secrets/ssh_user_ca_key")
+	assert.FatalError(t, err)
+	userSigner, ok := key.(crypto.Signer)
+	assert.Fatal(t, ok, "could not cast ssh user signing key to crypto signer")
+	sshUserSigner, err := ssh.NewSignerFromSigner(userSigner)
+	assert.FatalError(t, err)
+
+	hostKey, err := pemutil.Read("./testdata/secrets/ssh_host_ca_key")
+	assert.FatalError(t, err)
+	hostSigner, ok := hostKey.(crypto.Signer)
+	assert.Fatal(t, ok, "could not cast ssh host signing key to crypto signer")
+	sshHostSigner, err := ssh.NewSignerFromSigner(hostSigner)
+	assert.FatalError(t, err)
+
+	type test struct {
+		p     *SSHPOP
+		token string
+		cert  *ssh.Certificate
+		err   error
+		code  int
+	}
+	tests := map[string]func(*testing.T) test{
+		"fail/bad-token": func(t *testing.T) test {
+			p, err := generateSSHPOP()
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: "foo",
+				code:  http.StatusUnauthorized,
+				err:   errors.New("sshpop.AuthorizeSSHAuthorizedPrincipals: sshpop.authorizeToken; error extracting sshpop header from token: extractSSHPOPCert; error parsing token: "),
+			}
+		},
+		"fail/bad-audience": func(t *testing.T) test {
+			p, err := generateSSHPOP()
+			assert.FatalError(t, err)
+			cert, jwk, err := createSSHCert(&ssh.Certificate{CertType: ssh.HostCert}, sshHostSigner)
+			assert.FatalError(t, err)
+			tok, err := generateToken("foo", p.GetName(), testAudiences.SSHRenew[0], "",
+				[]string{"test.smallstep.com"}, time.Now(), jwk, withSSHPOPFile(cert))
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+				code:  http.StatusUnauthorized,
+				err:   errors.New("sshpop.AuthorizeSSHAuthorizedPrincipals: sshpop.authorizeToken; sshpop token has invalid audience claim (aud)"),
+			}
+		},
+		"fail/not-host-cert": func(t *testing.T) test {
+			p, err := generateSSHPOP()
+			assert.FatalError(t, err)
+			cert, jwk, err := createSSHCert(&ssh.Certificate{CertType: ssh.UserCert}, sshUserSigner)
+			assert.FatalError(t, err)
+			tok, err := generateToken("foo", p.GetName(), testAudiences.SSHAuthorizedPrincipals[0], "",
+				[]string{"test.smallstep.com"}, time.Now(), jwk, withSSHPOPFile(cert))
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+				code:  http.StatusBadRequest,
+				err:   errors.New("sshpop certificate must be a host ssh certificate"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			p, err := generateSSHPOP()
+			assert.FatalError(t, err)
+			cert, jwk, err := createSSHCert(&ssh.Certificate{Serial: 123455, CertType: ssh.HostCert}, sshHostSigner)
+			assert.FatalError(t, err)
+			tok, err := generateToken("123455", p.GetName(), testAudiences.SSHAuthorizedPrincipals[0], "",
+				[]string{"test.smallstep.com"}, time.Now(), jwk, withSSHPOPFile(cert))
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+				cert:  cert,
+			}
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc := tt(t)
+			if cert, err := tc.p.AuthorizeSSHAuthorizedPrincipals(context.Background(), tc.token); err != nil {
+				if assert.NotNil(t, tc.err) {
+					var sc render.StatusCodedError
+					if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+						assert.Equals(t, sc.StatusCode(), tc.code)
+					}
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+			} else {
+				if assert.Nil(t, tc.err) {
+					assert.Equals(t, tc.cert.Nonce, cert.Nonce)
+				}
+			}
+		})
+	}
+}
+
 func TestSSHPOP_ExtractSSHPOPCert(t *testing.T) {
 	hostKey, err := pemutil.Read("./testdata/secrets/ssh_host_ca_key")
 	assert.FatalError(t, err)
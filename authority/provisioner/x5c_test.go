@@ -786,7 +786,7 @@ func TestX5C_AuthorizeSSHSign(t *testing.T) {
 				p:      p,
 				claims: claims,
 				token:  tok,
-				count:  12,
+				count:  14,
 			}
 		},
 		"ok/without-claims": func(t *testing.T) test {
@@ -814,7 +814,7 @@ func TestX5C_AuthorizeSSHSign(t *testing.T) {
 				p:      p,
 				claims: claims,
 				token:  tok,
-				count:  10,
+				count:  12,
 			}
 		},
 		"ok/cnf": func(t *testing.T) test {
@@ -849,7 +849,7 @@ func TestX5C_AuthorizeSSHSign(t *testing.T) {
 				claims:      claims,
 				token:       tok,
 				fingerprint: "fingerprint",
-				count:       10,
+				count:       12,
 			}
 		},
 	}
@@ -894,6 +894,11 @@ func TestX5C_AuthorizeSSHSign(t *testing.T) {
 							case *sshNamePolicyValidator:
 								assert.Nil(t, v.userPolicyEngine)
 								assert.Nil(t, v.hostPolicyEngine)
+							case *sshOptionsPolicyValidator:
+								assert.Nil(t, v.userPolicyEngine)
+								assert.Nil(t, v.hostPolicyEngine)
+							case *sshSecurityKeyModifier:
+								assert.Nil(t, v)
 							case *sshDefaultPublicKeyValidator, *sshCertDefaultValidator, sshCertificateOptionsFunc:
 							case *WebhookController:
 								assert.Len(t, v.webhooks, 0)
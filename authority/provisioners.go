@@ -198,13 +198,14 @@ func (a *Authority) generateProvisionerConfig(ctx context.Context) (provisioner.
 			UserKeys: sshKeys.UserKeys,
 			HostKeys: sshKeys.HostKeys,
 		},
-		GetIdentityFunc:       a.getIdentityFunc,
-		AuthorizeRenewFunc:    a.authorizeRenewFunc,
-		AuthorizeSSHRenewFunc: a.authorizeSSHRenewFunc,
-		WebhookClient:         a.webhookClient,
-		HTTPClient:            a.httpClient,
-		WrapTransport:         a.wrapTransport,
-		SCEPKeyManager:        a.scepKeyManager,
+		GetIdentityFunc:           a.getIdentityFunc,
+		AuthorizeRenewFunc:        a.authorizeRenewFunc,
+		AuthorizeSSHRenewFunc:     a.authorizeSSHRenewFunc,
+		ValidateSCEPChallengeFunc: a.validateSCEPChallenge,
+		WebhookClient:             a.webhookClient,
+		HTTPClient:                a.httpClient,
+		WrapTransport:             a.wrapTransport,
+		SCEPKeyManager:            a.scepKeyManager,
 	}, nil
 }
 
@@ -2,6 +2,8 @@ package authority
 
 import (
 	"crypto/x509"
+	"slices"
+	"time"
 
 	"github.com/smallstep/certificates/errs"
 )
@@ -65,6 +67,9 @@ func (a *Authority) GetFederation() (federation []*x509.Certificate, err error)
 // Authority Service (CAS) that does not implement the
 // CertificateAuthorityGetter interface.
 func (a *Authority) GetIntermediateCertificate() *x509.Certificate {
+	if r := a.getIntermediateRotation(); r != nil && r.isActive(time.Now()) {
+		return r.chain[0]
+	}
 	if len(a.intermediateX509Certs) > 0 {
 		return a.intermediateX509Certs[0]
 	}
@@ -72,11 +77,49 @@ func (a *Authority) GetIntermediateCertificate() *x509.Certificate {
 }
 
 // GetIntermediateCertificates returns a list of all intermediate certificates
-// configured. The first certificate in the list will be the issuer certificate.
+// configured. The first certificate in the list will be the issuer certificate
+// of the default CAS. During an intermediate rotation, both the current and
+// new intermediates, and the cross-signed one, are included in the order of
+// use. The intermediates of the named CAS are added at the end.
 //
 // This method can return an empty list or nil if the CA is configured with a
 // Certificate Authority Service (CAS) that does not implement the
 // CertificateAuthorityGetter interface.
 func (a *Authority) GetIntermediateCertificates() []*x509.Certificate {
-	return a.intermediateX509Certs
+	r := a.getIntermediateRotation()
+	if r == nil && len(a.x509Issuers) == 0 {
+		return a.intermediateX509Certs
+	}
+
+	var certs []*x509.Certificate
+	if r != nil {
+		rotated := []*x509.Certificate{r.chain[0]}
+		if r.cross != nil {
+			rotated = append(rotated, r.cross)
+		}
+		if r.isActive(time.Now()) {
+			certs = append(rotated, a.intermediateX509Certs...)
+		} else {
+			certs = append(slices.Clone(a.intermediateX509Certs), rotated...)
+		}
+	} else {
+		certs = slices.Clone(a.intermediateX509Certs)
+	}
+	for _, iss := range a.x509Issuers {
+		for _, crt := range iss.intermediates {
+			if !containsCertificate(certs, crt) {
+				certs = append(certs, crt)
+			}
+		}
+	}
+	return certs
+}
+
+// GetNextIntermediateCertificates returns the intermediate certificates that
+// will replace the current ones after a CA rollover, if configured.
+func (a *Authority) GetNextIntermediateCertificates() []*x509.Certificate {
+	if r := a.getIntermediateRotation(); r != nil && len(a.nextX509Certs) == 0 && !r.isActive(time.Now()) {
+		return r.chain
+	}
+	return a.nextX509Certs
 }
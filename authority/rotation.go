@@ -0,0 +1,485 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"time"
+
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/nosql/database"
+
+	"github.com/smallstep/certificates/authority/admin"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/db"
+)
+
+// Status of the intermediate certificates reported by GetIssuers.
+const (
+	// IssuerStatusActive is the status of the intermediates issuing
+	// certificates.
+	IssuerStatusActive = "active"
+	// IssuerStatusScheduled is the status of the intermediate that will issue
+	// certificates after the rotation time.
+	IssuerStatusScheduled = "scheduled"
+	// IssuerStatusRetired is the status of the intermediate replaced by a
+	// rotation. Certificates issued by it can still be renewed and revoked.
+	IssuerStatusRetired = "retired"
+	// IssuerStatusCrossSigned is the status of the new intermediate
+	// cross-signed by the old one.
+	IssuerStatusCrossSigned = "cross-signed"
+)
+
+// IntermediateRotationRequest is the request used to rotate the intermediate
+// certificate of the default CAS.
+type IntermediateRotationRequest struct {
+	// RootKey is the file or KMS URI of the root key used to sign the new
+	// intermediate. It must be encrypted with the intermediate password.
+	RootKey string
+	// Key is the file or KMS URI where the new intermediate key is created.
+	Key string
+	// CrossSign creates a certificate of the new intermediate signed by the
+	// current one.
+	CrossSign bool
+	// RotateAt is the time when the new intermediate will start issuing
+	// certificates, if not set the rotation is immediate.
+	RotateAt time.Time
+	// NotAfter is the expiration of the new intermediate, if not set it will
+	// have the same validity as the current one.
+	NotAfter time.Time
+	// CreatedBy is the subject of the admin requesting the rotation.
+	CreatedBy string
+}
+
+// IssuerStatus represents the status of an intermediate certificate.
+type IssuerStatus struct {
+	Name         string    `json:"name,omitempty"`
+	Status       string    `json:"status"`
+	Subject      string    `json:"subject"`
+	SerialNumber string    `json:"serialNumber"`
+	Fingerprint  string    `json:"fingerprint"`
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+	RotateAt     time.Time `json:"rotateAt,omitzero"`
+}
+
+// intermediateRotation is the scheduled rotation of the default intermediate.
+type intermediateRotation struct {
+	chain    []*x509.Certificate
+	cross    *x509.Certificate
+	rotateAt time.Time
+}
+
+// isActive returns true if the new intermediate issues certificates.
+func (r *intermediateRotation) isActive(now time.Time) bool {
+	return !now.Before(r.rotateAt)
+}
+
+// RotateIntermediate creates a new intermediate certificate signed by the
+// root, and schedules it to replace the current one in the default CAS. The
+// new intermediate is stored in the database and it is loaded on restarts
+// until the rotation is canceled. The new key has the same type as the key of
+// the current intermediate, and it is deleted if the rotation fails.
+func (a *Authority) RotateIntermediate(_ context.Context, req *IntermediateRotationRequest) (_ []*IssuerStatus, err error) {
+	rdb, rotator, err := a.getIntermediateRotator()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case req.RootKey == "":
+		return nil, admin.NewError(admin.ErrorBadRequestType, "rootKey cannot be empty")
+	case req.Key == "":
+		return nil, admin.NewError(admin.ErrorBadRequestType, "key cannot be empty")
+	case !req.NotAfter.IsZero() && !req.NotAfter.After(now):
+		return nil, admin.NewError(admin.ErrorBadRequestType, "notAfter must be in the future")
+	case !req.NotAfter.IsZero() && !req.RotateAt.IsZero() && !req.NotAfter.After(req.RotateAt):
+		return nil, admin.NewError(admin.ErrorBadRequestType, "notAfter must be after rotateAt")
+	}
+
+	// The lock is not held while using the KMS, the rotation is checked again
+	// before storing it.
+	if a.getIntermediateRotation() != nil {
+		return nil, admin.NewError(admin.ErrorConflictType, "an intermediate rotation already exists")
+	}
+
+	// Do not overwrite existing keys when using files.
+	if _, err := os.Stat(req.Key); err == nil {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "key %s already exists", req.Key)
+	}
+
+	current := a.intermediateX509Certs[0]
+	currentSigner, err := a.x509CAService.(casapi.CertificateAuthoritySigner).GetSigner()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error getting intermediate signer")
+	}
+	signatureAlgorithm, bits, err := intermediateKeyType(current)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error getting intermediate key type")
+	}
+
+	rootSigner, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: req.RootKey,
+		Password:   a.password,
+	})
+	if err != nil {
+		return nil, admin.WrapError(admin.ErrorBadRequestType, err, "error loading root key")
+	}
+	root := a.getRootForSigner(rootSigner)
+	if root == nil {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "root key does not match any root certificate")
+	}
+
+	key, err := a.keyManager.CreateKey(&kmsapi.CreateKeyRequest{
+		Name:               req.Key,
+		SignatureAlgorithm: signatureAlgorithm,
+		Bits:               bits,
+	})
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error creating intermediate key")
+	}
+	defer func() {
+		if err != nil {
+			a.deleteIntermediateKey(key)
+		}
+	}()
+
+	// Only softkms returns the private key, it needs to be stored in a file.
+	if key.PrivateKey != nil {
+		opts := []pemutil.Options{pemutil.ToFile(key.Name, 0600)}
+		if len(a.password) > 0 {
+			opts = append(opts, pemutil.WithPassword(a.password))
+		}
+		if _, err := pemutil.Serialize(key.PrivateKey, opts...); err != nil {
+			return nil, admin.WrapErrorISE(err, "error writing intermediate key")
+		}
+	}
+	signer, err := a.keyManager.CreateSigner(&key.CreateSignerRequest)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error creating intermediate signer")
+	}
+
+	notAfter := req.NotAfter
+	if notAfter.IsZero() {
+		notAfter = now.Add(current.NotAfter.Sub(current.NotBefore))
+	}
+	crt, err := x509util.CreateCertificate(newIntermediateTemplate(current, now, notAfter), root, signer.Public(), rootSigner)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error signing intermediate certificate")
+	}
+
+	r := &db.IntermediateRotation{
+		Certificate: crt.Raw,
+		Key:         key.Name,
+		RotateAt:    req.RotateAt.UTC(),
+		CreatedBy:   req.CreatedBy,
+		CreatedAt:   now,
+	}
+	if r.RotateAt.IsZero() {
+		r.RotateAt = now
+	}
+
+	// The cross-signed certificate cannot outlive the current intermediate.
+	if req.CrossSign {
+		if current.NotAfter.Before(notAfter) {
+			notAfter = current.NotAfter
+		}
+		cross, err := x509util.CreateCertificate(newIntermediateTemplate(current, now, notAfter), current, signer.Public(), currentSigner)
+		if err != nil {
+			return nil, admin.WrapErrorISE(err, "error cross-signing intermediate certificate")
+		}
+		r.CrossCertificate = cross.Raw
+	}
+
+	a.x509RotationMutex.Lock()
+	defer a.x509RotationMutex.Unlock()
+	if a.x509Rotation != nil {
+		return nil, admin.NewError(admin.ErrorConflictType, "an intermediate rotation already exists")
+	}
+	if err := rdb.CreateIntermediateRotation(r); err != nil {
+		if errors.Is(err, db.ErrAlreadyExists) {
+			return nil, admin.NewError(admin.ErrorConflictType, "an intermediate rotation already exists")
+		}
+		return nil, admin.WrapErrorISE(err, "error storing intermediate rotation")
+	}
+	if err := a.setIntermediateRotation(rotator, r, signer); err != nil {
+		if delErr := rdb.DeleteIntermediateRotation(); delErr != nil {
+			log.Printf("error deleting intermediate rotation: %v", delErr)
+		}
+		return nil, admin.WrapErrorISE(err, "error scheduling intermediate rotation")
+	}
+
+	return a.getIssuers(now), nil
+}
+
+// deleteIntermediateKey deletes the key created by a failed rotation. Keys
+// stored in files are removed, other keys are deleted only if the KMS
+// supports it.
+func (a *Authority) deleteIntermediateKey(key *kmsapi.CreateKeyResponse) {
+	var err error
+	if key.PrivateKey != nil {
+		if err = os.Remove(key.Name); errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+	} else if kd, ok := a.keyManager.(kmsapi.KeyDeleter); ok {
+		err = kd.DeleteKey(&kmsapi.DeleteKeyRequest{Name: key.Name})
+	}
+	if err != nil {
+		log.Printf("error deleting intermediate key %s: %v", key.Name, err)
+	}
+}
+
+// intermediateKeyType returns the signature algorithm and the size of the key
+// of the given intermediate.
+func intermediateKeyType(crt *x509.Certificate) (kmsapi.SignatureAlgorithm, int, error) {
+	switch pub := crt.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return kmsapi.ECDSAWithSHA256, 0, nil
+		case elliptic.P384():
+			return kmsapi.ECDSAWithSHA384, 0, nil
+		case elliptic.P521():
+			return kmsapi.ECDSAWithSHA512, 0, nil
+		}
+	case *rsa.PublicKey:
+		return kmsapi.SHA256WithRSA, pub.N.BitLen(), nil
+	case ed25519.PublicKey:
+		return kmsapi.PureEd25519, 0, nil
+	}
+	return 0, 0, errors.New("unsupported intermediate key type")
+}
+
+// CancelIntermediateRotation removes the rotation of the intermediate. If the
+// rotation time has already passed, the intermediate configured in the crt
+// and key properties will issue certificates again.
+func (a *Authority) CancelIntermediateRotation(context.Context) error {
+	rdb, rotator, err := a.getIntermediateRotator()
+	if err != nil {
+		return err
+	}
+
+	a.x509RotationMutex.Lock()
+	defer a.x509RotationMutex.Unlock()
+	if a.x509Rotation == nil {
+		return admin.NewError(admin.ErrorNotFoundType, "intermediate rotation not found")
+	}
+	if err := rotator.RotateCertificateAuthority(&casapi.RotateCertificateAuthorityRequest{}); err != nil {
+		return admin.WrapErrorISE(err, "error canceling intermediate rotation")
+	}
+	if err := rdb.DeleteIntermediateRotation(); err != nil {
+		return admin.WrapErrorISE(err, "error deleting intermediate rotation")
+	}
+	a.x509Rotation = nil
+	return nil
+}
+
+// GetIssuers returns the status of the intermediate certificates of the
+// default and named CAS.
+func (a *Authority) GetIssuers(context.Context) []*IssuerStatus {
+	a.x509RotationMutex.RLock()
+	defer a.x509RotationMutex.RUnlock()
+	return a.getIssuers(time.Now())
+}
+
+func (a *Authority) getIssuers(now time.Time) []*IssuerStatus {
+	var issuers []*IssuerStatus
+	if len(a.intermediateX509Certs) > 0 {
+		status := IssuerStatusActive
+		if r := a.x509Rotation; r != nil && r.isActive(now) {
+			status = IssuerStatusRetired
+		}
+		issuers = append(issuers, newIssuerStatus("", status, a.intermediateX509Certs[0], time.Time{}))
+	}
+	if r := a.x509Rotation; r != nil {
+		status := IssuerStatusScheduled
+		if r.isActive(now) {
+			status = IssuerStatusActive
+		}
+		issuers = append(issuers, newIssuerStatus("", status, r.chain[0], r.rotateAt))
+		if r.cross != nil {
+			issuers = append(issuers, newIssuerStatus("", IssuerStatusCrossSigned, r.cross, r.rotateAt))
+		}
+	}
+	for _, iss := range a.x509Issuers {
+		if len(iss.intermediates) > 0 {
+			issuers = append(issuers, newIssuerStatus(iss.name, IssuerStatusActive, iss.intermediates[0], time.Time{}))
+		}
+	}
+	return issuers
+}
+
+// initIntermediateRotation loads the intermediate rotation from the database
+// and schedules it in the default CAS.
+func (a *Authority) initIntermediateRotation() error {
+	rdb, ok := a.db.(db.IntermediateRotationDB)
+	if !ok {
+		return nil
+	}
+	r, err := rdb.GetIntermediateRotation()
+	switch {
+	case database.IsErrNotFound(err):
+		return nil
+	case err != nil:
+		return err
+	}
+
+	rotator, ok := a.x509CAService.(casapi.CertificateAuthorityRotator)
+	if !ok {
+		log.Println("intermediate rotation ignored: the certificate authority service does not support it")
+		return nil
+	}
+
+	// Skip the rotation if the new intermediate is already configured.
+	if len(a.intermediateX509Certs) > 0 && bytes.Equal(a.intermediateX509Certs[0].Raw, r.Certificate) {
+		log.Println("intermediate rotation ignored: the new intermediate is already configured")
+		return nil
+	}
+
+	signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: r.Key,
+		Password:   a.password,
+	})
+	if err != nil {
+		return err
+	}
+
+	a.x509RotationMutex.Lock()
+	defer a.x509RotationMutex.Unlock()
+	return a.setIntermediateRotation(rotator, r, signer)
+}
+
+// setIntermediateRotation schedules the given rotation in the CAS. It must be
+// called with the rotation lock held.
+func (a *Authority) setIntermediateRotation(rotator casapi.CertificateAuthorityRotator, r *db.IntermediateRotation, signer crypto.Signer) error {
+	crt, err := x509.ParseCertificate(r.Certificate)
+	if err != nil {
+		return err
+	}
+	rotation := &intermediateRotation{
+		rotateAt: r.RotateAt,
+	}
+	// The new intermediate is signed by the same root, so the rest of the
+	// chain does not change.
+	rotation.chain = append(rotation.chain, crt)
+	if len(a.intermediateX509Certs) > 1 {
+		rotation.chain = append(rotation.chain, a.intermediateX509Certs[1:]...)
+	}
+	if len(r.CrossCertificate) > 0 {
+		if rotation.cross, err = x509.ParseCertificate(r.CrossCertificate); err != nil {
+			return err
+		}
+	}
+
+	if err := rotator.RotateCertificateAuthority(&casapi.RotateCertificateAuthorityRequest{
+		CertificateChain: rotation.chain,
+		Signer:           signer,
+		RotateAt:         r.RotateAt,
+	}); err != nil {
+		return err
+	}
+	a.x509Rotation = rotation
+	return nil
+}
+
+// getRetiredIntermediate returns the intermediate replaced by an active
+// rotation, or nil if there is none or it has expired.
+func (a *Authority) getRetiredIntermediate(now time.Time) *x509.Certificate {
+	r := a.getIntermediateRotation()
+	if r == nil || !r.isActive(now) || len(a.intermediateX509Certs) == 0 {
+		return nil
+	}
+	if crt := a.intermediateX509Certs[0]; now.Before(crt.NotAfter) {
+		return crt
+	}
+	return nil
+}
+
+// getIntermediateRotation returns the intermediate rotation if one exists.
+func (a *Authority) getIntermediateRotation() *intermediateRotation {
+	a.x509RotationMutex.RLock()
+	defer a.x509RotationMutex.RUnlock()
+	return a.x509Rotation
+}
+
+func (a *Authority) getIntermediateRotator() (db.IntermediateRotationDB, casapi.CertificateAuthorityRotator, error) {
+	rdb, ok := a.db.(db.IntermediateRotationDB)
+	if !ok {
+		return nil, nil, admin.NewError(admin.ErrorNotImplementedType, "intermediate rotation is not supported by the database")
+	}
+	rotator, ok := a.x509CAService.(casapi.CertificateAuthorityRotator)
+	if !ok || len(a.intermediateX509Certs) == 0 {
+		return nil, nil, admin.NewError(admin.ErrorNotImplementedType, "intermediate rotation is not supported by the certificate authority service")
+	}
+	if _, ok := a.x509CAService.(casapi.CertificateAuthoritySigner); !ok {
+		return nil, nil, admin.NewError(admin.ErrorNotImplementedType, "intermediate rotation is not supported by the certificate authority service")
+	}
+	return rdb, rotator, nil
+}
+
+// getRootForSigner returns the root certificate with the public key of the
+// given signer.
+func (a *Authority) getRootForSigner(signer crypto.Signer) *x509.Certificate {
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return nil
+	}
+	for _, root := range a.rootX509Certs {
+		if pub.Equal(root.PublicKey) {
+			return root
+		}
+	}
+	return nil
+}
+
+// newIntermediateTemplate returns the template of an intermediate with the
+// same subject and constraints as the given one.
+func newIntermediateTemplate(crt *x509.Certificate, notBefore, notAfter time.Time) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:                     crt.Subject,
+		NotBefore:                   notBefore,
+		NotAfter:                    notAfter,
+		KeyUsage:                    crt.KeyUsage,
+		ExtKeyUsage:                 crt.ExtKeyUsage,
+		UnknownExtKeyUsage:          crt.UnknownExtKeyUsage,
+		BasicConstraintsValid:       true,
+		IsCA:                        true,
+		MaxPathLen:                  crt.MaxPathLen,
+		MaxPathLenZero:              crt.MaxPathLenZero,
+		PermittedDNSDomainsCritical: crt.PermittedDNSDomainsCritical,
+		PermittedDNSDomains:         crt.PermittedDNSDomains,
+		ExcludedDNSDomains:          crt.ExcludedDNSDomains,
+		PermittedIPRanges:           crt.PermittedIPRanges,
+		ExcludedIPRanges:            crt.ExcludedIPRanges,
+		PermittedEmailAddresses:     crt.PermittedEmailAddresses,
+		ExcludedEmailAddresses:      crt.ExcludedEmailAddresses,
+		PermittedURIDomains:         crt.PermittedURIDomains,
+		ExcludedURIDomains:          crt.ExcludedURIDomains,
+	}
+}
+
+func newIssuerStatus(name, status string, crt *x509.Certificate, rotateAt time.Time) *IssuerStatus {
+	return &IssuerStatus{
+		Name:         name,
+		Status:       status,
+		Subject:      crt.Subject.String(),
+		SerialNumber: crt.SerialNumber.String(),
+		Fingerprint:  x509util.Fingerprint(crt),
+		NotBefore:    crt.NotBefore,
+		NotAfter:     crt.NotAfter,
+		RotateAt:     rotateAt,
+	}
+}
@@ -0,0 +1,341 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/keyutil"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/nosql/database"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/db"
+)
+
+type mockIntermediateRotationDB struct {
+	db.MockAuthDB
+	rotation  *db.IntermediateRotation
+	createErr error
+}
+
+func (m *mockIntermediateRotationDB) GetIntermediateRotation() (*db.IntermediateRotation, error) {
+	if m.rotation == nil {
+		return nil, database.ErrNotFound
+	}
+	return m.rotation, nil
+}
+
+func (m *mockIntermediateRotationDB) CreateIntermediateRotation(r *db.IntermediateRotation) error {
+	if m.createErr != nil {
+		return m.createErr
+	}
+	if m.rotation != nil {
+		return db.ErrAlreadyExists
+	}
+	m.rotation = r
+	return nil
+}
+
+func (m *mockIntermediateRotationDB) DeleteIntermediateRotation() error {
+	m.rotation = nil
+	return nil
+}
+
+type mockRotationCRLDB struct {
+	*mockIntermediateRotationDB
+	crls map[string]*db.CertificateRevocationListInfo
+}
+
+func (m *mockRotationCRLDB) GetIssuerCRL(issuer string) (*db.CertificateRevocationListInfo, error) {
+	if crl, ok := m.crls[issuer]; ok {
+		return crl, nil
+	}
+	return nil, database.ErrNotFound
+}
+
+func (m *mockRotationCRLDB) StoreIssuerCRL(issuer string, crl *db.CertificateRevocationListInfo) error {
+	m.crls[issuer] = crl
+	return nil
+}
+
+// withTestIntermediate configures the authority with the root and
+// intermediate of the given CA, it returns the path of the root key.
+func withTestIntermediate(t *testing.T, ca *minica.CA, dir string) (Option, string) {
+	t.Helper()
+	rootPath := filepath.Join(dir, "root_ca.crt")
+	rootKeyPath := filepath.Join(dir, "root_ca_key")
+	crtPath := filepath.Join(dir, "intermediate_ca.crt")
+	keyPath := filepath.Join(dir, "intermediate_ca_key")
+	require.NoError(t, os.WriteFile(rootPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw}), 0600))
+	require.NoError(t, os.WriteFile(crtPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw}), 0600))
+	_, err := pemutil.Serialize(ca.RootSigner, pemutil.WithPassword([]byte("pass")), pemutil.ToFile(rootKeyPath, 0600))
+	require.NoError(t, err)
+	_, err = pemutil.Serialize(ca.Signer, pemutil.WithPassword([]byte("pass")), pemutil.ToFile(keyPath, 0600))
+	require.NoError(t, err)
+
+	return func(a *Authority) error {
+		a.config.Root = []string{rootPath}
+		a.config.IntermediateCert = crtPath
+		a.config.IntermediateKey = keyPath
+		return nil
+	}, rootKeyPath
+}
+
+func assertIntermediateSigner(t *testing.T, a *Authority, want crypto.Signer) {
+	t.Helper()
+	signer, err := a.x509CAService.(casapi.CertificateAuthoritySigner).GetSigner()
+	require.NoError(t, err)
+	assert.Equal(t, want.Public(), signer.Public())
+}
+
+func TestAuthority_RotateIntermediate(t *testing.T) {
+	ctx := context.Background()
+	ca, err := minica.New(minica.WithName("Rotation"))
+	require.NoError(t, err)
+	dir := t.TempDir()
+	rdb := &mockIntermediateRotationDB{}
+	opt, rootKey := withTestIntermediate(t, ca, dir)
+	a := testAuthority(t, WithDatabase(rdb), opt)
+	current := a.GetIntermediateCertificate()
+	require.Equal(t, ca.Intermediate, current)
+
+	// Fail with bad requests.
+	var adminErr *admin.Error
+	_, err = a.RotateIntermediate(ctx, &IntermediateRotationRequest{Key: filepath.Join(dir, "next_key")})
+	require.ErrorAs(t, err, &adminErr)
+	assert.Equal(t, admin.ErrorBadRequestType.String(), adminErr.Type)
+	_, err = a.RotateIntermediate(ctx, &IntermediateRotationRequest{RootKey: rootKey, Key: a.config.IntermediateKey})
+	require.ErrorAs(t, err, &adminErr)
+	assert.Equal(t, admin.ErrorBadRequestType.String(), adminErr.Type)
+	_, err = a.RotateIntermediate(ctx, &IntermediateRotationRequest{RootKey: a.config.IntermediateKey, Key: filepath.Join(dir, "next_key")})
+	require.ErrorAs(t, err, &adminErr)
+	assert.Equal(t, admin.ErrorBadRequestType.String(), adminErr.Type)
+
+	// Schedule a rotation with a cross-signed intermediate.
+	rotateAt := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+	issuers, err := a.RotateIntermediate(ctx, &IntermediateRotationRequest{
+		RootKey:   rootKey,
+		Key:       filepath.Join(dir, "next_key"),
+		CrossSign: true,
+		RotateAt:  rotateAt,
+		CreatedBy: "admin@example.com",
+	})
+	require.NoError(t, err)
+	require.Len(t, issuers, 3)
+	assert.Equal(t, IssuerStatusActive, issuers[0].Status)
+	assert.Equal(t, IssuerStatusScheduled, issuers[1].Status)
+	assert.Equal(t, rotateAt, issuers[1].RotateAt)
+	assert.Equal(t, IssuerStatusCrossSigned, issuers[2].Status)
+	require.NotNil(t, rdb.rotation)
+	assert.Equal(t, "admin@example.com", rdb.rotation.CreatedBy)
+
+	next, err := x509.ParseCertificate(rdb.rotation.Certificate)
+	require.NoError(t, err)
+	cross, err := x509.ParseCertificate(rdb.rotation.CrossCertificate)
+	require.NoError(t, err)
+	require.NoError(t, next.CheckSignatureFrom(ca.Root))
+	require.NoError(t, cross.CheckSignatureFrom(current))
+	assert.Equal(t, current.Subject, next.Subject)
+	assert.Equal(t, next.PublicKey, cross.PublicKey)
+	assert.False(t, cross.NotAfter.After(current.NotAfter))
+
+	// The new key is encrypted with the intermediate password.
+	nextKey, err := pemutil.Read(filepath.Join(dir, "next_key"), pemutil.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+	assert.Equal(t, next.PublicKey, nextKey.(crypto.Signer).Public())
+
+	// Both chains are served, the current intermediate is still used.
+	assert.Equal(t, []*x509.Certificate{current, next, cross}, a.GetIntermediateCertificates())
+	assert.Equal(t, []*x509.Certificate{next}, a.GetNextIntermediateCertificates())
+	assert.Equal(t, current, a.GetIntermediateCertificate())
+	assertIntermediateSigner(t, a, ca.Signer)
+
+	// Certificates issued by the new intermediate use the default CAS.
+	name, _ := a.getX509CAService(newTestIssuedCert(next, 1), nil)
+	assert.Empty(t, name)
+
+	// Only one rotation is allowed.
+	_, err = a.RotateIntermediate(ctx, &IntermediateRotationRequest{RootKey: rootKey, Key: filepath.Join(dir, "other_key")})
+	require.ErrorAs(t, err, &adminErr)
+	assert.Equal(t, admin.ErrorConflictType.String(), adminErr.Type)
+
+	// Cancel the rotation.
+	require.NoError(t, a.CancelIntermediateRotation(ctx))
+	assert.Nil(t, rdb.rotation)
+	assert.Equal(t, []*x509.Certificate{current}, a.GetIntermediateCertificates())
+	err = a.CancelIntermediateRotation(ctx)
+	require.ErrorAs(t, err, &adminErr)
+	assert.Equal(t, admin.ErrorNotFoundType.String(), adminErr.Type)
+
+	// The new key is deleted if the rotation fails.
+	rdb.createErr = errors.New("force")
+	_, err = a.RotateIntermediate(ctx, &IntermediateRotationRequest{
+		RootKey: rootKey,
+		Key:     filepath.Join(dir, "failed_key"),
+	})
+	require.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, "failed_key"))
+	assert.Nil(t, rdb.rotation)
+	rdb.createErr = nil
+
+	// Rotate immediately.
+	issuers, err = a.RotateIntermediate(ctx, &IntermediateRotationRequest{
+		RootKey: rootKey,
+		Key:     filepath.Join(dir, "other_key"),
+	})
+	require.NoError(t, err)
+	require.Len(t, issuers, 2)
+	assert.Equal(t, IssuerStatusRetired, issuers[0].Status)
+	assert.Equal(t, IssuerStatusActive, issuers[1].Status)
+
+	next, err = x509.ParseCertificate(rdb.rotation.Certificate)
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{next, current}, a.GetIntermediateCertificates())
+	assert.Empty(t, a.GetNextIntermediateCertificates())
+	assert.Equal(t, next, a.GetIntermediateCertificate())
+	nextKey, err = pemutil.Read(filepath.Join(dir, "other_key"), pemutil.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+	assertIntermediateSigner(t, a, nextKey.(crypto.Signer))
+
+	// The rotation is resumed on restarts.
+	a = testAuthority(t, WithDatabase(rdb), opt)
+	assert.Equal(t, next, a.GetIntermediateCertificate())
+	assertIntermediateSigner(t, a, nextKey.(crypto.Signer))
+	assert.Len(t, a.GetIssuers(ctx), 2)
+}
+
+func TestAuthority_RotateIntermediate_CRL(t *testing.T) {
+	ctx := context.Background()
+	ca, err := minica.New(minica.WithName("Rotation"))
+	require.NoError(t, err)
+
+	var revokedList []db.RevokedCertificateInfo
+	var crlStore *db.CertificateRevocationListInfo
+	rdb := &mockIntermediateRotationDB{
+		MockAuthDB: db.MockAuthDB{
+			MGetCertificate: func(sn string) (*x509.Certificate, error) {
+				return nil, database.ErrNotFound
+			},
+			MRevoke: func(rci *db.RevokedCertificateInfo) error {
+				revokedList = append(revokedList, *rci)
+				return nil
+			},
+			MGetRevokedCertificates: func() (*[]db.RevokedCertificateInfo, error) {
+				return &revokedList, nil
+			},
+			MStoreCRL: func(crl *db.CertificateRevocationListInfo) error {
+				crlStore = crl
+				return nil
+			},
+			MGetCRL: func() (*db.CertificateRevocationListInfo, error) {
+				if crlStore == nil {
+					return nil, database.ErrNotFound
+				}
+				return crlStore, nil
+			},
+		},
+	}
+	cdb := &mockRotationCRLDB{
+		mockIntermediateRotationDB: rdb,
+		crls:                       map[string]*db.CertificateRevocationListInfo{},
+	}
+	dir := t.TempDir()
+	opt, rootKey := withTestIntermediate(t, ca, dir)
+	a := testAuthority(t, WithDatabase(cdb), opt)
+	a.config.CRL = &config.CRLConfig{Enabled: true}
+	current := a.GetIntermediateCertificate()
+	retiredName := x509util.Fingerprint(current)
+
+	revokeCtx := provisioner.NewContextWithMethod(ctx, provisioner.RevokeMethod)
+	crt := newTestIssuedCert(current, 1)
+	require.NoError(t, a.Revoke(revokeCtx, &RevokeOptions{
+		Serial: crt.SerialNumber.String(),
+		Crt:    crt,
+		MTLS:   true,
+	}))
+
+	// Without a rotation there is no retired intermediate.
+	require.NoError(t, a.GenerateCertificateRevocationList())
+	assert.Empty(t, cdb.crls)
+	_, err = a.GetIssuerCertificateRevocationList(retiredName)
+	assert.Error(t, err)
+
+	_, err = a.RotateIntermediate(ctx, &IntermediateRotationRequest{
+		RootKey: rootKey,
+		Key:     filepath.Join(dir, "next_key"),
+	})
+	require.NoError(t, err)
+	next := a.GetIntermediateCertificate()
+	require.NoError(t, a.GenerateCertificateRevocationList())
+
+	// The default CRL is signed by the new intermediate.
+	info, err := a.GetCertificateRevocationList()
+	require.NoError(t, err)
+	crl, err := x509.ParseRevocationList(info.Data)
+	require.NoError(t, err)
+	require.NoError(t, crl.CheckSignatureFrom(next))
+
+	// The CRL of the retired intermediate is signed by its own key.
+	info, err = a.GetIssuerCertificateRevocationList(retiredName)
+	require.NoError(t, err)
+	crl, err = x509.ParseRevocationList(info.Data)
+	require.NoError(t, err)
+	require.NoError(t, crl.CheckSignatureFrom(current))
+	if assert.Len(t, crl.RevokedCertificateEntries, 1) {
+		assert.Equal(t, big.NewInt(1), crl.RevokedCertificateEntries[0].SerialNumber)
+	}
+}
+
+func Test_intermediateKeyType(t *testing.T) {
+	newCert := func(t *testing.T, kty, crv string, size int) *x509.Certificate {
+		t.Helper()
+		signer, err := keyutil.GenerateSigner(kty, crv, size)
+		require.NoError(t, err)
+		return &x509.Certificate{PublicKey: signer.Public()}
+	}
+
+	tests := []struct {
+		name     string
+		crt      *x509.Certificate
+		want     kmsapi.SignatureAlgorithm
+		wantBits int
+		wantErr  bool
+	}{
+		{"P-256", newCert(t, "EC", "P-256", 0), kmsapi.ECDSAWithSHA256, 0, false},
+		{"P-384", newCert(t, "EC", "P-384", 0), kmsapi.ECDSAWithSHA384, 0, false},
+		{"P-521", newCert(t, "EC", "P-521", 0), kmsapi.ECDSAWithSHA512, 0, false},
+		{"RSA", newCert(t, "RSA", "", 3072), kmsapi.SHA256WithRSA, 3072, false},
+		{"Ed25519", newCert(t, "OKP", "Ed25519", 0), kmsapi.PureEd25519, 0, false},
+		{"fail", &x509.Certificate{PublicKey: "foo"}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, bits, err := intermediateKeyType(tt.crt)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantBits, bits)
+		})
+	}
+}
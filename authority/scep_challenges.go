@@ -0,0 +1,205 @@
+package authority
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"go.step.sm/crypto/randutil"
+
+	"github.com/smallstep/nosql/database"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+// scepChallengeLength is the number of characters in a one-time SCEP
+// challenge. Challenges are alphanumeric to be valid PrintableStrings.
+const scepChallengeLength = 32
+
+// CreateSCEPChallenge mints a one-time challenge for the given SCEP
+// provisioner. The challenge can be bound to the subject and SANs and the
+// expiration time in the given template. It returns the challenge password,
+// which is not stored, and the stored challenge.
+func (a *Authority) CreateSCEPChallenge(_ context.Context, provisionerName string, ch *db.SCEPChallenge) (string, *db.SCEPChallenge, error) {
+	cdb, err := a.getSCEPChallengeDB(provisionerName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now().UTC()
+	if !ch.ExpiresAt.IsZero() && !ch.ExpiresAt.After(now) {
+		return "", nil, admin.NewError(admin.ErrorBadRequestType, "scep challenge expiration must be in the future")
+	}
+	if slices.Contains(ch.SANs, "") {
+		return "", nil, admin.NewError(admin.ErrorBadRequestType, "scep challenge sans cannot contain empty values")
+	}
+
+	challenge, err := randutil.Alphanumeric(scepChallengeLength)
+	if err != nil {
+		return "", nil, admin.WrapErrorISE(err, "error generating scep challenge")
+	}
+
+	ch.ID = scepChallengeID(challenge)
+	ch.Provisioner = provisionerName
+	ch.CreatedAt = now
+	ch.UsedAt = time.Time{}
+	if !ch.ExpiresAt.IsZero() {
+		ch.ExpiresAt = ch.ExpiresAt.UTC()
+	}
+	if err := cdb.CreateSCEPChallenge(ch); err != nil {
+		return "", nil, admin.WrapErrorISE(err, "error storing scep challenge")
+	}
+	return challenge, ch, nil
+}
+
+// GetSCEPChallenges returns the outstanding one-time challenges of the given
+// SCEP provisioner, the ones not used and not expired, sorted by creation
+// time.
+func (a *Authority) GetSCEPChallenges(_ context.Context, provisionerName string) ([]*db.SCEPChallenge, error) {
+	cdb, err := a.getSCEPChallengeDB(provisionerName)
+	if err != nil {
+		return nil, err
+	}
+	chs, err := cdb.GetSCEPChallenges()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading scep challenges")
+	}
+
+	now := time.Now()
+	outstanding := []*db.SCEPChallenge{}
+	for _, ch := range chs {
+		if ch.Provisioner == provisionerName && ch.UsedAt.IsZero() && !isSCEPChallengeExpired(ch, now) {
+			outstanding = append(outstanding, ch)
+		}
+	}
+	slices.SortFunc(outstanding, func(a, b *db.SCEPChallenge) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return outstanding, nil
+}
+
+// RevokeSCEPChallenge deletes a one-time challenge of the given SCEP
+// provisioner, so it cannot be used anymore.
+func (a *Authority) RevokeSCEPChallenge(_ context.Context, provisionerName, id string) error {
+	cdb, err := a.getSCEPChallengeDB(provisionerName)
+	if err != nil {
+		return err
+	}
+	ch, err := cdb.GetSCEPChallenge(id)
+	switch {
+	case database.IsErrNotFound(err):
+		return admin.NewError(admin.ErrorNotFoundType, "scep challenge %s not found", id)
+	case err != nil:
+		return admin.WrapErrorISE(err, "error loading scep challenge %s", id)
+	case ch.Provisioner != provisionerName:
+		return admin.NewError(admin.ErrorNotFoundType, "scep challenge %s not found", id)
+	}
+	if err := cdb.DeleteSCEPChallenge(id); err != nil {
+		return admin.WrapErrorISE(err, "error deleting scep challenge %s", id)
+	}
+	return nil
+}
+
+// validateSCEPChallenge implements provisioner.ValidateSCEPChallengeFunc. It
+// consumes the one-time challenge if it belongs to the provisioner, and the
+// certificate request matches the subject and SANs bound to it.
+func (a *Authority) validateSCEPChallenge(_ context.Context, p provisioner.Interface, csr *x509.CertificateRequest, challenge string) (bool, error) {
+	cdb, ok := a.db.(db.SCEPChallengeDB)
+	if !ok {
+		return false, nil
+	}
+
+	id := scepChallengeID(challenge)
+	ch, err := cdb.GetSCEPChallenge(id)
+	switch {
+	case database.IsErrNotFound(err):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("error loading scep challenge: %w", err)
+	case ch.Provisioner != p.GetName():
+		return false, nil
+	case !ch.UsedAt.IsZero():
+		return false, errors.New("scep challenge has already been used")
+	case isSCEPChallengeExpired(ch, time.Now()):
+		return false, errors.New("scep challenge has expired")
+	}
+	if err := validateSCEPChallengeBinding(ch, csr); err != nil {
+		return false, err
+	}
+
+	if _, err := cdb.UseSCEPChallenge(id, time.Now().UTC()); err != nil {
+		if errors.Is(err, db.ErrSCEPChallengeUsed) {
+			return false, errors.New("scep challenge has already been used")
+		}
+		return false, fmt.Errorf("error consuming scep challenge: %w", err)
+	}
+	// The challenge cannot be used anymore, failing to delete it only leaves
+	// a used record behind.
+	if err := cdb.DeleteSCEPChallenge(id); err != nil {
+		log.Printf("error deleting used scep challenge %s: %v\n", id, err)
+	}
+	return true, nil
+}
+
+// validateSCEPChallengeBinding checks that the certificate request has the
+// subject bound to the challenge, and that it only contains SANs bound to it.
+func validateSCEPChallengeBinding(ch *db.SCEPChallenge, csr *x509.CertificateRequest) error {
+	if ch.Subject != "" && csr.Subject.CommonName != ch.Subject {
+		return fmt.Errorf("scep challenge is not valid for subject %q", csr.Subject.CommonName)
+	}
+	if len(ch.SANs) == 0 {
+		return nil
+	}
+
+	sans := slices.Clone(csr.DNSNames)
+	sans = append(sans, csr.EmailAddresses...)
+	for _, ip := range csr.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, u := range csr.URIs {
+		sans = append(sans, u.String())
+	}
+	for _, san := range sans {
+		if !slices.ContainsFunc(ch.SANs, func(s string) bool {
+			return strings.EqualFold(s, san)
+		}) {
+			return fmt.Errorf("scep challenge is not valid for san %q", san)
+		}
+	}
+	return nil
+}
+
+func (a *Authority) getSCEPChallengeDB(provisionerName string) (db.SCEPChallengeDB, error) {
+	p, err := a.LoadProvisionerByName(provisionerName)
+	if err != nil {
+		return nil, admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found", provisionerName)
+	}
+	if p.GetType() != provisioner.TypeSCEP {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "provisioner %s is not a SCEP provisioner", provisionerName)
+	}
+	cdb, ok := a.db.(db.SCEPChallengeDB)
+	if !ok {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "scep challenges are not supported by the database")
+	}
+	return cdb, nil
+}
+
+// scepChallengeID returns the id of a one-time SCEP challenge, the
+// hex-encoded SHA-256 hash of the challenge password.
+func scepChallengeID(challenge string) string {
+	sum := sha256.Sum256([]byte(challenge))
+	return hex.EncodeToString(sum[:])
+}
+
+func isSCEPChallengeExpired(ch *db.SCEPChallenge, now time.Time) bool {
+	return !ch.ExpiresAt.IsZero() && now.After(ch.ExpiresAt)
+}
@@ -0,0 +1,201 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/nosql/database"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+type mockSCEPChallengeDB struct {
+	db.MockAuthDB
+	chs map[string]*db.SCEPChallenge
+}
+
+func (m *mockSCEPChallengeDB) GetSCEPChallenge(id string) (*db.SCEPChallenge, error) {
+	if ch, ok := m.chs[id]; ok {
+		cp := *ch
+		return &cp, nil
+	}
+	return nil, database.ErrNotFound
+}
+
+func (m *mockSCEPChallengeDB) GetSCEPChallenges() ([]*db.SCEPChallenge, error) {
+	var chs []*db.SCEPChallenge
+	for _, ch := range m.chs {
+		cp := *ch
+		chs = append(chs, &cp)
+	}
+	return chs, nil
+}
+
+func (m *mockSCEPChallengeDB) CreateSCEPChallenge(ch *db.SCEPChallenge) error {
+	if _, ok := m.chs[ch.ID]; ok {
+		return db.ErrAlreadyExists
+	}
+	cp := *ch
+	m.chs[ch.ID] = &cp
+	return nil
+}
+
+func (m *mockSCEPChallengeDB) UseSCEPChallenge(id string, usedAt time.Time) (*db.SCEPChallenge, error) {
+	ch, ok := m.chs[id]
+	switch {
+	case !ok:
+		return nil, database.ErrNotFound
+	case !ch.UsedAt.IsZero():
+		return nil, db.ErrSCEPChallengeUsed
+	}
+	ch.UsedAt = usedAt
+	cp := *ch
+	return &cp, nil
+}
+
+func (m *mockSCEPChallengeDB) DeleteSCEPChallenge(id string) error {
+	delete(m.chs, id)
+	return nil
+}
+
+func newSCEPChallengeTestAuthority(t *testing.T) (*Authority, *provisioner.SCEP, *mockSCEPChallengeDB) {
+	t.Helper()
+	cdb := &mockSCEPChallengeDB{chs: map[string]*db.SCEPChallenge{}}
+	a := testAuthority(t, WithDatabase(cdb))
+	cfg, err := a.generateProvisionerConfig(context.Background())
+	require.NoError(t, err)
+	p := &provisioner.SCEP{Name: "scep", Type: "SCEP", ChallengePassword: "static"}
+	require.NoError(t, p.Init(cfg))
+	require.NoError(t, a.provisioners.Store(p))
+	return a, p, cdb
+}
+
+func TestAuthority_SCEPChallenges(t *testing.T) {
+	ctx := context.Background()
+	a, p, cdb := newSCEPChallengeTestAuthority(t)
+	csr := &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: "device-1"},
+		DNSNames:    []string{"device-1.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+	}
+
+	// Fail on non SCEP or unknown provisioners.
+	_, _, err := a.CreateSCEPChallenge(ctx, "Max", &db.SCEPChallenge{})
+	var adminErr *admin.Error
+	require.ErrorAs(t, err, &adminErr)
+	assert.Equal(t, admin.ErrorBadRequestType.String(), adminErr.Type)
+	_, err = a.GetSCEPChallenges(ctx, "missing")
+	require.ErrorAs(t, err, &adminErr)
+	assert.Equal(t, admin.ErrorNotFoundType.String(), adminErr.Type)
+
+	// Fail with bad templates.
+	_, _, err = a.CreateSCEPChallenge(ctx, "scep", &db.SCEPChallenge{ExpiresAt: time.Now().Add(-time.Minute)})
+	require.ErrorAs(t, err, &adminErr)
+	assert.Equal(t, admin.ErrorBadRequestType.String(), adminErr.Type)
+	_, _, err = a.CreateSCEPChallenge(ctx, "scep", &db.SCEPChallenge{SANs: []string{""}})
+	require.ErrorAs(t, err, &adminErr)
+	assert.Equal(t, admin.ErrorBadRequestType.String(), adminErr.Type)
+
+	// Mint challenges.
+	bound, ch, err := a.CreateSCEPChallenge(ctx, "scep", &db.SCEPChallenge{
+		Subject:   "device-1",
+		SANs:      []string{"DEVICE-1.example.com", "10.0.0.1"},
+		CreatedBy: "admin@example.com",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Len(t, bound, scepChallengeLength)
+	assert.Equal(t, scepChallengeID(bound), ch.ID)
+	assert.Equal(t, "scep", ch.Provisioner)
+
+	unbound, _, err := a.CreateSCEPChallenge(ctx, "scep", &db.SCEPChallenge{})
+	require.NoError(t, err)
+	revoked, revokedCh, err := a.CreateSCEPChallenge(ctx, "scep", &db.SCEPChallenge{})
+	require.NoError(t, err)
+
+	cdb.chs["expired"] = &db.SCEPChallenge{ID: "expired", Provisioner: "scep", ExpiresAt: time.Now().Add(-time.Minute)}
+	cdb.chs["other"] = &db.SCEPChallenge{ID: "other", Provisioner: "other"}
+
+	chs, err := a.GetSCEPChallenges(ctx, "scep")
+	require.NoError(t, err)
+	assert.Len(t, chs, 3)
+
+	// Revoke a challenge.
+	err = a.RevokeSCEPChallenge(ctx, "scep", "other")
+	require.ErrorAs(t, err, &adminErr)
+	assert.Equal(t, admin.ErrorNotFoundType.String(), adminErr.Type)
+	require.NoError(t, a.RevokeSCEPChallenge(ctx, "scep", revokedCh.ID))
+	err = a.RevokeSCEPChallenge(ctx, "scep", revokedCh.ID)
+	require.ErrorAs(t, err, &adminErr)
+	assert.Equal(t, admin.ErrorNotFoundType.String(), adminErr.Type)
+
+	// Validate challenges through the provisioner.
+	_, err = p.ValidateChallenge(ctx, csr, revoked, "tx")
+	require.EqualError(t, err, "invalid challenge password provided")
+
+	_, err = p.ValidateChallenge(ctx, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "device-2"}}, bound, "tx")
+	require.EqualError(t, err, `scep challenge is not valid for subject "device-2"`)
+	_, err = p.ValidateChallenge(ctx, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "device-1"},
+		DNSNames: []string{"device-2.example.com"},
+	}, bound, "tx")
+	require.EqualError(t, err, `scep challenge is not valid for san "device-2.example.com"`)
+
+	_, err = p.ValidateChallenge(ctx, csr, bound, "tx")
+	require.NoError(t, err)
+	_, err = p.ValidateChallenge(ctx, csr, unbound, "tx")
+	require.NoError(t, err)
+
+	// One-time challenges are consumed.
+	_, err = p.ValidateChallenge(ctx, csr, bound, "tx")
+	require.EqualError(t, err, "invalid challenge password provided")
+	chs, err = a.GetSCEPChallenges(ctx, "scep")
+	require.NoError(t, err)
+	assert.Empty(t, chs)
+
+	// The static challenge keeps working.
+	_, err = p.ValidateChallenge(ctx, csr, "static", "tx")
+	require.NoError(t, err)
+}
+
+func TestAuthority_validateSCEPChallenge(t *testing.T) {
+	ctx := context.Background()
+	a, p, cdb := newSCEPChallengeTestAuthority(t)
+	csr := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "device-1"}}
+
+	cdb.chs[scepChallengeID("used")] = &db.SCEPChallenge{Provisioner: "scep", UsedAt: time.Now()}
+	cdb.chs[scepChallengeID("expired")] = &db.SCEPChallenge{Provisioner: "scep", ExpiresAt: time.Now().Add(-time.Minute)}
+	cdb.chs[scepChallengeID("other")] = &db.SCEPChallenge{Provisioner: "other"}
+
+	tests := []struct {
+		name      string
+		challenge string
+		want      bool
+		wantErr   string
+	}{
+		{"ok/unknown", "unknown", false, ""},
+		{"ok/other provisioner", "other", false, ""},
+		{"fail/used", "used", false, "scep challenge has already been used"},
+		{"fail/expired", "expired", false, "scep challenge has expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.validateSCEPChallenge(ctx, p, csr, tt.challenge)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -1,12 +1,15 @@
 package authority
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/x509"
 	"encoding/binary"
 	"errors"
 	"net/http"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -36,6 +39,49 @@ const (
 	SSHAddUserCommand = "sudo useradd -m <principal>; nc -q0 localhost 22"
 )
 
+// sshSigningKey is an SSH signer that will sign certificates after the
+// activeFrom time.
+type sshSigningKey struct {
+	signer     ssh.Signer
+	activeFrom time.Time
+}
+
+// addSSHSigningKey adds a signing key to the list, keeping it sorted by
+// activation time.
+func addSSHSigningKey(keys []sshSigningKey, signer ssh.Signer, activeFrom time.Time) []sshSigningKey {
+	keys = append(keys, sshSigningKey{signer: signer, activeFrom: activeFrom})
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].activeFrom.Before(keys[j].activeFrom)
+	})
+	return keys
+}
+
+// getSSHSigner returns the signer for the given certificate type at the
+// given time. It returns the signing key with the most recent activation time
+// in the past, or the configured host or user key if there are none. It
+// returns nil if the certificate type is not enabled.
+func (a *Authority) getSSHSigner(certType uint32, now time.Time) ssh.Signer {
+	var base ssh.Signer
+	var keys []sshSigningKey
+	switch certType {
+	case ssh.UserCert:
+		base, keys = a.sshCAUserCertSignKey, a.sshCAUserSigningKeys
+	case ssh.HostCert:
+		base, keys = a.sshCAHostCertSignKey, a.sshCAHostSigningKeys
+	default:
+		return nil
+	}
+	if base == nil {
+		return nil
+	}
+	for i := len(keys) - 1; i >= 0; i-- {
+		if !now.Before(keys[i].activeFrom) {
+			return keys[i].signer
+		}
+	}
+	return base
+}
+
 // GetSSHRoots returns the SSH User and Host public keys.
 func (a *Authority) GetSSHRoots(context.Context) (*config.SSHKeys, error) {
 	return &config.SSHKeys{
@@ -76,14 +122,25 @@ func (a *Authority) GetSSHConfig(_ context.Context, typ string, data map[string]
 		return nil, errs.BadRequest("invalid certificate type '%s'", typ)
 	}
 
+	// Get the hosts in the inventory.
+	hosts, err := a.getSSHInventoryHosts()
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "getSSHConfig")
+	}
+
 	// Merge user and default data
 	var mergedData map[string]interface{}
 
-	if len(data) == 0 {
+	if len(data) == 0 && len(hosts) == 0 {
 		mergedData = a.templates.Data
 	} else {
-		mergedData = make(map[string]interface{}, len(a.templates.Data)+1)
-		mergedData["User"] = data
+		mergedData = make(map[string]interface{}, len(a.templates.Data)+2)
+		if len(data) > 0 {
+			mergedData["User"] = data
+		}
+		if len(hosts) > 0 {
+			mergedData["Hosts"] = hosts
+		}
 		for k, v := range a.templates.Data {
 			mergedData[k] = v
 		}
@@ -172,8 +229,18 @@ func (a *Authority) signSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 	// Set backdate with the configured value
 	opts.Backdate = a.config.AuthorityConfig.Backdate.Duration
 
+	// Set the tags and groups of the host in the inventory, so they can be
+	// used in templates.
+	if opts.CertType == provisioner.SSHHostCert {
+		var err error
+		if opts.HostTags, opts.HostGroups, err = a.getSSHInventoryTags(opts.Principals); err != nil {
+			return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignSSH: error loading ssh host")
+		}
+	}
+
 	var prov provisioner.Interface
 	var webhookCtl webhookController
+	var accessRequestOpt *provisioner.SSHAccessRequestOption
 	for _, op := range signOpts {
 		switch o := op.(type) {
 		// Capture current provisioner
@@ -206,6 +273,10 @@ func (a *Authority) signSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		case webhookController:
 			webhookCtl = o
 
+		// bind the certificate to an access request
+		case provisioner.SSHAccessRequestOption:
+			accessRequestOpt = &o
+
 		default:
 			return nil, prov, errs.InternalServer("authority.SignSSH: invalid extra option type %T", o)
 		}
@@ -274,6 +345,14 @@ func (a *Authority) signSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		}
 	}
 
+	// Limit the certificate to the approved access request.
+	var accessRequest *db.SSHAccessRequest
+	if accessRequestOpt != nil {
+		if accessRequest, err = a.applySSHAccessRequest(prov, *accessRequestOpt, certTpl); err != nil {
+			return nil, prov, err
+		}
+	}
+
 	// Get signer from authority keys
 	var signer ssh.Signer
 	switch certTpl.CertType {
@@ -281,18 +360,34 @@ func (a *Authority) signSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		if a.sshCAUserCertSignKey == nil {
 			return nil, prov, errs.NotImplemented("authority.SignSSH: user certificate signing is not enabled")
 		}
-		signer = a.sshCAUserCertSignKey
+		signer = a.getSSHSigner(ssh.UserCert, time.Now())
 	case ssh.HostCert:
 		if a.sshCAHostCertSignKey == nil {
 			return nil, prov, errs.NotImplemented("authority.SignSSH: host certificate signing is not enabled")
 		}
-		signer = a.sshCAHostCertSignKey
+		signer = a.getSSHSigner(ssh.HostCert, time.Now())
 	default:
 		return nil, prov, errs.InternalServer("authority.SignSSH: unexpected ssh certificate type: %d", certTpl.CertType)
 	}
 
+	// Decommissioned hosts cannot get new certificates.
+	if err := a.checkSSHHostInventory(certTpl); err != nil {
+		return nil, prov, err
+	}
+
 	// Check if authority is allowed to sign the certificate
-	if err := a.isAllowedToSignSSHCertificate(certTpl); err != nil {
+	if err := a.isAllowedToSignSSHCertificate(prov, certTpl); err != nil {
+		var ee *errs.Error
+		if errors.As(err, &ee) {
+			return nil, prov, ee
+		}
+		return nil, prov, errs.InternalServerErr(err,
+			errs.WithMessage("authority.SignSSH: error creating ssh certificate"),
+		)
+	}
+
+	// Check if the certificate satisfies the CEL policies
+	if err := a.areSSHRulesSatisfied(certTpl, prov, webhookCtl); err != nil {
 		var ee *errs.Error
 		if errors.As(err, &ee) {
 			return nil, prov, ee
@@ -309,6 +404,18 @@ func (a *Authority) signSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		)
 	}
 
+	// Verify the identity of the host.
+	if err := a.verifySSHHost(ctx, certTpl, opts.HostKeyProof); err != nil {
+		return nil, prov, err
+	}
+
+	// Use the access request before signing, so it cannot be used twice.
+	if accessRequest != nil {
+		if err := a.issueSSHAccessRequest(accessRequest, certTpl); err != nil {
+			return nil, prov, err
+		}
+	}
+
 	// Sign certificate.
 	cert, err := sshutil.CreateCertificate(certTpl, signer)
 	if err != nil {
@@ -329,9 +436,18 @@ func (a *Authority) signSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 	return cert, prov, nil
 }
 
-// isAllowedToSignSSHCertificate checks if the Authority is allowed to sign the SSH certificate.
-func (a *Authority) isAllowedToSignSSHCertificate(cert *ssh.Certificate) error {
-	return a.policyEngine.IsSSHCertificateAllowed(cert)
+// isAllowedToSignSSHCertificate checks if the Authority is allowed to sign the
+// SSH certificate. The critical options and extensions policy of the
+// provisioner managed with the admin API are checked too. On renew and rekey,
+// the provisioner is the one authorizing the request, e.g. SSHPOP.
+func (a *Authority) isAllowedToSignSSHCertificate(prov provisioner.Interface, cert *ssh.Certificate) error {
+	if err := a.policyEngine.IsSSHCertificateAllowed(cert); err != nil {
+		return err
+	}
+	if prov == nil {
+		return nil
+	}
+	return a.sshOptionsPolicyEngines[prov.GetID()].IsSSHCertificateAllowed(cert)
 }
 
 // RenewSSH creates a signed SSH certificate using the old SSH certificate as a template.
@@ -382,16 +498,28 @@ func (a *Authority) renewSSH(ctx context.Context, oldCert *ssh.Certificate) (*ss
 		if a.sshCAUserCertSignKey == nil {
 			return nil, prov, errs.NotImplemented("renewSSH: user certificate signing is not enabled")
 		}
-		signer = a.sshCAUserCertSignKey
+		signer = a.getSSHSigner(ssh.UserCert, time.Now())
 	case ssh.HostCert:
 		if a.sshCAHostCertSignKey == nil {
 			return nil, prov, errs.NotImplemented("renewSSH: host certificate signing is not enabled")
 		}
-		signer = a.sshCAHostCertSignKey
+		signer = a.getSSHSigner(ssh.HostCert, time.Now())
 	default:
 		return nil, prov, errs.InternalServer("renewSSH: unexpected ssh certificate type: %d", certTpl.CertType)
 	}
 
+	// Check if the certificate is allowed to be renewed, the name and the
+	// critical options and extensions policies might have changed.
+	if err := a.isAllowedToSignSSHCertificate(prov, certTpl); err != nil {
+		var ee *errs.Error
+		if errors.As(err, &ee) {
+			return nil, prov, ee
+		}
+		return nil, prov, errs.InternalServerErr(err,
+			errs.WithMessage("renewSSH: error renewing certificate"),
+		)
+	}
+
 	// Sign certificate.
 	cert, err := sshutil.CreateCertificate(certTpl, signer)
 	if err != nil {
@@ -462,16 +590,28 @@ func (a *Authority) rekeySSH(ctx context.Context, oldCert *ssh.Certificate, pub
 		if a.sshCAUserCertSignKey == nil {
 			return nil, prov, errs.NotImplemented("rekeySSH; user certificate signing is not enabled")
 		}
-		signer = a.sshCAUserCertSignKey
+		signer = a.getSSHSigner(ssh.UserCert, time.Now())
 	case ssh.HostCert:
 		if a.sshCAHostCertSignKey == nil {
 			return nil, prov, errs.NotImplemented("rekeySSH; host certificate signing is not enabled")
 		}
-		signer = a.sshCAHostCertSignKey
+		signer = a.getSSHSigner(ssh.HostCert, time.Now())
 	default:
 		return nil, prov, errs.BadRequest("unexpected certificate type '%d'", cert.CertType)
 	}
 
+	// Check if the certificate is allowed to be rekeyed, the name and the
+	// critical options and extensions policies might have changed.
+	if err := a.isAllowedToSignSSHCertificate(prov, cert); err != nil {
+		var ee *errs.Error
+		if errors.As(err, &ee) {
+			return nil, prov, ee
+		}
+		return nil, prov, errs.InternalServerErr(err,
+			errs.WithMessage("rekeySSH; error rekeying certificate"),
+		)
+	}
+
 	var err error
 	// Sign certificate.
 	cert, err = sshutil.CreateCertificate(cert, signer)
@@ -590,7 +730,7 @@ func (a *Authority) SignSSHAddUser(ctx context.Context, key ssh.PublicKey, subje
 		prov, _, _ = a.getProvisionerFromToken(token)
 	}
 
-	signer := a.sshCAUserCertSignKey
+	signer := a.getSSHSigner(ssh.UserCert, time.Now())
 	principal := subject.ValidPrincipals[0]
 	addUserPrincipal := a.getAddUserPrincipal()
 
@@ -666,13 +806,137 @@ func (a *Authority) GetSSHHosts(ctx context.Context, cert *x509.Certificate) ([]
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "getSSHHosts")
 	}
 
-	hosts := make([]config.Host, len(hostnames))
-	for i, hn := range hostnames {
-		hosts[i] = config.Host{Hostname: hn}
+	// Hosts in the inventory are returned with their tags and groups, followed
+	// by the principals of host certificates not in the inventory.
+	// Decommissioned hosts are excluded.
+	hosts, err := a.getSSHInventoryHosts()
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "getSSHHosts")
+	}
+	for _, hn := range hostnames {
+		if slices.ContainsFunc(hosts, func(h config.Host) bool { return strings.EqualFold(h.Hostname, hn) }) {
+			continue
+		}
+		decommissioned, err := a.isSSHHostDecommissioned(hn)
+		if err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "getSSHHosts")
+		}
+		if !decommissioned {
+			hosts = append(hosts, config.Host{Hostname: hn})
+		}
+	}
+	if hosts == nil {
+		hosts = []config.Host{}
 	}
 	return hosts, nil
 }
 
+// GetSSHAuthorizedPrincipals returns the principals of the user certificate
+// that are authorized to log in as user to the host with the given hostnames,
+// using the authorized principals rules in the configuration. The X.509
+// certificate used by the host, if any, is used to get the host tags; it must
+// have been issued by the provisioner configured in
+// authorizedPrincipalsProvisioner and it must not be revoked.
+func (a *Authority) GetSSHAuthorizedPrincipals(ctx context.Context, hostnames []string, hostCert *x509.Certificate, user string, cert *ssh.Certificate) ([]string, error) {
+	if a.sshCAUserCertSignKey == nil {
+		return nil, errs.NotImplemented("getSSHAuthorizedPrincipals: user certificate signing is not enabled")
+	}
+	if a.config.SSH == nil || len(a.config.SSH.AuthorizedPrincipals) == 0 {
+		return nil, errs.NotFound("getSSHAuthorizedPrincipals: ssh authorized principals are not configured")
+	}
+	if hostCert != nil {
+		if err := a.authorizeSSHAuthorizedPrincipalsClient(hostCert); err != nil {
+			return nil, err
+		}
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, errs.BadRequest("getSSHAuthorizedPrincipals: certificate is not a user certificate")
+	}
+
+	// Verify that the certificate has been signed by a trusted user key. The
+	// critical options are enforced by sshd.
+	var trusted bool
+	for _, k := range a.sshCAUserCerts {
+		if bytes.Equal(k.Marshal(), cert.SignatureKey.Marshal()) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return nil, errs.Unauthorized("getSSHAuthorizedPrincipals: user certificate is not signed by a trusted key")
+	}
+	checker := new(ssh.CertChecker)
+	for opt := range cert.CriticalOptions {
+		checker.SupportedCriticalOptions = append(checker.SupportedCriticalOptions, opt)
+	}
+	var principal string
+	if len(cert.ValidPrincipals) > 0 {
+		principal = cert.ValidPrincipals[0]
+	}
+	if err := checker.CheckCert(principal, cert); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "getSSHAuthorizedPrincipals: invalid user certificate")
+	}
+	if err := a.authorizeSSHCertificate(ctx, cert); err != nil {
+		return nil, err
+	}
+
+	// Get the tags of the host.
+	var tags []config.HostTag
+	if a.sshGetHostsFunc != nil {
+		hosts, err := a.sshGetHostsFunc(ctx, hostCert)
+		if err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "getSSHAuthorizedPrincipals")
+		}
+		for _, h := range hosts {
+			if slices.Contains(hostnames, h.Hostname) {
+				tags = append(tags, h.HostTags...)
+			}
+		}
+	} else {
+		hosts, err := a.getSSHInventoryHosts()
+		if err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "getSSHAuthorizedPrincipals")
+		}
+		for _, h := range hosts {
+			if slices.ContainsFunc(hostnames, func(hn string) bool { return strings.EqualFold(hn, h.Hostname) }) {
+				tags = append(tags, h.HostTags...)
+			}
+		}
+	}
+
+	principals := []string{}
+	for _, r := range a.config.SSH.AuthorizedPrincipals {
+		for _, p := range r.Authorize(hostnames, tags, user, cert.KeyId, cert.ValidPrincipals) {
+			if !slices.Contains(principals, p) {
+				principals = append(principals, p)
+			}
+		}
+	}
+	return principals, nil
+}
+
+// authorizeSSHAuthorizedPrincipalsClient checks that the X.509 certificate
+// used by a host to get the authorized principals has been issued by the
+// provisioner configured for that purpose and that it has not been revoked.
+func (a *Authority) authorizeSSHAuthorizedPrincipalsClient(cert *x509.Certificate) error {
+	name := a.config.SSH.AuthorizedPrincipalsProvisioner
+	if name == "" {
+		return errs.Unauthorized("getSSHAuthorizedPrincipals: client certificates are not allowed; use an sshpop token")
+	}
+	p, err := a.LoadProvisionerByCertificate(cert)
+	if err != nil || p.GetName() != name {
+		return errs.Unauthorized("getSSHAuthorizedPrincipals: client certificate was not issued by provisioner %s", name)
+	}
+	isRevoked, err := a.IsRevoked(cert.SerialNumber.String())
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "getSSHAuthorizedPrincipals: error checking revocation")
+	}
+	if isRevoked {
+		return errs.Unauthorized("getSSHAuthorizedPrincipals: client certificate has been revoked")
+	}
+	return nil
+}
+
 func (a *Authority) getAddUserPrincipal() (cmd string) {
 	if a.config.SSH.AddUserPrincipal == "" {
 		return SSHAddUserPrincipal
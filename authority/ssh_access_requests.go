@@ -0,0 +1,352 @@
+package authority
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/linkedca"
+	"github.com/smallstep/nosql/database"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/internal/cast"
+	"github.com/smallstep/certificates/internal/httptransport"
+	"github.com/smallstep/certificates/webhook"
+)
+
+// sshAccessRequestWebhookApprover is the value of ApprovedBy in the access
+// requests approved by the webhook.
+const sshAccessRequestWebhookApprover = "webhook"
+
+// CreateSSHAccessRequest creates a just-in-time SSH access request for the
+// subject of the given SSH sign token. The token is validated and consumed.
+// If the access requests webhook is configured, the request is approved if the
+// webhook allows it, otherwise it stays pending until an admin approves or
+// denies it.
+func (a *Authority) CreateSSHAccessRequest(ctx context.Context, token string, req *db.SSHAccessRequest) (*db.SSHAccessRequest, error) {
+	cfg, adb, err := a.getSSHAccessRequestsDB()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := a.authorizeSSHSign(ctx, token); err != nil {
+		return nil, err
+	}
+	prov, claims, err := a.getProvisionerFromToken(token)
+	if err != nil {
+		return nil, errs.UnauthorizedErr(err)
+	}
+	if claims.Subject == "" {
+		return nil, errs.Unauthorized("authority.CreateSSHAccessRequest: token subject cannot be empty")
+	}
+
+	if err := a.validateSSHAccessRequest(cfg, req); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	req.ID = uuid.NewString()
+	req.Status = db.SSHAccessRequestPending
+	req.Provisioner = prov.GetName()
+	req.Subject = claims.Subject
+	req.ApprovedBy, req.DeniedBy, req.DenyReason, req.Serial = "", "", "", ""
+	req.CreatedAt = now
+	req.UpdatedAt = now
+	req.ExpiresAt = time.Time{}
+	if err := adb.CreateSSHAccessRequest(req); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.CreateSSHAccessRequest: error storing ssh access request")
+	}
+
+	if cfg.Webhook == nil {
+		return req, nil
+	}
+	allow, err := a.callSSHAccessRequestWebhook(ctx, cfg.Webhook, req)
+	if err != nil {
+		log.Printf("error calling ssh access requests webhook for %s: %v\n", req.ID, err)
+		return req, nil
+	}
+	if !allow {
+		return req, nil
+	}
+	return a.approveSSHAccessRequest(cfg, adb, req, sshAccessRequestWebhookApprover)
+}
+
+// GetSSHAccessRequest returns the SSH access request with the given id.
+func (a *Authority) GetSSHAccessRequest(_ context.Context, id string) (*db.SSHAccessRequest, error) {
+	_, adb, err := a.getSSHAccessRequestsDB()
+	if err != nil {
+		return nil, err
+	}
+	req, err := adb.GetSSHAccessRequest(id)
+	if err != nil {
+		if database.IsErrNotFound(err) {
+			return nil, admin.NewError(admin.ErrorNotFoundType, "ssh access request %s not found", id)
+		}
+		return nil, admin.WrapErrorISE(err, "error loading ssh access request %s", id)
+	}
+	return req, nil
+}
+
+// GetSSHAccessRequestWithToken returns the SSH access request with the given
+// id to its subject. The subject authenticates using an SSH sign token, and the
+// provisioner and subject of the token must match the ones in the request.
+func (a *Authority) GetSSHAccessRequestWithToken(ctx context.Context, token, id string) (*db.SSHAccessRequest, error) {
+	if _, _, err := a.getSSHAccessRequestsDB(); err != nil {
+		return nil, err
+	}
+
+	if _, err := a.authorizeSSHSign(ctx, token); err != nil {
+		return nil, err
+	}
+	prov, claims, err := a.getProvisionerFromToken(token)
+	if err != nil {
+		return nil, errs.UnauthorizedErr(err)
+	}
+
+	req, err := a.GetSSHAccessRequest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" || req.Provisioner != prov.GetName() || req.Subject != claims.Subject {
+		return nil, errs.Forbidden("ssh access request %s does not belong to %s", id, claims.Subject)
+	}
+	return req, nil
+}
+
+// GetSSHAccessRequests returns all the SSH access requests.
+func (a *Authority) GetSSHAccessRequests(context.Context) ([]*db.SSHAccessRequest, error) {
+	_, adb, err := a.getSSHAccessRequestsDB()
+	if err != nil {
+		return nil, err
+	}
+	reqs, err := adb.GetSSHAccessRequests()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading ssh access requests")
+	}
+	return reqs, nil
+}
+
+// ApproveSSHAccessRequest approves a pending SSH access request. The request
+// can be used to get a certificate until the approval expires. Subjects cannot
+// approve their own requests.
+func (a *Authority) ApproveSSHAccessRequest(ctx context.Context, id, approvedBy string) (*db.SSHAccessRequest, error) {
+	req, err := a.GetSSHAccessRequest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Status != db.SSHAccessRequestPending {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "ssh access request %s is %s", id, req.Status)
+	}
+	if approvedBy == req.Subject {
+		return nil, admin.NewError(admin.ErrorUnauthorizedType, "ssh access request %s cannot be approved by its subject", id)
+	}
+	cfg, adb, err := a.getSSHAccessRequestsDB()
+	if err != nil {
+		return nil, err
+	}
+	return a.approveSSHAccessRequest(cfg, adb, req, approvedBy)
+}
+
+// DenySSHAccessRequest denies a pending or approved SSH access request.
+func (a *Authority) DenySSHAccessRequest(ctx context.Context, id, deniedBy, reason string) (*db.SSHAccessRequest, error) {
+	req, err := a.GetSSHAccessRequest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Status != db.SSHAccessRequestPending && req.Status != db.SSHAccessRequestApproved {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "ssh access request %s is %s", id, req.Status)
+	}
+
+	req.Status = db.SSHAccessRequestDenied
+	req.DeniedBy = deniedBy
+	req.DenyReason = reason
+	req.UpdatedAt = time.Now().UTC()
+	if err := a.db.(db.SSHAccessRequestDB).UpdateSSHAccessRequest(req); err != nil {
+		return nil, admin.WrapErrorISE(err, "error updating ssh access request %s", id)
+	}
+	return req, nil
+}
+
+func (a *Authority) approveSSHAccessRequest(cfg *config.SSHAccessRequests, adb db.SSHAccessRequestDB, req *db.SSHAccessRequest, approvedBy string) (*db.SSHAccessRequest, error) {
+	now := time.Now().UTC()
+	req.Status = db.SSHAccessRequestApproved
+	req.ApprovedBy = approvedBy
+	req.UpdatedAt = now
+	req.ExpiresAt = now.Add(cfg.GetApprovalDuration())
+	if err := adb.UpdateSSHAccessRequest(req); err != nil {
+		return nil, admin.WrapErrorISE(err, "error updating ssh access request %s", req.ID)
+	}
+	return req, nil
+}
+
+func (a *Authority) getSSHAccessRequestsDB() (*config.SSHAccessRequests, db.SSHAccessRequestDB, error) {
+	if a.config.SSH == nil || a.config.SSH.AccessRequests == nil {
+		return nil, nil, admin.NewError(admin.ErrorNotImplementedType, "ssh access requests are not enabled")
+	}
+	adb, ok := a.db.(db.SSHAccessRequestDB)
+	if !ok {
+		return nil, nil, admin.NewError(admin.ErrorNotImplementedType, "ssh access requests are not supported by the database")
+	}
+	return a.config.SSH.AccessRequests, adb, nil
+}
+
+// validateSSHAccessRequest validates the fields of a new access request, and
+// sets the default validity.
+func (a *Authority) validateSSHAccessRequest(cfg *config.SSHAccessRequests, req *db.SSHAccessRequest) error {
+	switch {
+	case len(req.Principals) == 0:
+		return errs.BadRequest("ssh access request principals cannot be empty")
+	case slices.Contains(req.Principals, ""):
+		return errs.BadRequest("ssh access request principals cannot contain empty values")
+	case strings.TrimSpace(req.Justification) == "":
+		return errs.BadRequest("ssh access request justification cannot be empty")
+	case req.Validity.Value() < 0:
+		return errs.BadRequest("ssh access request validity cannot be negative")
+	case req.Validity.Value() > cfg.GetMaxDuration():
+		return errs.BadRequest("ssh access request validity cannot be greater than %s", cfg.GetMaxDuration())
+	}
+	if req.Validity.Value() == 0 {
+		req.Validity = provisioner.Duration{Duration: cfg.GetMaxDuration()}
+	}
+
+	for _, s := range req.SourceAddresses {
+		if net.ParseIP(s) == nil {
+			if _, _, err := net.ParseCIDR(s); err != nil {
+				return errs.BadRequest("ssh access request source address %q is not valid", s)
+			}
+		}
+	}
+
+	if req.HostGroup != "" {
+		hosts, err := a.getSSHInventoryHosts()
+		if err != nil {
+			return errs.Wrap(http.StatusInternalServerError, err, "authority.CreateSSHAccessRequest: error loading ssh hosts")
+		}
+		if hosts != nil && !slices.ContainsFunc(hosts, func(h config.Host) bool {
+			return slices.Contains(h.HostGroups, req.HostGroup)
+		}) {
+			return errs.BadRequest("ssh access request host group %q does not exist", req.HostGroup)
+		}
+	}
+
+	return nil
+}
+
+// callSSHAccessRequestWebhook sends the access request to the webhook and
+// returns whether it allows it.
+func (a *Authority) callSSHAccessRequestWebhook(ctx context.Context, cfg *config.SSHAccessRequestWebhook, req *db.SSHAccessRequest) (bool, error) {
+	wh := &provisioner.Webhook{
+		ID:                   "accessRequests",
+		Name:                 "accessRequests",
+		URL:                  cfg.URL,
+		Kind:                 linkedca.Webhook_AUTHORIZING.String(),
+		DisableTLSClientAuth: cfg.DisableTLSClientAuth,
+		Secret:               cfg.Secret,
+		BearerToken:          cfg.BearerToken,
+	}
+	client := a.webhookClient
+	if client == nil {
+		client = &http.Client{
+			Transport: a.wrapTransport(httptransport.New()),
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	resp, err := wh.DoWithContext(ctx, client, a.wrapTransport, &webhook.RequestBody{
+		SSHAccessRequest: &webhook.SSHAccessRequest{
+			ID:              req.ID,
+			Subject:         req.Subject,
+			HostGroup:       req.HostGroup,
+			Principals:      req.Principals,
+			SourceAddresses: req.SourceAddresses,
+			Justification:   req.Justification,
+			Validity:        req.Validity.String(),
+		},
+	}, nil)
+	if err != nil {
+		return false, err
+	}
+	return resp.Allow, nil
+}
+
+// applySSHAccessRequest checks that the access request bound to a certificate
+// is approved and belongs to the subject of the token, and limits the
+// certificate to the principals, validity and source addresses of the request.
+func (a *Authority) applySSHAccessRequest(prov provisioner.Interface, opt provisioner.SSHAccessRequestOption, cert *ssh.Certificate) (*db.SSHAccessRequest, error) {
+	adb, ok := a.db.(db.SSHAccessRequestDB)
+	if !ok || a.config.SSH == nil || a.config.SSH.AccessRequests == nil {
+		return nil, errs.NotImplemented("authority.SignSSH: ssh access requests are not enabled")
+	}
+	req, err := adb.GetSSHAccessRequest(opt.ID)
+	switch {
+	case database.IsErrNotFound(err):
+		return nil, errs.Forbidden("ssh access request %s not found", opt.ID)
+	case err != nil:
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignSSH: error loading ssh access request")
+	}
+
+	now := time.Now()
+	switch {
+	case prov == nil || req.Provisioner != prov.GetName() || req.Subject != opt.Subject:
+		return nil, errs.Forbidden("ssh access request %s does not belong to %s", req.ID, opt.Subject)
+	case req.Status != db.SSHAccessRequestApproved:
+		return nil, errs.Forbidden("ssh access request %s is %s", req.ID, req.Status)
+	case now.After(req.ExpiresAt):
+		return nil, errs.Forbidden("ssh access request %s has expired", req.ID)
+	case cert.CertType != ssh.UserCert:
+		return nil, errs.Forbidden("ssh access request %s can only be used for user certificates", req.ID)
+	}
+	for _, p := range cert.ValidPrincipals {
+		if !slices.Contains(req.Principals, p) {
+			return nil, errs.Forbidden("ssh access request %s does not allow principal %s", req.ID, p)
+		}
+	}
+
+	if validBefore := cast.Uint64(now.Add(req.Validity.Value()).Unix()); cert.ValidBefore == 0 || cert.ValidBefore > validBefore {
+		cert.ValidBefore = validBefore
+	}
+	if len(req.SourceAddresses) > 0 {
+		if cert.CriticalOptions == nil {
+			cert.CriticalOptions = make(map[string]string)
+		}
+		cert.CriticalOptions["source-address"] = strings.Join(req.SourceAddresses, ",")
+	}
+	return req, nil
+}
+
+// issueSSHAccessRequest atomically moves the access request from approved to
+// issued before the certificate is signed, so concurrent requests cannot use it
+// twice. The serial of the certificate is set if it is not already defined.
+func (a *Authority) issueSSHAccessRequest(req *db.SSHAccessRequest, cert *ssh.Certificate) error {
+	if cert.Serial == 0 {
+		if err := binary.Read(rand.Reader, binary.BigEndian, &cert.Serial); err != nil {
+			return errs.Wrap(http.StatusInternalServerError, err, "authority.SignSSH: error generating serial number")
+		}
+	}
+	_, err := a.db.(db.SSHAccessRequestDB).IssueSSHAccessRequest(req.ID, strconv.FormatUint(cert.Serial, 10), time.Now().UTC())
+	switch {
+	case errors.Is(err, db.ErrSSHAccessRequestNotApproved):
+		return errs.Forbidden("ssh access request %s has already been used", req.ID)
+	case err != nil:
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.SignSSH: error updating ssh access request")
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,243 @@
+package authority
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/nosql/database"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/webhook"
+)
+
+type mockSSHAccessRequestDB struct {
+	db.MockAuthDB
+	reqs map[string]*db.SSHAccessRequest
+}
+
+func (m *mockSSHAccessRequestDB) GetSSHAccessRequest(id string) (*db.SSHAccessRequest, error) {
+	if req, ok := m.reqs[id]; ok {
+		// Return a copy like a real database.
+		cp := *req
+		return &cp, nil
+	}
+	return nil, database.ErrNotFound
+}
+
+func (m *mockSSHAccessRequestDB) GetSSHAccessRequests() ([]*db.SSHAccessRequest, error) {
+	var reqs []*db.SSHAccessRequest
+	for _, req := range m.reqs {
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+func (m *mockSSHAccessRequestDB) CreateSSHAccessRequest(req *db.SSHAccessRequest) error {
+	if _, ok := m.reqs[req.ID]; ok {
+		return db.ErrAlreadyExists
+	}
+	cp := *req
+	m.reqs[req.ID] = &cp
+	return nil
+}
+
+func (m *mockSSHAccessRequestDB) UpdateSSHAccessRequest(req *db.SSHAccessRequest) error {
+	cp := *req
+	m.reqs[req.ID] = &cp
+	return nil
+}
+
+func (m *mockSSHAccessRequestDB) IssueSSHAccessRequest(id, serial string, issuedAt time.Time) (*db.SSHAccessRequest, error) {
+	req, ok := m.reqs[id]
+	switch {
+	case !ok:
+		return nil, database.ErrNotFound
+	case req.Status != db.SSHAccessRequestApproved:
+		return nil, db.ErrSSHAccessRequestNotApproved
+	}
+	req.Status = db.SSHAccessRequestIssued
+	req.Serial = serial
+	req.UpdatedAt = issuedAt
+	cp := *req
+	return &cp, nil
+}
+
+func newSSHAccessRequestTestAuthority(t *testing.T, cfg *config.SSHAccessRequests) (*Authority, *mockSSHAccessRequestDB) {
+	t.Helper()
+	adb := &mockSSHAccessRequestDB{
+		MockAuthDB: db.MockAuthDB{
+			MUseToken: func(id, tok string) (bool, error) {
+				return true, nil
+			},
+		},
+		reqs: map[string]*db.SSHAccessRequest{},
+	}
+	a := testAuthority(t, WithDatabase(adb))
+	a.config.SSH.AccessRequests = cfg
+	return a, adb
+}
+
+func TestAuthority_SSHAccessRequest(t *testing.T) {
+	jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	require.NoError(t, err)
+
+	a, adb := newSSHAccessRequestTestAuthority(t, &config.SSHAccessRequests{
+		MaxDuration: &provisioner.Duration{Duration: 30 * time.Minute},
+	})
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SSHSignMethod)
+	newToken := func(sub string, opts *provisioner.SignSSHOptions) string {
+		tok, err := generateSSHToken(sub, "step-cli", testAudiences.SSHSign[0], time.Now(), opts, jwk)
+		require.NoError(t, err)
+		return tok
+	}
+	sign := func(sub, accessRequestID string, principals ...string) (*ssh.Certificate, error) {
+		opts := provisioner.SignSSHOptions{CertType: "user", Principals: principals, AccessRequestID: accessRequestID}
+		signOpts, err := a.Authorize(ctx, newToken(sub, &opts))
+		require.NoError(t, err)
+		return a.SignSSH(ctx, pub, provisioner.SignSSHOptions{CertType: "user", Principals: principals}, signOpts...)
+	}
+
+	// Validation
+	_, err = a.CreateSSHAccessRequest(ctx, newToken("alice@example.com", &provisioner.SignSSHOptions{}), &db.SSHAccessRequest{
+		Principals:    []string{"alice"},
+		Justification: "incident",
+		Validity:      provisioner.Duration{Duration: time.Hour},
+	})
+	assert.EqualError(t, err, "ssh access request validity cannot be greater than 30m0s")
+	_, err = a.CreateSSHAccessRequest(ctx, newToken("alice@example.com", &provisioner.SignSSHOptions{}), &db.SSHAccessRequest{
+		Principals:      []string{"alice"},
+		Justification:   "incident",
+		SourceAddresses: []string{"10.0.0.0/33"},
+	})
+	assert.EqualError(t, err, `ssh access request source address "10.0.0.0/33" is not valid`)
+
+	// Create and approve
+	req, err := a.CreateSSHAccessRequest(ctx, newToken("alice@example.com", &provisioner.SignSSHOptions{}), &db.SSHAccessRequest{
+		Principals:      []string{"alice", "root"},
+		Justification:   "incident 42",
+		SourceAddresses: []string{"10.0.0.1", "192.168.0.0/24"},
+		Validity:        provisioner.Duration{Duration: 10 * time.Minute},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, db.SSHAccessRequestPending, req.Status)
+	assert.Equal(t, "alice@example.com", req.Subject)
+	assert.Equal(t, "step-cli", req.Provisioner)
+
+	_, err = sign("alice@example.com", req.ID, "alice")
+	assert.EqualError(t, err, "ssh access request "+req.ID+" is pending")
+
+	_, err = a.ApproveSSHAccessRequest(ctx, req.ID, "alice@example.com")
+	assert.EqualError(t, err, "ssh access request "+req.ID+" cannot be approved by its subject")
+
+	req, err = a.ApproveSSHAccessRequest(ctx, req.ID, "admin@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, db.SSHAccessRequestApproved, req.Status)
+	assert.Equal(t, "admin@example.com", req.ApprovedBy)
+	assert.False(t, req.ExpiresAt.IsZero())
+
+	// Sign
+	_, err = sign("bob@example.com", req.ID, "alice")
+	assert.EqualError(t, err, "ssh access request "+req.ID+" does not belong to bob@example.com")
+	_, err = sign("alice@example.com", req.ID, "admin")
+	assert.EqualError(t, err, "ssh access request "+req.ID+" does not allow principal admin")
+	_, err = sign("alice@example.com", "missing", "alice")
+	assert.EqualError(t, err, "ssh access request missing not found")
+
+	cert, err := sign("alice@example.com", req.ID, "alice", "root")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "root"}, cert.ValidPrincipals)
+	assert.Equal(t, "10.0.0.1,192.168.0.0/24", cert.CriticalOptions["source-address"])
+	assert.LessOrEqual(t, cert.ValidBefore, uint64(time.Now().Add(10*time.Minute).Unix()))
+	assert.Equal(t, db.SSHAccessRequestIssued, adb.reqs[req.ID].Status)
+	assert.Equal(t, strconv.FormatUint(cert.Serial, 10), adb.reqs[req.ID].Serial)
+
+	// Requests can only be used once.
+	_, err = sign("alice@example.com", req.ID, "alice")
+	assert.EqualError(t, err, "ssh access request "+req.ID+" is issued")
+
+	// Get with token
+	got, err := a.GetSSHAccessRequestWithToken(ctx, newToken("alice@example.com", &provisioner.SignSSHOptions{}), req.ID)
+	require.NoError(t, err)
+	assert.Equal(t, db.SSHAccessRequestIssued, got.Status)
+	_, err = a.GetSSHAccessRequestWithToken(ctx, newToken("bob@example.com", &provisioner.SignSSHOptions{}), req.ID)
+	assert.EqualError(t, err, "ssh access request "+req.ID+" does not belong to bob@example.com")
+	_, err = a.GetSSHAccessRequestWithToken(ctx, "not-a-token", req.ID)
+	assert.Error(t, err)
+
+	// Deny
+	req, err = a.CreateSSHAccessRequest(ctx, newToken("alice@example.com", &provisioner.SignSSHOptions{}), &db.SSHAccessRequest{
+		Principals:    []string{"alice"},
+		Justification: "incident 43",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Minute, req.Validity.Duration)
+	req, err = a.DenySSHAccessRequest(ctx, req.ID, "admin@example.com", "not on call")
+	require.NoError(t, err)
+	assert.Equal(t, db.SSHAccessRequestDenied, req.Status)
+	_, err = a.ApproveSSHAccessRequest(ctx, req.ID, "admin@example.com")
+	assert.EqualError(t, err, "ssh access request "+req.ID+" is denied")
+}
+
+func TestAuthority_CreateSSHAccessRequest_webhook(t *testing.T) {
+	jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body webhook.RequestBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.SSHAccessRequest == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(webhook.ResponseBody{
+			Allow: body.SSHAccessRequest.Justification == "on call",
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	a, _ := newSSHAccessRequestTestAuthority(t, &config.SSHAccessRequests{
+		Webhook: &config.SSHAccessRequestWebhook{URL: srv.URL},
+	})
+	a.webhookClient = srv.Client()
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SSHSignMethod)
+
+	tests := []struct {
+		justification  string
+		wantStatus     db.SSHAccessRequestStatus
+		wantApprovedBy string
+	}{
+		{"on call", db.SSHAccessRequestApproved, "webhook"},
+		{"curious", db.SSHAccessRequestPending, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.justification, func(t *testing.T) {
+			tok, err := generateSSHToken("alice@example.com", "step-cli", testAudiences.SSHSign[0], time.Now(), &provisioner.SignSSHOptions{}, jwk)
+			require.NoError(t, err)
+			req, err := a.CreateSSHAccessRequest(ctx, tok, &db.SSHAccessRequest{
+				Principals:    []string{"alice"},
+				Justification: tt.justification,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, req.Status)
+			assert.Equal(t, tt.wantApprovedBy, req.ApprovedBy)
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/nosql/database"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/internal/cast"
+)
+
+// SearchSSHCertificates returns the stored SSH certificates matching the given
+// filter.
+func (a *Authority) SearchSSHCertificates(_ context.Context, filter *db.SSHCertificateFilter) ([]*db.SSHCertificateInfo, error) {
+	idb, ok := a.db.(db.SSHCertificateIndexDB)
+	if !ok {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "ssh certificates search is not supported by the database")
+	}
+	infos, err := idb.SearchSSHCertificates(filter)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error searching ssh certificates")
+	}
+	return infos, nil
+}
+
+// RevokeSSHCertificates revokes all the active SSH certificates matching the
+// given filter, that must have a principal or a key id. It returns the
+// certificates revoked.
+func (a *Authority) RevokeSSHCertificates(ctx context.Context, filter *db.SSHCertificateFilter, reasonCode int, reason string) ([]*db.SSHCertificateInfo, error) {
+	if filter == nil || (filter.Principal == "" && filter.KeyID == "") {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "principal or key id are required to revoke ssh certificates")
+	}
+	nf := *filter
+	nf.ValidAt = time.Now()
+	infos, err := a.SearchSSHCertificates(ctx, &nf)
+	if err != nil {
+		return nil, err
+	}
+
+	idb := a.db.(db.SSHCertificateIndexDB)
+	revoked := []*db.SSHCertificateInfo{}
+	for _, info := range infos {
+		if info.Revoked {
+			continue
+		}
+		cert, err := idb.GetSSHCertificate(info.Serial)
+		if err != nil {
+			return revoked, admin.WrapErrorISE(err, "error loading ssh certificate %s", info.Serial)
+		}
+		rci := &db.RevokedCertificateInfo{
+			Serial:     info.Serial,
+			ReasonCode: reasonCode,
+			Reason:     reason,
+			RevokedAt:  time.Now().UTC(),
+			ExpiresAt:  info.ValidBefore,
+		}
+		if err := a.revokeSSH(cert, rci); err != nil && !errors.Is(err, db.ErrAlreadyExists) {
+			return revoked, admin.WrapErrorISE(err, "error revoking ssh certificate %s", info.Serial)
+		}
+		info.Revoked = true
+		revoked = append(revoked, info)
+	}
+	return revoked, nil
+}
+
+// GetSSHKRL returns an OpenSSH key revocation list (KRL) with the unexpired
+// revoked SSH certificates signed by the SSH CA keys. Only the keys used by
+// this CA to sign certificates are in the KRL; serial numbers are not unique
+// across other trusted or federated CAs. It can be used in the RevokedKeys
+// option of sshd.
+func (a *Authority) GetSSHKRL(context.Context) ([]byte, error) {
+	keys := a.sshCASignerKeys
+	if len(keys) == 0 {
+		return nil, errs.NotFound("getSSHKRL: ssh is not configured")
+	}
+	idb, ok := a.db.(db.SSHCertificateIndexDB)
+	if !ok {
+		return nil, errs.NotImplemented("getSSHKRL: ssh revocation lists are not supported by the database")
+	}
+	revoked, err := idb.GetRevokedSSHCertificates()
+	if err != nil && !database.IsErrNotFound(err) {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "getSSHKRL: error loading revoked ssh certificates")
+	}
+
+	now := time.Now()
+	serials := make([]uint64, 0, len(revoked))
+	for _, rci := range revoked {
+		if !rci.ExpiresAt.IsZero() && rci.ExpiresAt.Before(now) {
+			continue
+		}
+		// Serial 0 cannot be revoked in a KRL, and it's not used by step-ca.
+		if sn, err := strconv.ParseUint(rci.Serial, 10, 64); err == nil && sn != 0 {
+			serials = append(serials, sn)
+		}
+	}
+	slices.Sort(serials)
+	serials = slices.Compact(serials)
+
+	return marshalSSHKRL(cast.Uint64(now.Unix()), now, keys, serials), nil
+}
+
+// KRL format constants, see PROTOCOL.krl in the OpenSSH sources.
+const (
+	krlMagic                 = 0x5353484b524c0a00
+	krlFormatVersion         = 1
+	krlSectionCertificates   = 1
+	krlSectionCertSerialList = 0x20
+)
+
+// marshalSSHKRL returns a KRL revoking the given certificate serials for each
+// of the CA keys.
+func marshalSSHKRL(version uint64, generatedAt time.Time, caKeys []ssh.PublicKey, serials []uint64) []byte {
+	var b bytes.Buffer
+	b.Write(binary.BigEndian.AppendUint64(nil, krlMagic))
+	b.Write(binary.BigEndian.AppendUint32(nil, krlFormatVersion))
+	b.Write(binary.BigEndian.AppendUint64(nil, version))
+	b.Write(binary.BigEndian.AppendUint64(nil, cast.Uint64(generatedAt.Unix())))
+	b.Write(binary.BigEndian.AppendUint64(nil, 0)) // flags
+	writeSSHString(&b, nil)                        // reserved
+	writeSSHString(&b, nil)                        // comment
+
+	if len(serials) == 0 {
+		return b.Bytes()
+	}
+
+	var serialList []byte
+	for _, sn := range serials {
+		serialList = binary.BigEndian.AppendUint64(serialList, sn)
+	}
+	seen := make(map[string]bool, len(caKeys))
+	for _, k := range caKeys {
+		key := k.Marshal()
+		if seen[string(key)] {
+			continue
+		}
+		seen[string(key)] = true
+
+		var section bytes.Buffer
+		writeSSHString(&section, key)
+		writeSSHString(&section, nil) // reserved
+		section.WriteByte(krlSectionCertSerialList)
+		writeSSHString(&section, serialList)
+
+		b.WriteByte(krlSectionCertificates)
+		writeSSHString(&b, section.Bytes())
+	}
+	return b.Bytes()
+}
+
+func writeSSHString(b *bytes.Buffer, s []byte) {
+	b.Write(binary.BigEndian.AppendUint32(nil, cast.Uint32(len(s))))
+	b.Write(s)
+}
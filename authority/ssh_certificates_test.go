@@ -0,0 +1,157 @@
+package authority
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/db"
+)
+
+type mockSSHCertificateIndexDB struct {
+	db.MockAuthDB
+	certs   map[string]*ssh.Certificate
+	revoked []db.RevokedCertificateInfo
+}
+
+func (m *mockSSHCertificateIndexDB) GetSSHCertificate(serial string) (*ssh.Certificate, error) {
+	return m.certs[serial], nil
+}
+
+func (m *mockSSHCertificateIndexDB) SearchSSHCertificates(filter *db.SSHCertificateFilter) ([]*db.SSHCertificateInfo, error) {
+	var infos []*db.SSHCertificateInfo
+	for _, cert := range m.certs {
+		info := db.NewSSHCertificateInfo(cert)
+		for _, rci := range m.revoked {
+			info.Revoked = info.Revoked || rci.Serial == info.Serial
+		}
+		if filter.Match(info) {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+func (m *mockSSHCertificateIndexDB) GetRevokedSSHCertificates() ([]db.RevokedCertificateInfo, error) {
+	return m.revoked, nil
+}
+
+func TestAuthority_RevokeSSHCertificates(t *testing.T) {
+	now := time.Now()
+	newCert := func(serial uint64, keyID string, validBefore time.Time, principals ...string) *ssh.Certificate {
+		return &ssh.Certificate{
+			Serial:          serial,
+			CertType:        ssh.UserCert,
+			KeyId:           keyID,
+			ValidPrincipals: principals,
+			ValidAfter:      uint64(now.Add(-time.Hour).Unix()),
+			ValidBefore:     uint64(validBefore.Unix()),
+		}
+	}
+	idb := &mockSSHCertificateIndexDB{
+		certs: map[string]*ssh.Certificate{
+			"1": newCert(1, "alice@example.com", now.Add(time.Hour), "alice"),
+			"2": newCert(2, "alice@example.com", now.Add(-time.Minute), "alice"),
+			"3": newCert(3, "bob@example.com", now.Add(time.Hour), "bob", "alice"),
+			"4": newCert(4, "carol@example.com", now.Add(time.Hour), "carol"),
+			"5": newCert(5, "alice@example.com", now.Add(time.Hour), "alice"),
+		},
+		revoked: []db.RevokedCertificateInfo{{Serial: "5"}},
+	}
+	idb.MRevokeSSH = func(rci *db.RevokedCertificateInfo) error {
+		assert.Equal(t, ocsp.KeyCompromise, rci.ReasonCode)
+		assert.Equal(t, "offboarding", rci.Reason)
+		idb.revoked = append(idb.revoked, *rci)
+		return nil
+	}
+	a := testAuthority(t, WithDatabase(idb))
+	signerKey, federatedKey := newSSHTestCAKey(t), newSSHTestCAKey(t)
+	a.sshCAUserCerts = []ssh.PublicKey{signerKey, federatedKey}
+	a.sshCASignerKeys = []ssh.PublicKey{signerKey}
+	ctx := context.Background()
+
+	_, err := a.RevokeSSHCertificates(ctx, &db.SSHCertificateFilter{}, 0, "")
+	assert.EqualError(t, err, "principal or key id are required to revoke ssh certificates")
+
+	revoked, err := a.RevokeSSHCertificates(ctx, &db.SSHCertificateFilter{Principal: "ALICE"}, ocsp.KeyCompromise, "offboarding")
+	require.NoError(t, err)
+	var serials []string
+	for _, info := range revoked {
+		assert.True(t, info.Revoked)
+		serials = append(serials, info.Serial)
+	}
+	assert.ElementsMatch(t, []string{"1", "3"}, serials)
+
+	revoked, err = a.RevokeSSHCertificates(ctx, &db.SSHCertificateFilter{KeyID: "carol@example.com"}, ocsp.KeyCompromise, "offboarding")
+	require.NoError(t, err)
+	require.Len(t, revoked, 1)
+	assert.Equal(t, "4", revoked[0].Serial)
+
+	// The revoked certificates are in the KRL.
+	krl, err := a.GetSSHKRL(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("SSHKRL\n\x00"), krl[:8])
+	for _, sn := range []uint64{1, 3, 4, 5} {
+		assert.Contains(t, string(krl), string(binary.BigEndian.AppendUint64(nil, sn)))
+	}
+	// Only the keys used to sign are in the KRL.
+	assert.Contains(t, string(krl), string(signerKey.Marshal()))
+	assert.NotContains(t, string(krl), string(federatedKey.Marshal()))
+}
+
+func newSSHTestCAKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	return key
+}
+
+func Test_marshalSSHKRL(t *testing.T) {
+	userKey := newSSHTestCAKey(t)
+	hostKey := newSSHTestCAKey(t)
+	generatedAt := time.Unix(1700000000, 0)
+
+	readString := func(b []byte) ([]byte, []byte) {
+		n := binary.BigEndian.Uint32(b)
+		return b[4 : 4+n], b[4+n:]
+	}
+
+	krl := marshalSSHKRL(42, generatedAt, []ssh.PublicKey{userKey, hostKey, userKey}, []uint64{7, 1234})
+	assert.Equal(t, uint64(krlMagic), binary.BigEndian.Uint64(krl))
+	assert.Equal(t, uint32(krlFormatVersion), binary.BigEndian.Uint32(krl[8:]))
+	assert.Equal(t, uint64(42), binary.BigEndian.Uint64(krl[12:]))
+	assert.Equal(t, uint64(1700000000), binary.BigEndian.Uint64(krl[20:]))
+	assert.Equal(t, uint64(0), binary.BigEndian.Uint64(krl[28:]))
+	rest := krl[36:]
+	_, rest = readString(rest) // reserved
+	_, rest = readString(rest) // comment
+
+	// One section per unique CA key.
+	for _, key := range []ssh.PublicKey{userKey, hostKey} {
+		require.Equal(t, byte(krlSectionCertificates), rest[0])
+		var section []byte
+		section, rest = readString(rest[1:])
+		caKey, section := readString(section)
+		assert.Equal(t, key.Marshal(), caKey)
+		_, section = readString(section) // reserved
+		require.Equal(t, byte(krlSectionCertSerialList), section[0])
+		serials, section := readString(section[1:])
+		assert.Empty(t, section)
+		assert.Equal(t, []uint64{7, 1234}, []uint64{binary.BigEndian.Uint64(serials), binary.BigEndian.Uint64(serials[8:])})
+	}
+	assert.Empty(t, rest)
+
+	// Empty KRL
+	krl = marshalSSHKRL(1, generatedAt, []ssh.PublicKey{userKey}, nil)
+	assert.Len(t, krl, 44)
+}
@@ -0,0 +1,234 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// sshHostResolver is the interface used to check the forward and reverse DNS
+// of the principals of SSH host certificates. It's implemented by
+// net.Resolver.
+type sshHostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// getSSHHostResolver returns the resolver used to verify the SSH hosts.
+func (a *Authority) getSSHHostResolver() sshHostResolver {
+	if a.sshHostResolver != nil {
+		return a.sshHostResolver
+	}
+	return net.DefaultResolver
+}
+
+// verifySSHHost verifies the identity of the host of an SSH host certificate
+// if host verification is configured. With the connect method, the host must
+// present the key being certified in the SSH port of each principal. With the
+// sshpop method, the host must sign the one-time token with the key of an
+// active host certificate for the same principals. If configured, the
+// principals must have matching forward and reverse DNS records.
+func (a *Authority) verifySSHHost(ctx context.Context, cert *ssh.Certificate, proof []byte) error {
+	if cert.CertType != ssh.HostCert || a.config.SSH == nil || a.config.SSH.HostVerification == nil {
+		return nil
+	}
+	if len(cert.ValidPrincipals) == 0 {
+		return errs.Forbidden("ssh host certificate principals cannot be empty")
+	}
+
+	cfg := a.config.SSH.HostVerification
+	ctx, cancel := context.WithTimeout(ctx, cfg.GetTimeout())
+	defer cancel()
+
+	switch cfg.Method {
+	case config.SSHHostVerifySSHPOP:
+		token, ok := provisioner.TokenFromContext(ctx)
+		if !ok {
+			return errs.InternalServer("authority.SignSSH: token is not in the context")
+		}
+		if err := a.verifySSHHostKeyProof(cert, []byte(token), proof); err != nil {
+			return errs.ForbiddenErr(err, "ssh host key proof is not valid")
+		}
+	default:
+		port := strconv.Itoa(cfg.GetPort())
+		for _, p := range cert.ValidPrincipals {
+			if err := verifySSHHostKey(ctx, net.JoinHostPort(p, port), cert.Key); err != nil {
+				return errs.ForbiddenErr(err, "ssh host %s could not be verified", p)
+			}
+		}
+	}
+
+	if cfg.DNS {
+		resolver := a.getSSHHostResolver()
+		for _, p := range cert.ValidPrincipals {
+			if err := verifySSHHostDNS(ctx, resolver, p); err != nil {
+				return errs.ForbiddenErr(err, "ssh host %s could not be verified", p)
+			}
+		}
+	}
+	return nil
+}
+
+// verifySSHHostKeyProof verifies that the proof is an SSH signature of the
+// nonce made with the key of a stored host certificate that is valid, not
+// revoked, and has all the principals of the new certificate.
+func (a *Authority) verifySSHHostKeyProof(cert *ssh.Certificate, nonce, proof []byte) error {
+	if len(proof) == 0 {
+		return errors.New("ssh host key proof is required")
+	}
+	sig := new(ssh.Signature)
+	if err := ssh.Unmarshal(proof, sig); err != nil {
+		return errors.Wrap(err, "error parsing ssh host key proof")
+	}
+
+	idb, ok := a.db.(db.SSHCertificateIndexDB)
+	if !ok {
+		return errors.New("ssh host certificates are not supported by the database")
+	}
+	infos, err := idb.SearchSSHCertificates(&db.SSHCertificateFilter{
+		Principal: cert.ValidPrincipals[0],
+		Type:      "host",
+		ValidAt:   time.Now(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "error loading ssh host certificates")
+	}
+	for _, info := range infos {
+		if info.Revoked || !hasSSHPrincipals(info.Principals, cert.ValidPrincipals) {
+			continue
+		}
+		crt, err := idb.GetSSHCertificate(info.Serial)
+		if err != nil {
+			return errors.Wrapf(err, "error loading ssh host certificate %s", info.Serial)
+		}
+		if crt.Key.Verify(nonce, sig) == nil {
+			return nil
+		}
+	}
+	return errors.New("ssh host key proof is not signed by the key of an active host certificate")
+}
+
+// hasSSHPrincipals returns true if all the wanted principals are in the list
+// of principals, ignoring the case.
+func hasSSHPrincipals(principals, wanted []string) bool {
+	for _, w := range wanted {
+		if !slices.ContainsFunc(principals, func(p string) bool {
+			return strings.EqualFold(p, w)
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// verifySSHHostKey connects to the SSH server in the given address and checks
+// that the host key it presents is the given key. The SSH handshake requires
+// the server to sign the session with the private key, so the server proves
+// the possession of the key without authenticating.
+func verifySSHHostKey(ctx context.Context, addr string, key ssh.PublicKey) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "error connecting to %s", addr)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return errors.Wrapf(err, "error connecting to %s", addr)
+		}
+	}
+
+	var hostKey ssh.PublicKey
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:              "step-ca",
+		HostKeyAlgorithms: sshHostKeyAlgorithms(key),
+		HostKeyCallback: func(_ string, _ net.Addr, k ssh.PublicKey) error {
+			hostKey = k
+			if !bytes.Equal(k.Marshal(), key.Marshal()) {
+				return errors.New("host key does not match")
+			}
+			return nil
+		},
+	})
+	if err == nil {
+		// The server does not require authentication.
+		go ssh.DiscardRequests(reqs)
+		go func() {
+			for ch := range chans {
+				_ = ch.Reject(ssh.Prohibited, "")
+			}
+		}()
+		c.Close()
+	}
+
+	switch {
+	case hostKey == nil:
+		return errors.Wrapf(err, "error getting host key from %s", addr)
+	case !bytes.Equal(hostKey.Marshal(), key.Marshal()):
+		return errors.Errorf("host key %s presented by %s does not match", ssh.FingerprintSHA256(hostKey), addr)
+	default:
+		return nil
+	}
+}
+
+// sshHostKeyAlgorithms returns the host key algorithms that can be used with
+// the given key.
+func sshHostKeyAlgorithms(key ssh.PublicKey) []string {
+	if key.Type() == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+	return []string{key.Type()}
+}
+
+// verifySSHHostDNS checks that a hostname resolves to an address that
+// resolves back to the hostname, or that an IP address resolves to a hostname
+// that resolves back to the address.
+func verifySSHHostDNS(ctx context.Context, resolver sshHostResolver, principal string) error {
+	if ip := net.ParseIP(principal); ip != nil {
+		names, err := resolver.LookupAddr(ctx, principal)
+		if err != nil {
+			return errors.Wrapf(err, "error resolving %s", principal)
+		}
+		for _, name := range names {
+			addrs, err := resolver.LookupHost(ctx, strings.TrimSuffix(name, "."))
+			if err != nil {
+				continue
+			}
+			for _, addr := range addrs {
+				if a := net.ParseIP(addr); a != nil && a.Equal(ip) {
+					return nil
+				}
+			}
+		}
+		return errors.Errorf("reverse dns of %s does not resolve back to the address", principal)
+	}
+
+	addrs, err := resolver.LookupHost(ctx, principal)
+	if err != nil {
+		return errors.Wrapf(err, "error resolving %s", principal)
+	}
+	for _, addr := range addrs {
+		names, err := resolver.LookupAddr(ctx, addr)
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			if strings.EqualFold(strings.TrimSuffix(name, "."), strings.TrimSuffix(principal, ".")) {
+				return nil
+			}
+		}
+	}
+	return errors.Errorf("addresses of %s do not resolve back to the hostname", principal)
+}
@@ -0,0 +1,250 @@
+package authority
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// startSSHTestServer starts an SSH server that presents the given host key
+// and rejects all the authentication attempts. It returns the port.
+func startSSHTestServer(t *testing.T, hostKey ssh.Signer) int {
+	t.Helper()
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, errors.New("not allowed")
+		},
+	}
+	cfg.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _, _, _ = ssh.NewServerConn(conn, cfg)
+			}()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func newSSHTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	return signer
+}
+
+type mockSSHHostResolver struct {
+	hosts map[string][]string
+	addrs map[string][]string
+}
+
+func (m *mockSSHHostResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	if addrs, ok := m.hosts[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (m *mockSSHHostResolver) LookupAddr(_ context.Context, addr string) ([]string, error) {
+	if names, ok := m.addrs[addr]; ok {
+		return names, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+}
+
+func Test_verifySSHHostKey(t *testing.T) {
+	hostKey := newSSHTestSigner(t)
+	port := startSSHTestServer(t, hostKey)
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, verifySSHHostKey(ctx, addr, hostKey.PublicKey()))
+
+	otherKey := newSSHTestSigner(t).PublicKey()
+	assert.Error(t, verifySSHHostKey(ctx, addr, otherKey))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := l.Addr().String()
+	l.Close()
+	assert.Error(t, verifySSHHostKey(ctx, closedAddr, hostKey.PublicKey()))
+}
+
+func newSSHTestHostCert(key ssh.PublicKey, serial uint64, validBefore time.Time, principals ...string) *ssh.Certificate {
+	return &ssh.Certificate{
+		Key:             key,
+		Serial:          serial,
+		CertType:        ssh.HostCert,
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(time.Now().Add(-time.Hour).Unix()),
+		ValidBefore:     uint64(validBefore.Unix()),
+	}
+}
+
+func TestAuthority_verifySSHHostKeyProof(t *testing.T) {
+	now := time.Now()
+	currentKey, revokedKey, expiredKey, newKey := newSSHTestSigner(t), newSSHTestSigner(t), newSSHTestSigner(t), newSSHTestSigner(t)
+	a := testAuthority(t, WithDatabase(&mockSSHCertificateIndexDB{
+		certs: map[string]*ssh.Certificate{
+			"1": newSSHTestHostCert(currentKey.PublicKey(), 1, now.Add(time.Hour), "db1.example.com", "db2.example.com"),
+			"2": newSSHTestHostCert(revokedKey.PublicKey(), 2, now.Add(time.Hour), "db1.example.com"),
+			"3": newSSHTestHostCert(expiredKey.PublicKey(), 3, now.Add(-time.Minute), "db1.example.com"),
+		},
+		revoked: []db.RevokedCertificateInfo{{Serial: "2"}},
+	}))
+	newProof := func(signer ssh.Signer, nonce string) []byte {
+		sig, err := signer.Sign(rand.Reader, []byte(nonce))
+		require.NoError(t, err)
+		return ssh.Marshal(sig)
+	}
+	newCert := newSSHTestHostCert(newKey.PublicKey(), 0, now.Add(time.Hour), "DB1.example.com")
+
+	tests := []struct {
+		name    string
+		cert    *ssh.Certificate
+		proof   []byte
+		wantErr string
+	}{
+		{"ok", newCert, newProof(currentKey, "token"), ""},
+		{"ok/principals", newSSHTestHostCert(newKey.PublicKey(), 0, now.Add(time.Hour), "db2.example.com", "db1.example.com"), newProof(currentKey, "token"), ""},
+		{"fail/principals", newSSHTestHostCert(newKey.PublicKey(), 0, now.Add(time.Hour), "db1.example.com", "db3.example.com"), newProof(currentKey, "token"), "ssh host key proof is not signed by the key of an active host certificate"},
+		{"fail/new key", newCert, newProof(newKey, "token"), "ssh host key proof is not signed by the key of an active host certificate"},
+		{"fail/revoked", newCert, newProof(revokedKey, "token"), "ssh host key proof is not signed by the key of an active host certificate"},
+		{"fail/expired", newCert, newProof(expiredKey, "token"), "ssh host key proof is not signed by the key of an active host certificate"},
+		{"fail/nonce", newCert, newProof(currentKey, "other"), "ssh host key proof is not signed by the key of an active host certificate"},
+		{"fail/missing", newCert, nil, "ssh host key proof is required"},
+		{"fail/parse", newCert, []byte("foo"), "error parsing ssh host key proof"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.verifySSHHostKeyProof(tt.cert, []byte("token"), tt.proof)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+
+	a = testAuthority(t)
+	assert.EqualError(t, a.verifySSHHostKeyProof(newCert, []byte("token"), newProof(currentKey, "token")),
+		"ssh host certificates are not supported by the database")
+}
+
+func Test_verifySSHHostDNS(t *testing.T) {
+	resolver := &mockSSHHostResolver{
+		hosts: map[string][]string{
+			"db1.example.com":   {"10.0.0.1"},
+			"db2.example.com":   {"10.0.0.2"},
+			"db3.example.com":   {"10.0.0.3", "10.0.0.4"},
+			"other.example.com": {"10.0.0.5"},
+		},
+		addrs: map[string][]string{
+			"10.0.0.1": {"db1.example.com."},
+			"10.0.0.2": {"web.example.com."},
+			"10.0.0.4": {"DB3.example.com."},
+			"10.0.0.5": {"other.example.com."},
+		},
+	}
+	tests := []struct {
+		principal string
+		wantErr   bool
+	}{
+		{"db1.example.com", false},
+		{"db3.example.com", false},
+		{"10.0.0.1", false},
+		{"db2.example.com", true},
+		{"missing.example.com", true},
+		{"10.0.0.2", true},
+		{"10.0.0.9", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.principal, func(t *testing.T) {
+			err := verifySSHHostDNS(context.Background(), resolver, tt.principal)
+			assert.Equal(t, tt.wantErr, err != nil, err)
+		})
+	}
+}
+
+func TestAuthority_verifySSHHost(t *testing.T) {
+	hostKey := newSSHTestSigner(t)
+	port := startSSHTestServer(t, hostKey)
+	sig, err := hostKey.Sign(rand.Reader, []byte("token"))
+	require.NoError(t, err)
+	proof := ssh.Marshal(sig)
+
+	a := testAuthority(t, WithDatabase(&mockSSHCertificateIndexDB{
+		certs: map[string]*ssh.Certificate{
+			"1": newSSHTestHostCert(hostKey.PublicKey(), 1, time.Now().Add(time.Hour), "db1.example.com"),
+		},
+	}))
+	a.sshHostResolver = &mockSSHHostResolver{
+		hosts: map[string][]string{"localhost": {"127.0.0.1"}},
+		addrs: map[string][]string{"127.0.0.1": {"localhost."}},
+	}
+	ctx := provisioner.NewContextWithToken(context.Background(), "token")
+	hostCert := func(principals ...string) *ssh.Certificate {
+		return &ssh.Certificate{Key: hostKey.PublicKey(), CertType: ssh.HostCert, ValidPrincipals: principals}
+	}
+
+	tests := []struct {
+		name    string
+		cfg     *config.SSHHostVerification
+		cert    *ssh.Certificate
+		proof   []byte
+		wantErr string
+	}{
+		{"ok/disabled", nil, hostCert("db1.example.com"), nil, ""},
+		{"ok/user", &config.SSHHostVerification{}, &ssh.Certificate{Key: hostKey.PublicKey(), CertType: ssh.UserCert}, nil, ""},
+		{"ok/connect", &config.SSHHostVerification{Port: port}, hostCert("127.0.0.1", "localhost"), nil, ""},
+		{"ok/connect dns", &config.SSHHostVerification{Method: "connect", Port: port, DNS: true}, hostCert("localhost"), proof, ""},
+		{"ok/sshpop", &config.SSHHostVerification{Method: "sshpop"}, hostCert("db1.example.com"), proof, ""},
+		{"fail/principals", &config.SSHHostVerification{}, hostCert(), proof, "ssh host certificate principals cannot be empty"},
+		{"fail/connect", &config.SSHHostVerification{Port: port}, &ssh.Certificate{Key: newSSHTestSigner(t).PublicKey(), CertType: ssh.HostCert, ValidPrincipals: []string{"127.0.0.1"}}, nil, "ssh host 127.0.0.1 could not be verified"},
+		{"fail/sshpop", &config.SSHHostVerification{Method: "sshpop"}, hostCert("db1.example.com"), nil, "ssh host key proof is not valid"},
+		{"fail/sshpop principals", &config.SSHHostVerification{Method: "sshpop"}, hostCert("db2.example.com"), proof, "ssh host key proof is not valid"},
+		{"fail/proof ignored", &config.SSHHostVerification{Port: port}, &ssh.Certificate{Key: newSSHTestSigner(t).PublicKey(), CertType: ssh.HostCert, ValidPrincipals: []string{"127.0.0.1"}}, proof, "ssh host 127.0.0.1 could not be verified"},
+		{"fail/dns", &config.SSHHostVerification{DNS: true}, hostCert("db1.example.com"), proof, "ssh host db1.example.com could not be verified"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.config.SSH = &config.SSHConfig{HostVerification: tt.cfg}
+			err := a.verifySSHHost(ctx, tt.cert, tt.proof)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var ee *errs.Error
+			require.ErrorAs(t, err, &ee)
+			assert.Equal(t, http.StatusForbidden, ee.StatusCode())
+			assert.Contains(t, ee.Message(), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package authority
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ocsp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/nosql/database"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/internal/cast"
+)
+
+// GetSSHInventoryHost returns the host with the given hostname from the SSH
+// host inventory.
+func (a *Authority) GetSSHInventoryHost(_ context.Context, hostname string) (*db.SSHHost, error) {
+	idb, err := a.getSSHHostInventoryDB()
+	if err != nil {
+		return nil, err
+	}
+	host, err := idb.GetSSHHost(hostname)
+	if err != nil {
+		if database.IsErrNotFound(err) {
+			return nil, admin.NewError(admin.ErrorNotFoundType, "ssh host %s not found", hostname)
+		}
+		return nil, admin.WrapErrorISE(err, "error loading ssh host %s", hostname)
+	}
+	return host, nil
+}
+
+// GetSSHInventoryHosts returns all the hosts in the SSH host inventory.
+func (a *Authority) GetSSHInventoryHosts(context.Context) ([]*db.SSHHost, error) {
+	idb, err := a.getSSHHostInventoryDB()
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := idb.GetSSHHosts()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading ssh hosts")
+	}
+	return hosts, nil
+}
+
+// CreateSSHInventoryHost adds a new host to the SSH host inventory.
+func (a *Authority) CreateSSHInventoryHost(_ context.Context, host *db.SSHHost) (*db.SSHHost, error) {
+	idb, err := a.getSSHHostInventoryDB()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	host.ID = uuid.NewString()
+	host.CreatedAt = now
+	host.UpdatedAt = now
+	host.DecommissionedAt = time.Time{}
+	if err := idb.CreateSSHHost(host); err != nil {
+		if errors.Is(err, db.ErrAlreadyExists) {
+			return nil, admin.NewError(admin.ErrorConflictType, "ssh host %s already exists", host.Hostname)
+		}
+		return nil, admin.WrapErrorISE(err, "error creating ssh host %s", host.Hostname)
+	}
+	return host, nil
+}
+
+// UpdateSSHInventoryHost updates the tags and groups of a host in the SSH
+// host inventory.
+func (a *Authority) UpdateSSHInventoryHost(ctx context.Context, nu *db.SSHHost) (*db.SSHHost, error) {
+	host, err := a.GetSSHInventoryHost(ctx, nu.Hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	host.Tags = nu.Tags
+	host.Groups = nu.Groups
+	host.UpdatedAt = time.Now().UTC()
+	if err := a.db.(db.SSHHostInventoryDB).UpdateSSHHost(host); err != nil {
+		return nil, admin.WrapErrorISE(err, "error updating ssh host %s", host.Hostname)
+	}
+	return host, nil
+}
+
+// RemoveSSHInventoryHost deletes a host from the SSH host inventory.
+func (a *Authority) RemoveSSHInventoryHost(ctx context.Context, hostname string) error {
+	if _, err := a.GetSSHInventoryHost(ctx, hostname); err != nil {
+		return err
+	}
+	if err := a.db.(db.SSHHostInventoryDB).DeleteSSHHost(hostname); err != nil {
+		return admin.WrapErrorISE(err, "error deleting ssh host %s", hostname)
+	}
+	return nil
+}
+
+// DecommissionSSHInventoryHost marks a host of the SSH host inventory as
+// decommissioned and revokes its active host certificates. Decommissioned
+// hosts cannot get new host certificates.
+func (a *Authority) DecommissionSSHInventoryHost(ctx context.Context, hostname, reason string) (*db.SSHHost, error) {
+	host, err := a.GetSSHInventoryHost(ctx, hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	idb := a.db.(db.SSHHostInventoryDB)
+	if !host.IsDecommissioned() {
+		now := time.Now().UTC()
+		host.DecommissionedAt = now
+		host.UpdatedAt = now
+		if err := idb.UpdateSSHHost(host); err != nil {
+			return nil, admin.WrapErrorISE(err, "error updating ssh host %s", hostname)
+		}
+	}
+
+	certs, err := idb.GetSSHHostCertificates(hostname)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading certificates of ssh host %s", hostname)
+	}
+	if reason == "" {
+		reason = "host decommissioned"
+	}
+	for _, cert := range certs {
+		rci := &db.RevokedCertificateInfo{
+			Serial:     strconv.FormatUint(cert.Serial, 10),
+			ReasonCode: ocsp.CessationOfOperation,
+			Reason:     reason,
+			RevokedAt:  time.Now().UTC(),
+			ExpiresAt:  time.Unix(cast.Int64(cert.ValidBefore), 0).UTC(),
+		}
+		if err := a.revokeSSH(cert, rci); err != nil && !errors.Is(err, db.ErrAlreadyExists) {
+			return nil, admin.WrapErrorISE(err, "error revoking certificate %s of ssh host %s", rci.Serial, hostname)
+		}
+	}
+
+	return host, nil
+}
+
+func (a *Authority) getSSHHostInventoryDB() (db.SSHHostInventoryDB, error) {
+	if idb, ok := a.db.(db.SSHHostInventoryDB); ok {
+		return idb, nil
+	}
+	return nil, admin.NewError(admin.ErrorNotImplementedType, "ssh host inventory is not supported by the database")
+}
+
+// getSSHInventoryHosts returns the hosts of the SSH host inventory that have
+// not been decommissioned. It returns nil if the database does not support
+// the inventory.
+func (a *Authority) getSSHInventoryHosts() ([]config.Host, error) {
+	idb, ok := a.db.(db.SSHHostInventoryDB)
+	if !ok {
+		return nil, nil
+	}
+	inventory, err := idb.GetSSHHosts()
+	if err != nil {
+		return nil, err
+	}
+	var hosts []config.Host
+	for _, h := range inventory {
+		if !h.IsDecommissioned() {
+			hosts = append(hosts, sshInventoryHostToConfig(h))
+		}
+	}
+	return hosts, nil
+}
+
+// getSSHInventoryTags returns the merged tags and groups of the hosts in the
+// inventory with the given hostnames. It is used to expose them to SSH host
+// certificate templates.
+func (a *Authority) getSSHInventoryTags(hostnames []string) (map[string]string, []string, error) {
+	idb, ok := a.db.(db.SSHHostInventoryDB)
+	if !ok {
+		return nil, nil, nil
+	}
+	var tags map[string]string
+	var groups []string
+	for _, hn := range hostnames {
+		host, err := idb.GetSSHHost(hn)
+		if err != nil {
+			if database.IsErrNotFound(err) {
+				continue
+			}
+			return nil, nil, err
+		}
+		if len(host.Tags) > 0 {
+			if tags == nil {
+				tags = make(map[string]string, len(host.Tags))
+			}
+			maps.Copy(tags, host.Tags)
+		}
+		for _, g := range host.Groups {
+			if !slices.Contains(groups, g) {
+				groups = append(groups, g)
+			}
+		}
+	}
+	return tags, groups, nil
+}
+
+// checkSSHHostInventory returns an error if any of the principals of the host
+// certificate is a decommissioned host.
+func (a *Authority) checkSSHHostInventory(cert *ssh.Certificate) error {
+	if cert.CertType != ssh.HostCert {
+		return nil
+	}
+	for _, p := range cert.ValidPrincipals {
+		decommissioned, err := a.isSSHHostDecommissioned(p)
+		if err != nil {
+			return errs.InternalServerErr(err, errs.WithMessage("error loading ssh host %s", p))
+		}
+		if decommissioned {
+			return errs.Forbidden("ssh host %s has been decommissioned", p)
+		}
+	}
+	return nil
+}
+
+// isSSHHostDecommissioned returns true if the host with the given hostname is
+// in the SSH host inventory and has been decommissioned.
+func (a *Authority) isSSHHostDecommissioned(hostname string) (bool, error) {
+	idb, ok := a.db.(db.SSHHostInventoryDB)
+	if !ok {
+		return false, nil
+	}
+	host, err := idb.GetSSHHost(hostname)
+	switch {
+	case database.IsErrNotFound(err):
+		return false, nil
+	case err != nil:
+		return false, err
+	default:
+		return host.IsDecommissioned(), nil
+	}
+}
+
+// sshInventoryHostToConfig converts an inventory host to the type used in the
+// ssh hosts API and the authorized principals rules.
+func sshInventoryHostToConfig(h *db.SSHHost) config.Host {
+	names := slices.Sorted(maps.Keys(h.Tags))
+	tags := make([]config.HostTag, len(names))
+	for i, name := range names {
+		tags[i] = config.HostTag{
+			ID:    h.ID + "/" + name,
+			Name:  name,
+			Value: h.Tags[name],
+		}
+	}
+	return config.Host{
+		HostID:     h.ID,
+		HostTags:   tags,
+		HostGroups: h.Groups,
+		Hostname:   strings.ToLower(h.Hostname),
+	}
+}
@@ -0,0 +1,125 @@
+package authority
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/nosql/database"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/db"
+)
+
+type mockSSHHostInventoryDB struct {
+	db.MockAuthDB
+	hosts map[string]*db.SSHHost
+	certs []*ssh.Certificate
+}
+
+func (m *mockSSHHostInventoryDB) GetSSHHost(hostname string) (*db.SSHHost, error) {
+	if h, ok := m.hosts[strings.ToLower(hostname)]; ok {
+		return h, nil
+	}
+	return nil, database.ErrNotFound
+}
+
+func (m *mockSSHHostInventoryDB) GetSSHHosts() ([]*db.SSHHost, error) {
+	var hosts []*db.SSHHost
+	for _, h := range m.hosts {
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+func (m *mockSSHHostInventoryDB) CreateSSHHost(host *db.SSHHost) error {
+	if _, ok := m.hosts[strings.ToLower(host.Hostname)]; ok {
+		return db.ErrAlreadyExists
+	}
+	m.hosts[strings.ToLower(host.Hostname)] = host
+	return nil
+}
+
+func (m *mockSSHHostInventoryDB) UpdateSSHHost(host *db.SSHHost) error {
+	m.hosts[strings.ToLower(host.Hostname)] = host
+	return nil
+}
+
+func (m *mockSSHHostInventoryDB) DeleteSSHHost(hostname string) error {
+	delete(m.hosts, strings.ToLower(hostname))
+	return nil
+}
+
+func (m *mockSSHHostInventoryDB) GetSSHHostCertificates(string) ([]*ssh.Certificate, error) {
+	return m.certs, nil
+}
+
+func TestAuthority_SSHInventoryHosts(t *testing.T) {
+	var revoked []string
+	idb := &mockSSHHostInventoryDB{
+		MockAuthDB: db.MockAuthDB{
+			MGetSSHHostPrincipals: func() ([]string, error) {
+				return []string{"db1.example.com", "web1.example.com"}, nil
+			},
+			MRevokeSSH: func(rci *db.RevokedCertificateInfo) error {
+				revoked = append(revoked, rci.Serial)
+				return nil
+			},
+		},
+		hosts: map[string]*db.SSHHost{},
+		certs: []*ssh.Certificate{
+			{Serial: 42, CertType: ssh.HostCert, ValidPrincipals: []string{"db1.example.com"}, ValidBefore: uint64(time.Now().Add(time.Hour).Unix())},
+		},
+	}
+	a := testAuthority(t, WithDatabase(idb))
+	ctx := context.Background()
+
+	host, err := a.CreateSSHInventoryHost(ctx, &db.SSHHost{
+		Hostname: "DB1.example.com",
+		Tags:     map[string]string{"role": "db", "env": "prod"},
+		Groups:   []string{"databases"},
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, host.ID)
+	assert.False(t, host.IsDecommissioned())
+
+	_, err = a.CreateSSHInventoryHost(ctx, &db.SSHHost{Hostname: "db1.example.com"})
+	assert.EqualError(t, err, "ssh host db1.example.com already exists")
+
+	hosts, err := a.GetSSHHosts(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []config.Host{
+		{HostID: host.ID, HostTags: []config.HostTag{
+			{ID: host.ID + "/env", Name: "env", Value: "prod"},
+			{ID: host.ID + "/role", Name: "role", Value: "db"},
+		}, HostGroups: []string{"databases"}, Hostname: "db1.example.com"},
+		{Hostname: "web1.example.com"},
+	}, hosts)
+
+	tags, groups, err := a.getSSHInventoryTags([]string{"db1.example.com", "10.0.0.1"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"role": "db", "env": "prod"}, tags)
+	assert.Equal(t, []string{"databases"}, groups)
+
+	host, err = a.DecommissionSSHInventoryHost(ctx, "db1.example.com", "")
+	require.NoError(t, err)
+	assert.True(t, host.IsDecommissioned())
+	assert.Equal(t, []string{"42"}, revoked)
+
+	hosts, err = a.GetSSHHosts(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []config.Host{{Hostname: "web1.example.com"}}, hosts)
+
+	err = a.checkSSHHostInventory(&ssh.Certificate{CertType: ssh.HostCert, ValidPrincipals: []string{"web1.example.com", "db1.example.com"}})
+	assert.EqualError(t, err, "ssh host db1.example.com has been decommissioned")
+	assert.NoError(t, a.checkSSHHostInventory(&ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"db1.example.com"}}))
+
+	require.NoError(t, a.RemoveSSHInventoryHost(ctx, "db1.example.com"))
+	_, err = a.GetSSHInventoryHost(ctx, "db1.example.com")
+	assert.EqualError(t, err, "ssh host db1.example.com not found")
+}
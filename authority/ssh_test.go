@@ -9,6 +9,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"math/big"
 	"net/http"
 	"reflect"
 	"testing"
@@ -20,6 +21,7 @@ import (
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
@@ -135,6 +137,76 @@ func TestAuthority_initUserOnly(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestAuthority_initSigningKeys(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	auth := testAuthority(t, func(a *Authority) error {
+		a.config.SSH.SigningKeys = []*config.SSHSigningKey{
+			{Type: "host", Key: "testdata/secrets/ssh_user_ca_key", ActiveFrom: &past},
+			{Type: "user", Key: "testdata/secrets/ssh_host_ca_key", ActiveFrom: &future},
+		}
+		return nil
+	})
+
+	hostKey := auth.sshCAHostCertSignKey.PublicKey()
+	userKey := auth.sshCAUserCertSignKey.PublicKey()
+
+	// All signing keys are trusted and published.
+	keys, err := auth.GetSSHRoots(context.Background())
+	assert.NoError(t, err)
+	assert.Equals(t, []ssh.PublicKey{hostKey, userKey}, keys.HostKeys)
+	assert.Equals(t, []ssh.PublicKey{userKey, hostKey}, keys.UserKeys)
+	keys, err = auth.GetSSHFederation(context.Background())
+	assert.NoError(t, err)
+	assert.Equals(t, []ssh.PublicKey{hostKey, userKey}, keys.HostKeys)
+	assert.Equals(t, []ssh.PublicKey{userKey, hostKey}, keys.UserKeys)
+
+	// The designated signer depends on the activation time.
+	assert.Equals(t, userKey, auth.getSSHSigner(ssh.HostCert, now).PublicKey())
+	assert.Equals(t, userKey, auth.getSSHSigner(ssh.UserCert, now).PublicKey())
+	assert.Equals(t, hostKey, auth.getSSHSigner(ssh.UserCert, future).PublicKey())
+	assert.Nil(t, auth.getSSHSigner(0, now))
+}
+
+func TestAuthority_getSSHSigner(t *testing.T) {
+	newSigner := func() ssh.Signer {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.FatalError(t, err)
+		signer, err := ssh.NewSignerFromSigner(key)
+		assert.FatalError(t, err)
+		return signer
+	}
+	now := time.Now()
+	base, old, current, next := newSigner(), newSigner(), newSigner(), newSigner()
+
+	var keys []sshSigningKey
+	keys = addSSHSigningKey(keys, next, now.Add(time.Hour))
+	keys = addSSHSigningKey(keys, old, now.Add(-2*time.Hour))
+	keys = addSSHSigningKey(keys, current, now.Add(-time.Hour))
+
+	tests := []struct {
+		name     string
+		auth     *Authority
+		certType uint32
+		now      time.Time
+		want     ssh.Signer
+	}{
+		{"ok/user", &Authority{sshCAUserCertSignKey: base}, ssh.UserCert, now, base},
+		{"ok/host", &Authority{sshCAHostCertSignKey: base}, ssh.HostCert, now, base},
+		{"ok/before", &Authority{sshCAHostCertSignKey: base, sshCAHostSigningKeys: keys}, ssh.HostCert, now.Add(-3 * time.Hour), base},
+		{"ok/old", &Authority{sshCAHostCertSignKey: base, sshCAHostSigningKeys: keys}, ssh.HostCert, now.Add(-90 * time.Minute), old},
+		{"ok/current", &Authority{sshCAHostCertSignKey: base, sshCAHostSigningKeys: keys}, ssh.HostCert, now, current},
+		{"ok/next", &Authority{sshCAUserCertSignKey: base, sshCAUserSigningKeys: keys}, ssh.UserCert, now.Add(time.Hour), next},
+		{"disabled", &Authority{sshCAUserCertSignKey: base, sshCAUserSigningKeys: keys}, ssh.HostCert, now, nil},
+		{"badType", &Authority{sshCAUserCertSignKey: base}, 0, now, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, tt.auth.getSSHSigner(tt.certType, tt.now))
+		})
+	}
+}
+
 func TestAuthority_SignSSH(t *testing.T) {
 	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	assert.FatalError(t, err)
@@ -879,6 +951,206 @@ func TestAuthority_GetSSHHosts(t *testing.T) {
 	}
 }
 
+func TestAuthority_GetSSHAuthorizedPrincipals(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	otherSigner, err := ssh.NewSignerFromKey(otherKey)
+	assert.FatalError(t, err)
+
+	rules := []*config.SSHPrincipalsRule{
+		{Principals: []string{"%u"}},
+		{HostTags: map[string]string{"role": "db"}, Users: []string{"postgres"}, Principals: []string{"dba"}},
+	}
+	newCert := func(t *testing.T, a *Authority, certType uint32, signer ssh.Signer) *ssh.Certificate {
+		cert := &ssh.Certificate{
+			Key:             pub,
+			Serial:          1234,
+			CertType:        certType,
+			KeyId:           "alice@example.com",
+			ValidPrincipals: []string{"alice", "postgres", "dba"},
+			ValidAfter:      uint64(time.Now().Add(-time.Minute).Unix()),
+			ValidBefore:     uint64(time.Now().Add(time.Hour).Unix()),
+		}
+		if signer == nil {
+			signer = a.sshCAUserCertSignKey
+		}
+		assert.FatalError(t, cert.SignCert(rand.Reader, signer))
+		return cert
+	}
+	getHosts := func(ctx context.Context, cert *x509.Certificate) ([]config.Host, error) {
+		return []config.Host{
+			{Hostname: "db1.example.com", HostTags: []config.HostTag{{Name: "role", Value: "db"}}},
+			{Hostname: "web1.example.com", HostTags: []config.HostTag{{Name: "role", Value: "web"}}},
+		}, nil
+	}
+
+	newHostCert := func(t *testing.T, a *Authority, name string, serial int64) *x509.Certificate {
+		return generateCertificate(t, "db1.example.com", []string{"db1.example.com"},
+			withProvisionerOID(name, a.config.AuthorityConfig.Provisioners[0].(*provisioner.JWK).Key.KeyID),
+			provisioner.CertificateModifierFunc(func(crt *x509.Certificate, _ provisioner.SignOptions) error {
+				crt.SerialNumber = big.NewInt(serial)
+				return nil
+			}),
+			withSigner(getDefaultIssuer(a), getDefaultSigner(a)))
+	}
+
+	type test struct {
+		auth      *Authority
+		hostnames []string
+		hostCert  *x509.Certificate
+		user      string
+		cert      *ssh.Certificate
+		want      []string
+		code      int
+	}
+	tests := map[string]func(t *testing.T) *test{
+		"ok/client-certificate": func(t *testing.T) *test {
+			a := testAuthority(t)
+			a.config.SSH.AuthorizedPrincipals = rules
+			a.config.SSH.AuthorizedPrincipalsProvisioner = "Max"
+			a.sshGetHostsFunc = getHosts
+			return &test{auth: a, hostnames: []string{"db1.example.com"}, hostCert: newHostCert(t, a, "Max", 1), user: "postgres", cert: newCert(t, a, ssh.UserCert, nil), want: []string{"postgres", "dba"}}
+		},
+		"fail/client-certificate-not-allowed": func(t *testing.T) *test {
+			a := testAuthority(t)
+			a.config.SSH.AuthorizedPrincipals = rules
+			return &test{auth: a, hostnames: []string{"db1.example.com"}, hostCert: newHostCert(t, a, "Max", 1), user: "postgres", cert: newCert(t, a, ssh.UserCert, nil), code: http.StatusUnauthorized}
+		},
+		"fail/client-certificate-provisioner": func(t *testing.T) *test {
+			a := testAuthority(t)
+			a.config.SSH.AuthorizedPrincipals = rules
+			a.config.SSH.AuthorizedPrincipalsProvisioner = "dev"
+			return &test{auth: a, hostnames: []string{"db1.example.com"}, hostCert: newHostCert(t, a, "Max", 1), user: "postgres", cert: newCert(t, a, ssh.UserCert, nil), code: http.StatusUnauthorized}
+		},
+		"fail/client-certificate-revoked": func(t *testing.T) *test {
+			a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+				MIsRevoked: func(sn string) (bool, error) {
+					return sn == "1234", nil
+				},
+			}))
+			a.config.SSH.AuthorizedPrincipals = rules
+			a.config.SSH.AuthorizedPrincipalsProvisioner = "Max"
+			return &test{auth: a, hostnames: []string{"db1.example.com"}, hostCert: newHostCert(t, a, "Max", 1234), user: "postgres", cert: newCert(t, a, ssh.UserCert, nil), code: http.StatusUnauthorized}
+		},
+		"ok/user": func(t *testing.T) *test {
+			a := testAuthority(t)
+			a.config.SSH.AuthorizedPrincipals = rules
+			a.sshGetHostsFunc = getHosts
+			return &test{auth: a, hostnames: []string{"web1.example.com"}, user: "alice", cert: newCert(t, a, ssh.UserCert, nil), want: []string{"alice"}}
+		},
+		"ok/tags": func(t *testing.T) *test {
+			a := testAuthority(t)
+			a.config.SSH.AuthorizedPrincipals = rules
+			a.sshGetHostsFunc = getHosts
+			return &test{auth: a, hostnames: []string{"db1.example.com"}, user: "postgres", cert: newCert(t, a, ssh.UserCert, nil), want: []string{"postgres", "dba"}}
+		},
+		"ok/none": func(t *testing.T) *test {
+			a := testAuthority(t)
+			a.config.SSH.AuthorizedPrincipals = rules
+			a.sshGetHostsFunc = getHosts
+			return &test{auth: a, hostnames: []string{"web1.example.com"}, user: "root", cert: newCert(t, a, ssh.UserCert, nil), want: []string{}}
+		},
+		"fail/not-configured": func(t *testing.T) *test {
+			a := testAuthority(t)
+			return &test{auth: a, hostnames: []string{"web1.example.com"}, user: "alice", cert: newCert(t, a, ssh.UserCert, nil), code: http.StatusNotFound}
+		},
+		"fail/host-cert": func(t *testing.T) *test {
+			a := testAuthority(t)
+			a.config.SSH.AuthorizedPrincipals = rules
+			return &test{auth: a, hostnames: []string{"web1.example.com"}, user: "alice", cert: newCert(t, a, ssh.HostCert, nil), code: http.StatusBadRequest}
+		},
+		"fail/untrusted": func(t *testing.T) *test {
+			a := testAuthority(t)
+			a.config.SSH.AuthorizedPrincipals = rules
+			return &test{auth: a, hostnames: []string{"web1.example.com"}, user: "alice", cert: newCert(t, a, ssh.UserCert, otherSigner), code: http.StatusUnauthorized}
+		},
+		"fail/revoked": func(t *testing.T) *test {
+			a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+				MIsSSHRevoked: func(sn string) (bool, error) {
+					return sn == "1234", nil
+				},
+			}))
+			a.config.SSH.AuthorizedPrincipals = rules
+			return &test{auth: a, hostnames: []string{"web1.example.com"}, user: "alice", cert: newCert(t, a, ssh.UserCert, nil), code: http.StatusUnauthorized}
+		},
+		"fail/getHosts": func(t *testing.T) *test {
+			a := testAuthority(t)
+			a.config.SSH.AuthorizedPrincipals = rules
+			a.sshGetHostsFunc = func(context.Context, *x509.Certificate) ([]config.Host, error) {
+				return nil, errors.New("force")
+			}
+			return &test{auth: a, hostnames: []string{"web1.example.com"}, user: "alice", cert: newCert(t, a, ssh.UserCert, nil), code: http.StatusInternalServerError}
+		},
+	}
+	for name, genTestCase := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc := genTestCase(t)
+			got, err := tc.auth.GetSSHAuthorizedPrincipals(context.Background(), tc.hostnames, tc.hostCert, tc.user, tc.cert)
+			if tc.code != 0 {
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+					assert.Equals(t, tc.code, sc.StatusCode())
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equals(t, tc.want, got)
+		})
+	}
+}
+
+func TestAuthority_RenewSSH(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+
+	now := time.Now()
+	newCert := func(extensions map[string]string) *ssh.Certificate {
+		return &ssh.Certificate{
+			Key:             pub,
+			Serial:          1234,
+			ValidAfter:      uint64(now.Add(-time.Hour).Unix()),
+			ValidBefore:     uint64(now.Add(time.Hour).Unix()),
+			CertType:        ssh.HostCert,
+			ValidPrincipals: []string{"foo.internal"},
+			KeyId:           "foo.internal",
+			Permissions:     ssh.Permissions{Extensions: extensions},
+		}
+	}
+
+	a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+		MIsSSHRevoked: func(sn string) (bool, error) {
+			return false, nil
+		},
+	}))
+	engine, err := policy.New(new(policy.Options).WithSSHOptionsPolicy(&policy.SSHOptionsPolicy{
+		Host: &policy.SSHCertificateOptionsPolicy{
+			Extensions: &policy.SSHExtensionOptions{Deny: []string{"permit-pty"}},
+		},
+	}))
+	assert.FatalError(t, err)
+	a.policyEngine = engine
+
+	t.Run("ok", func(t *testing.T) {
+		cert, err := a.RenewSSH(context.Background(), newCert(nil))
+		assert.FatalError(t, err)
+		assert.Equals(t, []string{"foo.internal"}, cert.ValidPrincipals)
+	})
+
+	t.Run("fail/ssh-options-policy", func(t *testing.T) {
+		_, err := a.RenewSSH(context.Background(), newCert(map[string]string{"permit-pty": ""}))
+		var sc render.StatusCodedError
+		if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+			assert.Equals(t, http.StatusForbidden, sc.StatusCode())
+		}
+	})
+}
+
 func TestAuthority_RekeySSH(t *testing.T) {
 	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	assert.FatalError(t, err)
@@ -1048,6 +1320,41 @@ func TestAuthority_RekeySSH(t *testing.T) {
 				code:       http.StatusInternalServerError,
 			}
 		},
+		"fail/ssh-options-policy": func(t *testing.T) *test {
+			auth := testAuthority(t, WithDatabase(&db.MockAuthDB{
+				MIsSSHRevoked: func(sn string) (bool, error) {
+					return false, nil
+				},
+			}))
+			engines, err := newSSHOptionsPolicyEngines(map[string]*policy.SSHOptionsPolicy{
+				"sshpop-id": {
+					User: &policy.SSHCertificateOptionsPolicy{
+						Extensions: &policy.SSHExtensionOptions{Deny: []string{"permit-port-forwarding"}},
+					},
+				},
+			})
+			assert.FatalError(t, err)
+			auth.sshOptionsPolicyEngines = engines
+			return &test{
+				auth:       auth,
+				userSigner: signer,
+				hostSigner: nil,
+				cert: &ssh.Certificate{
+					ValidAfter:      uint64(now.Unix()),
+					ValidBefore:     uint64(now.Add(time.Hour).Unix()),
+					CertType:        ssh.UserCert,
+					ValidPrincipals: []string{"foo"},
+					KeyId:           "foo",
+					Permissions: ssh.Permissions{
+						Extensions: map[string]string{"permit-port-forwarding": ""},
+					},
+				},
+				key:      pub,
+				signOpts: []provisioner.SignOption{&provisioner.SSHPOP{ID: "sshpop-id"}},
+				err:      errors.New(`extension "permit-port-forwarding" not allowed`),
+				code:     http.StatusForbidden,
+			}
+		},
 		"ok": func(t *testing.T) *test {
 			va1 := now.Add(-24 * time.Hour)
 			vb1 := now.Add(-23 * time.Hour)
@@ -1086,8 +1393,8 @@ func TestAuthority_RekeySSH(t *testing.T) {
 			if auth == nil {
 				auth = a
 			}
-			a.sshCAUserCertSignKey = tc.userSigner
-			a.sshCAHostCertSignKey = tc.hostSigner
+			auth.sshCAUserCertSignKey = tc.userSigner
+			auth.sshCAHostCertSignKey = tc.hostSigner
 
 			cert, err := auth.RekeySSH(context.Background(), tc.cert, tc.key, tc.signOpts...)
 			if err != nil {
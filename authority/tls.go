@@ -14,6 +14,7 @@ import (
 	"math/big"
 	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -47,6 +48,21 @@ func TokenFromContext(ctx context.Context) (token string, ok bool) {
 	return
 }
 
+type certificateRequestKey struct{}
+
+// NewCertificateRequestContext adds the certificate request used to rekey a
+// certificate to the context.
+func NewCertificateRequestContext(ctx context.Context, csr *x509.CertificateRequest) context.Context {
+	return context.WithValue(ctx, certificateRequestKey{}, csr)
+}
+
+// CertificateRequestFromContext returns the certificate request from the given
+// context.
+func CertificateRequestFromContext(ctx context.Context) (csr *x509.CertificateRequest, ok bool) {
+	csr, ok = ctx.Value(certificateRequestKey{}).(*x509.CertificateRequest)
+	return
+}
+
 // GetTLSOptions returns the tls options configured.
 func (a *Authority) GetTLSOptions() *config.TLSOptions {
 	return a.config.TLS
@@ -145,6 +161,7 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		prov       provisioner.Interface
 		pInfo      *casapi.ProvisionerInfo
 		attData    *provisioner.AttestationData
+		account    *provisioner.ACMEAccountData
 		webhookCtl webhookController
 	)
 	for _, op := range extraOpts {
@@ -186,6 +203,10 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		case provisioner.AttestationData:
 			attData = &k
 
+		// The ACME account of the order.
+		case provisioner.ACMEAccountData:
+			account = &k
+
 		// Capture the provisioner's webhook controller
 		case webhookController:
 			webhookCtl = k
@@ -288,6 +309,19 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		)
 	}
 
+	// Check if the certificate satisfies the CEL policies
+	if err = a.areX509RulesSatisfied(leaf, csr, prov, webhookCtl, attData, account); err != nil {
+		var ee *errs.Error
+		if errors.As(err, &ee) {
+			return nil, prov, errs.ApplyOptions(ee, opts...)
+		}
+		return nil, prov, errs.InternalServerErr(err,
+			errs.WithKeyVal("csr", csr),
+			errs.WithKeyVal("signOptions", signOpts),
+			errs.WithMessage("error creating certificate"),
+		)
+	}
+
 	// Send certificate to webhooks for authorization
 	if err := a.callAuthorizingWebhooksX509(ctx, prov, webhookCtl, crt, leaf, attData); err != nil {
 		return nil, prov, errs.ApplyOptions(
@@ -296,10 +330,11 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		)
 	}
 
-	// Sign certificate
+	// Sign certificate using the CAS of the provisioner
 	lifetime := leaf.NotAfter.Sub(leaf.NotBefore.Add(signOpts.Backdate))
 
-	resp, err := a.x509CAService.CreateCertificate(&casapi.CreateCertificateRequest{
+	_, casService := a.getX509CAService(nil, prov)
+	resp, err := casService.CreateCertificate(&casapi.CreateCertificateRequest{
 		Template:    leaf,
 		CSR:         csr,
 		Lifetime:    lifetime,
@@ -475,13 +510,37 @@ func (a *Authority) renewContext(ctx context.Context, oldCert *x509.Certificate,
 	// mode, this can be used to renew a certificate.
 	token, _ := TokenFromContext(ctx)
 
-	resp, err := a.x509CAService.RenewCertificate(&casapi.RenewCertificateRequest{
-		Template: newCert,
-		Lifetime: lifetime,
-		Backdate: backdate,
-		Token:    token,
+	// The certificate request signed by the new key can optionally be in the
+	// context on rekey operations. Some CAS, like AWS Private CA, require it.
+	var csr *x509.CertificateRequest
+	if isRekey {
+		csr, _ = CertificateRequestFromContext(ctx)
+	}
+
+	var pInfo *casapi.ProvisionerInfo
+	if prov != nil {
+		pInfo = &casapi.ProvisionerInfo{
+			ID:   prov.GetID(),
+			Type: prov.GetType().String(),
+			Name: prov.GetName(),
+		}
+	}
+
+	// Renew using the CAS that issued the certificate.
+	_, casService := a.getX509CAService(oldCert, prov)
+	resp, err := casService.RenewCertificate(&casapi.RenewCertificateRequest{
+		Template:    newCert,
+		Lifetime:    lifetime,
+		Backdate:    backdate,
+		Token:       token,
+		CSR:         csr,
+		Provisioner: pInfo,
 	})
 	if err != nil {
+		var nie casapi.NotImplementedError
+		if errors.As(err, &nie) {
+			return nil, prov, errs.StatusCodeError(http.StatusNotImplemented, err, opts...)
+		}
 		return nil, prov, errs.StatusCodeError(http.StatusInternalServerError, err, opts...)
 	}
 
@@ -682,9 +741,18 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 			revokedCert, _ = a.db.GetCertificate(rci.Serial)
 		}
 
+		// Select the CAS that issued the certificate, or the one used by the
+		// provisioner if the certificate is not available.
+		var revokeProv provisioner.Interface
+		if rci.ProvisionerID != "" {
+			revokeProv, _ = a.LoadProvisionerByID(rci.ProvisionerID)
+		}
+		var casService casapi.CertificateAuthorityService
+		rci.Issuer, casService = a.getX509CAService(revokedCert, revokeProv)
+
 		// CAS operation, note that SoftCAS (default) is a noop.
 		// The revoke happens when this is stored in the db.
-		_, err := a.x509CAService.RevokeCertificate(&casapi.RevokeCertificateRequest{
+		_, err := casService.RevokeCertificate(&casapi.RevokeCertificateRequest{
 			Certificate:  revokedCert,
 			SerialNumber: rci.Serial,
 			Reason:       rci.Reason,
@@ -791,12 +859,121 @@ func (a *Authority) GenerateCertificateRevocationList() error {
 		return errors.Wrap(err, "could not retrieve CRL from database")
 	}
 
-	now := time.Now().Truncate(time.Second).UTC()
 	revokedList, err := crlDB.GetRevokedCertificates()
 	if err != nil {
 		return errors.Wrap(err, "could not retrieve revoked certificates list from database")
 	}
 
+	// Set CRL IDP to config item, otherwise, leave as default
+	var fullName string
+	if a.config.CRL.IDPurl != "" {
+		fullName = a.config.CRL.IDPurl
+	} else {
+		fullName = a.config.Audience("/1.0/crl")[0]
+	}
+
+	newCRLInfo, err := a.createCRL(caCRLGenerator, crlInfo, *revokedList, "", nil, fullName)
+	if err != nil {
+		return err
+	}
+
+	// Store the CRL in the database ready for retrieval by api endpoints
+	err = crlDB.StoreCRL(newCRLInfo)
+	if err != nil {
+		return errors.Wrap(err, "could not store CRL in database")
+	}
+
+	if err := a.generateRetiredIssuerCRL(caCRLGenerator, *revokedList); err != nil {
+		return err
+	}
+
+	return a.generateIssuerCRLs(*revokedList)
+}
+
+// generateRetiredIssuerCRL generates and stores the CRL of the intermediate
+// replaced by a rotation, signed with its own key, so the certificates issued
+// before the rotation can still be checked. The CRL is named after the
+// fingerprint of the retired intermediate, and it is generated until the
+// retired intermediate expires, as none of its certificates are valid after
+// that.
+func (a *Authority) generateRetiredIssuerCRL(caCRLGenerator casapi.CertificateAuthorityCRLGenerator, revokedList []db.RevokedCertificateInfo) error {
+	retired := a.getRetiredIntermediate(time.Now())
+	if retired == nil {
+		return nil
+	}
+
+	crlDB, ok := a.db.(db.IssuerCertificateRevocationListDB)
+	if !ok {
+		return errors.Errorf("Database does not support CRL generation of multiple certificate authorities")
+	}
+
+	name := x509util.Fingerprint(retired)
+	crlInfo, err := crlDB.GetIssuerCRL(name)
+	if err != nil && !database.IsErrNotFound(err) {
+		return errors.Wrap(err, "could not retrieve CRL of the retired intermediate from database")
+	}
+
+	newCRLInfo, err := a.createCRL(caCRLGenerator, crlInfo, revokedList, "", retired, a.getIssuerCRLURL(name))
+	if err != nil {
+		return errors.Wrap(err, "could not create CRL of the retired intermediate")
+	}
+	if err := crlDB.StoreIssuerCRL(name, newCRLInfo); err != nil {
+		return errors.Wrap(err, "could not store CRL of the retired intermediate in database")
+	}
+	return nil
+}
+
+// getIssuerCRLURL returns the URL of the CRL of the named issuer.
+func (a *Authority) getIssuerCRLURL(name string) string {
+	if a.config.CRL.IDPurl != "" {
+		return strings.TrimSuffix(a.config.CRL.IDPurl, "/") + "/" + url.PathEscape(name)
+	}
+	return a.config.Audience("/1.0/crl/" + url.PathEscape(name))[0]
+}
+
+// generateIssuerCRLs generates and stores the CRLs of the named certificate
+// authorities that support CRL generation.
+func (a *Authority) generateIssuerCRLs(revokedList []db.RevokedCertificateInfo) error {
+	if len(a.x509Issuers) == 0 {
+		return nil
+	}
+
+	crlDB, ok := a.db.(db.IssuerCertificateRevocationListDB)
+	if !ok {
+		return errors.Errorf("Database does not support CRL generation of multiple certificate authorities")
+	}
+
+	for _, iss := range a.x509Issuers {
+		caCRLGenerator, ok := iss.service.(casapi.CertificateAuthorityCRLGenerator)
+		if !ok {
+			continue
+		}
+
+		crlInfo, err := crlDB.GetIssuerCRL(iss.name)
+		if err != nil && !database.IsErrNotFound(err) {
+			return errors.Wrapf(err, "could not retrieve CRL of %s from database", iss.name)
+		}
+
+		newCRLInfo, err := a.createCRL(caCRLGenerator, crlInfo, revokedList, iss.name, nil, a.getIssuerCRLURL(iss.name))
+		if err != nil {
+			return errors.Wrapf(err, "could not create CRL of %s", iss.name)
+		}
+		if err := crlDB.StoreIssuerCRL(iss.name, newCRLInfo); err != nil {
+			return errors.Wrapf(err, "could not store CRL of %s in database", iss.name)
+		}
+	}
+
+	return nil
+}
+
+// createCRL signs a new CRL with the revoked certificates of the given issuer
+// using the given CRL generator. The default issuer has an empty name, and it
+// also includes the certificates revoked by issuers no longer configured. The
+// issuer certificate selects the key of the CRL generator signing the CRL,
+// and it is nil to use the current one.
+func (a *Authority) createCRL(caCRLGenerator casapi.CertificateAuthorityCRLGenerator, crlInfo *db.CertificateRevocationListInfo, revokedList []db.RevokedCertificateInfo, issuer string, issuerCert *x509.Certificate, fullName string) (*db.CertificateRevocationListInfo, error) {
+	now := time.Now().Truncate(time.Second).UTC()
+
 	// Number is a monotonically increasing integer (essentially the CRL version
 	// number) that we need to keep track of and increase every time we generate
 	// a new CRL
@@ -809,12 +986,21 @@ func (a *Authority) GenerateCertificateRevocationList() error {
 	// representation ready for the CAS to sign it
 	var revokedCertificateEntries []x509.RevocationListEntry
 	skipExpiredTime := now.Add(-config.DefaultCRLExpiredDuration)
-	for _, revokedCert := range *revokedList {
+	for _, revokedCert := range revokedList {
 		// skip expired certificates
 		if !revokedCert.ExpiresAt.IsZero() && revokedCert.ExpiresAt.Before(skipExpiredTime) {
 			continue
 		}
 
+		// skip certificates of other issuers
+		if issuer == "" {
+			if revokedCert.Issuer != "" && a.getX509Issuer(revokedCert.Issuer) != nil {
+				continue
+			}
+		} else if revokedCert.Issuer != issuer {
+			continue
+		}
+
 		var sn big.Int
 		sn.SetString(revokedCert.Serial, 10)
 		revokedCertificateEntries = append(revokedCertificateEntries, x509.RevocationListEntry{
@@ -841,14 +1027,6 @@ func (a *Authority) GenerateCertificateRevocationList() error {
 		NextUpdate:                now.Add(updateDuration),
 	}
 
-	// Set CRL IDP to config item, otherwise, leave as default
-	var fullName string
-	if a.config.CRL.IDPurl != "" {
-		fullName = a.config.CRL.IDPurl
-	} else {
-		fullName = a.config.Audience("/1.0/crl")[0]
-	}
-
 	// Add distribution point.
 	//
 	// Note that this is currently using the port 443 by default.
@@ -858,27 +1036,22 @@ func (a *Authority) GenerateCertificateRevocationList() error {
 		}
 	}
 
-	certificateRevocationList, err := caCRLGenerator.CreateCRL(&casapi.CreateCRLRequest{RevocationList: &revocationList})
+	certificateRevocationList, err := caCRLGenerator.CreateCRL(&casapi.CreateCRLRequest{
+		RevocationList: &revocationList,
+		Issuer:         issuerCert,
+	})
 	if err != nil {
-		return errors.Wrap(err, "could not create CRL")
+		return nil, errors.Wrap(err, "could not create CRL")
 	}
 
 	// Create a new db.CertificateRevocationListInfo, which stores the new Number we just generated, the
 	// expiry time, duration, and the DER-encoded CRL
-	newCRLInfo := db.CertificateRevocationListInfo{
+	return &db.CertificateRevocationListInfo{
 		Number:    bn.Int64(),
 		ExpiresAt: revocationList.NextUpdate,
 		DER:       certificateRevocationList.CRL,
 		Duration:  updateDuration,
-	}
-
-	// Store the CRL in the database ready for retrieval by api endpoints
-	err = crlDB.StoreCRL(&newCRLInfo)
-	if err != nil {
-		return errors.Wrap(err, "could not store CRL in database")
-	}
-
-	return nil
+	}, nil
 }
 
 // GetTLSCertificate creates a new leaf certificate to be used by the CA HTTPS server.
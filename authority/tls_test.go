@@ -2151,6 +2151,53 @@ func (notImplementedCAS) RevokeCertificate(req *apiv1.RevokeCertificateRequest)
 	return nil, apiv1.NotImplementedError{}
 }
 
+// renewRequestCAS records the renew requests sent to the wrapped CAS.
+type renewRequestCAS struct {
+	apiv1.CertificateAuthorityService
+	req *apiv1.RenewCertificateRequest
+}
+
+func (m *renewRequestCAS) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
+	m.req = req
+	return m.CertificateAuthorityService.RenewCertificate(req)
+}
+
+func TestAuthority_RenewContext_certificateRequest(t *testing.T) {
+	a := testAuthority(t)
+	now := time.Now().UTC()
+	cert := generateCertificate(t, "renew", []string{"test.smallstep.com"},
+		withNotBeforeNotAfter(now.Add(-time.Minute), now.Add(time.Hour)),
+		withProvisionerOID("Max", a.config.AuthorityConfig.Provisioners[0].(*provisioner.JWK).Key.KeyID),
+		withSigner(getDefaultIssuer(a), getDefaultSigner(a)))
+
+	cas := &renewRequestCAS{CertificateAuthorityService: a.x509CAService}
+	a.x509CAService = cas
+
+	key, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	csr, err := x509util.CreateCertificateRequest("renew", []string{"test.smallstep.com"}, key)
+	require.NoError(t, err)
+	ctx := NewCertificateRequestContext(context.Background(), csr)
+
+	// The certificate request is only sent on rekey operations.
+	_, err = a.RenewContext(ctx, cert, csr.PublicKey)
+	require.NoError(t, err)
+	assert.Equal(t, csr, cas.req.CSR)
+
+	_, err = a.RenewContext(ctx, cert, nil)
+	require.NoError(t, err)
+	assert.Nil(t, cas.req.CSR)
+	require.NotNil(t, cas.req.Provisioner)
+	assert.Equal(t, "Max", cas.req.Provisioner.Name)
+
+	// CAS that cannot renew return a NotImplemented error.
+	a.x509CAService = notImplementedCAS{}
+	_, err = a.RenewContext(ctx, cert, nil)
+	var sc render.StatusCodedError
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusNotImplemented, sc.StatusCode())
+}
+
 func TestAuthority_GetX509Signer(t *testing.T) {
 	auth := testAuthority(t)
 	require.IsType(t, &softcas.SoftCAS{}, auth.x509CAService)
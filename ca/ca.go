@@ -13,6 +13,7 @@ import (
 	"net/url"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/coreos/go-systemd/v22/daemon"
@@ -27,13 +28,18 @@ import (
 	"github.com/smallstep/certificates/acme"
 	acmeAPI "github.com/smallstep/certificates/acme/api"
 	acmeNoSQL "github.com/smallstep/certificates/acme/db/nosql"
+	"github.com/smallstep/certificates/acme/perspective"
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/admin"
 	adminAPI "github.com/smallstep/certificates/authority/admin/api"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/cmp"
+	cmpAPI "github.com/smallstep/certificates/cmp/api"
 	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/est"
+	estAPI "github.com/smallstep/certificates/est/api"
 	"github.com/smallstep/certificates/internal/httptransport"
 	"github.com/smallstep/certificates/internal/metrix"
 	"github.com/smallstep/certificates/logging"
@@ -145,6 +151,9 @@ func WithQuiet(quiet bool) Option {
 // CA is the type used to build the complete certificate authority. It builds
 // the HTTP server, set ups the middlewares and the HTTP handlers.
 type CA struct {
+	// authMu synchronizes the background jobs using auth with the
+	// replacement of auth on Reload.
+	authMu      sync.RWMutex
 	auth        *authority.Authority
 	config      *config.Config
 	srv         *server.Server
@@ -153,6 +162,10 @@ type CA struct {
 	opts        *options
 	renewer     *TLSRenewer
 	compactStop chan struct{}
+	acmeDB      acme.DB
+	starStop    chan struct{}
+	cmpStop     chan struct{}
+	finalizeQ   *acme.FinalizeQueue
 }
 
 // New creates and initializes the CA with the given configuration and options.
@@ -161,6 +174,8 @@ func New(cfg *config.Config, opts ...Option) (*CA, error) {
 		config:      cfg,
 		opts:        new(options),
 		compactStop: make(chan struct{}),
+		starStop:    make(chan struct{}),
+		cmpStop:     make(chan struct{}),
 	}
 	ca.opts.apply(opts)
 	return ca.Init(cfg)
@@ -271,6 +286,7 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 			return nil, fmt.Errorf("error configuring ACME DB interface: %w", err)
 		}
 		acmeLinker = acme.NewLinker(dns, "acme")
+		ca.acmeDB = acmeDB
 		mux.Route("/acme", func(r chi.Router) {
 			acmeAPI.Route(r)
 		})
@@ -286,12 +302,14 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 		adminDB := auth.GetAdminDatabase()
 		if adminDB != nil {
 			acmeAdminResponder := adminAPI.NewACMEAdminResponder()
+			acmeAccountAdminResponder := adminAPI.NewACMEAccountAdminResponder()
 			policyAdminResponder := adminAPI.NewPolicyAdminResponder()
 			webhookAdminResponder := adminAPI.NewWebhookAdminResponder()
 			mux.Route("/admin", func(r chi.Router) {
 				adminAPI.Route(
 					r,
 					adminAPI.WithACMEResponder(acmeAdminResponder),
+					adminAPI.WithACMEAccountResponder(acmeAccountAdminResponder),
 					adminAPI.WithPolicyResponder(policyAdminResponder),
 					adminAPI.WithWebhookResponder(webhookAdminResponder),
 				)
@@ -324,6 +342,18 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 		})
 	}
 
+	// EST operations are only defined over HTTPS (RFC 7030, section 3.2.1), so
+	// the API is only mounted in the secure mux.
+	mux.Route("/.well-known/est", func(r chi.Router) {
+		estAPI.Route(r)
+	})
+
+	// CMP over HTTP is mounted in the secure mux, messages are protected by
+	// CMP itself but RFC 9483 recommends the use of TLS.
+	mux.Route("/.well-known/cmp", func(r chi.Router) {
+		cmpAPI.Route(r)
+	})
+
 	// helpful routine for logging all routes
 	//dumpRoutes(mux)
 	//dumpRoutes(insecureMux)
@@ -357,6 +387,23 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 	// Create context with all the necessary values.
 	baseContext := buildContext(auth, scepAuthority, acmeDB, acmeLinker)
 
+	// Enable multi-perspective validation of ACME challenges if configured.
+	if acmeDB != nil && cfg.ACME.HasPerspectives() {
+		pv, err := perspective.New(cfg.ACME.Perspectives, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error configuring ACME validation perspectives: %w", err)
+		}
+		baseContext = acme.NewPerspectiveValidatorContext(baseContext, pv)
+	}
+
+	// Enable asynchronous finalization of ACME orders if configured. The
+	// workers are started in Run.
+	if acmeDB != nil && cfg.ACME.HasAsyncFinalize() {
+		ca.finalizeQ = acme.NewFinalizeQueue(acmeDB, auth,
+			cfg.ACME.AsyncFinalize.Workers, cfg.ACME.AsyncFinalize.QueueSize)
+		baseContext = acme.NewFinalizeQueueContext(baseContext, ca.finalizeQ)
+	}
+
 	ca.srv = server.New(cfg.Address, handler, tlsConfig)
 	ca.srv.BaseContext = func(net.Listener) context.Context {
 		return baseContext
@@ -414,6 +461,8 @@ func buildContext(a *authority.Authority, scepAuthority *scep.Authority, acmeDB
 	if scepAuthority != nil {
 		ctx = scep.NewContext(ctx, scepAuthority)
 	}
+	ctx = est.NewContext(ctx, est.New(a))
+	ctx = cmp.NewContext(ctx, cmp.New(a))
 	if acmeDB != nil {
 		ctx = acme.NewContext(ctx, acmeDB, acme.NewClient(), acmeLinker, nil)
 	}
@@ -457,6 +506,29 @@ func (ca *CA) Run() error {
 		return nil
 	})
 
+	if ca.acmeDB != nil {
+		eg.Go(func() error {
+			ca.runStarRenewalJob()
+			return nil
+		})
+	}
+
+	eg.Go(func() error {
+		ca.runCMPConfirmationJob()
+		return nil
+	})
+
+	if ca.finalizeQ != nil {
+		if err := ca.finalizeQ.Start(context.Background()); err != nil {
+			return fmt.Errorf("error starting ACME finalize queue: %w", err)
+		}
+	} else if ca.acmeDB != nil {
+		eg.Go(func() error {
+			ca.processFinalizeJobs()
+			return nil
+		})
+	}
+
 	if ca.insecureSrv != nil {
 		eg.Go(func() error {
 			return ca.insecureSrv.ListenAndServe()
@@ -499,13 +571,20 @@ func (ca *CA) Run() error {
 // Stop stops the CA calling to the server Shutdown method.
 func (ca *CA) Stop() error {
 	close(ca.compactStop)
+	close(ca.starStop)
+	close(ca.cmpStop)
+	if ca.finalizeQ != nil {
+		ca.finalizeQ.Stop()
+	}
 	if ca.renewer != nil {
 		ca.renewer.Stop()
 	}
 
+	ca.authMu.Lock()
 	if err := ca.auth.Shutdown(); err != nil {
 		log.Printf("error stopping ca.Authority: %+v\n", err)
 	}
+	ca.authMu.Unlock()
 
 	// Concurrently shutdown services
 	var eg errgroup.Group
@@ -595,12 +674,32 @@ func (ca *CA) Reload() error {
 		ca.renewer.Stop()
 	}
 
+	// Replace the finalize queue, the jobs not processed by the previous
+	// one are resumed by the new one.
+	if ca.finalizeQ != nil {
+		ca.finalizeQ.Stop()
+	}
+	if newCA.finalizeQ != nil {
+		if err := newCA.finalizeQ.Start(context.Background()); err != nil {
+			log.Printf("error starting ACME finalize queue: %v", err)
+		}
+	}
+	ca.finalizeQ = newCA.finalizeQ
+
+	ca.authMu.Lock()
 	ca.auth.CloseForReload()
 	ca.auth = newCA.auth
+	ca.authMu.Unlock()
 	ca.config = newCA.config
 	ca.opts = newCA.opts
 	ca.renewer = newCA.renewer
 
+	// Finish the jobs left by the previous finalize queue if the
+	// asynchronous finalization has been disabled.
+	if ca.finalizeQ == nil && ca.acmeDB != nil {
+		go ca.processFinalizeJobs()
+	}
+
 	_, _ = daemon.SdNotify(true, daemon.SdNotifyReady)
 
 	return nil
@@ -741,6 +840,61 @@ func (ca *CA) runCompactJob() {
 	}
 }
 
+// runStarRenewalJob periodically issues the certificates of the ACME STAR
+// orders that are due for renewal.
+func (ca *CA) runStarRenewalJob() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ca.starStop:
+			return
+		case <-ticker.C:
+			// Hold the read lock while renewing, so that the authority
+			// is not closed by Reload in the middle of a renewal.
+			ca.authMu.RLock()
+			err := acme.RenewStarOrders(context.Background(), ca.acmeDB, ca.auth)
+			ca.authMu.RUnlock()
+			if err != nil {
+				log.Printf("error renewing ACME STAR orders: %v", err)
+			}
+		}
+	}
+}
+
+// processFinalizeJobs synchronously finalizes the ACME orders left in the
+// processing state by a previous run with asynchronous finalization enabled.
+func (ca *CA) processFinalizeJobs() {
+	ca.authMu.RLock()
+	err := acme.ProcessFinalizeJobs(context.Background(), ca.acmeDB, ca.auth)
+	ca.authMu.RUnlock()
+	if err != nil {
+		log.Printf("error finalizing pending ACME orders: %v", err)
+	}
+}
+
+// runCMPConfirmationJob periodically revokes the certificates issued using
+// CMP that have not been confirmed in time by the clients.
+func (ca *CA) runCMPConfirmationJob() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ca.cmpStop:
+			return
+		case <-ticker.C:
+			ca.authMu.RLock()
+			err := cmp.New(ca.auth).RevokeUnconfirmedCertificates(context.Background())
+			ca.authMu.RUnlock()
+			if err != nil {
+				log.Printf("error revoking unconfirmed CMP certificates: %v", err)
+			}
+		}
+	}
+}
+
 // runCompact executes the compact job until it returns an error.
 func runCompact(c nosql.Compactor) {
 	for err := error(nil); err == nil; {
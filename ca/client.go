@@ -1424,6 +1424,41 @@ retry:
 	return &bastion, nil
 }
 
+// SSHAuthorizedPrincipals performs the POST /ssh/authorized-principals request
+// to the CA with an empty context and returns the principals authorized to
+// log in to the host.
+func (c *Client) SSHAuthorizedPrincipals(req *api.SSHAuthorizedPrincipalsRequest) (*api.SSHAuthorizedPrincipalsResponse, error) {
+	return c.SSHAuthorizedPrincipalsWithContext(context.Background(), req)
+}
+
+// SSHAuthorizedPrincipalsWithContext performs the POST
+// /ssh/authorized-principals request to the CA with the provided context.
+func (c *Client) SSHAuthorizedPrincipalsWithContext(ctx context.Context, req *api.SSHAuthorizedPrincipalsRequest) (*api.SSHAuthorizedPrincipalsResponse, error) {
+	var retried bool
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "client.SSHAuthorizedPrincipals; error marshaling request")
+	}
+	u := c.endpoint.ResolveReference(&url.URL{Path: "/ssh/authorized-principals"})
+retry:
+	resp, err := c.client.PostWithContext(ctx, u.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, clientError(err)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) { //nolint:contextcheck // deeply nested context; retry using the same context
+			retried = true
+			goto retry
+		}
+		return nil, readError(resp)
+	}
+	var principals api.SSHAuthorizedPrincipalsResponse
+	if err := readJSON(resp.Body, &principals); err != nil {
+		return nil, errors.Wrapf(err, "client.SSHAuthorizedPrincipals; error reading %s", u)
+	}
+	return &principals, nil
+}
+
 // RootFingerprint is a helper method that returns the current root fingerprint.
 // It does an health connection and gets the fingerprint from the TLS verified chains.
 func (c *Client) RootFingerprint() (string, error) {
@@ -995,6 +995,59 @@ func TestClient_SSHBastion(t *testing.T) {
 	}
 }
 
+func TestClient_SSHAuthorizedPrincipals(t *testing.T) {
+	ok := &api.SSHAuthorizedPrincipalsResponse{
+		Principals: []string{"root", "admin"},
+	}
+
+	tests := []struct {
+		name         string
+		request      *api.SSHAuthorizedPrincipalsRequest
+		response     interface{}
+		responseCode int
+		wantErr      bool
+		err          error
+	}{
+		{"ok", &api.SSHAuthorizedPrincipalsRequest{User: "root"}, ok, 200, false, nil},
+		{"bad-response", &api.SSHAuthorizedPrincipalsRequest{User: "root"}, "bad json", 200, true, nil},
+		{"bad-request", &api.SSHAuthorizedPrincipalsRequest{}, errs.BadRequest("force"), 400, true, errors.New(errs.BadRequestPrefix)},
+		{"unauthorized", &api.SSHAuthorizedPrincipalsRequest{User: "root"}, errs.Unauthorized("force"), 401, true, errors.New(errs.UnauthorizedDefaultMsg)},
+	}
+
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+			require.NoError(t, err)
+
+			srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/ssh/authorized-principals", r.URL.Path)
+				render.JSONStatus(w, r, tt.response, tt.responseCode)
+			})
+
+			got, err := c.SSHAuthorizedPrincipals(tt.request)
+			if tt.wantErr {
+				if assert.Error(t, err) {
+					if tt.responseCode != 200 {
+						var sc render.StatusCodedError
+						if assert.ErrorAs(t, err, &sc) {
+							assert.Equal(t, tt.responseCode, sc.StatusCode())
+						}
+						assert.True(t, strings.HasPrefix(err.Error(), tt.err.Error()))
+					}
+				}
+				assert.Nil(t, got)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.response, got)
+		})
+	}
+}
+
 func TestClient_GetCaURL(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -24,10 +24,13 @@ type Options struct {
 	// In StepCAS the value is the CA url, e.g., "https://ca.smallstep.com:9000".
 	// In CloudCAS the format is "projects/*/locations/*/certificateAuthorities/*".
 	// In VaultCAS the value is the url, e.g., "https://vault.smallstep.com".
+	// In AWSPCA the value is the certificate authority ARN.
+	// In EJBCACAS the value is the EJBCA url, e.g., "https://ejbca.example.com".
 	CertificateAuthority string `json:"certificateAuthority,omitempty"`
 
 	// CertificateAuthorityFingerprint is the root fingerprint used to
-	// authenticate the connection to the CA when using StepCAS.
+	// authenticate the connection to the CA when using StepCAS. It is also used
+	// to verify the root certificate in VaultCAS and EJBCACAS.
 	CertificateAuthorityFingerprint string `json:"certificateAuthorityFingerprint,omitempty"`
 
 	// CertificateIssuer contains the configuration used in StepCAS.
@@ -35,7 +38,8 @@ type Options struct {
 
 	// Path to the credentials file used in CloudCAS. If not defined the default
 	// authentication mechanism provided by Google SDK will be used. See
-	// https://cloud.google.com/docs/authentication.
+	// https://cloud.google.com/docs/authentication. In AWSPCA it is an AWS
+	// shared credentials file.
 	CredentialsFile string `json:"credentialsFile,omitempty"`
 
 	// CertificateChain contains the issuer certificate, along with any other
@@ -67,6 +71,10 @@ type Options struct {
 	// KeyManager is the KMS used to generate keys in SoftCAS.
 	KeyManager kms.KeyManager `json:"-"`
 
+	// BackendStore is used in FailoverCAS to keep track of the backend that
+	// issued each certificate.
+	BackendStore CertificateBackendStore `json:"-"`
+
 	// Project, Location, CaPool and GCSBucket are parameters used in CloudCAS
 	// to create a new certificate authority. If a CaPool does not exist it will
 	// be created. GCSBucket is optional, if not provided GCloud will create a
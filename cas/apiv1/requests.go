@@ -77,12 +77,13 @@ type CreateCertificateResponse struct {
 
 // RenewCertificateRequest is the request used to re-sign a certificate.
 type RenewCertificateRequest struct {
-	Template  *x509.Certificate
-	CSR       *x509.CertificateRequest
-	Lifetime  time.Duration
-	Backdate  time.Duration
-	Token     string
-	RequestID string
+	Template    *x509.Certificate
+	CSR         *x509.CertificateRequest
+	Lifetime    time.Duration
+	Backdate    time.Duration
+	Token       string
+	RequestID   string
+	Provisioner *ProvisionerInfo
 }
 
 // RenewCertificateResponse is the response to a renew certificate request.
@@ -118,6 +119,9 @@ type GetCertificateAuthorityRequest struct {
 type GetCertificateAuthorityResponse struct {
 	RootCertificate          *x509.Certificate
 	IntermediateCertificates []*x509.Certificate
+	// NextIntermediateCertificates are the intermediate certificates that
+	// will replace the current ones, if the CAS knows them in advance.
+	NextIntermediateCertificates []*x509.Certificate
 }
 
 // CreateKeyRequest is the request used to generate a new key using a KMS.
@@ -157,9 +161,24 @@ type CreateCertificateAuthorityResponse struct {
 	Signer           crypto.Signer
 }
 
+// RotateCertificateAuthorityRequest is the request used to schedule the
+// rotation of the issuer of a CAS. The new issuer will be used to sign
+// certificates from RotateAt, a zero RotateAt switches immediately. A request
+// without CertificateChain and Signer cancels a scheduled rotation.
+type RotateCertificateAuthorityRequest struct {
+	CertificateChain []*x509.Certificate
+	Signer           crypto.Signer
+	RotateAt         time.Time
+}
+
 // CreateCRLRequest is the request to create a Certificate Revocation List.
 type CreateCRLRequest struct {
 	RevocationList *x509.RevocationList
+	// Issuer is the certificate of the intermediate that signs the CRL. If
+	// not set, the CRL is signed by the intermediate issuing certificates.
+	// It is only supported by softcas, to sign the CRL of an intermediate
+	// replaced by a rotation.
+	Issuer *x509.Certificate
 }
 
 // CreateCRLResponse is the response to a Certificate Revocation List request.
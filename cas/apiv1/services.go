@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // CertificateAuthorityService is the interface implemented to support external
@@ -41,6 +42,43 @@ type CertificateAuthoritySigner interface {
 	GetSigner() (crypto.Signer, error)
 }
 
+// CertificateAuthorityRotator is an optional interface implemented by a
+// CertificateAuthorityService that can replace the issuer used to sign
+// certificates at a scheduled time.
+type CertificateAuthorityRotator interface {
+	RotateCertificateAuthority(req *RotateCertificateAuthorityRequest) error
+}
+
+// CertificateAuthorityHealthReporter is an optional interface implemented by a
+// CertificateAuthorityService that reports the health of its backends.
+type CertificateAuthorityHealthReporter interface {
+	GetHealth() []BackendHealth
+}
+
+// CertificateAuthorityCloser is an optional interface implemented by a
+// CertificateAuthorityService that needs to release resources, like
+// background goroutines, when the authority is shut down or reloaded.
+type CertificateAuthorityCloser interface {
+	Close() error
+}
+
+// BackendHealth represents the health of a backend used by a
+// CertificateAuthorityService.
+type BackendHealth struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Healthy   bool      `json:"healthy"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt,omitzero"`
+}
+
+// CertificateBackendStore is the interface used to keep track of the backend
+// that issued a certificate. It is implemented by the step-ca database.
+type CertificateBackendStore interface {
+	StoreCertificateBackend(serialNumber, backend string) error
+	GetCertificateBackend(serialNumber string) (string, error)
+}
+
 // SignatureAlgorithmGetter is an optional implementation in a crypto.Signer
 // that returns the SignatureAlgorithm to use.
 type SignatureAlgorithmGetter interface {
@@ -63,6 +101,13 @@ const (
 	VaultCAS = "vaultcas"
 	// ExternalCAS is a CertificateAuthorityService using an external injected CA implementation
 	ExternalCAS = "externalcas"
+	// AWSPCA is a CertificateAuthorityService using AWS Private CA.
+	AWSPCA = "awspca"
+	// EJBCACAS is a CertificateAuthorityService using the EJBCA REST API.
+	EJBCACAS = "ejbcacas"
+	// FailoverCAS is a CertificateAuthorityService that fails over between
+	// other CertificateAuthorityServices.
+	FailoverCAS = "failovercas"
 )
 
 // String returns a string from the type. It will always return the lower case
@@ -0,0 +1,512 @@
+package awspca
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/acmpca"
+	"github.com/aws/aws-sdk-go-v2/service/acmpca/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+func init() {
+	apiv1.Register(apiv1.AWSPCA, func(ctx context.Context, opts apiv1.Options) (apiv1.CertificateAuthorityService, error) {
+		return New(ctx, opts)
+	})
+}
+
+var now = time.Now
+
+// caRegexp matches the ARN of an AWS Private CA certificate authority, e.g.
+// "arn:aws:acm-pca:us-east-1:123456789012:certificate-authority/12345678-1234-1234-1234-123456789012".
+var caRegexp = regexp.MustCompile("^arn:([^:]+):acm-pca:([^:]+):[0-9]+:certificate-authority/([^/]+)$")
+
+// defaultTemplateName is the AWS Private CA template used by default. API
+// passthrough templates allow to set the subject and extensions of the
+// certificate from the step-ca template.
+const defaultTemplateName = "EndEntityCertificate_APIPassthrough/V1"
+
+// defaultTimeout is the maximum time used by the requests to AWS, including
+// the time waiting for a certificate to be issued.
+const defaultTimeout = 15 * time.Second
+
+// CertificateAuthorityClient is the interface implemented by the AWS Private
+// CA client.
+type CertificateAuthorityClient interface {
+	IssueCertificate(ctx context.Context, params *acmpca.IssueCertificateInput, optFns ...func(*acmpca.Options)) (*acmpca.IssueCertificateOutput, error)
+	GetCertificate(ctx context.Context, params *acmpca.GetCertificateInput, optFns ...func(*acmpca.Options)) (*acmpca.GetCertificateOutput, error)
+	RevokeCertificate(ctx context.Context, params *acmpca.RevokeCertificateInput, optFns ...func(*acmpca.Options)) (*acmpca.RevokeCertificateOutput, error)
+	GetCertificateAuthorityCertificate(ctx context.Context, params *acmpca.GetCertificateAuthorityCertificateInput, optFns ...func(*acmpca.Options)) (*acmpca.GetCertificateAuthorityCertificateOutput, error)
+	DescribeCertificateAuthority(ctx context.Context, params *acmpca.DescribeCertificateAuthorityInput, optFns ...func(*acmpca.Options)) (*acmpca.DescribeCertificateAuthorityOutput, error)
+}
+
+// ObjectClient is the interface implemented by the AWS S3 client. It is used
+// to read the CRLs published by AWS Private CA.
+type ObjectClient interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// revocationCodeMap maps revocation reason codes from RFC 5280, to AWS Private
+// CA revocation reasons. Revocation reason 7 is not used, and revocation
+// reasons 6 (certificateHold) and 8 (removeFromCRL) are not supported by AWS
+// Private CA.
+var revocationCodeMap = map[int]types.RevocationReason{
+	0:  types.RevocationReasonUnspecified,
+	1:  types.RevocationReasonKeyCompromise,
+	2:  types.RevocationReasonCertificateAuthorityCompromise,
+	3:  types.RevocationReasonAffiliationChanged,
+	4:  types.RevocationReasonSuperseded,
+	5:  types.RevocationReasonCessationOfOperation,
+	9:  types.RevocationReasonPrivilegeWithdrawn,
+	10: types.RevocationReasonAACompromise,
+}
+
+// signingAlgorithmMap maps the key algorithm of a certificate authority to the
+// default signing algorithm.
+var signingAlgorithmMap = map[types.KeyAlgorithm]types.SigningAlgorithm{
+	types.KeyAlgorithmRsa2048:      types.SigningAlgorithmSha256withrsa,
+	types.KeyAlgorithmRsa3072:      types.SigningAlgorithmSha256withrsa,
+	types.KeyAlgorithmRsa4096:      types.SigningAlgorithmSha256withrsa,
+	types.KeyAlgorithmEcPrime256v1: types.SigningAlgorithmSha256withecdsa,
+	types.KeyAlgorithmEcSecp384r1:  types.SigningAlgorithmSha384withecdsa,
+	types.KeyAlgorithmEcSecp521r1:  types.SigningAlgorithmSha512withecdsa,
+	types.KeyAlgorithmSm2:          types.SigningAlgorithmSm3withsm2,
+}
+
+// Options is the configuration of AWS Private CA in the config property of the
+// CAS options.
+//
+// Credentials are loaded from the standard AWS sources: environment variables,
+// the shared credentials and config files, and the container or instance
+// roles. The credentialsFile property of the CAS options can be used to read
+// the credentials from a different shared credentials file.
+type Options struct {
+	// Region is the AWS region of the certificate authority. It defaults to
+	// the region in the certificate authority ARN.
+	Region string `json:"region,omitempty"`
+	// Profile is the name of the profile in the shared configuration files.
+	Profile string `json:"profile,omitempty"`
+	// TemplateArn is the ARN of the AWS Private CA template used to issue
+	// certificates. It defaults to the end-entity API passthrough template.
+	TemplateArn string `json:"templateArn,omitempty"`
+	// SigningAlgorithm is the algorithm used to sign certificates, e.g.
+	// SHA256WITHECDSA. It defaults to an algorithm compatible with the key of
+	// the certificate authority.
+	SigningAlgorithm string `json:"signingAlgorithm,omitempty"`
+}
+
+// AWSPCA implements a Certificate Authority Service using AWS Private CA.
+type AWSPCA struct {
+	client               CertificateAuthorityClient
+	objectClient         ObjectClient
+	certificateAuthority string
+	templateArn          string
+	signingAlgorithm     types.SigningAlgorithm
+}
+
+// newClient creates the AWS Private CA and S3 clients. This function is used
+// for testing purposes.
+var newClient = func(ctx context.Context, o *Options, credentialsFile string) (CertificateAuthorityClient, ObjectClient, error) {
+	optFns := []func(*config.LoadOptions) error{
+		config.WithRegion(o.Region),
+	}
+	if o.Profile != "" {
+		optFns = append(optFns, config.WithSharedConfigProfile(o.Profile))
+	}
+	if credentialsFile != "" {
+		optFns = append(optFns, config.WithSharedCredentialsFiles([]string{credentialsFile}))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, optFns...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error loading AWS config")
+	}
+	return acmpca.NewFromConfig(cfg), s3.NewFromConfig(cfg), nil
+}
+
+// New creates a new CertificateAuthorityService implementation using AWS
+// Private CA.
+func New(ctx context.Context, opts apiv1.Options) (*AWSPCA, error) {
+	if opts.IsCreator {
+		return nil, errors.New("awsPCA does not support creating certificate authorities")
+	}
+
+	var o Options
+	if len(opts.Config) > 0 {
+		if err := json.Unmarshal(opts.Config, &o); err != nil {
+			return nil, errors.Wrap(err, "error decoding awsPCA config")
+		}
+	}
+
+	if opts.CertificateAuthority == "" {
+		return nil, errors.New("awsPCA 'certificateAuthority' cannot be empty")
+	}
+	parts := caRegexp.FindStringSubmatch(opts.CertificateAuthority)
+	if parts == nil {
+		return nil, errors.New("awsPCA 'certificateAuthority' is not a valid certificate authority ARN")
+	}
+	if o.Region == "" {
+		o.Region = parts[2]
+	}
+	if o.TemplateArn == "" {
+		o.TemplateArn = "arn:" + parts[1] + ":acm-pca:::template/" + defaultTemplateName
+	}
+
+	client, objectClient, err := newClient(ctx, &o, opts.CredentialsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &AWSPCA{
+		client:               client,
+		objectClient:         objectClient,
+		certificateAuthority: opts.CertificateAuthority,
+		templateArn:          o.TemplateArn,
+		signingAlgorithm:     types.SigningAlgorithm(o.SigningAlgorithm),
+	}
+
+	// Select the signing algorithm from the key of the certificate authority.
+	if c.signingAlgorithm == "" && !opts.IsCAGetter {
+		ca, err := c.describeCertificateAuthority()
+		if err != nil {
+			return nil, err
+		}
+		var alg types.KeyAlgorithm
+		if conf := ca.CertificateAuthorityConfiguration; conf != nil {
+			alg = conf.KeyAlgorithm
+		}
+		var ok bool
+		if c.signingAlgorithm, ok = signingAlgorithmMap[alg]; !ok {
+			return nil, errors.Errorf("awsPCA key algorithm %q is not supported", alg)
+		}
+	}
+
+	return c, nil
+}
+
+// Type returns the type of this CertificateAuthorityService.
+func (c *AWSPCA) Type() apiv1.Type {
+	return apiv1.AWSPCA
+}
+
+// GetCertificateAuthority returns the root certificate and the chain of the
+// given certificate authority. It implements apiv1.CertificateAuthorityGetter
+// interface.
+func (c *AWSPCA) GetCertificateAuthority(req *apiv1.GetCertificateAuthorityRequest) (*apiv1.GetCertificateAuthorityResponse, error) {
+	name := req.Name
+	if name == "" {
+		name = c.certificateAuthority
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	resp, err := c.client.GetCertificateAuthorityCertificate(ctx, &acmpca.GetCertificateAuthorityCertificateInput{
+		CertificateAuthorityArn: aws.String(name),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "awsPCA GetCertificateAuthorityCertificate failed")
+	}
+
+	cert, err := parseCertificate(aws.ToString(resp.Certificate))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing awsPCA certificate failed")
+	}
+	chain, err := parseCertificateChain(aws.ToString(resp.CertificateChain))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing awsPCA certificate chain failed")
+	}
+
+	// Root certificate authorities do not have a chain.
+	if len(chain) == 0 {
+		return &apiv1.GetCertificateAuthorityResponse{
+			RootCertificate: cert,
+		}, nil
+	}
+
+	// Last certificate in the chain is the root
+	return &apiv1.GetCertificateAuthorityResponse{
+		RootCertificate:          chain[len(chain)-1],
+		IntermediateCertificates: append([]*x509.Certificate{cert}, chain[:len(chain)-1]...),
+	}, nil
+}
+
+// CreateCertificate signs a new certificate using AWS Private CA.
+func (c *AWSPCA) CreateCertificate(req *apiv1.CreateCertificateRequest) (*apiv1.CreateCertificateResponse, error) {
+	switch {
+	case req.Template == nil:
+		return nil, errors.New("createCertificateRequest `template` cannot be nil")
+	case req.CSR == nil:
+		return nil, errors.New("createCertificateRequest `csr` cannot be nil")
+	case req.Lifetime == 0:
+		return nil, errors.New("createCertificateRequest `lifetime` cannot be 0")
+	}
+
+	cert, chain, err := c.createCertificate(req.Template, req.CSR, req.Lifetime, req.RequestID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.CreateCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
+}
+
+// RenewCertificate renews the given certificate using AWS Private CA. AWS
+// Private CA does not support the renew operation, so this method issues a
+// new certificate. AWS Private CA requires a certificate request signed by the
+// subject key, which is only available on rekey operations, so renewals are
+// not supported and return a NotImplementedError.
+func (c *AWSPCA) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
+	switch {
+	case req.Template == nil:
+		return nil, errors.New("renewCertificateRequest `template` cannot be nil")
+	case req.CSR == nil:
+		return nil, apiv1.NotImplementedError{Message: "awsPCA does not support renewals without a certificate request"}
+	case req.Lifetime == 0:
+		return nil, errors.New("renewCertificateRequest `lifetime` cannot be 0")
+	}
+
+	cert, chain, err := c.createCertificate(req.Template, req.CSR, req.Lifetime, req.RequestID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.RenewCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
+}
+
+// RevokeCertificate revokes a certificate using AWS Private CA.
+func (c *AWSPCA) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1.RevokeCertificateResponse, error) {
+	reason, ok := revocationCodeMap[req.ReasonCode]
+	switch {
+	case !ok:
+		return nil, errors.Errorf("revokeCertificate 'reasonCode=%d' is invalid or not supported", req.ReasonCode)
+	case req.Certificate == nil && req.SerialNumber == "":
+		return nil, errors.New("revokeCertificateRequest `certificate` or `serialNumber` are required")
+	}
+
+	var sn *big.Int
+	if req.Certificate != nil {
+		sn = req.Certificate.SerialNumber
+	} else if sn, ok = new(big.Int).SetString(req.SerialNumber, 10); !ok {
+		return nil, errors.Errorf("revokeCertificateRequest `serialNumber` %q is not valid", req.SerialNumber)
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	if _, err := c.client.RevokeCertificate(ctx, &acmpca.RevokeCertificateInput{
+		CertificateAuthorityArn: aws.String(c.certificateAuthority),
+		CertificateSerial:       aws.String(formatSerialNumber(sn)),
+		RevocationReason:        reason,
+	}); err != nil {
+		return nil, errors.Wrap(err, "awsPCA RevokeCertificate failed")
+	}
+
+	return &apiv1.RevokeCertificateResponse{
+		Certificate: req.Certificate,
+	}, nil
+}
+
+// CreateCRL returns the latest CRL published by AWS Private CA. AWS Private
+// CA signs its own CRLs with the certificates revoked using RevokeCertificate,
+// so the revocation list in the request is ignored. It implements the
+// apiv1.CertificateAuthorityCRLGenerator interface.
+func (c *AWSPCA) CreateCRL(*apiv1.CreateCRLRequest) (*apiv1.CreateCRLResponse, error) {
+	ca, err := c.describeCertificateAuthority()
+	if err != nil {
+		return nil, err
+	}
+
+	var crlConfig *types.CrlConfiguration
+	if ca.RevocationConfiguration != nil {
+		crlConfig = ca.RevocationConfiguration.CrlConfiguration
+	}
+	if crlConfig == nil || !aws.ToBool(crlConfig.Enabled) || aws.ToString(crlConfig.S3BucketName) == "" {
+		return nil, errors.New("awsPCA certificate authority does not publish CRLs")
+	}
+
+	// AWS Private CA publishes the CRLs in crl/<id>.crl.
+	parts := caRegexp.FindStringSubmatch(c.certificateAuthority)
+	key := "crl/" + parts[3] + ".crl"
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	resp, err := c.objectClient.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: crlConfig.S3BucketName,
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "awsPCA error getting CRL")
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "awsPCA error reading CRL")
+	}
+	if block, _ := pem.Decode(b); block != nil {
+		b = block.Bytes
+	}
+	if _, err := x509.ParseRevocationList(b); err != nil {
+		return nil, errors.Wrap(err, "awsPCA error parsing CRL")
+	}
+
+	return &apiv1.CreateCRLResponse{
+		CRL: b,
+	}, nil
+}
+
+func (c *AWSPCA) createCertificate(tpl *x509.Certificate, csr *x509.CertificateRequest, lifetime time.Duration, requestID string) (*x509.Certificate, []*x509.Certificate, error) {
+	notBefore, notAfter := tpl.NotBefore, tpl.NotAfter
+	if notAfter.IsZero() {
+		notAfter = now().Add(lifetime)
+	}
+
+	input := &acmpca.IssueCertificateInput{
+		ApiPassthrough:          createAPIPassthrough(tpl),
+		CertificateAuthorityArn: aws.String(c.certificateAuthority),
+		Csr: pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE REQUEST",
+			Bytes: csr.Raw,
+		}),
+		SigningAlgorithm: c.signingAlgorithm,
+		TemplateArn:      aws.String(c.templateArn),
+		Validity: &types.Validity{
+			Type:  types.ValidityPeriodTypeAbsolute,
+			Value: aws.Int64(notAfter.Unix()),
+		},
+	}
+	if !notBefore.IsZero() {
+		input.ValidityNotBefore = &types.Validity{
+			Type:  types.ValidityPeriodTypeAbsolute,
+			Value: aws.Int64(notBefore.Unix()),
+		}
+	}
+	if requestID != "" {
+		input.IdempotencyToken = aws.String(requestID)
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	resp, err := c.client.IssueCertificate(ctx, input)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "awsPCA IssueCertificate failed")
+	}
+
+	// Wait until the certificate is issued.
+	getInput := &acmpca.GetCertificateInput{
+		CertificateArn:          resp.CertificateArn,
+		CertificateAuthorityArn: aws.String(c.certificateAuthority),
+	}
+	certResp, err := acmpca.NewCertificateIssuedWaiter(c.client).WaitForOutput(ctx, getInput, defaultTimeout)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "awsPCA GetCertificate failed")
+	}
+
+	cert, err := parseCertificate(aws.ToString(certResp.Certificate))
+	if err != nil {
+		return nil, nil, err
+	}
+	chain, err := parseCertificateChain(aws.ToString(certResp.CertificateChain))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The chain goes up to the root, remove it unless it is the issuer.
+	if n := len(chain); n > 1 && isSelfSigned(chain[n-1]) {
+		chain = chain[:n-1]
+	}
+
+	return cert, chain, nil
+}
+
+func (c *AWSPCA) describeCertificateAuthority() (*types.CertificateAuthority, error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	resp, err := c.client.DescribeCertificateAuthority(ctx, &acmpca.DescribeCertificateAuthorityInput{
+		CertificateAuthorityArn: aws.String(c.certificateAuthority),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "awsPCA DescribeCertificateAuthority failed")
+	}
+	if resp.CertificateAuthority == nil {
+		return nil, errors.New("awsPCA DescribeCertificateAuthority failed: certificate authority is empty")
+	}
+	return resp.CertificateAuthority, nil
+}
+
+func defaultContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), defaultTimeout)
+}
+
+func parseCertificate(pemCert string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(pemCert))
+	if block == nil {
+		return nil, errors.New("error decoding certificate: not a valid PEM encoded block")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate")
+	}
+	return cert, nil
+}
+
+func parseCertificateChain(pemChain string) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	rest := []byte(pemChain)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing certificate")
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 && strings.TrimSpace(pemChain) != "" {
+		return nil, errors.New("error decoding certificate chain: not a valid PEM encoded block")
+	}
+	return chain, nil
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// formatSerialNumber returns the serial number in the hexadecimal format used
+// by AWS Private CA, e.g. "0a:1b:2c".
+func formatSerialNumber(sn *big.Int) string {
+	b := sn.Bytes()
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	parts := make([]string, len(b))
+	for i, v := range b {
+		parts[i] = fmt.Sprintf("%02x", v)
+	}
+	return strings.Join(parts, ":")
+}
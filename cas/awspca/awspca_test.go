@@ -0,0 +1,498 @@
+package awspca
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/acmpca"
+	"github.com/aws/aws-sdk-go-v2/service/acmpca/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/minica"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+const (
+	testAuthorityArn   = "arn:aws:acm-pca:us-east-1:123456789012:certificate-authority/test-ca"
+	testCertificateArn = testAuthorityArn + "/certificate/test-certificate"
+	testTemplateArn    = "arn:aws:acm-pca:::template/EndEntityCertificate_APIPassthrough/V1"
+)
+
+var errTest = errors.New("test error")
+
+type mockClient struct {
+	ca          *minica.CA
+	err         error
+	issued      *acmpca.IssueCertificateInput
+	revoked     *acmpca.RevokeCertificateInput
+	describe    *types.CertificateAuthority
+	certificate *x509.Certificate
+}
+
+func newMockClient(t *testing.T) *mockClient {
+	t.Helper()
+	ca, err := minica.New(minica.WithName("AWS Private CA"))
+	require.NoError(t, err)
+	return &mockClient{
+		ca: ca,
+		describe: &types.CertificateAuthority{
+			Arn: aws.String(testAuthorityArn),
+			CertificateAuthorityConfiguration: &types.CertificateAuthorityConfiguration{
+				KeyAlgorithm: types.KeyAlgorithmEcPrime256v1,
+			},
+			RevocationConfiguration: &types.RevocationConfiguration{
+				CrlConfiguration: &types.CrlConfiguration{
+					Enabled:      aws.Bool(true),
+					S3BucketName: aws.String("test-bucket"),
+				},
+			},
+		},
+	}
+}
+
+func (m *mockClient) IssueCertificate(_ context.Context, input *acmpca.IssueCertificateInput, _ ...func(*acmpca.Options)) (*acmpca.IssueCertificateOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	block, _ := pem.Decode(input.Csr)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	m.issued = input
+	m.certificate, err = m.ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: aws.ToString(input.ApiPassthrough.Subject.CommonName)},
+		PublicKey: csr.PublicKey,
+		NotBefore: time.Unix(aws.ToInt64(input.ValidityNotBefore.Value), 0),
+		NotAfter:  time.Unix(aws.ToInt64(input.Validity.Value), 0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &acmpca.IssueCertificateOutput{
+		CertificateArn: aws.String(testCertificateArn),
+	}, nil
+}
+
+func (m *mockClient) GetCertificate(_ context.Context, input *acmpca.GetCertificateInput, _ ...func(*acmpca.Options)) (*acmpca.GetCertificateOutput, error) {
+	if aws.ToString(input.CertificateArn) != testCertificateArn {
+		return nil, errTest
+	}
+	return &acmpca.GetCertificateOutput{
+		Certificate:      aws.String(encodeCertificates(m.certificate)),
+		CertificateChain: aws.String(encodeCertificates(m.ca.Intermediate, m.ca.Root)),
+	}, nil
+}
+
+func (m *mockClient) RevokeCertificate(_ context.Context, input *acmpca.RevokeCertificateInput, _ ...func(*acmpca.Options)) (*acmpca.RevokeCertificateOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.revoked = input
+	return &acmpca.RevokeCertificateOutput{}, nil
+}
+
+func (m *mockClient) GetCertificateAuthorityCertificate(_ context.Context, input *acmpca.GetCertificateAuthorityCertificateInput, _ ...func(*acmpca.Options)) (*acmpca.GetCertificateAuthorityCertificateOutput, error) {
+	switch {
+	case m.err != nil:
+		return nil, m.err
+	case aws.ToString(input.CertificateAuthorityArn) == testAuthorityArn:
+		return &acmpca.GetCertificateAuthorityCertificateOutput{
+			Certificate:      aws.String(encodeCertificates(m.ca.Intermediate)),
+			CertificateChain: aws.String(encodeCertificates(m.ca.Root)),
+		}, nil
+	default:
+		return &acmpca.GetCertificateAuthorityCertificateOutput{
+			Certificate: aws.String(encodeCertificates(m.ca.Root)),
+		}, nil
+	}
+}
+
+func (m *mockClient) DescribeCertificateAuthority(context.Context, *acmpca.DescribeCertificateAuthorityInput, ...func(*acmpca.Options)) (*acmpca.DescribeCertificateAuthorityOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &acmpca.DescribeCertificateAuthorityOutput{
+		CertificateAuthority: m.describe,
+	}, nil
+}
+
+type mockObjectClient struct {
+	crl []byte
+	err error
+}
+
+func (m *mockObjectClient) GetObject(_ context.Context, input *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	switch {
+	case m.err != nil:
+		return nil, m.err
+	case aws.ToString(input.Bucket) != "test-bucket" || aws.ToString(input.Key) != "crl/test-ca.crl":
+		return nil, errTest
+	default:
+		return &s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader(m.crl)),
+		}, nil
+	}
+}
+
+func encodeCertificates(certs ...*x509.Certificate) string {
+	var buf bytes.Buffer
+	for _, crt := range certs {
+		buf.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw}))
+	}
+	return buf.String()
+}
+
+func mustCertificateRequest(t *testing.T, commonName string) *x509.CertificateRequest {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName},
+	}, key)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+	return csr
+}
+
+func mockNewClient(t *testing.T, client CertificateAuthorityClient, objectClient ObjectClient) {
+	t.Helper()
+	tmp := newClient
+	newClient = func(ctx context.Context, o *Options, credentialsFile string) (CertificateAuthorityClient, ObjectClient, error) {
+		if credentialsFile == "missing" {
+			return nil, nil, errTest
+		}
+		return client, objectClient, nil
+	}
+	t.Cleanup(func() {
+		newClient = tmp
+	})
+}
+
+func TestNew(t *testing.T) {
+	client := newMockClient(t)
+	objectClient := &mockObjectClient{}
+	mockNewClient(t, client, objectClient)
+
+	failClient := newMockClient(t)
+	failClient.err = errTest
+
+	tests := []struct {
+		name    string
+		client  *mockClient
+		opts    apiv1.Options
+		want    *AWSPCA
+		wantErr bool
+	}{
+		{"ok", client, apiv1.Options{
+			CertificateAuthority: testAuthorityArn,
+		}, &AWSPCA{
+			client:               client,
+			objectClient:         objectClient,
+			certificateAuthority: testAuthorityArn,
+			templateArn:          testTemplateArn,
+			signingAlgorithm:     types.SigningAlgorithmSha256withecdsa,
+		}, false},
+		{"ok with config", failClient, apiv1.Options{
+			CertificateAuthority: testAuthorityArn,
+			Config:               json.RawMessage(`{"region":"us-west-2","profile":"step","templateArn":"arn:aws:acm-pca:::template/EndEntityClientAuthCertificate_APIPassthrough/V1","signingAlgorithm":"SHA384WITHECDSA"}`),
+		}, &AWSPCA{
+			client:               client,
+			objectClient:         objectClient,
+			certificateAuthority: testAuthorityArn,
+			templateArn:          "arn:aws:acm-pca:::template/EndEntityClientAuthCertificate_APIPassthrough/V1",
+			signingAlgorithm:     types.SigningAlgorithmSha384withecdsa,
+		}, false},
+		{"ok ca getter", failClient, apiv1.Options{
+			CertificateAuthority: "arn:aws-us-gov:acm-pca:us-gov-west-1:123456789012:certificate-authority/test-ca",
+			IsCAGetter:           true,
+		}, &AWSPCA{
+			client:               client,
+			objectClient:         objectClient,
+			certificateAuthority: "arn:aws-us-gov:acm-pca:us-gov-west-1:123456789012:certificate-authority/test-ca",
+			templateArn:          "arn:aws-us-gov:acm-pca:::template/EndEntityCertificate_APIPassthrough/V1",
+		}, false},
+		{"fail creator", client, apiv1.Options{CertificateAuthority: testAuthorityArn, IsCreator: true}, nil, true},
+		{"fail config", client, apiv1.Options{CertificateAuthority: testAuthorityArn, Config: json.RawMessage(`{`)}, nil, true},
+		{"fail certificateAuthority", client, apiv1.Options{}, nil, true},
+		{"fail certificateAuthority arn", client, apiv1.Options{CertificateAuthority: "projects/test/locations/us/caPools/test/certificateAuthorities/test"}, nil, true},
+		{"fail newClient", client, apiv1.Options{CertificateAuthority: testAuthorityArn, CredentialsFile: "missing"}, nil, true},
+		{"fail describe", failClient, apiv1.Options{CertificateAuthority: testAuthorityArn}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockNewClient(t, tt.client, objectClient)
+			got, err := New(context.Background(), tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			tt.want.client = tt.client
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNew_register(t *testing.T) {
+	mockNewClient(t, newMockClient(t), &mockObjectClient{})
+
+	newFn, ok := apiv1.LoadCertificateAuthorityServiceNewFunc(apiv1.AWSPCA)
+	require.True(t, ok)
+
+	got, err := newFn(context.Background(), apiv1.Options{
+		CertificateAuthority: testAuthorityArn,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, apiv1.Type(apiv1.AWSPCA), apiv1.TypeOf(got))
+}
+
+func TestAWSPCA_GetCertificateAuthority(t *testing.T) {
+	client := newMockClient(t)
+	failClient := newMockClient(t)
+	failClient.err = errTest
+
+	tests := []struct {
+		name    string
+		client  *mockClient
+		req     *apiv1.GetCertificateAuthorityRequest
+		want    *apiv1.GetCertificateAuthorityResponse
+		wantErr bool
+	}{
+		{"ok", client, &apiv1.GetCertificateAuthorityRequest{}, &apiv1.GetCertificateAuthorityResponse{
+			RootCertificate:          client.ca.Root,
+			IntermediateCertificates: []*x509.Certificate{client.ca.Intermediate},
+		}, false},
+		{"ok root", client, &apiv1.GetCertificateAuthorityRequest{
+			Name: "arn:aws:acm-pca:us-east-1:123456789012:certificate-authority/root-ca",
+		}, &apiv1.GetCertificateAuthorityResponse{
+			RootCertificate: client.ca.Root,
+		}, false},
+		{"fail", failClient, &apiv1.GetCertificateAuthorityRequest{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &AWSPCA{
+				client:               tt.client,
+				certificateAuthority: testAuthorityArn,
+			}
+			got, err := c.GetCertificateAuthority(tt.req)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAWSPCA_CreateCertificate(t *testing.T) {
+	client := newMockClient(t)
+	failClient := newMockClient(t)
+	failClient.err = errTest
+	csr := mustCertificateRequest(t, "test.smallstep.com")
+
+	notBefore := time.Now().Truncate(time.Second)
+	notAfter := notBefore.Add(24 * time.Hour)
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "test.smallstep.com"},
+		DNSNames:    []string{"test.smallstep.com"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		PublicKey:   csr.PublicKey,
+		NotBefore:   notBefore,
+		NotAfter:    notAfter,
+	}
+
+	tests := []struct {
+		name    string
+		client  *mockClient
+		req     *apiv1.CreateCertificateRequest
+		wantErr bool
+	}{
+		{"ok", client, &apiv1.CreateCertificateRequest{
+			Template: template, CSR: csr, Lifetime: 24 * time.Hour, RequestID: "request-id",
+		}, false},
+		{"fail template", client, &apiv1.CreateCertificateRequest{CSR: csr, Lifetime: 24 * time.Hour}, true},
+		{"fail csr", client, &apiv1.CreateCertificateRequest{Template: template, Lifetime: 24 * time.Hour}, true},
+		{"fail lifetime", client, &apiv1.CreateCertificateRequest{Template: template, CSR: csr}, true},
+		{"fail issue", failClient, &apiv1.CreateCertificateRequest{Template: template, CSR: csr, Lifetime: 24 * time.Hour}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &AWSPCA{
+				client:               tt.client,
+				certificateAuthority: testAuthorityArn,
+				templateArn:          testTemplateArn,
+				signingAlgorithm:     types.SigningAlgorithmSha256withecdsa,
+			}
+			got, err := c.CreateCertificate(tt.req)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.client.certificate, got.Certificate)
+			assert.Equal(t, []*x509.Certificate{tt.client.ca.Intermediate}, got.CertificateChain)
+
+			issued := tt.client.issued
+			assert.Equal(t, testAuthorityArn, aws.ToString(issued.CertificateAuthorityArn))
+			assert.Equal(t, testTemplateArn, aws.ToString(issued.TemplateArn))
+			assert.Equal(t, types.SigningAlgorithmSha256withecdsa, issued.SigningAlgorithm)
+			assert.Equal(t, "request-id", aws.ToString(issued.IdempotencyToken))
+			assert.Equal(t, &types.Validity{Type: types.ValidityPeriodTypeAbsolute, Value: aws.Int64(notAfter.Unix())}, issued.Validity)
+			assert.Equal(t, &types.Validity{Type: types.ValidityPeriodTypeAbsolute, Value: aws.Int64(notBefore.Unix())}, issued.ValidityNotBefore)
+			assert.Equal(t, createAPIPassthrough(template), issued.ApiPassthrough)
+		})
+	}
+}
+
+func TestAWSPCA_RenewCertificate(t *testing.T) {
+	client := newMockClient(t)
+	csr := mustCertificateRequest(t, "test.smallstep.com")
+	template := &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "test.smallstep.com"},
+		PublicKey: csr.PublicKey,
+		NotBefore: time.Now(),
+		NotAfter:  time.Now().Add(time.Hour),
+	}
+
+	c := &AWSPCA{
+		client:               client,
+		certificateAuthority: testAuthorityArn,
+		templateArn:          testTemplateArn,
+		signingAlgorithm:     types.SigningAlgorithmSha256withecdsa,
+	}
+	got, err := c.RenewCertificate(&apiv1.RenewCertificateRequest{
+		Template: template, CSR: csr, Lifetime: time.Hour,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, client.certificate, got.Certificate)
+
+	_, err = c.RenewCertificate(&apiv1.RenewCertificateRequest{Template: template, Lifetime: time.Hour})
+	var nie apiv1.NotImplementedError
+	assert.ErrorAs(t, err, &nie)
+
+	_, err = c.RenewCertificate(&apiv1.RenewCertificateRequest{CSR: csr, Lifetime: time.Hour})
+	assert.Error(t, err)
+	_, err = c.RenewCertificate(&apiv1.RenewCertificateRequest{Template: template, CSR: csr})
+	assert.Error(t, err)
+}
+
+func TestAWSPCA_RevokeCertificate(t *testing.T) {
+	client := newMockClient(t)
+	failClient := newMockClient(t)
+	failClient.err = errTest
+	cert := &x509.Certificate{SerialNumber: big.NewInt(0x0a1b2c)}
+
+	tests := []struct {
+		name       string
+		client     *mockClient
+		req        *apiv1.RevokeCertificateRequest
+		wantSerial string
+		wantReason types.RevocationReason
+		wantErr    bool
+	}{
+		{"ok certificate", client, &apiv1.RevokeCertificateRequest{
+			Certificate: cert, ReasonCode: 1,
+		}, "0a:1b:2c", types.RevocationReasonKeyCompromise, false},
+		{"ok serial number", client, &apiv1.RevokeCertificateRequest{
+			SerialNumber: "255", ReasonCode: 10,
+		}, "ff", types.RevocationReasonAACompromise, false},
+		{"fail reason", client, &apiv1.RevokeCertificateRequest{Certificate: cert, ReasonCode: 6}, "", "", true},
+		{"fail empty", client, &apiv1.RevokeCertificateRequest{}, "", "", true},
+		{"fail serial number", client, &apiv1.RevokeCertificateRequest{SerialNumber: "0x0a"}, "", "", true},
+		{"fail revoke", failClient, &apiv1.RevokeCertificateRequest{Certificate: cert}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &AWSPCA{
+				client:               tt.client,
+				certificateAuthority: testAuthorityArn,
+			}
+			got, err := c.RevokeCertificate(tt.req)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.req.Certificate, got.Certificate)
+			assert.Equal(t, &acmpca.RevokeCertificateInput{
+				CertificateAuthorityArn: aws.String(testAuthorityArn),
+				CertificateSerial:       aws.String(tt.wantSerial),
+				RevocationReason:        tt.wantReason,
+			}, tt.client.revoked)
+		})
+	}
+}
+
+func TestAWSPCA_CreateCRL(t *testing.T) {
+	client := newMockClient(t)
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, client.ca.Intermediate, client.ca.Signer)
+	require.NoError(t, err)
+
+	disabledClient := newMockClient(t)
+	disabledClient.describe.RevocationConfiguration = nil
+	failClient := newMockClient(t)
+	failClient.err = errTest
+
+	tests := []struct {
+		name         string
+		client       *mockClient
+		objectClient *mockObjectClient
+		want         *apiv1.CreateCRLResponse
+		wantErr      bool
+	}{
+		{"ok", client, &mockObjectClient{crl: crl}, &apiv1.CreateCRLResponse{CRL: crl}, false},
+		{"ok pem", client, &mockObjectClient{crl: pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl})}, &apiv1.CreateCRLResponse{CRL: crl}, false},
+		{"fail describe", failClient, &mockObjectClient{crl: crl}, nil, true},
+		{"fail disabled", disabledClient, &mockObjectClient{crl: crl}, nil, true},
+		{"fail get", client, &mockObjectClient{err: errTest}, nil, true},
+		{"fail parse", client, &mockObjectClient{crl: []byte("not a crl")}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &AWSPCA{
+				client:               tt.client,
+				objectClient:         tt.objectClient,
+				certificateAuthority: testAuthorityArn,
+			}
+			got, err := c.CreateCRL(&apiv1.CreateCRLRequest{RevocationList: &x509.RevocationList{}})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_formatSerialNumber(t *testing.T) {
+	assert.Equal(t, "00", formatSerialNumber(big.NewInt(0)))
+	assert.Equal(t, "01", formatSerialNumber(big.NewInt(1)))
+	assert.Equal(t, "01:00", formatSerialNumber(big.NewInt(256)))
+}
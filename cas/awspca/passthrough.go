@@ -0,0 +1,191 @@
+package awspca
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"net"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/acmpca/types"
+)
+
+var (
+	oidExtensionSubjectKeyID          = asn1.ObjectIdentifier{2, 5, 29, 14}
+	oidExtensionKeyUsage              = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionExtendedKeyUsage      = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidExtensionAuthorityKeyID        = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidExtensionBasicConstraints      = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidExtensionSubjectAltName        = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionCRLDistributionPoints = asn1.ObjectIdentifier{2, 5, 29, 31}
+	oidExtensionCertificatePolicies   = asn1.ObjectIdentifier{2, 5, 29, 32}
+	oidExtensionAuthorityInfoAccess   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 1}
+)
+
+// managedExtensions are the extensions that are not sent as custom
+// extensions, because they are added by AWS Private CA or they are sent in a
+// different way.
+var managedExtensions = [...]asn1.ObjectIdentifier{
+	oidExtensionSubjectKeyID,          // Added by AWS Private CA
+	oidExtensionKeyUsage,              // Added in Extensions.KeyUsage
+	oidExtensionExtendedKeyUsage,      // Added in Extensions.ExtendedKeyUsage
+	oidExtensionAuthorityKeyID,        // Added by AWS Private CA
+	oidExtensionBasicConstraints,      // Added by the AWS Private CA template
+	oidExtensionSubjectAltName,        // Added in Extensions.SubjectAlternativeNames
+	oidExtensionCRLDistributionPoints, // Added by AWS Private CA
+	oidExtensionCertificatePolicies,   // Added in Extensions.CertificatePolicies
+	oidExtensionAuthorityInfoAccess,   // Added by AWS Private CA
+}
+
+var extKeyUsageMap = map[x509.ExtKeyUsage]types.ExtendedKeyUsageType{
+	x509.ExtKeyUsageServerAuth:      types.ExtendedKeyUsageTypeServerAuth,
+	x509.ExtKeyUsageClientAuth:      types.ExtendedKeyUsageTypeClientAuth,
+	x509.ExtKeyUsageCodeSigning:     types.ExtendedKeyUsageTypeCodeSigning,
+	x509.ExtKeyUsageEmailProtection: types.ExtendedKeyUsageTypeEmailProtection,
+	x509.ExtKeyUsageTimeStamping:    types.ExtendedKeyUsageTypeTimeStamping,
+	x509.ExtKeyUsageOCSPSigning:     types.ExtendedKeyUsageTypeOcspSigning,
+}
+
+var extKeyUsageOIDs = map[x509.ExtKeyUsage]asn1.ObjectIdentifier{
+	x509.ExtKeyUsageAny:                            {2, 5, 29, 37, 0},
+	x509.ExtKeyUsageIPSECEndSystem:                 {1, 3, 6, 1, 5, 5, 7, 3, 5},
+	x509.ExtKeyUsageIPSECTunnel:                    {1, 3, 6, 1, 5, 5, 7, 3, 6},
+	x509.ExtKeyUsageIPSECUser:                      {1, 3, 6, 1, 5, 5, 7, 3, 7},
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     {1, 3, 6, 1, 4, 1, 311, 10, 3, 3},
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      {2, 16, 840, 1, 113730, 4, 1},
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: {1, 3, 6, 1, 4, 1, 311, 2, 1, 22},
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     {1, 3, 6, 1, 4, 1, 311, 61, 1, 1},
+}
+
+// createAPIPassthrough returns the subject and extensions of the template in
+// the format used by the AWS Private CA API passthrough templates.
+func createAPIPassthrough(tpl *x509.Certificate) *types.ApiPassthrough {
+	return &types.ApiPassthrough{
+		Subject:    createSubject(tpl),
+		Extensions: createExtensions(tpl),
+	}
+}
+
+func createSubject(cert *x509.Certificate) *types.ASN1Subject {
+	sub := cert.Subject
+	ret := new(types.ASN1Subject)
+	if sub.CommonName != "" {
+		ret.CommonName = aws.String(sub.CommonName)
+	}
+	if sub.SerialNumber != "" {
+		ret.SerialNumber = aws.String(sub.SerialNumber)
+	}
+	if len(sub.Country) > 0 {
+		ret.Country = aws.String(sub.Country[0])
+	}
+	if len(sub.Organization) > 0 {
+		ret.Organization = aws.String(sub.Organization[0])
+	}
+	if len(sub.OrganizationalUnit) > 0 {
+		ret.OrganizationalUnit = aws.String(sub.OrganizationalUnit[0])
+	}
+	if len(sub.Locality) > 0 {
+		ret.Locality = aws.String(sub.Locality[0])
+	}
+	if len(sub.Province) > 0 {
+		ret.State = aws.String(sub.Province[0])
+	}
+	return ret
+}
+
+func createExtensions(cert *x509.Certificate) *types.Extensions {
+	ret := new(types.Extensions)
+
+	if cert.KeyUsage != 0 {
+		ret.KeyUsage = &types.KeyUsage{
+			DigitalSignature: cert.KeyUsage&x509.KeyUsageDigitalSignature > 0,
+			NonRepudiation:   cert.KeyUsage&x509.KeyUsageContentCommitment > 0,
+			KeyEncipherment:  cert.KeyUsage&x509.KeyUsageKeyEncipherment > 0,
+			DataEncipherment: cert.KeyUsage&x509.KeyUsageDataEncipherment > 0,
+			KeyAgreement:     cert.KeyUsage&x509.KeyUsageKeyAgreement > 0,
+			KeyCertSign:      cert.KeyUsage&x509.KeyUsageCertSign > 0,
+			CRLSign:          cert.KeyUsage&x509.KeyUsageCRLSign > 0,
+			EncipherOnly:     cert.KeyUsage&x509.KeyUsageEncipherOnly > 0,
+			DecipherOnly:     cert.KeyUsage&x509.KeyUsageDecipherOnly > 0,
+		}
+	}
+
+	for _, eku := range cert.ExtKeyUsage {
+		if typ, ok := extKeyUsageMap[eku]; ok {
+			ret.ExtendedKeyUsage = append(ret.ExtendedKeyUsage, types.ExtendedKeyUsage{
+				ExtendedKeyUsageType: typ,
+			})
+		} else if oid, ok := extKeyUsageOIDs[eku]; ok {
+			ret.ExtendedKeyUsage = append(ret.ExtendedKeyUsage, types.ExtendedKeyUsage{
+				ExtendedKeyUsageObjectIdentifier: aws.String(oid.String()),
+			})
+		}
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		ret.ExtendedKeyUsage = append(ret.ExtendedKeyUsage, types.ExtendedKeyUsage{
+			ExtendedKeyUsageObjectIdentifier: aws.String(oid.String()),
+		})
+	}
+
+	for _, oid := range cert.PolicyIdentifiers {
+		ret.CertificatePolicies = append(ret.CertificatePolicies, types.PolicyInformation{
+			CertPolicyId: aws.String(oid.String()),
+		})
+	}
+
+	// A SAN extension in the template replaces the SANs in the certificate
+	// fields, as it does in x509.CreateCertificate.
+	var hasSANExtension bool
+	for _, ext := range cert.ExtraExtensions {
+		if ext.Id.Equal(oidExtensionSubjectAltName) {
+			hasSANExtension = true
+		} else if !isCustomExtension(ext.Id) {
+			continue
+		}
+		ret.CustomExtensions = append(ret.CustomExtensions, types.CustomExtension{
+			ObjectIdentifier: aws.String(ext.Id.String()),
+			Critical:         aws.Bool(ext.Critical),
+			Value:            aws.String(base64.StdEncoding.EncodeToString(ext.Value)),
+		})
+	}
+	if !hasSANExtension {
+		ret.SubjectAlternativeNames = createSubjectAlternativeNames(cert)
+	}
+
+	return ret
+}
+
+func createSubjectAlternativeNames(cert *x509.Certificate) []types.GeneralName {
+	var ret []types.GeneralName
+	for _, name := range cert.DNSNames {
+		ret = append(ret, types.GeneralName{DnsName: aws.String(name)})
+	}
+	for _, email := range cert.EmailAddresses {
+		ret = append(ret, types.GeneralName{Rfc822Name: aws.String(email)})
+	}
+	for _, ip := range cert.IPAddresses {
+		ret = append(ret, types.GeneralName{IpAddress: aws.String(formatIP(ip))})
+	}
+	for _, u := range cert.URIs {
+		ret = append(ret, types.GeneralName{UniformResourceIdentifier: aws.String(u.String())})
+	}
+	return ret
+}
+
+// isCustomExtension returns true if the extension oid is not managed in a
+// different way.
+func isCustomExtension(oid asn1.ObjectIdentifier) bool {
+	for _, id := range managedExtensions {
+		if id.Equal(oid) {
+			return false
+		}
+	}
+	return true
+}
+
+func formatIP(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String()
+	}
+	return ip.String()
+}
@@ -0,0 +1,106 @@
+package awspca
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/acmpca/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_createAPIPassthrough(t *testing.T) {
+	uri, _ := url.Parse("spiffe://example.com/test")
+	tests := []struct {
+		name string
+		tpl  *x509.Certificate
+		want *types.ApiPassthrough
+	}{
+		{"ok", &x509.Certificate{
+			Subject: pkix.Name{
+				CommonName:         "test.smallstep.com",
+				SerialNumber:       "1234",
+				Country:            []string{"US", "ES"},
+				Organization:       []string{"Smallstep"},
+				OrganizationalUnit: []string{"Engineering"},
+				Locality:           []string{"San Francisco"},
+				Province:           []string{"CA"},
+			},
+			DNSNames:           []string{"test.smallstep.com"},
+			EmailAddresses:     []string{"test@smallstep.com"},
+			IPAddresses:        []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+			URIs:               []*url.URL{uri},
+			KeyUsage:           x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+			ExtKeyUsage:        []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageIPSECUser},
+			UnknownExtKeyUsage: []asn1.ObjectIdentifier{{1, 2, 3, 4}},
+			PolicyIdentifiers:  []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 1}},
+			ExtraExtensions: []pkix.Extension{
+				{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 1}, Value: []byte("step")},
+				{Id: oidExtensionSubjectKeyID, Value: []byte("skid")},
+			},
+		}, &types.ApiPassthrough{
+			Subject: &types.ASN1Subject{
+				CommonName:         aws.String("test.smallstep.com"),
+				SerialNumber:       aws.String("1234"),
+				Country:            aws.String("US"),
+				Organization:       aws.String("Smallstep"),
+				OrganizationalUnit: aws.String("Engineering"),
+				Locality:           aws.String("San Francisco"),
+				State:              aws.String("CA"),
+			},
+			Extensions: &types.Extensions{
+				KeyUsage: &types.KeyUsage{
+					DigitalSignature: true,
+					NonRepudiation:   false,
+					KeyEncipherment:  true,
+					DataEncipherment: false,
+					KeyAgreement:     false,
+					KeyCertSign:      false,
+					CRLSign:          false,
+					EncipherOnly:     false,
+					DecipherOnly:     false,
+				},
+				ExtendedKeyUsage: []types.ExtendedKeyUsage{
+					{ExtendedKeyUsageType: types.ExtendedKeyUsageTypeServerAuth},
+					{ExtendedKeyUsageObjectIdentifier: aws.String("1.3.6.1.5.5.7.3.7")},
+					{ExtendedKeyUsageObjectIdentifier: aws.String("1.2.3.4")},
+				},
+				CertificatePolicies: []types.PolicyInformation{
+					{CertPolicyId: aws.String("2.23.140.1.2.1")},
+				},
+				CustomExtensions: []types.CustomExtension{
+					{ObjectIdentifier: aws.String("1.3.6.1.4.1.37476.9000.64.1"), Critical: aws.Bool(false), Value: aws.String("c3RlcA==")},
+				},
+				SubjectAlternativeNames: []types.GeneralName{
+					{DnsName: aws.String("test.smallstep.com")},
+					{Rfc822Name: aws.String("test@smallstep.com")},
+					{IpAddress: aws.String("127.0.0.1")},
+					{IpAddress: aws.String("::1")},
+					{UniformResourceIdentifier: aws.String("spiffe://example.com/test")},
+				},
+			},
+		}},
+		{"ok san extension", &x509.Certificate{
+			DNSNames: []string{"test.smallstep.com"},
+			ExtraExtensions: []pkix.Extension{
+				{Id: oidExtensionSubjectAltName, Critical: true, Value: []byte("san")},
+			},
+		}, &types.ApiPassthrough{
+			Subject: &types.ASN1Subject{},
+			Extensions: &types.Extensions{
+				CustomExtensions: []types.CustomExtension{
+					{ObjectIdentifier: aws.String("2.5.29.17"), Critical: aws.Bool(true), Value: aws.String("c2Fu")},
+				},
+			},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, createAPIPassthrough(tt.tpl))
+		})
+	}
+}
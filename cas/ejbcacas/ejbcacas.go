@@ -0,0 +1,685 @@
+package ejbcacas
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+func init() {
+	apiv1.Register(apiv1.EJBCACAS, func(ctx context.Context, opts apiv1.Options) (apiv1.CertificateAuthorityService, error) {
+		return New(ctx, opts)
+	})
+}
+
+// apiPath is the path of the EJBCA REST API.
+const apiPath = "/ejbca/ejbca-rest-api/v1"
+
+var oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// revocationCodeMap maps revocation reason codes from RFC 5280, to EJBCA
+// revocation reasons. Revocation reason 7 is not used.
+var revocationCodeMap = map[int]string{
+	0:  "UNSPECIFIED",
+	1:  "KEY_COMPROMISE",
+	2:  "CA_COMPROMISE",
+	3:  "AFFILIATION_CHANGED",
+	4:  "SUPERSEDED",
+	5:  "CESSATION_OF_OPERATION",
+	6:  "CERTIFICATE_HOLD",
+	8:  "REMOVE_FROM_CRL",
+	9:  "PRIVILEGES_WITHDRAWN",
+	10: "AA_COMPROMISE",
+}
+
+// Options is the configuration of EJBCA in the config property of the CAS
+// options. The certificateAuthority property of the CAS options is the URL of
+// the EJBCA server, e.g. "https://ejbca.example.com".
+type Options struct {
+	// CertificateAuthorityName is the name of the CA in EJBCA.
+	CertificateAuthorityName string `json:"certificateAuthorityName"`
+	// CertificateProfile and EndEntityProfile are the names of the EJBCA
+	// profiles used by default.
+	CertificateProfile string `json:"certificateProfile"`
+	EndEntityProfile   string `json:"endEntityProfile"`
+	// Provisioners maps the name of a provisioner to the EJBCA profiles used
+	// for the certificates authorized by it.
+	Provisioners map[string]Profile `json:"provisioners,omitempty"`
+	// ClientCertificate and ClientKey are the paths to the certificate and key
+	// used to authenticate with EJBCA.
+	ClientCertificate string `json:"clientCertificate"`
+	ClientKey         string `json:"clientKey"`
+	// RootCA is the path to the bundle used to verify the EJBCA server. The
+	// system trust store is used if it is not set.
+	RootCA string `json:"rootCA,omitempty"`
+}
+
+// Profile are the EJBCA profiles used to issue a certificate. Empty values
+// default to the profiles in the EJBCA options.
+type Profile struct {
+	CertificateProfile string `json:"certificateProfile,omitempty"`
+	EndEntityProfile   string `json:"endEntityProfile,omitempty"`
+}
+
+// EJBCACAS implements a Certificate Authority Service using the REST API of
+// EJBCA. EJBCA builds the certificates from the certificate request and the
+// configured profiles, so the subject and SANs of the certificate request must
+// match the ones in the step-ca template.
+type EJBCACAS struct {
+	client      *http.Client
+	baseURL     *url.URL
+	config      Options
+	fingerprint string
+
+	mu        sync.Mutex
+	subjectDN string
+}
+
+// New creates a new CertificateAuthorityService implementation using EJBCA.
+// The connection to EJBCA is not checked until the first request.
+func New(_ context.Context, opts apiv1.Options) (*EJBCACAS, error) {
+	if opts.IsCreator {
+		return nil, errors.New("ejbcaCAS does not support creating certificate authorities")
+	}
+	if opts.CertificateAuthority == "" {
+		return nil, errors.New("ejbcaCAS 'certificateAuthority' cannot be empty")
+	}
+	u, err := url.Parse(opts.CertificateAuthority)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, errors.New("ejbcaCAS 'certificateAuthority' must be an https url")
+	}
+
+	var o Options
+	if len(opts.Config) > 0 {
+		if err := json.Unmarshal(opts.Config, &o); err != nil {
+			return nil, errors.Wrap(err, "error decoding ejbcaCAS config")
+		}
+	}
+	switch {
+	case o.CertificateAuthorityName == "":
+		return nil, errors.New("ejbcaCAS 'certificateAuthorityName' cannot be empty")
+	case o.ClientCertificate == "":
+		return nil, errors.New("ejbcaCAS 'clientCertificate' cannot be empty")
+	case o.ClientKey == "":
+		return nil, errors.New("ejbcaCAS 'clientKey' cannot be empty")
+	case !opts.IsCAGetter && o.CertificateProfile == "":
+		return nil, errors.New("ejbcaCAS 'certificateProfile' cannot be empty")
+	case !opts.IsCAGetter && o.EndEntityProfile == "":
+		return nil, errors.New("ejbcaCAS 'endEntityProfile' cannot be empty")
+	}
+
+	cert, err := tls.LoadX509KeyPair(o.ClientCertificate, o.ClientKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading ejbcaCAS client certificate")
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if o.RootCA != "" {
+		roots, err := pemutil.ReadCertificateBundle(o.RootCA)
+		if err != nil {
+			return nil, errors.Wrap(err, "error loading ejbcaCAS 'rootCA'")
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		for _, crt := range roots {
+			tlsConfig.RootCAs.AddCert(crt)
+		}
+	}
+	baseURL := *u
+	baseURL.Path = strings.TrimSuffix(u.Path, "/") + apiPath
+	baseURL.RawPath = ""
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = tlsConfig
+
+	return &EJBCACAS{
+		client: &http.Client{
+			Transport: tr,
+			Timeout:   30 * time.Second,
+		},
+		baseURL:     &baseURL,
+		config:      o,
+		fingerprint: opts.CertificateAuthorityFingerprint,
+	}, nil
+}
+
+// Type returns the type of this CertificateAuthorityService.
+func (c *EJBCACAS) Type() apiv1.Type {
+	return apiv1.EJBCACAS
+}
+
+// GetCertificateAuthority returns the root and intermediate certificates of
+// the configured CA. If the CAS options have a fingerprint, it is used to
+// verify the root certificate. It implements apiv1.CertificateAuthorityGetter
+// interface.
+func (c *EJBCACAS) GetCertificateAuthority(*apiv1.GetCertificateAuthorityRequest) (*apiv1.GetCertificateAuthorityResponse, error) {
+	subjectDN, err := c.getSubjectDN()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(http.MethodGet, "ca/"+url.PathEscape(subjectDN)+"/certificate/download", nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "ejbcaCAS error getting CA certificate")
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "ejbcaCAS error reading CA certificate")
+	}
+
+	var root *x509.Certificate
+	var intermediates []*x509.Certificate
+	for _, crt := range parseCertificates(b) {
+		if isRoot(crt) {
+			root = crt
+		} else {
+			intermediates = append(intermediates, crt)
+		}
+	}
+	if root == nil {
+		return nil, errors.New("ejbcaCAS error getting CA certificate: root certificate not found")
+	}
+
+	if c.fingerprint != "" {
+		sum := sha256.Sum256(root.Raw)
+		if !strings.EqualFold(c.fingerprint, hex.EncodeToString(sum[:])) {
+			return nil, errors.New("ejbcaCAS error verifying root: fingerprint does not match")
+		}
+	}
+
+	return &apiv1.GetCertificateAuthorityResponse{
+		RootCertificate:          root,
+		IntermediateCertificates: intermediates,
+	}, nil
+}
+
+// CreateCertificate signs a new certificate using EJBCA. The EJBCA profiles
+// are selected using the provisioner in the request.
+func (c *EJBCACAS) CreateCertificate(req *apiv1.CreateCertificateRequest) (*apiv1.CreateCertificateResponse, error) {
+	switch {
+	case req.CSR == nil:
+		return nil, errors.New("createCertificateRequest `csr` cannot be nil")
+	case req.Template == nil:
+		return nil, errors.New("createCertificateRequest `template` cannot be nil")
+	}
+
+	var provisionerName string
+	if req.Provisioner != nil {
+		provisionerName = req.Provisioner.Name
+	}
+
+	cert, chain, err := c.createCertificate(req.Template, req.CSR, c.getProfile(provisionerName))
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.CreateCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
+}
+
+// RenewCertificate renews a certificate using EJBCA. EJBCA requires a
+// certificate request to issue certificates, so renewals without one are not
+// supported. The EJBCA profiles are selected using the provisioner in the
+// request.
+func (c *EJBCACAS) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
+	switch {
+	case req.CSR == nil:
+		return nil, apiv1.NotImplementedError{Message: "ejbcaCAS does not support renewals without a certificate request"}
+	case req.Template == nil:
+		return nil, errors.New("renewCertificateRequest `template` cannot be nil")
+	}
+
+	var provisionerName string
+	if req.Provisioner != nil {
+		provisionerName = req.Provisioner.Name
+	}
+
+	cert, chain, err := c.createCertificate(req.Template, req.CSR, c.getProfile(provisionerName))
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.RenewCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
+}
+
+// RevokeCertificate revokes a certificate using EJBCA.
+func (c *EJBCACAS) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1.RevokeCertificateResponse, error) {
+	reason, ok := revocationCodeMap[req.ReasonCode]
+	switch {
+	case !ok:
+		return nil, errors.Errorf("revokeCertificate 'reasonCode=%d' is invalid or not supported", req.ReasonCode)
+	case req.Certificate == nil && req.SerialNumber == "":
+		return nil, errors.New("revokeCertificateRequest `certificate` or `serialNumber` are required")
+	}
+
+	var issuerDN string
+	var sn *big.Int
+	if req.Certificate != nil {
+		sn = req.Certificate.SerialNumber
+		issuerDN = req.Certificate.Issuer.String()
+	} else if sn, ok = new(big.Int).SetString(req.SerialNumber, 10); !ok {
+		return nil, errors.Errorf("revokeCertificateRequest `serialNumber` %q is not valid", req.SerialNumber)
+	} else {
+		var err error
+		if issuerDN, err = c.getSubjectDN(); err != nil {
+			return nil, err
+		}
+	}
+
+	query := url.Values{"reason": []string{reason}}
+	resp, err := c.do(http.MethodPut, "certificate/"+url.PathEscape(issuerDN)+"/"+sn.Text(16)+"/revoke", query, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "ejbcaCAS error revoking certificate")
+	}
+	resp.Body.Close()
+
+	return &apiv1.RevokeCertificateResponse{
+		Certificate: req.Certificate,
+	}, nil
+}
+
+// CreateCRL returns the latest CRL of the CA in EJBCA. EJBCA signs its own
+// CRLs with the certificates revoked using RevokeCertificate, so the
+// revocation list in the request is ignored. It implements the
+// apiv1.CertificateAuthorityCRLGenerator interface.
+func (c *EJBCACAS) CreateCRL(*apiv1.CreateCRLRequest) (*apiv1.CreateCRLResponse, error) {
+	subjectDN, err := c.getSubjectDN()
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{"deltaCrl": []string{"false"}}
+	var body crlResponse
+	if err := c.doJSON(http.MethodGet, "ca/"+url.PathEscape(subjectDN)+"/getLatestCrl", query, nil, &body); err != nil {
+		return nil, errors.Wrap(err, "ejbcaCAS error getting CRL")
+	}
+
+	crl, err := decodeBytes(body.CRL)
+	if err != nil {
+		return nil, errors.Wrap(err, "ejbcaCAS error decoding CRL")
+	}
+	if _, err := x509.ParseRevocationList(crl); err != nil {
+		return nil, errors.Wrap(err, "ejbcaCAS error parsing CRL")
+	}
+
+	return &apiv1.CreateCRLResponse{
+		CRL: crl,
+	}, nil
+}
+
+type enrollRequest struct {
+	CertificateRequest       string `json:"certificate_request"`
+	CertificateProfileName   string `json:"certificate_profile_name"`
+	EndEntityProfileName     string `json:"end_entity_profile_name"`
+	CertificateAuthorityName string `json:"certificate_authority_name"`
+	Username                 string `json:"username"`
+	Password                 string `json:"password"`
+	IncludeChain             bool   `json:"include_chain"`
+}
+
+type enrollResponse struct {
+	Certificate      string   `json:"certificate"`
+	SerialNumber     string   `json:"serial_number"`
+	ResponseFormat   string   `json:"response_format"`
+	CertificateChain []string `json:"certificate_chain"`
+}
+
+type caListResponse struct {
+	CertificateAuthorities []struct {
+		Name      string `json:"name"`
+		SubjectDN string `json:"subject_dn"`
+	} `json:"certificate_authorities"`
+}
+
+type crlResponse struct {
+	CRL            string `json:"crl"`
+	ResponseFormat string `json:"response_format"`
+}
+
+type errorResponse struct {
+	ErrorCode    int    `json:"error_code"`
+	ErrorMessage string `json:"error_message"`
+}
+
+// apiError is the error returned by the EJBCA REST API.
+type apiError struct {
+	Status  int
+	Message string
+}
+
+// Error implements the error interface.
+func (e *apiError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ejbca responded with status code %d", e.Status)
+	}
+	return fmt.Sprintf("ejbca responded with status code %d: %s", e.Status, e.Message)
+}
+
+// StatusCode returns the status code of the EJBCA response.
+func (e *apiError) StatusCode() int {
+	return e.Status
+}
+
+func (c *EJBCACAS) createCertificate(tpl *x509.Certificate, cr *x509.CertificateRequest, profile Profile) (*x509.Certificate, []*x509.Certificate, error) {
+	if err := validateCertificateRequest(tpl, cr); err != nil {
+		return nil, nil, err
+	}
+
+	password, err := randomPassword()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var body enrollResponse
+	if err := c.doJSON(http.MethodPost, "certificate/pkcs10enroll", nil, &enrollRequest{
+		CertificateRequest: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE REQUEST",
+			Bytes: cr.Raw,
+		})),
+		CertificateProfileName:   profile.CertificateProfile,
+		EndEntityProfileName:     profile.EndEntityProfile,
+		CertificateAuthorityName: c.config.CertificateAuthorityName,
+		Username:                 getUsername(tpl),
+		Password:                 password,
+		IncludeChain:             true,
+	}, &body); err != nil {
+		return nil, nil, errors.Wrap(err, "ejbcaCAS error signing certificate")
+	}
+
+	cert, err := parseCertificate(body.Certificate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var chain []*x509.Certificate
+	for _, s := range body.CertificateChain {
+		crt, err := parseCertificate(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		chain = append(chain, crt)
+	}
+
+	// The chain goes up to the root, remove it unless it is the issuer.
+	if n := len(chain); n > 1 && isRoot(chain[n-1]) {
+		chain = chain[:n-1]
+	}
+
+	return cert, chain, nil
+}
+
+// getProfile returns the EJBCA profiles used for the given provisioner.
+func (c *EJBCACAS) getProfile(provisionerName string) Profile {
+	p := c.config.Provisioners[provisionerName]
+	if p.CertificateProfile == "" {
+		p.CertificateProfile = c.config.CertificateProfile
+	}
+	if p.EndEntityProfile == "" {
+		p.EndEntityProfile = c.config.EndEntityProfile
+	}
+	return p
+}
+
+// getSubjectDN returns the subject DN of the configured CA, used to get the CA
+// certificates, revoke certificates and get CRLs. It is retrieved from EJBCA on
+// the first successful call.
+func (c *EJBCACAS) getSubjectDN() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.subjectDN != "" {
+		return c.subjectDN, nil
+	}
+
+	var body caListResponse
+	if err := c.doJSON(http.MethodGet, "ca", nil, nil, &body); err != nil {
+		return "", errors.Wrap(err, "ejbcaCAS error getting certificate authorities")
+	}
+	for _, ca := range body.CertificateAuthorities {
+		if ca.Name == c.config.CertificateAuthorityName {
+			c.subjectDN = ca.SubjectDN
+			return c.subjectDN, nil
+		}
+	}
+	return "", errors.Errorf("ejbcaCAS certificate authority %q was not found", c.config.CertificateAuthorityName)
+}
+
+func (c *EJBCACAS) do(method, path string, query url.Values, body any) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	resp, err := c.doWithContext(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	// Read the body before the context is canceled.
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading response")
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	return resp, nil
+}
+
+func (c *EJBCACAS) doWithContext(ctx context.Context, method, path string, query url.Values, body any) (*http.Response, error) {
+	u := c.baseURL.JoinPath(path)
+	u.RawQuery = query.Encode()
+
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling request")
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), r)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating request")
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error doing %s %s", method, u.Path)
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var e errorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return nil, &apiError{
+			Status:  resp.StatusCode,
+			Message: e.ErrorMessage,
+		}
+	}
+	return resp, nil
+}
+
+func (c *EJBCACAS) doJSON(method, path string, query url.Values, body, v any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	return c.doJSONWithContext(ctx, method, path, query, body, v)
+}
+
+func (c *EJBCACAS) doJSONWithContext(ctx context.Context, method, path string, query url.Values, body, v any) error {
+	resp, err := c.doWithContext(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return errors.Wrap(err, "error decoding response")
+	}
+	return nil
+}
+
+// validateCertificateRequest checks that the subject and SANs of the
+// certificate request are the ones in the template. EJBCA issues the
+// certificate with the names in the certificate request, so a request with
+// names different from the ones authorized by step-ca is rejected.
+func validateCertificateRequest(tpl *x509.Certificate, cr *x509.CertificateRequest) error {
+	if tpl.Subject.String() != cr.Subject.String() {
+		return apiv1.ValidationError{
+			Message: fmt.Sprintf("ejbcaCAS certificate request subject %q does not match the template subject %q", cr.Subject, tpl.Subject),
+		}
+	}
+
+	// A SAN extension in the template replaces the SANs in the certificate
+	// fields, as it does in x509.CreateCertificate.
+	if ext, ok := findExtension(tpl.ExtraExtensions, oidExtensionSubjectAltName); ok {
+		if crExt, ok := findExtension(cr.Extensions, oidExtensionSubjectAltName); !ok || !bytes.Equal(ext.Value, crExt.Value) {
+			return apiv1.ValidationError{
+				Message: "ejbcaCAS certificate request subject alternative names do not match the template",
+			}
+		}
+		return nil
+	}
+
+	tplNames := subjectAltNames(tpl.DNSNames, tpl.EmailAddresses, tpl.IPAddresses, tpl.URIs)
+	crNames := subjectAltNames(cr.DNSNames, cr.EmailAddresses, cr.IPAddresses, cr.URIs)
+	if !slices.Equal(tplNames, crNames) {
+		return apiv1.ValidationError{
+			Message: fmt.Sprintf("ejbcaCAS certificate request subject alternative names %v do not match the template %v", crNames, tplNames),
+		}
+	}
+	return nil
+}
+
+// subjectAltNames returns the sorted list of SANs with their type as prefix.
+func subjectAltNames(dnsNames, emails []string, ips []net.IP, uris []*url.URL) []string {
+	names := make([]string, 0, len(dnsNames)+len(emails)+len(ips)+len(uris))
+	for _, s := range dnsNames {
+		names = append(names, "dns:"+s)
+	}
+	for _, s := range emails {
+		names = append(names, "email:"+s)
+	}
+	for _, ip := range ips {
+		names = append(names, "ip:"+ip.String())
+	}
+	for _, u := range uris {
+		names = append(names, "uri:"+u.String())
+	}
+	slices.Sort(names)
+	return names
+}
+
+func findExtension(exts []pkix.Extension, oid asn1.ObjectIdentifier) (pkix.Extension, bool) {
+	for _, ext := range exts {
+		if ext.Id.Equal(oid) {
+			return ext, true
+		}
+	}
+	return pkix.Extension{}, false
+}
+
+// getUsername returns the name of the EJBCA end entity used for a
+// certificate. It is the common name or the first SAN of the template.
+func getUsername(tpl *x509.Certificate) string {
+	switch {
+	case tpl.Subject.CommonName != "":
+		return tpl.Subject.CommonName
+	case len(tpl.DNSNames) > 0:
+		return tpl.DNSNames[0]
+	case len(tpl.EmailAddresses) > 0:
+		return tpl.EmailAddresses[0]
+	case len(tpl.IPAddresses) > 0:
+		return tpl.IPAddresses[0].String()
+	case len(tpl.URIs) > 0:
+		return tpl.URIs[0].String()
+	default:
+		sum := sha256.Sum256(tpl.RawSubjectPublicKeyInfo)
+		return hex.EncodeToString(sum[:])
+	}
+}
+
+// randomPassword returns the enrollment code used for the end entity.
+func randomPassword() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "error generating password")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeBytes decodes a value returned by EJBCA, it can be PEM or base64
+// encoded DER.
+func decodeBytes(s string) ([]byte, error) {
+	if block, _ := pem.Decode([]byte(s)); block != nil {
+		return block.Bytes, nil
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
+
+func parseCertificate(s string) (*x509.Certificate, error) {
+	b, err := decodeBytes(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding certificate")
+	}
+	cert, err := x509.ParseCertificate(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate")
+	}
+	return cert, nil
+}
+
+func parseCertificates(b []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	var block *pem.Block
+	for {
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			break
+		}
+		certs = append(certs, cert)
+	}
+	return certs
+}
+
+// isRoot returns true if the given certificate is a root certificate.
+func isRoot(cert *x509.Certificate) bool {
+	if cert.BasicConstraintsValid && cert.IsCA {
+		return cert.CheckSignatureFrom(cert) == nil
+	}
+	return false
+}
@@ -0,0 +1,565 @@
+package ejbcacas
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+const testCAName = "TestCA"
+
+// testEJBCA is a local stand-in of the EJBCA REST API that requires mTLS.
+type testEJBCA struct {
+	ca         *minica.CA
+	srv        *httptest.Server
+	options    Options
+	crl        []byte
+	enrollment *enrollRequest
+	revoked    string
+	reason     string
+}
+
+func newTestEJBCA(t *testing.T) *testEJBCA {
+	t.Helper()
+	ca, err := minica.New(minica.WithName("EJBCA"))
+	require.NoError(t, err)
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, ca.Intermediate, ca.Signer)
+	require.NoError(t, err)
+
+	e := &testEJBCA{ca: ca, crl: crl}
+	subjectDN := ca.Intermediate.Subject.String()
+
+	writeJSON := func(w http.ResponseWriter, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	writeError := func(w http.ResponseWriter, code int, msg string) {
+		w.WriteHeader(code)
+		writeJSON(w, errorResponse{ErrorCode: code, ErrorMessage: msg})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ejbca/ejbca-rest-api/v1/ca", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"certificate_authorities":[{"id":1,"name":"ManagementCA","subject_dn":"CN=ManagementCA"},{"id":2,"name":%q,"subject_dn":%q}]}`, testCAName, subjectDN)
+	})
+	mux.HandleFunc("GET /ejbca/ejbca-rest-api/v1/ca/{dn}/certificate/download", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("dn") != subjectDN {
+			writeError(w, http.StatusNotFound, "CA not found")
+			return
+		}
+		_ = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw})
+		_ = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw})
+	})
+	mux.HandleFunc("GET /ejbca/ejbca-rest-api/v1/ca/{dn}/getLatestCrl", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("dn") != subjectDN || r.URL.Query().Get("deltaCrl") != "false" {
+			writeError(w, http.StatusNotFound, "CRL not found")
+			return
+		}
+		writeJSON(w, crlResponse{CRL: base64.StdEncoding.EncodeToString(e.crl), ResponseFormat: "DER"})
+	})
+	mux.HandleFunc("POST /ejbca/ejbca-rest-api/v1/certificate/pkcs10enroll", func(w http.ResponseWriter, r *http.Request) {
+		var req enrollRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		block, _ := pem.Decode([]byte(req.CertificateRequest))
+		if block == nil {
+			writeError(w, http.StatusBadRequest, "bad certificate request")
+			return
+		}
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil || csr.Subject.CommonName == "fail" {
+			writeError(w, http.StatusBadRequest, "bad certificate request")
+			return
+		}
+		e.enrollment = &req
+		crt, err := ca.Sign(&x509.Certificate{
+			Subject:   csr.Subject,
+			DNSNames:  csr.DNSNames,
+			PublicKey: csr.PublicKey,
+		})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, enrollResponse{
+			Certificate:    base64.StdEncoding.EncodeToString(crt.Raw),
+			SerialNumber:   crt.SerialNumber.Text(16),
+			ResponseFormat: "DER",
+			CertificateChain: []string{
+				base64.StdEncoding.EncodeToString(ca.Intermediate.Raw),
+				base64.StdEncoding.EncodeToString(ca.Root.Raw),
+			},
+		})
+	})
+	mux.HandleFunc("PUT /ejbca/ejbca-rest-api/v1/certificate/{dn}/{sn}/revoke", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("dn") != subjectDN {
+			writeError(w, http.StatusNotFound, "CA not found")
+			return
+		}
+		e.revoked = r.PathValue("sn")
+		e.reason = r.URL.Query().Get("reason")
+		writeJSON(w, map[string]any{"serial_number": e.revoked, "revocation_reason": e.reason, "revoked": true})
+	})
+
+	// Client certificate used for mTLS.
+	dir := t.TempDir()
+	clientSigner, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	clientCrt, err := ca.Sign(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "step-ca"},
+		PublicKey:   clientSigner.Public(),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	require.NoError(t, err)
+	clientCertificate := filepath.Join(dir, "client.crt")
+	clientKey := filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(clientCertificate, append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientCrt.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw})...,
+	), 0600))
+	_, err = pemutil.Serialize(clientSigner, pemutil.ToFile(clientKey, 0600))
+	require.NoError(t, err)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.Root)
+	e.srv = httptest.NewUnstartedServer(mux)
+	e.srv.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+	e.srv.StartTLS()
+	t.Cleanup(e.srv.Close)
+
+	rootCA := filepath.Join(dir, "root_ca.crt")
+	require.NoError(t, os.WriteFile(rootCA, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: e.srv.Certificate().Raw}), 0600))
+
+	e.options = Options{
+		CertificateAuthorityName: testCAName,
+		CertificateProfile:       "ENDUSER",
+		EndEntityProfile:         "STEP",
+		Provisioners: map[string]Profile{
+			"acme": {CertificateProfile: "SERVER"},
+		},
+		ClientCertificate: clientCertificate,
+		ClientKey:         clientKey,
+		RootCA:            rootCA,
+	}
+	return e
+}
+
+func (e *testEJBCA) newCAS(t *testing.T) *EJBCACAS {
+	t.Helper()
+	c, err := New(context.Background(), apiv1.Options{
+		Type:                 apiv1.EJBCACAS,
+		CertificateAuthority: e.srv.URL,
+		Config:               mustMarshal(t, e.options),
+	})
+	require.NoError(t, err)
+	return c
+}
+
+func mustMarshal(t *testing.T, v any) json.RawMessage {
+	t.Helper()
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return b
+}
+
+func mustCertificateRequest(t *testing.T, commonName string, sans ...string) *x509.CertificateRequest {
+	t.Helper()
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	csr, err := x509util.CreateCertificateRequest(commonName, sans, signer)
+	require.NoError(t, err)
+	return csr
+}
+
+func TestNew(t *testing.T) {
+	e := newTestEJBCA(t)
+
+	withOptions := func(fn func(o *Options)) json.RawMessage {
+		o := e.options
+		fn(&o)
+		return mustMarshal(t, o)
+	}
+
+	tests := []struct {
+		name    string
+		opts    apiv1.Options
+		wantErr string
+	}{
+		{"ok", apiv1.Options{CertificateAuthority: e.srv.URL, Config: mustMarshal(t, e.options)}, ""},
+		{"ok ca getter", apiv1.Options{CertificateAuthority: e.srv.URL, IsCAGetter: true, Config: withOptions(func(o *Options) {
+			o.CertificateProfile = ""
+			o.EndEntityProfile = ""
+		})}, ""},
+		{"fail creator", apiv1.Options{CertificateAuthority: e.srv.URL, IsCreator: true, Config: mustMarshal(t, e.options)}, "ejbcaCAS does not support creating certificate authorities"},
+		{"fail certificateAuthority", apiv1.Options{Config: mustMarshal(t, e.options)}, "ejbcaCAS 'certificateAuthority' cannot be empty"},
+		{"fail certificateAuthority http", apiv1.Options{CertificateAuthority: "http://ejbca.example.com", Config: mustMarshal(t, e.options)}, "ejbcaCAS 'certificateAuthority' must be an https url"},
+		{"fail config", apiv1.Options{CertificateAuthority: e.srv.URL, Config: json.RawMessage(`{`)}, "error decoding ejbcaCAS config"},
+		{"fail certificateAuthorityName", apiv1.Options{CertificateAuthority: e.srv.URL, Config: withOptions(func(o *Options) {
+			o.CertificateAuthorityName = ""
+		})}, "ejbcaCAS 'certificateAuthorityName' cannot be empty"},
+		{"fail clientCertificate", apiv1.Options{CertificateAuthority: e.srv.URL, Config: withOptions(func(o *Options) {
+			o.ClientCertificate = ""
+		})}, "ejbcaCAS 'clientCertificate' cannot be empty"},
+		{"fail clientKey", apiv1.Options{CertificateAuthority: e.srv.URL, Config: withOptions(func(o *Options) {
+			o.ClientKey = ""
+		})}, "ejbcaCAS 'clientKey' cannot be empty"},
+		{"fail certificateProfile", apiv1.Options{CertificateAuthority: e.srv.URL, Config: withOptions(func(o *Options) {
+			o.CertificateProfile = ""
+		})}, "ejbcaCAS 'certificateProfile' cannot be empty"},
+		{"fail endEntityProfile", apiv1.Options{CertificateAuthority: e.srv.URL, Config: withOptions(func(o *Options) {
+			o.EndEntityProfile = ""
+		})}, "ejbcaCAS 'endEntityProfile' cannot be empty"},
+		{"fail client certificate", apiv1.Options{CertificateAuthority: e.srv.URL, Config: withOptions(func(o *Options) {
+			o.ClientKey = o.RootCA
+		})}, "error loading ejbcaCAS client certificate"},
+		{"fail rootCA", apiv1.Options{CertificateAuthority: e.srv.URL, Config: withOptions(func(o *Options) {
+			o.RootCA = "testdata/missing.crt"
+		})}, "error loading ejbcaCAS 'rootCA'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(context.Background(), tt.opts)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Empty(t, got.subjectDN)
+			assert.Equal(t, apiv1.Type(apiv1.EJBCACAS), got.Type())
+		})
+	}
+}
+
+func TestNew_register(t *testing.T) {
+	e := newTestEJBCA(t)
+	newFn, ok := apiv1.LoadCertificateAuthorityServiceNewFunc(apiv1.EJBCACAS)
+	require.True(t, ok)
+
+	got, err := newFn(context.Background(), apiv1.Options{
+		CertificateAuthority: e.srv.URL,
+		Config:               mustMarshal(t, e.options),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, apiv1.Type(apiv1.EJBCACAS), apiv1.TypeOf(got))
+}
+
+func TestEJBCACAS_getSubjectDN(t *testing.T) {
+	e := newTestEJBCA(t)
+	c := e.newCAS(t)
+
+	got, err := c.getSubjectDN()
+	require.NoError(t, err)
+	assert.Equal(t, e.ca.Intermediate.Subject.String(), got)
+	assert.Equal(t, got, c.subjectDN)
+
+	// Errors are not cached.
+	o := e.options
+	o.CertificateAuthorityName = "MissingCA"
+	c, err = New(context.Background(), apiv1.Options{CertificateAuthority: e.srv.URL, Config: mustMarshal(t, o)})
+	require.NoError(t, err)
+	_, err = c.getSubjectDN()
+	assert.EqualError(t, err, `ejbcaCAS certificate authority "MissingCA" was not found`)
+	_, err = c.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+	assert.EqualError(t, err, `ejbcaCAS certificate authority "MissingCA" was not found`)
+	c.config.CertificateAuthorityName = testCAName
+	got, err = c.getSubjectDN()
+	require.NoError(t, err)
+	assert.Equal(t, e.ca.Intermediate.Subject.String(), got)
+
+	o = e.options
+	o.RootCA = ""
+	c, err = New(context.Background(), apiv1.Options{CertificateAuthority: e.srv.URL, Config: mustMarshal(t, o)})
+	require.NoError(t, err)
+	_, err = c.getSubjectDN()
+	assert.ErrorContains(t, err, "ejbcaCAS error getting certificate authorities")
+}
+
+func TestEJBCACAS_GetCertificateAuthority(t *testing.T) {
+	e := newTestEJBCA(t)
+	c := e.newCAS(t)
+
+	got, err := c.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, &apiv1.GetCertificateAuthorityResponse{
+		RootCertificate:          e.ca.Root,
+		IntermediateCertificates: []*x509.Certificate{e.ca.Intermediate},
+	}, got)
+
+	sum := sha256.Sum256(e.ca.Root.Raw)
+	c.fingerprint = hex.EncodeToString(sum[:])
+	_, err = c.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+	require.NoError(t, err)
+
+	c.fingerprint = "0123456789abcdef"
+	_, err = c.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+	assert.EqualError(t, err, "ejbcaCAS error verifying root: fingerprint does not match")
+
+	c.subjectDN = "CN=Missing"
+	_, err = c.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+	assert.EqualError(t, err, "ejbcaCAS error getting CA certificate: ejbca responded with status code 404: CA not found")
+}
+
+func TestEJBCACAS_CreateCertificate(t *testing.T) {
+	e := newTestEJBCA(t)
+	c := e.newCAS(t)
+	csr := mustCertificateRequest(t, "test.smallstep.com", "test.smallstep.com")
+	template := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "test.smallstep.com"},
+		DNSNames: []string{"test.smallstep.com"},
+	}
+	failCSR := mustCertificateRequest(t, "fail")
+	failTemplate := &x509.Certificate{Subject: pkix.Name{CommonName: "fail"}}
+
+	tests := []struct {
+		name        string
+		req         *apiv1.CreateCertificateRequest
+		wantProfile Profile
+		wantErr     bool
+	}{
+		{"ok", &apiv1.CreateCertificateRequest{
+			Template: template, CSR: csr,
+		}, Profile{CertificateProfile: "ENDUSER", EndEntityProfile: "STEP"}, false},
+		{"ok provisioner", &apiv1.CreateCertificateRequest{
+			Template: template, CSR: csr, Provisioner: &apiv1.ProvisionerInfo{Name: "acme"},
+		}, Profile{CertificateProfile: "SERVER", EndEntityProfile: "STEP"}, false},
+		{"ok other provisioner", &apiv1.CreateCertificateRequest{
+			Template: template, CSR: csr, Provisioner: &apiv1.ProvisionerInfo{Name: "jwk"},
+		}, Profile{CertificateProfile: "ENDUSER", EndEntityProfile: "STEP"}, false},
+		{"fail csr", &apiv1.CreateCertificateRequest{Template: template}, Profile{}, true},
+		{"fail template", &apiv1.CreateCertificateRequest{CSR: csr}, Profile{}, true},
+		{"fail subject", &apiv1.CreateCertificateRequest{
+			Template: &x509.Certificate{Subject: pkix.Name{CommonName: "other.smallstep.com"}, DNSNames: []string{"test.smallstep.com"}}, CSR: csr,
+		}, Profile{}, true},
+		{"fail sans", &apiv1.CreateCertificateRequest{
+			Template: &x509.Certificate{Subject: pkix.Name{CommonName: "test.smallstep.com"}, DNSNames: []string{"test.smallstep.com", "other.smallstep.com"}}, CSR: csr,
+		}, Profile{}, true},
+		{"fail enroll", &apiv1.CreateCertificateRequest{
+			Template: failTemplate, CSR: failCSR,
+		}, Profile{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.CreateCertificate(tt.req)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, csr.PublicKey, got.Certificate.PublicKey)
+			assert.Equal(t, []*x509.Certificate{e.ca.Intermediate}, got.CertificateChain)
+
+			assert.Equal(t, tt.wantProfile.CertificateProfile, e.enrollment.CertificateProfileName)
+			assert.Equal(t, tt.wantProfile.EndEntityProfile, e.enrollment.EndEntityProfileName)
+			assert.Equal(t, testCAName, e.enrollment.CertificateAuthorityName)
+			assert.Equal(t, "test.smallstep.com", e.enrollment.Username)
+			assert.NotEmpty(t, e.enrollment.Password)
+			assert.True(t, e.enrollment.IncludeChain)
+		})
+	}
+}
+
+func TestEJBCACAS_RenewCertificate(t *testing.T) {
+	e := newTestEJBCA(t)
+	c := e.newCAS(t)
+	csr := mustCertificateRequest(t, "test.smallstep.com")
+	template := &x509.Certificate{Subject: pkix.Name{CommonName: "test.smallstep.com"}}
+
+	got, err := c.RenewCertificate(&apiv1.RenewCertificateRequest{Template: template, CSR: csr})
+	require.NoError(t, err)
+	assert.Equal(t, csr.PublicKey, got.Certificate.PublicKey)
+	assert.Equal(t, "ENDUSER", e.enrollment.CertificateProfileName)
+
+	got, err = c.RenewCertificate(&apiv1.RenewCertificateRequest{
+		Template: template, CSR: csr, Provisioner: &apiv1.ProvisionerInfo{Name: "acme"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, csr.PublicKey, got.Certificate.PublicKey)
+	assert.Equal(t, "SERVER", e.enrollment.CertificateProfileName)
+	assert.Equal(t, "STEP", e.enrollment.EndEntityProfileName)
+
+	_, err = c.RenewCertificate(&apiv1.RenewCertificateRequest{
+		Template: &x509.Certificate{Subject: pkix.Name{CommonName: "other.smallstep.com"}}, CSR: csr,
+	})
+	var ve apiv1.ValidationError
+	assert.ErrorAs(t, err, &ve)
+
+	_, err = c.RenewCertificate(&apiv1.RenewCertificateRequest{Template: template})
+	var nie apiv1.NotImplementedError
+	assert.ErrorAs(t, err, &nie)
+
+	_, err = c.RenewCertificate(&apiv1.RenewCertificateRequest{CSR: csr})
+	assert.Error(t, err)
+}
+
+func TestEJBCACAS_RevokeCertificate(t *testing.T) {
+	e := newTestEJBCA(t)
+	c := e.newCAS(t)
+	cert, err := e.ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "test.smallstep.com"},
+		PublicKey: mustCertificateRequest(t, "test.smallstep.com").PublicKey,
+	})
+	require.NoError(t, err)
+	other := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Issuer:       pkix.Name{CommonName: "Other CA"},
+	}
+
+	tests := []struct {
+		name       string
+		req        *apiv1.RevokeCertificateRequest
+		wantSerial string
+		wantReason string
+		wantErr    bool
+	}{
+		{"ok certificate", &apiv1.RevokeCertificateRequest{Certificate: cert, ReasonCode: 1}, cert.SerialNumber.Text(16), "KEY_COMPROMISE", false},
+		{"ok serial number", &apiv1.RevokeCertificateRequest{SerialNumber: "255", ReasonCode: 6}, "ff", "CERTIFICATE_HOLD", false},
+		{"fail reason", &apiv1.RevokeCertificateRequest{Certificate: cert, ReasonCode: 7}, "", "", true},
+		{"fail empty", &apiv1.RevokeCertificateRequest{}, "", "", true},
+		{"fail serial number", &apiv1.RevokeCertificateRequest{SerialNumber: "0xff"}, "", "", true},
+		{"fail issuer", &apiv1.RevokeCertificateRequest{Certificate: other}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.RevokeCertificate(tt.req)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.req.Certificate, got.Certificate)
+			assert.Equal(t, tt.wantSerial, e.revoked)
+			assert.Equal(t, tt.wantReason, e.reason)
+		})
+	}
+}
+
+func TestEJBCACAS_CreateCRL(t *testing.T) {
+	e := newTestEJBCA(t)
+	c := e.newCAS(t)
+
+	got, err := c.CreateCRL(&apiv1.CreateCRLRequest{RevocationList: &x509.RevocationList{}})
+	require.NoError(t, err)
+	assert.Equal(t, &apiv1.CreateCRLResponse{CRL: e.crl}, got)
+
+	e.crl = []byte("not a crl")
+	_, err = c.CreateCRL(&apiv1.CreateCRLRequest{RevocationList: &x509.RevocationList{}})
+	assert.ErrorContains(t, err, "ejbcaCAS error parsing CRL")
+
+	c.subjectDN = "CN=Missing"
+	_, err = c.CreateCRL(&apiv1.CreateCRLRequest{RevocationList: &x509.RevocationList{}})
+	assert.ErrorContains(t, err, "ejbcaCAS error getting CRL")
+}
+
+func Test_apiError(t *testing.T) {
+	err := &apiError{Status: http.StatusBadRequest}
+	assert.EqualError(t, err, "ejbca responded with status code 400")
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode())
+}
+
+func Test_validateCertificateRequest(t *testing.T) {
+	uri, err := url.Parse("spiffe://example.com/test")
+	require.NoError(t, err)
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	csr, err := x509util.CreateCertificateRequest("test", []string{
+		"test.smallstep.com", "test@smallstep.com", "127.0.0.1", uri.String(),
+	}, signer)
+	require.NoError(t, err)
+
+	var sanExtension pkix.Extension
+	for _, ext := range csr.Extensions {
+		if ext.Id.Equal(oidExtensionSubjectAltName) {
+			sanExtension = ext
+		}
+	}
+
+	tests := []struct {
+		name    string
+		tpl     *x509.Certificate
+		wantErr bool
+	}{
+		{"ok", &x509.Certificate{
+			Subject:        pkix.Name{CommonName: "test"},
+			DNSNames:       []string{"test.smallstep.com"},
+			EmailAddresses: []string{"test@smallstep.com"},
+			IPAddresses:    []net.IP{net.ParseIP("127.0.0.1")},
+			URIs:           []*url.URL{uri},
+		}, false},
+		{"ok order", &x509.Certificate{
+			Subject:        pkix.Name{CommonName: "test"},
+			URIs:           []*url.URL{uri},
+			IPAddresses:    []net.IP{net.ParseIP("127.0.0.1")},
+			EmailAddresses: []string{"test@smallstep.com"},
+			DNSNames:       []string{"test.smallstep.com"},
+		}, false},
+		{"ok san extension", &x509.Certificate{
+			Subject:         pkix.Name{CommonName: "test"},
+			ExtraExtensions: []pkix.Extension{sanExtension},
+		}, false},
+		{"fail subject", &x509.Certificate{
+			Subject:        pkix.Name{CommonName: "test", Organization: []string{"Smallstep"}},
+			DNSNames:       []string{"test.smallstep.com"},
+			EmailAddresses: []string{"test@smallstep.com"},
+			IPAddresses:    []net.IP{net.ParseIP("127.0.0.1")},
+			URIs:           []*url.URL{uri},
+		}, true},
+		{"fail missing san", &x509.Certificate{
+			Subject:        pkix.Name{CommonName: "test"},
+			DNSNames:       []string{"test.smallstep.com"},
+			EmailAddresses: []string{"test@smallstep.com"},
+			IPAddresses:    []net.IP{net.ParseIP("127.0.0.1")},
+		}, true},
+		{"fail san extension", &x509.Certificate{
+			Subject:         pkix.Name{CommonName: "test"},
+			ExtraExtensions: []pkix.Extension{{Id: oidExtensionSubjectAltName, Value: []byte("san")}},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCertificateRequest(tt.tpl, csr)
+			if tt.wantErr {
+				var ve apiv1.ValidationError
+				assert.ErrorAs(t, err, &ve)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
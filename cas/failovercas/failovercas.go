@@ -0,0 +1,522 @@
+package failovercas
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+func init() {
+	apiv1.Register(apiv1.FailoverCAS, func(ctx context.Context, opts apiv1.Options) (apiv1.CertificateAuthorityService, error) {
+		return New(ctx, opts)
+	})
+}
+
+var now = time.Now
+
+// Default values of the failover options.
+const (
+	DefaultFailureThreshold    = 3
+	DefaultResetTimeout        = 30 * time.Second
+	DefaultHealthCheckInterval = time.Minute
+)
+
+// Options defines the configuration options added using the
+// apiv1.Options.Config field.
+type Options struct {
+	Backends            []BackendOptions `json:"backends"`
+	FailureThreshold    int              `json:"failureThreshold,omitempty"`
+	ResetTimeout        Duration         `json:"resetTimeout,omitempty"`
+	HealthCheckInterval Duration         `json:"healthCheckInterval,omitempty"`
+}
+
+// BackendOptions are the options of a backend. They are the same options used
+// to configure a CAS with an additional name.
+type BackendOptions struct {
+	Name string `json:"name"`
+	apiv1.Options
+}
+
+// Duration is a wrapper around time.Duration that unmarshals strings like
+// "30s" or "1m". A negative health check interval disables the health checks.
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parses a duration string.
+func (d *Duration) UnmarshalJSON(data []byte) (err error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("error unmarshaling %s: %w", data, err)
+	}
+	if d.Duration, err = time.ParseDuration(s); err != nil {
+		return fmt.Errorf("error parsing %s as duration: %w", s, err)
+	}
+	return nil
+}
+
+// MarshalJSON returns the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Duration.String())
+}
+
+// FailoverCAS implements a Certificate Authority Service that signs
+// certificates with the first healthy backend of an ordered list. Each backend
+// has a circuit breaker that opens after a number of consecutive failures,
+// and it is closed again after a successful health check or after a timeout.
+type FailoverCAS struct {
+	backends         []*backend
+	store            apiv1.CertificateBackendStore
+	failureThreshold int
+	resetTimeout     time.Duration
+	cancel           context.CancelFunc
+}
+
+// backend is a CAS with a circuit breaker.
+type backend struct {
+	name      string
+	typ       apiv1.Type
+	reference string
+	service   apiv1.CertificateAuthorityService
+
+	mu            sync.Mutex
+	failures      int
+	openedAt      time.Time
+	lastErr       error
+	checkedAt     time.Time
+	intermediates []*x509.Certificate
+}
+
+// New creates a new CertificateAuthorityService that fails over between the
+// configured backends.
+func New(ctx context.Context, opts apiv1.Options) (*FailoverCAS, error) {
+	var o Options
+	if opts.Config != nil {
+		if err := json.Unmarshal(opts.Config, &o); err != nil {
+			return nil, fmt.Errorf("error decoding failoverCAS config: %w", err)
+		}
+	}
+
+	switch {
+	case len(o.Backends) == 0:
+		return nil, errors.New("failoverCAS 'backends' cannot be empty")
+	case o.FailureThreshold < 0:
+		return nil, errors.New("failoverCAS 'failureThreshold' cannot be negative")
+	case o.ResetTimeout.Duration < 0:
+		return nil, errors.New("failoverCAS 'resetTimeout' cannot be negative")
+	}
+	if o.FailureThreshold == 0 {
+		o.FailureThreshold = DefaultFailureThreshold
+	}
+	if o.ResetTimeout.Duration == 0 {
+		o.ResetTimeout.Duration = DefaultResetTimeout
+	}
+	if o.HealthCheckInterval.Duration == 0 {
+		o.HealthCheckInterval.Duration = DefaultHealthCheckInterval
+	}
+
+	c := &FailoverCAS{
+		store:            opts.BackendStore,
+		failureThreshold: o.FailureThreshold,
+		resetTimeout:     o.ResetTimeout.Duration,
+	}
+	names := make(map[string]bool, len(o.Backends))
+	for _, bo := range o.Backends {
+		switch {
+		case bo.Name == "":
+			return nil, errors.New("failoverCAS backend 'name' cannot be empty")
+		case names[bo.Name]:
+			return nil, fmt.Errorf("failoverCAS backend name %q is duplicated", bo.Name)
+		case apiv1.Type(bo.Type).String() == apiv1.FailoverCAS:
+			return nil, fmt.Errorf("failoverCAS backend %q cannot be a failoverCAS", bo.Name)
+		}
+		names[bo.Name] = true
+
+		svc, err := newBackendService(ctx, opts, bo.Options)
+		if err != nil {
+			return nil, fmt.Errorf("error initializing failoverCAS backend %q: %w", bo.Name, err)
+		}
+		b := &backend{
+			name:      bo.Name,
+			typ:       apiv1.Type(bo.Type),
+			reference: bo.CertificateAuthority,
+			service:   svc,
+		}
+		// Backends that cannot report their intermediates sign with the
+		// certificate chain of the authority.
+		if _, ok := svc.(apiv1.CertificateAuthorityGetter); !ok {
+			b.intermediates = opts.CertificateChain
+		}
+		c.backends = append(c.backends, b)
+	}
+
+	if o.HealthCheckInterval.Duration > 0 {
+		ctx, c.cancel = context.WithCancel(ctx)
+		go c.runHealthChecks(ctx, o.HealthCheckInterval.Duration)
+	}
+
+	return c, nil
+}
+
+// newBackendService creates a backend using the given options. The properties
+// not available in the JSON configuration are inherited from the failover
+// options.
+func newBackendService(ctx context.Context, parent, opts apiv1.Options) (apiv1.CertificateAuthorityService, error) {
+	opts.AuthorityID = parent.AuthorityID
+	opts.CertificateChain = parent.CertificateChain
+	opts.Signer = parent.Signer
+	opts.CertificateSigner = parent.CertificateSigner
+	opts.KeyManager = parent.KeyManager
+	opts.IsCAGetter = parent.IsCAGetter
+
+	t := apiv1.Type(opts.Type)
+	if t == apiv1.DefaultCAS {
+		t = apiv1.SoftCAS
+	}
+	fn, ok := apiv1.LoadCertificateAuthorityServiceNewFunc(t)
+	if !ok {
+		return nil, fmt.Errorf("unsupported cas type %q", t)
+	}
+	return fn(ctx, opts)
+}
+
+// Type returns the type of this CertificateAuthorityService.
+func (c *FailoverCAS) Type() apiv1.Type {
+	return apiv1.FailoverCAS
+}
+
+// CreateCertificate signs a new certificate using the first healthy backend.
+func (c *FailoverCAS) CreateCertificate(req *apiv1.CreateCertificateRequest) (*apiv1.CreateCertificateResponse, error) {
+	var resp *apiv1.CreateCertificateResponse
+	b, err := c.failover(func(b *backend) (err error) {
+		// Backends can modify the template, each one gets a copy.
+		r := *req
+		if req.Template != nil {
+			tmpl := *req.Template
+			r.Template = &tmpl
+		}
+		resp, err = b.service.CreateCertificate(&r)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.storeBackend(resp.Certificate.SerialNumber.String(), b)
+	return resp, nil
+}
+
+// RenewCertificate renews a certificate using the first healthy backend.
+func (c *FailoverCAS) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
+	var resp *apiv1.RenewCertificateResponse
+	b, err := c.failover(func(b *backend) (err error) {
+		r := *req
+		if req.Template != nil {
+			tmpl := *req.Template
+			r.Template = &tmpl
+		}
+		resp, err = b.service.RenewCertificate(&r)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.storeBackend(resp.Certificate.SerialNumber.String(), b)
+	return resp, nil
+}
+
+// RevokeCertificate revokes a certificate using the backend that issued it.
+// If the backend is not stored, it is the one with an intermediate that
+// issued the certificate. The certificate is never revoked by other backends,
+// as some of them, like softcas, accept any revocation.
+func (c *FailoverCAS) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1.RevokeCertificateResponse, error) {
+	b := c.lookupBackend(req)
+	if b == nil {
+		b = c.lookupIssuingBackend(req.Certificate)
+	}
+	if b == nil {
+		sn := req.SerialNumber
+		if req.Certificate != nil {
+			sn = req.Certificate.SerialNumber.String()
+		}
+		return nil, fmt.Errorf("failoverCAS cannot determine the backend of certificate %s", sn)
+	}
+
+	resp, err := b.service.RevokeCertificate(req)
+	c.record(b, err)
+	return resp, err
+}
+
+// GetCertificateAuthority implements [apiv1.CertificateAuthorityGetter] and
+// returns the root certificate of the first backend that provides it, and
+// the intermediates of all the backends.
+func (c *FailoverCAS) GetCertificateAuthority(*apiv1.GetCertificateAuthorityRequest) (*apiv1.GetCertificateAuthorityResponse, error) {
+	var errs []error
+	var resp *apiv1.GetCertificateAuthorityResponse
+	for _, b := range c.backends {
+		getter, ok := b.service.(apiv1.CertificateAuthorityGetter)
+		if !ok {
+			continue
+		}
+		r, err := getter.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{
+			Name: b.reference,
+		})
+		c.record(b, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("backend %q: %w", b.name, err))
+			continue
+		}
+		b.setIntermediates(r.IntermediateCertificates)
+		if resp == nil {
+			resp = &apiv1.GetCertificateAuthorityResponse{
+				RootCertificate: r.RootCertificate,
+			}
+		}
+		resp.IntermediateCertificates = append(resp.IntermediateCertificates, r.IntermediateCertificates...)
+	}
+	if resp == nil {
+		if len(errs) == 0 {
+			return nil, apiv1.NotImplementedError{Message: "failoverCAS backends do not implement getCertificateAuthority"}
+		}
+		return nil, errors.Join(errs...)
+	}
+	return resp, nil
+}
+
+// GetHealth implements [apiv1.CertificateAuthorityHealthReporter] and returns
+// the health of the backends.
+func (c *FailoverCAS) GetHealth() []apiv1.BackendHealth {
+	health := make([]apiv1.BackendHealth, 0, len(c.backends))
+	for _, b := range c.backends {
+		b.mu.Lock()
+		h := apiv1.BackendHealth{
+			Name:      b.name,
+			Type:      b.typ.String(),
+			Healthy:   b.openedAt.IsZero(),
+			CheckedAt: b.checkedAt,
+		}
+		if b.lastErr != nil {
+			h.Error = b.lastErr.Error()
+		}
+		b.mu.Unlock()
+		health = append(health, h)
+	}
+	return health
+}
+
+// Close implements [apiv1.CertificateAuthorityCloser] and stops the health
+// checks.
+func (c *FailoverCAS) Close() error {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	return nil
+}
+
+// failover runs fn with the available backends in order until one succeeds.
+// Errors caused by the request are returned without trying other backends.
+func (c *FailoverCAS) failover(fn func(*backend) error) (*backend, error) {
+	var errs []error
+	for _, b := range c.backends {
+		if !c.isAvailable(b) {
+			continue
+		}
+		err := fn(b)
+		if err == nil {
+			c.record(b, nil)
+			return b, nil
+		}
+		if isRequestError(err) {
+			return nil, err
+		}
+		c.record(b, err)
+		errs = append(errs, fmt.Errorf("backend %q: %w", b.name, err))
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("failoverCAS has no available backends")
+	}
+	return nil, errors.Join(errs...)
+}
+
+// isAvailable returns true if the circuit breaker of the backend is closed,
+// or if it has been open for more than the reset timeout.
+func (c *FailoverCAS) isAvailable(b *backend) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.openedAt.IsZero() || now().Sub(b.openedAt) >= c.resetTimeout
+}
+
+// record updates the circuit breaker of the backend with the result of an
+// operation.
+func (c *FailoverCAS) record(b *backend, err error) {
+	if err != nil && isRequestError(err) {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checkedAt = now()
+	b.lastErr = err
+	if err == nil {
+		b.failures = 0
+		b.openedAt = time.Time{}
+		return
+	}
+	b.failures++
+	if b.failures >= c.failureThreshold {
+		b.openedAt = b.checkedAt
+	}
+}
+
+// lookupBackend returns the backend that issued the certificate in the
+// request, or nil if it is not known.
+func (c *FailoverCAS) lookupBackend(req *apiv1.RevokeCertificateRequest) *backend {
+	if c.store == nil {
+		return nil
+	}
+	sn := req.SerialNumber
+	if req.Certificate != nil {
+		sn = req.Certificate.SerialNumber.String()
+	}
+	name, err := c.store.GetCertificateBackend(sn)
+	if err != nil {
+		return nil
+	}
+	for _, b := range c.backends {
+		if b.name == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// lookupIssuingBackend returns the only backend with an intermediate that
+// issued the given certificate, or nil if there is none or there are several
+// of them. The intermediates of the backends that implement
+// [apiv1.CertificateAuthorityGetter] are retrieved if they are not known yet.
+func (c *FailoverCAS) lookupIssuingBackend(crt *x509.Certificate) *backend {
+	if crt == nil {
+		return nil
+	}
+	var found *backend
+	for _, b := range c.backends {
+		for _, ca := range c.getIntermediates(b) {
+			if isIssuedBy(crt, ca) {
+				if found != nil {
+					return nil
+				}
+				found = b
+				break
+			}
+		}
+	}
+	return found
+}
+
+// getIntermediates returns the intermediates of the backend.
+func (c *FailoverCAS) getIntermediates(b *backend) []*x509.Certificate {
+	b.mu.Lock()
+	intermediates := b.intermediates
+	b.mu.Unlock()
+	if len(intermediates) > 0 {
+		return intermediates
+	}
+
+	getter, ok := b.service.(apiv1.CertificateAuthorityGetter)
+	if !ok {
+		return nil
+	}
+	resp, err := getter.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{
+		Name: b.reference,
+	})
+	c.record(b, err)
+	if err != nil {
+		return nil
+	}
+	b.setIntermediates(resp.IntermediateCertificates)
+	return resp.IntermediateCertificates
+}
+
+// setIntermediates caches the intermediates reported by the backend.
+func (b *backend) setIntermediates(intermediates []*x509.Certificate) {
+	if len(intermediates) == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.intermediates = intermediates
+	b.mu.Unlock()
+}
+
+// isIssuedBy returns true if the issuer and authority key identifier of the
+// certificate match the subject and subject key identifier of the given CA.
+func isIssuedBy(crt, ca *x509.Certificate) bool {
+	if !bytes.Equal(crt.RawIssuer, ca.RawSubject) {
+		return false
+	}
+	if len(crt.AuthorityKeyId) > 0 && len(ca.SubjectKeyId) > 0 {
+		return bytes.Equal(crt.AuthorityKeyId, ca.SubjectKeyId)
+	}
+	return true
+}
+
+// storeBackend stores the backend that issued a certificate. The certificate
+// is already signed, so errors are only logged.
+func (c *FailoverCAS) storeBackend(serialNumber string, b *backend) {
+	if c.store == nil {
+		return
+	}
+	if err := c.store.StoreCertificateBackend(serialNumber, b.name); err != nil {
+		log.Printf("failoverCAS: error storing backend of certificate %s: %v", serialNumber, err)
+	}
+}
+
+// runHealthChecks checks the health of the backends periodically until the
+// context is done.
+func (c *FailoverCAS) runHealthChecks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.checkHealth()
+		}
+	}
+}
+
+// checkHealth uses GetCertificateAuthority to check the health of the
+// backends that implement it.
+func (c *FailoverCAS) checkHealth() {
+	for _, b := range c.backends {
+		getter, ok := b.service.(apiv1.CertificateAuthorityGetter)
+		if !ok {
+			continue
+		}
+		resp, err := getter.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{
+			Name: b.reference,
+		})
+		c.record(b, err)
+		if err == nil {
+			b.setIntermediates(resp.IntermediateCertificates)
+		}
+	}
+}
+
+// isRequestError returns true if the error is caused by the request, and
+// other backends will fail in the same way.
+func isRequestError(err error) bool {
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) {
+		code := sc.StatusCode()
+		return code >= 400 && code < 500
+	}
+	return false
+}
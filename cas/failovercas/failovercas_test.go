@@ -0,0 +1,369 @@
+package failovercas
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+const mockCAS = apiv1.Type("mockcas")
+
+// mockBackends are the backends created by the mockcas type, indexed by the
+// certificateAuthority option.
+var mockBackends = map[string]*mockBackend{}
+
+func init() {
+	apiv1.Register(mockCAS, func(_ context.Context, opts apiv1.Options) (apiv1.CertificateAuthorityService, error) {
+		if b, ok := mockBackends[opts.CertificateAuthority]; ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("mock backend %s not found", opts.CertificateAuthority)
+	})
+}
+
+type mockBackend struct {
+	serial   int64
+	root     *x509.Certificate
+	err      error
+	calls    int
+	revoked  []string
+	getCalls int
+}
+
+func (m *mockBackend) CreateCertificate(*apiv1.CreateCertificateRequest) (*apiv1.CreateCertificateResponse, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &apiv1.CreateCertificateResponse{
+		Certificate: &x509.Certificate{SerialNumber: big.NewInt(m.serial)},
+	}, nil
+}
+
+func (m *mockBackend) RenewCertificate(*apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &apiv1.RenewCertificateResponse{
+		Certificate: &x509.Certificate{SerialNumber: big.NewInt(m.serial)},
+	}, nil
+}
+
+func (m *mockBackend) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1.RevokeCertificateResponse, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.revoked = append(m.revoked, req.SerialNumber)
+	return &apiv1.RevokeCertificateResponse{}, nil
+}
+
+func (m *mockBackend) GetCertificateAuthority(*apiv1.GetCertificateAuthorityRequest) (*apiv1.GetCertificateAuthorityResponse, error) {
+	m.getCalls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &apiv1.GetCertificateAuthorityResponse{
+		RootCertificate:          m.root,
+		IntermediateCertificates: []*x509.Certificate{m.intermediate()},
+	}, nil
+}
+
+// intermediate returns a fake intermediate with a subject and a subject key
+// identifier based on the serial number.
+func (m *mockBackend) intermediate() *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber: big.NewInt(m.serial),
+		RawSubject:   []byte(fmt.Sprintf("intermediate-%d", m.serial)),
+		SubjectKeyId: []byte{byte(m.serial)},
+	}
+}
+
+// issue returns a fake certificate issued by the intermediate of the backend.
+func (m *mockBackend) issue(serial int64) *x509.Certificate {
+	ca := m.intermediate()
+	return &x509.Certificate{
+		SerialNumber:   big.NewInt(serial),
+		RawIssuer:      ca.RawSubject,
+		AuthorityKeyId: ca.SubjectKeyId,
+	}
+}
+
+type mockStore map[string]string
+
+func (m mockStore) StoreCertificateBackend(serialNumber, backend string) error {
+	m[serialNumber] = backend
+	return nil
+}
+
+func (m mockStore) GetCertificateBackend(serialNumber string) (string, error) {
+	if name, ok := m[serialNumber]; ok {
+		return name, nil
+	}
+	return "", errors.New("not found")
+}
+
+func mockNow(t *testing.T, tm *time.Time) {
+	t.Helper()
+	tmp := now
+	now = func() time.Time {
+		return *tm
+	}
+	t.Cleanup(func() {
+		now = tmp
+	})
+}
+
+func newTestFailoverCAS(t *testing.T, store apiv1.CertificateBackendStore, config string) (*FailoverCAS, *mockBackend, *mockBackend) {
+	t.Helper()
+	primary := &mockBackend{serial: 1, root: &x509.Certificate{SerialNumber: big.NewInt(100)}}
+	secondary := &mockBackend{serial: 2, root: &x509.Certificate{SerialNumber: big.NewInt(200)}}
+	mockBackends["primary"] = primary
+	mockBackends["secondary"] = secondary
+	t.Cleanup(func() {
+		delete(mockBackends, "primary")
+		delete(mockBackends, "secondary")
+	})
+
+	c, err := New(context.Background(), apiv1.Options{
+		Type:         apiv1.FailoverCAS,
+		BackendStore: store,
+		Config:       json.RawMessage(config),
+	})
+	require.NoError(t, err)
+	return c, primary, secondary
+}
+
+const testConfig = `{
+	"backends": [
+		{"name": "primary", "type": "mockcas", "certificateAuthority": "primary"},
+		{"name": "secondary", "type": "mockcas", "certificateAuthority": "secondary"}
+	],
+	"failureThreshold": 2,
+	"resetTimeout": "1m",
+	"healthCheckInterval": "-1s"
+}`
+
+func TestNew(t *testing.T) {
+	mockBackends["primary"] = &mockBackend{}
+	t.Cleanup(func() {
+		delete(mockBackends, "primary")
+	})
+
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{"ok", `{"backends":[{"name":"primary","type":"mockcas","certificateAuthority":"primary"}],"healthCheckInterval":"-1s"}`, ""},
+		{"fail/json", `{`, "error decoding failoverCAS config"},
+		{"fail/backends", `{}`, "failoverCAS 'backends' cannot be empty"},
+		{"fail/failureThreshold", `{"backends":[{"name":"primary"}],"failureThreshold":-1}`, "failoverCAS 'failureThreshold' cannot be negative"},
+		{"fail/resetTimeout", `{"backends":[{"name":"primary"}],"resetTimeout":"-1s"}`, "failoverCAS 'resetTimeout' cannot be negative"},
+		{"fail/duration", `{"backends":[{"name":"primary"}],"resetTimeout":"foo"}`, "error decoding failoverCAS config"},
+		{"fail/name", `{"backends":[{"type":"mockcas"}]}`, "failoverCAS backend 'name' cannot be empty"},
+		{"fail/duplicated", `{"backends":[{"name":"primary","type":"mockcas","certificateAuthority":"primary"},{"name":"primary","type":"mockcas","certificateAuthority":"primary"}],"healthCheckInterval":"-1s"}`, `failoverCAS backend name "primary" is duplicated`},
+		{"fail/failovercas", `{"backends":[{"name":"primary","type":"failovercas"}]}`, `failoverCAS backend "primary" cannot be a failoverCAS`},
+		{"fail/type", `{"backends":[{"name":"primary","type":"foocas"}]}`, `unsupported cas type "foocas"`},
+		{"fail/backend", `{"backends":[{"name":"primary","type":"mockcas","certificateAuthority":"missing"}]}`, "mock backend missing not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(context.Background(), apiv1.Options{
+				Type:   apiv1.FailoverCAS,
+				Config: json.RawMessage(tt.config),
+			})
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, DefaultFailureThreshold, got.failureThreshold)
+			assert.Equal(t, DefaultResetTimeout, got.resetTimeout)
+			assert.Equal(t, apiv1.Type(apiv1.FailoverCAS), got.Type())
+		})
+	}
+}
+
+func TestFailoverCAS_CreateCertificate(t *testing.T) {
+	tm := time.Now()
+	mockNow(t, &tm)
+	store := mockStore{}
+	c, primary, secondary := newTestFailoverCAS(t, store, testConfig)
+
+	// Primary is used while healthy.
+	resp, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(1), resp.Certificate.SerialNumber)
+	assert.Equal(t, "primary", store["1"])
+
+	// Fail over to the secondary.
+	primary.err = errors.New("unavailable")
+	for range 2 {
+		resp, err = c.CreateCertificate(&apiv1.CreateCertificateRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, big.NewInt(2), resp.Certificate.SerialNumber)
+	}
+	assert.Equal(t, "secondary", store["2"])
+	assert.Equal(t, 3, primary.calls)
+
+	// The circuit of the primary is open.
+	renewed, err := c.RenewCertificate(&apiv1.RenewCertificateRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(2), renewed.Certificate.SerialNumber)
+	assert.Equal(t, 3, primary.calls)
+
+	health := c.GetHealth()
+	require.Len(t, health, 2)
+	assert.Equal(t, apiv1.BackendHealth{Name: "primary", Type: "mockcas", Healthy: false, Error: "unavailable", CheckedAt: tm}, health[0])
+	assert.Equal(t, apiv1.BackendHealth{Name: "secondary", Type: "mockcas", Healthy: true, CheckedAt: tm}, health[1])
+
+	// Request errors are not retried.
+	secondary.err = apiv1.ValidationError{Message: "bad request"}
+	_, err = c.CreateCertificate(&apiv1.CreateCertificateRequest{})
+	assert.EqualError(t, err, "bad request")
+	assert.True(t, c.GetHealth()[1].Healthy)
+
+	// All the backends fail.
+	secondary.err = errors.New("unavailable")
+	_, err = c.CreateCertificate(&apiv1.CreateCertificateRequest{})
+	assert.EqualError(t, err, `backend "secondary": unavailable`)
+	_, err = c.CreateCertificate(&apiv1.CreateCertificateRequest{})
+	assert.Error(t, err)
+	_, err = c.CreateCertificate(&apiv1.CreateCertificateRequest{})
+	assert.EqualError(t, err, "failoverCAS has no available backends")
+
+	// The circuit is half-open after the reset timeout.
+	tm = tm.Add(time.Minute)
+	primary.err = nil
+	resp, err = c.CreateCertificate(&apiv1.CreateCertificateRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(1), resp.Certificate.SerialNumber)
+	assert.True(t, c.GetHealth()[0].Healthy)
+}
+
+func TestFailoverCAS_RevokeCertificate(t *testing.T) {
+	store := mockStore{"1": "primary", "2": "secondary", "3": "unknown"}
+	c, primary, secondary := newTestFailoverCAS(t, store, testConfig)
+
+	_, err := c.RevokeCertificate(&apiv1.RevokeCertificateRequest{SerialNumber: "2"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2"}, secondary.revoked)
+	assert.Equal(t, 0, primary.calls)
+
+	_, err = c.RevokeCertificate(&apiv1.RevokeCertificateRequest{
+		Certificate:  &x509.Certificate{SerialNumber: big.NewInt(1)},
+		SerialNumber: "1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, primary.revoked)
+
+	// The issuing backend is unavailable.
+	secondary.err = errors.New("unavailable")
+	_, err = c.RevokeCertificate(&apiv1.RevokeCertificateRequest{SerialNumber: "2"})
+	assert.EqualError(t, err, "unavailable")
+
+	// Unknown backends are found using the issuer of the certificate.
+	secondary.err = nil
+	_, err = c.RevokeCertificate(&apiv1.RevokeCertificateRequest{
+		Certificate:  secondary.issue(4),
+		SerialNumber: "4",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2", "4"}, secondary.revoked)
+	assert.Equal(t, []string{"1"}, primary.revoked)
+
+	// Other backends are never tried.
+	_, err = c.RevokeCertificate(&apiv1.RevokeCertificateRequest{SerialNumber: "3"})
+	assert.EqualError(t, err, "failoverCAS cannot determine the backend of certificate 3")
+	_, err = c.RevokeCertificate(&apiv1.RevokeCertificateRequest{
+		Certificate:  (&mockBackend{serial: 5}).issue(5),
+		SerialNumber: "5",
+	})
+	assert.EqualError(t, err, "failoverCAS cannot determine the backend of certificate 5")
+	assert.Equal(t, []string{"1"}, primary.revoked)
+	assert.Equal(t, []string{"2", "4"}, secondary.revoked)
+}
+
+func TestFailoverCAS_Close(t *testing.T) {
+	c, _, _ := newTestFailoverCAS(t, nil, `{
+		"backends": [
+			{"name": "primary", "type": "mockcas", "certificateAuthority": "primary"},
+			{"name": "secondary", "type": "mockcas", "certificateAuthority": "secondary"}
+		],
+		"healthCheckInterval": "1ms"
+	}`)
+	require.Eventually(t, func() bool {
+		return !c.GetHealth()[0].CheckedAt.IsZero()
+	}, time.Second, time.Millisecond)
+	require.NoError(t, c.Close())
+
+	// Wait for a running health check to finish.
+	time.Sleep(10 * time.Millisecond)
+	checkedAt := c.GetHealth()[0].CheckedAt
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, checkedAt, c.GetHealth()[0].CheckedAt)
+}
+
+func TestFailoverCAS_GetCertificateAuthority(t *testing.T) {
+	c, primary, secondary := newTestFailoverCAS(t, nil, testConfig)
+
+	resp, err := c.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, primary.root, resp.RootCertificate)
+	assert.Len(t, resp.IntermediateCertificates, 2)
+
+	primary.err = errors.New("unavailable")
+	resp, err = c.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, secondary.root, resp.RootCertificate)
+	assert.Len(t, resp.IntermediateCertificates, 1)
+
+	secondary.err = errors.New("unavailable")
+	_, err = c.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+	assert.Error(t, err)
+}
+
+func TestFailoverCAS_checkHealth(t *testing.T) {
+	c, primary, _ := newTestFailoverCAS(t, nil, testConfig)
+
+	primary.err = errors.New("unavailable")
+	c.checkHealth()
+	c.checkHealth()
+	assert.False(t, c.GetHealth()[0].Healthy)
+	assert.True(t, c.GetHealth()[1].Healthy)
+
+	// A successful health check closes the circuit.
+	primary.err = nil
+	c.checkHealth()
+	assert.True(t, c.GetHealth()[0].Healthy)
+	assert.Equal(t, 3, primary.getCalls)
+}
+
+func TestFailoverCAS_runHealthChecks(t *testing.T) {
+	c, primary, _ := newTestFailoverCAS(t, nil, testConfig)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.runHealthChecks(ctx, time.Millisecond)
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		return len(c.GetHealth()) == 2 && !c.GetHealth()[0].CheckedAt.IsZero()
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	assert.Positive(t, primary.getCalls)
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -32,6 +33,12 @@ type SoftCAS struct {
 	Signer            crypto.Signer
 	CertificateSigner func() ([]*x509.Certificate, crypto.Signer, error)
 	KeyManager        kms.KeyManager
+
+	// The issuer that replaces CertificateChain and Signer from rotateAt.
+	mu         sync.RWMutex
+	nextChain  []*x509.Certificate
+	nextSigner crypto.Signer
+	rotateAt   time.Time
 }
 
 // New creates a new CertificateAuthorityService implementation using Golang or KMS
@@ -145,9 +152,11 @@ func (c *SoftCAS) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1
 	}, nil
 }
 
-// CreateCRL will create a new CRL based on the RevocationList passed to it
+// CreateCRL will create a new CRL based on the RevocationList passed to it. If
+// the request has an issuer, the CRL is signed with the key of that issuer,
+// that can be the current intermediate or the one scheduled to replace it.
 func (c *SoftCAS) CreateCRL(req *apiv1.CreateCRLRequest) (*apiv1.CreateCRLResponse, error) {
-	certChain, signer, err := c.getCertSigner()
+	certChain, signer, err := c.getCRLSigner(req.Issuer)
 	if err != nil {
 		return nil, err
 	}
@@ -226,6 +235,28 @@ func (c *SoftCAS) CreateCertificateAuthority(req *apiv1.CreateCertificateAuthori
 	}, nil
 }
 
+// RotateCertificateAuthority implements [apiv1.CertificateAuthorityRotator]
+// and schedules the replacement of the issuer used to sign new and renewed
+// certificates. The current issuer is still used until the rotation time, and
+// a request without a chain and signer cancels the rotation.
+func (c *SoftCAS) RotateCertificateAuthority(req *apiv1.RotateCertificateAuthorityRequest) error {
+	switch {
+	case c.CertificateSigner != nil:
+		return errors.New("softCAS does not support the rotation of a 'CertificateSigner'")
+	case len(req.CertificateChain) == 0 && req.Signer != nil:
+		return errors.New("rotateCertificateAuthorityRequest `certificateChain` cannot be empty")
+	case len(req.CertificateChain) > 0 && req.Signer == nil:
+		return errors.New("rotateCertificateAuthorityRequest `signer` cannot be nil")
+	}
+
+	c.mu.Lock()
+	c.nextChain = req.CertificateChain
+	c.nextSigner = req.Signer
+	c.rotateAt = req.RotateAt
+	c.mu.Unlock()
+	return nil
+}
+
 // initializeKeyManager initializes the default key manager if was not given.
 func (c *SoftCAS) initializeKeyManager() (err error) {
 	if c.KeyManager == nil {
@@ -241,9 +272,41 @@ func (c *SoftCAS) getCertSigner() ([]*x509.Certificate, crypto.Signer, error) {
 	if c.CertificateSigner != nil {
 		return c.CertificateSigner()
 	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.nextSigner != nil && !now().Before(c.rotateAt) {
+		return c.nextChain, c.nextSigner, nil
+	}
 	return c.CertificateChain, c.Signer, nil
 }
 
+// getCRLSigner returns the certificate chain and signer of the given issuer,
+// or the ones used to issue certificates if the issuer is nil.
+func (c *SoftCAS) getCRLSigner(issuer *x509.Certificate) ([]*x509.Certificate, crypto.Signer, error) {
+	if issuer == nil {
+		return c.getCertSigner()
+	}
+	if c.CertificateSigner != nil {
+		chain, signer, err := c.CertificateSigner()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(chain) > 0 && chain[0].Equal(issuer) {
+			return chain, signer, nil
+		}
+	} else {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		switch {
+		case len(c.CertificateChain) > 0 && c.CertificateChain[0].Equal(issuer):
+			return c.CertificateChain, c.Signer, nil
+		case len(c.nextChain) > 0 && c.nextChain[0].Equal(issuer):
+			return c.nextChain, c.nextSigner, nil
+		}
+	}
+	return nil, nil, errors.New("softCAS does not have the key of the CRL issuer")
+}
+
 // createKey uses the configured kms to create a key.
 func (c *SoftCAS) createKey(req *kmsapi.CreateKeyRequest) (*kmsapi.CreateKeyResponse, error) {
 	if err := c.initializeKeyManager(); err != nil {
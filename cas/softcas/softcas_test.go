@@ -706,6 +706,94 @@ func TestSoftCAS_RevokeCertificate(t *testing.T) {
 	}
 }
 
+func TestSoftCAS_RotateCertificateAuthority(t *testing.T) {
+	mockNow(t)
+
+	ca, err := minica.New()
+	require.NoError(t, err)
+	nextChain := []*x509.Certificate{ca.Intermediate}
+
+	c := &SoftCAS{
+		CertificateChain: []*x509.Certificate{testIssuer},
+		Signer:           testSigner,
+	}
+	assertIssuer := func(t *testing.T, want *x509.Certificate) {
+		t.Helper()
+		resp, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+			Template: &x509.Certificate{
+				Subject:      testTemplate.Subject,
+				PublicKey:    testTemplate.PublicKey,
+				SerialNumber: testTemplate.SerialNumber,
+			},
+			Lifetime: 24 * time.Hour,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []*x509.Certificate{want}, resp.CertificateChain)
+		assert.NoError(t, resp.Certificate.CheckSignatureFrom(want))
+	}
+
+	// Scheduled rotation keeps the current issuer.
+	require.NoError(t, c.RotateCertificateAuthority(&apiv1.RotateCertificateAuthorityRequest{
+		CertificateChain: nextChain,
+		Signer:           ca.Signer,
+		RotateAt:         testNow.Add(time.Hour),
+	}))
+	assertIssuer(t, testIssuer)
+
+	// Rotation time reached.
+	require.NoError(t, c.RotateCertificateAuthority(&apiv1.RotateCertificateAuthorityRequest{
+		CertificateChain: nextChain,
+		Signer:           ca.Signer,
+		RotateAt:         testNow,
+	}))
+	assertIssuer(t, ca.Intermediate)
+	signer, err := c.GetSigner()
+	require.NoError(t, err)
+	assert.Equal(t, ca.Signer, signer)
+
+	// CRLs can be signed by both issuers.
+	assertCRLIssuer := func(t *testing.T, issuer, want *x509.Certificate) {
+		t.Helper()
+		resp, err := c.CreateCRL(&apiv1.CreateCRLRequest{
+			RevocationList: &x509.RevocationList{
+				Number:     big.NewInt(1),
+				ThisUpdate: testNow,
+				NextUpdate: testNow.Add(time.Hour),
+			},
+			Issuer: issuer,
+		})
+		require.NoError(t, err)
+		crl, err := x509.ParseRevocationList(resp.CRL)
+		require.NoError(t, err)
+		assert.NoError(t, crl.CheckSignatureFrom(want))
+	}
+	assertCRLIssuer(t, nil, ca.Intermediate)
+	assertCRLIssuer(t, ca.Intermediate, ca.Intermediate)
+	assertCRLIssuer(t, testIssuer, testIssuer)
+	_, err = c.CreateCRL(&apiv1.CreateCRLRequest{
+		RevocationList: &x509.RevocationList{Number: big.NewInt(1)},
+		Issuer:         ca.Root,
+	})
+	assert.Error(t, err)
+
+	// Cancel rotation.
+	require.NoError(t, c.RotateCertificateAuthority(&apiv1.RotateCertificateAuthorityRequest{}))
+	assertIssuer(t, testIssuer)
+
+	// Fail with bad requests.
+	assert.Error(t, c.RotateCertificateAuthority(&apiv1.RotateCertificateAuthorityRequest{
+		Signer: ca.Signer,
+	}))
+	assert.Error(t, c.RotateCertificateAuthority(&apiv1.RotateCertificateAuthorityRequest{
+		CertificateChain: nextChain,
+	}))
+	c = &SoftCAS{CertificateSigner: testCertificateSigner}
+	assert.Error(t, c.RotateCertificateAuthority(&apiv1.RotateCertificateAuthorityRequest{
+		CertificateChain: nextChain,
+		Signer:           ca.Signer,
+	}))
+}
+
 func Test_now(t *testing.T) {
 	t0 := time.Now()
 	t1 := now()
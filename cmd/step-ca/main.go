@@ -38,7 +38,10 @@ import (
 	_ "go.step.sm/crypto/kms/yubikey"
 
 	// Enabled cas interfaces.
+	_ "github.com/smallstep/certificates/cas/awspca"
 	_ "github.com/smallstep/certificates/cas/cloudcas"
+	_ "github.com/smallstep/certificates/cas/ejbcacas"
+	_ "github.com/smallstep/certificates/cas/failovercas"
 	_ "github.com/smallstep/certificates/cas/softcas"
 	_ "github.com/smallstep/certificates/cas/stepcas"
 	_ "github.com/smallstep/certificates/cas/vaultcas"
@@ -0,0 +1,97 @@
+// Package api implements a CMP HTTP server.
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/log"
+	"github.com/smallstep/certificates/cmp"
+)
+
+const maxPayloadSize = 2 << 20
+
+const pkixCMPContentType = "application/pkixcmp"
+
+// Route traffic and implement the Router interface. The routes are expected
+// to be mounted in /.well-known/cmp, using the path defined in RFC 9483,
+// section 6.1. The optional operation label is ignored, the operation is
+// given by the message body.
+func Route(r api.Router) {
+	r.MethodFunc(http.MethodPost, "/p/{provisionerName}", lookupProvisioner(Process))
+	r.MethodFunc(http.MethodPost, "/p/{provisionerName}/{operation}", lookupProvisioner(Process))
+}
+
+// Process handles a CMP request message and writes the response message, as
+// defined in RFC 6712. CMP errors are written as CMP error messages with a
+// 200 status code.
+func Process(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if ct, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || ct != pkixCMPContentType {
+		failStatus(w, r, http.StatusUnsupportedMediaType, fmt.Errorf("content type must be %s", pkixCMPContentType))
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize+1))
+	switch {
+	case err != nil:
+		failStatus(w, r, http.StatusBadRequest, fmt.Errorf("error reading request body: %w", err))
+		return
+	case len(body) > maxPayloadSize:
+		failStatus(w, r, http.StatusRequestEntityTooLarge, errors.New("request body is too large"))
+		return
+	}
+
+	res, err := cmp.MustFromContext(ctx).Process(ctx, body)
+	if len(res) == 0 {
+		failStatus(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if err != nil {
+		log.Error(w, r, err)
+	}
+	w.Header().Set("Content-Type", pkixCMPContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+}
+
+// lookupProvisioner loads the provisioner associated with the request.
+// Responds 404 if the provisioner does not exist.
+func lookupProvisioner(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "provisionerName")
+		provisionerName, err := url.PathUnescape(name)
+		if err != nil {
+			failStatus(w, r, http.StatusBadRequest, fmt.Errorf("error url unescaping provisioner name '%s'", name))
+			return
+		}
+
+		ctx := r.Context()
+		p, err := cmp.MustFromContext(ctx).LoadProvisionerByName(provisionerName)
+		if err != nil {
+			failStatus(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		ctx = cmp.NewProvisionerContext(ctx, p)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// failStatus writes an error response with the given status code. The error
+// is only written for client errors, other errors are only logged.
+func failStatus(w http.ResponseWriter, r *http.Request, status int, err error) {
+	log.Error(w, r, err)
+	msg := http.StatusText(status)
+	if status < http.StatusInternalServerError {
+		msg = err.Error()
+	}
+	http.Error(w, msg, status)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/minica"
+
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/cmp"
+)
+
+type signAuthority struct {
+	ca *minica.CA
+}
+
+func (s *signAuthority) SignWithContext(context.Context, *x509.CertificateRequest, provisioner.SignOptions, ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *signAuthority) RenewContext(context.Context, *x509.Certificate, crypto.PublicKey) ([]*x509.Certificate, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *signAuthority) Revoke(context.Context, *authority.RevokeOptions) error {
+	return errors.New("not implemented")
+}
+
+func (s *signAuthority) LoadProvisionerByName(name string) (provisioner.Interface, error) {
+	if name != "cmp" {
+		return nil, errors.New("provisioner not found")
+	}
+	p := &provisioner.CMP{Type: "CMP", Name: name, SharedSecret: "secret"}
+	if err := p.Init(provisioner.Config{
+		Claims: config.GlobalProvisionerClaims,
+	}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *signAuthority) GetRootCertificates() []*x509.Certificate {
+	return []*x509.Certificate{s.ca.Root}
+}
+
+func (s *signAuthority) GetIntermediateCertificates() []*x509.Certificate {
+	return []*x509.Certificate{s.ca.Intermediate}
+}
+
+func (s *signAuthority) GetX509Signer() (crypto.Signer, error) {
+	return s.ca.Signer, nil
+}
+
+func (s *signAuthority) IsRevoked(string) (bool, error) {
+	return false, nil
+}
+
+func newTestServer(t *testing.T) http.Handler {
+	t.Helper()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	ctx := cmp.NewContext(context.Background(), cmp.New(&signAuthority{ca: ca}))
+
+	r := chi.NewRouter()
+	Route(r)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+func TestProcess(t *testing.T) {
+	h := newTestServer(t)
+	tests := []struct {
+		name            string
+		path            string
+		contentType     string
+		body            string
+		wantStatus      int
+		wantContentType string
+	}{
+		{"ok/error-message", "/p/cmp", pkixCMPContentType, "foo", http.StatusOK, pkixCMPContentType},
+		{"ok/operation-label", "/p/cmp/initialization", pkixCMPContentType, "foo", http.StatusOK, pkixCMPContentType},
+		{"fail/provisioner", "/p/foo", pkixCMPContentType, "foo", http.StatusNotFound, "text/plain; charset=utf-8"},
+		{"fail/content-type", "/p/cmp", "application/octet-stream", "foo", http.StatusUnsupportedMediaType, "text/plain; charset=utf-8"},
+		{"fail/body-too-large", "/p/cmp", pkixCMPContentType, strings.Repeat("a", maxPayloadSize+1), http.StatusRequestEntityTooLarge, "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantContentType, w.Header().Get("Content-Type"))
+		})
+	}
+}
@@ -0,0 +1,1044 @@
+// Package cmp implements the Lightweight Certificate Management Protocol
+// profile defined in RFC 9483.
+package cmp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/smallstep/nosql/database"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/x509util"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+// Authority is the layer that handles all CMP interactions.
+type Authority struct {
+	signAuth     SignAuthority
+	transactions *transactionStore
+	proxyMu      sync.Mutex
+	proxySigners map[string]crypto.Signer
+}
+
+type authorityKey struct{}
+
+// NewContext adds the given authority to the context.
+func NewContext(ctx context.Context, a *Authority) context.Context {
+	return context.WithValue(ctx, authorityKey{}, a)
+}
+
+// FromContext returns the current authority from the given context.
+func FromContext(ctx context.Context) (a *Authority, ok bool) {
+	a, ok = ctx.Value(authorityKey{}).(*Authority)
+	return
+}
+
+// MustFromContext returns the current authority from the given context. It will
+// panic if the authority is not in the context.
+func MustFromContext(ctx context.Context) *Authority {
+	a, ok := FromContext(ctx)
+	if !ok {
+		panic("cmp authority is not in the context")
+	}
+	return a
+}
+
+// SignAuthority is the interface for a signing authority
+type SignAuthority interface {
+	SignWithContext(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	RenewContext(ctx context.Context, oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
+	Revoke(ctx context.Context, opts *authority.RevokeOptions) error
+	LoadProvisionerByName(string) (provisioner.Interface, error)
+	GetRootCertificates() []*x509.Certificate
+	GetIntermediateCertificates() []*x509.Certificate
+	GetX509Signer() (crypto.Signer, error)
+	IsRevoked(sn string) (bool, error)
+}
+
+// New returns a new Authority that implements the CMP interface.
+func New(signAuth SignAuthority) *Authority {
+	return &Authority{
+		signAuth:     signAuth,
+		transactions: newTransactionStore(),
+		proxySigners: make(map[string]crypto.Signer),
+	}
+}
+
+// LoadProvisionerByName returns the CMP provisioner with the given name.
+func (a *Authority) LoadProvisionerByName(name string) (Provisioner, error) {
+	p, err := a.signAuth.LoadProvisionerByName(name)
+	if err != nil {
+		return nil, err
+	}
+	prov, ok := p.(*provisioner.CMP)
+	if !ok {
+		return nil, errors.New("provisioner must be of type CMP")
+	}
+	return prov, nil
+}
+
+// response contains the fields of a response message.
+type response struct {
+	bodyType        int
+	content         any
+	extraCerts      []*x509.Certificate
+	implicitConfirm bool
+	tx              *transaction
+}
+
+// Process handles a DER encoded CMP request and returns the DER encoded
+// response. If the request fails, the response contains a CMP error message
+// and the returned error describes the failure.
+func (a *Authority) Process(ctx context.Context, der []byte) ([]byte, error) {
+	p := provisionerFromContext(ctx)
+
+	msg, err := parseMessage(der)
+	if err != nil {
+		return a.respondError(ctx, nil, nil, wrapError(failBadDataFormat, err, "error parsing message"))
+	}
+	if err := validateHeader(msg); err != nil {
+		return a.respondError(ctx, msg, nil, asError(err, "invalid message header"))
+	}
+	prot, err := verifyProtection(msg, p.GetSharedSecret())
+	if err != nil {
+		return a.respondError(ctx, msg, nil, asError(err, "error verifying message protection"))
+	}
+
+	var res *response
+	switch msg.bodyType() {
+	case bodyIR, bodyCR:
+		res, err = a.handleCertRequest(ctx, msg, prot)
+	case bodyP10CR:
+		res, err = a.handleP10CertRequest(ctx, msg, prot)
+	case bodyKUR:
+		res, err = a.handleKeyUpdateRequest(ctx, msg, prot)
+	case bodyRR:
+		res, err = a.handleRevocationRequest(ctx, msg, prot)
+	case bodyCertConf:
+		res, err = a.handleCertConf(ctx, msg, prot)
+	case bodyPollReq:
+		res, err = a.handlePollReq(ctx, msg, prot)
+	default:
+		err = newError(failBadRequest, "unsupported message body type %d", msg.bodyType())
+	}
+	if err != nil {
+		return a.respondError(ctx, msg, prot, asError(err, "error processing request"))
+	}
+	return a.respond(ctx, msg, prot, res)
+}
+
+// validateHeader validates the fields of the header required by RFC 9483,
+// section 3.1.
+func validateHeader(msg *message) error {
+	switch {
+	case msg.header.PVNO != pvno2 && msg.header.PVNO != pvno3:
+		return newError(failUnsupportedVersion, "unsupported protocol version %d", msg.header.PVNO)
+	case len(msg.header.TransactionID) == 0:
+		return newError(failBadRequest, "missing transactionID")
+	case len(msg.header.SenderNonce) == 0:
+		return newError(failBadSenderNonce, "missing senderNonce")
+	default:
+		return nil
+	}
+}
+
+// handleCertRequest handles ir and cr messages.
+func (a *Authority) handleCertRequest(ctx context.Context, msg *message, prot *protection) (*response, error) {
+	p := provisionerFromContext(ctx)
+	if err := a.authorizeEnrollment(p, msg, prot); err != nil {
+		return nil, err
+	}
+
+	certReq, tpl, err := parseCertReqMessages(msg.content())
+	if err != nil {
+		return nil, err
+	}
+	proxy, csr, err := a.proxyCSR(tpl)
+	if err != nil {
+		return nil, wrapError(failSystemFailure, err, "error creating certificate request")
+	}
+	return a.issue(ctx, msg, prot, certReq.CertReqID, func(ctx context.Context) ([]*x509.Certificate, error) {
+		return a.sign(ctx, csr, proxy)
+	})
+}
+
+// handleP10CertRequest handles p10cr messages.
+func (a *Authority) handleP10CertRequest(ctx context.Context, msg *message, prot *protection) (*response, error) {
+	p := provisionerFromContext(ctx)
+	if err := a.authorizeEnrollment(p, msg, prot); err != nil {
+		return nil, err
+	}
+
+	csr, err := x509.ParseCertificateRequest(msg.content())
+	if err != nil {
+		return nil, wrapError(failBadDataFormat, err, "error parsing certificate request")
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, wrapError(failBadPOP, err, "invalid certificate request signature")
+	}
+	return a.issue(ctx, msg, prot, p10crCertReqID, func(ctx context.Context) ([]*x509.Certificate, error) {
+		return a.sign(ctx, csr, csr)
+	})
+}
+
+// handleKeyUpdateRequest handles kur messages. The request must be signed
+// with the certificate to update, that is renewed with the new public key.
+func (a *Authority) handleKeyUpdateRequest(ctx context.Context, msg *message, prot *protection) (*response, error) {
+	if prot.isMAC() {
+		return nil, newError(failNotAuthorized, "key update requests must be signed with the certificate to update")
+	}
+	if err := a.verifyIssued(prot.cert, msg.extraCerts[1:]); err != nil {
+		return nil, err
+	}
+
+	certReq, tpl, err := parseCertReqMessages(msg.content())
+	if err != nil {
+		return nil, err
+	}
+	if !isEmptyName(tpl.Subject) && !bytes.Equal(tpl.Subject, prot.cert.RawSubject) {
+		return nil, newError(failBadCertTemplate, "certificate template subject does not match the certificate")
+	}
+	return a.issue(ctx, msg, prot, certReq.CertReqID, func(ctx context.Context) ([]*x509.Certificate, error) {
+		ctx = provisioner.NewContextWithMethod(ctx, provisioner.RenewMethod)
+		return a.signAuth.RenewContext(ctx, prot.cert, tpl.PublicKey)
+	})
+}
+
+// isEmptyName returns true if the given DER encoded name is not present or
+// it is the NULL-DN.
+func isEmptyName(name []byte) bool {
+	return len(name) == 0 || bytes.Equal(name, []byte{0x30, 0x00})
+}
+
+// handleRevocationRequest handles rr messages. The request must be signed
+// with the certificate to revoke.
+func (a *Authority) handleRevocationRequest(ctx context.Context, msg *message, prot *protection) (*response, error) {
+	if prot.isMAC() {
+		return nil, newError(failNotAuthorized, "revocation requests must be signed with the certificate to revoke")
+	}
+	if err := a.verifyIssued(prot.cert, msg.extraCerts[1:]); err != nil {
+		return nil, err
+	}
+
+	var details []revDetails
+	if rest, err := asn1.Unmarshal(msg.content(), &details); err != nil || len(rest) > 0 {
+		return nil, wrapError(failBadDataFormat, err, "error parsing revocation request")
+	}
+	if len(details) != 1 {
+		return nil, newError(failBadRequest, "revocation requests must contain exactly one certificate")
+	}
+	tpl, err := parseCertTemplate(details[0].CertDetails.FullBytes)
+	if err != nil {
+		return nil, wrapError(failBadCertTemplate, err, "error parsing certificate details")
+	}
+	if tpl.SerialNumber == nil || tpl.SerialNumber.Cmp(prot.cert.SerialNumber) != 0 ||
+		(len(tpl.Issuer) > 0 && !bytes.Equal(tpl.Issuer, prot.cert.RawIssuer)) {
+		return nil, newError(failBadCertID, "certificate details do not match the protection certificate")
+	}
+
+	var reasonCode asn1.Enumerated
+	for _, ext := range details[0].CRLEntryDetails {
+		if ext.Id.Equal(oidReasonCode) {
+			if _, err := asn1.Unmarshal(ext.Value, &reasonCode); err != nil {
+				return nil, wrapError(failBadDataFormat, err, "error parsing reason code")
+			}
+		}
+	}
+
+	ctx = provisioner.NewContextWithMethod(ctx, provisioner.RevokeMethod)
+	if err := a.signAuth.Revoke(ctx, &authority.RevokeOptions{
+		Serial:     prot.cert.SerialNumber.String(),
+		ReasonCode: int(reasonCode),
+		MTLS:       true,
+		Crt:        prot.cert,
+	}); err != nil {
+		return nil, asError(err, "error revoking certificate")
+	}
+
+	return &response{
+		bodyType: bodyRP,
+		content: revRepContent{
+			Status: []pkiStatusInfo{{Status: statusAccepted}},
+		},
+	}, nil
+}
+
+// handleCertConf handles certConf messages. A transaction is finished once
+// the client accepts or rejects the certificate.
+func (a *Authority) handleCertConf(ctx context.Context, msg *message, prot *protection) (*response, error) {
+	tx, err := a.loadTransaction(ctx, msg, prot)
+	if err != nil {
+		return nil, err
+	}
+	if !tx.isDone() || tx.err != nil {
+		return nil, newError(failBadRequest, "certificate has not been issued")
+	}
+
+	var statuses []certStatus
+	if rest, err := asn1.Unmarshal(msg.content(), &statuses); err != nil || len(rest) > 0 {
+		return nil, wrapError(failBadDataFormat, err, "error parsing certificate confirmation")
+	}
+
+	// An empty confirmation rejects the certificate.
+	rejected := len(statuses) == 0
+	if len(statuses) > 0 {
+		st := statuses[0]
+		if len(statuses) > 1 || st.CertReqID != tx.certReqID {
+			return nil, newError(failBadCertID, "unknown certReqId")
+		}
+		hash, err := certificateHash(tx.certs[0], st.HashAlg)
+		if err != nil {
+			return nil, wrapError(failBadAlg, err, "invalid hash algorithm")
+		}
+		if !bytes.Equal(hash, st.CertHash) {
+			return nil, newError(failBadCertID, "certificate hash does not match the issued certificate")
+		}
+		rejected = st.StatusInfo.Status == statusRejection
+	}
+
+	if err := a.closeTransaction(tx); err != nil {
+		return nil, err
+	}
+	if rejected {
+		if err := a.revokeUnconfirmed(ctx, tx.certs[0], "certificate rejected by the client"); err != nil {
+			return nil, asError(err, "error revoking rejected certificate")
+		}
+	}
+	return &response{
+		bodyType: bodyPKIConf,
+		content:  asn1.NullRawValue,
+		tx:       tx,
+	}, nil
+}
+
+// handlePollReq handles pollReq messages, it returns a pollRep if the
+// certificate is not yet issued, or the certificate response otherwise.
+func (a *Authority) handlePollReq(ctx context.Context, msg *message, prot *protection) (*response, error) {
+	tx, err := a.loadTransaction(ctx, msg, prot)
+	if err != nil {
+		return nil, err
+	}
+
+	var reqs []pollReq
+	if rest, err := asn1.Unmarshal(msg.content(), &reqs); err != nil || len(rest) > 0 {
+		return nil, wrapError(failBadDataFormat, err, "error parsing poll request")
+	}
+	if len(reqs) != 1 || reqs[0].CertReqID != tx.certReqID {
+		return nil, newError(failBadCertID, "unknown certReqId")
+	}
+	return a.certResponse(ctx, msg, tx)
+}
+
+// authorizeEnrollment authorizes ir, cr and p10cr messages. Requests
+// protected with the shared secret are always authorized, signed requests
+// must use a certificate trusted by the provisioner.
+func (a *Authority) authorizeEnrollment(p Provisioner, msg *message, prot *protection) error {
+	if prot.isMAC() {
+		return nil
+	}
+	if err := p.AuthorizeClientCertificate(msg.extraCerts); err != nil {
+		return wrapError(failSignerNotTrusted, err, "protection certificate is not trusted")
+	}
+	return nil
+}
+
+// verifyIssued verifies that the given certificate was issued by the CA and
+// has not been revoked.
+func (a *Authority) verifyIssued(cert *x509.Certificate, extraCerts []*x509.Certificate) error {
+	roots := x509.NewCertPool()
+	for _, crt := range a.signAuth.GetRootCertificates() {
+		roots.AddCert(crt)
+	}
+	intermediates := x509.NewCertPool()
+	for _, crt := range a.signAuth.GetIntermediateCertificates() {
+		intermediates.AddCert(crt)
+	}
+	for _, crt := range extraCerts {
+		intermediates.AddCert(crt)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return wrapError(failSignerNotTrusted, err, "protection certificate is not trusted")
+	}
+
+	isRevoked, err := a.signAuth.IsRevoked(cert.SerialNumber.String())
+	if err != nil {
+		return wrapError(failSystemFailure, err, "error checking certificate revocation")
+	}
+	if isRevoked {
+		return newError(failCertRevoked, "certificate has been revoked")
+	}
+	return nil
+}
+
+// loadTransaction returns the transaction of a certConf or pollReq message.
+// The message must come from the same sender and it must include the nonce
+// of the last response.
+func (a *Authority) loadTransaction(ctx context.Context, msg *message, prot *protection) (*transaction, error) {
+	p := provisionerFromContext(ctx)
+	key := transactionKey(p.GetName(), msg.header.TransactionID)
+	tx := a.transactions.get(key)
+	if tx == nil {
+		var err error
+		if tx, err = a.loadStoredTransaction(key); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case tx == nil:
+		return nil, newError(failBadRequest, "unknown transactionID")
+	case !tx.prot.sameSender(prot):
+		return nil, newError(failNotAuthorized, "message protection does not match the transaction")
+	case !bytes.Equal(msg.header.RecipNonce, tx.getSenderNonce()):
+		return nil, newError(failBadRecipientNonce, "invalid recipNonce")
+	default:
+		return tx, nil
+	}
+}
+
+// transactionDB returns the database used to persist transactions, or nil if
+// the authority does not have a database supporting them.
+func (a *Authority) transactionDB() db.CMPTransactionDB {
+	if da, ok := a.signAuth.(interface{ GetDatabase() db.AuthDB }); ok {
+		if tdb, ok := da.GetDatabase().(db.CMPTransactionDB); ok {
+			return tdb
+		}
+	}
+	return nil
+}
+
+// saveTransaction persists a transaction whose certificate has been issued
+// and is waiting for the confirmation of the client. Persisted transactions
+// survive a restart, and their certificates are revoked if they are not
+// confirmed in time, see RevokeUnconfirmedCertificates.
+func (a *Authority) saveTransaction(ctx context.Context, tx *transaction) error {
+	if tx.implicit || !tx.isDone() || tx.err != nil {
+		return nil
+	}
+	tdb := a.transactionDB()
+	if tdb == nil {
+		return nil
+	}
+
+	p := provisionerFromContext(ctx)
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.closed {
+		return nil
+	}
+	rec := &db.CMPTransaction{
+		ID:          tx.key,
+		Provisioner: p.GetName(),
+		BodyType:    tx.bodyType,
+		CertReqID:   tx.certReqID,
+		MAC:         tx.prot.isMAC(),
+		SenderNonce: tx.senderNonce,
+		CreatedAt:   tx.createdAt,
+		ExpiresAt:   tx.expiresAt,
+	}
+	if !rec.MAC {
+		rec.SenderCertificate = tx.prot.cert.Raw
+	}
+	for _, crt := range tx.certs {
+		rec.Certificates = append(rec.Certificates, crt.Raw)
+	}
+	if err := tdb.SaveCMPTransaction(rec); err != nil {
+		return fmt.Errorf("error storing transaction: %w", err)
+	}
+	tx.persisted = true
+	return nil
+}
+
+// loadStoredTransaction returns a transaction persisted by saveTransaction,
+// or nil if it does not exist or it has expired.
+func (a *Authority) loadStoredTransaction(key string) (*transaction, error) {
+	tdb := a.transactionDB()
+	if tdb == nil {
+		return nil, nil
+	}
+	rec, err := tdb.GetCMPTransaction(key)
+	switch {
+	case database.IsErrNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, wrapError(failSystemFailure, err, "error loading transaction")
+	case rec.Closed || time.Now().After(rec.ExpiresAt):
+		return nil, nil
+	}
+
+	tx := &transaction{
+		key:         rec.ID,
+		bodyType:    rec.BodyType,
+		certReqID:   rec.CertReqID,
+		prot:        &protection{},
+		done:        make(chan struct{}),
+		createdAt:   rec.CreatedAt,
+		senderNonce: rec.SenderNonce,
+		expiresAt:   rec.ExpiresAt,
+		persisted:   true,
+	}
+	if rec.MAC {
+		tx.prot.params = &pbmParameter{}
+	} else if tx.prot.cert, err = x509.ParseCertificate(rec.SenderCertificate); err != nil {
+		return nil, wrapError(failSystemFailure, err, "error parsing transaction sender certificate")
+	}
+	certs := make([]*x509.Certificate, len(rec.Certificates))
+	for i, b := range rec.Certificates {
+		if certs[i], err = x509.ParseCertificate(b); err != nil {
+			return nil, wrapError(failSystemFailure, err, "error parsing transaction certificate")
+		}
+	}
+	if len(certs) == 0 {
+		return nil, newError(failSystemFailure, "transaction does not have a certificate")
+	}
+	tx.finish(certs, nil)
+	return tx, nil
+}
+
+// closeTransaction removes a transaction once its certificate has been
+// confirmed or rejected. It fails if the transaction has already been closed,
+// for example, because it expired and its certificate was revoked.
+func (a *Authority) closeTransaction(tx *transaction) error {
+	a.transactions.remove(tx)
+	if !tx.close() {
+		return newError(failBadRequest, "transaction has already been closed")
+	}
+	tdb := a.transactionDB()
+	if tdb == nil {
+		return nil
+	}
+	_, err := tdb.CloseCMPTransaction(tx.key)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, db.ErrCMPTransactionClosed):
+		return newError(failBadRequest, "transaction has already been closed")
+	case database.IsErrNotFound(err):
+		tx.mu.Lock()
+		defer tx.mu.Unlock()
+		if tx.persisted {
+			return newError(failBadRequest, "transaction has already been closed")
+		}
+		return nil
+	default:
+		return wrapError(failSystemFailure, err, "error closing transaction")
+	}
+}
+
+// revokeUnconfirmed revokes a certificate rejected by the client, or not
+// confirmed in time.
+func (a *Authority) revokeUnconfirmed(ctx context.Context, cert *x509.Certificate, reason string) error {
+	ctx = provisioner.NewContextWithMethod(ctx, provisioner.RevokeMethod)
+	return a.signAuth.Revoke(ctx, &authority.RevokeOptions{
+		Serial:     cert.SerialNumber.String(),
+		Reason:     reason,
+		ReasonCode: ocsp.CessationOfOperation,
+		MTLS:       true,
+		Crt:        cert,
+	})
+}
+
+// RevokeUnconfirmedCertificates revokes the certificates of the persisted
+// transactions that have not been confirmed within the confirmation wait time
+// of the provisioner, as required by RFC 9483, section 4.1.1.
+func (a *Authority) RevokeUnconfirmedCertificates(ctx context.Context) error {
+	tdb := a.transactionDB()
+	if tdb == nil {
+		return nil
+	}
+	recs, err := tdb.GetCMPTransactions()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	now := time.Now()
+	for _, rec := range recs {
+		if rec.Closed || now.Before(rec.ExpiresAt) {
+			continue
+		}
+		// Closing the transaction guarantees that it is not confirmed
+		// concurrently.
+		if _, err := tdb.CloseCMPTransaction(rec.ID); err != nil {
+			if !errors.Is(err, db.ErrCMPTransactionClosed) && !database.IsErrNotFound(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if len(rec.Certificates) == 0 {
+			continue
+		}
+		cert, err := x509.ParseCertificate(rec.Certificates[0])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error parsing certificate of transaction %s: %w", rec.ID, err))
+			continue
+		}
+		if revoked, err := a.signAuth.IsRevoked(cert.SerialNumber.String()); err == nil && revoked {
+			continue
+		}
+		if err := a.revokeUnconfirmed(ctx, cert, "certificate not confirmed"); err != nil {
+			errs = append(errs, fmt.Errorf("error revoking certificate %s: %w", cert.SerialNumber, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// issue starts a new transaction and runs the given function to issue the
+// certificate. If the provisioner has a polling threshold and issuing the
+// certificate takes longer than it, the client is asked to poll for the
+// certificate.
+func (a *Authority) issue(ctx context.Context, msg *message, prot *protection, certReqID int, fn func(context.Context) ([]*x509.Certificate, error)) (*response, error) {
+	p := provisionerFromContext(ctx)
+	tx := &transaction{
+		key:       transactionKey(p.GetName(), msg.header.TransactionID),
+		bodyType:  msg.bodyType(),
+		certReqID: certReqID,
+		prot:      prot,
+		implicit:  msg.hasImplicitConfirm() && p.ShouldAllowImplicitConfirm(),
+		done:      make(chan struct{}),
+		createdAt: time.Now(),
+	}
+	if !a.transactions.add(tx, p.GetConfirmWaitTime()) {
+		return nil, newError(failTransactionIDInUse, "transactionID is already in use")
+	}
+
+	threshold := p.GetPollingThreshold()
+	if threshold == 0 {
+		tx.finish(fn(ctx))
+	} else {
+		go func() {
+			tx.finish(fn(context.WithoutCancel(ctx)))
+		}()
+		timer := time.NewTimer(threshold)
+		defer timer.Stop()
+		select {
+		case <-tx.done:
+		case <-timer.C:
+		}
+	}
+	return a.certResponse(ctx, msg, tx)
+}
+
+// certResponse returns the ip, cp or kup response of a transaction, or a
+// pollRep if the transaction is in progress and the request is a pollReq.
+func (a *Authority) certResponse(ctx context.Context, msg *message, tx *transaction) (*response, error) {
+	p := provisionerFromContext(ctx)
+	bodyType := bodyCP
+	switch tx.bodyType {
+	case bodyIR:
+		bodyType = bodyIP
+	case bodyKUR:
+		bodyType = bodyKUP
+	}
+
+	if !tx.isDone() {
+		if msg.bodyType() == bodyPollReq {
+			return &response{
+				bodyType: bodyPollRep,
+				content: []pollRep{{
+					CertReqID:  tx.certReqID,
+					CheckAfter: int(math.Max(1, math.Ceil(p.GetPollingThreshold().Seconds()))),
+				}},
+				tx: tx,
+			}, nil
+		}
+		return &response{
+			bodyType: bodyType,
+			content: certRepMessage{
+				Response: []certResponse{{
+					CertReqID: tx.certReqID,
+					Status:    pkiStatusInfo{Status: statusWaiting},
+				}},
+			},
+			tx: tx,
+		}, nil
+	}
+
+	if tx.err != nil {
+		a.transactions.remove(tx)
+		return nil, asError(tx.err, "error issuing certificate")
+	}
+
+	content := certRepMessage{
+		Response: []certResponse{{
+			CertReqID: tx.certReqID,
+			Status:    pkiStatusInfo{Status: statusAccepted},
+			CertifiedKeyPair: certifiedKeyPair{
+				CertOrEncCert: asn1.RawValue{
+					Class:      asn1.ClassContextSpecific,
+					Tag:        0,
+					IsCompound: true,
+					Bytes:      tx.certs[0].Raw,
+				},
+			},
+		}},
+	}
+	if tx.bodyType == bodyIR && p.ShouldIncludeRootInChain() {
+		for _, crt := range a.signAuth.GetRootCertificates() {
+			content.CAPubs = append(content.CAPubs, asn1.RawValue{FullBytes: crt.Raw})
+		}
+	}
+	if tx.implicit {
+		a.transactions.remove(tx)
+	}
+	return &response{
+		bodyType:        bodyType,
+		content:         content,
+		extraCerts:      tx.certs[1:],
+		implicitConfirm: tx.implicit,
+		tx:              tx,
+	}, nil
+}
+
+// sign signs a certificate using the CMP provisioner. The proxy request is
+// the one sent to the authority; it is the same as csr unless the request
+// comes from a CRMF template, see proxyCSR.
+func (a *Authority) sign(ctx context.Context, csr, proxy *x509.CertificateRequest) ([]*x509.Certificate, error) {
+	p := provisionerFromContext(ctx)
+
+	// Template data
+	sans := []string{}
+	sans = append(sans, csr.DNSNames...)
+	sans = append(sans, csr.EmailAddresses...)
+	for _, v := range csr.IPAddresses {
+		sans = append(sans, v.String())
+	}
+	for _, v := range csr.URIs {
+		sans = append(sans, v.String())
+	}
+	if len(sans) == 0 {
+		sans = append(sans, csr.Subject.CommonName)
+	}
+	data := x509util.CreateTemplateData(csr.Subject.CommonName, sans)
+	data.SetCertificateRequest(csr)
+	data.SetSubject(x509util.Subject{
+		Country:            csr.Subject.Country,
+		Organization:       csr.Subject.Organization,
+		OrganizationalUnit: csr.Subject.OrganizationalUnit,
+		Locality:           csr.Subject.Locality,
+		Province:           csr.Subject.Province,
+		StreetAddress:      csr.Subject.StreetAddress,
+		PostalCode:         csr.Subject.PostalCode,
+		SerialNumber:       csr.Subject.SerialNumber,
+		CommonName:         csr.Subject.CommonName,
+	})
+
+	// Get authorizations from the CMP provisioner.
+	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
+	signOps, err := p.AuthorizeSign(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving authorization options from CMP provisioner: %w", err)
+	}
+	for _, signOp := range signOps {
+		switch o := signOp.(type) {
+		case *provisioner.WebhookController:
+			o.TemplateData = data
+		case provisioner.CertificateRequestValidator:
+			if csr != proxy {
+				if err := o.Valid(csr); err != nil {
+					return nil, wrapError(failBadCertTemplate, err, "error validating certificate template")
+				}
+			}
+		}
+	}
+
+	templateOptions, err := provisioner.TemplateOptions(p.GetOptions(), data)
+	if err != nil {
+		return nil, fmt.Errorf("error creating template options from CMP provisioner: %w", err)
+	}
+	signOps = append(signOps, templateOptions)
+	if csr != proxy {
+		signOps = append(signOps, publicKeyModifier{csr.PublicKey})
+	}
+
+	certChain, err := a.signAuth.SignWithContext(ctx, proxy, provisioner.SignOptions{}, signOps...)
+	if err != nil {
+		return nil, fmt.Errorf("error generating certificate: %w", err)
+	}
+	if pub, ok := certChain[0].PublicKey.(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(csr.PublicKey) {
+		return nil, errors.New("error generating certificate: certificate public key does not match the request")
+	}
+	return certChain, nil
+}
+
+// parseCertReqMessages parses the CertReqMessages of an ir, cr or kur message
+// and verifies the proof of possession of the private key. Only one request
+// with a signature proof of possession is supported, as required by RFC 9483.
+func parseCertReqMessages(der []byte) (*certRequest, *certTemplate, error) {
+	var msgs []certReqMsg
+	if rest, err := asn1.Unmarshal(der, &msgs); err != nil || len(rest) > 0 {
+		return nil, nil, wrapError(failBadDataFormat, err, "error parsing certificate request")
+	}
+	if len(msgs) != 1 {
+		return nil, nil, newError(failBadRequest, "certificate requests must contain exactly one request")
+	}
+
+	var certReq certRequest
+	if rest, err := asn1.Unmarshal(msgs[0].CertReq.FullBytes, &certReq); err != nil || len(rest) > 0 {
+		return nil, nil, wrapError(failBadDataFormat, err, "error parsing certificate request")
+	}
+	tpl, err := parseCertTemplate(certReq.CertTemplate.FullBytes)
+	if err != nil {
+		return nil, nil, wrapError(failBadCertTemplate, err, "error parsing certificate template")
+	}
+	if tpl.PublicKey == nil {
+		return nil, nil, newError(failBadCertTemplate, "certificate template must contain a public key")
+	}
+
+	popo := msgs[0].POPO
+	if popo.Class != asn1.ClassContextSpecific || popo.Tag != 1 || !popo.IsCompound {
+		return nil, nil, newError(failBadPOP, "only signature-based proof of possession is supported")
+	}
+	var pop popoSigningKey
+	if _, err := asn1.Unmarshal(retag(popo, asn1.TagSequence, true), &pop); err != nil {
+		return nil, nil, wrapError(failBadPOP, err, "error parsing proof of possession")
+	}
+	if len(pop.Input.FullBytes) > 0 {
+		return nil, nil, newError(failBadPOP, "proof of possession with poposkInput is not supported")
+	}
+	if err := verifySignature(tpl.PublicKey, pop.Algorithm, msgs[0].CertReq.FullBytes, pop.Signature.RightAlign()); err != nil {
+		return nil, nil, wrapError(failBadPOP, err, "invalid proof of possession")
+	}
+	return &certReq, tpl, nil
+}
+
+// proxyCSR creates the certificate requests for a CRMF template. The
+// authority requires a certificate request signed by the requested key, so
+// the returned proxy request contains the template subject and extensions and
+// is signed by a key owned by the CA, of the same type and size as the
+// requested key. The returned csr is a copy of the proxy with the requested
+// key, it is used to validate the request and render the templates. The
+// proof of possession of the requested key is verified by
+// parseCertReqMessages.
+func (a *Authority) proxyCSR(tpl *certTemplate) (proxy, csr *x509.CertificateRequest, err error) {
+	signer, err := a.proxySigner(tpl.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		RawSubject:      tpl.Subject,
+		ExtraExtensions: tpl.Extensions,
+	}, signer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if proxy, err = x509.ParseCertificateRequest(der); err != nil {
+		return nil, nil, err
+	}
+
+	cr := *proxy
+	cr.PublicKey = tpl.PublicKey
+	switch tpl.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		cr.PublicKeyAlgorithm = x509.ECDSA
+	case *rsa.PublicKey:
+		cr.PublicKeyAlgorithm = x509.RSA
+	case ed25519.PublicKey:
+		cr.PublicKeyAlgorithm = x509.Ed25519
+	}
+	return proxy, &cr, nil
+}
+
+// proxySigner returns a cached key of the same type and size as the given
+// public key.
+func (a *Authority) proxySigner(pub crypto.PublicKey) (crypto.Signer, error) {
+	var (
+		kty, crv string
+		size     int
+	)
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		kty, crv = "EC", pub.Curve.Params().Name
+	case *rsa.PublicKey:
+		kty, size = "RSA", pub.Size()*8
+	case ed25519.PublicKey:
+		kty, crv = "OKP", "Ed25519"
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+
+	key := fmt.Sprintf("%s/%s/%d", kty, crv, size)
+	a.proxyMu.Lock()
+	defer a.proxyMu.Unlock()
+	if signer, ok := a.proxySigners[key]; ok {
+		return signer, nil
+	}
+	signer, err := keyutil.GenerateSigner(kty, crv, size)
+	if err != nil {
+		return nil, err
+	}
+	a.proxySigners[key] = signer
+	return signer, nil
+}
+
+// publicKeyModifier sets the requested public key in certificates signed
+// using a proxy certificate request.
+type publicKeyModifier struct {
+	publicKey crypto.PublicKey
+}
+
+// Modify implements provisioner.CertificateModifier.
+func (m publicKeyModifier) Modify(cert *x509.Certificate, _ provisioner.SignOptions) error {
+	cert.PublicKey = m.publicKey
+	cert.SubjectKeyId = nil
+	return nil
+}
+
+// respondError returns a protected error message if the protection of the
+// request was verified, or an unprotected one otherwise. The returned error
+// is the given one unless the response cannot be created.
+func (a *Authority) respondError(ctx context.Context, msg *message, prot *protection, e *Error) ([]byte, error) {
+	b, err := a.respond(ctx, msg, prot, &response{
+		bodyType: bodyError,
+		content: errorMsgContent{
+			PKIStatusInfo: pkiStatusInfo{
+				Status:       statusRejection,
+				StatusString: freeText(e.Message),
+				FailInfo:     failureInfo(e.FailInfo),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, e
+}
+
+// respond creates the response message to the given request. Responses are
+// protected with the same mechanism used in the request.
+func (a *Authority) respond(ctx context.Context, req *message, prot *protection, res *response) ([]byte, error) {
+	p := provisionerFromContext(ctx)
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+	header := pkiHeader{
+		PVNO:        pvno2,
+		Sender:      directoryName(nil),
+		Recipient:   directoryName(nil),
+		MessageTime: time.Now().UTC().Truncate(time.Second),
+		SenderNonce: nonce,
+	}
+	if req != nil {
+		header.PVNO = req.header.PVNO
+		header.Recipient = req.header.Sender
+		header.TransactionID = req.header.TransactionID
+		header.RecipNonce = req.header.SenderNonce
+		if len(req.header.Recipient.FullBytes) > 0 {
+			header.Sender = req.header.Recipient
+		}
+	}
+	if res.implicitConfirm {
+		header.GeneralInfo = []infoTypeAndValue{{
+			InfoType:  oidImplicitConfirm,
+			InfoValue: asn1.NullRawValue,
+		}}
+	}
+
+	var (
+		signer     crypto.Signer
+		hash       crypto.Hash
+		params     *pbmParameter
+		extraCerts []*x509.Certificate
+		err        error
+	)
+	switch {
+	case prot == nil:
+	case prot.isMAC():
+		if params, err = prot.params.withNewSalt(); err != nil {
+			return nil, fmt.Errorf("error generating salt: %w", err)
+		}
+		if header.ProtectionAlg, err = params.algorithm(); err != nil {
+			return nil, fmt.Errorf("error encoding protection algorithm: %w", err)
+		}
+		header.SenderKID = req.header.SenderKID
+	default:
+		var cert *x509.Certificate
+		if cert, signer = p.GetSigner(); signer != nil {
+			extraCerts = []*x509.Certificate{cert}
+		} else {
+			if signer, err = a.signAuth.GetX509Signer(); err != nil {
+				return nil, fmt.Errorf("error retrieving CA signer: %w", err)
+			}
+			extraCerts = a.signAuth.GetIntermediateCertificates()
+			if len(extraCerts) == 0 {
+				return nil, errors.New("missing CA intermediate certificate")
+			}
+			cert = extraCerts[0]
+		}
+		if header.ProtectionAlg, hash, err = signatureAlgorithm(signer.Public()); err != nil {
+			return nil, err
+		}
+		header.Sender = directoryName(cert.RawSubject)
+		header.SenderKID = cert.SubjectKeyId
+	}
+
+	headerDER, err := asn1.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding message header: %w", err)
+	}
+	body, err := newBody(res.bodyType, res.content)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding message body: %w", err)
+	}
+	bodyDER, err := asn1.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding message body: %w", err)
+	}
+
+	msg := pkiMessage{
+		Header: asn1.RawValue{FullBytes: headerDER},
+		Body:   asn1.RawValue{FullBytes: bodyDER},
+	}
+	if prot != nil {
+		data, err := protectedPart(msg.Header, msg.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding protected part: %w", err)
+		}
+		var sig []byte
+		if params != nil {
+			sig, err = params.mac(prot.secret, data)
+		} else {
+			sig, err = signData(signer, hash, data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error protecting message: %w", err)
+		}
+		msg.Protection = asn1.BitString{Bytes: sig, BitLength: len(sig) * 8}
+	}
+	for _, crt := range append(extraCerts, res.extraCerts...) {
+		msg.ExtraCerts = append(msg.ExtraCerts, asn1.RawValue{FullBytes: crt.Raw})
+	}
+
+	b, err := asn1.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding message: %w", err)
+	}
+	if res.tx != nil {
+		res.tx.update(nonce, p.GetConfirmWaitTime())
+		if err := a.saveTransaction(ctx, res.tx); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
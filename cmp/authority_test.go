@@ -0,0 +1,866 @@
+package cmp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+	stepx509util "go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+type signAuthority struct {
+	ca      *minica.CA
+	wait    chan struct{}
+	revoked *authority.RevokeOptions
+}
+
+func (s *signAuthority) SignWithContext(_ context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	if s.wait != nil {
+		<-s.wait
+	}
+	if err := cr.CheckSignature(); err != nil {
+		return nil, err
+	}
+	var (
+		certOptions []stepx509util.Option
+		modifiers   []provisioner.CertificateModifier
+	)
+	for _, so := range signOpts {
+		switch o := so.(type) {
+		case provisioner.CertificateOptions:
+			certOptions = append(certOptions, o.Options(opts)...)
+		case provisioner.CertificateModifier:
+			modifiers = append(modifiers, o)
+		}
+	}
+	c, err := stepx509util.NewCertificate(cr, certOptions...)
+	if err != nil {
+		return nil, err
+	}
+	leaf := c.GetCertificate()
+	for _, m := range modifiers {
+		if err := m.Modify(leaf, opts); err != nil {
+			return nil, err
+		}
+	}
+	crt, err := s.ca.Sign(leaf)
+	if err != nil {
+		return nil, err
+	}
+	return []*x509.Certificate{crt, s.ca.Intermediate}, nil
+}
+
+func (s *signAuthority) RenewContext(_ context.Context, oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
+	crt, err := s.ca.Sign(&x509.Certificate{
+		Subject:     oldCert.Subject,
+		DNSNames:    oldCert.DNSNames,
+		ExtKeyUsage: oldCert.ExtKeyUsage,
+		PublicKey:   pk,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []*x509.Certificate{crt, s.ca.Intermediate}, nil
+}
+
+func (s *signAuthority) Revoke(_ context.Context, opts *authority.RevokeOptions) error {
+	if s.revoked != nil {
+		return errors.New("already revoked")
+	}
+	s.revoked = opts
+	return nil
+}
+
+func (s *signAuthority) LoadProvisionerByName(name string) (provisioner.Interface, error) {
+	if name != "cmp" {
+		return nil, errors.New("provisioner not found")
+	}
+	return newTestProvisioner(nil, &provisioner.CMP{SharedSecret: "secret"}), nil
+}
+
+func (s *signAuthority) GetRootCertificates() []*x509.Certificate {
+	return []*x509.Certificate{s.ca.Root}
+}
+
+func (s *signAuthority) GetIntermediateCertificates() []*x509.Certificate {
+	return []*x509.Certificate{s.ca.Intermediate}
+}
+
+func (s *signAuthority) GetX509Signer() (crypto.Signer, error) {
+	return s.ca.Signer, nil
+}
+
+func (s *signAuthority) IsRevoked(string) (bool, error) {
+	return s.revoked != nil, nil
+}
+
+// dbSignAuthority is a signAuthority with a database.
+type dbSignAuthority struct {
+	*signAuthority
+	db db.AuthDB
+}
+
+func (s *dbSignAuthority) GetDatabase() db.AuthDB {
+	return s.db
+}
+
+func newDBSignAuthority(t *testing.T, ca *minica.CA) *dbSignAuthority {
+	t.Helper()
+	adb, err := db.New(&db.Config{Type: "badgerv2", DataSource: t.TempDir()})
+	require.NoError(t, err)
+	t.Cleanup(func() { adb.Shutdown() })
+	return &dbSignAuthority{signAuthority: &signAuthority{ca: ca}, db: adb}
+}
+
+func newTestProvisioner(t *testing.T, p *provisioner.CMP) *provisioner.CMP {
+	p.Type, p.Name = "CMP", "cmp"
+	err := p.Init(provisioner.Config{
+		Claims: config.GlobalProvisionerClaims,
+	})
+	if t != nil {
+		require.NoError(t, err)
+	}
+	return p
+}
+
+func pemEncode(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type: "CERTIFICATE", Bytes: cert.Raw,
+	})
+}
+
+// testClient creates requests and verifies responses like a CMP client.
+type testClient struct {
+	t             *testing.T
+	secret        []byte
+	signer        crypto.Signer
+	chain         []*x509.Certificate
+	transactionID []byte
+	recipNonce    []byte
+}
+
+func newMACClient(t *testing.T, secret string) *testClient {
+	return &testClient{t: t, secret: []byte(secret), transactionID: randomBytes(t)}
+}
+
+func newSignatureClient(t *testing.T, signer crypto.Signer, chain ...*x509.Certificate) *testClient {
+	return &testClient{t: t, signer: signer, chain: chain, transactionID: randomBytes(t)}
+}
+
+func randomBytes(t *testing.T) []byte {
+	t.Helper()
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+	return b
+}
+
+func (c *testClient) request(bodyType int, content []byte, generalInfo ...infoTypeAndValue) []byte {
+	t := c.t
+	t.Helper()
+	header := pkiHeader{
+		PVNO:          pvno2,
+		Sender:        directoryName(nil),
+		Recipient:     directoryName(nil),
+		MessageTime:   time.Now().UTC().Truncate(time.Second),
+		TransactionID: c.transactionID,
+		SenderNonce:   randomBytes(t),
+		RecipNonce:    c.recipNonce,
+		GeneralInfo:   generalInfo,
+	}
+	var (
+		params *pbmParameter
+		hash   crypto.Hash
+		err    error
+	)
+	if c.signer != nil {
+		header.ProtectionAlg, hash, err = signatureAlgorithm(c.signer.Public())
+		require.NoError(t, err)
+		header.Sender = directoryName(c.chain[0].RawSubject)
+	} else {
+		params = &pbmParameter{
+			Salt:           randomBytes(t),
+			OWF:            pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			IterationCount: 1000,
+			MAC:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256},
+		}
+		header.ProtectionAlg, err = params.algorithm()
+		require.NoError(t, err)
+		header.SenderKID = []byte("kid")
+	}
+	headerDER, err := asn1.Marshal(header)
+	require.NoError(t, err)
+	bodyDER, err := asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        bodyType,
+		IsCompound: true,
+		Bytes:      content,
+	})
+	require.NoError(t, err)
+
+	msg := pkiMessage{
+		Header: asn1.RawValue{FullBytes: headerDER},
+		Body:   asn1.RawValue{FullBytes: bodyDER},
+	}
+	data, err := protectedPart(msg.Header, msg.Body)
+	require.NoError(t, err)
+	var sig []byte
+	if params != nil {
+		sig, err = params.mac(c.secret, data)
+	} else {
+		sig, err = signData(c.signer, hash, data)
+	}
+	require.NoError(t, err)
+	msg.Protection = asn1.BitString{Bytes: sig, BitLength: len(sig) * 8}
+	for _, crt := range c.chain {
+		msg.ExtraCerts = append(msg.ExtraCerts, asn1.RawValue{FullBytes: crt.Raw})
+	}
+	b, err := asn1.Marshal(msg)
+	require.NoError(t, err)
+	return b
+}
+
+// response parses and verifies a response message.
+func (c *testClient) response(der []byte) *message {
+	t := c.t
+	t.Helper()
+	msg, err := parseMessage(der)
+	require.NoError(t, err)
+	assert.Equal(t, c.transactionID, msg.header.TransactionID)
+	if msg.bodyType() != bodyError {
+		_, err = verifyProtection(msg, c.secret)
+		require.NoError(t, err)
+	}
+	c.recipNonce = msg.header.SenderNonce
+	return msg
+}
+
+func marshal(t *testing.T, v any) []byte {
+	t.Helper()
+	b, err := asn1.Marshal(v)
+	require.NoError(t, err)
+	return b
+}
+
+func implicitTag(t *testing.T, tag int, der []byte) asn1.RawValue {
+	t.Helper()
+	var v asn1.RawValue
+	_, err := asn1.Unmarshal(der, &v)
+	require.NoError(t, err)
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: v.Bytes}
+}
+
+func newCertReqMessages(t *testing.T, signer crypto.Signer, subject pkix.Name, dnsNames ...string) []byte {
+	t.Helper()
+	spki, err := x509.MarshalPKIXPublicKey(signer.Public())
+	require.NoError(t, err)
+	fields := []asn1.RawValue{
+		{Class: asn1.ClassContextSpecific, Tag: 5, IsCompound: true, Bytes: marshal(t, subject.ToRDNSequence())},
+		implicitTag(t, 6, spki),
+	}
+	if len(dnsNames) > 0 {
+		var names []asn1.RawValue
+		for _, n := range dnsNames {
+			names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte(n)})
+		}
+		fields = append(fields, implicitTag(t, 9, marshal(t, []pkix.Extension{{
+			Id:    asn1.ObjectIdentifier{2, 5, 29, 17},
+			Value: marshal(t, names),
+		}})))
+	}
+	tpl := marshal(t, fields)
+	certReq := marshal(t, certRequest{
+		CertReqID:    0,
+		CertTemplate: asn1.RawValue{FullBytes: tpl},
+	})
+
+	alg, hash, err := signatureAlgorithm(signer.Public())
+	require.NoError(t, err)
+	sig, err := signData(signer, hash, certReq)
+	require.NoError(t, err)
+	popo := implicitTag(t, 1, marshal(t, popoSigningKey{
+		Algorithm: alg,
+		Signature: asn1.BitString{Bytes: sig, BitLength: len(sig) * 8},
+	}))
+	return marshal(t, []certReqMsg{{
+		CertReq: asn1.RawValue{FullBytes: certReq},
+		POPO:    popo,
+	}})
+}
+
+func newCertConf(t *testing.T, cert *x509.Certificate, certReqID int) []byte {
+	t.Helper()
+	sum := sha256.Sum256(cert.Raw)
+	return marshal(t, []certStatus{{
+		CertHash:  sum[:],
+		CertReqID: certReqID,
+	}})
+}
+
+func parseCertRep(t *testing.T, msg *message) certRepMessage {
+	t.Helper()
+	var rep certRepMessage
+	_, err := asn1.Unmarshal(msg.content(), &rep)
+	require.NoError(t, err)
+	require.Len(t, rep.Response, 1)
+	return rep
+}
+
+func parseCertificate(t *testing.T, msg *message) *x509.Certificate {
+	t.Helper()
+	rep := parseCertRep(t, msg)
+	require.Equal(t, statusAccepted, rep.Response[0].Status.Status)
+	cert, err := x509.ParseCertificate(rep.Response[0].CertifiedKeyPair.CertOrEncCert.Bytes)
+	require.NoError(t, err)
+	return cert
+}
+
+func assertError(t *testing.T, msg *message, fi failInfo) {
+	t.Helper()
+	require.Equal(t, bodyError, msg.bodyType())
+	var content errorMsgContent
+	_, err := asn1.Unmarshal(msg.content(), &content)
+	require.NoError(t, err)
+	assert.Equal(t, statusRejection, content.PKIStatusInfo.Status)
+	assert.Equal(t, 1, content.PKIStatusInfo.FailInfo.At(int(fi)), "failInfo %d not set", fi)
+}
+
+func TestAuthority_LoadProvisionerByName(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	a := New(&signAuthority{ca: ca})
+
+	p, err := a.LoadProvisionerByName("cmp")
+	require.NoError(t, err)
+	assert.Equal(t, "cmp", p.GetName())
+
+	_, err = a.LoadProvisionerByName("foo")
+	assert.Error(t, err)
+}
+
+func TestAuthority_Process_initializationRequest(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	a := New(&signAuthority{ca: ca})
+	ctx := NewProvisionerContext(context.Background(), newTestProvisioner(t, &provisioner.CMP{
+		SharedSecret: "secret",
+		IncludeRoot:  true,
+	}))
+
+	signer, err := keyutil.GenerateSigner("EC", "P-384", 0)
+	require.NoError(t, err)
+	c := newMACClient(t, "secret")
+	res, err := a.Process(ctx, c.request(bodyIR, newCertReqMessages(t, signer, pkix.Name{CommonName: "device"}, "device.example.com")))
+	require.NoError(t, err)
+
+	msg := c.response(res)
+	require.Equal(t, bodyIP, msg.bodyType())
+	assert.False(t, msg.hasImplicitConfirm())
+	rep := parseCertRep(t, msg)
+	require.Len(t, rep.CAPubs, 1)
+	assert.Equal(t, ca.Root.Raw, rep.CAPubs[0].FullBytes)
+	cert := parseCertificate(t, msg)
+	assert.Equal(t, signer.Public(), cert.PublicKey)
+	assert.Equal(t, "device", cert.Subject.CommonName)
+	assert.Equal(t, []string{"device.example.com"}, cert.DNSNames)
+	require.Len(t, msg.extraCerts, 1)
+	assert.Equal(t, ca.Intermediate.Raw, msg.extraCerts[0].Raw)
+
+	// Confirm the certificate.
+	res, err = a.Process(ctx, c.request(bodyCertConf, newCertConf(t, cert, 0)))
+	require.NoError(t, err)
+	msg = c.response(res)
+	assert.Equal(t, bodyPKIConf, msg.bodyType())
+
+	// The transaction is finished.
+	res, err = a.Process(ctx, c.request(bodyCertConf, newCertConf(t, cert, 0)))
+	assert.Error(t, err)
+	assertError(t, c.response(res), failBadRequest)
+}
+
+func TestAuthority_Process_implicitConfirm(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	a := New(&signAuthority{ca: ca})
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	implicitConfirm := infoTypeAndValue{InfoType: oidImplicitConfirm, InfoValue: asn1.NullRawValue}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := NewProvisionerContext(context.Background(), newTestProvisioner(t, &provisioner.CMP{SharedSecret: "secret"}))
+		c := newMACClient(t, "secret")
+		res, err := a.Process(ctx, c.request(bodyCR, newCertReqMessages(t, signer, pkix.Name{CommonName: "device"}), implicitConfirm))
+		require.NoError(t, err)
+		msg := c.response(res)
+		require.Equal(t, bodyCP, msg.bodyType())
+		assert.True(t, msg.hasImplicitConfirm())
+		assert.Empty(t, parseCertRep(t, msg).CAPubs)
+		cert := parseCertificate(t, msg)
+
+		res, err = a.Process(ctx, c.request(bodyCertConf, newCertConf(t, cert, 0)))
+		assert.Error(t, err)
+		assertError(t, c.response(res), failBadRequest)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		ctx := NewProvisionerContext(context.Background(), newTestProvisioner(t, &provisioner.CMP{
+			SharedSecret:           "secret",
+			DisableImplicitConfirm: true,
+		}))
+		c := newMACClient(t, "secret")
+		res, err := a.Process(ctx, c.request(bodyCR, newCertReqMessages(t, signer, pkix.Name{CommonName: "device"}), implicitConfirm))
+		require.NoError(t, err)
+		msg := c.response(res)
+		assert.False(t, msg.hasImplicitConfirm())
+		cert := parseCertificate(t, msg)
+
+		res, err = a.Process(ctx, c.request(bodyCertConf, newCertConf(t, cert, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, bodyPKIConf, c.response(res).bodyType())
+	})
+}
+
+func TestAuthority_Process_p10cr(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	a := New(&signAuthority{ca: ca})
+	ctx := NewProvisionerContext(context.Background(), newTestProvisioner(t, &provisioner.CMP{
+		Roots: pemEncode(ca.Root),
+	}))
+
+	// Signed with a certificate issued by the provisioner roots.
+	clientSigner, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	clientCert, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "client"},
+		PublicKey: clientSigner.Public(),
+	})
+	require.NoError(t, err)
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	csr, err := stepx509util.CreateCertificateRequest("device", []string{"device.example.com"}, signer)
+	require.NoError(t, err)
+
+	c := newSignatureClient(t, clientSigner, clientCert, ca.Intermediate)
+	res, err := a.Process(ctx, c.request(bodyP10CR, csr.Raw))
+	require.NoError(t, err)
+	msg := c.response(res)
+	require.Equal(t, bodyCP, msg.bodyType())
+	// Signed responses include the CA intermediate.
+	assert.Equal(t, ca.Intermediate.Raw, msg.extraCerts[0].Raw)
+	assert.Equal(t, directoryName(ca.Intermediate.RawSubject), asn1.RawValue{
+		Class: msg.header.Sender.Class, Tag: msg.header.Sender.Tag,
+		IsCompound: msg.header.Sender.IsCompound, Bytes: msg.header.Sender.Bytes,
+	})
+	rep := parseCertRep(t, msg)
+	assert.Equal(t, p10crCertReqID, rep.Response[0].CertReqID)
+	cert := parseCertificate(t, msg)
+	assert.Equal(t, signer.Public(), cert.PublicKey)
+	recipNonce := c.recipNonce
+
+	// certConf must come from the same sender.
+	other := newMACClient(t, "secret")
+	other.transactionID, other.recipNonce = c.transactionID, c.recipNonce
+	res, err = a.Process(ctx, other.request(bodyCertConf, newCertConf(t, cert, p10crCertReqID)))
+	assert.Error(t, err)
+	assertError(t, c.response(res), failWrongIntegrity)
+
+	// certConf must include the last nonce.
+	c.recipNonce = randomBytes(t)
+	res, err = a.Process(ctx, c.request(bodyCertConf, newCertConf(t, cert, p10crCertReqID)))
+	assert.Error(t, err)
+	assertError(t, c.response(res), failBadRecipientNonce)
+
+	c.recipNonce = recipNonce
+	res, err = a.Process(ctx, c.request(bodyCertConf, newCertConf(t, cert, p10crCertReqID)))
+	require.NoError(t, err)
+	assert.Equal(t, bodyPKIConf, c.response(res).bodyType())
+}
+
+func TestAuthority_Process_keyUpdateAndRevocation(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	sa := &signAuthority{ca: ca}
+	a := New(sa)
+	ctx := NewProvisionerContext(context.Background(), newTestProvisioner(t, &provisioner.CMP{SharedSecret: "secret"}))
+
+	oldSigner, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	oldCert, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "device"},
+		DNSNames:  []string{"device.example.com"},
+		PublicKey: oldSigner.Public(),
+	})
+	require.NoError(t, err)
+
+	// Key update requests must be signed.
+	newSigner, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	c := newMACClient(t, "secret")
+	res, err := a.Process(ctx, c.request(bodyKUR, newCertReqMessages(t, newSigner, pkix.Name{})))
+	assert.Error(t, err)
+	assertError(t, c.response(res), failNotAuthorized)
+
+	// Key update signed with the old certificate.
+	c = newSignatureClient(t, oldSigner, oldCert, ca.Intermediate)
+	res, err = a.Process(ctx, c.request(bodyKUR, newCertReqMessages(t, newSigner, pkix.Name{})))
+	require.NoError(t, err)
+	msg := c.response(res)
+	require.Equal(t, bodyKUP, msg.bodyType())
+	newCert := parseCertificate(t, msg)
+	assert.Equal(t, newSigner.Public(), newCert.PublicKey)
+	assert.Equal(t, oldCert.Subject.String(), newCert.Subject.String())
+	res, err = a.Process(ctx, c.request(bodyCertConf, newCertConf(t, newCert, 0)))
+	require.NoError(t, err)
+	assert.Equal(t, bodyPKIConf, c.response(res).bodyType())
+
+	// Revocation of a certificate signed by another one.
+	certDetails := func(serial *big.Int) asn1.RawValue {
+		var v asn1.RawValue
+		_, err := asn1.Unmarshal(marshal(t, serial), &v)
+		require.NoError(t, err)
+		return asn1.RawValue{FullBytes: marshal(t, []asn1.RawValue{{
+			Class: asn1.ClassContextSpecific, Tag: 1, Bytes: v.Bytes,
+		}})}
+	}
+	reason := pkix.Extension{Id: oidReasonCode, Value: marshal(t, asn1.Enumerated(1))}
+	c = newSignatureClient(t, newSigner, newCert, ca.Intermediate)
+	res, err = a.Process(ctx, c.request(bodyRR, marshal(t, []revDetails{{
+		CertDetails: certDetails(oldCert.SerialNumber), CRLEntryDetails: []pkix.Extension{reason},
+	}})))
+	assert.Error(t, err)
+	assertError(t, c.response(res), failBadCertID)
+	assert.Nil(t, sa.revoked)
+
+	// Revocation signed with the certificate to revoke.
+	c = newSignatureClient(t, newSigner, newCert, ca.Intermediate)
+	res, err = a.Process(ctx, c.request(bodyRR, marshal(t, []revDetails{{
+		CertDetails: certDetails(newCert.SerialNumber), CRLEntryDetails: []pkix.Extension{reason},
+	}})))
+	require.NoError(t, err)
+	msg = c.response(res)
+	require.Equal(t, bodyRP, msg.bodyType())
+	var rp revRepContent
+	_, err = asn1.Unmarshal(msg.content(), &rp)
+	require.NoError(t, err)
+	assert.Equal(t, []pkiStatusInfo{{Status: statusAccepted}}, rp.Status)
+	require.NotNil(t, sa.revoked)
+	assert.Equal(t, newCert.SerialNumber.String(), sa.revoked.Serial)
+	assert.Equal(t, 1, sa.revoked.ReasonCode)
+	assert.True(t, sa.revoked.MTLS)
+
+	// Revoked certificates cannot be used.
+	c = newSignatureClient(t, newSigner, newCert, ca.Intermediate)
+	res, err = a.Process(ctx, c.request(bodyKUR, newCertReqMessages(t, oldSigner, pkix.Name{})))
+	assert.Error(t, err)
+	assertError(t, c.response(res), failCertRevoked)
+}
+
+func TestAuthority_Process_polling(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	sa := &signAuthority{ca: ca, wait: make(chan struct{})}
+	a := New(sa)
+	ctx := NewProvisionerContext(context.Background(), newTestProvisioner(t, &provisioner.CMP{
+		SharedSecret:     "secret",
+		PollingThreshold: &provisioner.Duration{Duration: 10 * time.Millisecond},
+	}))
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	c := newMACClient(t, "secret")
+	res, err := a.Process(ctx, c.request(bodyIR, newCertReqMessages(t, signer, pkix.Name{CommonName: "device"})))
+	require.NoError(t, err)
+	msg := c.response(res)
+	require.Equal(t, bodyIP, msg.bodyType())
+	assert.Equal(t, statusWaiting, parseCertRep(t, msg).Response[0].Status.Status)
+
+	// The same transactionID cannot be reused.
+	other := newMACClient(t, "secret")
+	other.transactionID = c.transactionID
+	res, err = a.Process(ctx, other.request(bodyIR, newCertReqMessages(t, signer, pkix.Name{CommonName: "device"})))
+	assert.Error(t, err)
+	assertError(t, other.response(res), failTransactionIDInUse)
+
+	res, err = a.Process(ctx, c.request(bodyPollReq, marshal(t, []pollReq{{CertReqID: 0}})))
+	require.NoError(t, err)
+	msg = c.response(res)
+	require.Equal(t, bodyPollRep, msg.bodyType())
+	var rep []pollRep
+	_, err = asn1.Unmarshal(msg.content(), &rep)
+	require.NoError(t, err)
+	assert.Equal(t, []pollRep{{CertReqID: 0, CheckAfter: 1}}, rep)
+
+	close(sa.wait)
+	require.Eventually(t, func() bool {
+		tx := a.transactions.get(transactionKey("cmp", c.transactionID))
+		return tx != nil && tx.isDone()
+	}, time.Second, 10*time.Millisecond)
+
+	res, err = a.Process(ctx, c.request(bodyPollReq, marshal(t, []pollReq{{CertReqID: 0}})))
+	require.NoError(t, err)
+	msg = c.response(res)
+	require.Equal(t, bodyIP, msg.bodyType())
+	cert := parseCertificate(t, msg)
+
+	res, err = a.Process(ctx, c.request(bodyCertConf, newCertConf(t, cert, 0)))
+	require.NoError(t, err)
+	assert.Equal(t, bodyPKIConf, c.response(res).bodyType())
+}
+
+func TestAuthority_Process_certConfRejection(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	ctx := NewProvisionerContext(context.Background(), newTestProvisioner(t, &provisioner.CMP{SharedSecret: "secret"}))
+
+	enroll := func(t *testing.T, a *Authority) (*testClient, *x509.Certificate) {
+		t.Helper()
+		signer, err := keyutil.GenerateDefaultSigner()
+		require.NoError(t, err)
+		c := newMACClient(t, "secret")
+		res, err := a.Process(ctx, c.request(bodyIR, newCertReqMessages(t, signer, pkix.Name{CommonName: "device"})))
+		require.NoError(t, err)
+		return c, parseCertificate(t, c.response(res))
+	}
+
+	t.Run("rejected", func(t *testing.T) {
+		sa := &signAuthority{ca: ca}
+		a := New(sa)
+		c, cert := enroll(t, a)
+		sum := sha256.Sum256(cert.Raw)
+		res, err := a.Process(ctx, c.request(bodyCertConf, marshal(t, []certStatus{{
+			CertHash:   sum[:],
+			StatusInfo: pkiStatusInfo{Status: statusRejection},
+		}})))
+		require.NoError(t, err)
+		assert.Equal(t, bodyPKIConf, c.response(res).bodyType())
+		require.NotNil(t, sa.revoked)
+		assert.Equal(t, cert.SerialNumber.String(), sa.revoked.Serial)
+		assert.Equal(t, cert, sa.revoked.Crt)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		sa := &signAuthority{ca: ca}
+		a := New(sa)
+		c, cert := enroll(t, a)
+		res, err := a.Process(ctx, c.request(bodyCertConf, marshal(t, []certStatus{})))
+		require.NoError(t, err)
+		assert.Equal(t, bodyPKIConf, c.response(res).bodyType())
+		require.NotNil(t, sa.revoked)
+		assert.Equal(t, cert.SerialNumber.String(), sa.revoked.Serial)
+	})
+
+	t.Run("accepted", func(t *testing.T) {
+		sa := &signAuthority{ca: ca}
+		a := New(sa)
+		c, cert := enroll(t, a)
+		res, err := a.Process(ctx, c.request(bodyCertConf, newCertConf(t, cert, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, bodyPKIConf, c.response(res).bodyType())
+		assert.Nil(t, sa.revoked)
+	})
+}
+
+func TestAuthority_Process_persistedTransaction(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	sa := newDBSignAuthority(t, ca)
+	ctx := NewProvisionerContext(context.Background(), newTestProvisioner(t, &provisioner.CMP{SharedSecret: "secret"}))
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	c := newMACClient(t, "secret")
+	res, err := New(sa).Process(ctx, c.request(bodyIR, newCertReqMessages(t, signer, pkix.Name{CommonName: "device"})))
+	require.NoError(t, err)
+	cert := parseCertificate(t, c.response(res))
+
+	// The confirmation is processed by a new authority, e.g. after a restart.
+	a := New(sa)
+	other := newMACClient(t, "secret")
+	other.transactionID = c.transactionID
+	res, err = a.Process(ctx, other.request(bodyCertConf, newCertConf(t, cert, 0)))
+	assert.Error(t, err)
+	assertError(t, other.response(res), failBadRecipientNonce)
+
+	res, err = a.Process(ctx, c.request(bodyCertConf, newCertConf(t, cert, 0)))
+	require.NoError(t, err)
+	assert.Equal(t, bodyPKIConf, c.response(res).bodyType())
+	assert.Nil(t, sa.revoked)
+
+	// The transaction is finished.
+	res, err = New(sa).Process(ctx, c.request(bodyCertConf, newCertConf(t, cert, 0)))
+	assert.Error(t, err)
+	assertError(t, c.response(res), failBadRequest)
+	txs, err := sa.db.(db.CMPTransactionDB).GetCMPTransactions()
+	require.NoError(t, err)
+	assert.Empty(t, txs)
+}
+
+func TestAuthority_RevokeUnconfirmedCertificates(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	sa := newDBSignAuthority(t, ca)
+	a := New(sa)
+	ctx := NewProvisionerContext(context.Background(), newTestProvisioner(t, &provisioner.CMP{
+		SharedSecret:    "secret",
+		ConfirmWaitTime: &provisioner.Duration{Duration: 50 * time.Millisecond},
+	}))
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	c := newMACClient(t, "secret")
+	res, err := a.Process(ctx, c.request(bodyIR, newCertReqMessages(t, signer, pkix.Name{CommonName: "device"})))
+	require.NoError(t, err)
+	cert := parseCertificate(t, c.response(res))
+
+	// Not expired yet.
+	require.NoError(t, a.RevokeUnconfirmedCertificates(context.Background()))
+	assert.Nil(t, sa.revoked)
+
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, a.RevokeUnconfirmedCertificates(context.Background()))
+	require.NotNil(t, sa.revoked)
+	assert.Equal(t, cert.SerialNumber.String(), sa.revoked.Serial)
+	assert.Equal(t, "certificate not confirmed", sa.revoked.Reason)
+
+	// The certificate cannot be confirmed anymore.
+	res, err = a.Process(ctx, c.request(bodyCertConf, newCertConf(t, cert, 0)))
+	assert.Error(t, err)
+	assertError(t, c.response(res), failBadRequest)
+
+	// Nothing left to revoke.
+	sa.revoked = nil
+	require.NoError(t, a.RevokeUnconfirmedCertificates(context.Background()))
+	assert.Nil(t, sa.revoked)
+}
+
+func TestAuthority_Process_errors(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	a := New(&signAuthority{ca: ca})
+	ctx := NewProvisionerContext(context.Background(), newTestProvisioner(t, &provisioner.CMP{SharedSecret: "secret"}))
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	otherSigner, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	otherCert, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "client"},
+		PublicKey: otherSigner.Public(),
+	})
+	require.NoError(t, err)
+
+	t.Run("fail/bad-data-format", func(t *testing.T) {
+		res, err := a.Process(ctx, []byte("foo"))
+		assert.Error(t, err)
+		msg, err := parseMessage(res)
+		require.NoError(t, err)
+		assertError(t, msg, failBadDataFormat)
+	})
+
+	t.Run("fail/wrong-secret", func(t *testing.T) {
+		c := newMACClient(t, "foo")
+		res, err := a.Process(ctx, c.request(bodyIR, newCertReqMessages(t, signer, pkix.Name{CommonName: "device"})))
+		assert.Error(t, err)
+		msg := c.response(res)
+		assertError(t, msg, failBadMessageCheck)
+		assert.Zero(t, msg.raw.Protection.BitLength)
+	})
+
+	t.Run("fail/signature-not-enabled", func(t *testing.T) {
+		c := newSignatureClient(t, otherSigner, otherCert, ca.Intermediate)
+		res, err := a.Process(ctx, c.request(bodyIR, newCertReqMessages(t, signer, pkix.Name{CommonName: "device"})))
+		assert.Error(t, err)
+		assertError(t, c.response(res), failSignerNotTrusted)
+	})
+
+	t.Run("fail/bad-pop", func(t *testing.T) {
+		c := newMACClient(t, "secret")
+		der := newCertReqMessages(t, signer, pkix.Name{CommonName: "device"})
+		var msgs []certReqMsg
+		_, err := asn1.Unmarshal(der, &msgs)
+		require.NoError(t, err)
+		msgs[0].POPO = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: []byte{}}
+		res, err := a.Process(ctx, c.request(bodyIR, marshal(t, msgs)))
+		assert.Error(t, err)
+		assertError(t, c.response(res), failBadPOP)
+	})
+
+	t.Run("fail/wrong-pop-key", func(t *testing.T) {
+		c := newMACClient(t, "secret")
+		der := newCertReqMessages(t, signer, pkix.Name{CommonName: "device"})
+		other := newCertReqMessages(t, otherSigner, pkix.Name{CommonName: "device"})
+		var msgs, otherMsgs []certReqMsg
+		_, err := asn1.Unmarshal(der, &msgs)
+		require.NoError(t, err)
+		_, err = asn1.Unmarshal(other, &otherMsgs)
+		require.NoError(t, err)
+		msgs[0].POPO = otherMsgs[0].POPO
+		res, err := a.Process(ctx, c.request(bodyIR, marshal(t, msgs)))
+		assert.Error(t, err)
+		assertError(t, c.response(res), failBadPOP)
+	})
+
+	t.Run("fail/unsupported-body", func(t *testing.T) {
+		c := newMACClient(t, "secret")
+		res, err := a.Process(ctx, c.request(bodyPKIConf, marshal(t, asn1.NullRawValue)))
+		assert.Error(t, err)
+		assertError(t, c.response(res), failBadRequest)
+	})
+
+	t.Run("fail/unknown-transaction", func(t *testing.T) {
+		c := newMACClient(t, "secret")
+		res, err := a.Process(ctx, c.request(bodyPollReq, marshal(t, []pollReq{{CertReqID: 0}})))
+		assert.Error(t, err)
+		assertError(t, c.response(res), failBadRequest)
+	})
+
+	t.Run("fail/bad-cert-hash", func(t *testing.T) {
+		c := newMACClient(t, "secret")
+		res, err := a.Process(ctx, c.request(bodyIR, newCertReqMessages(t, signer, pkix.Name{CommonName: "device"})))
+		require.NoError(t, err)
+		c.response(res)
+		res, err = a.Process(ctx, c.request(bodyCertConf, newCertConf(t, otherCert, 0)))
+		assert.Error(t, err)
+		assertError(t, c.response(res), failBadCertID)
+	})
+}
+
+func Test_validateHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header pkiHeader
+		want   failInfo
+	}{
+		{"fail/version", pkiHeader{PVNO: 1, TransactionID: []byte("tx"), SenderNonce: []byte("nonce")}, failUnsupportedVersion},
+		{"fail/transactionID", pkiHeader{PVNO: pvno2, SenderNonce: []byte("nonce")}, failBadRequest},
+		{"fail/senderNonce", pkiHeader{PVNO: pvno3, TransactionID: []byte("tx")}, failBadSenderNonce},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateHeader(&message{header: tt.header})
+			var e *Error
+			require.ErrorAs(t, err, &e)
+			assert.Equal(t, tt.want, e.FailInfo)
+		})
+	}
+	assert.NoError(t, validateHeader(&message{header: pkiHeader{PVNO: pvno3, TransactionID: []byte("tx"), SenderNonce: []byte("nonce")}}))
+}
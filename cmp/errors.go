@@ -0,0 +1,89 @@
+package cmp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// failInfo is a bit of the PKIFailureInfo, as defined in RFC 4210, section
+// 5.2.3.
+type failInfo int
+
+const (
+	failBadAlg             failInfo = 0
+	failBadMessageCheck    failInfo = 1
+	failBadRequest         failInfo = 2
+	failBadCertID          failInfo = 4
+	failBadDataFormat      failInfo = 5
+	failBadPOP             failInfo = 9
+	failCertRevoked        failInfo = 10
+	failWrongIntegrity     failInfo = 12
+	failBadRecipientNonce  failInfo = 13
+	failBadSenderNonce     failInfo = 18
+	failBadCertTemplate    failInfo = 19
+	failSignerNotTrusted   failInfo = 20
+	failTransactionIDInUse failInfo = 21
+	failUnsupportedVersion failInfo = 22
+	failNotAuthorized      failInfo = 23
+	failSystemFailure      failInfo = 25
+)
+
+// Error is an error returned to the client in a CMP error message.
+type Error struct {
+	FailInfo failInfo
+	Message  string
+	Err      error
+}
+
+// newError returns a new Error with the given failure and message.
+func newError(fi failInfo, format string, args ...any) *Error {
+	msg := fmt.Sprintf(format, args...)
+	return &Error{
+		FailInfo: fi,
+		Message:  msg,
+		Err:      errors.New(msg),
+	}
+}
+
+// wrapError returns a new Error with the given failure and message wrapping
+// the given error.
+func wrapError(fi failInfo, err error, format string, args ...any) *Error {
+	return &Error{
+		FailInfo: fi,
+		Message:  fmt.Sprintf(format, args...),
+		Err:      err,
+	}
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.Err == nil || e.Err.Error() == e.Message {
+		return e.Message
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// asError converts any error into an Error. Errors with an HTTP status code,
+// like the ones returned by the authority, are mapped to the closest failure.
+func asError(err error, msg string) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) {
+		switch sc.StatusCode() {
+		case http.StatusBadRequest:
+			return wrapError(failBadRequest, err, "%s", msg)
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return wrapError(failNotAuthorized, err, "%s", msg)
+		}
+	}
+	return wrapError(failSystemFailure, err, "%s", msg)
+}
@@ -0,0 +1,326 @@
+package cmp
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Body types of a PKIMessage, as defined in RFC 4210, section 5.1.2.
+const (
+	bodyIR       = 0
+	bodyIP       = 1
+	bodyCR       = 2
+	bodyCP       = 3
+	bodyP10CR    = 4
+	bodyKUR      = 7
+	bodyKUP      = 8
+	bodyRR       = 11
+	bodyRP       = 12
+	bodyPKIConf  = 19
+	bodyError    = 23
+	bodyCertConf = 24
+	bodyPollReq  = 25
+	bodyPollRep  = 26
+)
+
+// PKIStatus values, as defined in RFC 4210, section 5.2.3.
+const (
+	statusAccepted  = 0
+	statusRejection = 2
+	statusWaiting   = 3
+)
+
+// Supported protocol versions. Version 3 is defined in RFC 9480.
+const (
+	pvno2 = 2
+	pvno3 = 3
+)
+
+// p10crCertReqID is the certReqId used in responses to p10cr messages.
+const p10crCertReqID = -1
+
+var (
+	oidImplicitConfirm = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 4, 13}
+	oidReasonCode      = asn1.ObjectIdentifier{2, 5, 29, 21}
+)
+
+// pkiMessage is the ASN.1 structure of a CMP message. The header and the body
+// are kept as raw values so the protected part can be computed from the
+// original encoding.
+type pkiMessage struct {
+	Header     asn1.RawValue
+	Body       asn1.RawValue
+	Protection asn1.BitString  `asn1:"optional,explicit,tag:0"`
+	ExtraCerts []asn1.RawValue `asn1:"optional,explicit,tag:1"`
+}
+
+// pkiHeader is the ASN.1 structure of the header of a CMP message.
+type pkiHeader struct {
+	PVNO          int
+	Sender        asn1.RawValue
+	Recipient     asn1.RawValue
+	MessageTime   time.Time                `asn1:"optional,explicit,tag:0,generalized"`
+	ProtectionAlg pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:1"`
+	SenderKID     []byte                   `asn1:"optional,explicit,tag:2"`
+	RecipKID      []byte                   `asn1:"optional,explicit,tag:3"`
+	TransactionID []byte                   `asn1:"optional,explicit,tag:4"`
+	SenderNonce   []byte                   `asn1:"optional,explicit,tag:5"`
+	RecipNonce    []byte                   `asn1:"optional,explicit,tag:6"`
+	FreeText      []asn1.RawValue          `asn1:"optional,explicit,tag:7"`
+	GeneralInfo   []infoTypeAndValue       `asn1:"optional,explicit,tag:8"`
+}
+
+type infoTypeAndValue struct {
+	InfoType  asn1.ObjectIdentifier
+	InfoValue asn1.RawValue `asn1:"optional"`
+}
+
+type certReqMsg struct {
+	CertReq asn1.RawValue
+	POPO    asn1.RawValue `asn1:"optional"`
+	RegInfo asn1.RawValue `asn1:"optional"`
+}
+
+type certRequest struct {
+	CertReqID    int
+	CertTemplate asn1.RawValue
+	Controls     asn1.RawValue `asn1:"optional"`
+}
+
+type popoSigningKey struct {
+	Input     asn1.RawValue `asn1:"optional,tag:0"`
+	Algorithm pkix.AlgorithmIdentifier
+	Signature asn1.BitString
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+type certRepMessage struct {
+	CAPubs   []asn1.RawValue `asn1:"optional,explicit,tag:1"`
+	Response []certResponse
+}
+
+type certResponse struct {
+	CertReqID        int
+	Status           pkiStatusInfo
+	CertifiedKeyPair certifiedKeyPair `asn1:"optional"`
+}
+
+type certifiedKeyPair struct {
+	CertOrEncCert asn1.RawValue
+}
+
+type revDetails struct {
+	CertDetails     asn1.RawValue
+	CRLEntryDetails []pkix.Extension `asn1:"optional"`
+}
+
+type revRepContent struct {
+	Status []pkiStatusInfo
+}
+
+type certStatus struct {
+	CertHash   []byte
+	CertReqID  int
+	StatusInfo pkiStatusInfo            `asn1:"optional"`
+	HashAlg    pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:0"`
+}
+
+type pollReq struct {
+	CertReqID int
+}
+
+type pollRep struct {
+	CertReqID  int
+	CheckAfter int
+}
+
+type errorMsgContent struct {
+	PKIStatusInfo pkiStatusInfo
+}
+
+// message is a parsed CMP message.
+type message struct {
+	raw        *pkiMessage
+	header     pkiHeader
+	extraCerts []*x509.Certificate
+}
+
+// parseMessage parses a DER encoded CMP message.
+func parseMessage(der []byte) (*message, error) {
+	var raw pkiMessage
+	rest, err := asn1.Unmarshal(der, &raw)
+	switch {
+	case err != nil:
+		return nil, err
+	case len(rest) > 0:
+		return nil, errors.New("trailing data after message")
+	case raw.Body.Class != asn1.ClassContextSpecific || !raw.Body.IsCompound:
+		return nil, errors.New("invalid message body")
+	}
+
+	msg := &message{raw: &raw}
+	if rest, err = asn1.Unmarshal(raw.Header.FullBytes, &msg.header); err != nil {
+		return nil, fmt.Errorf("error parsing message header: %w", err)
+	} else if len(rest) > 0 {
+		return nil, errors.New("trailing data after message header")
+	}
+	for _, rv := range raw.ExtraCerts {
+		cert, err := x509.ParseCertificate(rv.FullBytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing extraCerts: %w", err)
+		}
+		msg.extraCerts = append(msg.extraCerts, cert)
+	}
+	return msg, nil
+}
+
+// bodyType returns the type of the message body.
+func (m *message) bodyType() int {
+	return m.raw.Body.Tag
+}
+
+// content returns the DER encoding of the body content.
+func (m *message) content() []byte {
+	return m.raw.Body.Bytes
+}
+
+// hasImplicitConfirm returns true if the client requested implicit
+// confirmation.
+func (m *message) hasImplicitConfirm() bool {
+	for _, v := range m.header.GeneralInfo {
+		if v.InfoType.Equal(oidImplicitConfirm) {
+			return true
+		}
+	}
+	return false
+}
+
+// protectedPart returns the DER encoding of the ProtectedPart of the message,
+// that is the sequence of the header and the body.
+func protectedPart(header, body asn1.RawValue) ([]byte, error) {
+	return asn1.Marshal(asn1.RawValue{
+		Tag:        asn1.TagSequence,
+		IsCompound: true,
+		Bytes:      append(append([]byte{}, header.FullBytes...), body.FullBytes...),
+	})
+}
+
+// newBody returns a body of the given type with the DER encoding of the given
+// value.
+func newBody(bodyType int, v any) (asn1.RawValue, error) {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	return asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        bodyType,
+		IsCompound: true,
+		Bytes:      b,
+	}, nil
+}
+
+// directoryName returns a GeneralName with the given DER encoded name.
+func directoryName(name []byte) asn1.RawValue {
+	if len(name) == 0 {
+		name = []byte{0x30, 0x00} // NULL-DN
+	}
+	return asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        4,
+		IsCompound: true,
+		Bytes:      name,
+	}
+}
+
+// freeText returns a PKIFreeText with the given string.
+func freeText(s string) []asn1.RawValue {
+	return []asn1.RawValue{{
+		Tag:   asn1.TagUTF8String,
+		Bytes: []byte(s),
+	}}
+}
+
+// failureInfo returns a PKIFailureInfo with the given bit set.
+func failureInfo(bit failInfo) asn1.BitString {
+	b := make([]byte, int(bit)/8+1)
+	b[int(bit)/8] = 0x80 >> (uint(bit) % 8)
+	return asn1.BitString{Bytes: b, BitLength: int(bit) + 1}
+}
+
+// retag returns the DER encoding of an implicitly tagged value using the given
+// universal tag.
+func retag(v asn1.RawValue, tag int, isCompound bool) []byte {
+	b, _ := asn1.Marshal(asn1.RawValue{
+		Tag:        tag,
+		IsCompound: isCompound,
+		Bytes:      v.Bytes,
+	})
+	return b
+}
+
+// certTemplate contains the supported fields of a CRMF CertTemplate.
+type certTemplate struct {
+	SerialNumber *big.Int
+	Issuer       []byte
+	Subject      []byte
+	PublicKey    crypto.PublicKey
+	Extensions   []pkix.Extension
+}
+
+// parseCertTemplate parses the CertTemplate defined in RFC 4211, section 5.
+// The fields in a CertTemplate are implicitly tagged, except for the names
+// that are CHOICE types.
+func parseCertTemplate(der []byte) (*certTemplate, error) {
+	var seq asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &seq); err != nil {
+		return nil, err
+	}
+	if seq.Class != asn1.ClassUniversal || seq.Tag != asn1.TagSequence {
+		return nil, errors.New("certTemplate is not a sequence")
+	}
+
+	tpl := new(certTemplate)
+	for b := seq.Bytes; len(b) > 0; {
+		var (
+			field asn1.RawValue
+			err   error
+		)
+		if b, err = asn1.Unmarshal(b, &field); err != nil {
+			return nil, err
+		}
+		if field.Class != asn1.ClassContextSpecific {
+			return nil, errors.New("invalid certTemplate field")
+		}
+		switch field.Tag {
+		case 1:
+			if _, err := asn1.Unmarshal(retag(field, asn1.TagInteger, false), &tpl.SerialNumber); err != nil {
+				return nil, fmt.Errorf("error parsing serialNumber: %w", err)
+			}
+		case 3:
+			tpl.Issuer = field.Bytes
+		case 5:
+			tpl.Subject = field.Bytes
+		case 6:
+			if tpl.PublicKey, err = x509.ParsePKIXPublicKey(retag(field, asn1.TagSequence, true)); err != nil {
+				return nil, fmt.Errorf("error parsing publicKey: %w", err)
+			}
+		case 9:
+			if _, err := asn1.Unmarshal(retag(field, asn1.TagSequence, true), &tpl.Extensions); err != nil {
+				return nil, fmt.Errorf("error parsing extensions: %w", err)
+			}
+		}
+	}
+	return tpl, nil
+}
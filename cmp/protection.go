@@ -0,0 +1,309 @@
+package cmp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // used only with HMAC for interoperability
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// Limits of the iteration count accepted in PasswordBasedMac parameters.
+const (
+	minIterationCount = 100
+	maxIterationCount = 100000
+)
+
+var (
+	oidPasswordBasedMac = asn1.ObjectIdentifier{1, 2, 840, 113533, 7, 66, 13}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 8, 1, 2}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+var hashAlgorithms = []struct {
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+}{
+	{oidSHA1, crypto.SHA1},
+	{oidSHA256, crypto.SHA256},
+	{oidSHA384, crypto.SHA384},
+	{oidSHA512, crypto.SHA512},
+}
+
+var macAlgorithms = []struct {
+	oid  asn1.ObjectIdentifier
+	hash func() hash.Hash
+}{
+	{oidHMACWithSHA1, sha1.New},
+	{oidHMACWithSHA256, sha256.New},
+	{oidHMACWithSHA384, sha512.New384},
+	{oidHMACWithSHA512, sha512.New},
+}
+
+var signatureAlgorithms = []struct {
+	oid  asn1.ObjectIdentifier
+	algo x509.SignatureAlgorithm
+}{
+	{oidSHA256WithRSA, x509.SHA256WithRSA},
+	{oidSHA384WithRSA, x509.SHA384WithRSA},
+	{oidSHA512WithRSA, x509.SHA512WithRSA},
+	{oidECDSAWithSHA256, x509.ECDSAWithSHA256},
+	{oidECDSAWithSHA384, x509.ECDSAWithSHA384},
+	{oidECDSAWithSHA512, x509.ECDSAWithSHA512},
+	{oidEd25519, x509.PureEd25519},
+}
+
+// pbmParameter are the parameters of the PasswordBasedMac algorithm defined
+// in RFC 4211, section 4.4.
+type pbmParameter struct {
+	Salt           []byte
+	OWF            pkix.AlgorithmIdentifier
+	IterationCount int
+	MAC            pkix.AlgorithmIdentifier
+}
+
+// parsePBMParameter parses the parameters of a PasswordBasedMac algorithm.
+func parsePBMParameter(alg pkix.AlgorithmIdentifier) (*pbmParameter, error) {
+	var params pbmParameter
+	if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("error parsing PasswordBasedMac parameters: %w", err)
+	}
+	if params.IterationCount < minIterationCount || params.IterationCount > maxIterationCount {
+		return nil, fmt.Errorf("PasswordBasedMac iteration count must be between %d and %d", minIterationCount, maxIterationCount)
+	}
+	return &params, nil
+}
+
+// mac computes the PasswordBasedMac of the given data.
+func (p *pbmParameter) mac(secret, data []byte) ([]byte, error) {
+	owf, err := hashAlgorithm(p.OWF)
+	if err != nil {
+		return nil, err
+	}
+	var newMAC func() hash.Hash
+	for _, m := range macAlgorithms {
+		if m.oid.Equal(p.MAC.Algorithm) {
+			newMAC = m.hash
+			break
+		}
+	}
+	if newMAC == nil {
+		return nil, fmt.Errorf("unsupported MAC algorithm %s", p.MAC.Algorithm)
+	}
+
+	// The one-way function is applied iterationCount times to the salted
+	// secret to derive the key.
+	h := owf.New()
+	h.Write(secret)
+	h.Write(p.Salt)
+	key := h.Sum(nil)
+	for i := 1; i < p.IterationCount; i++ {
+		h.Reset()
+		h.Write(key)
+		key = h.Sum(nil)
+	}
+
+	m := hmac.New(newMAC, key)
+	m.Write(data)
+	return m.Sum(nil), nil
+}
+
+// algorithm returns the AlgorithmIdentifier of a PasswordBasedMac with these
+// parameters.
+func (p *pbmParameter) algorithm() (pkix.AlgorithmIdentifier, error) {
+	b, err := asn1.Marshal(*p)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+	return pkix.AlgorithmIdentifier{
+		Algorithm:  oidPasswordBasedMac,
+		Parameters: asn1.RawValue{FullBytes: b},
+	}, nil
+}
+
+// withNewSalt returns a copy of the parameters with a new random salt.
+func (p *pbmParameter) withNewSalt() (*pbmParameter, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	params := *p
+	params.Salt = salt
+	return &params, nil
+}
+
+// hashAlgorithm returns the hash function of the given algorithm.
+func hashAlgorithm(alg pkix.AlgorithmIdentifier) (crypto.Hash, error) {
+	for _, h := range hashAlgorithms {
+		if h.oid.Equal(alg.Algorithm) {
+			return h.hash, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported hash algorithm %s", alg.Algorithm)
+}
+
+// verifySignature verifies the signature of the given data using the public
+// key and the signature algorithm.
+func verifySignature(pub crypto.PublicKey, alg pkix.AlgorithmIdentifier, signed, signature []byte) error {
+	for _, s := range signatureAlgorithms {
+		if s.oid.Equal(alg.Algorithm) {
+			cert := &x509.Certificate{PublicKey: pub}
+			return cert.CheckSignature(s.algo, signed, signature)
+		}
+	}
+	return newError(failBadAlg, "unsupported signature algorithm %s", alg.Algorithm)
+}
+
+// signatureAlgorithm returns the signature algorithm and hash function used
+// to sign with the given public key.
+func signatureAlgorithm(pub crypto.PublicKey) (pkix.AlgorithmIdentifier, crypto.Hash, error) {
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch pub.Curve.Params().BitSize {
+		case 384:
+			return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA384}, crypto.SHA384, nil
+		case 521:
+			return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA512}, crypto.SHA512, nil
+		default:
+			return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}, crypto.SHA256, nil
+		}
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidSHA256WithRSA, Parameters: asn1.NullRawValue}, crypto.SHA256, nil
+	case ed25519.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidEd25519}, 0, nil
+	default:
+		return pkix.AlgorithmIdentifier{}, 0, fmt.Errorf("unsupported signer key type %T", pub)
+	}
+}
+
+// signData signs the given data with the signer using the given hash
+// function. A zero hash is used with Ed25519 keys that sign the message.
+func signData(signer crypto.Signer, hash crypto.Hash, data []byte) ([]byte, error) {
+	digest := data
+	if hash != 0 {
+		h := hash.New()
+		h.Write(data)
+		digest = h.Sum(nil)
+	}
+	return signer.Sign(rand.Reader, digest, hash)
+}
+
+// certificateHash returns the hash of a certificate used in certConf
+// messages. If the hash algorithm is not defined, the hash used in the
+// certificate signature is used, as defined in RFC 4210, section 5.3.18.
+func certificateHash(cert *x509.Certificate, alg pkix.AlgorithmIdentifier) ([]byte, error) {
+	var hash crypto.Hash
+	if len(alg.Algorithm) > 0 {
+		var err error
+		if hash, err = hashAlgorithm(alg); err != nil {
+			return nil, err
+		}
+	} else {
+		switch cert.SignatureAlgorithm {
+		case x509.SHA384WithRSA, x509.SHA384WithRSAPSS, x509.ECDSAWithSHA384:
+			hash = crypto.SHA384
+		case x509.SHA512WithRSA, x509.SHA512WithRSAPSS, x509.ECDSAWithSHA512, x509.PureEd25519:
+			hash = crypto.SHA512
+		default:
+			hash = crypto.SHA256
+		}
+	}
+	h := hash.New()
+	h.Write(cert.Raw)
+	return h.Sum(nil), nil
+}
+
+// protection contains the protection mechanism used in a request.
+type protection struct {
+	params *pbmParameter
+	secret []byte
+	cert   *x509.Certificate
+}
+
+// isMAC returns true if the request was protected using a MAC.
+func (p *protection) isMAC() bool {
+	return p.params != nil
+}
+
+// sameSender returns true if the given protection was done by the same
+// entity.
+func (p *protection) sameSender(o *protection) bool {
+	switch {
+	case p.isMAC() || o.isMAC():
+		return p.isMAC() && o.isMAC()
+	default:
+		return bytes.Equal(p.cert.Raw, o.cert.Raw)
+	}
+}
+
+// verifyProtection verifies the protection of a message using the shared
+// secret of the provisioner or the first certificate in extraCerts. The
+// trust on the certificate is validated by each operation.
+func verifyProtection(msg *message, secret []byte) (*protection, error) {
+	alg := msg.header.ProtectionAlg
+	if len(alg.Algorithm) == 0 || msg.raw.Protection.BitLength == 0 {
+		return nil, newError(failNotAuthorized, "message is not protected")
+	}
+	data, err := protectedPart(msg.raw.Header, msg.raw.Body)
+	if err != nil {
+		return nil, wrapError(failBadDataFormat, err, "error encoding protected part")
+	}
+
+	if alg.Algorithm.Equal(oidPasswordBasedMac) {
+		if len(secret) == 0 {
+			return nil, newError(failWrongIntegrity, "MAC-based protection is not enabled")
+		}
+		params, err := parsePBMParameter(alg)
+		if err != nil {
+			return nil, wrapError(failBadAlg, err, "invalid protection algorithm")
+		}
+		mac, err := params.mac(secret, data)
+		if err != nil {
+			return nil, wrapError(failBadAlg, err, "invalid protection algorithm")
+		}
+		if !hmac.Equal(mac, msg.raw.Protection.RightAlign()) {
+			return nil, newError(failBadMessageCheck, "invalid message protection")
+		}
+		return &protection{params: params, secret: secret}, nil
+	}
+
+	if len(msg.extraCerts) == 0 {
+		return nil, newError(failBadMessageCheck, "missing protection certificate")
+	}
+	cert := msg.extraCerts[0]
+	if err := verifySignature(cert.PublicKey, alg, data, msg.raw.Protection.RightAlign()); err != nil {
+		var e *Error
+		if errors.As(err, &e) {
+			return nil, e
+		}
+		return nil, wrapError(failBadMessageCheck, err, "invalid message protection")
+	}
+	return &protection{cert: cert}, nil
+}
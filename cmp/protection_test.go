@@ -0,0 +1,77 @@
+package cmp
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parsePBMParameter(t *testing.T) {
+	algorithm := func(iterations int, mac asn1.ObjectIdentifier) pkix.AlgorithmIdentifier {
+		p := &pbmParameter{
+			Salt:           []byte("salt"),
+			OWF:            pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			IterationCount: iterations,
+			MAC:            pkix.AlgorithmIdentifier{Algorithm: mac},
+		}
+		alg, err := p.algorithm()
+		require.NoError(t, err)
+		return alg
+	}
+	tests := []struct {
+		name       string
+		alg        pkix.AlgorithmIdentifier
+		wantErr    bool
+		wantMACErr bool
+	}{
+		{"ok", algorithm(1000, oidHMACWithSHA256), false, false},
+		{"ok/sha1", algorithm(minIterationCount, oidHMACWithSHA1), false, false},
+		{"fail/iterations-low", algorithm(minIterationCount-1, oidHMACWithSHA256), true, false},
+		{"fail/iterations-high", algorithm(maxIterationCount+1, oidHMACWithSHA256), true, false},
+		{"fail/parameters", pkix.AlgorithmIdentifier{Algorithm: oidPasswordBasedMac}, true, false},
+		{"fail/mac", algorithm(1000, oidSHA256), false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := parsePBMParameter(tt.alg)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			mac, err := params.mac([]byte("secret"), []byte("data"))
+			if tt.wantMACErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			// The MAC depends on the secret and the salt.
+			other, err := params.mac([]byte("other"), []byte("data"))
+			require.NoError(t, err)
+			assert.NotEqual(t, mac, other)
+			salted, err := params.withNewSalt()
+			require.NoError(t, err)
+			other, err = salted.mac([]byte("secret"), []byte("data"))
+			require.NoError(t, err)
+			assert.NotEqual(t, mac, other)
+		})
+	}
+}
+
+func Test_failureInfo(t *testing.T) {
+	for _, fi := range []failInfo{failBadAlg, failBadPOP, failNotAuthorized, failSystemFailure} {
+		b := failureInfo(fi)
+		assert.Equal(t, int(fi)+1, b.BitLength)
+		assert.Equal(t, 1, b.At(int(fi)))
+		der, err := asn1.Marshal(b)
+		require.NoError(t, err)
+		var got asn1.BitString
+		_, err = asn1.Unmarshal(der, &got)
+		require.NoError(t, err)
+		assert.Equal(t, 1, got.At(int(fi)))
+	}
+}
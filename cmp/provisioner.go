@@ -0,0 +1,43 @@
+package cmp
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// Provisioner is an interface that embeds the provisioner.Interface and adds
+// some CMP specific functions.
+type Provisioner interface {
+	provisioner.Interface
+	GetOptions() *provisioner.Options
+	GetSharedSecret() []byte
+	AuthorizeClientCertificate(chain []*x509.Certificate) error
+	GetSigner() (*x509.Certificate, crypto.Signer)
+	ShouldAllowImplicitConfirm() bool
+	ShouldIncludeRootInChain() bool
+	GetConfirmWaitTime() time.Duration
+	GetPollingThreshold() time.Duration
+}
+
+// provisionerKey is the key type for storing and searching a CMP
+// provisioner in the context.
+type provisionerKey struct{}
+
+// provisionerFromContext searches the context for a CMP provisioner.
+// Returns the provisioner or panics if no CMP provisioner is found.
+func provisionerFromContext(ctx context.Context) Provisioner {
+	p, ok := ctx.Value(provisionerKey{}).(Provisioner)
+	if !ok {
+		panic("CMP provisioner expected in request context")
+	}
+	return p
+}
+
+// NewProvisionerContext adds the given CMP provisioner to the context.
+func NewProvisionerContext(ctx context.Context, p Provisioner) context.Context {
+	return context.WithValue(ctx, provisionerKey{}, p)
+}
@@ -0,0 +1,142 @@
+package cmp
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+// transaction is an enrollment in progress. Transactions are kept until the
+// client confirms the certificate, or until they expire.
+type transaction struct {
+	key       string
+	bodyType  int
+	certReqID int
+	prot      *protection
+	implicit  bool
+	done      chan struct{}
+	certs     []*x509.Certificate
+	err       error
+
+	createdAt time.Time
+
+	mu          sync.Mutex
+	senderNonce []byte
+	expiresAt   time.Time
+	persisted   bool
+	closed      bool
+}
+
+// finish sets the result of the enrollment.
+func (tx *transaction) finish(certs []*x509.Certificate, err error) {
+	tx.certs, tx.err = certs, err
+	close(tx.done)
+}
+
+// isDone returns true if the enrollment has finished.
+func (tx *transaction) isDone() bool {
+	select {
+	case <-tx.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// getSenderNonce returns the nonce sent in the last response.
+func (tx *transaction) getSenderNonce() []byte {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return tx.senderNonce
+}
+
+// update sets the nonce sent in the last response and extends the
+// expiration of the transaction.
+func (tx *transaction) update(nonce []byte, ttl time.Duration) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.senderNonce = nonce
+	tx.expiresAt = time.Now().Add(ttl)
+}
+
+// close marks the transaction as closed, it returns false if it was already
+// closed.
+func (tx *transaction) close() bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.closed {
+		return false
+	}
+	tx.closed = true
+	return true
+}
+
+// isExpired returns true if the transaction has expired.
+func (tx *transaction) isExpired(now time.Time) bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return now.After(tx.expiresAt)
+}
+
+// transactionStore is an in-memory store of transactions.
+type transactionStore struct {
+	mu           sync.Mutex
+	transactions map[string]*transaction
+}
+
+func newTransactionStore() *transactionStore {
+	return &transactionStore{
+		transactions: make(map[string]*transaction),
+	}
+}
+
+// transactionKey returns the key used to store a transaction. Transaction
+// identifiers are chosen by the clients, so they are scoped by provisioner,
+// and they are base64 encoded as they can contain any byte.
+func transactionKey(provisionerName string, transactionID []byte) string {
+	return provisionerName + "/" + base64.RawURLEncoding.EncodeToString(transactionID)
+}
+
+// add stores a transaction, it returns false if a transaction with the same
+// key already exists.
+func (s *transactionStore) add(tx *transaction, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+	if _, ok := s.transactions[tx.key]; ok {
+		return false
+	}
+	tx.expiresAt = time.Now().Add(ttl)
+	s.transactions[tx.key] = tx
+	return true
+}
+
+// get returns the transaction with the given key or nil if it does not
+// exist.
+func (s *transactionStore) get(key string) *transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+	return s.transactions[key]
+}
+
+// remove deletes the given transaction.
+func (s *transactionStore) remove(tx *transaction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.transactions[tx.key] == tx {
+		delete(s.transactions, tx.key)
+	}
+}
+
+// purge deletes the expired transactions. It must be called with the lock
+// held.
+func (s *transactionStore) purge() {
+	now := time.Now()
+	for k, tx := range s.transactions {
+		if tx.isExpired(now) {
+			delete(s.transactions, k)
+		}
+	}
+}
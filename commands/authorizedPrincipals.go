@@ -0,0 +1,227 @@
+package commands
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/cli-utils/command"
+	"github.com/smallstep/cli-utils/errs"
+	"github.com/smallstep/cli-utils/token"
+	"github.com/smallstep/cli-utils/token/provision"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/randutil"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/ca"
+)
+
+func init() {
+	command.Register(cli.Command{
+		Name:      "authorized-principals",
+		Usage:     "print the principals of an SSH certificate authorized to log in to this host",
+		UsageText: "**step-ca authorized-principals** <user> <certificate> **--ca-url**=<uri> **--root**=<file>",
+		Action:    authorizedPrincipalsAction,
+		Description: `**step-ca authorized-principals** asks the CA which principals of an SSH
+user certificate are authorized to log in as <user> to this host. The principals
+are printed one per line, so it can be used as the sshd AuthorizedPrincipalsCommand.
+
+The host authenticates with its SSH host certificate and key using an SSHPOP
+token, or with an X.509 certificate and key using mTLS. The X.509 certificate
+must be issued by the provisioner configured in the
+ssh.authorizedPrincipalsProvisioner property of the CA.
+
+## POSITIONAL ARGUMENTS
+
+<user>
+:  The local user to log in as, the %u token in sshd_config.
+
+<certificate>
+:  The base64 encoded SSH certificate, the %k token in sshd_config.
+
+## EXAMPLES
+
+Configure sshd to use the CA with an SSHPOP token:
+'''
+AuthorizedPrincipalsCommand /usr/bin/step-ca authorized-principals --ca-url https://ca.example.com --root /etc/step/root_ca.crt --provisioner sshpop --host-cert /etc/ssh/ssh_host_ecdsa_key-cert.pub --host-key /etc/ssh/ssh_host_ecdsa_key %u %k
+AuthorizedPrincipalsCommandUser root
+'''
+
+Configure sshd to use the CA with mTLS:
+'''
+AuthorizedPrincipalsCommand /usr/bin/step-ca authorized-principals --ca-url https://ca.example.com --root /etc/step/root_ca.crt --cert /etc/step/host.crt --key /etc/step/host.key %u %k
+AuthorizedPrincipalsCommandUser root
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "ca-url",
+				Usage: "<URI> of the targeted Step Certificate Authority.",
+			},
+			cli.StringFlag{
+				Name:  "root",
+				Usage: "The path to the PEM <file> used as the root certificate authority.",
+			},
+			cli.StringFlag{
+				Name:  "provisioner",
+				Usage: "The <name> of the SSHPOP provisioner used to authenticate the host.",
+			},
+			cli.StringFlag{
+				Name:  "host-cert",
+				Usage: "The <file> with the SSH host certificate used in the SSHPOP token.",
+			},
+			cli.StringFlag{
+				Name:  "host-key",
+				Usage: "The <file> with the SSH host private key used to sign the SSHPOP token.",
+			},
+			cli.StringFlag{
+				Name:  "cert",
+				Usage: "The <file> with the X.509 certificate used for mTLS.",
+			},
+			cli.StringFlag{
+				Name:  "key",
+				Usage: "The <file> with the X.509 private key used for mTLS.",
+			},
+		},
+	})
+}
+
+func authorizedPrincipalsAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 2); err != nil {
+		return err
+	}
+
+	caURL := ctx.String("ca-url")
+	if caURL == "" {
+		return errs.RequiredFlag(ctx, "ca-url")
+	}
+	root := ctx.String("root")
+	if root == "" {
+		return errs.RequiredFlag(ctx, "root")
+	}
+
+	user := ctx.Args().Get(0)
+	cert, err := parseSSHCertificate(ctx.Args().Get(1))
+	if err != nil {
+		return err
+	}
+
+	opts := []ca.ClientOption{ca.WithRootFile(root)}
+	req := &api.SSHAuthorizedPrincipalsRequest{
+		User:        user,
+		Certificate: api.SSHCertificate{Certificate: cert},
+	}
+
+	switch hostCert, crt := ctx.String("host-cert"), ctx.String("cert"); {
+	case hostCert != "":
+		name := ctx.String("provisioner")
+		if name == "" {
+			return errs.RequiredWithFlag(ctx, "host-cert", "provisioner")
+		}
+		hostKey := ctx.String("host-key")
+		if hostKey == "" {
+			return errs.RequiredWithFlag(ctx, "host-cert", "host-key")
+		}
+		if req.OTT, err = generateSSHPOPToken(caURL, name, hostCert, hostKey); err != nil {
+			return err
+		}
+	case crt != "":
+		key := ctx.String("key")
+		if key == "" {
+			return errs.RequiredWithFlag(ctx, "cert", "key")
+		}
+		tlsCert, err := tls.LoadX509KeyPair(crt, key)
+		if err != nil {
+			return errors.Wrap(err, "error loading certificate and key")
+		}
+		opts = append(opts, ca.WithCertificate(tlsCert))
+	default:
+		return errors.New("flag '--host-cert' or '--cert' is required")
+	}
+
+	client, err := ca.NewClient(caURL, opts...)
+	if err != nil {
+		return err
+	}
+	resp, err := client.SSHAuthorizedPrincipals(req)
+	if err != nil {
+		return err
+	}
+	for _, p := range resp.Principals {
+		fmt.Println(p)
+	}
+	return nil
+}
+
+// parseSSHCertificate parses a base64 encoded SSH certificate.
+func parseSSHCertificate(s string) (*ssh.Certificate, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding certificate")
+	}
+	pub, err := ssh.ParsePublicKey(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate")
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.Errorf("error parsing certificate: %T is not an ssh certificate", pub)
+	}
+	return cert, nil
+}
+
+// generateSSHPOPToken generates an SSHPOP token to authenticate the host with
+// the given SSH host certificate and key.
+func generateSSHPOPToken(caURL, provisionerName, certFile, keyFile string) (string, error) {
+	u, err := url.Parse(caURL)
+	if err != nil {
+		return "", errors.Wrapf(err, "error parsing %s", caURL)
+	}
+	aud := u.ResolveReference(&url.URL{
+		Path:     "/1.0/ssh/authorized-principals",
+		Fragment: "sshpop/" + provisionerName,
+	})
+
+	jwk, err := jose.ReadKey(keyFile)
+	if err != nil {
+		return "", err
+	}
+	jwtID, err := randutil.Hex(64) // 256 bits
+	if err != nil {
+		return "", err
+	}
+
+	// The subject is not used by the CA, use the certificate serial number.
+	b, err := os.ReadFile(certFile)
+	if err != nil {
+		return "", errors.Wrapf(err, "error reading %s", certFile)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(b)
+	if err != nil {
+		return "", errors.Wrapf(err, "error parsing %s", certFile)
+	}
+	hostCert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return "", errors.Errorf("error parsing %s: %T is not an ssh certificate", certFile, pub)
+	}
+
+	now := time.Now()
+	tok, err := provision.New(strconv.FormatUint(hostCert.Serial, 10),
+		token.WithJWTID(jwtID),
+		token.WithIssuer(provisionerName),
+		token.WithAudience(aud.String()),
+		token.WithValidity(now, now.Add(token.DefaultValidity)),
+		token.WithSSHPOPFile(certFile, jwk.Key),
+	)
+	if err != nil {
+		return "", err
+	}
+	return tok.SignedString(jwk.Algorithm, jwk.Key)
+}
@@ -0,0 +1,149 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"github.com/smallstep/cli-utils/command"
+	"github.com/smallstep/cli-utils/errs"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/acme/validator"
+)
+
+func init() {
+	command.Register(cli.Command{
+		Name:  "validator",
+		Usage: "run a remote ACME validation agent",
+		UsageText: `**step-ca validator** **--secret-file**=<file> **--cert**=<file> **--key**=<file>
+[**--address**=<address>] [**--resolver**=<addr>]`,
+		Action: validatorAction,
+		Description: `**step-ca validator** runs an agent used for multi-perspective validation of
+ACME challenges.
+
+When multi-perspective validation is configured in the "acme.perspectives"
+property of the ca.json, step-ca sends every http-01, dns-01 and tls-alpn-01
+challenge validated locally to a set of remote agents. The challenge is only
+considered valid if a quorum of agents reach the same result from their own
+network location.
+
+Requests and responses are authenticated using an HMAC-SHA256 signature with
+the base64 encoded secret configured for the agent in the ca.json.
+
+## EXAMPLES
+
+Run a validation agent listening on port 8443:
+'''
+$ step-ca validator --address :8443 --secret-file secret.txt \
+  --cert validator.crt --key validator.key
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "address",
+				Usage: "the <address> the agent listens on.",
+				Value: ":8443",
+			},
+			cli.StringFlag{
+				Name: "secret-file",
+				Usage: `path to the <file> containing the base64 encoded secret shared
+with the CA.`,
+			},
+			cli.StringFlag{
+				Name:  "cert",
+				Usage: "path to the certificate <file> used to serve TLS.",
+			},
+			cli.StringFlag{
+				Name:  "key",
+				Usage: "path to the private key <file> used to serve TLS.",
+			},
+			cli.StringFlag{
+				Name:  "resolver",
+				Usage: "address of a DNS resolver to be used instead of the default.",
+			},
+			cli.IntFlag{
+				Name: "acme-http-port",
+				Usage: `the <port> used on http-01 challenges. It can be changed for testing purposes.
+Requires **--insecure** flag.`,
+			},
+			cli.IntFlag{
+				Name: "acme-tls-port",
+				Usage: `the <port> used on tls-alpn-01 challenges. It can be changed for testing purposes.
+Requires **--insecure** flag.`,
+			},
+			cli.BoolFlag{
+				Name:  "acme-strict-fqdn",
+				Usage: `enable strict DNS resolution using a fully qualified domain name.`,
+			},
+			cli.BoolFlag{
+				Name:  "insecure",
+				Usage: "enable insecure flags.",
+			},
+		},
+	})
+}
+
+func validatorAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 0); err != nil {
+		return err
+	}
+	for _, name := range []string{"secret-file", "cert", "key"} {
+		if ctx.String(name) == "" {
+			return errs.RequiredFlag(ctx, name)
+		}
+	}
+
+	// Allow custom ACME ports with insecure
+	if acmePort := ctx.Int("acme-http-port"); acmePort != 0 {
+		if !ctx.Bool("insecure") {
+			return fmt.Errorf("flag '--acme-http-port' requires the '--insecure' flag")
+		}
+		acme.InsecurePortHTTP01 = acmePort
+	}
+	if acmePort := ctx.Int("acme-tls-port"); acmePort != 0 {
+		if !ctx.Bool("insecure") {
+			return fmt.Errorf("flag '--acme-tls-port' requires the '--insecure' flag")
+		}
+		acme.InsecurePortTLSALPN01 = acmePort
+	}
+	acme.StrictFQDN = ctx.Bool("acme-strict-fqdn")
+
+	secretFile := ctx.String("secret-file")
+	b, err := os.ReadFile(secretFile)
+	if err != nil {
+		return errors.Wrapf(err, "error reading %s", secretFile)
+	}
+	secret, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(b)))
+	if err != nil {
+		return errors.Wrapf(err, "error decoding %s", secretFile)
+	}
+
+	// replace resolver if requested
+	if resolver := ctx.String("resolver"); resolver != "" {
+		net.DefaultResolver.PreferGo = true
+		net.DefaultResolver.Dial = func(_ context.Context, network, _ string) (net.Conn, error) {
+			return net.Dial(network, resolver)
+		}
+	}
+
+	srv := &http.Server{
+		Addr:              ctx.String("address"),
+		Handler:           validator.NewHandler(secret, nil),
+		ReadHeaderTimeout: 15 * time.Second,
+	}
+
+	log.Printf("Serving ACME validation agent on %s ...", srv.Addr)
+	if err := srv.ListenAndServeTLS(ctx.String("cert"), ctx.String("key")); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
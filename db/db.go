@@ -19,26 +19,53 @@ import (
 )
 
 var (
-	certsTable             = []byte("x509_certs")
-	certsDataTable         = []byte("x509_certs_data")
-	revokedCertsTable      = []byte("revoked_x509_certs")
-	crlTable               = []byte("x509_crl")
-	revokedSSHCertsTable   = []byte("revoked_ssh_certs")
-	usedOTTTable           = []byte("used_ott")
-	sshCertsTable          = []byte("ssh_certs")
-	sshHostsTable          = []byte("ssh_hosts")
-	sshUsersTable          = []byte("ssh_users")
-	sshHostPrincipalsTable = []byte("ssh_host_principals")
+	certsTable                = []byte("x509_certs")
+	certsDataTable            = []byte("x509_certs_data")
+	revokedCertsTable         = []byte("revoked_x509_certs")
+	crlTable                  = []byte("x509_crl")
+	revokedSSHCertsTable      = []byte("revoked_ssh_certs")
+	usedOTTTable              = []byte("used_ott")
+	sshCertsTable             = []byte("ssh_certs")
+	sshCertsIndexTable        = []byte("ssh_certs_index")
+	sshCertsByPrincipalTable  = []byte("ssh_certs_principal_index")
+	sshCertsByKeyIDTable      = []byte("ssh_certs_key_id_index")
+	sshHostsTable             = []byte("ssh_hosts")
+	sshUsersTable             = []byte("ssh_users")
+	sshHostPrincipalsTable    = []byte("ssh_host_principals")
+	sshHostInventoryTable     = []byte("ssh_host_inventory")
+	sshAccessRequestsTable    = []byte("ssh_access_requests")
+	scepPendingTable          = []byte("scep_pending_requests")
+	scepChallengesTable       = []byte("scep_challenges")
+	intermediateRotationTable = []byte("intermediate_rotation")
+	certsBackendTable         = []byte("x509_certs_backend")
+	migrationsTable           = []byte("migrations")
+	cmpTransactionsTable      = []byte("cmp_transactions")
 )
 
 // TODO: at the moment we store a single CRL in the database, in a dedicated table.
 // is this acceptable? probably not....
 var crlKey = []byte("crl")
 
+// intermediateRotationKey is the key of the only intermediate rotation stored
+// in the database.
+var intermediateRotationKey = []byte("current")
+
 // ErrAlreadyExists can be returned if the DB attempts to set a key that has
 // been previously set.
 var ErrAlreadyExists = errors.New("already exists")
 
+// ErrSCEPChallengeUsed is returned when a one-time SCEP challenge has already
+// been consumed.
+var ErrSCEPChallengeUsed = errors.New("scep challenge already used")
+
+// ErrSSHAccessRequestNotApproved is returned when an SSH access request cannot
+// be used because it is not approved, e.g. it has already been used.
+var ErrSSHAccessRequestNotApproved = errors.New("ssh access request not approved")
+
+// ErrCMPTransactionClosed is returned when a CMP transaction has already been
+// confirmed, rejected or expired.
+var ErrCMPTransactionClosed = errors.New("cmp transaction closed")
+
 // Config represents the JSON attributes used for configuring a step-ca DB.
 type Config struct {
 	Type       string `json:"type"`
@@ -105,6 +132,70 @@ type CertificateRevocationListDB interface {
 	StoreCRL(*CertificateRevocationListInfo) error
 }
 
+// IssuerCertificateRevocationListDB is an extension of
+// CertificateRevocationListDB that allows to store the CRLs of the named
+// certificate authorities.
+type IssuerCertificateRevocationListDB interface {
+	GetIssuerCRL(issuer string) (*CertificateRevocationListInfo, error)
+	StoreIssuerCRL(issuer string, crlInfo *CertificateRevocationListInfo) error
+}
+
+// SSHHostInventoryDB is an extension of AuthDB that allows to manage an
+// inventory of SSH hosts.
+type SSHHostInventoryDB interface {
+	GetSSHHost(hostname string) (*SSHHost, error)
+	GetSSHHosts() ([]*SSHHost, error)
+	CreateSSHHost(host *SSHHost) error
+	UpdateSSHHost(host *SSHHost) error
+	DeleteSSHHost(hostname string) error
+	GetSSHHostCertificates(hostname string) ([]*ssh.Certificate, error)
+}
+
+// SSHAccessRequestDB is an extension of AuthDB that allows to store
+// just-in-time SSH access requests.
+type SSHAccessRequestDB interface {
+	GetSSHAccessRequest(id string) (*SSHAccessRequest, error)
+	GetSSHAccessRequests() ([]*SSHAccessRequest, error)
+	CreateSSHAccessRequest(req *SSHAccessRequest) error
+	UpdateSSHAccessRequest(req *SSHAccessRequest) error
+	IssueSSHAccessRequest(id, serial string, issuedAt time.Time) (*SSHAccessRequest, error)
+}
+
+// SCEPPendingRequestDB is an extension of AuthDB that allows to store SCEP
+// enrollment requests waiting for a decision.
+type SCEPPendingRequestDB interface {
+	GetSCEPPendingRequest(id string) (*SCEPPendingRequest, error)
+	CreateSCEPPendingRequest(req *SCEPPendingRequest) error
+	DeleteSCEPPendingRequest(id string) error
+}
+
+// CMPTransactionDB is an extension of AuthDB that allows to store CMP
+// transactions waiting for the confirmation of the issued certificate.
+type CMPTransactionDB interface {
+	GetCMPTransaction(id string) (*CMPTransaction, error)
+	GetCMPTransactions() ([]*CMPTransaction, error)
+	SaveCMPTransaction(tx *CMPTransaction) error
+	CloseCMPTransaction(id string) (*CMPTransaction, error)
+}
+
+// SCEPChallengeDB is an extension of AuthDB that allows to store one-time SCEP
+// challenge passwords.
+type SCEPChallengeDB interface {
+	GetSCEPChallenge(id string) (*SCEPChallenge, error)
+	GetSCEPChallenges() ([]*SCEPChallenge, error)
+	CreateSCEPChallenge(ch *SCEPChallenge) error
+	UseSCEPChallenge(id string, usedAt time.Time) (*SCEPChallenge, error)
+	DeleteSCEPChallenge(id string) error
+}
+
+// IntermediateRotationDB is an extension of AuthDB that allows to store the
+// scheduled rotation of the intermediate certificate.
+type IntermediateRotationDB interface {
+	GetIntermediateRotation() (*IntermediateRotation, error)
+	CreateIntermediateRotation(r *IntermediateRotation) error
+	DeleteIntermediateRotation() error
+}
+
 // DB is a wrapper over the nosql.DB interface.
 type DB struct {
 	nosql.DB
@@ -131,7 +222,11 @@ func New(c *Config) (AuthDB, error) {
 	tables := [][]byte{
 		revokedCertsTable, certsTable, usedOTTTable,
 		sshCertsTable, sshHostsTable, sshHostPrincipalsTable, sshUsersTable,
-		revokedSSHCertsTable, certsDataTable, crlTable,
+		revokedSSHCertsTable, certsDataTable, crlTable, sshHostInventoryTable,
+		sshAccessRequestsTable, sshCertsIndexTable, scepPendingTable,
+		scepChallengesTable, intermediateRotationTable, certsBackendTable,
+		sshCertsByPrincipalTable, sshCertsByKeyIDTable, migrationsTable,
+		cmpTransactionsTable,
 	}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
@@ -140,7 +235,11 @@ func New(c *Config) (AuthDB, error) {
 		}
 	}
 
-	return &DB{db, true}, nil
+	d := &DB{db, true}
+	if err := d.backfillSSHCertificateIndexes(); err != nil {
+		return nil, err
+	}
+	return d, nil
 }
 
 // RevokedCertificateInfo contains information regarding the certificate
@@ -155,6 +254,7 @@ type RevokedCertificateInfo struct {
 	TokenID       string
 	MTLS          bool
 	ACME          bool
+	Issuer        string
 }
 
 // CertificateRevocationListInfo contains a CRL in DER format and associated
@@ -293,6 +393,37 @@ func (db *DB) GetCRL() (*CertificateRevocationListInfo, error) {
 	return &crlInfo, err
 }
 
+// StoreIssuerCRL stores the CRL of a named certificate authority.
+func (db *DB) StoreIssuerCRL(issuer string, crlInfo *CertificateRevocationListInfo) error {
+	crlInfoBytes, err := json.Marshal(crlInfo)
+	if err != nil {
+		return errors.Wrap(err, "json Marshal error")
+	}
+
+	if err := db.Set(crlTable, issuerCRLKey(issuer), crlInfoBytes); err != nil {
+		return errors.Wrap(err, "database Set error")
+	}
+	return nil
+}
+
+// GetIssuerCRL gets the existing CRL of a named certificate authority.
+func (db *DB) GetIssuerCRL(issuer string) (*CertificateRevocationListInfo, error) {
+	crlInfoBytes, err := db.Get(crlTable, issuerCRLKey(issuer))
+	if err != nil {
+		return nil, errors.Wrap(err, "database Get error")
+	}
+
+	var crlInfo CertificateRevocationListInfo
+	if err := json.Unmarshal(crlInfoBytes, &crlInfo); err != nil {
+		return nil, errors.Wrap(err, "json Unmarshal error")
+	}
+	return &crlInfo, nil
+}
+
+func issuerCRLKey(issuer string) []byte {
+	return []byte(string(crlKey) + "/" + issuer)
+}
+
 // GetCertificate retrieves a certificate by the serial number.
 func (db *DB) GetCertificate(serialNumber string) (*x509.Certificate, error) {
 	asn1Data, err := db.Get(certsTable, []byte(serialNumber))
@@ -431,8 +562,13 @@ type sshHostPrincipalData struct {
 // StoreSSHCertificate stores an SSH certificate.
 func (db *DB) StoreSSHCertificate(crt *ssh.Certificate) error {
 	serial := strconv.FormatUint(crt.Serial, 10)
+	info, err := json.Marshal(NewSSHCertificateInfo(crt))
+	if err != nil {
+		return errors.Wrap(err, "error marshaling ssh certificate index")
+	}
 	tx := new(database.Tx)
 	tx.Set(sshCertsTable, []byte(serial), crt.Marshal())
+	tx.Set(sshCertsIndexTable, []byte(serial), info)
 	if crt.CertType == ssh.HostCert {
 		for _, p := range crt.ValidPrincipals {
 			hostPrincipalData, err := json.Marshal(sshHostPrincipalData{
@@ -453,7 +589,7 @@ func (db *DB) StoreSSHCertificate(crt *ssh.Certificate) error {
 	if err := db.Update(tx); err != nil {
 		return errors.Wrap(err, "database Update error")
 	}
-	return nil
+	return db.indexSSHCertificate(crt)
 }
 
 // GetSSHHostPrincipals gets a list of all valid host principals.
@@ -475,6 +611,571 @@ func (db *DB) GetSSHHostPrincipals() ([]string, error) {
 	return principals, nil
 }
 
+// SSHHost represents a host in the SSH host inventory.
+type SSHHost struct {
+	ID               string            `json:"id"`
+	Hostname         string            `json:"hostname"`
+	Tags             map[string]string `json:"tags,omitempty"`
+	Groups           []string          `json:"groups,omitempty"`
+	CreatedAt        time.Time         `json:"createdAt"`
+	UpdatedAt        time.Time         `json:"updatedAt"`
+	DecommissionedAt time.Time         `json:"decommissionedAt,omitzero"`
+}
+
+// IsDecommissioned returns true if the host has been decommissioned.
+func (h *SSHHost) IsDecommissioned() bool {
+	return !h.DecommissionedAt.IsZero()
+}
+
+// GetSSHHost returns the host with the given hostname from the SSH host
+// inventory.
+func (db *DB) GetSSHHost(hostname string) (*SSHHost, error) {
+	b, err := db.Get(sshHostInventoryTable, []byte(strings.ToLower(hostname)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading ssh host %s", hostname)
+	}
+	host := new(SSHHost)
+	if err := json.Unmarshal(b, host); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling ssh host %s", hostname)
+	}
+	return host, nil
+}
+
+// GetSSHHosts returns all the hosts in the SSH host inventory.
+func (db *DB) GetSSHHosts() ([]*SSHHost, error) {
+	entries, err := db.List(sshHostInventoryTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading ssh hosts")
+	}
+	hosts := make([]*SSHHost, 0, len(entries))
+	for _, e := range entries {
+		host := new(SSHHost)
+		if err := json.Unmarshal(e.Value, host); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling ssh host %s", e.Key)
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// CreateSSHHost adds a new host to the SSH host inventory. It returns
+// ErrAlreadyExists if a host with the same hostname exists.
+func (db *DB) CreateSSHHost(host *SSHHost) error {
+	b, err := json.Marshal(host)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling ssh host")
+	}
+	_, swapped, err := db.CmpAndSwap(sshHostInventoryTable, []byte(strings.ToLower(host.Hostname)), nil, b)
+	switch {
+	case err != nil:
+		return errors.Wrapf(err, "error storing ssh host %s", host.Hostname)
+	case !swapped:
+		return ErrAlreadyExists
+	default:
+		return nil
+	}
+}
+
+// UpdateSSHHost replaces a host in the SSH host inventory.
+func (db *DB) UpdateSSHHost(host *SSHHost) error {
+	b, err := json.Marshal(host)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling ssh host")
+	}
+	if err := db.Set(sshHostInventoryTable, []byte(strings.ToLower(host.Hostname)), b); err != nil {
+		return errors.Wrapf(err, "error storing ssh host %s", host.Hostname)
+	}
+	return nil
+}
+
+// DeleteSSHHost removes a host from the SSH host inventory.
+func (db *DB) DeleteSSHHost(hostname string) error {
+	if err := db.Del(sshHostInventoryTable, []byte(strings.ToLower(hostname))); err != nil {
+		return errors.Wrapf(err, "error deleting ssh host %s", hostname)
+	}
+	return nil
+}
+
+// GetSSHHostCertificates returns the stored SSH host certificates that are
+// not expired and have the given hostname as a principal.
+func (db *DB) GetSSHHostCertificates(hostname string) ([]*ssh.Certificate, error) {
+	entries, err := db.List(sshCertsTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading ssh certificates")
+	}
+	var certs []*ssh.Certificate
+	now := cast.Uint64(time.Now().Unix())
+	for _, e := range entries {
+		pub, err := ssh.ParsePublicKey(e.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing ssh certificate %s", e.Key)
+		}
+		cert, ok := pub.(*ssh.Certificate)
+		if !ok || cert.CertType != ssh.HostCert || cert.ValidBefore < now {
+			continue
+		}
+		for _, p := range cert.ValidPrincipals {
+			if strings.EqualFold(p, hostname) {
+				certs = append(certs, cert)
+				break
+			}
+		}
+	}
+	return certs, nil
+}
+
+// SSHAccessRequestStatus is the status of a just-in-time SSH access request.
+type SSHAccessRequestStatus string
+
+const (
+	// SSHAccessRequestPending is the status of a request waiting for approval.
+	SSHAccessRequestPending SSHAccessRequestStatus = "pending"
+	// SSHAccessRequestApproved is the status of an approved request that can
+	// be used to get a certificate.
+	SSHAccessRequestApproved SSHAccessRequestStatus = "approved"
+	// SSHAccessRequestDenied is the status of a denied request.
+	SSHAccessRequestDenied SSHAccessRequestStatus = "denied"
+	// SSHAccessRequestIssued is the status of a request already used to get a
+	// certificate.
+	SSHAccessRequestIssued SSHAccessRequestStatus = "issued"
+)
+
+// SSHAccessRequest represents a just-in-time request to access a group of SSH
+// hosts. Once approved, the subject can get a single SSH user certificate with
+// the requested principals, validity and source addresses.
+type SSHAccessRequest struct {
+	ID              string                 `json:"id"`
+	Status          SSHAccessRequestStatus `json:"status"`
+	Provisioner     string                 `json:"provisioner"`
+	Subject         string                 `json:"subject"`
+	HostGroup       string                 `json:"hostGroup,omitempty"`
+	Principals      []string               `json:"principals"`
+	SourceAddresses []string               `json:"sourceAddresses,omitempty"`
+	Justification   string                 `json:"justification"`
+	Validity        provisioner.Duration   `json:"validity"`
+	ApprovedBy      string                 `json:"approvedBy,omitempty"`
+	DeniedBy        string                 `json:"deniedBy,omitempty"`
+	DenyReason      string                 `json:"denyReason,omitempty"`
+	Serial          string                 `json:"serial,omitempty"`
+	CreatedAt       time.Time              `json:"createdAt"`
+	UpdatedAt       time.Time              `json:"updatedAt"`
+	ExpiresAt       time.Time              `json:"expiresAt,omitzero"`
+}
+
+// GetSSHAccessRequest returns the SSH access request with the given id.
+func (db *DB) GetSSHAccessRequest(id string) (*SSHAccessRequest, error) {
+	b, err := db.Get(sshAccessRequestsTable, []byte(id))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading ssh access request %s", id)
+	}
+	req := new(SSHAccessRequest)
+	if err := json.Unmarshal(b, req); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling ssh access request %s", id)
+	}
+	return req, nil
+}
+
+// GetSSHAccessRequests returns all the SSH access requests.
+func (db *DB) GetSSHAccessRequests() ([]*SSHAccessRequest, error) {
+	entries, err := db.List(sshAccessRequestsTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading ssh access requests")
+	}
+	reqs := make([]*SSHAccessRequest, 0, len(entries))
+	for _, e := range entries {
+		req := new(SSHAccessRequest)
+		if err := json.Unmarshal(e.Value, req); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling ssh access request %s", e.Key)
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+// CreateSSHAccessRequest stores a new SSH access request. It returns
+// ErrAlreadyExists if a request with the same id exists.
+func (db *DB) CreateSSHAccessRequest(req *SSHAccessRequest) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling ssh access request")
+	}
+	_, swapped, err := db.CmpAndSwap(sshAccessRequestsTable, []byte(req.ID), nil, b)
+	switch {
+	case err != nil:
+		return errors.Wrapf(err, "error storing ssh access request %s", req.ID)
+	case !swapped:
+		return ErrAlreadyExists
+	default:
+		return nil
+	}
+}
+
+// UpdateSSHAccessRequest replaces an SSH access request.
+func (db *DB) UpdateSSHAccessRequest(req *SSHAccessRequest) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling ssh access request")
+	}
+	if err := db.Set(sshAccessRequestsTable, []byte(req.ID), b); err != nil {
+		return errors.Wrapf(err, "error storing ssh access request %s", req.ID)
+	}
+	return nil
+}
+
+// IssueSSHAccessRequest atomically moves an approved SSH access request to the
+// issued status, recording the serial of the certificate that uses it. It
+// returns ErrSSHAccessRequestNotApproved if the request is not approved or it
+// was modified concurrently.
+func (db *DB) IssueSSHAccessRequest(id, serial string, issuedAt time.Time) (*SSHAccessRequest, error) {
+	old, err := db.Get(sshAccessRequestsTable, []byte(id))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading ssh access request %s", id)
+	}
+	req := new(SSHAccessRequest)
+	if err := json.Unmarshal(old, req); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling ssh access request %s", id)
+	}
+	if req.Status != SSHAccessRequestApproved {
+		return nil, ErrSSHAccessRequestNotApproved
+	}
+	req.Status = SSHAccessRequestIssued
+	req.Serial = serial
+	req.UpdatedAt = issuedAt
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling ssh access request")
+	}
+	_, swapped, err := db.CmpAndSwap(sshAccessRequestsTable, []byte(id), old, b)
+	switch {
+	case err != nil:
+		return nil, errors.Wrapf(err, "error storing ssh access request %s", id)
+	case !swapped:
+		return nil, ErrSSHAccessRequestNotApproved
+	default:
+		return req, nil
+	}
+}
+
+// SCEPPendingRequest represents a SCEP enrollment request that has not been
+// accepted or rejected yet. Clients will poll for the certificate using the
+// transaction id, signing the poll with the same certificate used in the
+// request, identified by SignerFingerprint.
+type SCEPPendingRequest struct {
+	ID                string    `json:"id"`
+	Provisioner       string    `json:"provisioner"`
+	TransactionID     string    `json:"transactionID"`
+	CSR               []byte    `json:"csr"`
+	Challenge         string    `json:"challenge,omitempty"`
+	SignerFingerprint string    `json:"signerFingerprint"`
+	CreatedAt         time.Time `json:"createdAt"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+	ExpiresAt         time.Time `json:"expiresAt"`
+}
+
+// GetSCEPPendingRequest returns the pending SCEP request with the given id.
+func (db *DB) GetSCEPPendingRequest(id string) (*SCEPPendingRequest, error) {
+	b, err := db.Get(scepPendingTable, []byte(id))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading scep pending request %s", id)
+	}
+	req := new(SCEPPendingRequest)
+	if err := json.Unmarshal(b, req); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling scep pending request %s", id)
+	}
+	return req, nil
+}
+
+// CreateSCEPPendingRequest stores a new pending SCEP request. It returns
+// ErrAlreadyExists if a request with the same id exists.
+func (db *DB) CreateSCEPPendingRequest(req *SCEPPendingRequest) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling scep pending request")
+	}
+	_, swapped, err := db.CmpAndSwap(scepPendingTable, []byte(req.ID), nil, b)
+	switch {
+	case err != nil:
+		return errors.Wrapf(err, "error storing scep pending request %s", req.ID)
+	case !swapped:
+		return ErrAlreadyExists
+	default:
+		return nil
+	}
+}
+
+// DeleteSCEPPendingRequest deletes a pending SCEP request.
+func (db *DB) DeleteSCEPPendingRequest(id string) error {
+	if err := db.Del(scepPendingTable, []byte(id)); err != nil {
+		return errors.Wrapf(err, "error deleting scep pending request %s", id)
+	}
+	return nil
+}
+
+// SCEPChallenge represents a one-time SCEP challenge password. The password
+// itself is not stored, the id is the hex-encoded SHA-256 hash of it. The
+// challenge can optionally be bound to the subject and SANs expected in the
+// certificate request.
+type SCEPChallenge struct {
+	ID          string    `json:"id"`
+	Provisioner string    `json:"provisioner"`
+	Subject     string    `json:"subject,omitempty"`
+	SANs        []string  `json:"sans,omitempty"`
+	CreatedBy   string    `json:"createdBy,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt,omitzero"`
+	UsedAt      time.Time `json:"usedAt,omitzero"`
+}
+
+// GetSCEPChallenge returns the SCEP challenge with the given id.
+func (db *DB) GetSCEPChallenge(id string) (*SCEPChallenge, error) {
+	b, err := db.Get(scepChallengesTable, []byte(id))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading scep challenge %s", id)
+	}
+	ch := new(SCEPChallenge)
+	if err := json.Unmarshal(b, ch); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling scep challenge %s", id)
+	}
+	return ch, nil
+}
+
+// GetSCEPChallenges returns all the SCEP challenges.
+func (db *DB) GetSCEPChallenges() ([]*SCEPChallenge, error) {
+	entries, err := db.List(scepChallengesTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading scep challenges")
+	}
+	chs := make([]*SCEPChallenge, 0, len(entries))
+	for _, e := range entries {
+		ch := new(SCEPChallenge)
+		if err := json.Unmarshal(e.Value, ch); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling scep challenge %s", e.Key)
+		}
+		chs = append(chs, ch)
+	}
+	return chs, nil
+}
+
+// CreateSCEPChallenge stores a new SCEP challenge. It returns
+// ErrAlreadyExists if a challenge with the same id exists.
+func (db *DB) CreateSCEPChallenge(ch *SCEPChallenge) error {
+	b, err := json.Marshal(ch)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling scep challenge")
+	}
+	_, swapped, err := db.CmpAndSwap(scepChallengesTable, []byte(ch.ID), nil, b)
+	switch {
+	case err != nil:
+		return errors.Wrapf(err, "error storing scep challenge %s", ch.ID)
+	case !swapped:
+		return ErrAlreadyExists
+	default:
+		return nil
+	}
+}
+
+// UseSCEPChallenge atomically marks a SCEP challenge as used and returns it.
+// It returns ErrSCEPChallengeUsed if the challenge was already used.
+func (db *DB) UseSCEPChallenge(id string, usedAt time.Time) (*SCEPChallenge, error) {
+	old, err := db.Get(scepChallengesTable, []byte(id))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading scep challenge %s", id)
+	}
+	ch := new(SCEPChallenge)
+	if err := json.Unmarshal(old, ch); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling scep challenge %s", id)
+	}
+	if !ch.UsedAt.IsZero() {
+		return nil, ErrSCEPChallengeUsed
+	}
+	ch.UsedAt = usedAt
+	b, err := json.Marshal(ch)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling scep challenge")
+	}
+	_, swapped, err := db.CmpAndSwap(scepChallengesTable, []byte(id), old, b)
+	switch {
+	case err != nil:
+		return nil, errors.Wrapf(err, "error storing scep challenge %s", id)
+	case !swapped:
+		return nil, ErrSCEPChallengeUsed
+	default:
+		return ch, nil
+	}
+}
+
+// DeleteSCEPChallenge deletes a SCEP challenge.
+func (db *DB) DeleteSCEPChallenge(id string) error {
+	if err := db.Del(scepChallengesTable, []byte(id)); err != nil {
+		return errors.Wrapf(err, "error deleting scep challenge %s", id)
+	}
+	return nil
+}
+
+// CMPTransaction represents a CMP transaction whose certificate has been
+// issued but not yet confirmed by the client. The sender is identified by
+// the protection certificate, or by the shared secret if MAC is set.
+type CMPTransaction struct {
+	ID                string    `json:"id"`
+	Provisioner       string    `json:"provisioner"`
+	BodyType          int       `json:"bodyType"`
+	CertReqID         int       `json:"certReqID"`
+	MAC               bool      `json:"mac,omitempty"`
+	SenderCertificate []byte    `json:"senderCertificate,omitempty"`
+	Certificates      [][]byte  `json:"certificates"`
+	SenderNonce       []byte    `json:"senderNonce"`
+	Closed            bool      `json:"closed,omitempty"`
+	CreatedAt         time.Time `json:"createdAt"`
+	ExpiresAt         time.Time `json:"expiresAt"`
+}
+
+// GetCMPTransaction returns the CMP transaction with the given id.
+func (db *DB) GetCMPTransaction(id string) (*CMPTransaction, error) {
+	b, err := db.Get(cmpTransactionsTable, []byte(id))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading cmp transaction %s", id)
+	}
+	tx := new(CMPTransaction)
+	if err := json.Unmarshal(b, tx); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling cmp transaction %s", id)
+	}
+	return tx, nil
+}
+
+// GetCMPTransactions returns all the CMP transactions.
+func (db *DB) GetCMPTransactions() ([]*CMPTransaction, error) {
+	entries, err := db.List(cmpTransactionsTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading cmp transactions")
+	}
+	txs := make([]*CMPTransaction, 0, len(entries))
+	for _, e := range entries {
+		tx := new(CMPTransaction)
+		if err := json.Unmarshal(e.Value, tx); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling cmp transaction %s", e.Key)
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// SaveCMPTransaction stores a CMP transaction.
+func (db *DB) SaveCMPTransaction(tx *CMPTransaction) error {
+	b, err := json.Marshal(tx)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling cmp transaction")
+	}
+	if err := db.Set(cmpTransactionsTable, []byte(tx.ID), b); err != nil {
+		return errors.Wrapf(err, "error storing cmp transaction %s", tx.ID)
+	}
+	return nil
+}
+
+// CloseCMPTransaction atomically marks a CMP transaction as closed and
+// deletes it. Only one caller can close a transaction, the others get
+// ErrCMPTransactionClosed.
+func (db *DB) CloseCMPTransaction(id string) (*CMPTransaction, error) {
+	old, err := db.Get(cmpTransactionsTable, []byte(id))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading cmp transaction %s", id)
+	}
+	tx := new(CMPTransaction)
+	if err := json.Unmarshal(old, tx); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling cmp transaction %s", id)
+	}
+	if tx.Closed {
+		return nil, ErrCMPTransactionClosed
+	}
+	tx.Closed = true
+	b, err := json.Marshal(tx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling cmp transaction")
+	}
+	_, swapped, err := db.CmpAndSwap(cmpTransactionsTable, []byte(id), old, b)
+	switch {
+	case err != nil:
+		return nil, errors.Wrapf(err, "error storing cmp transaction %s", id)
+	case !swapped:
+		return nil, ErrCMPTransactionClosed
+	}
+	if err := db.Del(cmpTransactionsTable, []byte(id)); err != nil {
+		return nil, errors.Wrapf(err, "error deleting cmp transaction %s", id)
+	}
+	return tx, nil
+}
+
+// IntermediateRotation represents the rotation of the intermediate
+// certificate used to sign X.509 certificates. The new intermediate is signed
+// by the root, and it can be cross-signed by the current intermediate. The key
+// is a file or a KMS URI.
+type IntermediateRotation struct {
+	Certificate      []byte    `json:"crt"`
+	CrossCertificate []byte    `json:"crossCrt,omitempty"`
+	Key              string    `json:"key"`
+	RotateAt         time.Time `json:"rotateAt"`
+	CreatedBy        string    `json:"createdBy,omitempty"`
+	CreatedAt        time.Time `json:"createdAt"`
+}
+
+// GetIntermediateRotation returns the intermediate rotation.
+func (db *DB) GetIntermediateRotation() (*IntermediateRotation, error) {
+	b, err := db.Get(intermediateRotationTable, intermediateRotationKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading intermediate rotation")
+	}
+	r := new(IntermediateRotation)
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling intermediate rotation")
+	}
+	return r, nil
+}
+
+// CreateIntermediateRotation stores a new intermediate rotation. It returns
+// ErrAlreadyExists if there is already one.
+func (db *DB) CreateIntermediateRotation(r *IntermediateRotation) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling intermediate rotation")
+	}
+	_, swapped, err := db.CmpAndSwap(intermediateRotationTable, intermediateRotationKey, nil, b)
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error storing intermediate rotation")
+	case !swapped:
+		return ErrAlreadyExists
+	default:
+		return nil
+	}
+}
+
+// DeleteIntermediateRotation deletes the intermediate rotation.
+func (db *DB) DeleteIntermediateRotation() error {
+	if err := db.Del(intermediateRotationTable, intermediateRotationKey); err != nil {
+		return errors.Wrap(err, "error deleting intermediate rotation")
+	}
+	return nil
+}
+
+// StoreCertificateBackend stores the name of the CAS backend that issued the
+// certificate with the given serial number. It implements
+// apiv1.CertificateBackendStore.
+func (db *DB) StoreCertificateBackend(serialNumber, backend string) error {
+	if err := db.Set(certsBackendTable, []byte(serialNumber), []byte(backend)); err != nil {
+		return errors.Wrapf(err, "error storing backend of certificate %s", serialNumber)
+	}
+	return nil
+}
+
+// GetCertificateBackend returns the name of the CAS backend that issued the
+// certificate with the given serial number.
+func (db *DB) GetCertificateBackend(serialNumber string) (string, error) {
+	b, err := db.Get(certsBackendTable, []byte(serialNumber))
+	if err != nil {
+		return "", errors.Wrapf(err, "error loading backend of certificate %s", serialNumber)
+	}
+	return string(b), nil
+}
+
 // Shutdown sends a shutdown message to the database.
 func (db *DB) Shutdown() error {
 	if db.isUp {
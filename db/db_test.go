@@ -2,11 +2,17 @@ package db
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"math/big"
 	"reflect"
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority/provisioner"
@@ -435,3 +441,368 @@ func TestDB_StoreRenewedCertificate(t *testing.T) {
 		})
 	}
 }
+
+func TestDB_CreateSSHHost(t *testing.T) {
+	host := &SSHHost{ID: "1", Hostname: "DB1.example.com", Groups: []string{"databases"}}
+	tests := []struct {
+		name    string
+		db      nosql.DB
+		wantErr error
+	}{
+		{"ok", &MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, sshHostInventoryTable)
+				assert.Equals(t, key, []byte("db1.example.com"))
+				assert.Nil(t, old)
+				return newval, true, nil
+			},
+		}, nil},
+		{"fail/exists", &MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return []byte("{}"), false, nil
+			},
+		}, ErrAlreadyExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{DB: tt.db, isUp: true}
+			err := db.CreateSSHHost(host)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("DB.CreateSSHHost() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDB_GetSSHHostCertificates(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	assert.FatalError(t, err)
+
+	newCert := func(serial uint64, certType uint32, validBefore time.Time, principals ...string) []byte {
+		cert := &ssh.Certificate{
+			Key:             signer.PublicKey(),
+			Serial:          serial,
+			CertType:        certType,
+			ValidPrincipals: principals,
+			ValidBefore:     uint64(validBefore.Unix()),
+		}
+		assert.FatalError(t, cert.SignCert(rand.Reader, signer))
+		return cert.Marshal()
+	}
+
+	now := time.Now()
+	db := &DB{DB: &MockNoSQLDB{
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			assert.Equals(t, bucket, sshCertsTable)
+			return []*database.Entry{
+				{Key: []byte("1"), Value: newCert(1, ssh.HostCert, now.Add(time.Hour), "db1.example.com", "10.0.0.1")},
+				{Key: []byte("2"), Value: newCert(2, ssh.HostCert, now.Add(-time.Hour), "db1.example.com")},
+				{Key: []byte("3"), Value: newCert(3, ssh.UserCert, now.Add(time.Hour), "db1.example.com")},
+				{Key: []byte("4"), Value: newCert(4, ssh.HostCert, now.Add(time.Hour), "db2.example.com")},
+				{Key: []byte("5"), Value: newCert(5, ssh.HostCert, now.Add(time.Hour), "DB1.EXAMPLE.COM")},
+			}, nil
+		},
+	}, isUp: true}
+
+	certs, err := db.GetSSHHostCertificates("db1.example.com")
+	assert.FatalError(t, err)
+	var serials []uint64
+	for _, c := range certs {
+		serials = append(serials, c.Serial)
+	}
+	assert.Equals(t, []uint64{1, 5}, serials)
+}
+
+func TestDB_SearchSSHCertificates(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	assert.FatalError(t, err)
+
+	now := time.Now().Truncate(time.Second)
+	newCert := func(serial uint64, keyID string, validAfter, validBefore time.Time, principals ...string) *ssh.Certificate {
+		cert := &ssh.Certificate{
+			Key:             signer.PublicKey(),
+			Serial:          serial,
+			CertType:        ssh.UserCert,
+			KeyId:           keyID,
+			ValidPrincipals: principals,
+			ValidAfter:      uint64(validAfter.Unix()),
+			ValidBefore:     uint64(validBefore.Unix()),
+		}
+		assert.FatalError(t, cert.SignCert(rand.Reader, signer))
+		return cert
+	}
+
+	c1 := newCert(1, "alice@example.com", now.Add(-2*time.Hour), now.Add(-time.Hour), "alice")
+	c2 := newCert(2, "alice@example.com", now.Add(-time.Hour), now.Add(time.Hour), "alice", "root")
+	c3 := newCert(3, "bob@example.com", now.Add(-time.Hour), now.Add(time.Hour), "bob")
+	// Certificate stored before the indexes existed.
+	c4 := newCert(4, "carol@example.com", now.Add(-3*time.Hour), now.Add(time.Hour), "Alice")
+
+	adb, err := New(&Config{Type: "badgerv2", DataSource: t.TempDir()})
+	assert.FatalError(t, err)
+	t.Cleanup(func() { adb.Shutdown() })
+	db := adb.(*DB)
+	for _, c := range []*ssh.Certificate{c1, c2, c3} {
+		assert.FatalError(t, db.StoreSSHCertificate(c))
+	}
+	assert.FatalError(t, db.RevokeSSH(&RevokedCertificateInfo{Serial: "3"}))
+	assert.FatalError(t, db.Set(sshCertsTable, []byte("4"), c4.Marshal()))
+
+	// Every certificate has its own entry, and expired entries are pruned
+	// when the index is read.
+	_, err = db.Get(sshCertsByPrincipalTable, []byte("alice|1"))
+	assert.FatalError(t, err)
+	serials, err := db.getSSHCertificateIndex(sshCertsByPrincipalTable, "alice")
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"2"}, serials)
+	_, err = db.Get(sshCertsByPrincipalTable, []byte("alice|1"))
+	assert.True(t, database.IsErrNotFound(err))
+
+	// The migration only runs once.
+	assert.FatalError(t, db.backfillSSHCertificateIndexes())
+	serials, err = db.getSSHCertificateIndex(sshCertsByPrincipalTable, "alice")
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"2"}, serials)
+	assert.FatalError(t, db.Del(migrationsTable, sshCertificateIndexesMigration))
+	assert.FatalError(t, db.backfillSSHCertificateIndexes())
+	serials, err = db.getSSHCertificateIndex(sshCertsByPrincipalTable, "alice")
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"2", "4"}, serials)
+
+	tests := []struct {
+		name        string
+		filter      *SSHCertificateFilter
+		wantSerials []string
+	}{
+		{"all", nil, []string{"4", "1", "2", "3"}},
+		{"principal", &SSHCertificateFilter{Principal: "alice"}, []string{"4", "2"}},
+		{"keyID", &SSHCertificateFilter{KeyID: "alice@example.com"}, []string{"2"}},
+		{"keyID/legacy", &SSHCertificateFilter{KeyID: "carol@example.com"}, []string{"4"}},
+		{"principal/revoked", &SSHCertificateFilter{Principal: "BOB"}, []string{"3"}},
+		{"missing", &SSHCertificateFilter{Principal: "dave"}, nil},
+		{"validAt", &SSHCertificateFilter{Principal: "alice", ValidAt: now}, []string{"4", "2"}},
+		{"type", &SSHCertificateFilter{Type: "host"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			infos, err := db.SearchSSHCertificates(tt.filter)
+			assert.FatalError(t, err)
+			var serials []string
+			for _, info := range infos {
+				serials = append(serials, info.Serial)
+				assert.Equals(t, info.Serial == "3", info.Revoked)
+			}
+			assert.Equals(t, tt.wantSerials, serials)
+		})
+	}
+}
+
+func TestDB_UseSCEPChallenge(t *testing.T) {
+	usedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	unused, err := json.Marshal(&SCEPChallenge{ID: "1", Provisioner: "scep"})
+	assert.FatalError(t, err)
+	used, err := json.Marshal(&SCEPChallenge{ID: "1", Provisioner: "scep", UsedAt: usedAt})
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name    string
+		db      nosql.DB
+		wantErr error
+	}{
+		{"ok", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return unused, nil
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, scepChallengesTable)
+				assert.Equals(t, key, []byte("1"))
+				assert.Equals(t, old, unused)
+				return newval, true, nil
+			},
+		}, nil},
+		{"fail/used", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return used, nil
+			},
+		}, ErrSCEPChallengeUsed},
+		{"fail/concurrent", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return unused, nil
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return used, false, nil
+			},
+		}, ErrSCEPChallengeUsed},
+		{"fail/not found", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, database.ErrNotFound
+			},
+		}, database.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{DB: tt.db, isUp: true}
+			ch, err := db.UseSCEPChallenge("1", usedAt)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("DB.UseSCEPChallenge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				assert.Equals(t, usedAt, ch.UsedAt)
+			}
+		})
+	}
+}
+
+func TestDB_CloseCMPTransaction(t *testing.T) {
+	open, err := json.Marshal(&CMPTransaction{ID: "cmp/1", Provisioner: "cmp"})
+	assert.FatalError(t, err)
+	closed, err := json.Marshal(&CMPTransaction{ID: "cmp/1", Provisioner: "cmp", Closed: true})
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name    string
+		db      nosql.DB
+		wantErr error
+	}{
+		{"ok", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return open, nil
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, cmpTransactionsTable)
+				assert.Equals(t, key, []byte("cmp/1"))
+				assert.Equals(t, old, open)
+				assert.Equals(t, newval, closed)
+				return newval, true, nil
+			},
+			MDel: func(bucket, key []byte) error {
+				assert.Equals(t, bucket, cmpTransactionsTable)
+				assert.Equals(t, key, []byte("cmp/1"))
+				return nil
+			},
+		}, nil},
+		{"fail/closed", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return closed, nil
+			},
+		}, ErrCMPTransactionClosed},
+		{"fail/concurrent", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return open, nil
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return closed, false, nil
+			},
+		}, ErrCMPTransactionClosed},
+		{"fail/not found", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, database.ErrNotFound
+			},
+		}, database.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{DB: tt.db, isUp: true}
+			tx, err := db.CloseCMPTransaction("cmp/1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("DB.CloseCMPTransaction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				assert.True(t, tx.Closed)
+			}
+		})
+	}
+}
+
+func TestDB_IssueSSHAccessRequest(t *testing.T) {
+	issuedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	approved, err := json.Marshal(&SSHAccessRequest{ID: "1", Status: SSHAccessRequestApproved})
+	assert.FatalError(t, err)
+	issued, err := json.Marshal(&SSHAccessRequest{ID: "1", Status: SSHAccessRequestIssued, Serial: "1234"})
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name    string
+		db      nosql.DB
+		wantErr error
+	}{
+		{"ok", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return approved, nil
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, sshAccessRequestsTable)
+				assert.Equals(t, key, []byte("1"))
+				assert.Equals(t, old, approved)
+				return newval, true, nil
+			},
+		}, nil},
+		{"fail/issued", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return issued, nil
+			},
+		}, ErrSSHAccessRequestNotApproved},
+		{"fail/concurrent", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return approved, nil
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return issued, false, nil
+			},
+		}, ErrSSHAccessRequestNotApproved},
+		{"fail/not found", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, database.ErrNotFound
+			},
+		}, database.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{DB: tt.db, isUp: true}
+			req, err := db.IssueSSHAccessRequest("1", "5678", issuedAt)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("DB.IssueSSHAccessRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				assert.Equals(t, SSHAccessRequestIssued, req.Status)
+				assert.Equals(t, "5678", req.Serial)
+				assert.Equals(t, issuedAt, req.UpdatedAt)
+			}
+		})
+	}
+}
+
+func TestDB_CreateIntermediateRotation(t *testing.T) {
+	r := &IntermediateRotation{Certificate: []byte("crt"), Key: "key"}
+	tests := []struct {
+		name    string
+		db      nosql.DB
+		wantErr error
+	}{
+		{"ok", &MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, intermediateRotationTable)
+				assert.Equals(t, key, intermediateRotationKey)
+				assert.Nil(t, old)
+				return newval, true, nil
+			},
+		}, nil},
+		{"fail/exists", &MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return []byte("{}"), false, nil
+			},
+		}, ErrAlreadyExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{DB: tt.db, isUp: true}
+			if err := db.CreateIntermediateRotation(r); !errors.Is(err, tt.wantErr) {
+				t.Errorf("DB.CreateIntermediateRotation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
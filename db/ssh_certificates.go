@@ -0,0 +1,383 @@
+package db
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/nosql/database"
+
+	"github.com/smallstep/certificates/internal/cast"
+)
+
+// sshCertificateIndexesMigration is the key used in the migrations table to
+// record that the SSH certificate principal and key id indexes have been
+// backfilled.
+var sshCertificateIndexesMigration = []byte("ssh-certificate-indexes")
+
+// SSHCertificateIndexDB is an extension of AuthDB that allows to search the
+// stored SSH certificates and to list the revoked ones.
+type SSHCertificateIndexDB interface {
+	GetSSHCertificate(serial string) (*ssh.Certificate, error)
+	SearchSSHCertificates(filter *SSHCertificateFilter) ([]*SSHCertificateInfo, error)
+	GetRevokedSSHCertificates() ([]RevokedCertificateInfo, error)
+}
+
+// SSHCertificateInfo is the entry of an SSH certificate in the SSH
+// certificates index. A zero ValidBefore means that the certificate does not
+// expire.
+type SSHCertificateInfo struct {
+	Serial      string    `json:"serial"`
+	Type        string    `json:"type"`
+	KeyID       string    `json:"keyID"`
+	Principals  []string  `json:"principals"`
+	ValidAfter  time.Time `json:"validAfter,omitzero"`
+	ValidBefore time.Time `json:"validBefore,omitzero"`
+	Revoked     bool      `json:"revoked,omitempty"`
+}
+
+// NewSSHCertificateInfo returns the index entry of the given certificate.
+func NewSSHCertificateInfo(crt *ssh.Certificate) *SSHCertificateInfo {
+	typ := "user"
+	if crt.CertType == ssh.HostCert {
+		typ = "host"
+	}
+	return &SSHCertificateInfo{
+		Serial:      strconv.FormatUint(crt.Serial, 10),
+		Type:        typ,
+		KeyID:       crt.KeyId,
+		Principals:  crt.ValidPrincipals,
+		ValidAfter:  sshCertificateTime(crt.ValidAfter),
+		ValidBefore: sshCertificateTime(crt.ValidBefore),
+	}
+}
+
+// IsValidAt returns true if the certificate is valid at the given time.
+func (i *SSHCertificateInfo) IsValidAt(t time.Time) bool {
+	return !t.Before(i.ValidAfter) && (i.ValidBefore.IsZero() || t.Before(i.ValidBefore))
+}
+
+func sshCertificateTime(t uint64) time.Time {
+	if t == 0 || t == ssh.CertTimeInfinity {
+		return time.Time{}
+	}
+	return time.Unix(cast.Int64(t), 0).UTC()
+}
+
+// SSHCertificateFilter contains the conditions used to search SSH
+// certificates. Empty fields match every certificate. Principal matches one of
+// the principals of the certificate ignoring the case, and if ValidAt is set
+// only the certificates valid at that time are returned.
+type SSHCertificateFilter struct {
+	Principal string
+	KeyID     string
+	Type      string
+	ValidAt   time.Time
+}
+
+// Match returns true if the index entry matches all the conditions in the
+// filter.
+func (f *SSHCertificateFilter) Match(info *SSHCertificateInfo) bool {
+	switch {
+	case f == nil:
+		return true
+	case f.Type != "" && f.Type != info.Type:
+		return false
+	case f.KeyID != "" && f.KeyID != info.KeyID:
+		return false
+	case f.Principal != "" && !slices.ContainsFunc(info.Principals, func(p string) bool {
+		return strings.EqualFold(p, f.Principal)
+	}):
+		return false
+	case !f.ValidAt.IsZero() && !info.IsValidAt(f.ValidAt):
+		return false
+	default:
+		return true
+	}
+}
+
+// GetSSHCertificate retrieves an SSH certificate by the serial number.
+func (db *DB) GetSSHCertificate(serial string) (*ssh.Certificate, error) {
+	b, err := db.Get(sshCertsTable, []byte(serial))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading ssh certificate %s", serial)
+	}
+	pub, err := ssh.ParsePublicKey(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing ssh certificate %s", serial)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.Errorf("error parsing ssh certificate %s: unexpected type %T", serial, pub)
+	}
+	return cert, nil
+}
+
+// SearchSSHCertificates returns the entries of the SSH certificates index
+// matching the given filter, sorted by the start of the validity. If the filter
+// has a principal or a key id, only the certificates in the principal or key id
+// index are loaded, otherwise all the certificates are read. The principal and
+// key id indexes only contain the certificates that have not expired.
+func (db *DB) SearchSSHCertificates(filter *SSHCertificateFilter) ([]*SSHCertificateInfo, error) {
+	var (
+		infos map[string]*SSHCertificateInfo
+		err   error
+	)
+	switch {
+	case filter != nil && filter.KeyID != "":
+		infos, err = db.getIndexedSSHCertificates(sshCertsByKeyIDTable, filter.KeyID)
+	case filter != nil && filter.Principal != "":
+		infos, err = db.getIndexedSSHCertificates(sshCertsByPrincipalTable, strings.ToLower(filter.Principal))
+	default:
+		infos, err = db.getAllSSHCertificates()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*SSHCertificateInfo
+	for _, info := range infos {
+		if filter.Match(info) {
+			matches = append(matches, info)
+		}
+	}
+	slices.SortFunc(matches, func(a, b *SSHCertificateInfo) int {
+		if c := a.ValidAfter.Compare(b.ValidAfter); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Serial, b.Serial)
+	})
+	return matches, nil
+}
+
+// getIndexedSSHCertificates returns the index entries of the certificates
+// stored under the given key of a principal or key id index.
+func (db *DB) getIndexedSSHCertificates(table []byte, key string) (map[string]*SSHCertificateInfo, error) {
+	serials, err := db.getSSHCertificateIndex(table, key)
+	if err != nil {
+		return nil, err
+	}
+	infos := make(map[string]*SSHCertificateInfo, len(serials))
+	for _, serial := range serials {
+		info, err := db.getSSHCertificateInfo(serial)
+		if err != nil {
+			return nil, err
+		}
+		if info.Revoked, err = db.IsSSHRevoked(serial); err != nil {
+			return nil, err
+		}
+		infos[serial] = info
+	}
+	return infos, nil
+}
+
+// getSSHCertificateInfo returns the index entry of the certificate with the
+// given serial. Certificates stored before the index existed are read from the
+// certificates table.
+func (db *DB) getSSHCertificateInfo(serial string) (*SSHCertificateInfo, error) {
+	b, err := db.Get(sshCertsIndexTable, []byte(serial))
+	switch {
+	case database.IsErrNotFound(err):
+		cert, err := db.GetSSHCertificate(serial)
+		if err != nil {
+			return nil, err
+		}
+		return NewSSHCertificateInfo(cert), nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "error loading ssh certificate index %s", serial)
+	}
+	info := new(SSHCertificateInfo)
+	if err := json.Unmarshal(b, info); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling ssh certificate index %s", serial)
+	}
+	return info, nil
+}
+
+// getAllSSHCertificates returns the index entries of all the certificates.
+// Certificates stored before the index existed are read from the certificates
+// table.
+func (db *DB) getAllSSHCertificates() (map[string]*SSHCertificateInfo, error) {
+	entries, err := db.List(sshCertsIndexTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading ssh certificates index")
+	}
+	infos := make(map[string]*SSHCertificateInfo, len(entries))
+	for _, e := range entries {
+		info := new(SSHCertificateInfo)
+		if err := json.Unmarshal(e.Value, info); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling ssh certificate index %s", e.Key)
+		}
+		infos[info.Serial] = info
+	}
+
+	if entries, err = db.List(sshCertsTable); err != nil {
+		return nil, errors.Wrap(err, "error loading ssh certificates")
+	}
+	for _, e := range entries {
+		if _, ok := infos[string(e.Key)]; ok {
+			continue
+		}
+		pub, err := ssh.ParsePublicKey(e.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing ssh certificate %s", e.Key)
+		}
+		if cert, ok := pub.(*ssh.Certificate); ok {
+			infos[string(e.Key)] = NewSSHCertificateInfo(cert)
+		}
+	}
+
+	revoked, err := db.GetRevokedSSHCertificates()
+	if err != nil {
+		return nil, err
+	}
+	for _, rci := range revoked {
+		if info, ok := infos[rci.Serial]; ok {
+			info.Revoked = true
+		}
+	}
+	return infos, nil
+}
+
+// indexSSHCertificate adds the certificate to the principal and key id
+// indexes. Principals are indexed in lower case.
+func (db *DB) indexSSHCertificate(crt *ssh.Certificate) error {
+	info := NewSSHCertificateInfo(crt)
+	if crt.KeyId != "" {
+		if err := db.addToSSHCertificateIndex(sshCertsByKeyIDTable, crt.KeyId, info); err != nil {
+			return err
+		}
+	}
+	var principals []string
+	for _, p := range crt.ValidPrincipals {
+		if p = strings.ToLower(p); !slices.Contains(principals, p) {
+			principals = append(principals, p)
+		}
+	}
+	for _, p := range principals {
+		if err := db.addToSSHCertificateIndex(sshCertsByPrincipalTable, p, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sshCertificateIndexKey returns the key of the entry of a certificate in a
+// principal or key id index. Every certificate has its own entry, so indexing
+// a certificate never modifies the entries of other certificates.
+func sshCertificateIndexKey(key, serial string) []byte {
+	return []byte(key + "|" + serial)
+}
+
+// addToSSHCertificateIndex adds the entry of a certificate under key in the
+// given index table. The value of the entry is the end of the validity of the
+// certificate, so expired entries can be pruned without loading the
+// certificate.
+func (db *DB) addToSSHCertificateIndex(table []byte, key string, info *SSHCertificateInfo) error {
+	var value []byte
+	if !info.ValidBefore.IsZero() {
+		value = []byte(info.ValidBefore.Format(time.RFC3339))
+	}
+	if err := db.Set(table, sshCertificateIndexKey(key, info.Serial), value); err != nil {
+		return errors.Wrapf(err, "error saving index %s for key %s", table, key)
+	}
+	return nil
+}
+
+// getSSHCertificateIndex returns the serials of the certificates stored under
+// key in the given index table. The database does not support range queries,
+// so the entries are found by prefix on the list of the entries of the table.
+// Expired entries are skipped and deleted from the table.
+func (db *DB) getSSHCertificateIndex(table []byte, key string) ([]string, error) {
+	entries, err := db.List(table)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading index %s", table)
+	}
+	now := time.Now()
+	prefix := key + "|"
+	var serials []string
+	for _, e := range entries {
+		if isExpiredSSHCertificateIndexEntry(e.Value, now) {
+			if err := db.Del(table, e.Key); err != nil {
+				return nil, errors.Wrapf(err, "error deleting index %s entry %s", table, e.Key)
+			}
+			continue
+		}
+		serial, ok := strings.CutPrefix(string(e.Key), prefix)
+		if ok && serial != "" && !strings.Contains(serial, "|") {
+			serials = append(serials, serial)
+		}
+	}
+	return serials, nil
+}
+
+func isExpiredSSHCertificateIndexEntry(value []byte, now time.Time) bool {
+	if len(value) == 0 {
+		return false
+	}
+	validBefore, err := time.Parse(time.RFC3339, string(value))
+	return err == nil && !now.Before(validBefore)
+}
+
+// backfillSSHCertificateIndexes adds the SSH certificates stored before the
+// principal and key id indexes existed to those indexes. Expired certificates
+// are not indexed. It runs only once; completion is recorded in the migrations
+// table.
+func (db *DB) backfillSSHCertificateIndexes() error {
+	_, err := db.Get(migrationsTable, sshCertificateIndexesMigration)
+	switch {
+	case err == nil:
+		return nil
+	case !database.IsErrNotFound(err):
+		return errors.Wrap(err, "error loading migrations")
+	}
+
+	entries, err := db.List(sshCertsTable)
+	if err != nil {
+		return errors.Wrap(err, "error loading ssh certificates")
+	}
+	now := time.Now()
+	for _, e := range entries {
+		pub, err := ssh.ParsePublicKey(e.Value)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing ssh certificate %s", e.Key)
+		}
+		cert, ok := pub.(*ssh.Certificate)
+		if !ok {
+			continue
+		}
+		info := NewSSHCertificateInfo(cert)
+		if !info.ValidBefore.IsZero() && !now.Before(info.ValidBefore) {
+			continue
+		}
+		if err := db.indexSSHCertificate(cert); err != nil {
+			return err
+		}
+	}
+
+	if err := db.Set(migrationsTable, sshCertificateIndexesMigration, []byte(time.Now().UTC().Format(time.RFC3339))); err != nil {
+		return errors.Wrap(err, "error saving migrations")
+	}
+	return nil
+}
+
+// GetRevokedSSHCertificates returns the list of all revoked SSH certificates.
+func (db *DB) GetRevokedSSHCertificates() ([]RevokedCertificateInfo, error) {
+	entries, err := db.List(revokedSSHCertsTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading revoked ssh certificates")
+	}
+	revoked := make([]RevokedCertificateInfo, 0, len(entries))
+	for _, e := range entries {
+		var rci RevokedCertificateInfo
+		if err := json.Unmarshal(e.Value, &rci); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling revoked ssh certificate %s", e.Key)
+		}
+		revoked = append(revoked, rci)
+	}
+	return revoked, nil
+}
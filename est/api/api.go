@@ -0,0 +1,304 @@
+// Package api implements an EST HTTP server.
+package api
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/smallstep/pkcs7"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/log"
+	"github.com/smallstep/certificates/est"
+)
+
+const maxPayloadSize = 2 << 20
+
+const (
+	certsOnlyContentType = "application/pkcs7-mime; smime-type=certs-only"
+	csrAttrsContentType  = "application/csrattrs"
+	pkcs8ContentType     = "application/pkcs8"
+)
+
+// Route traffic and implement the Router interface. The routes are expected
+// to be mounted in /.well-known/est.
+func Route(r api.Router) {
+	r.MethodFunc(http.MethodGet, "/{provisionerName}/cacerts", lookupProvisioner(CACerts))
+	r.MethodFunc(http.MethodGet, "/{provisionerName}/csrattrs", lookupProvisioner(CSRAttrs))
+	r.MethodFunc(http.MethodPost, "/{provisionerName}/simpleenroll", lookupProvisioner(authorize(SimpleEnroll)))
+	r.MethodFunc(http.MethodPost, "/{provisionerName}/simplereenroll", lookupProvisioner(SimpleReenroll))
+	r.MethodFunc(http.MethodPost, "/{provisionerName}/serverkeygen", lookupProvisioner(authorize(ServerKeyGen)))
+}
+
+// CACerts returns the CA certificates as a certs-only PKCS#7 structure.
+func CACerts(w http.ResponseWriter, r *http.Request) {
+	certs, err := est.MustFromContext(r.Context()).GetCACertificates(r.Context())
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	data, err := degenerateCertificates(certs)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	writeBase64(w, "application/pkcs7-mime", data)
+}
+
+// CSRAttrs returns the attributes the client should include in the CSR. If
+// the provisioner does not define any, it responds with 204 No Content.
+func CSRAttrs(w http.ResponseWriter, r *http.Request) {
+	oids := est.MustFromContext(r.Context()).GetCSRAttributes(r.Context())
+	if len(oids) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	data, err := asn1.Marshal(oids)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	writeBase64(w, csrAttrsContentType, data)
+}
+
+// SimpleEnroll signs the CSR in the body and returns the certificate as a
+// certs-only PKCS#7 structure.
+func SimpleEnroll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	auth := est.MustFromContext(ctx)
+	csr, err := readCSR(r)
+	if err != nil {
+		failStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := auth.VerifyChannelBinding(ctx, csr, r.TLS); err != nil {
+		fail(w, r, err)
+		return
+	}
+	cert, err := auth.SignCSR(ctx, csr)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	writeCertificate(w, r, cert)
+}
+
+// SimpleReenroll renews the TLS client certificate using the CSR in the body,
+// and returns the new certificate as a certs-only PKCS#7 structure.
+func SimpleReenroll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	auth := est.MustFromContext(ctx)
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		failStatus(w, r, http.StatusUnauthorized, errors.New("missing client certificate"))
+		return
+	}
+	csr, err := readCSR(r)
+	if err != nil {
+		failStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := auth.VerifyChannelBinding(ctx, csr, r.TLS); err != nil {
+		fail(w, r, err)
+		return
+	}
+	cert, err := auth.RenewCSR(ctx, csr, r.TLS.VerifiedChains[0])
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	writeCertificate(w, r, cert)
+}
+
+// ServerKeyGen generates a private key in the CA, and signs a certificate with
+// the subject and subject alternative names of the CSR in the body. It
+// returns a multipart response with the PKCS#8 private key and the
+// certificate as a certs-only PKCS#7 structure.
+func ServerKeyGen(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	auth := est.MustFromContext(ctx)
+	if !auth.IsServerKeyGenEnabled(ctx) {
+		failStatus(w, r, http.StatusNotImplemented, errors.New("serverkeygen is not enabled"))
+		return
+	}
+	csr, err := readCSR(r)
+	if err != nil {
+		failStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := auth.VerifyChannelBinding(ctx, csr, r.TLS); err != nil {
+		fail(w, r, err)
+		return
+	}
+	signer, cert, err := auth.GenerateKey(ctx, csr)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	data, err := degenerateCertificates([]*x509.Certificate{cert})
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		data        []byte
+	}{
+		{pkcs8ContentType, key},
+		{certsOnlyContentType, data},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			fail(w, r, err)
+			return
+		}
+		if _, err := pw.Write([]byte(base64.StdEncoding.EncodeToString(part.data))); err != nil {
+			fail(w, r, err)
+			return
+		}
+	}
+	if err := mw.Close(); err != nil {
+		fail(w, r, err)
+		return
+	}
+
+	api.LogCertificate(w, cert)
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	_, _ = w.Write(body.Bytes())
+}
+
+// lookupProvisioner loads the provisioner associated with the request.
+// Responds 404 if the provisioner does not exist.
+func lookupProvisioner(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "provisionerName")
+		provisionerName, err := url.PathUnescape(name)
+		if err != nil {
+			failStatus(w, r, http.StatusBadRequest, fmt.Errorf("error url unescaping provisioner name '%s'", name))
+			return
+		}
+
+		ctx := r.Context()
+		p, err := est.MustFromContext(ctx).LoadProvisionerByName(provisionerName)
+		if err != nil {
+			failStatus(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		ctx = est.NewProvisionerContext(ctx, p)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// authorize authenticates the request using the HTTP basic authentication
+// credentials or the TLS client certificate.
+func authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		auth := est.MustFromContext(ctx)
+		if err := auth.AuthorizeRequest(ctx, r); err != nil {
+			if auth.HasBasicAuth(ctx) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="est"`)
+			}
+			fail(w, r, err)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// readCSR reads a base64 encoded PKCS#10 certificate request from the request
+// body.
+func readCSR(r *http.Request) (*x509.CertificateRequest, error) {
+	defer r.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed reading request body: %w", err)
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(body)), ""))
+	if err != nil {
+		return nil, fmt.Errorf("failed base64 decoding certificate request: %w", err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing certificate request: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+	return csr, nil
+}
+
+// degenerateCertificates returns a certs-only PKCS#7 structure with the given
+// certificates.
+func degenerateCertificates(certs []*x509.Certificate) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, c := range certs {
+		buf.Write(c.Raw)
+	}
+	return pkcs7.DegenerateCertificate(buf.Bytes())
+}
+
+// writeCertificate writes the certificate as a certs-only PKCS#7 structure.
+func writeCertificate(w http.ResponseWriter, r *http.Request, cert *x509.Certificate) {
+	data, err := degenerateCertificates([]*x509.Certificate{cert})
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	api.LogCertificate(w, cert)
+	writeBase64(w, certsOnlyContentType, data)
+}
+
+// writeBase64 writes the base64 encoded data with the given content type.
+func writeBase64(w http.ResponseWriter, contentType string, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Transfer-Encoding", "base64")
+	_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString(data)))
+}
+
+// fail writes an error response with the status code of the error. Errors
+// without a status code are considered internal server errors.
+func fail(w http.ResponseWriter, r *http.Request, err error) {
+	var sc interface{ StatusCode() int }
+	switch {
+	case errors.Is(err, est.ErrUnauthorized):
+		failStatus(w, r, http.StatusUnauthorized, err)
+	case errors.As(err, &sc):
+		failStatus(w, r, sc.StatusCode(), err)
+	default:
+		failStatus(w, r, http.StatusInternalServerError, err)
+	}
+}
+
+// failStatus writes an error response with the given status code. The error
+// is only written for client errors, other errors are only logged.
+func failStatus(w http.ResponseWriter, r *http.Request, status int, err error) {
+	log.Error(w, r, err)
+	msg := http.StatusText(status)
+	if status < http.StatusInternalServerError {
+		msg = err.Error()
+	}
+	http.Error(w, msg, status)
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/smallstep/pkcs7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/est"
+)
+
+type signAuthority struct {
+	ca *minica.CA
+}
+
+func (s *signAuthority) SignWithContext(_ context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	var certOptions []x509util.Option
+	for _, so := range signOpts {
+		if co, ok := so.(provisioner.CertificateOptions); ok {
+			certOptions = append(certOptions, co.Options(opts)...)
+		}
+	}
+	c, err := x509util.NewCertificate(cr, certOptions...)
+	if err != nil {
+		return nil, err
+	}
+	crt, err := s.ca.Sign(c.GetCertificate())
+	if err != nil {
+		return nil, err
+	}
+	return []*x509.Certificate{crt, s.ca.Intermediate}, nil
+}
+
+func (s *signAuthority) LoadProvisionerByName(name string) (provisioner.Interface, error) {
+	var p *provisioner.EST
+	switch name {
+	case "est":
+		p = &provisioner.EST{Type: "EST", Name: name, Username: "user", Password: "pass"}
+	case "keygen":
+		p = &provisioner.EST{
+			Type: "EST", Name: name, Username: "user", Password: "pass",
+			EnableServerKeyGen: true,
+			CSRAttributes:      []string{"1.2.840.113549.1.9.7"},
+		}
+	default:
+		return nil, errors.New("provisioner not found")
+	}
+	if err := p.Init(provisioner.Config{
+		Claims: config.GlobalProvisionerClaims,
+	}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *signAuthority) LoadProvisionerByCertificate(*x509.Certificate) (provisioner.Interface, error) {
+	return s.LoadProvisionerByName("est")
+}
+
+func (s *signAuthority) GetRootCertificates() []*x509.Certificate {
+	return []*x509.Certificate{s.ca.Root}
+}
+
+func (s *signAuthority) GetIntermediateCertificates() []*x509.Certificate {
+	return []*x509.Certificate{s.ca.Intermediate}
+}
+
+func (s *signAuthority) IsRevoked(string) (bool, error) {
+	return false, nil
+}
+
+func newTestServer(t *testing.T) (*minica.CA, http.Handler) {
+	t.Helper()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	ctx := est.NewContext(context.Background(), est.New(&signAuthority{ca: ca}))
+	r := chi.NewRouter()
+	Route(r)
+	return ca, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+func newTestCSRBody(t *testing.T) io.Reader {
+	t.Helper()
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	csr, err := x509util.CreateCertificateRequest("device", []string{"device.example.com"}, signer)
+	require.NoError(t, err)
+	return strings.NewReader(base64.StdEncoding.EncodeToString(csr.Raw))
+}
+
+func parseCertsOnly(t *testing.T, body string) []*x509.Certificate {
+	t.Helper()
+	der, err := base64.StdEncoding.DecodeString(body)
+	require.NoError(t, err)
+	p7, err := pkcs7.Parse(der)
+	require.NoError(t, err)
+	return p7.Certificates
+}
+
+func TestCACerts(t *testing.T) {
+	ca, h := newTestServer(t)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/est/cacerts", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pkcs7-mime", w.Header().Get("Content-Type"))
+	assert.Equal(t, "base64", w.Header().Get("Content-Transfer-Encoding"))
+	assert.Equal(t, []*x509.Certificate{ca.Intermediate}, parseCertsOnly(t, w.Body.String()))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/foo/cacerts", http.NoBody))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestCSRAttrs(t *testing.T) {
+	_, h := newTestServer(t)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/est/csrattrs", http.NoBody))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/keygen/csrattrs", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/csrattrs", w.Header().Get("Content-Type"))
+	der, err := base64.StdEncoding.DecodeString(w.Body.String())
+	require.NoError(t, err)
+	var oids []asn1.ObjectIdentifier
+	_, err = asn1.Unmarshal(der, &oids)
+	require.NoError(t, err)
+	assert.Equal(t, []asn1.ObjectIdentifier{{1, 2, 840, 113549, 1, 9, 7}}, oids)
+}
+
+func TestSimpleEnroll(t *testing.T) {
+	_, h := newTestServer(t)
+
+	tests := []struct {
+		name     string
+		path     string
+		body     io.Reader
+		username string
+		password string
+		want     int
+	}{
+		{"ok", "/est/simpleenroll", newTestCSRBody(t), "user", "pass", http.StatusOK},
+		{"fail/provisioner", "/foo/simpleenroll", newTestCSRBody(t), "user", "pass", http.StatusNotFound},
+		{"fail/no-credentials", "/est/simpleenroll", newTestCSRBody(t), "", "", http.StatusUnauthorized},
+		{"fail/password", "/est/simpleenroll", newTestCSRBody(t), "user", "foo", http.StatusUnauthorized},
+		{"fail/not-base64", "/est/simpleenroll", strings.NewReader("not-base64"), "user", "pass", http.StatusBadRequest},
+		{"fail/not-csr", "/est/simpleenroll", strings.NewReader("Zm9v"), "user", "pass", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.path, tt.body)
+			if tt.username != "" {
+				r.SetBasicAuth(tt.username, tt.password)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			require.Equal(t, tt.want, w.Code)
+			switch tt.want {
+			case http.StatusOK:
+				assert.Equal(t, certsOnlyContentType, w.Header().Get("Content-Type"))
+				certs := parseCertsOnly(t, w.Body.String())
+				require.Len(t, certs, 1)
+				assert.Equal(t, "device", certs[0].Subject.CommonName)
+			case http.StatusUnauthorized:
+				assert.Equal(t, `Basic realm="est"`, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestSimpleReenroll(t *testing.T) {
+	_, h := newTestServer(t)
+
+	r := httptest.NewRequest(http.MethodPost, "/est/simplereenroll", newTestCSRBody(t))
+	r.SetBasicAuth("user", "pass")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestServerKeyGen(t *testing.T) {
+	_, h := newTestServer(t)
+
+	r := httptest.NewRequest(http.MethodPost, "/est/serverkeygen", newTestCSRBody(t))
+	r.SetBasicAuth("user", "pass")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+
+	r = httptest.NewRequest(http.MethodPost, "/keygen/serverkeygen", newTestCSRBody(t))
+	r.SetBasicAuth("user", "pass")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	mr := multipart.NewReader(w.Body, params["boundary"])
+	part, err := mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, pkcs8ContentType, part.Header.Get("Content-Type"))
+	b, err := io.ReadAll(part)
+	require.NoError(t, err)
+	der, err := base64.StdEncoding.DecodeString(string(b))
+	require.NoError(t, err)
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	require.NoError(t, err)
+
+	part, err = mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, certsOnlyContentType, part.Header.Get("Content-Type"))
+	b, err = io.ReadAll(part)
+	require.NoError(t, err)
+	certs := parseCertsOnly(t, string(b))
+	require.Len(t, certs, 1)
+	assert.Equal(t, "device", certs[0].Subject.CommonName)
+
+	signer, ok := key.(crypto.Signer)
+	require.True(t, ok)
+	assert.Equal(t, signer.Public(), certs[0].PublicKey)
+}
@@ -0,0 +1,344 @@
+// Package est implements the Enrollment over Secure Transport protocol
+// defined in RFC 7030.
+package est
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	smallscepx509util "github.com/smallstep/scep/x509util"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// ErrUnauthorized is returned when the client is not allowed to enroll.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Authority is the layer that handles all EST interactions.
+type Authority struct {
+	signAuth SignAuthority
+}
+
+type authorityKey struct{}
+
+// NewContext adds the given authority to the context.
+func NewContext(ctx context.Context, a *Authority) context.Context {
+	return context.WithValue(ctx, authorityKey{}, a)
+}
+
+// FromContext returns the current authority from the given context.
+func FromContext(ctx context.Context) (a *Authority, ok bool) {
+	a, ok = ctx.Value(authorityKey{}).(*Authority)
+	return
+}
+
+// MustFromContext returns the current authority from the given context. It will
+// panic if the authority is not in the context.
+func MustFromContext(ctx context.Context) *Authority {
+	a, ok := FromContext(ctx)
+	if !ok {
+		panic("est authority is not in the context")
+	}
+	return a
+}
+
+// SignAuthority is the interface for a signing authority
+type SignAuthority interface {
+	SignWithContext(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	LoadProvisionerByName(string) (provisioner.Interface, error)
+	LoadProvisionerByCertificate(*x509.Certificate) (provisioner.Interface, error)
+	GetRootCertificates() []*x509.Certificate
+	GetIntermediateCertificates() []*x509.Certificate
+	IsRevoked(sn string) (bool, error)
+}
+
+// New returns a new Authority that implements the EST interface.
+func New(signAuth SignAuthority) *Authority {
+	return &Authority{
+		signAuth: signAuth,
+	}
+}
+
+// LoadProvisionerByName returns the EST provisioner with the given name.
+func (a *Authority) LoadProvisionerByName(name string) (Provisioner, error) {
+	p, err := a.signAuth.LoadProvisionerByName(name)
+	if err != nil {
+		return nil, err
+	}
+	prov, ok := p.(*provisioner.EST)
+	if !ok {
+		return nil, errors.New("provisioner must be of type EST")
+	}
+	return prov, nil
+}
+
+// GetCACertificates returns the certificates returned in the cacerts
+// response, the intermediates and, if configured, the roots.
+func (a *Authority) GetCACertificates(ctx context.Context) ([]*x509.Certificate, error) {
+	p := provisionerFromContext(ctx)
+	certs := slices.Clone(a.signAuth.GetIntermediateCertificates())
+	if p.ShouldIncludeRootInChain() {
+		certs = append(certs, a.signAuth.GetRootCertificates()...)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("missing CA certificates")
+	}
+	return certs, nil
+}
+
+// HasBasicAuth returns true if the provisioner accepts HTTP basic
+// authentication.
+func (a *Authority) HasBasicAuth(ctx context.Context) bool {
+	return provisionerFromContext(ctx).HasBasicAuth()
+}
+
+// GetCSRAttributes returns the object identifiers of the csrattrs response.
+func (a *Authority) GetCSRAttributes(ctx context.Context) []asn1.ObjectIdentifier {
+	return provisionerFromContext(ctx).GetCSRAttributes()
+}
+
+// IsServerKeyGenEnabled returns true if the provisioner allows the
+// serverkeygen operation.
+func (a *Authority) IsServerKeyGenEnabled(ctx context.Context) bool {
+	return provisionerFromContext(ctx).IsServerKeyGenEnabled()
+}
+
+// AuthorizeRequest authenticates an enroll request using the HTTP basic
+// authentication credentials or the TLS client certificate.
+func (a *Authority) AuthorizeRequest(ctx context.Context, r *http.Request) error {
+	p := provisionerFromContext(ctx)
+	if username, password, ok := r.BasicAuth(); ok && p.HasBasicAuth() {
+		if err := p.AuthorizeBasicAuth(username, password); err != nil {
+			return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+		}
+		return nil
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		if err := p.AuthorizeClientCertificate(r.TLS.PeerCertificates); err != nil {
+			return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+		}
+		return a.checkRevocation(r.TLS.PeerCertificates[0])
+	}
+	return fmt.Errorf("%w: missing credentials", ErrUnauthorized)
+}
+
+// checkRevocation returns an error if the given client certificate has been
+// revoked.
+func (a *Authority) checkRevocation(cert *x509.Certificate) error {
+	isRevoked, err := a.signAuth.IsRevoked(cert.SerialNumber.String())
+	if err != nil {
+		return fmt.Errorf("error checking certificate revocation: %w", err)
+	}
+	if isRevoked {
+		return fmt.Errorf("%w: certificate has been revoked", ErrUnauthorized)
+	}
+	return nil
+}
+
+// VerifyChannelBinding checks, if the provisioner requires it, that the
+// challengePassword attribute of the CSR contains the channel binding value
+// of the TLS connection, as described in RFC 7030, section 3.5. The tls-unique
+// value is used with TLS 1.2, and the tls-exporter value defined in RFC 9266
+// with TLS 1.3.
+func (a *Authority) VerifyChannelBinding(ctx context.Context, csr *x509.CertificateRequest, state *tls.ConnectionState) error {
+	if !provisionerFromContext(ctx).ShouldRequireChannelBinding() {
+		return nil
+	}
+	if state == nil {
+		return fmt.Errorf("%w: channel binding requires a TLS connection", ErrUnauthorized)
+	}
+	want, err := channelBinding(state)
+	if err != nil {
+		return err
+	}
+	challenge, err := smallscepx509util.ParseChallengePassword(csr.Raw)
+	if err != nil {
+		return fmt.Errorf("error parsing challengePassword: %w", err)
+	}
+	got, err := base64.StdEncoding.DecodeString(challenge)
+	if err != nil || len(want) == 0 || !bytes.Equal(got, want) {
+		return fmt.Errorf("%w: challengePassword does not match the channel binding", ErrUnauthorized)
+	}
+	return nil
+}
+
+// channelBinding returns the channel binding value of a TLS connection.
+func channelBinding(state *tls.ConnectionState) ([]byte, error) {
+	if state.Version < tls.VersionTLS13 {
+		return state.TLSUnique, nil
+	}
+	b, err := state.ExportKeyingMaterial("EXPORTER-Channel-Binding", nil, 32)
+	if err != nil {
+		return nil, fmt.Errorf("error exporting channel binding: %w", err)
+	}
+	return b, nil
+}
+
+// SignCSR signs the given CSR and returns the issued certificate.
+func (a *Authority) SignCSR(ctx context.Context, csr *x509.CertificateRequest) (*x509.Certificate, error) {
+	p := provisionerFromContext(ctx)
+
+	// Template data
+	sans := []string{}
+	sans = append(sans, csr.DNSNames...)
+	sans = append(sans, csr.EmailAddresses...)
+	for _, v := range csr.IPAddresses {
+		sans = append(sans, v.String())
+	}
+	for _, v := range csr.URIs {
+		sans = append(sans, v.String())
+	}
+	if len(sans) == 0 {
+		sans = append(sans, csr.Subject.CommonName)
+	}
+	data := x509util.CreateTemplateData(csr.Subject.CommonName, sans)
+	data.SetCertificateRequest(csr)
+	data.SetSubject(x509util.Subject{
+		Country:            csr.Subject.Country,
+		Organization:       csr.Subject.Organization,
+		OrganizationalUnit: csr.Subject.OrganizationalUnit,
+		Locality:           csr.Subject.Locality,
+		Province:           csr.Subject.Province,
+		StreetAddress:      csr.Subject.StreetAddress,
+		PostalCode:         csr.Subject.PostalCode,
+		SerialNumber:       csr.Subject.SerialNumber,
+		CommonName:         csr.Subject.CommonName,
+	})
+
+	// Get authorizations from the EST provisioner.
+	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
+	signOps, err := p.AuthorizeSign(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving authorization options from EST provisioner: %w", err)
+	}
+	for _, signOp := range signOps {
+		if wc, ok := signOp.(*provisioner.WebhookController); ok {
+			wc.TemplateData = data
+		}
+	}
+
+	templateOptions, err := provisioner.TemplateOptions(p.GetOptions(), data)
+	if err != nil {
+		return nil, fmt.Errorf("error creating template options from EST provisioner: %w", err)
+	}
+	signOps = append(signOps, templateOptions)
+
+	certChain, err := a.signAuth.SignWithContext(ctx, csr, provisioner.SignOptions{}, signOps...)
+	if err != nil {
+		return nil, fmt.Errorf("error generating certificate: %w", err)
+	}
+	return certChain[0], nil
+}
+
+// RenewCSR signs a CSR to renew the first certificate of the given verified
+// client certificate chain. The certificate must have been issued by the EST
+// provisioner, or be signed by one of the provisioner roots, and it must not
+// be revoked. As defined in RFC 7030, section 4.2.2, the CSR must have the
+// same subject and subject alternative names as the certificate.
+func (a *Authority) RenewCSR(ctx context.Context, csr *x509.CertificateRequest, chain []*x509.Certificate) (*x509.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%w: missing client certificate", ErrUnauthorized)
+	}
+	cert := chain[0]
+	if err := a.authorizeReenroll(ctx, chain); err != nil {
+		return nil, err
+	}
+	if err := a.checkRevocation(cert); err != nil {
+		return nil, err
+	}
+	if !sameIdentity(csr, cert) {
+		return nil, fmt.Errorf("%w: certificate request subject and subject alternative names do not match the certificate", ErrUnauthorized)
+	}
+	return a.SignCSR(ctx, csr)
+}
+
+// authorizeReenroll checks that the client certificate was issued by the EST
+// provisioner in the context, or that it is signed by one of the provisioner
+// roots.
+func (a *Authority) authorizeReenroll(ctx context.Context, chain []*x509.Certificate) error {
+	p := provisionerFromContext(ctx)
+	if err := p.AuthorizeClientCertificate(chain); err == nil {
+		return nil
+	}
+	prov, err := a.signAuth.LoadProvisionerByCertificate(chain[0])
+	if err != nil || prov.GetName() != p.GetName() {
+		return fmt.Errorf("%w: certificate was not issued by provisioner %s", ErrUnauthorized, p.GetName())
+	}
+	return nil
+}
+
+// GenerateKey generates a new private key in the CA and signs a certificate
+// for it with the subject and subject alternative names of the given CSR.
+func (a *Authority) GenerateKey(ctx context.Context, csr *x509.CertificateRequest) (crypto.Signer, *x509.Certificate, error) {
+	signer, err := keyutil.GenerateDefaultSigner()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating key: %w", err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:        csr.Subject,
+		DNSNames:       csr.DNSNames,
+		EmailAddresses: csr.EmailAddresses,
+		IPAddresses:    csr.IPAddresses,
+		URIs:           csr.URIs,
+	}, signer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating certificate request: %w", err)
+	}
+	cr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing certificate request: %w", err)
+	}
+	cert, err := a.SignCSR(ctx, cr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signer, cert, nil
+}
+
+// sameIdentity returns true if the CSR has the same subject and subject
+// alternative names as the certificate.
+func sameIdentity(csr *x509.CertificateRequest, cert *x509.Certificate) bool {
+	if csr.Subject.String() != cert.Subject.String() {
+		return false
+	}
+	ips := func(c *x509.CertificateRequest) []string {
+		var s []string
+		for _, ip := range c.IPAddresses {
+			s = append(s, ip.String())
+		}
+		return s
+	}
+	uris := func(c *x509.CertificateRequest) []string {
+		var s []string
+		for _, u := range c.URIs {
+			s = append(s, u.String())
+		}
+		return s
+	}
+	certReq := &x509.CertificateRequest{IPAddresses: cert.IPAddresses, URIs: cert.URIs}
+	return sameStrings(csr.DNSNames, cert.DNSNames) &&
+		sameStrings(csr.EmailAddresses, cert.EmailAddresses) &&
+		sameStrings(ips(csr), ips(certReq)) &&
+		sameStrings(uris(csr), uris(certReq))
+}
+
+// sameStrings returns true if both slices contain the same values in any
+// order.
+func sameStrings(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
@@ -0,0 +1,336 @@
+package est
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	smallscepx509util "github.com/smallstep/scep/x509util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+	stepx509util "go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+type signAuthority struct {
+	ca          *minica.CA
+	revoked     bool
+	revokeErr   error
+	provisioner string
+}
+
+func (s *signAuthority) SignWithContext(_ context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	var certOptions []stepx509util.Option
+	for _, so := range signOpts {
+		if co, ok := so.(provisioner.CertificateOptions); ok {
+			certOptions = append(certOptions, co.Options(opts)...)
+		}
+	}
+	c, err := stepx509util.NewCertificate(cr, certOptions...)
+	if err != nil {
+		return nil, err
+	}
+	crt, err := s.ca.Sign(c.GetCertificate())
+	if err != nil {
+		return nil, err
+	}
+	return []*x509.Certificate{crt, s.ca.Intermediate}, nil
+}
+
+func (s *signAuthority) LoadProvisionerByName(name string) (provisioner.Interface, error) {
+	if name != "est" {
+		return nil, errors.New("provisioner not found")
+	}
+	p := &provisioner.EST{
+		Type:     "EST",
+		Name:     "est",
+		Username: "user",
+		Password: "pass",
+	}
+	if err := p.Init(provisioner.Config{
+		Claims: config.GlobalProvisionerClaims,
+	}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *signAuthority) LoadProvisionerByCertificate(*x509.Certificate) (provisioner.Interface, error) {
+	if s.provisioner == "" {
+		return s.LoadProvisionerByName("est")
+	}
+	return s.LoadProvisionerByName(s.provisioner)
+}
+
+func (s *signAuthority) GetRootCertificates() []*x509.Certificate {
+	return []*x509.Certificate{s.ca.Root}
+}
+
+func (s *signAuthority) GetIntermediateCertificates() []*x509.Certificate {
+	return []*x509.Certificate{s.ca.Intermediate}
+}
+
+func (s *signAuthority) IsRevoked(string) (bool, error) {
+	return s.revoked, s.revokeErr
+}
+
+func newTestContext(t *testing.T, p *provisioner.EST) context.Context {
+	t.Helper()
+	require.NoError(t, p.Init(provisioner.Config{
+		Claims: config.GlobalProvisionerClaims,
+	}))
+	return NewProvisionerContext(context.Background(), p)
+}
+
+func pemEncode(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type: "CERTIFICATE", Bytes: cert.Raw,
+	})
+}
+
+func newTestCSR(t *testing.T, cn string, sans []string) *x509.CertificateRequest {
+	t.Helper()
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	csr, err := stepx509util.CreateCertificateRequest(cn, sans, signer)
+	require.NoError(t, err)
+	return csr
+}
+
+func TestAuthority_LoadProvisionerByName(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	a := New(&signAuthority{ca: ca})
+
+	p, err := a.LoadProvisionerByName("est")
+	require.NoError(t, err)
+	assert.Equal(t, "est", p.GetName())
+
+	_, err = a.LoadProvisionerByName("foo")
+	assert.Error(t, err)
+}
+
+func TestAuthority_GetCACertificates(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	a := New(&signAuthority{ca: ca})
+
+	certs, err := a.GetCACertificates(newTestContext(t, &provisioner.EST{
+		Type: "EST", Name: "est", Username: "user", Password: "pass",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{ca.Intermediate}, certs)
+
+	certs, err = a.GetCACertificates(newTestContext(t, &provisioner.EST{
+		Type: "EST", Name: "est", Username: "user", Password: "pass", IncludeRoot: true,
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{ca.Intermediate, ca.Root}, certs)
+}
+
+func TestAuthority_AuthorizeRequest(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	a := New(&signAuthority{ca: ca})
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	clientCert, err := ca.Sign(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "device"},
+		PublicKey:   signer.Public(),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	require.NoError(t, err)
+
+	basicAuthCtx := newTestContext(t, &provisioner.EST{
+		Type: "EST", Name: "est", Username: "user", Password: "pass",
+	})
+	rootsCtx := newTestContext(t, &provisioner.EST{
+		Type: "EST", Name: "est", Roots: pemEncode(ca.Root),
+	})
+
+	newRequest := func(username, password string, chain ...*x509.Certificate) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/est/simpleenroll", http.NoBody)
+		if username != "" {
+			r.SetBasicAuth(username, password)
+		}
+		if len(chain) > 0 {
+			r.TLS = &tls.ConnectionState{PeerCertificates: chain}
+		}
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		a       *Authority
+		ctx     context.Context
+		r       *http.Request
+		wantErr bool
+	}{
+		{"ok/basic-auth", a, basicAuthCtx, newRequest("user", "pass"), false},
+		{"ok/client-certificate", a, rootsCtx, newRequest("", "", clientCert, ca.Intermediate), false},
+		{"ok/basic-auth-ignored", a, rootsCtx, newRequest("user", "pass", clientCert, ca.Intermediate), false},
+		{"fail/basic-auth", a, basicAuthCtx, newRequest("user", "foo"), true},
+		{"fail/client-certificate", a, basicAuthCtx, newRequest("", "", clientCert, ca.Intermediate), true},
+		{"fail/missing-credentials", a, rootsCtx, newRequest("user", "pass"), true},
+		{"fail/no-credentials", a, basicAuthCtx, newRequest("", ""), true},
+		{"fail/revoked", New(&signAuthority{ca: ca, revoked: true}), rootsCtx, newRequest("", "", clientCert, ca.Intermediate), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.a.AuthorizeRequest(tt.ctx, tt.r)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrUnauthorized)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAuthority_VerifyChannelBinding(t *testing.T) {
+	a := New(nil)
+	ctx := newTestContext(t, &provisioner.EST{
+		Type: "EST", Name: "est", Username: "user", Password: "pass", RequireChannelBinding: true,
+	})
+	noBindingCtx := newTestContext(t, &provisioner.EST{
+		Type: "EST", Name: "est", Username: "user", Password: "pass",
+	})
+
+	tlsUnique := []byte("0123456789ab")
+	state := &tls.ConnectionState{Version: tls.VersionTLS12, TLSUnique: tlsUnique}
+
+	newCSR := func(challenge string) *x509.CertificateRequest {
+		signer, err := keyutil.GenerateDefaultSigner()
+		require.NoError(t, err)
+		der, err := smallscepx509util.CreateCertificateRequest(rand.Reader, &smallscepx509util.CertificateRequest{
+			CertificateRequest: x509.CertificateRequest{
+				Subject: pkix.Name{CommonName: "device"},
+			},
+			ChallengePassword: challenge,
+		}, signer)
+		require.NoError(t, err)
+		csr, err := x509.ParseCertificateRequest(der)
+		require.NoError(t, err)
+		return csr
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		csr     *x509.CertificateRequest
+		state   *tls.ConnectionState
+		wantErr bool
+	}{
+		{"ok", ctx, newCSR(base64.StdEncoding.EncodeToString(tlsUnique)), state, false},
+		{"ok/not-required", noBindingCtx, newTestCSR(t, "device", nil), nil, false},
+		{"fail/no-tls", ctx, newCSR(base64.StdEncoding.EncodeToString(tlsUnique)), nil, true},
+		{"fail/missing", ctx, newTestCSR(t, "device", nil), state, true},
+		{"fail/mismatch", ctx, newCSR(base64.StdEncoding.EncodeToString([]byte("foo"))), state, true},
+		{"fail/not-base64", ctx, newCSR("not base64"), state, true},
+		{"fail/empty-tls-unique", ctx, newCSR(""), &tls.ConnectionState{Version: tls.VersionTLS12}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.VerifyChannelBinding(tt.ctx, tt.csr, tt.state)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAuthority_SignCSR(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	a := New(&signAuthority{ca: ca})
+	ctx := newTestContext(t, &provisioner.EST{
+		Type: "EST", Name: "est", Username: "user", Password: "pass",
+	})
+
+	csr := newTestCSR(t, "device", []string{"device.example.com", "127.0.0.1"})
+	cert, err := a.SignCSR(ctx, csr)
+	require.NoError(t, err)
+	assert.Equal(t, "device", cert.Subject.CommonName)
+	assert.Equal(t, []string{"device.example.com"}, cert.DNSNames)
+	assert.Len(t, cert.IPAddresses, 1)
+	assert.Equal(t, csr.PublicKey, cert.PublicKey)
+}
+
+func TestAuthority_RenewCSR(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	ctx := newTestContext(t, &provisioner.EST{
+		Type: "EST", Name: "est", Username: "user", Password: "pass",
+	})
+
+	cert, err := New(&signAuthority{ca: ca}).SignCSR(ctx, newTestCSR(t, "device", []string{"device.example.com", "127.0.0.1"}))
+	require.NoError(t, err)
+	chain := []*x509.Certificate{cert, ca.Intermediate, ca.Root}
+	rootsCtx := newTestContext(t, &provisioner.EST{
+		Type: "EST", Name: "est", Roots: pemEncode(ca.Root),
+	})
+
+	tests := []struct {
+		name             string
+		sa               *signAuthority
+		ctx              context.Context
+		chain            []*x509.Certificate
+		csr              *x509.CertificateRequest
+		wantErr          bool
+		wantUnauthorized bool
+	}{
+		{"ok", &signAuthority{ca: ca}, ctx, chain, newTestCSR(t, "device", []string{"127.0.0.1", "device.example.com"}), false, false},
+		{"ok/provisioner-roots", &signAuthority{ca: ca, provisioner: "other"}, rootsCtx, chain, newTestCSR(t, "device", []string{"127.0.0.1", "device.example.com"}), false, false},
+		{"fail/provisioner", &signAuthority{ca: ca, provisioner: "other"}, ctx, chain, newTestCSR(t, "device", []string{"device.example.com", "127.0.0.1"}), true, true},
+		{"fail/missing", &signAuthority{ca: ca}, ctx, nil, newTestCSR(t, "device", []string{"device.example.com", "127.0.0.1"}), true, true},
+		{"fail/revoked", &signAuthority{ca: ca, revoked: true}, ctx, chain, newTestCSR(t, "device", []string{"device.example.com", "127.0.0.1"}), true, true},
+		{"fail/is-revoked", &signAuthority{ca: ca, revokeErr: errors.New("force")}, ctx, chain, newTestCSR(t, "device", []string{"device.example.com", "127.0.0.1"}), true, false},
+		{"fail/subject", &signAuthority{ca: ca}, ctx, chain, newTestCSR(t, "other", []string{"device.example.com", "127.0.0.1"}), true, true},
+		{"fail/sans", &signAuthority{ca: ca}, ctx, chain, newTestCSR(t, "device", []string{"device.example.com"}), true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.sa).RenewCSR(tt.ctx, tt.csr, tt.chain)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Equal(t, tt.wantUnauthorized, errors.Is(err, ErrUnauthorized))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.csr.PublicKey, got.PublicKey)
+			assert.NotEqual(t, cert.SerialNumber, got.SerialNumber)
+		})
+	}
+}
+
+func TestAuthority_GenerateKey(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	a := New(&signAuthority{ca: ca})
+	ctx := newTestContext(t, &provisioner.EST{
+		Type: "EST", Name: "est", Username: "user", Password: "pass", EnableServerKeyGen: true,
+	})
+
+	csr := newTestCSR(t, "device", []string{"device.example.com"})
+	signer, cert, err := a.GenerateKey(ctx, csr)
+	require.NoError(t, err)
+	assert.Equal(t, signer.Public(), cert.PublicKey)
+	assert.NotEqual(t, csr.PublicKey, cert.PublicKey)
+	assert.Equal(t, "device", cert.Subject.CommonName)
+	assert.Equal(t, []string{"device.example.com"}, cert.DNSNames)
+}
@@ -0,0 +1,42 @@
+package est
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// Provisioner is an interface that embeds the provisioner.Interface and adds
+// some EST specific functions.
+type Provisioner interface {
+	provisioner.Interface
+	GetOptions() *provisioner.Options
+	HasBasicAuth() bool
+	AuthorizeBasicAuth(username, password string) error
+	AuthorizeClientCertificate(chain []*x509.Certificate) error
+	ShouldRequireChannelBinding() bool
+	ShouldIncludeRootInChain() bool
+	IsServerKeyGenEnabled() bool
+	GetCSRAttributes() []asn1.ObjectIdentifier
+}
+
+// provisionerKey is the key type for storing and searching an EST
+// provisioner in the context.
+type provisionerKey struct{}
+
+// provisionerFromContext searches the context for an EST provisioner.
+// Returns the provisioner or panics if no EST provisioner is found.
+func provisionerFromContext(ctx context.Context) Provisioner {
+	p, ok := ctx.Value(provisionerKey{}).(Provisioner)
+	if !ok {
+		panic("EST provisioner expected in request context")
+	}
+	return p
+}
+
+// NewProvisionerContext adds the given EST provisioner to the context.
+func NewProvisionerContext(ctx context.Context, p Provisioner) context.Context {
+	return context.WithValue(ctx, provisionerKey{}, p)
+}
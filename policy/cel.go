@@ -0,0 +1,431 @@
+package policy
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/ext"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// The variables available to the CEL policy expressions.
+const (
+	celCertificateVariable = "cert"
+	celRequestVariable     = "csr"
+	celProvisionerVariable = "provisioner"
+	celTokenVariable       = "token"
+	celAttestationVariable = "attestation"
+	celAccountVariable     = "account"
+)
+
+// The limits of the evaluation of a CEL policy expression. The expressions
+// are evaluated on every signing request, an expression exceeding the cost
+// limit or the timeout fails and the request is rejected.
+const (
+	celCostLimit              = 1_000_000
+	celEvaluationTimeout      = 100 * time.Millisecond
+	celInterruptCheckInterval = 100
+)
+
+// CELPolicyError is returned when a certificate doesn't satisfy a rule of a
+// CEL policy, or when the expression of the rule can't be evaluated.
+type CELPolicyError struct {
+	Rule    string
+	Message string
+	Err     error
+}
+
+func (e *CELPolicyError) Error() string {
+	switch {
+	case e.Err != nil:
+		return fmt.Sprintf("error evaluating policy rule %q: %v", e.Rule, e.Err)
+	case e.Message != "":
+		return fmt.Sprintf("policy rule %q not satisfied: %s", e.Rule, e.Message)
+	default:
+		return fmt.Sprintf("policy rule %q not satisfied", e.Rule)
+	}
+}
+
+// Unwrap returns the evaluation error, if any.
+func (e *CELPolicyError) Unwrap() error {
+	return e.Err
+}
+
+// As implements the As(any) bool interface and allows to use "errors.As()" to
+// convert a CELPolicyError to an errs.Error. Evaluation errors are also
+// converted to a forbidden error, rules fail closed.
+func (e *CELPolicyError) As(v any) bool {
+	if err, ok := v.(**errs.Error); ok {
+		*err = &errs.Error{
+			Status: http.StatusForbidden,
+			Msg:    fmt.Sprintf("The request was forbidden by the certificate authority: %s", e.Error()),
+			Err:    e,
+		}
+		return true
+	}
+	return false
+}
+
+// CELData contains the data, besides the certificate and the certificate
+// request, the CEL policy expressions are evaluated against. Nil maps are
+// evaluated as empty maps.
+type CELData struct {
+	// Provisioner contains the id, name and type of the provisioner.
+	Provisioner map[string]any
+	// Token contains the claims of the token used to authorize the request.
+	Token map[string]any
+	// Attestation contains the data of the ACME device attestation: the
+	// permanentIdentifier, the fingerprint of the attested key and the type
+	// of attestation (apple, step or tpm).
+	Attestation map[string]any
+	// Account contains the id of the ACME account.
+	Account map[string]any
+}
+
+type celRule struct {
+	name    string
+	message string
+	program cel.Program
+}
+
+// CELPolicyEngine evaluates X.509 and SSH certificates against rules written
+// as CEL expressions. A certificate is allowed if all the expressions of the
+// rules for its kind evaluate to true.
+type CELPolicyEngine struct {
+	x509Rules []celRule
+	sshRules  []celRule
+}
+
+type CELPolicyOption func(e *CELPolicyEngine) error
+
+// NewCELPolicyEngine creates a new CELPolicyEngine with CELPolicyOptions.
+func NewCELPolicyEngine(opts ...CELPolicyOption) (*CELPolicyEngine, error) {
+	e := &CELPolicyEngine{}
+	for _, option := range opts {
+		if err := option(e); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// WithX509CELRule adds a rule that X.509 certificates must satisfy. The
+// message is added to the error returned when the rule is not satisfied.
+func WithX509CELRule(name, expression, message string) CELPolicyOption {
+	return func(e *CELPolicyEngine) error {
+		rule, err := newCELRule(e.x509Rules, name, expression, message)
+		if err != nil {
+			return err
+		}
+		e.x509Rules = append(e.x509Rules, rule)
+		return nil
+	}
+}
+
+// WithSSHCELRule adds a rule that SSH certificates must satisfy. The message
+// is added to the error returned when the rule is not satisfied.
+func WithSSHCELRule(name, expression, message string) CELPolicyOption {
+	return func(e *CELPolicyEngine) error {
+		rule, err := newCELRule(e.sshRules, name, expression, message)
+		if err != nil {
+			return err
+		}
+		e.sshRules = append(e.sshRules, rule)
+		return nil
+	}
+}
+
+// celEnv returns the CEL environment shared by all the policy expressions.
+var celEnv = sync.OnceValues(func() (*cel.Env, error) {
+	mapType := cel.MapType(cel.StringType, cel.DynType)
+	return cel.NewEnv(
+		cel.Variable(celCertificateVariable, mapType),
+		cel.Variable(celRequestVariable, mapType),
+		cel.Variable(celProvisionerVariable, mapType),
+		cel.Variable(celTokenVariable, mapType),
+		cel.Variable(celAttestationVariable, mapType),
+		cel.Variable(celAccountVariable, mapType),
+		ext.Strings(),
+		ext.Lists(),
+		ext.Sets(),
+	)
+})
+
+func newCELRule(rules []celRule, name, expression, message string) (celRule, error) {
+	switch {
+	case name == "":
+		return celRule{}, errors.New("policy rule name cannot be empty")
+	case expression == "":
+		return celRule{}, fmt.Errorf("policy rule %q expression cannot be empty", name)
+	}
+	for _, r := range rules {
+		if r.name == name {
+			return celRule{}, fmt.Errorf("policy rule %q is defined more than once", name)
+		}
+	}
+
+	env, err := celEnv()
+	if err != nil {
+		return celRule{}, fmt.Errorf("error creating CEL environment: %w", err)
+	}
+	ast, iss := env.Compile(expression)
+	if iss.Err() != nil {
+		return celRule{}, fmt.Errorf("error compiling policy rule %q: %w", name, iss.Err())
+	}
+	if ast.OutputType() != cel.BoolType {
+		return celRule{}, fmt.Errorf("policy rule %q must evaluate to a bool, not %s", name, ast.OutputType())
+	}
+	program, err := env.Program(ast,
+		cel.CostLimit(celCostLimit),
+		cel.InterruptCheckFrequency(celInterruptCheckInterval),
+	)
+	if err != nil {
+		return celRule{}, fmt.Errorf("error creating program for policy rule %q: %w", name, err)
+	}
+
+	return celRule{
+		name:    name,
+		message: message,
+		program: program,
+	}, nil
+}
+
+// IsX509CertificateAllowed evaluates the X.509 rules against the certificate
+// template, the certificate request and the rest of the request data. The
+// certificate request can be nil.
+func (e *CELPolicyEngine) IsX509CertificateAllowed(cert *x509.Certificate, csr *x509.CertificateRequest, data *CELData) error {
+	if e == nil || len(e.x509Rules) == 0 {
+		return nil
+	}
+	vars := celVariables(data)
+	vars[celCertificateVariable] = x509CertificateVariable(cert)
+	vars[celRequestVariable] = x509CertificateRequestVariable(csr)
+	return evaluateCELRules(e.x509Rules, vars)
+}
+
+// IsSSHCertificateAllowed evaluates the SSH rules against the certificate
+// template and the rest of the request data.
+func (e *CELPolicyEngine) IsSSHCertificateAllowed(cert *ssh.Certificate, data *CELData) error {
+	if e == nil || len(e.sshRules) == 0 {
+		return nil
+	}
+	vars := celVariables(data)
+	vars[celCertificateVariable] = sshCertificateVariable(cert)
+	vars[celRequestVariable] = map[string]any{}
+	return evaluateCELRules(e.sshRules, vars)
+}
+
+func evaluateCELRules(rules []celRule, vars map[string]any) error {
+	for _, r := range rules {
+		out, err := evaluateCELRule(r, vars)
+		if err != nil {
+			return &CELPolicyError{Rule: r.name, Err: err}
+		}
+		if allowed, ok := out.Value().(bool); !ok {
+			return &CELPolicyError{Rule: r.name, Err: fmt.Errorf("unexpected result type %s", out.Type())}
+		} else if !allowed {
+			return &CELPolicyError{Rule: r.name, Message: r.message}
+		}
+	}
+	return nil
+}
+
+func evaluateCELRule(r celRule, vars map[string]any) (ref.Val, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), celEvaluationTimeout)
+	defer cancel()
+	out, _, err := r.program.ContextEval(ctx, vars)
+	return out, err
+}
+
+func celVariables(data *CELData) map[string]any {
+	if data == nil {
+		data = &CELData{}
+	}
+	return map[string]any{
+		celProvisionerVariable: emptyIfNil(data.Provisioner),
+		celTokenVariable:       emptyIfNil(data.Token),
+		celAttestationVariable: emptyIfNil(data.Attestation),
+		celAccountVariable:     emptyIfNil(data.Account),
+	}
+}
+
+func emptyIfNil(m map[string]any) map[string]any {
+	if m == nil {
+		return map[string]any{}
+	}
+	return m
+}
+
+var keyUsageNames = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "digitalSignature"},
+	{x509.KeyUsageContentCommitment, "contentCommitment"},
+	{x509.KeyUsageKeyEncipherment, "keyEncipherment"},
+	{x509.KeyUsageDataEncipherment, "dataEncipherment"},
+	{x509.KeyUsageKeyAgreement, "keyAgreement"},
+	{x509.KeyUsageCertSign, "certSign"},
+	{x509.KeyUsageCRLSign, "crlSign"},
+	{x509.KeyUsageEncipherOnly, "encipherOnly"},
+	{x509.KeyUsageDecipherOnly, "decipherOnly"},
+}
+
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:                            "any",
+	x509.ExtKeyUsageServerAuth:                     "serverAuth",
+	x509.ExtKeyUsageClientAuth:                     "clientAuth",
+	x509.ExtKeyUsageCodeSigning:                    "codeSigning",
+	x509.ExtKeyUsageEmailProtection:                "emailProtection",
+	x509.ExtKeyUsageIPSECEndSystem:                 "ipsecEndSystem",
+	x509.ExtKeyUsageIPSECTunnel:                    "ipsecTunnel",
+	x509.ExtKeyUsageIPSECUser:                      "ipsecUser",
+	x509.ExtKeyUsageTimeStamping:                   "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:                    "ocspSigning",
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     "microsoftServerGatedCrypto",
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      "netscapeServerGatedCrypto",
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: "microsoftCommercialCodeSigning",
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     "microsoftKernelCodeSigning",
+}
+
+// x509CertificateVariable returns the value of the cert variable for an X.509
+// certificate. Key usages and extended key usages are represented by name,
+// unknown extended key usages by their object identifier.
+func x509CertificateVariable(cert *x509.Certificate) map[string]any {
+	if cert == nil {
+		return map[string]any{}
+	}
+
+	keyUsage := []string{}
+	for _, ku := range keyUsageNames {
+		if cert.KeyUsage&ku.usage != 0 {
+			keyUsage = append(keyUsage, ku.name)
+		}
+	}
+	extKeyUsage := []string{}
+	for _, eku := range cert.ExtKeyUsage {
+		if name, ok := extKeyUsageNames[eku]; ok {
+			extKeyUsage = append(extKeyUsage, name)
+		}
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		extKeyUsage = append(extKeyUsage, oid.String())
+	}
+
+	v := sansVariable(cert.Subject, cert.DNSNames, cert.EmailAddresses, cert.IPAddresses, cert.URIs)
+	v["keyUsage"] = keyUsage
+	v["extKeyUsage"] = extKeyUsage
+	v["isCA"] = cert.IsCA
+	v["notBefore"] = cert.NotBefore
+	v["notAfter"] = cert.NotAfter
+	return v
+}
+
+// x509CertificateRequestVariable returns the value of the csr variable for an
+// X.509 certificate request.
+func x509CertificateRequestVariable(csr *x509.CertificateRequest) map[string]any {
+	if csr == nil {
+		return map[string]any{}
+	}
+	return sansVariable(csr.Subject, csr.DNSNames, csr.EmailAddresses, csr.IPAddresses, csr.URIs)
+}
+
+func sansVariable(subject pkix.Name, dnsNames, emails []string, ips []net.IP, uris []*url.URL) map[string]any {
+	ipAddresses := make([]string, len(ips))
+	for i, ip := range ips {
+		ipAddresses[i] = ip.String()
+	}
+	uriNames := make([]string, len(uris))
+	for i, u := range uris {
+		uriNames[i] = u.String()
+	}
+
+	sans := make([]string, 0, len(dnsNames)+len(emails)+len(ipAddresses)+len(uriNames))
+	sans = append(sans, dnsNames...)
+	sans = append(sans, emails...)
+	sans = append(sans, ipAddresses...)
+	sans = append(sans, uriNames...)
+
+	return map[string]any{
+		"subject": map[string]any{
+			"commonName":         subject.CommonName,
+			"serialNumber":       subject.SerialNumber,
+			"country":            nonNil(subject.Country),
+			"organization":       nonNil(subject.Organization),
+			"organizationalUnit": nonNil(subject.OrganizationalUnit),
+			"locality":           nonNil(subject.Locality),
+			"province":           nonNil(subject.Province),
+			"streetAddress":      nonNil(subject.StreetAddress),
+			"postalCode":         nonNil(subject.PostalCode),
+		},
+		"dnsNames":       nonNil(dnsNames),
+		"emailAddresses": nonNil(emails),
+		"ipAddresses":    ipAddresses,
+		"uris":           uriNames,
+		"sans":           sans,
+	}
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// maxCELTime is the maximum timestamp supported by CEL.
+var maxCELTime = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+
+// sshCertificateVariable returns the value of the cert variable for an SSH
+// certificate.
+func sshCertificateVariable(cert *ssh.Certificate) map[string]any {
+	if cert == nil {
+		return map[string]any{}
+	}
+
+	var certType string
+	switch cert.CertType {
+	case ssh.UserCert:
+		certType = "user"
+	case ssh.HostCert:
+		certType = "host"
+	}
+
+	criticalOptions := make(map[string]string, len(cert.CriticalOptions))
+	for k, v := range cert.CriticalOptions {
+		criticalOptions[k] = v
+	}
+	extensions := make(map[string]string, len(cert.Extensions))
+	for k, v := range cert.Extensions {
+		extensions[k] = v
+	}
+
+	return map[string]any{
+		"type":            certType,
+		"keyId":           cert.KeyId,
+		"principals":      nonNil(cert.ValidPrincipals),
+		"criticalOptions": criticalOptions,
+		"extensions":      extensions,
+		"validAfter":      sshTime(cert.ValidAfter),
+		"validBefore":     sshTime(cert.ValidBefore),
+	}
+}
+
+func sshTime(t uint64) time.Time {
+	if t > uint64(maxCELTime.Unix()) {
+		return maxCELTime
+	}
+	return time.Unix(int64(t), 0).UTC()
+}
@@ -0,0 +1,266 @@
+package policy
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+func TestNewCELPolicyEngine(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []CELPolicyOption
+		wantErr bool
+	}{
+		{"ok", []CELPolicyOption{
+			WithX509CELRule("max-sans", "size(cert.sans) <= 5", "too many names"),
+			WithX509CELRule("spiffe", `cert.uris.all(u, u.startsWith("spiffe://prod/"))`, ""),
+			WithSSHCELRule("max-sans", `cert.type == "host" || size(cert.principals) <= 5`, ""),
+		}, false},
+		{"ok/empty", nil, false},
+		{"fail/name", []CELPolicyOption{WithX509CELRule("", "true", "")}, true},
+		{"fail/expression", []CELPolicyOption{WithSSHCELRule("empty", "", "")}, true},
+		{"fail/duplicate", []CELPolicyOption{
+			WithX509CELRule("rule", "true", ""),
+			WithX509CELRule("rule", "false", ""),
+		}, true},
+		{"fail/syntax", []CELPolicyOption{WithX509CELRule("syntax", "size(cert.sans <= 5", "")}, true},
+		{"fail/undeclared", []CELPolicyOption{WithX509CELRule("undeclared", "request.sans == []", "")}, true},
+		{"fail/not-bool", []CELPolicyOption{WithX509CELRule("not-bool", "size(cert.sans)", "")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewCELPolicyEngine(tt.options...)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, got)
+		})
+	}
+}
+
+func TestCELPolicyEngine_IsX509CertificateAllowed(t *testing.T) {
+	prodURI, _ := url.Parse("spiffe://prod/ns/default/sa/app")
+	devURI, _ := url.Parse("spiffe://dev/ns/default/sa/app")
+	now := time.Now()
+
+	k8sData := &CELData{
+		Provisioner: map[string]any{"id": "prov-id", "name": "k8s", "type": "K8sSA"},
+	}
+	oidcData := func(groups ...any) *CELData {
+		return &CELData{
+			Provisioner: map[string]any{"id": "prov-id", "name": "google", "type": "OIDC"},
+			Token:       map[string]any{"email": "jane@example.com", "groups": groups},
+		}
+	}
+
+	clientAuth := WithX509CELRule("client-auth",
+		`!("clientAuth" in cert.extKeyUsage) || (has(token.groups) && "admins" in token.groups)`,
+		"client certificates require the admins group")
+	spiffe := WithX509CELRule("spiffe",
+		`provisioner.type != "K8sSA" || cert.uris.all(u, u.startsWith("spiffe://prod/"))`, "")
+
+	tests := []struct {
+		name    string
+		options []CELPolicyOption
+		cert    *x509.Certificate
+		csr     *x509.CertificateRequest
+		data    *CELData
+		wantErr *CELPolicyError
+	}{
+		{"ok/no-policy", nil, &x509.Certificate{DNSNames: []string{"example.com"}}, nil, nil, nil},
+		{"ok/max-sans", []CELPolicyOption{WithX509CELRule("max-sans", "size(cert.sans) <= 2", "")}, &x509.Certificate{
+			DNSNames:    []string{"example.com"},
+			IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		}, nil, nil, nil},
+		{"fail/max-sans", []CELPolicyOption{WithX509CELRule("max-sans", "size(cert.sans) <= 2", "at most 2 names")}, &x509.Certificate{
+			DNSNames:       []string{"example.com"},
+			EmailAddresses: []string{"jane@example.com"},
+			URIs:           []*url.URL{prodURI},
+		}, nil, nil, &CELPolicyError{Rule: "max-sans", Message: "at most 2 names"}},
+		{"ok/client-auth", []CELPolicyOption{clientAuth}, &x509.Certificate{
+			EmailAddresses: []string{"jane@example.com"},
+			ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, nil, oidcData("admins", "users"), nil},
+		{"ok/client-auth-server", []CELPolicyOption{clientAuth}, &x509.Certificate{
+			DNSNames:    []string{"example.com"},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, nil, nil, nil},
+		{"fail/client-auth", []CELPolicyOption{clientAuth}, &x509.Certificate{
+			EmailAddresses: []string{"jane@example.com"},
+			ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, nil, oidcData("users"), &CELPolicyError{Rule: "client-auth", Message: "client certificates require the admins group"}},
+		{"fail/client-auth-no-token", []CELPolicyOption{clientAuth}, &x509.Certificate{
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, nil, nil, &CELPolicyError{Rule: "client-auth", Message: "client certificates require the admins group"}},
+		{"ok/spiffe", []CELPolicyOption{spiffe}, &x509.Certificate{URIs: []*url.URL{prodURI}}, nil, k8sData, nil},
+		{"ok/spiffe-other-provisioner", []CELPolicyOption{spiffe}, &x509.Certificate{URIs: []*url.URL{devURI}}, nil, oidcData(), nil},
+		{"fail/spiffe", []CELPolicyOption{spiffe}, &x509.Certificate{URIs: []*url.URL{prodURI, devURI}}, nil, k8sData, &CELPolicyError{Rule: "spiffe"}},
+		{"ok/csr", []CELPolicyOption{WithX509CELRule("csr", "cert.subject.commonName == csr.subject.commonName", "")},
+			&x509.Certificate{Subject: pkix.Name{CommonName: "example.com"}},
+			&x509.CertificateRequest{Subject: pkix.Name{CommonName: "example.com"}}, nil, nil},
+		{"fail/csr", []CELPolicyOption{WithX509CELRule("csr", "cert.subject.commonName == csr.subject.commonName", "")},
+			&x509.Certificate{Subject: pkix.Name{CommonName: "example.com"}},
+			&x509.CertificateRequest{Subject: pkix.Name{CommonName: "other.example.com"}}, nil, &CELPolicyError{Rule: "csr"}},
+		{"ok/key-usage", []CELPolicyOption{WithX509CELRule("key-usage", `!cert.isCA && cert.keyUsage == ["digitalSignature", "keyEncipherment"] && "1.2.3.4" in cert.extKeyUsage`, "")}, &x509.Certificate{
+			KeyUsage:           x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+			UnknownExtKeyUsage: []asn1.ObjectIdentifier{{1, 2, 3, 4}},
+		}, nil, nil, nil},
+		{"ok/validity", []CELPolicyOption{WithX509CELRule("validity", `cert.notAfter - cert.notBefore <= duration("24h")`, "")}, &x509.Certificate{
+			NotBefore: now, NotAfter: now.Add(24 * time.Hour),
+		}, nil, nil, nil},
+		{"fail/validity", []CELPolicyOption{WithX509CELRule("validity", `cert.notAfter - cert.notBefore <= duration("24h")`, "")}, &x509.Certificate{
+			NotBefore: now, NotAfter: now.Add(25 * time.Hour),
+		}, nil, nil, &CELPolicyError{Rule: "validity"}},
+		{"ok/attestation", []CELPolicyOption{WithX509CELRule("attestation", `account.id == "account-id" && attestation.permanentIdentifier.startsWith("serial-")`, "")}, &x509.Certificate{}, nil, &CELData{
+			Attestation: map[string]any{"permanentIdentifier": "serial-1234"},
+			Account:     map[string]any{"id": "account-id"},
+		}, nil},
+		{"ok/attestation-type", []CELPolicyOption{WithX509CELRule("attestation", `attestation.type == "tpm" && attestation.fingerprint != ""`, "")}, &x509.Certificate{}, nil, &CELData{
+			Attestation: map[string]any{"permanentIdentifier": "serial-1234", "fingerprint": "fingerprint", "type": "tpm"},
+		}, nil},
+		{"fail/attestation-type", []CELPolicyOption{WithX509CELRule("attestation", `attestation.type == "tpm"`, "")}, &x509.Certificate{}, nil, &CELData{
+			Attestation: map[string]any{"permanentIdentifier": "serial-1234", "fingerprint": "fingerprint", "type": "apple"},
+		}, &CELPolicyError{Rule: "attestation"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := NewCELPolicyEngine(tt.options...)
+			require.NoError(t, err)
+
+			err = engine.IsX509CertificateAllowed(tt.cert, tt.csr, tt.data)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var pe *CELPolicyError
+			require.True(t, errors.As(err, &pe))
+			assert.Equal(t, tt.wantErr, pe)
+
+			var ee *errs.Error
+			require.True(t, errors.As(err, &ee))
+			assert.Equal(t, http.StatusForbidden, ee.StatusCode())
+		})
+	}
+}
+
+func TestCELPolicyEngine_IsX509CertificateAllowed_evaluationError(t *testing.T) {
+	engine, err := NewCELPolicyEngine(WithX509CELRule("groups", `"admins" in token.groups`, ""))
+	require.NoError(t, err)
+
+	err = engine.IsX509CertificateAllowed(&x509.Certificate{}, nil, nil)
+	var pe *CELPolicyError
+	require.True(t, errors.As(err, &pe))
+	assert.Equal(t, "groups", pe.Rule)
+	assert.Error(t, pe.Err)
+
+	var ee *errs.Error
+	require.True(t, errors.As(err, &ee))
+	assert.Equal(t, http.StatusForbidden, ee.StatusCode())
+
+	var nilEngine *CELPolicyEngine
+	assert.NoError(t, nilEngine.IsX509CertificateAllowed(&x509.Certificate{}, nil, nil))
+}
+
+func TestCELPolicyEngine_IsX509CertificateAllowed_costLimit(t *testing.T) {
+	engine, err := NewCELPolicyEngine(WithX509CELRule("expensive", `lists.range(2000).all(x, lists.range(2000).all(y, x + y >= 0))`, ""))
+	require.NoError(t, err)
+
+	err = engine.IsX509CertificateAllowed(&x509.Certificate{}, nil, nil)
+	var pe *CELPolicyError
+	require.True(t, errors.As(err, &pe))
+	assert.Equal(t, "expensive", pe.Rule)
+	assert.ErrorContains(t, pe.Err, "cost limit exceeded")
+
+	var ee *errs.Error
+	require.True(t, errors.As(err, &ee))
+	assert.Equal(t, http.StatusForbidden, ee.StatusCode())
+}
+
+func TestCELPolicyEngine_IsSSHCertificateAllowed(t *testing.T) {
+	options := []CELPolicyOption{
+		WithX509CELRule("x509-only", "false", ""),
+		WithSSHCELRule("principals", `cert.type == "host" || cert.principals.all(p, p == token.sub)`, "principals must match the subject"),
+		WithSSHCELRule("no-port-forwarding", `!("permit-port-forwarding" in cert.extensions)`, ""),
+		WithSSHCELRule("validity", `cert.validBefore <= cert.validAfter + duration("16h")`, ""),
+	}
+	now := uint64(time.Now().Unix())
+
+	tests := []struct {
+		name    string
+		cert    *ssh.Certificate
+		data    *CELData
+		wantErr *CELPolicyError
+	}{
+		{"ok/user", &ssh.Certificate{
+			CertType:        ssh.UserCert,
+			ValidPrincipals: []string{"jane"},
+			Permissions:     ssh.Permissions{Extensions: map[string]string{"permit-pty": ""}},
+			ValidAfter:      now,
+			ValidBefore:     now + 3600,
+		}, &CELData{Token: map[string]any{"sub": "jane"}}, nil},
+		{"ok/host", &ssh.Certificate{
+			CertType:        ssh.HostCert,
+			ValidPrincipals: []string{"host.example.com"},
+			ValidAfter:      now,
+			ValidBefore:     now + 3600,
+		}, nil, nil},
+		{"fail/principals", &ssh.Certificate{
+			CertType:        ssh.UserCert,
+			ValidPrincipals: []string{"jane", "root"},
+			ValidAfter:      now,
+			ValidBefore:     now + 3600,
+		}, &CELData{Token: map[string]any{"sub": "jane"}}, &CELPolicyError{Rule: "principals", Message: "principals must match the subject"}},
+		{"fail/extensions", &ssh.Certificate{
+			CertType:        ssh.UserCert,
+			ValidPrincipals: []string{"jane"},
+			Permissions:     ssh.Permissions{Extensions: map[string]string{"permit-port-forwarding": ""}},
+			ValidAfter:      now,
+			ValidBefore:     now + 3600,
+		}, &CELData{Token: map[string]any{"sub": "jane"}}, &CELPolicyError{Rule: "no-port-forwarding"}},
+		{"fail/validity-forever", &ssh.Certificate{
+			CertType:        ssh.HostCert,
+			ValidPrincipals: []string{"host.example.com"},
+			ValidAfter:      0,
+			ValidBefore:     ssh.CertTimeInfinity,
+		}, nil, &CELPolicyError{Rule: "validity"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := NewCELPolicyEngine(options...)
+			require.NoError(t, err)
+
+			err = engine.IsSSHCertificateAllowed(tt.cert, tt.data)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var pe *CELPolicyError
+			require.True(t, errors.As(err, &pe))
+			assert.Equal(t, tt.wantErr, pe)
+		})
+	}
+}
+
+func Test_sshTime(t *testing.T) {
+	assert.Equal(t, time.Unix(1700000000, 0).UTC(), sshTime(1700000000))
+	assert.Equal(t, maxCELTime, sshTime(ssh.CertTimeInfinity))
+	assert.Equal(t, maxCELTime, sshTime(math.MaxInt64))
+}
@@ -0,0 +1,162 @@
+package policy
+
+import (
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/url"
+
+	"go.step.sm/crypto/x509util"
+	"golang.org/x/crypto/ssh"
+)
+
+// NamePolicyExplainer is implemented by name policy engines that can explain
+// their decisions. Contrary to the IsXXXAllowed methods, all names are
+// evaluated, so that the outcome for every name is available.
+type NamePolicyExplainer interface {
+	ExplainX509CertificateRequest(csr *x509.CertificateRequest) *Explanation
+	ExplainSANs(sans []string) *Explanation
+	ExplainSSHCertificate(cert *ssh.Certificate) (*Explanation, error)
+}
+
+// RuleType is the type of the rule that decided on a name.
+type RuleType string
+
+const (
+	// AllowRule is the type of rule that explicitly permits a name.
+	AllowRule RuleType = "allow"
+	// DenyRule is the type of rule that excludes a name.
+	DenyRule RuleType = "deny"
+)
+
+// NameExplanation describes the decision made for a single name. When an
+// allow or deny rule matched the name, RuleType and Rule are set; Rule holds
+// the constraint as normalized by the engine, e.g. "*.example.com" becomes
+// ".example.com". Detail describes why a name was not allowed.
+type NameExplanation struct {
+	NameType NameType `json:"type"`
+	Name     string   `json:"name"`
+	Allowed  bool     `json:"allowed"`
+	RuleType RuleType `json:"ruleType,omitempty"`
+	Rule     string   `json:"rule,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// Explanation describes the decisions made for all the names in a request.
+type Explanation struct {
+	Allowed bool              `json:"allowed"`
+	Names   []NameExplanation `json:"names"`
+}
+
+// ExplainX509CertificateRequest explains the decision for every name in the
+// CSR. The Subject Common Name is only included when the engine verifies it.
+func (e *NamePolicyEngine) ExplainX509CertificateRequest(csr *x509.CertificateRequest) *Explanation {
+	exp := e.explainNames(csr.DNSNames, csr.IPAddresses, csr.EmailAddresses, csr.URIs, []string{})
+	if e.verifySubjectCommonName && csr.Subject.CommonName != "" {
+		exp.add(e.explainName(CNNameType, csr.Subject.CommonName, func() (string, error) {
+			return e.checkCommonName(csr.Subject.CommonName)
+		}))
+	}
+	return exp
+}
+
+// ExplainSANs explains the decision for every name in the slice of SANs. The
+// SANs are first split into DNS names, IPs, email addresses and URIs.
+func (e *NamePolicyEngine) ExplainSANs(sans []string) *Explanation {
+	dnsNames, ips, emails, uris := x509util.SplitSANs(sans)
+	return e.explainNames(dnsNames, ips, emails, uris, []string{})
+}
+
+// ExplainSSHCertificate explains the decision for every principal in an SSH
+// certificate. An error is returned if the principals can't be split by type.
+func (e *NamePolicyEngine) ExplainSSHCertificate(cert *ssh.Certificate) (*Explanation, error) {
+	dnsNames, ips, emails, principals, err := splitSSHPrincipals(cert)
+	if err != nil {
+		return nil, err
+	}
+	return e.explainNames(dnsNames, ips, emails, []*url.URL{}, principals), nil
+}
+
+// explainNames explains the decision for all names.
+func (e *NamePolicyEngine) explainNames(dnsNames []string, ips []net.IP, emailAddresses []string, uris []*url.URL, principals []string) *Explanation {
+	exp := &Explanation{
+		Allowed: true,
+		Names:   []NameExplanation{},
+	}
+	for _, dns := range dnsNames {
+		exp.add(e.explainName(DNSNameType, dns, func() (string, error) {
+			return e.checkDNSName(dns)
+		}))
+	}
+	for _, ip := range ips {
+		exp.add(e.explainName(IPNameType, ip.String(), func() (string, error) {
+			return e.checkIP(ip)
+		}))
+	}
+	for _, email := range emailAddresses {
+		exp.add(e.explainName(EmailNameType, email, func() (string, error) {
+			return e.checkEmailAddress(email)
+		}))
+	}
+	for _, uri := range uris {
+		exp.add(e.explainName(URINameType, uri.String(), func() (string, error) {
+			return e.checkURI(uri)
+		}))
+	}
+	for _, principal := range principals {
+		exp.add(e.explainName(PrincipalNameType, principal, func() (string, error) {
+			return e.checkPrincipal(principal)
+		}))
+	}
+	return exp
+}
+
+// explainName runs check for a single name and converts its result into a
+// NameExplanation.
+func (e *NamePolicyEngine) explainName(nameType NameType, name string, check func() (string, error)) NameExplanation {
+	ne := NameExplanation{
+		NameType: nameType,
+		Name:     name,
+	}
+
+	// nothing to compare against; all names are allowed
+	if e.totalNumberOfConstraints == 0 {
+		ne.Allowed = true
+		ne.Detail = "no constraints configured"
+		return ne
+	}
+
+	rule, err := check()
+	if err == nil {
+		ne.Allowed = true
+		if rule != "" {
+			ne.RuleType = AllowRule
+			ne.Rule = rule
+		} else {
+			ne.Detail = "not excluded by any constraint"
+		}
+		return ne
+	}
+
+	// a rule is only returned together with an error when the name
+	// matched an excluded constraint.
+	if rule != "" {
+		ne.RuleType = DenyRule
+		ne.Rule = rule
+	}
+
+	var pe *NamePolicyError
+	if errors.As(err, &pe) {
+		ne.Detail = pe.Detail()
+	} else {
+		ne.Detail = err.Error()
+	}
+
+	return ne
+}
+
+// add appends the explanation of a name and updates the overall decision.
+func (exp *Explanation) add(ne NameExplanation) {
+	exp.Names = append(exp.Names, ne)
+	exp.Allowed = exp.Allowed && ne.Allowed
+}
@@ -0,0 +1,145 @@
+package policy
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestNamePolicyEngine_ExplainSANs(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []NamePolicyOption
+		sans    []string
+		want    *Explanation
+	}{
+		{
+			name: "ok/no-constraints",
+			sans: []string{"www.example.com"},
+			want: &Explanation{Allowed: true, Names: []NameExplanation{
+				{NameType: DNSNameType, Name: "www.example.com", Allowed: true, Detail: "no constraints configured"},
+			}},
+		},
+		{
+			name: "ok/allow-rule",
+			options: []NamePolicyOption{
+				WithPermittedDNSDomains("*.local", "*.example.com"),
+				WithPermittedCIDRs("10.0.0.0/8"),
+			},
+			sans: []string{"www.example.com", "10.1.2.3"},
+			want: &Explanation{Allowed: true, Names: []NameExplanation{
+				{NameType: DNSNameType, Name: "www.example.com", Allowed: true, RuleType: AllowRule, Rule: ".example.com"},
+				{NameType: IPNameType, Name: "10.1.2.3", Allowed: true, RuleType: AllowRule, Rule: "10.0.0.0/8"},
+			}},
+		},
+		{
+			name: "ok/implicit-allow",
+			options: []NamePolicyOption{
+				WithExcludedDNSDomains("*.internal.example.com"),
+			},
+			sans: []string{"www.example.com"},
+			want: &Explanation{Allowed: true, Names: []NameExplanation{
+				{NameType: DNSNameType, Name: "www.example.com", Allowed: true, Detail: "not excluded by any constraint"},
+			}},
+		},
+		{
+			name: "fail/deny-rule",
+			options: []NamePolicyOption{
+				WithPermittedDNSDomains("*.example.com"),
+				WithExcludedDNSDomains("admin.example.com"),
+			},
+			sans: []string{"www.example.com", "admin.example.com"},
+			want: &Explanation{Allowed: false, Names: []NameExplanation{
+				{NameType: DNSNameType, Name: "www.example.com", Allowed: true, RuleType: AllowRule, Rule: ".example.com"},
+				{NameType: DNSNameType, Name: "admin.example.com", Allowed: false, RuleType: DenyRule, Rule: "admin.example.com",
+					Detail: `dns "admin.example.com" is excluded by constraint "admin.example.com"`},
+			}},
+		},
+		{
+			name: "fail/not-permitted",
+			options: []NamePolicyOption{
+				WithPermittedDNSDomains("*.example.com"),
+			},
+			sans: []string{"www.example.org", "mariano@example.com"},
+			want: &Explanation{Allowed: false, Names: []NameExplanation{
+				{NameType: DNSNameType, Name: "www.example.org", Allowed: false, Detail: `dns "www.example.org" is not permitted by any constraint`},
+				{NameType: EmailNameType, Name: "mariano@example.com", Allowed: false, Detail: `email "mariano@example.com" is not explicitly permitted by any constraint`},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := New(tt.options...)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, engine.ExplainSANs(tt.sans))
+		})
+	}
+}
+
+func TestNamePolicyEngine_ExplainX509CertificateRequest(t *testing.T) {
+	csr := &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: "host.example.com"},
+		DNSNames:    []string{"host.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("192.168.1.1")},
+	}
+
+	t.Run("ok/without-common-name", func(t *testing.T) {
+		engine, err := New(WithPermittedDNSDomains("*.example.com"))
+		require.NoError(t, err)
+		assert.Equal(t, &Explanation{Allowed: false, Names: []NameExplanation{
+			{NameType: DNSNameType, Name: "host.example.com", Allowed: true, RuleType: AllowRule, Rule: ".example.com"},
+			{NameType: IPNameType, Name: "192.168.1.1", Allowed: false, Detail: `ip "192.168.1.1" is not explicitly permitted by any constraint`},
+		}}, engine.ExplainX509CertificateRequest(csr))
+	})
+
+	t.Run("ok/with-common-name", func(t *testing.T) {
+		engine, err := New(
+			WithSubjectCommonNameVerification(),
+			WithPermittedDNSDomains("*.example.com"),
+			WithPermittedCIDRs("192.168.0.0/16"),
+			WithExcludedCommonNames("host.example.com"),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, &Explanation{Allowed: true, Names: []NameExplanation{
+			{NameType: DNSNameType, Name: "host.example.com", Allowed: true, RuleType: AllowRule, Rule: ".example.com"},
+			{NameType: IPNameType, Name: "192.168.1.1", Allowed: true, RuleType: AllowRule, Rule: "192.168.0.0/16"},
+			{NameType: CNNameType, Name: "host.example.com", Allowed: true, RuleType: AllowRule, Rule: ".example.com"},
+		}}, engine.ExplainX509CertificateRequest(csr))
+	})
+}
+
+func TestNamePolicyEngine_ExplainSSHCertificate(t *testing.T) {
+	engine, err := New(
+		WithPermittedPrincipals("ops", "dev"),
+		WithPermittedEmailAddresses("@example.com"),
+		WithExcludedPrincipals("root"),
+	)
+	require.NoError(t, err)
+
+	t.Run("ok", func(t *testing.T) {
+		got, err := engine.ExplainSSHCertificate(&ssh.Certificate{
+			CertType:        ssh.UserCert,
+			ValidPrincipals: []string{"ops", "root", "jane@example.com"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, &Explanation{Allowed: false, Names: []NameExplanation{
+			{NameType: EmailNameType, Name: "jane@example.com", Allowed: true, RuleType: AllowRule, Rule: "example.com"},
+			{NameType: PrincipalNameType, Name: "ops", Allowed: true, RuleType: AllowRule, Rule: "ops"},
+			{NameType: PrincipalNameType, Name: "root", Allowed: false, RuleType: DenyRule, Rule: "root",
+				Detail: `principal "root" is excluded by constraint "root"`},
+		}}, got)
+	})
+
+	t.Run("fail/unexpected-principals", func(t *testing.T) {
+		_, err := engine.ExplainSSHCertificate(&ssh.Certificate{
+			CertType:        ssh.UserCert,
+			ValidPrincipals: []string{"10.0.0.1"},
+		})
+		assert.Error(t, err)
+	})
+}
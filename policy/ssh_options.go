@@ -0,0 +1,318 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+const (
+	// ForceCommandOption is the name of the SSH critical option that forces
+	// the execution of a command.
+	ForceCommandOption = "force-command"
+	// SourceAddressOption is the name of the SSH critical option that
+	// restricts the addresses a certificate can be used from.
+	SourceAddressOption = "source-address"
+)
+
+type SSHOptionType string
+
+const (
+	CriticalOptionType SSHOptionType = "critical option"
+	ExtensionType      SSHOptionType = "extension"
+)
+
+type SSHOptionPolicyReason int
+
+const (
+	// OptionNotAllowed results when a critical option or extension
+	// is present in a certificate, but the policy doesn't allow it.
+	OptionNotAllowed SSHOptionPolicyReason = iota + 1
+	// OptionValueNotAllowed results when the value of a critical
+	// option is not allowed by the policy.
+	OptionValueNotAllowed
+	// OptionRequired results when a critical option or extension
+	// required by the policy is not present in a certificate.
+	OptionRequired
+)
+
+type SSHOptionPolicyError struct {
+	Reason     SSHOptionPolicyReason
+	OptionType SSHOptionType
+	Name       string
+	Value      string
+}
+
+func (e *SSHOptionPolicyError) Error() string {
+	switch e.Reason {
+	case OptionNotAllowed:
+		return fmt.Sprintf("%s %q not allowed", e.OptionType, e.Name)
+	case OptionValueNotAllowed:
+		return fmt.Sprintf("%s %q with value %q not allowed", e.OptionType, e.Name, e.Value)
+	case OptionRequired:
+		return fmt.Sprintf("%s %q is required", e.OptionType, e.Name)
+	default:
+		return fmt.Sprintf("unknown error reason (%d) for %s %q", e.Reason, e.OptionType, e.Name)
+	}
+}
+
+// As implements the As(any) bool interface and allows to use "errors.As()" to
+// convert an SSHOptionPolicyError to an errs.Error.
+func (e *SSHOptionPolicyError) As(v any) bool {
+	if err, ok := v.(**errs.Error); ok {
+		*err = &errs.Error{
+			Status: http.StatusForbidden,
+			Msg:    fmt.Sprintf("The request was forbidden by the certificate authority: %s", e.Error()),
+			Err:    e,
+		}
+		return true
+	}
+	return false
+}
+
+// SSHOptionsPolicyEngine evaluates the critical options and extensions
+// of SSH certificates. It implements the SSHNamePolicyEngine interface,
+// so that it can be used next to the name policy engine.
+type SSHOptionsPolicyEngine struct {
+	permittedCriticalOptions []string
+	excludedCriticalOptions  []string
+	requiredCriticalOptions  []string
+	permittedForceCommands   []string
+	permittedSourceAddresses []*net.IPNet
+	permittedExtensions      []string
+	excludedExtensions       []string
+	requiredExtensions       []string
+}
+
+type SSHOptionsPolicyOption func(e *SSHOptionsPolicyEngine) error
+
+// NewSSHOptionsPolicyEngine creates a new SSHOptionsPolicyEngine with
+// SSHOptionsPolicyOptions.
+func NewSSHOptionsPolicyEngine(opts ...SSHOptionsPolicyOption) (*SSHOptionsPolicyEngine, error) {
+	e := &SSHOptionsPolicyEngine{}
+	for _, option := range opts {
+		if err := option(e); err != nil {
+			return nil, err
+		}
+	}
+
+	e.permittedCriticalOptions = removeDuplicates(e.permittedCriticalOptions)
+	e.excludedCriticalOptions = removeDuplicates(e.excludedCriticalOptions)
+	e.requiredCriticalOptions = removeDuplicates(e.requiredCriticalOptions)
+	e.permittedForceCommands = removeDuplicates(e.permittedForceCommands)
+	e.permittedSourceAddresses = removeDuplicateIPNets(e.permittedSourceAddresses)
+	e.permittedExtensions = removeDuplicates(e.permittedExtensions)
+	e.excludedExtensions = removeDuplicates(e.excludedExtensions)
+	e.requiredExtensions = removeDuplicates(e.requiredExtensions)
+
+	return e, nil
+}
+
+func WithPermittedCriticalOptions(names ...string) SSHOptionsPolicyOption {
+	return func(e *SSHOptionsPolicyEngine) error {
+		if err := validateSSHOptionNames(CriticalOptionType, names); err != nil {
+			return err
+		}
+		e.permittedCriticalOptions = names
+		return nil
+	}
+}
+
+func WithExcludedCriticalOptions(names ...string) SSHOptionsPolicyOption {
+	return func(e *SSHOptionsPolicyEngine) error {
+		if err := validateSSHOptionNames(CriticalOptionType, names); err != nil {
+			return err
+		}
+		e.excludedCriticalOptions = names
+		return nil
+	}
+}
+
+func WithRequiredCriticalOptions(names ...string) SSHOptionsPolicyOption {
+	return func(e *SSHOptionsPolicyEngine) error {
+		if err := validateSSHOptionNames(CriticalOptionType, names); err != nil {
+			return err
+		}
+		e.requiredCriticalOptions = names
+		return nil
+	}
+}
+
+func WithPermittedForceCommands(commands ...string) SSHOptionsPolicyOption {
+	return func(e *SSHOptionsPolicyEngine) error {
+		for _, command := range commands {
+			if command == "" {
+				return errors.New("cannot parse permitted force-command: command cannot be empty")
+			}
+		}
+		e.permittedForceCommands = commands
+		return nil
+	}
+}
+
+func WithPermittedSourceAddresses(ipsOrCIDRs ...string) SSHOptionsPolicyOption {
+	return func(e *SSHOptionsPolicyEngine) error {
+		networks := make([]*net.IPNet, len(ipsOrCIDRs))
+		for i, ipOrCIDR := range ipsOrCIDRs {
+			nw, err := parseIPOrCIDR(ipOrCIDR)
+			if err != nil {
+				return fmt.Errorf("cannot parse permitted source-address constraint %q as IP nor CIDR", ipOrCIDR)
+			}
+			networks[i] = nw
+		}
+		e.permittedSourceAddresses = networks
+		return nil
+	}
+}
+
+func WithPermittedExtensions(names ...string) SSHOptionsPolicyOption {
+	return func(e *SSHOptionsPolicyEngine) error {
+		if err := validateSSHOptionNames(ExtensionType, names); err != nil {
+			return err
+		}
+		e.permittedExtensions = names
+		return nil
+	}
+}
+
+func WithExcludedExtensions(names ...string) SSHOptionsPolicyOption {
+	return func(e *SSHOptionsPolicyEngine) error {
+		if err := validateSSHOptionNames(ExtensionType, names); err != nil {
+			return err
+		}
+		e.excludedExtensions = names
+		return nil
+	}
+}
+
+func WithRequiredExtensions(names ...string) SSHOptionsPolicyOption {
+	return func(e *SSHOptionsPolicyEngine) error {
+		if err := validateSSHOptionNames(ExtensionType, names); err != nil {
+			return err
+		}
+		e.requiredExtensions = names
+		return nil
+	}
+}
+
+// IsSSHCertificateAllowed verifies that the critical options and extensions
+// in an SSH certificate are allowed.
+func (e *SSHOptionsPolicyEngine) IsSSHCertificateAllowed(cert *ssh.Certificate) error {
+	if err := validateSSHOptions(CriticalOptionType, cert.CriticalOptions,
+		e.permittedCriticalOptions, e.excludedCriticalOptions, e.requiredCriticalOptions); err != nil {
+		return err
+	}
+
+	if cmd, ok := cert.CriticalOptions[ForceCommandOption]; ok && len(e.permittedForceCommands) > 0 {
+		if !slices.Contains(e.permittedForceCommands, cmd) {
+			return &SSHOptionPolicyError{
+				Reason:     OptionValueNotAllowed,
+				OptionType: CriticalOptionType,
+				Name:       ForceCommandOption,
+				Value:      cmd,
+			}
+		}
+	}
+
+	if addrs, ok := cert.CriticalOptions[SourceAddressOption]; ok && len(e.permittedSourceAddresses) > 0 {
+		if !e.areSourceAddressesAllowed(addrs) {
+			return &SSHOptionPolicyError{
+				Reason:     OptionValueNotAllowed,
+				OptionType: CriticalOptionType,
+				Name:       SourceAddressOption,
+				Value:      addrs,
+			}
+		}
+	}
+
+	return validateSSHOptions(ExtensionType, cert.Extensions,
+		e.permittedExtensions, e.excludedExtensions, e.requiredExtensions)
+}
+
+// areSourceAddressesAllowed checks that every address in the comma separated
+// source-address list is contained in one of the permitted ranges.
+func (e *SSHOptionsPolicyEngine) areSourceAddressesAllowed(addrs string) bool {
+	for _, addr := range strings.Split(addrs, ",") {
+		nw, err := parseIPOrCIDR(strings.TrimSpace(addr))
+		if err != nil {
+			return false
+		}
+		if !slices.ContainsFunc(e.permittedSourceAddresses, func(constraint *net.IPNet) bool {
+			return containsIPNet(constraint, nw)
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateSSHOptions checks the names of the options against the permitted,
+// excluded and required names. Required names are always permitted.
+func validateSSHOptions(typ SSHOptionType, options map[string]string, permitted, excluded, required []string) error {
+	// sort the names, so that errors are deterministic
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if slices.Contains(excluded, name) ||
+			(len(permitted) > 0 && !slices.Contains(permitted, name) && !slices.Contains(required, name)) {
+			return &SSHOptionPolicyError{
+				Reason:     OptionNotAllowed,
+				OptionType: typ,
+				Name:       name,
+			}
+		}
+	}
+
+	for _, name := range required {
+		if _, ok := options[name]; !ok {
+			return &SSHOptionPolicyError{
+				Reason:     OptionRequired,
+				OptionType: typ,
+				Name:       name,
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateSSHOptionNames(typ SSHOptionType, names []string) error {
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, " \t\r\n") {
+			return fmt.Errorf("cannot parse %s constraint %q", typ, name)
+		}
+	}
+	return nil
+}
+
+func parseIPOrCIDR(ipOrCIDR string) (*net.IPNet, error) {
+	if _, nw, err := net.ParseCIDR(ipOrCIDR); err == nil {
+		return nw, nil
+	}
+	if ip := net.ParseIP(ipOrCIDR); ip != nil {
+		return networkFor(ip), nil
+	}
+	return nil, fmt.Errorf("cannot parse %q as IP nor CIDR", ipOrCIDR)
+}
+
+// containsIPNet returns true if the network nw is fully contained in the
+// network constraint.
+func containsIPNet(constraint, nw *net.IPNet) bool {
+	if isIPv4(constraint.IP) != isIPv4(nw.IP) {
+		return false
+	}
+	constraintOnes, _ := constraint.Mask.Size()
+	ones, _ := nw.Mask.Size()
+	return ones >= constraintOnes && constraint.Contains(nw.IP)
+}
@@ -0,0 +1,264 @@
+package policy
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+func TestNewSSHOptionsPolicyEngine(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []SSHOptionsPolicyOption
+		wantErr bool
+	}{
+		{"ok", []SSHOptionsPolicyOption{
+			WithPermittedCriticalOptions("force-command", "source-address"),
+			WithExcludedCriticalOptions("verify-required"),
+			WithRequiredCriticalOptions("source-address"),
+			WithPermittedForceCommands("/usr/bin/backup"),
+			WithPermittedSourceAddresses("10.0.0.0/8", "192.168.1.1", "2001:db8::/32"),
+			WithPermittedExtensions("permit-pty"),
+			WithExcludedExtensions("permit-port-forwarding"),
+			WithRequiredExtensions("permit-pty"),
+		}, false},
+		{"ok/empty", nil, false},
+		{"fail/critical-option-name", []SSHOptionsPolicyOption{WithPermittedCriticalOptions("")}, true},
+		{"fail/extension-name", []SSHOptionsPolicyOption{WithExcludedExtensions("permit pty")}, true},
+		{"fail/force-command", []SSHOptionsPolicyOption{WithPermittedForceCommands("")}, true},
+		{"fail/source-address", []SSHOptionsPolicyOption{WithPermittedSourceAddresses("10.0.0.0/33")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewSSHOptionsPolicyEngine(tt.options...)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, got)
+		})
+	}
+}
+
+func TestSSHOptionsPolicyEngine_IsSSHCertificateAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []SSHOptionsPolicyOption
+		cert    *ssh.Certificate
+		wantErr *SSHOptionPolicyError
+	}{
+		{
+			name:    "ok/no-policy",
+			options: nil,
+			cert: &ssh.Certificate{
+				Permissions: ssh.Permissions{
+					CriticalOptions: map[string]string{"force-command": "/bin/sh"},
+					Extensions:      map[string]string{"permit-pty": ""},
+				},
+			},
+		},
+		{
+			name:    "ok/permitted-critical-option",
+			options: []SSHOptionsPolicyOption{WithPermittedCriticalOptions("force-command")},
+			cert: &ssh.Certificate{
+				Permissions: ssh.Permissions{
+					CriticalOptions: map[string]string{"force-command": "/bin/sh"},
+				},
+			},
+		},
+		{
+			name: "ok/required-critical-option-is-permitted",
+			options: []SSHOptionsPolicyOption{
+				WithPermittedCriticalOptions("force-command"),
+				WithRequiredCriticalOptions("verify-required"),
+			},
+			cert: &ssh.Certificate{
+				Permissions: ssh.Permissions{
+					CriticalOptions: map[string]string{"verify-required": ""},
+				},
+			},
+		},
+		{
+			name:    "ok/permitted-force-command",
+			options: []SSHOptionsPolicyOption{WithPermittedForceCommands("/usr/bin/backup", "/usr/bin/restore")},
+			cert: &ssh.Certificate{
+				Permissions: ssh.Permissions{
+					CriticalOptions: map[string]string{"force-command": "/usr/bin/restore"},
+				},
+			},
+		},
+		{
+			name:    "ok/permitted-source-address",
+			options: []SSHOptionsPolicyOption{WithPermittedSourceAddresses("10.0.0.0/8", "2001:db8::/32")},
+			cert: &ssh.Certificate{
+				Permissions: ssh.Permissions{
+					CriticalOptions: map[string]string{"source-address": "10.1.2.3, 10.2.0.0/16,2001:db8::1"},
+				},
+			},
+		},
+		{
+			name:    "ok/source-address-not-set",
+			options: []SSHOptionsPolicyOption{WithPermittedSourceAddresses("10.0.0.0/8")},
+			cert:    &ssh.Certificate{},
+		},
+		{
+			name: "ok/extensions",
+			options: []SSHOptionsPolicyOption{
+				WithPermittedExtensions("permit-pty", "permit-agent-forwarding"),
+				WithExcludedExtensions("permit-port-forwarding"),
+				WithRequiredExtensions("permit-pty"),
+			},
+			cert: &ssh.Certificate{
+				Permissions: ssh.Permissions{
+					Extensions: map[string]string{"permit-pty": "", "permit-agent-forwarding": ""},
+				},
+			},
+		},
+		{
+			name:    "fail/critical-option-not-permitted",
+			options: []SSHOptionsPolicyOption{WithPermittedCriticalOptions("source-address")},
+			cert: &ssh.Certificate{
+				Permissions: ssh.Permissions{
+					CriticalOptions: map[string]string{"force-command": "/bin/sh"},
+				},
+			},
+			wantErr: &SSHOptionPolicyError{Reason: OptionNotAllowed, OptionType: CriticalOptionType, Name: "force-command"},
+		},
+		{
+			name:    "fail/critical-option-excluded",
+			options: []SSHOptionsPolicyOption{WithExcludedCriticalOptions("force-command")},
+			cert: &ssh.Certificate{
+				Permissions: ssh.Permissions{
+					CriticalOptions: map[string]string{"force-command": "/bin/sh"},
+				},
+			},
+			wantErr: &SSHOptionPolicyError{Reason: OptionNotAllowed, OptionType: CriticalOptionType, Name: "force-command"},
+		},
+		{
+			name:    "fail/critical-option-required",
+			options: []SSHOptionsPolicyOption{WithRequiredCriticalOptions("verify-required")},
+			cert:    &ssh.Certificate{},
+			wantErr: &SSHOptionPolicyError{Reason: OptionRequired, OptionType: CriticalOptionType, Name: "verify-required"},
+		},
+		{
+			name:    "fail/force-command",
+			options: []SSHOptionsPolicyOption{WithPermittedForceCommands("/usr/bin/backup")},
+			cert: &ssh.Certificate{
+				Permissions: ssh.Permissions{
+					CriticalOptions: map[string]string{"force-command": "/bin/sh"},
+				},
+			},
+			wantErr: &SSHOptionPolicyError{Reason: OptionValueNotAllowed, OptionType: CriticalOptionType, Name: "force-command", Value: "/bin/sh"},
+		},
+		{
+			name:    "fail/source-address-outside-range",
+			options: []SSHOptionsPolicyOption{WithPermittedSourceAddresses("10.0.0.0/8")},
+			cert: &ssh.Certificate{
+				Permissions: ssh.Permissions{
+					CriticalOptions: map[string]string{"source-address": "10.0.0.1,192.168.0.1"},
+				},
+			},
+			wantErr: &SSHOptionPolicyError{Reason: OptionValueNotAllowed, OptionType: CriticalOptionType, Name: "source-address", Value: "10.0.0.1,192.168.0.1"},
+		},
+		{
+			name:    "fail/source-address-wider-range",
+			options: []SSHOptionsPolicyOption{WithPermittedSourceAddresses("10.0.0.0/16")},
+			cert: &ssh.Certificate{
+				Permissions: ssh.Permissions{
+					CriticalOptions: map[string]string{"source-address": "10.0.0.0/8"},
+				},
+			},
+			wantErr: &SSHOptionPolicyError{Reason: OptionValueNotAllowed, OptionType: CriticalOptionType, Name: "source-address", Value: "10.0.0.0/8"},
+		},
+		{
+			name:    "fail/source-address-ip-family",
+			options: []SSHOptionsPolicyOption{WithPermittedSourceAddresses("::/0")},
+			cert: &ssh.Certificate{
+				Permissions: ssh.Permissions{
+					CriticalOptions: map[string]string{"source-address": "10.0.0.1"},
+				},
+			},
+			wantErr: &SSHOptionPolicyError{Reason: OptionValueNotAllowed, OptionType: CriticalOptionType, Name: "source-address", Value: "10.0.0.1"},
+		},
+		{
+			name:    "fail/source-address-invalid",
+			options: []SSHOptionsPolicyOption{WithPermittedSourceAddresses("10.0.0.0/8")},
+			cert: &ssh.Certificate{
+				Permissions: ssh.Permissions{
+					CriticalOptions: map[string]string{"source-address": "localhost"},
+				},
+			},
+			wantErr: &SSHOptionPolicyError{Reason: OptionValueNotAllowed, OptionType: CriticalOptionType, Name: "source-address", Value: "localhost"},
+		},
+		{
+			name:    "fail/extension-not-permitted",
+			options: []SSHOptionsPolicyOption{WithPermittedExtensions("permit-pty")},
+			cert: &ssh.Certificate{
+				Permissions: ssh.Permissions{
+					Extensions: map[string]string{"permit-pty": "", "permit-port-forwarding": ""},
+				},
+			},
+			wantErr: &SSHOptionPolicyError{Reason: OptionNotAllowed, OptionType: ExtensionType, Name: "permit-port-forwarding"},
+		},
+		{
+			name:    "fail/extension-excluded",
+			options: []SSHOptionsPolicyOption{WithExcludedExtensions("permit-agent-forwarding")},
+			cert: &ssh.Certificate{
+				Permissions: ssh.Permissions{
+					Extensions: map[string]string{"permit-agent-forwarding": ""},
+				},
+			},
+			wantErr: &SSHOptionPolicyError{Reason: OptionNotAllowed, OptionType: ExtensionType, Name: "permit-agent-forwarding"},
+		},
+		{
+			name:    "fail/extension-required",
+			options: []SSHOptionsPolicyOption{WithRequiredExtensions("permit-pty")},
+			cert:    &ssh.Certificate{},
+			wantErr: &SSHOptionPolicyError{Reason: OptionRequired, OptionType: ExtensionType, Name: "permit-pty"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := NewSSHOptionsPolicyEngine(tt.options...)
+			require.NoError(t, err)
+			gotErr := engine.IsSSHCertificateAllowed(tt.cert)
+			if tt.wantErr == nil {
+				assert.NoError(t, gotErr)
+				return
+			}
+			var ope *SSHOptionPolicyError
+			require.True(t, errors.As(gotErr, &ope))
+			assert.Equal(t, tt.wantErr, ope)
+
+			var ee *errs.Error
+			require.True(t, errors.As(gotErr, &ee))
+			assert.Equal(t, http.StatusForbidden, ee.StatusCode())
+		})
+	}
+}
+
+func TestSSHOptionPolicyError_Error(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *SSHOptionPolicyError
+		want string
+	}{
+		{"not-allowed", &SSHOptionPolicyError{Reason: OptionNotAllowed, OptionType: ExtensionType, Name: "permit-pty"}, `extension "permit-pty" not allowed`},
+		{"value-not-allowed", &SSHOptionPolicyError{Reason: OptionValueNotAllowed, OptionType: CriticalOptionType, Name: "force-command", Value: "/bin/sh"}, `critical option "force-command" with value "/bin/sh" not allowed`},
+		{"required", &SSHOptionPolicyError{Reason: OptionRequired, OptionType: CriticalOptionType, Name: "verify-required"}, `critical option "verify-required" is required`},
+		{"unknown", &SSHOptionPolicyError{Reason: -1, OptionType: ExtensionType, Name: "permit-pty"}, `unknown error reason (-1) for extension "permit-pty"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.err.Error())
+		})
+	}
+}
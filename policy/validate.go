@@ -35,104 +35,19 @@ func (e *NamePolicyEngine) validateNames(dnsNames []string, ips []net.IP, emailA
 	// TODO: gather all errors, or return early? Currently we return early on the first wrong name; check might fail for multiple names.
 	// Perhaps make that an option?
 	for _, dns := range dnsNames {
-		// if there are DNS names to check, no DNS constraints set, but there are other permitted constraints,
-		// then return error, because DNS should be explicitly configured to be allowed in that case. In case there are
-		// (other) excluded constraints, we'll allow a DNS (implicit allow; currently).
-		if e.numberOfDNSDomainConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
-			return &NamePolicyError{
-				Reason:   NotAllowed,
-				NameType: DNSNameType,
-				Name:     dns,
-				detail:   fmt.Sprintf("dns %q is not explicitly permitted by any constraint", dns),
-			}
-		}
-		didCutWildcard := false
-		parsedDNS := dns
-		if strings.HasPrefix(parsedDNS, "*.") {
-			parsedDNS = parsedDNS[1:]
-			didCutWildcard = true
-		}
-		// TODO(hs): fix this above; we need separate rule for Subject Common Name?
-		parsedDNS, err := idna.Lookup.ToASCII(parsedDNS)
-		if err != nil {
-			return &NamePolicyError{
-				Reason:   CannotParseDomain,
-				NameType: DNSNameType,
-				Name:     dns,
-				detail:   fmt.Sprintf("dns %q cannot be converted to ASCII", dns),
-			}
-		}
-		if didCutWildcard {
-			parsedDNS = "*" + parsedDNS
-		}
-		if _, ok := domainToReverseLabels(parsedDNS); !ok { // TODO(hs): this also fails with spaces
-			return &NamePolicyError{
-				Reason:   CannotParseDomain,
-				NameType: DNSNameType,
-				Name:     dns,
-				detail:   fmt.Sprintf("cannot parse dns %q", dns),
-			}
-		}
-		if err := checkNameConstraints(DNSNameType, dns, parsedDNS,
-			func(parsedName, constraint interface{}) (bool, error) {
-				return e.matchDomainConstraint(parsedName.(string), constraint.(string))
-			}, e.permittedDNSDomains, e.excludedDNSDomains); err != nil {
+		if _, err := e.checkDNSName(dns); err != nil {
 			return err
 		}
 	}
 
 	for _, ip := range ips {
-		if e.numberOfIPRangeConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
-			return &NamePolicyError{
-				Reason:   NotAllowed,
-				NameType: IPNameType,
-				Name:     ip.String(),
-				detail:   fmt.Sprintf("ip %q is not explicitly permitted by any constraint", ip.String()),
-			}
-		}
-		if err := checkNameConstraints(IPNameType, ip.String(), ip,
-			func(parsedName, constraint interface{}) (bool, error) {
-				return matchIPConstraint(parsedName.(net.IP), constraint.(*net.IPNet))
-			}, e.permittedIPRanges, e.excludedIPRanges); err != nil {
+		if _, err := e.checkIP(ip); err != nil {
 			return err
 		}
 	}
 
 	for _, email := range emailAddresses {
-		if e.numberOfEmailAddressConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
-			return &NamePolicyError{
-				Reason:   NotAllowed,
-				NameType: EmailNameType,
-				Name:     email,
-				detail:   fmt.Sprintf("email %q is not explicitly permitted by any constraint", email),
-			}
-		}
-		mailbox, ok := parseRFC2821Mailbox(email)
-		if !ok {
-			return &NamePolicyError{
-				Reason:   CannotParseRFC822Name,
-				NameType: EmailNameType,
-				Name:     email,
-				detail:   fmt.Sprintf("invalid rfc822Name %q", mailbox),
-			}
-		}
-		// According to RFC 5280, section 7.5, emails are considered to match if the local part is
-		// an exact match and the host (domain) part matches the ASCII representation (case-insensitive):
-		// https://datatracker.ietf.org/doc/html/rfc5280#section-7.5
-		domainASCII, err := idna.ToASCII(mailbox.domain)
-		if err != nil {
-			return &NamePolicyError{
-				Reason:   CannotParseDomain,
-				NameType: EmailNameType,
-				Name:     email,
-				detail:   fmt.Errorf("cannot parse email domain %q: %w", email, err).Error(),
-			}
-		}
-		mailbox.domain = domainASCII
-		if err := checkNameConstraints(EmailNameType, email, mailbox,
-			func(parsedName, constraint interface{}) (bool, error) {
-				return e.matchEmailConstraint(parsedName.(rfc2821Mailbox), constraint.(string))
-			}, e.permittedEmailAddresses, e.excludedEmailAddresses); err != nil {
+		if _, err := e.checkEmailAddress(email); err != nil {
 			return err
 		}
 	}
@@ -140,38 +55,13 @@ func (e *NamePolicyEngine) validateNames(dnsNames []string, ips []net.IP, emailA
 	// TODO(hs): fix internationalization for URIs (IRIs)
 
 	for _, uri := range uris {
-		if e.numberOfURIDomainConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
-			return &NamePolicyError{
-				Reason:   NotAllowed,
-				NameType: URINameType,
-				Name:     uri.String(),
-				detail:   fmt.Sprintf("uri %q is not explicitly permitted by any constraint", uri.String()),
-			}
-		}
-		// TODO(hs): ideally we'd like the uri.String() to be the original contents; now
-		// it's transformed into ASCII. Prevent that here?
-		if err := checkNameConstraints(URINameType, uri.String(), uri,
-			func(parsedName, constraint interface{}) (bool, error) {
-				return e.matchURIConstraint(parsedName.(*url.URL), constraint.(string))
-			}, e.permittedURIDomains, e.excludedURIDomains); err != nil {
+		if _, err := e.checkURI(uri); err != nil {
 			return err
 		}
 	}
 
 	for _, principal := range principals {
-		if e.numberOfPrincipalConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
-			return &NamePolicyError{
-				Reason:   NotAllowed,
-				NameType: PrincipalNameType,
-				Name:     principal,
-				detail:   fmt.Sprintf("username principal %q is not explicitly permitted by any constraint", principal),
-			}
-		}
-		// TODO: some validation? I.e. allowed characters?
-		if err := checkNameConstraints(PrincipalNameType, principal, principal,
-			func(parsedName, constraint interface{}) (bool, error) {
-				return matchPrincipalConstraint(parsedName.(string), constraint.(string))
-			}, e.permittedPrincipals, e.excludedPrincipals); err != nil {
+		if _, err := e.checkPrincipal(principal); err != nil {
 			return err
 		}
 	}
@@ -180,6 +70,146 @@ func (e *NamePolicyEngine) validateNames(dnsNames []string, ips []net.IP, emailA
 	return nil
 }
 
+// checkDNSName verifies that a DNS name is allowed. It returns the constraint
+// that matched the name, if any.
+func (e *NamePolicyEngine) checkDNSName(dns string) (string, error) {
+	// if there are DNS names to check, no DNS constraints set, but there are other permitted constraints,
+	// then return error, because DNS should be explicitly configured to be allowed in that case. In case there are
+	// (other) excluded constraints, we'll allow a DNS (implicit allow; currently).
+	if e.numberOfDNSDomainConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
+		return "", &NamePolicyError{
+			Reason:   NotAllowed,
+			NameType: DNSNameType,
+			Name:     dns,
+			detail:   fmt.Sprintf("dns %q is not explicitly permitted by any constraint", dns),
+		}
+	}
+	didCutWildcard := false
+	parsedDNS := dns
+	if strings.HasPrefix(parsedDNS, "*.") {
+		parsedDNS = parsedDNS[1:]
+		didCutWildcard = true
+	}
+	// TODO(hs): fix this above; we need separate rule for Subject Common Name?
+	parsedDNS, err := idna.Lookup.ToASCII(parsedDNS)
+	if err != nil {
+		return "", &NamePolicyError{
+			Reason:   CannotParseDomain,
+			NameType: DNSNameType,
+			Name:     dns,
+			detail:   fmt.Sprintf("dns %q cannot be converted to ASCII", dns),
+		}
+	}
+	if didCutWildcard {
+		parsedDNS = "*" + parsedDNS
+	}
+	if _, ok := domainToReverseLabels(parsedDNS); !ok { // TODO(hs): this also fails with spaces
+		return "", &NamePolicyError{
+			Reason:   CannotParseDomain,
+			NameType: DNSNameType,
+			Name:     dns,
+			detail:   fmt.Sprintf("cannot parse dns %q", dns),
+		}
+	}
+	return checkNameConstraints(DNSNameType, dns, parsedDNS,
+		func(parsedName, constraint interface{}) (bool, error) {
+			return e.matchDomainConstraint(parsedName.(string), constraint.(string))
+		}, e.permittedDNSDomains, e.excludedDNSDomains)
+}
+
+// checkIP verifies that an IP address is allowed. It returns the constraint
+// that matched the IP, if any.
+func (e *NamePolicyEngine) checkIP(ip net.IP) (string, error) {
+	if e.numberOfIPRangeConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
+		return "", &NamePolicyError{
+			Reason:   NotAllowed,
+			NameType: IPNameType,
+			Name:     ip.String(),
+			detail:   fmt.Sprintf("ip %q is not explicitly permitted by any constraint", ip.String()),
+		}
+	}
+	return checkNameConstraints(IPNameType, ip.String(), ip,
+		func(parsedName, constraint interface{}) (bool, error) {
+			return matchIPConstraint(parsedName.(net.IP), constraint.(*net.IPNet))
+		}, e.permittedIPRanges, e.excludedIPRanges)
+}
+
+// checkEmailAddress verifies that an email address is allowed. It returns the
+// constraint that matched the email address, if any.
+func (e *NamePolicyEngine) checkEmailAddress(email string) (string, error) {
+	if e.numberOfEmailAddressConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
+		return "", &NamePolicyError{
+			Reason:   NotAllowed,
+			NameType: EmailNameType,
+			Name:     email,
+			detail:   fmt.Sprintf("email %q is not explicitly permitted by any constraint", email),
+		}
+	}
+	mailbox, ok := parseRFC2821Mailbox(email)
+	if !ok {
+		return "", &NamePolicyError{
+			Reason:   CannotParseRFC822Name,
+			NameType: EmailNameType,
+			Name:     email,
+			detail:   fmt.Sprintf("invalid rfc822Name %q", mailbox),
+		}
+	}
+	// According to RFC 5280, section 7.5, emails are considered to match if the local part is
+	// an exact match and the host (domain) part matches the ASCII representation (case-insensitive):
+	// https://datatracker.ietf.org/doc/html/rfc5280#section-7.5
+	domainASCII, err := idna.ToASCII(mailbox.domain)
+	if err != nil {
+		return "", &NamePolicyError{
+			Reason:   CannotParseDomain,
+			NameType: EmailNameType,
+			Name:     email,
+			detail:   fmt.Errorf("cannot parse email domain %q: %w", email, err).Error(),
+		}
+	}
+	mailbox.domain = domainASCII
+	return checkNameConstraints(EmailNameType, email, mailbox,
+		func(parsedName, constraint interface{}) (bool, error) {
+			return e.matchEmailConstraint(parsedName.(rfc2821Mailbox), constraint.(string))
+		}, e.permittedEmailAddresses, e.excludedEmailAddresses)
+}
+
+// checkURI verifies that a URI is allowed. It returns the constraint that
+// matched the URI, if any.
+func (e *NamePolicyEngine) checkURI(uri *url.URL) (string, error) {
+	if e.numberOfURIDomainConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
+		return "", &NamePolicyError{
+			Reason:   NotAllowed,
+			NameType: URINameType,
+			Name:     uri.String(),
+			detail:   fmt.Sprintf("uri %q is not explicitly permitted by any constraint", uri.String()),
+		}
+	}
+	// TODO(hs): ideally we'd like the uri.String() to be the original contents; now
+	// it's transformed into ASCII. Prevent that here?
+	return checkNameConstraints(URINameType, uri.String(), uri,
+		func(parsedName, constraint interface{}) (bool, error) {
+			return e.matchURIConstraint(parsedName.(*url.URL), constraint.(string))
+		}, e.permittedURIDomains, e.excludedURIDomains)
+}
+
+// checkPrincipal verifies that a username principal is allowed. It returns
+// the constraint that matched the principal, if any.
+func (e *NamePolicyEngine) checkPrincipal(principal string) (string, error) {
+	if e.numberOfPrincipalConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
+		return "", &NamePolicyError{
+			Reason:   NotAllowed,
+			NameType: PrincipalNameType,
+			Name:     principal,
+			detail:   fmt.Sprintf("username principal %q is not explicitly permitted by any constraint", principal),
+		}
+	}
+	// TODO: some validation? I.e. allowed characters?
+	return checkNameConstraints(PrincipalNameType, principal, principal,
+		func(parsedName, constraint interface{}) (bool, error) {
+			return matchPrincipalConstraint(parsedName.(string), constraint.(string))
+		}, e.permittedPrincipals, e.excludedPrincipals)
+}
+
 // validateCommonName verifies that the Subject Common Name is allowed
 func (e *NamePolicyEngine) validateCommonName(commonName string) error {
 	// nothing to compare against; return early
@@ -192,24 +222,43 @@ func (e *NamePolicyEngine) validateCommonName(commonName string) error {
 		return nil
 	}
 
+	_, err := e.checkCommonName(commonName)
+	return err
+}
+
+// checkCommonName verifies that a non-empty Subject Common Name is allowed. It
+// returns the constraint that matched the Common Name, if any.
+func (e *NamePolicyEngine) checkCommonName(commonName string) (string, error) {
 	if e.numberOfCommonNameConstraints > 0 {
 		// Check the Common Name using its dedicated matcher if constraints have been
 		// configured. If no error is returned from matching, the Common Name was
-		// explicitly allowed and nil is returned immediately.
-		if err := checkNameConstraints(CNNameType, commonName, commonName,
+		// explicitly allowed and the constraint is returned immediately.
+		if constraint, err := checkNameConstraints(CNNameType, commonName, commonName,
 			func(parsedName, constraint interface{}) (bool, error) {
 				return matchCommonNameConstraint(parsedName.(string), constraint.(string))
 			}, e.permittedCommonNames, e.excludedCommonNames); err == nil {
-			return nil
+			return constraint, nil
 		}
 	}
 
 	// When an error was returned or when no constraints were configured for Common Names,
 	// the Common Name should be validated against the other types of constraints too,
 	// according to what type it is.
+	var (
+		constraint string
+		err        error
+	)
 	dnsNames, ips, emails, uris := x509util.SplitSANs([]string{commonName})
-
-	err := e.validateNames(dnsNames, ips, emails, uris, []string{})
+	switch {
+	case len(dnsNames) > 0:
+		constraint, err = e.checkDNSName(dnsNames[0])
+	case len(ips) > 0:
+		constraint, err = e.checkIP(ips[0])
+	case len(emails) > 0:
+		constraint, err = e.checkEmailAddress(emails[0])
+	case len(uris) > 0:
+		constraint, err = e.checkURI(uris[0])
+	}
 
 	var pe *NamePolicyError
 	if errors.As(err, &pe) {
@@ -217,25 +266,26 @@ func (e *NamePolicyEngine) validateCommonName(commonName string) error {
 		pe.NameType = CNNameType
 	}
 
-	return err
+	return constraint, err
 }
 
 // checkNameConstraints checks that a name, of type nameType is permitted.
 // The argument parsedName contains the parsed form of name, suitable for passing
-// to the match function.
+// to the match function. The constraint that matched the name is returned, so
+// that it can be reported when explaining a policy decision.
 func checkNameConstraints(
 	nameType NameType,
 	name string,
 	parsedName interface{},
 	match func(parsedName, constraint interface{}) (match bool, err error),
-	permitted, excluded interface{}) error {
+	permitted, excluded interface{}) (string, error) {
 	excludedValue := reflect.ValueOf(excluded)
 
 	for i := 0; i < excludedValue.Len(); i++ {
 		constraint := excludedValue.Index(i).Interface()
 		match, err := match(parsedName, constraint)
 		if err != nil {
-			return &NamePolicyError{
+			return "", &NamePolicyError{
 				Reason:   CannotMatchNameToConstraint,
 				NameType: nameType,
 				Name:     name,
@@ -244,7 +294,7 @@ func checkNameConstraints(
 		}
 
 		if match {
-			return &NamePolicyError{
+			return fmt.Sprint(constraint), &NamePolicyError{
 				Reason:   NotAllowed,
 				NameType: nameType,
 				Name:     name,
@@ -260,7 +310,7 @@ func checkNameConstraints(
 		constraint := permittedValue.Index(i).Interface()
 		var err error
 		if ok, err = match(parsedName, constraint); err != nil {
-			return &NamePolicyError{
+			return "", &NamePolicyError{
 				Reason:   CannotMatchNameToConstraint,
 				NameType: nameType,
 				Name:     name,
@@ -269,12 +319,12 @@ func checkNameConstraints(
 		}
 
 		if ok {
-			break
+			return fmt.Sprint(constraint), nil
 		}
 	}
 
 	if !ok {
-		return &NamePolicyError{
+		return "", &NamePolicyError{
 			Reason:   NotAllowed,
 			NameType: nameType,
 			Name:     name,
@@ -282,7 +332,7 @@ func checkNameConstraints(
 		}
 	}
 
-	return nil
+	return "", nil
 }
 
 // domainToReverseLabels converts a textual domain name like foo.example.com to
@@ -13,7 +13,6 @@ import (
 	"strings"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/smallstep/pkcs7"
 	smallscep "github.com/smallstep/scep"
 
 	"github.com/smallstep/certificates/api"
@@ -24,11 +23,10 @@ import (
 )
 
 const (
-	opnGetCACert    = "GetCACert"
-	opnGetCACaps    = "GetCACaps"
-	opnPKIOperation = "PKIOperation"
-
-	// TODO: add other (more optional) operations and handling
+	opnGetCACert     = "GetCACert"
+	opnGetCACaps     = "GetCACaps"
+	opnGetNextCACert = "GetNextCACert"
+	opnPKIOperation  = "PKIOperation"
 )
 
 const maxPayloadSize = 2 << 20
@@ -109,6 +107,8 @@ func Get(w http.ResponseWriter, r *http.Request) {
 		res, err = GetCACert(ctx)
 	case opnGetCACaps:
 		res, err = GetCACaps(ctx)
+	case opnGetNextCACert:
+		res, err = GetNextCACert(ctx)
 	case opnPKIOperation:
 		res, err = PKIOperation(ctx, req)
 	default:
@@ -164,7 +164,7 @@ func decodeRequest(r *http.Request) (request, error) {
 	switch method {
 	case http.MethodGet:
 		switch operation {
-		case opnGetCACert, opnGetCACaps:
+		case opnGetCACert, opnGetCACaps, opnGetNextCACert:
 			return request{
 				Operation: operation,
 				Message:   []byte{},
@@ -330,6 +330,26 @@ func GetCACert(ctx context.Context) (Response, error) {
 	return res, nil
 }
 
+// GetNextCACert returns the certificates of the CA that will replace the
+// current one in a SCEP response.
+func GetNextCACert(ctx context.Context) (Response, error) {
+	auth := scep.MustFromContext(ctx)
+	certs, err := auth.GetNextCACertificates(ctx)
+	if err != nil {
+		return Response{}, err
+	}
+
+	data, err := auth.SignNextCACertificates(ctx, certs)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return Response{
+		Operation: opnGetNextCACert,
+		Data:      data,
+	}, nil
+}
+
 // GetCACaps returns the CA capabilities in a SCEP response
 func GetCACaps(ctx context.Context) (Response, error) {
 	auth := scep.MustFromContext(ctx)
@@ -345,36 +365,39 @@ func GetCACaps(ctx context.Context) (Response, error) {
 
 // PKIOperation performs PKI operations and returns a SCEP response
 func PKIOperation(ctx context.Context, req request) (Response, error) {
-	// parse the message using smallscep implementation
-	microMsg, err := smallscep.ParsePKIMessage(req.Message)
+	// parse the message; this is essentially doing the same as
+	// smallscep.ParsePKIMessage, but it also supports the CertPoll, GetCert
+	// and GetCRL message types.
+	msg, err := scep.ParsePKIMessage(req.Message)
 	if err != nil {
 		// return the error, because we can't use the msg for creating a CertRep
 		return Response{}, fmt.Errorf("failed parsing SCEP request: %w", err)
 	}
 
-	// this is essentially doing the same as smallscep.ParsePKIMessage, but
-	// gives us access to the p7 itself in scep.PKIMessage. Essentially a small
-	// wrapper for the smallscep implementation.
-	p7, err := pkcs7.Parse(microMsg.Raw)
-	if err != nil {
-		return Response{}, err
-	}
-
-	// copy over properties to our internal PKIMessage
-	msg := &scep.PKIMessage{
-		TransactionID: microMsg.TransactionID,
-		MessageType:   microMsg.MessageType,
-		SenderNonce:   microMsg.SenderNonce,
-		Raw:           microMsg.Raw,
-		P7:            p7,
-	}
-
 	auth := scep.MustFromContext(ctx)
 	if err := auth.DecryptPKIEnvelope(ctx, msg); err != nil {
 		return Response{}, err
 	}
 
 	// NOTE: at this point we have sufficient information for returning nicely signed CertReps
+	switch msg.MessageType {
+	case smallscep.PKCSReq, smallscep.RenewalReq:
+		return enrollCertificate(ctx, msg)
+	case smallscep.CertPoll:
+		return pollCertificate(ctx, msg)
+	case smallscep.GetCert:
+		return getCertificate(ctx, msg)
+	case smallscep.GetCRL:
+		return getCRL(ctx, msg)
+	default:
+		scepErr := fmt.Errorf("unexpected message type: (%s)", string(msg.MessageType))
+		return createFailureResponse(ctx, nil, msg, smallscep.BadRequest, scepErr.Error(), scepErr)
+	}
+}
+
+// enrollCertificate handles PKCSReq and RenewalReq messages.
+func enrollCertificate(ctx context.Context, msg *scep.PKIMessage) (Response, error) {
+	auth := scep.MustFromContext(ctx)
 	csr := msg.CSRReqMessage.CSR
 	transactionID := string(msg.TransactionID)
 	challengePassword := msg.CSRReqMessage.ChallengePassword
@@ -384,20 +407,22 @@ func PKIOperation(ctx context.Context, req request) (Response, error) {
 	// even if using the renewal flow as described in the README.md. MicroMDM SCEP client also only does PKCSreq by default, unless
 	// a certificate exists; then it will use RenewalReq. Adding the challenge check here may be a small breaking change for clients.
 	// We'll have to see how it works out.
-	var signCSROpts []provisioner.SignCSROption
-	if msg.MessageType == smallscep.PKCSReq || msg.MessageType == smallscep.RenewalReq {
-		challengeOptions, err := auth.ValidateChallenge(ctx, csr, challengePassword, transactionID)
-		if err != nil {
-			if errors.Is(err, provisioner.ErrSCEPChallengeInvalid) {
-				return createFailureResponse(ctx, csr, msg, smallscep.BadRequest, err.Error(), err)
+	challengeOptions, err := auth.ValidateChallenge(ctx, csr, challengePassword, transactionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, provisioner.ErrSCEPChallengePending):
+			// the decision has been deferred; store the request so that
+			// the client can poll for the certificate.
+			if err := auth.CreatePendingRequest(ctx, msg); err != nil {
+				return createFailureResponse(ctx, csr, msg, smallscep.BadRequest, "internal server error; please see the certificate authority logs for more info", err)
 			}
+			return createPendingResponse(ctx, msg)
+		case errors.Is(err, provisioner.ErrSCEPChallengeInvalid):
+			return createFailureResponse(ctx, csr, msg, smallscep.BadRequest, err.Error(), err)
+		default:
 			scepErr := errors.New("failed validating challenge password")
 			return createFailureResponse(ctx, csr, msg, smallscep.BadRequest, scepErr.Error(), scepErr)
 		}
-		signCSROpts = append(signCSROpts, challengeOptions...)
-	} else {
-		scepErr := fmt.Errorf("unexpected message type: (%s)", string(msg.MessageType))
-		return createFailureResponse(ctx, csr, msg, smallscep.BadRequest, scepErr.Error(), scepErr)
 	}
 
 	// TODO: authorize renewal: we can authorize renewals with the challenge password (if reusable secrets are used).
@@ -408,6 +433,52 @@ func PKIOperation(ctx context.Context, req request) (Response, error) {
 	// Authentication by the (self-signed) certificate with an optional challenge is required; supporting renewals incl. verification
 	// of the client cert is not.
 
+	return signCertificate(ctx, msg, challengeOptions)
+}
+
+// pollCertificate handles CertPoll messages. The challenge of the pending
+// request is validated again, and the certificate is issued once the
+// webhooks allow the request.
+func pollCertificate(ctx context.Context, msg *scep.PKIMessage) (Response, error) {
+	auth := scep.MustFromContext(ctx)
+	if err := auth.LoadPendingRequest(ctx, msg); err != nil {
+		if errors.Is(err, scep.ErrPendingRequestNotFound) {
+			return createFailureResponse(ctx, nil, msg, smallscep.BadRequest, err.Error(), err)
+		}
+		return createFailureResponse(ctx, nil, msg, smallscep.BadRequest, "internal server error; please see the certificate authority logs for more info", err)
+	}
+
+	csr := msg.CSRReqMessage.CSR
+	transactionID := string(msg.TransactionID)
+	challengePassword := msg.CSRReqMessage.ChallengePassword
+
+	challengeOptions, err := auth.ValidateChallenge(ctx, csr, challengePassword, transactionID)
+	if errors.Is(err, provisioner.ErrSCEPChallengePending) {
+		return createPendingResponse(ctx, msg)
+	}
+
+	// the request has been decided; it can't be polled anymore.
+	if delErr := auth.DeletePendingRequest(ctx, msg); delErr != nil {
+		return createFailureResponse(ctx, csr, msg, smallscep.BadRequest, "internal server error; please see the certificate authority logs for more info", delErr)
+	}
+
+	if err != nil {
+		if errors.Is(err, provisioner.ErrSCEPChallengeInvalid) {
+			return createFailureResponse(ctx, csr, msg, smallscep.BadRequest, err.Error(), err)
+		}
+		scepErr := errors.New("failed validating challenge password")
+		return createFailureResponse(ctx, csr, msg, smallscep.BadRequest, scepErr.Error(), scepErr)
+	}
+
+	return signCertificate(ctx, msg, challengeOptions)
+}
+
+// signCertificate signs the CSR in msg and notifies the result.
+func signCertificate(ctx context.Context, msg *scep.PKIMessage, signCSROpts []provisioner.SignCSROption) (Response, error) {
+	auth := scep.MustFromContext(ctx)
+	csr := msg.CSRReqMessage.CSR
+	transactionID := string(msg.TransactionID)
+
 	certRep, err := auth.SignCSR(ctx, csr, msg, signCSROpts...)
 	if err != nil {
 		if notifyErr := auth.NotifyFailure(ctx, csr, transactionID, 0, err.Error()); notifyErr != nil {
@@ -431,6 +502,50 @@ func PKIOperation(ctx context.Context, req request) (Response, error) {
 	return res, nil
 }
 
+// getCertificate handles GetCert messages.
+func getCertificate(ctx context.Context, msg *scep.PKIMessage) (Response, error) {
+	auth := scep.MustFromContext(ctx)
+	cert, err := auth.GetCertificate(ctx, msg)
+	if err != nil {
+		if errors.Is(err, scep.ErrCertificateNotFound) {
+			return createFailureResponse(ctx, nil, msg, smallscep.BadCertID, err.Error(), err)
+		}
+		return createFailureResponse(ctx, nil, msg, smallscep.BadRequest, "internal server error; please see the certificate authority logs for more info", err)
+	}
+
+	certRep, err := auth.CreateCertResponse(ctx, msg, cert)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return Response{
+		Operation: opnPKIOperation,
+		Data:      certRep.Raw,
+	}, nil
+}
+
+// getCRL handles GetCRL messages.
+func getCRL(ctx context.Context, msg *scep.PKIMessage) (Response, error) {
+	auth := scep.MustFromContext(ctx)
+	crl, err := auth.GetCRL(ctx, msg)
+	if err != nil {
+		if errors.Is(err, scep.ErrCRLNotFound) {
+			return createFailureResponse(ctx, nil, msg, smallscep.BadCertID, err.Error(), err)
+		}
+		return createFailureResponse(ctx, nil, msg, smallscep.BadRequest, "internal server error; please see the certificate authority logs for more info", err)
+	}
+
+	certRep, err := auth.CreateCRLResponse(ctx, msg, crl)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return Response{
+		Operation: opnPKIOperation,
+		Data:      certRep.Raw,
+	}, nil
+}
+
 func formatCapabilities(caps []string) []byte {
 	return []byte(strings.Join(caps, "\r\n"))
 }
@@ -452,7 +567,23 @@ func writeResponse(w http.ResponseWriter, r *http.Request, res Response) {
 func fail(w http.ResponseWriter, r *http.Request, err error) {
 	log.Error(w, r, err)
 
-	http.Error(w, err.Error(), http.StatusInternalServerError)
+	status := http.StatusInternalServerError
+	if errors.Is(err, scep.ErrNextCANotAvailable) {
+		status = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func createPendingResponse(ctx context.Context, msg *scep.PKIMessage) (Response, error) {
+	auth := scep.MustFromContext(ctx)
+	certRepMsg, err := auth.CreatePendingResponse(ctx, msg)
+	if err != nil {
+		return Response{}, err
+	}
+	return Response{
+		Operation: opnPKIOperation,
+		Data:      certRepMsg.Raw,
+	}, nil
 }
 
 func createFailureResponse(ctx context.Context, csr *x509.CertificateRequest, msg *scep.PKIMessage, info smallscep.FailInfo, infoText string, failError error) (Response, error) {
@@ -477,6 +608,8 @@ func contentHeader(r Response) string {
 			return "application/x-x509-ca-ra-cert"
 		}
 		return "application/x-x509-ca-cert"
+	case opnGetNextCACert:
+		return "application/x-x509-next-ca-cert"
 	case opnPKIOperation:
 		return "application/x-pki-message"
 	}
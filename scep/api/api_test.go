@@ -3,18 +3,43 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"testing/iotest"
+	"time"
 
+	"github.com/smallstep/linkedca"
+	"github.com/smallstep/nosql/database"
+	"github.com/smallstep/pkcs7"
+	smallscep "github.com/smallstep/scep"
+	smallscepx509util "github.com/smallstep/scep/x509util"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/scep"
+	"github.com/smallstep/certificates/webhook"
 )
 
 func Test_decodeRequest(t *testing.T) {
@@ -111,6 +136,17 @@ func Test_decodeRequest(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "ok/get-GetNextCACert",
+			args: args{
+				r: httptest.NewRequest(http.MethodGet, "http://scep:8080/?operation=GetNextCACert", http.NoBody),
+			},
+			want: request{
+				Operation: "GetNextCACert",
+				Message:   []byte{},
+			},
+			wantErr: false,
+		},
 		{
 			name: "ok/get-PKIOperation",
 			args: args{
@@ -181,3 +217,356 @@ func Test_decodeRequest(t *testing.T) {
 		})
 	}
 }
+
+type mockSCEPDB struct {
+	db.MockAuthDB
+	pending map[string]*db.SCEPPendingRequest
+}
+
+func (m *mockSCEPDB) GetSCEPPendingRequest(id string) (*db.SCEPPendingRequest, error) {
+	if req, ok := m.pending[id]; ok {
+		return req, nil
+	}
+	return nil, database.ErrNotFound
+}
+
+func (m *mockSCEPDB) CreateSCEPPendingRequest(req *db.SCEPPendingRequest) error {
+	if _, ok := m.pending[req.ID]; ok {
+		return db.ErrAlreadyExists
+	}
+	m.pending[req.ID] = req
+	return nil
+}
+
+func (m *mockSCEPDB) DeleteSCEPPendingRequest(id string) error {
+	delete(m.pending, id)
+	return nil
+}
+
+type mockSignAuthority struct {
+	ca          *minica.CA
+	db          *mockSCEPDB
+	provisioner *provisioner.SCEP
+	issued      map[string]*x509.Certificate
+}
+
+func (m *mockSignAuthority) SignWithContext(_ context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	var certOptions []x509util.Option
+	for _, so := range signOpts {
+		if co, ok := so.(provisioner.CertificateOptions); ok {
+			certOptions = append(certOptions, co.Options(opts)...)
+		}
+	}
+	c, err := x509util.NewCertificate(cr, certOptions...)
+	if err != nil {
+		return nil, err
+	}
+	crt, err := m.ca.Sign(c.GetCertificate())
+	if err != nil {
+		return nil, err
+	}
+	m.issued[crt.SerialNumber.String()] = crt
+	return []*x509.Certificate{crt, m.ca.Intermediate}, nil
+}
+
+func (m *mockSignAuthority) LoadProvisionerByName(string) (provisioner.Interface, error) {
+	return m.provisioner, nil
+}
+
+func (m *mockSignAuthority) GetDatabase() db.AuthDB {
+	return m.db
+}
+
+var (
+	oidSCEPmessageType   = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 2}
+	oidSCEPpkiStatus     = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 3}
+	oidSCEPsenderNonce   = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 5}
+	oidSCEPtransactionID = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 7}
+)
+
+type testSCEPClient struct {
+	t         *testing.T
+	recipient *x509.Certificate
+	cert      *x509.Certificate
+	key       *rsa.PrivateKey
+}
+
+func newTestSCEPClient(t *testing.T, recipient *x509.Certificate) *testSCEPClient {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test.localhost"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testSCEPClient{t: t, recipient: recipient, cert: cert, key: key}
+}
+
+// request creates a signed SCEP request with the given envelope content.
+func (c *testSCEPClient) request(msgType smallscep.MessageType, content []byte) request {
+	c.t.Helper()
+	e7, err := pkcs7.Encrypt(content, []*x509.Certificate{c.recipient})
+	require.NoError(c.t, err)
+	sd, err := pkcs7.NewSignedData(e7)
+	require.NoError(c.t, err)
+	require.NoError(c.t, sd.AddSigner(c.cert, c.key, pkcs7.SignerInfoConfig{
+		ExtraSignedAttributes: []pkcs7.Attribute{
+			{Type: oidSCEPtransactionID, Value: smallscep.TransactionID("transaction-1")},
+			{Type: oidSCEPmessageType, Value: msgType},
+			{Type: oidSCEPsenderNonce, Value: smallscep.SenderNonce("nonce-1")},
+		},
+	}))
+	raw, err := sd.Finish()
+	require.NoError(c.t, err)
+	return request{Operation: opnPKIOperation, Message: raw}
+}
+
+// response parses a CertRep and returns the status and the degenerate
+// PKCS#7 content.
+func (c *testSCEPClient) response(res Response) (smallscep.PKIStatus, *pkcs7.PKCS7) {
+	c.t.Helper()
+	p7, err := pkcs7.Parse(res.Data)
+	require.NoError(c.t, err)
+	require.NoError(c.t, p7.Verify())
+	var status smallscep.PKIStatus
+	require.NoError(c.t, p7.UnmarshalSignedAttribute(oidSCEPpkiStatus, &status))
+	if len(p7.Content) == 0 {
+		return status, nil
+	}
+	e7, err := pkcs7.Parse(p7.Content)
+	require.NoError(c.t, err)
+	content, err := e7.Decrypt(c.cert, c.key)
+	require.NoError(c.t, err)
+	deg, err := pkcs7.Parse(content)
+	require.NoError(c.t, err)
+	return status, deg
+}
+
+func TestPKIOperation(t *testing.T) {
+	ca, err := minica.New(minica.WithGetSignerFunc(func() (crypto.Signer, error) {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}))
+	require.NoError(t, err)
+
+	// the webhook defers the decision until allowed is set
+	var allowed atomic.Bool
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req webhook.RequestBody
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "the-challenge", req.SCEPChallenge)
+		assert.Equal(t, "transaction-1", req.SCEPTransactionID)
+		assert.NoError(t, json.NewEncoder(w).Encode(webhook.ResponseBody{
+			Allow:   allowed.Load(),
+			Pending: !allowed.Load(),
+		}))
+	}))
+	t.Cleanup(srv.Close)
+
+	p := &provisioner.SCEP{
+		Name: "scep",
+		Type: "SCEP",
+		DecrypterCertificate: pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: ca.Intermediate.Raw,
+		}),
+		DecrypterKeyPEM: pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(ca.Signer.(*rsa.PrivateKey)),
+		}),
+		Options: &provisioner.Options{
+			Webhooks: []*provisioner.Webhook{{
+				ID:       "webhook-id",
+				Name:     "ScepChallenge",
+				Kind:     linkedca.Webhook_SCEPCHALLENGE.String(),
+				CertType: linkedca.Webhook_X509.String(),
+				URL:      srv.URL,
+				Secret:   "MTIzNAo=",
+			}},
+		},
+	}
+	require.NoError(t, p.Init(provisioner.Config{
+		Claims:        config.GlobalProvisionerClaims,
+		WebhookClient: srv.Client(),
+	}))
+
+	mdb := &mockSCEPDB{pending: map[string]*db.SCEPPendingRequest{}}
+	sa := &mockSignAuthority{ca: ca, db: mdb, provisioner: p, issued: map[string]*x509.Certificate{}}
+	mdb.MGetCertificate = func(serialNumber string) (*x509.Certificate, error) {
+		if crt, ok := sa.issued[serialNumber]; ok {
+			return crt, nil
+		}
+		return nil, database.ErrNotFound
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, ca.Intermediate, ca.Signer)
+	require.NoError(t, err)
+	mdb.MGetCRL = func() (*db.CertificateRevocationListInfo, error) {
+		return &db.CertificateRevocationListInfo{DER: crl, ExpiresAt: time.Now().Add(time.Hour)}, nil
+	}
+
+	auth, err := scep.New(sa, scep.Options{
+		Roots:         []*x509.Certificate{ca.Root},
+		Intermediates: []*x509.Certificate{ca.Intermediate},
+		SignerCert:    ca.Intermediate,
+		Signer:        ca.Signer,
+	})
+	require.NoError(t, err)
+	ctx := scep.NewContext(context.Background(), auth)
+	ctx = scep.NewProvisionerContext(ctx, p)
+
+	client := newTestSCEPClient(t, ca.Intermediate)
+	csr, err := x509util.CreateCertificateRequest("test.localhost", []string{"test.localhost"}, client.key)
+	require.NoError(t, err)
+	csrDER, err := smallscepx509util.CreateCertificateRequest(rand.Reader, &smallscepx509util.CertificateRequest{
+		CertificateRequest: *csr,
+		ChallengePassword:  "the-challenge",
+	}, client.key)
+	require.NoError(t, err)
+	poll, err := asn1.Marshal(scep.IssuerAndSubject{
+		Issuer:  asn1.RawValue{FullBytes: ca.Intermediate.RawSubject},
+		Subject: asn1.RawValue{FullBytes: csr.RawSubject},
+	})
+	require.NoError(t, err)
+
+	// the enrollment is deferred by the webhook
+	res, err := PKIOperation(ctx, client.request(smallscep.PKCSReq, csrDER))
+	require.NoError(t, err)
+	status, _ := client.response(res)
+	assert.Equal(t, smallscep.PENDING, status)
+	assert.Contains(t, mdb.pending, "scep/transaction-1")
+
+	// polling before the decision
+	res, err = PKIOperation(ctx, client.request(smallscep.CertPoll, poll))
+	require.NoError(t, err)
+	status, _ = client.response(res)
+	assert.Equal(t, smallscep.PENDING, status)
+
+	// polling with a different signer certificate
+	other := newTestSCEPClient(t, ca.Intermediate)
+	res, err = PKIOperation(ctx, other.request(smallscep.CertPoll, poll))
+	require.NoError(t, err)
+	status, _ = other.response(res)
+	assert.Equal(t, smallscep.FAILURE, status)
+	assert.Contains(t, mdb.pending, "scep/transaction-1")
+
+	// polling after the decision
+	allowed.Store(true)
+	res, err = PKIOperation(ctx, client.request(smallscep.CertPoll, poll))
+	require.NoError(t, err)
+	status, deg := client.response(res)
+	require.Equal(t, smallscep.SUCCESS, status)
+	require.Len(t, deg.Certificates, 1)
+	cert := deg.Certificates[0]
+	assert.Equal(t, "test.localhost", cert.Subject.CommonName)
+	assert.Empty(t, mdb.pending)
+
+	// the request can't be polled anymore
+	res, err = PKIOperation(ctx, client.request(smallscep.CertPoll, poll))
+	require.NoError(t, err)
+	status, _ = client.response(res)
+	assert.Equal(t, smallscep.FAILURE, status)
+
+	// get the issued certificate
+	ias, err := asn1.Marshal(scep.IssuerAndSerial{
+		Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+		SerialNumber: cert.SerialNumber,
+	})
+	require.NoError(t, err)
+	res, err = PKIOperation(ctx, client.request(smallscep.GetCert, ias))
+	require.NoError(t, err)
+	status, deg = client.response(res)
+	require.Equal(t, smallscep.SUCCESS, status)
+	require.Len(t, deg.Certificates, 1)
+	assert.Equal(t, cert.Raw, deg.Certificates[0].Raw)
+
+	// get an unknown certificate
+	unknown, err := asn1.Marshal(scep.IssuerAndSerial{
+		Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+		SerialNumber: big.NewInt(1234),
+	})
+	require.NoError(t, err)
+	res, err = PKIOperation(ctx, client.request(smallscep.GetCert, unknown))
+	require.NoError(t, err)
+	status, _ = client.response(res)
+	assert.Equal(t, smallscep.FAILURE, status)
+
+	// get the CRL
+	res, err = PKIOperation(ctx, client.request(smallscep.GetCRL, ias))
+	require.NoError(t, err)
+	status, deg = client.response(res)
+	require.Equal(t, smallscep.SUCCESS, status)
+	require.Len(t, deg.CRLs, 1)
+}
+
+func TestGetNextCACert(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	next, err := minica.New()
+	require.NoError(t, err)
+
+	p := &provisioner.SCEP{Name: "scep", Type: "SCEP", IncludeRoot: true}
+	sa := &mockSignAuthority{ca: ca, provisioner: p}
+
+	newContext := func(t *testing.T, opts scep.Options) context.Context {
+		t.Helper()
+		auth, err := scep.New(sa, opts)
+		require.NoError(t, err)
+		ctx := scep.NewContext(context.Background(), auth)
+		return scep.NewProvisionerContext(ctx, p)
+	}
+
+	opts := scep.Options{
+		Roots:         []*x509.Certificate{ca.Root},
+		Intermediates: []*x509.Certificate{ca.Intermediate},
+		SignerCert:    ca.Intermediate,
+		Signer:        ca.Signer,
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		opts := opts
+		opts.NextIntermediates = []*x509.Certificate{next.Intermediate}
+		ctx := newContext(t, opts)
+
+		res, err := GetNextCACert(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "application/x-x509-next-ca-cert", contentHeader(res))
+
+		p7, err := pkcs7.Parse(res.Data)
+		require.NoError(t, err)
+		require.NoError(t, p7.Verify())
+		assert.Equal(t, ca.Intermediate.Raw, p7.GetOnlySigner().Raw)
+		deg, err := pkcs7.Parse(p7.Content)
+		require.NoError(t, err)
+		require.Len(t, deg.Certificates, 2)
+		assert.Equal(t, next.Intermediate.Raw, deg.Certificates[0].Raw)
+		assert.Equal(t, ca.Root.Raw, deg.Certificates[1].Raw)
+
+		res, err = GetCACaps(ctx)
+		require.NoError(t, err)
+		assert.Contains(t, string(res.Data), "GetNextCACert")
+	})
+
+	t.Run("fail/not configured", func(t *testing.T) {
+		ctx := newContext(t, opts)
+
+		_, err := GetNextCACert(ctx)
+		assert.ErrorIs(t, err, scep.ErrNextCANotAvailable)
+
+		w := httptest.NewRecorder()
+		Get(w, httptest.NewRequest(http.MethodGet, "http://scep:8080/?operation=GetNextCACert", http.NoBody).WithContext(ctx))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		res, err := GetCACaps(ctx)
+		require.NoError(t, err)
+		assert.NotContains(t, string(res.Data), "GetNextCACert")
+	})
+}
@@ -1,12 +1,17 @@
 package scep
 
 import (
+	"bytes"
 	"context"
 	"crypto"
 	"crypto/x509"
+	"encoding/asn1"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/smallstep/pkcs7"
 	smallscep "github.com/smallstep/scep"
@@ -14,7 +19,10 @@ import (
 
 	"go.step.sm/crypto/x509util"
 
+	"github.com/smallstep/nosql/database"
+
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 )
 
 // Authority is the layer that handles all SCEP interactions.
@@ -22,6 +30,7 @@ type Authority struct {
 	signAuth             SignAuthority
 	roots                []*x509.Certificate
 	intermediates        []*x509.Certificate
+	nextIntermediates    []*x509.Certificate
 	defaultSigner        crypto.Signer
 	signerCertificate    *x509.Certificate
 	defaultDecrypter     crypto.Decrypter
@@ -74,6 +83,7 @@ func New(signAuth SignAuthority, opts Options) (*Authority, error) {
 		signAuth:             signAuth, // TODO: provide signAuth through context instead?
 		roots:                opts.Roots,
 		intermediates:        opts.Intermediates,
+		nextIntermediates:    opts.NextIntermediates,
 		defaultSigner:        opts.Signer,
 		signerCertificate:    opts.SignerCert,
 		defaultDecrypter:     opts.Decrypter,
@@ -129,7 +139,12 @@ func (a *Authority) UpdateProvisioners(scepProvisionerNames []string) {
 }
 
 var (
-	// TODO: check the default capabilities; https://tools.ietf.org/html/rfc8894#section-3.5.2
+	// defaultCapabilities are the capabilities advertised when a provisioner
+	// doesn't configure them; see https://tools.ietf.org/html/rfc8894#section-3.5.2.
+	// CertPoll, GetCert and GetCRL don't have a capability keyword. CertPoll
+	// is part of SCEPStandard, GetCert and GetCRL are optional operations
+	// that clients use without checking the capabilities. GetNextCACert is
+	// only advertised if the next CA is configured.
 	defaultCapabilities = []string{
 		"Renewal", // NOTE: removing this will result in macOS SCEP client stating the server doesn't support renewal, but it uses PKCSreq to do so.
 		"SHA-1",
@@ -186,6 +201,54 @@ func (a *Authority) GetCACertificates(ctx context.Context) (certs []*x509.Certif
 	return certs, nil
 }
 
+// ErrNextCANotAvailable is returned on GetNextCACert requests when the CA
+// that will replace the current one is not configured.
+var ErrNextCANotAvailable = errors.New("next CA certificate is not available")
+
+// GetNextCACertificates returns the certificate chain of the CA that will
+// replace the current one. Like in GetCACertificates, the CA roots are added
+// if the provisioner is configured to do so.
+func (a *Authority) GetNextCACertificates(ctx context.Context) ([]*x509.Certificate, error) {
+	if len(a.nextIntermediates) == 0 {
+		return nil, ErrNextCANotAvailable
+	}
+
+	p := provisionerFromContext(ctx)
+	certs := append([]*x509.Certificate{}, a.nextIntermediates...)
+	if p.ShouldIncludeRootInChain() {
+		certs = append(certs, a.roots...)
+	}
+
+	return certs, nil
+}
+
+// SignNextCACertificates creates the GetNextCACert response: a degenerate
+// PKCS#7 with the given certificates, wrapped in a PKCS#7 signed by the
+// current CA or RA signer, so that clients can verify the next CA before
+// trusting it; see https://tools.ietf.org/html/rfc8894#section-4.7.1.
+func (a *Authority) SignNextCACertificates(ctx context.Context, certs []*x509.Certificate) ([]byte, error) {
+	deg, err := smallscep.DegenerateCertificates(certs)
+	if err != nil {
+		return nil, fmt.Errorf("failed generating degenerate certificate: %w", err)
+	}
+
+	signedData, err := pkcs7.NewSignedData(deg)
+	if err != nil {
+		return nil, err
+	}
+
+	signerCert, signer, err := a.selectSigner(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed selecting signer: %w", err)
+	}
+
+	if err := signedData.AddSigner(signerCert, signer, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, err
+	}
+
+	return signedData.Finish()
+}
+
 // DecryptPKIEnvelope decrypts an enveloped message
 func (a *Authority) DecryptPKIEnvelope(ctx context.Context, msg *PKIMessage) error {
 	p7c, err := pkcs7.Parse(msg.P7.Content)
@@ -232,12 +295,49 @@ func (a *Authority) DecryptPKIEnvelope(ctx context.Context, msg *PKIMessage) err
 			ChallengePassword: cp,
 		}
 		return nil
+	case smallscep.GetCert, smallscep.GetCRL:
+		var ias IssuerAndSerial
+		if err := unmarshalEnvelope(msg.pkiEnvelope, &ias); err != nil {
+			return fmt.Errorf("parse issuerAndSerialNumber from pkiEnvelope: %w", err)
+		}
+		if !isName(ias.Issuer) || ias.SerialNumber == nil {
+			return errors.New("parse issuerAndSerialNumber from pkiEnvelope: invalid issuerAndSerialNumber")
+		}
+		msg.IssuerAndSerial = &ias
+		return nil
+	case smallscep.CertPoll:
+		var ias IssuerAndSubject
+		if err := unmarshalEnvelope(msg.pkiEnvelope, &ias); err != nil {
+			return fmt.Errorf("parse issuerAndSubject from pkiEnvelope: %w", err)
+		}
+		if !isName(ias.Issuer) || !isName(ias.Subject) {
+			return errors.New("parse issuerAndSubject from pkiEnvelope: invalid issuerAndSubject")
+		}
+		msg.IssuerAndSubject = &ias
+		return nil
 	default:
-		// this is for e.g. GetCRL, GetCert and CertPoll
-		return errors.New("not implemented")
+		return fmt.Errorf("message type %q is not supported", string(msg.MessageType))
 	}
 }
 
+// unmarshalEnvelope parses the DER encoded envelope into v, failing if there's
+// trailing data.
+func unmarshalEnvelope(envelope []byte, v any) error {
+	rest, err := asn1.Unmarshal(envelope, v)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errors.New("trailing data")
+	}
+	return nil
+}
+
+// isName returns true if the raw value looks like an encoded X.501 name.
+func isName(v asn1.RawValue) bool {
+	return v.Class == asn1.ClassUniversal && v.Tag == asn1.TagSequence && v.IsCompound
+}
+
 // SignCSR creates an x509.Certificate based on a CSR template and Cert Authority credentials
 // returns a new PKIMessage with CertRep data
 func (a *Authority) SignCSR(ctx context.Context, csr *x509.CertificateRequest, msg *PKIMessage, signCSROpts ...provisioner.SignCSROption) (*PKIMessage, error) {
@@ -326,9 +426,22 @@ func (a *Authority) SignCSR(ctx context.Context, csr *x509.CertificateRequest, m
 		return nil, fmt.Errorf("failed generating degenerate certificate: %w", err)
 	}
 
-	e7, err := a.encrypt(deg, msg.P7.Certificates, p.GetContentEncryptionAlgorithm())
-	if err != nil {
-		return nil, fmt.Errorf("failed encrypting degenerate certificate: %w", err)
+	return a.createCertRep(ctx, msg, smallscep.SUCCESS, deg, cert)
+}
+
+// createCertRep creates a CertRep message in response to msg with the given
+// status. The degenerate PKCS#7 content, if any, is encrypted to the
+// certificate that signed msg, and the issued certificate, if any, is added to
+// the signed data.
+func (a *Authority) createCertRep(ctx context.Context, msg *PKIMessage, status smallscep.PKIStatus, deg []byte, cert *x509.Certificate) (*PKIMessage, error) {
+	p := provisionerFromContext(ctx)
+
+	var e7 []byte
+	if deg != nil {
+		var err error
+		if e7, err = a.encrypt(deg, msg.P7.Certificates, p.GetContentEncryptionAlgorithm()); err != nil {
+			return nil, fmt.Errorf("failed encrypting degenerate content: %w", err)
+		}
 	}
 
 	// PKIMessageAttributes to be signed
@@ -340,7 +453,7 @@ func (a *Authority) SignCSR(ctx context.Context, csr *x509.CertificateRequest, m
 			},
 			{
 				Type:  oidSCEPpkiStatus,
-				Value: smallscep.SUCCESS,
+				Value: status,
 			},
 			{
 				Type:  oidSCEPmessageType,
@@ -365,7 +478,9 @@ func (a *Authority) SignCSR(ctx context.Context, csr *x509.CertificateRequest, m
 	// add the certificate into the signed data type
 	// this cert must be added before the signedData because the recipient will expect it
 	// as the first certificate in the array
-	signedData.AddCertificate(cert)
+	if cert != nil {
+		signedData.AddCertificate(cert)
+	}
 
 	signerCert, signer, err := a.selectSigner(ctx)
 	if err != nil {
@@ -383,7 +498,7 @@ func (a *Authority) SignCSR(ctx context.Context, csr *x509.CertificateRequest, m
 	}
 
 	cr := &CertRepMessage{
-		PKIStatus:      smallscep.SUCCESS,
+		PKIStatus:      status,
 		RecipientNonce: smallscep.RecipientNonce(msg.SenderNonce),
 		Certificate:    cert,
 		degenerate:     deg,
@@ -494,15 +609,259 @@ func (a *Authority) CreateFailureResponse(ctx context.Context, _ *x509.Certifica
 	return crepMsg, nil
 }
 
+// CreatePendingResponse creates a CertRep message with the PENDING status.
+// The client is expected to poll for the certificate using CertPoll messages.
+func (a *Authority) CreatePendingResponse(ctx context.Context, msg *PKIMessage) (*PKIMessage, error) {
+	return a.createCertRep(ctx, msg, smallscep.PENDING, nil, nil)
+}
+
+// CreateCertResponse creates a CertRep message with the given certificate, in
+// response to a GetCert message.
+func (a *Authority) CreateCertResponse(ctx context.Context, msg *PKIMessage, cert *x509.Certificate) (*PKIMessage, error) {
+	deg, err := smallscep.DegenerateCertificates([]*x509.Certificate{cert})
+	if err != nil {
+		return nil, fmt.Errorf("failed generating degenerate certificate: %w", err)
+	}
+	return a.createCertRep(ctx, msg, smallscep.SUCCESS, deg, cert)
+}
+
+// CreateCRLResponse creates a CertRep message with the given DER encoded CRL,
+// in response to a GetCRL message.
+func (a *Authority) CreateCRLResponse(ctx context.Context, msg *PKIMessage, crl []byte) (*PKIMessage, error) {
+	deg, err := degenerateCRL(crl)
+	if err != nil {
+		return nil, fmt.Errorf("failed generating degenerate CRL: %w", err)
+	}
+	return a.createCertRep(ctx, msg, smallscep.SUCCESS, deg, nil)
+}
+
+var (
+	// ErrPendingRequestNotFound is returned when a CertPoll message doesn't
+	// match a pending request.
+	ErrPendingRequestNotFound = errors.New("pending request not found")
+	// ErrCertificateNotFound is returned when a GetCert message doesn't match
+	// a certificate issued by the CA.
+	ErrCertificateNotFound = errors.New("certificate not found")
+	// ErrCRLNotFound is returned when a GetCRL message doesn't match the
+	// current CRL.
+	ErrCRLNotFound = errors.New("certificate revocation list not found")
+)
+
+// pendingRequestTTL is the time a pending request is kept. Clients polling
+// after that time will get a failure response.
+const pendingRequestTTL = 7 * 24 * time.Hour
+
+// pendingRequestID returns the id used to store a pending request. Transaction
+// ids are chosen by the clients, so they are scoped by provisioner.
+func pendingRequestID(provisionerName string, transactionID smallscep.TransactionID) string {
+	return provisionerName + "/" + string(transactionID)
+}
+
+// signerFingerprint returns the fingerprint of the certificate used to sign
+// the message, or an empty string if the message is not signed.
+func signerFingerprint(msg *PKIMessage) string {
+	if msg.SignerCert == nil {
+		return ""
+	}
+	return x509util.Fingerprint(msg.SignerCert)
+}
+
+// CreatePendingRequest stores the PKCSReq or RenewalReq message, so that the
+// enrollment can be completed when the client polls for the certificate. A
+// repeated request for a pending transaction is ignored.
+func (a *Authority) CreatePendingRequest(ctx context.Context, msg *PKIMessage) error {
+	pdb, err := a.pendingRequestDB()
+	if err != nil {
+		return err
+	}
+	fingerprint := signerFingerprint(msg)
+	if fingerprint == "" {
+		return errors.New("message does not have a signer certificate")
+	}
+
+	p := provisionerFromContext(ctx)
+	now := time.Now().UTC()
+	err = pdb.CreateSCEPPendingRequest(&db.SCEPPendingRequest{
+		ID:                pendingRequestID(p.GetName(), msg.TransactionID),
+		Provisioner:       p.GetName(),
+		TransactionID:     string(msg.TransactionID),
+		CSR:               msg.CSRReqMessage.RawDecrypted,
+		Challenge:         msg.CSRReqMessage.ChallengePassword,
+		SignerFingerprint: fingerprint,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+		ExpiresAt:         now.Add(pendingRequestTTL),
+	})
+	if err != nil && !errors.Is(err, db.ErrAlreadyExists) {
+		return fmt.Errorf("failed storing pending request: %w", err)
+	}
+	return nil
+}
+
+// LoadPendingRequest loads the pending request matching the CertPoll message,
+// and sets the CSR and challenge of the original request in msg. It returns
+// ErrPendingRequestNotFound if the request doesn't exist, it has expired, the
+// subject doesn't match, or the message is not signed with the certificate
+// used in the original request.
+func (a *Authority) LoadPendingRequest(ctx context.Context, msg *PKIMessage) error {
+	pdb, err := a.pendingRequestDB()
+	if err != nil {
+		return err
+	}
+
+	p := provisionerFromContext(ctx)
+	id := pendingRequestID(p.GetName(), msg.TransactionID)
+	req, err := pdb.GetSCEPPendingRequest(id)
+	switch {
+	case database.IsErrNotFound(err):
+		return ErrPendingRequestNotFound
+	case err != nil:
+		return fmt.Errorf("failed loading pending request: %w", err)
+	case time.Now().After(req.ExpiresAt):
+		if err := pdb.DeleteSCEPPendingRequest(id); err != nil {
+			return fmt.Errorf("failed deleting pending request: %w", err)
+		}
+		return ErrPendingRequestNotFound
+	case req.SignerFingerprint == "" || signerFingerprint(msg) != req.SignerFingerprint:
+		return ErrPendingRequestNotFound
+	}
+
+	csr, err := x509.ParseCertificateRequest(req.CSR)
+	if err != nil {
+		return fmt.Errorf("failed parsing pending request: %w", err)
+	}
+	if msg.IssuerAndSubject != nil && !bytes.Equal(msg.IssuerAndSubject.Subject.FullBytes, csr.RawSubject) {
+		return ErrPendingRequestNotFound
+	}
+
+	msg.CSRReqMessage = &smallscep.CSRReqMessage{
+		RawDecrypted:      req.CSR,
+		CSR:               csr,
+		ChallengePassword: req.Challenge,
+	}
+	return nil
+}
+
+// DeletePendingRequest deletes the pending request for the transaction in msg.
+func (a *Authority) DeletePendingRequest(ctx context.Context, msg *PKIMessage) error {
+	pdb, err := a.pendingRequestDB()
+	if err != nil {
+		return err
+	}
+
+	p := provisionerFromContext(ctx)
+	if err := pdb.DeleteSCEPPendingRequest(pendingRequestID(p.GetName(), msg.TransactionID)); err != nil && !database.IsErrNotFound(err) {
+		return fmt.Errorf("failed deleting pending request: %w", err)
+	}
+	return nil
+}
+
+// GetCertificate returns the certificate matching the issuer and serial number
+// of a GetCert message.
+func (a *Authority) GetCertificate(_ context.Context, msg *PKIMessage) (*x509.Certificate, error) {
+	adb, err := a.getDatabase()
+	if err != nil {
+		return nil, err
+	}
+
+	ias := msg.IssuerAndSerial
+	if ias == nil {
+		return nil, errors.New("message does not have an issuer and serial number")
+	}
+
+	cert, err := adb.GetCertificate(ias.SerialNumber.String())
+	switch {
+	case database.IsErrNotFound(err):
+		return nil, ErrCertificateNotFound
+	case err != nil:
+		return nil, fmt.Errorf("failed loading certificate: %w", err)
+	case !bytes.Equal(cert.RawIssuer, ias.Issuer.FullBytes):
+		return nil, ErrCertificateNotFound
+	default:
+		return cert, nil
+	}
+}
+
+// GetCRL returns the current DER encoded CRL if it has been issued by the
+// issuer of a GetCRL message.
+func (a *Authority) GetCRL(_ context.Context, msg *PKIMessage) ([]byte, error) {
+	adb, err := a.getDatabase()
+	if err != nil {
+		return nil, err
+	}
+	crlDB, ok := adb.(db.CertificateRevocationListDB)
+	if !ok {
+		return nil, errors.New("database does not support certificate revocation lists")
+	}
+
+	ias := msg.IssuerAndSerial
+	if ias == nil {
+		return nil, errors.New("message does not have an issuer and serial number")
+	}
+
+	info, err := crlDB.GetCRL()
+	switch {
+	case database.IsErrNotFound(err):
+		return nil, ErrCRLNotFound
+	case err != nil:
+		return nil, fmt.Errorf("failed loading certificate revocation list: %w", err)
+	case time.Now().After(info.ExpiresAt):
+		return nil, ErrCRLNotFound
+	}
+
+	crl, err := x509.ParseRevocationList(info.DER)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing certificate revocation list: %w", err)
+	}
+	if !bytes.Equal(crl.RawIssuer, ias.Issuer.FullBytes) {
+		return nil, ErrCRLNotFound
+	}
+
+	return info.DER, nil
+}
+
+// getDatabase returns the database of the sign authority, if available.
+func (a *Authority) getDatabase() (db.AuthDB, error) {
+	if da, ok := a.signAuth.(interface{ GetDatabase() db.AuthDB }); ok {
+		if adb := da.GetDatabase(); adb != nil {
+			return adb, nil
+		}
+	}
+	return nil, errors.New("database is not available")
+}
+
+// pendingRequestDB returns the database used to store pending requests.
+func (a *Authority) pendingRequestDB() (db.SCEPPendingRequestDB, error) {
+	adb, err := a.getDatabase()
+	if err != nil {
+		return nil, err
+	}
+	pdb, ok := adb.(db.SCEPPendingRequestDB)
+	if !ok {
+		return nil, errors.New("database does not support pending requests")
+	}
+	return pdb, nil
+}
+
 // GetCACaps returns the CA capabilities
 func (a *Authority) GetCACaps(ctx context.Context) []string {
 	p := provisionerFromContext(ctx)
 
 	caps := p.GetCapabilities()
 	if len(caps) == 0 {
+		if len(a.nextIntermediates) > 0 {
+			return append(slices.Clone(defaultCapabilities), "GetNextCACert")
+		}
 		return defaultCapabilities
 	}
 
+	// don't advertise the rollover if the next CA is not configured.
+	if len(a.nextIntermediates) == 0 {
+		caps = slices.DeleteFunc(slices.Clone(caps), func(c string) bool {
+			return strings.EqualFold(c, "GetNextCACert")
+		})
+	}
+
 	// TODO: validate the caps? Ensure they are the right format according to RFC?
 	// TODO: ensure that the capabilities are actually "enforced"/"verified" in code too:
 	// check that only parts of the spec are used in the implementation belonging to the capabilities.
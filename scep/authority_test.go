@@ -7,13 +7,19 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
+	"math/big"
 	"net/url"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/linkedca"
+	"github.com/smallstep/nosql/database"
 	"github.com/smallstep/pkcs7"
 	"github.com/smallstep/scep"
 	"github.com/stretchr/testify/assert"
@@ -247,3 +253,463 @@ func TestAuthority_SignCSR(t *testing.T) {
 		})
 	}
 }
+
+type mockPendingRequestDB struct {
+	db.MockAuthDB
+	pending map[string]*db.SCEPPendingRequest
+}
+
+func (m *mockPendingRequestDB) GetSCEPPendingRequest(id string) (*db.SCEPPendingRequest, error) {
+	if req, ok := m.pending[id]; ok {
+		return req, nil
+	}
+	return nil, database.ErrNotFound
+}
+
+func (m *mockPendingRequestDB) CreateSCEPPendingRequest(req *db.SCEPPendingRequest) error {
+	if _, ok := m.pending[req.ID]; ok {
+		return db.ErrAlreadyExists
+	}
+	m.pending[req.ID] = req
+	return nil
+}
+
+func (m *mockPendingRequestDB) DeleteSCEPPendingRequest(id string) error {
+	if _, ok := m.pending[id]; !ok {
+		return database.ErrNotFound
+	}
+	delete(m.pending, id)
+	return nil
+}
+
+type databaseSignAuthority struct {
+	signAuthority
+	db db.AuthDB
+}
+
+func (s *databaseSignAuthority) GetDatabase() db.AuthDB {
+	return s.db
+}
+
+func newTestAuthority(t *testing.T, adb db.AuthDB) (*Authority, *minica.CA, context.Context) {
+	t.Helper()
+	ca, err := minica.New(minica.WithGetSignerFunc(func() (crypto.Signer, error) {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}))
+	require.NoError(t, err)
+
+	var sa SignAuthority = &signAuthority{ca: ca}
+	if adb != nil {
+		sa = &databaseSignAuthority{signAuthority: signAuthority{ca: ca}, db: adb}
+	}
+
+	a, err := New(sa, Options{
+		Roots:                []*x509.Certificate{ca.Root},
+		Intermediates:        []*x509.Certificate{ca.Intermediate},
+		SignerCert:           ca.Intermediate,
+		Signer:               ca.Signer,
+		Decrypter:            ca.Signer.(*rsa.PrivateKey),
+		DecrypterCert:        ca.Intermediate,
+		SCEPProvisionerNames: []string{"scep"},
+	})
+	require.NoError(t, err)
+
+	p, err := a.LoadProvisionerByName("scep")
+	require.NoError(t, err)
+
+	return a, ca, NewProvisionerContext(context.Background(), p.(*provisioner.SCEP))
+}
+
+// newTestRequest creates a SCEP request with the given message type and
+// content, signed with a self-signed certificate.
+func newTestRequest(t *testing.T, recipient *x509.Certificate, msgType scep.MessageType, content []byte) (*x509.Certificate, crypto.Signer, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "SCEP client"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	e7, err := pkcs7.Encrypt(content, []*x509.Certificate{recipient})
+	require.NoError(t, err)
+	sd, err := pkcs7.NewSignedData(e7)
+	require.NoError(t, err)
+	require.NoError(t, sd.AddSigner(cert, key, pkcs7.SignerInfoConfig{
+		ExtraSignedAttributes: []pkcs7.Attribute{
+			{Type: oidSCEPtransactionID, Value: scep.TransactionID("transaction-1")},
+			{Type: oidSCEPmessageType, Value: msgType},
+			{Type: oidSCEPsenderNonce, Value: scep.SenderNonce("nonce-1")},
+		},
+	}))
+	raw, err := sd.Finish()
+	require.NoError(t, err)
+	return cert, key, raw
+}
+
+// decryptTestResponse parses a CertRep response and returns the pkiStatus and
+// the decrypted content.
+func decryptTestResponse(t *testing.T, raw []byte, cert *x509.Certificate, key crypto.Signer) (scep.PKIStatus, *pkcs7.PKCS7) {
+	t.Helper()
+	p7, err := pkcs7.Parse(raw)
+	require.NoError(t, err)
+	require.NoError(t, p7.Verify())
+	var status scep.PKIStatus
+	require.NoError(t, p7.UnmarshalSignedAttribute(oidSCEPpkiStatus, &status))
+	if len(p7.Content) == 0 {
+		return status, nil
+	}
+	e7, err := pkcs7.Parse(p7.Content)
+	require.NoError(t, err)
+	content, err := e7.Decrypt(cert, key)
+	require.NoError(t, err)
+	deg, err := pkcs7.Parse(content)
+	require.NoError(t, err)
+	return status, deg
+}
+
+func TestParsePKIMessage(t *testing.T) {
+	ca, err := minica.New(minica.WithGetSignerFunc(func() (crypto.Signer, error) {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}))
+	require.NoError(t, err)
+
+	_, _, getCert := newTestRequest(t, ca.Intermediate, scep.GetCert, []byte{0x30, 0x00})
+	_, _, certRep := newTestRequest(t, ca.Intermediate, scep.CertRep, []byte{0x30, 0x00})
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    scep.MessageType
+		wantErr bool
+	}{
+		{"ok", getCert, scep.GetCert, false},
+		{"fail/message type", certRep, "", true},
+		{"fail/parse", []byte("foo"), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePKIMessage(tt.data)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.MessageType)
+			assert.Equal(t, scep.TransactionID("transaction-1"), got.TransactionID)
+			assert.Equal(t, scep.SenderNonce("nonce-1"), got.SenderNonce)
+		})
+	}
+}
+
+func TestAuthority_DecryptPKIEnvelope(t *testing.T) {
+	a, ca, ctx := newTestAuthority(t, nil)
+
+	ias, err := asn1.Marshal(IssuerAndSerial{
+		Issuer:       asn1.RawValue{FullBytes: ca.Intermediate.RawSubject},
+		SerialNumber: big.NewInt(1234),
+	})
+	require.NoError(t, err)
+	iasub, err := asn1.Marshal(IssuerAndSubject{
+		Issuer:  asn1.RawValue{FullBytes: ca.Intermediate.RawSubject},
+		Subject: asn1.RawValue{FullBytes: ca.Root.RawSubject},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		msgType  scep.MessageType
+		content  []byte
+		validate func(*testing.T, *PKIMessage)
+		wantErr  bool
+	}{
+		{"ok/GetCert", scep.GetCert, ias, func(t *testing.T, msg *PKIMessage) {
+			require.NotNil(t, msg.IssuerAndSerial)
+			assert.Equal(t, ca.Intermediate.RawSubject, msg.IssuerAndSerial.Issuer.FullBytes)
+			assert.Equal(t, big.NewInt(1234), msg.IssuerAndSerial.SerialNumber)
+		}, false},
+		{"ok/GetCRL", scep.GetCRL, ias, func(t *testing.T, msg *PKIMessage) {
+			require.NotNil(t, msg.IssuerAndSerial)
+		}, false},
+		{"ok/CertPoll", scep.CertPoll, iasub, func(t *testing.T, msg *PKIMessage) {
+			require.NotNil(t, msg.IssuerAndSubject)
+			assert.Equal(t, ca.Intermediate.RawSubject, msg.IssuerAndSubject.Issuer.FullBytes)
+			assert.Equal(t, ca.Root.RawSubject, msg.IssuerAndSubject.Subject.FullBytes)
+		}, false},
+		{"fail/GetCert", scep.GetCert, iasub, nil, true},
+		{"fail/CertPoll", scep.CertPoll, ias, nil, true},
+		{"fail/UpdateReq", scep.UpdateReq, ias, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, raw := newTestRequest(t, ca.Intermediate, tt.msgType, tt.content)
+			msg, err := ParsePKIMessage(raw)
+			require.NoError(t, err)
+			err = a.DecryptPKIEnvelope(ctx, msg)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			tt.validate(t, msg)
+		})
+	}
+}
+
+func TestAuthority_pendingRequest(t *testing.T) {
+	mdb := &mockPendingRequestDB{pending: map[string]*db.SCEPPendingRequest{}}
+	a, ca, ctx := newTestAuthority(t, mdb)
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	csr, err := x509util.CreateCertificateRequest("jane@example.com", []string{"jane@example.com"}, signer)
+	require.NoError(t, err)
+	signerCert, err := ca.Sign(&x509.Certificate{Subject: pkix.Name{CommonName: "jane@example.com"}, PublicKey: signer.Public()})
+	require.NoError(t, err)
+	otherCert, err := ca.Sign(&x509.Certificate{Subject: pkix.Name{CommonName: "jane@example.com"}, PublicKey: signer.Public()})
+	require.NoError(t, err)
+
+	msg := &PKIMessage{
+		TransactionID: "transaction-1",
+		SignerCert:    signerCert,
+		CSRReqMessage: &scep.CSRReqMessage{
+			RawDecrypted:      csr.Raw,
+			CSR:               csr,
+			ChallengePassword: "the-challenge",
+		},
+	}
+	require.NoError(t, a.CreatePendingRequest(ctx, msg))
+	// repeated requests are ignored
+	require.NoError(t, a.CreatePendingRequest(ctx, msg))
+	require.Contains(t, mdb.pending, "scep/transaction-1")
+
+	poll := func(transactionID string, subject []byte) *PKIMessage {
+		return &PKIMessage{
+			TransactionID: scep.TransactionID(transactionID),
+			SignerCert:    signerCert,
+			IssuerAndSubject: &IssuerAndSubject{
+				Issuer:  asn1.RawValue{FullBytes: ca.Intermediate.RawSubject},
+				Subject: asn1.RawValue{FullBytes: subject},
+			},
+		}
+	}
+
+	got := poll("transaction-1", csr.RawSubject)
+	require.NoError(t, a.LoadPendingRequest(ctx, got))
+	assert.Equal(t, csr.Raw, got.CSRReqMessage.CSR.Raw)
+	assert.Equal(t, "the-challenge", got.CSRReqMessage.ChallengePassword)
+
+	assert.ErrorIs(t, a.LoadPendingRequest(ctx, poll("transaction-2", csr.RawSubject)), ErrPendingRequestNotFound)
+	assert.ErrorIs(t, a.LoadPendingRequest(ctx, poll("transaction-1", ca.Root.RawSubject)), ErrPendingRequestNotFound)
+
+	// the poll must be signed with the certificate of the original request
+	other := poll("transaction-1", csr.RawSubject)
+	other.SignerCert = otherCert
+	assert.ErrorIs(t, a.LoadPendingRequest(ctx, other), ErrPendingRequestNotFound)
+	other.SignerCert = nil
+	assert.ErrorIs(t, a.LoadPendingRequest(ctx, other), ErrPendingRequestNotFound)
+
+	require.NoError(t, a.DeletePendingRequest(ctx, got))
+	assert.Empty(t, mdb.pending)
+	assert.ErrorIs(t, a.LoadPendingRequest(ctx, poll("transaction-1", csr.RawSubject)), ErrPendingRequestNotFound)
+
+	// expired requests are removed
+	require.NoError(t, a.CreatePendingRequest(ctx, msg))
+	mdb.pending["scep/transaction-1"].ExpiresAt = time.Now().Add(-time.Minute)
+	assert.ErrorIs(t, a.LoadPendingRequest(ctx, poll("transaction-1", csr.RawSubject)), ErrPendingRequestNotFound)
+	assert.Empty(t, mdb.pending)
+
+	// the request must be signed
+	assert.Error(t, a.CreatePendingRequest(ctx, &PKIMessage{
+		TransactionID: "transaction-3",
+		CSRReqMessage: msg.CSRReqMessage,
+	}))
+
+	// the database is required
+	a, _, ctx = newTestAuthority(t, nil)
+	assert.Error(t, a.CreatePendingRequest(ctx, msg))
+}
+
+func TestAuthority_GetCertificate(t *testing.T) {
+	mdb := &mockPendingRequestDB{}
+	a, ca, ctx := newTestAuthority(t, mdb)
+
+	cert, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "jane@example.com"},
+		PublicKey: ca.Intermediate.PublicKey,
+	})
+	require.NoError(t, err)
+	mdb.MGetCertificate = func(serialNumber string) (*x509.Certificate, error) {
+		if serialNumber == cert.SerialNumber.String() {
+			return cert, nil
+		}
+		return nil, database.ErrNotFound
+	}
+
+	msg := func(issuer []byte, serial *big.Int) *PKIMessage {
+		return &PKIMessage{IssuerAndSerial: &IssuerAndSerial{
+			Issuer:       asn1.RawValue{FullBytes: issuer},
+			SerialNumber: serial,
+		}}
+	}
+
+	got, err := a.GetCertificate(ctx, msg(ca.Intermediate.RawSubject, cert.SerialNumber))
+	require.NoError(t, err)
+	assert.Equal(t, cert, got)
+
+	_, err = a.GetCertificate(ctx, msg(ca.Intermediate.RawSubject, big.NewInt(1)))
+	assert.ErrorIs(t, err, ErrCertificateNotFound)
+	_, err = a.GetCertificate(ctx, msg(ca.Root.RawSubject, cert.SerialNumber))
+	assert.ErrorIs(t, err, ErrCertificateNotFound)
+}
+
+func TestAuthority_GetCRL(t *testing.T) {
+	mdb := &mockPendingRequestDB{}
+	a, ca, ctx := newTestAuthority(t, mdb)
+
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, ca.Intermediate, ca.Signer)
+	require.NoError(t, err)
+
+	msg := &PKIMessage{IssuerAndSerial: &IssuerAndSerial{
+		Issuer:       asn1.RawValue{FullBytes: ca.Intermediate.RawSubject},
+		SerialNumber: big.NewInt(1234),
+	}}
+
+	tests := []struct {
+		name    string
+		getCRL  func() (*db.CertificateRevocationListInfo, error)
+		msg     *PKIMessage
+		want    []byte
+		wantErr error
+	}{
+		{"ok", func() (*db.CertificateRevocationListInfo, error) {
+			return &db.CertificateRevocationListInfo{DER: crl, ExpiresAt: time.Now().Add(time.Hour)}, nil
+		}, msg, crl, nil},
+		{"fail/not found", func() (*db.CertificateRevocationListInfo, error) {
+			return nil, database.ErrNotFound
+		}, msg, nil, ErrCRLNotFound},
+		{"fail/expired", func() (*db.CertificateRevocationListInfo, error) {
+			return &db.CertificateRevocationListInfo{DER: crl, ExpiresAt: time.Now().Add(-time.Minute)}, nil
+		}, msg, nil, ErrCRLNotFound},
+		{"fail/issuer", func() (*db.CertificateRevocationListInfo, error) {
+			return &db.CertificateRevocationListInfo{DER: crl, ExpiresAt: time.Now().Add(time.Hour)}, nil
+		}, &PKIMessage{IssuerAndSerial: &IssuerAndSerial{
+			Issuer:       asn1.RawValue{FullBytes: ca.Root.RawSubject},
+			SerialNumber: big.NewInt(1234),
+		}}, nil, ErrCRLNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mdb.MGetCRL = tt.getCRL
+			got, err := a.GetCRL(ctx, tt.msg)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAuthority_createResponses(t *testing.T) {
+	a, ca, ctx := newTestAuthority(t, nil)
+
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, ca.Intermediate, ca.Signer)
+	require.NoError(t, err)
+
+	clientCert, clientKey, raw := newTestRequest(t, ca.Intermediate, scep.GetCRL, []byte{0x30, 0x00})
+	msg, err := ParsePKIMessage(raw)
+	require.NoError(t, err)
+
+	t.Run("pending", func(t *testing.T) {
+		got, err := a.CreatePendingResponse(ctx, msg)
+		require.NoError(t, err)
+		status, deg := decryptTestResponse(t, got.Raw, clientCert, clientKey)
+		assert.Equal(t, scep.PENDING, status)
+		assert.Nil(t, deg)
+	})
+
+	t.Run("cert", func(t *testing.T) {
+		got, err := a.CreateCertResponse(ctx, msg, ca.Intermediate)
+		require.NoError(t, err)
+		status, deg := decryptTestResponse(t, got.Raw, clientCert, clientKey)
+		assert.Equal(t, scep.SUCCESS, status)
+		require.Len(t, deg.Certificates, 1)
+		assert.Equal(t, ca.Intermediate.Raw, deg.Certificates[0].Raw)
+	})
+
+	t.Run("crl", func(t *testing.T) {
+		got, err := a.CreateCRLResponse(ctx, msg, crl)
+		require.NoError(t, err)
+		status, deg := decryptTestResponse(t, got.Raw, clientCert, clientKey)
+		assert.Equal(t, scep.SUCCESS, status)
+		assert.Empty(t, deg.Certificates)
+		require.Len(t, deg.CRLs, 1)
+		want, err := x509.ParseRevocationList(crl)
+		require.NoError(t, err)
+		assert.Equal(t, want.RawTBSRevocationList, []byte(deg.CRLs[0].TBSCertList.Raw))
+	})
+}
+
+func TestAuthority_GetNextCACertificates(t *testing.T) {
+	a, ca, ctx := newTestAuthority(t, nil)
+
+	_, err := a.GetNextCACertificates(ctx)
+	assert.ErrorIs(t, err, ErrNextCANotAvailable)
+
+	next, err := minica.New()
+	require.NoError(t, err)
+	a.nextIntermediates = []*x509.Certificate{next.Intermediate}
+
+	certs, err := a.GetNextCACertificates(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{next.Intermediate}, certs)
+
+	data, err := a.SignNextCACertificates(ctx, certs)
+	require.NoError(t, err)
+
+	p7, err := pkcs7.Parse(data)
+	require.NoError(t, err)
+	require.NoError(t, p7.Verify())
+	require.NotNil(t, p7.GetOnlySigner())
+	assert.Equal(t, ca.Intermediate.Raw, p7.GetOnlySigner().Raw)
+
+	deg, err := pkcs7.Parse(p7.Content)
+	require.NoError(t, err)
+	require.Len(t, deg.Certificates, 1)
+	assert.Equal(t, next.Intermediate.Raw, deg.Certificates[0].Raw)
+}
+
+func TestAuthority_GetCACaps(t *testing.T) {
+	a, _, _ := newTestAuthority(t, nil)
+	next, err := minica.New()
+	require.NoError(t, err)
+
+	withCaps := func(caps ...string) context.Context {
+		return NewProvisionerContext(context.Background(), &provisioner.SCEP{Capabilities: caps})
+	}
+
+	assert.Equal(t, defaultCapabilities, a.GetCACaps(withCaps()))
+	assert.Equal(t, []string{"Renewal", "SHA-256"}, a.GetCACaps(withCaps("Renewal", "GetNextCACert", "SHA-256")))
+
+	a.nextIntermediates = []*x509.Certificate{next.Intermediate}
+	assert.Equal(t, append(slices.Clone(defaultCapabilities), "GetNextCACert"), a.GetCACaps(withCaps()))
+	assert.Equal(t, []string{"Renewal", "GetNextCACert", "SHA-256"}, a.GetCACaps(withCaps("Renewal", "GetNextCACert", "SHA-256")))
+	assert.NotContains(t, defaultCapabilities, "GetNextCACert")
+}
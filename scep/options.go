@@ -13,6 +13,9 @@ type Options struct {
 	// Intermediates points issuer certificate, along with any other bundled certificates
 	// to be returned in the chain for consumers.
 	Intermediates []*x509.Certificate `json:"-"`
+	// NextIntermediates contains the certificate chain of the CA that will
+	// replace the current one. It's returned in GetNextCACert responses.
+	NextIntermediates []*x509.Certificate `json:"-"`
 	// SignerCert points to the certificate of the CA signer. It usually is the same as the
 	// first certificate in the CertificateChain.
 	SignerCert *x509.Certificate `json:"-"`
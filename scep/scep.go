@@ -4,6 +4,9 @@ package scep
 import (
 	"crypto/x509"
 	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
 
 	"github.com/smallstep/pkcs7"
 	smallscep "github.com/smallstep/scep"
@@ -51,6 +54,16 @@ type PKIMessage struct {
 
 	*CertRepMessage
 
+	// IssuerAndSerial identifies the certificate in GetCert and GetCRL
+	// messages.
+	IssuerAndSerial *IssuerAndSerial
+
+	// IssuerAndSubject identifies the pending request in CertPoll messages.
+	IssuerAndSubject *IssuerAndSubject
+
+	// SignerCert is the certificate used to sign the message.
+	SignerCert *x509.Certificate
+
 	// DER Encoded PKIMessage
 	Raw []byte
 
@@ -74,3 +87,95 @@ type CertRepMessage struct {
 
 	degenerate []byte
 }
+
+// IssuerAndSerial is the content of GetCert and GetCRL messages.
+type IssuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// IssuerAndSubject is the content of CertPoll messages.
+type IssuerAndSubject struct {
+	Issuer  asn1.RawValue
+	Subject asn1.RawValue
+}
+
+// ParsePKIMessage parses and verifies a PKCS#7 signed SCEP request. Unlike
+// smallscep.ParsePKIMessage it supports the CertPoll, GetCert and GetCRL
+// message types. The envelope is not decrypted.
+func ParsePKIMessage(data []byte) (*PKIMessage, error) {
+	p7, err := pkcs7.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing pkcs7 data: %w", err)
+	}
+	if err := p7.Verify(); err != nil {
+		return nil, fmt.Errorf("error verifying pkcs7 signature: %w", err)
+	}
+
+	var tID smallscep.TransactionID
+	if err := p7.UnmarshalSignedAttribute(oidSCEPtransactionID, &tID); err != nil {
+		return nil, fmt.Errorf("error parsing transactionID attribute: %w", err)
+	}
+	var msgType smallscep.MessageType
+	if err := p7.UnmarshalSignedAttribute(oidSCEPmessageType, &msgType); err != nil {
+		return nil, fmt.Errorf("error parsing messageType attribute: %w", err)
+	}
+
+	switch msgType {
+	case smallscep.PKCSReq, smallscep.UpdateReq, smallscep.RenewalReq,
+		smallscep.CertPoll, smallscep.GetCert, smallscep.GetCRL:
+	default:
+		return nil, fmt.Errorf("unsupported message type %q", string(msgType))
+	}
+
+	var sn smallscep.SenderNonce
+	if err := p7.UnmarshalSignedAttribute(oidSCEPsenderNonce, &sn); err != nil {
+		return nil, fmt.Errorf("error parsing senderNonce attribute: %w", err)
+	}
+	if len(sn) == 0 {
+		return nil, errors.New("pkiMessage must include senderNonce attribute")
+	}
+
+	return &PKIMessage{
+		TransactionID: tID,
+		MessageType:   msgType,
+		SenderNonce:   sn,
+		SignerCert:    p7.GetOnlySigner(),
+		Raw:           data,
+		P7:            p7,
+	}, nil
+}
+
+// contentInfo is the PKCS#7 ContentInfo type.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// degenerateSignedData is a PKCS#7 SignedData type without signers.
+type degenerateSignedData struct {
+	Version                    int
+	DigestAlgorithmIdentifiers []asn1.RawValue `asn1:"set"`
+	ContentInfo                contentInfo
+	CRLs                       []asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos                []asn1.RawValue `asn1:"set"`
+}
+
+// degenerateCRL creates a degenerate PKCS#7 signed data structure
+// containing only the given DER encoded CRL. The pkcs7 package only
+// supports creating these structures with certificates.
+func degenerateCRL(crl []byte) ([]byte, error) {
+	sd := degenerateSignedData{
+		Version:     1,
+		ContentInfo: contentInfo{ContentType: pkcs7.OIDData},
+		CRLs:        []asn1.RawValue{{FullBytes: crl}},
+	}
+	content, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: pkcs7.OIDSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: content, IsCompound: true},
+	})
+}
@@ -29,25 +29,45 @@ var (
 		"ssh_hosts",
 		"ssh_users",
 		"ssh_host_principals",
+		"ssh_host_inventory",
+		"ssh_access_requests",
+		"ssh_certs_index",
+		"scep_pending_requests",
+		"scep_challenges",
+		"intermediate_rotation",
+		"x509_certs_backend",
+		"ssh_certs_principal_index",
+		"ssh_certs_key_id_index",
+		"migrations",
+		"cmp_transactions",
 	}
 	acmeTables = []string{
 		"acme_accounts",
 		"acme_keyID_accountID_index",
 		"acme_authzs",
+		"acme_account_identifier_authz_index",
 		"acme_challenges",
 		"nonces",
 		"acme_orders",
 		"acme_account_orders_index",
+		"acme_account_order_history_index",
+		"acme_provisioner_accounts_index",
+		"acme_account_certs_index",
+		"acme_star_orders",
+		"acme_finalize_jobs",
 		"acme_certs",
 		"acme_serial_certs_index",
 		"acme_external_account_keys",
 		"acme_external_account_keyID_reference_index",
 		"acme_external_account_keyID_provisionerID_index",
+		"acme_migrations",
 	}
 	adminTables = []string{
 		"admins",
 		"provisioners",
 		"authority_policies",
+		"ssh_options_policies",
+		"cel_policies",
 	}
 )
 
@@ -87,7 +87,7 @@ func TestBlocksUnsupportedMessageType(t *testing.T) {
 	requireHealthyCA(t, caClient)
 
 	scepClient := createSCEPClient(t, c.caURL, c.root)
-	cert, err := scepClient.requestCertificate(t, withMessageType(scep.CertPoll))
+	cert, err := scepClient.requestCertificate(t, withMessageType(scep.UpdateReq))
 	require.Error(t, err)
 	require.Nil(t, cert)
 
@@ -13,6 +13,9 @@ type ResponseBody struct {
 	Data  any    `json:"data"`
 	Allow bool   `json:"allow"`
 	Error *Error `json:"error,omitempty"`
+	// Pending is used by SCEPCHALLENGE webhooks to defer the decision. SCEP
+	// clients will be asked to poll for the certificate later.
+	Pending bool `json:"pending,omitempty"`
 }
 
 // Error provides details explaining why the webhook was not permitted.
@@ -64,6 +67,18 @@ type SSHCertificate struct {
 	ValidAfter   uint64 `json:"validAfter"`
 }
 
+// SSHAccessRequest is the just-in-time SSH access request sent to webhook
+// servers for approval.
+type SSHAccessRequest struct {
+	ID              string   `json:"id"`
+	Subject         string   `json:"subject"`
+	HostGroup       string   `json:"hostGroup,omitempty"`
+	Principals      []string `json:"principals"`
+	SourceAddresses []string `json:"sourceAddresses,omitempty"`
+	Justification   string   `json:"justification"`
+	Validity        string   `json:"validity"`
+}
+
 // AttestationData is data validated by acme device-attest-01 challenge
 type AttestationData struct {
 	PermanentIdentifier string `json:"permanentIdentifier"`
@@ -93,6 +108,8 @@ type RequestBody struct {
 	X509Certificate        *X509Certificate        `json:"x509Certificate,omitempty"`
 	SSHCertificateRequest  *SSHCertificateRequest  `json:"sshCertificateRequest,omitempty"`
 	SSHCertificate         *SSHCertificate         `json:"sshCertificate,omitempty"`
+	// Only set for SSH access request webhooks
+	SSHAccessRequest *SSHAccessRequest `json:"sshAccessRequest,omitempty"`
 	// Only set for SCEP webhook requests
 	SCEPChallenge        string `json:"scepChallenge,omitempty"`
 	SCEPTransactionID    string `json:"scepTransactionID,omitempty"`